@@ -0,0 +1,18 @@
+package main
+
+import "context"
+
+// confirmStatus mirrors a deployment's status reaction with a one-line reply in the message's thread when
+// ACCESSIBLE_STATUS is set, since an emoji alone is invisible to screen readers and email digests
+func (a *App) confirmStatus(ctx context.Context, d *Deployment) {
+	if !a.config.AccessibleStatus || d.Channel == "" {
+		return
+	}
+	// A failure reply already says so, with the reason
+	if d.Status == StatusFailed && a.flagEnabled(ctx, FlagFailureThreadReplies, d.Repository, d.TriggeredBy) {
+		return
+	}
+	if err := a.postThreadMessage(ctx, d.Channel, d.Ts, a.deploymentSummary(d)); err != nil {
+		logError("Error confirming %s status of deployment %s: %v", d.Status, d.ID, err)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+)
+
+// defaultCloudWatchNamespace is the namespace of the deployment metric unless annotations set one
+const defaultCloudWatchNamespace = "VibeDeploy"
+
+// cloudWatchMetric is the metric each successful deployment puts a data point of 1 in
+const cloudWatchMetric = "Deployment"
+
+var annotationsHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// AnnotationsConfig is the annotations section of the repos config file: the dashboards and APM providers that
+// mark deployments
+type AnnotationsConfig struct {
+	Grafana    *GrafanaConfig    `yaml:"grafana"`
+	CloudWatch *CloudWatchConfig `yaml:"cloudwatch"`
+	NewRelic   *NewRelicConfig   `yaml:"newrelic"`
+	Honeycomb  *HoneycombConfig  `yaml:"honeycomb"`
+}
+
+// GrafanaConfig is a Grafana instance whose annotations API deployments are posted to
+type GrafanaConfig struct {
+	URL string `yaml:"url"`
+	// TokenSecret names a service account token in the secrets provider
+	TokenSecret string `yaml:"token_secret"`
+}
+
+// CloudWatchConfig is where deployments are put as a metric, for CloudWatch dashboards to plot as markers.
+// Credentials come from the usual AWS environment, shared config or instance role.
+type CloudWatchConfig struct {
+	Region    string `yaml:"region"`
+	Namespace string `yaml:"namespace"`
+	// Endpoint overrides https://monitoring.<region>.amazonaws.com, e.g. for LocalStack
+	Endpoint string `yaml:"endpoint"`
+}
+
+func (c *AnnotationsConfig) validate() error {
+	if c.Grafana != nil {
+		u, err := url.Parse(c.Grafana.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("annotations grafana url %q must be an http(s) URL", c.Grafana.URL)
+		}
+		if c.Grafana.TokenSecret == "" {
+			return fmt.Errorf("annotations grafana needs token_secret")
+		}
+	}
+	if c.CloudWatch != nil && c.CloudWatch.Region == "" {
+		return fmt.Errorf("annotations cloudwatch needs region")
+	}
+	if c.NewRelic != nil {
+		if err := c.NewRelic.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Honeycomb != nil {
+		if err := c.Honeycomb.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RepoAnnotationsConfig is the annotations section of a repository's settings
+type RepoAnnotationsConfig struct {
+	// DashboardUID limits the Grafana annotation to one dashboard; without it the annotation is organization-wide
+	DashboardUID string `yaml:"dashboard_uid"`
+	// Tags are added to the deployment, repository and environment tags of the Grafana annotation
+	Tags []string `yaml:"tags"`
+	// CloudWatch also puts the deployment metric
+	CloudWatch bool `yaml:"cloudwatch"`
+	// Service is the repository's New Relic APM application and Honeycomb dataset, which get deployment markers
+	Service string `yaml:"service"`
+	// Environments override the dashboard and tags of environments of the promotion chain
+	Environments map[string]AnnotationTarget `yaml:"environments"`
+}
+
+// AnnotationTarget is how one environment's deployments are annotated
+type AnnotationTarget struct {
+	DashboardUID string   `yaml:"dashboard_uid"`
+	Tags         []string `yaml:"tags"`
+	Service      string   `yaml:"service"`
+	// Skip leaves the environment's deployments unannotated
+	Skip bool `yaml:"skip"`
+}
+
+// target resolves the annotation of an environment's deployments
+func (c *RepoAnnotationsConfig) target(environment string) AnnotationTarget {
+	target := AnnotationTarget{DashboardUID: c.DashboardUID, Tags: append([]string{}, c.Tags...), Service: c.Service}
+	if override, ok := c.Environments[environment]; ok {
+		if override.DashboardUID != "" {
+			target.DashboardUID = override.DashboardUID
+		}
+		if override.Service != "" {
+			target.Service = override.Service
+		}
+		target.Tags = append(target.Tags, override.Tags...)
+		target.Skip = override.Skip
+	}
+	return target
+}
+
+// annotationText is the marker's label, e.g. "Deployed its-the-vibe/VibeMerge@1a2b3c4 to prod by U123"
+func annotationText(d *Deployment) string {
+	text := "Deployed " + d.Repository
+	if d.Build.GitSHA != "" {
+		text += "@" + shortSHA(d.Build.GitSHA)
+	} else {
+		text += " " + d.Branch
+	}
+	if d.Environment != "" {
+		text += " to " + d.Environment
+	}
+	if d.TriggeredBy != "" {
+		text += " by " + d.TriggeredBy
+	}
+	return text
+}
+
+// annotateDeployment marks a successful deployment on the repository's dashboards. Like the other
+// integrations, failures are logged and never affect the deployment.
+func (a *App) annotateDeployment(ctx context.Context, d *Deployment) {
+	if a.reposConfig == nil || a.reposConfig.Annotations == nil {
+		return
+	}
+	repoConfig := a.repoConfig(d.Repository).Annotations
+	if repoConfig == nil {
+		return
+	}
+	target := repoConfig.target(d.Environment)
+	if target.Skip {
+		return
+	}
+	config := a.reposConfig.Annotations
+	at := time.Now().UTC()
+	if d.FinishedAt != nil {
+		at = *d.FinishedAt
+	}
+
+	if config.Grafana != nil {
+		if err := a.postGrafanaAnnotation(ctx, config.Grafana, target, d, at); err != nil {
+			logError("Error annotating deployment %s in Grafana: %v", d.ID, err)
+		} else {
+			logInfo("Annotated deployment %s in Grafana", d.ID)
+		}
+	}
+	if config.CloudWatch != nil && repoConfig.CloudWatch {
+		if err := putDeploymentMetric(ctx, config.CloudWatch, d, at); err != nil {
+			logError("Error putting CloudWatch metric of deployment %s: %v", d.ID, err)
+		} else {
+			logInfo("Put CloudWatch metric of deployment %s", d.ID)
+		}
+	}
+	a.markAPM(ctx, config, target.Service, d)
+}
+
+// postGrafanaAnnotation creates the deployment's annotation through Grafana's HTTP API
+func (a *App) postGrafanaAnnotation(ctx context.Context, config *GrafanaConfig, target AnnotationTarget, d *Deployment, at time.Time) error {
+	token, err := a.secrets.Secret(ctx, config.TokenSecret)
+	if err != nil {
+		return fmt.Errorf("could not resolve the Grafana token: %w", err)
+	}
+	tags := []string{"deployment", d.Repository}
+	if d.Environment != "" {
+		tags = append(tags, d.Environment)
+	}
+	annotation := map[string]interface{}{
+		"time": at.UnixMilli(),
+		"tags": append(tags, target.Tags...),
+		"text": annotationText(d),
+	}
+	if target.DashboardUID != "" {
+		annotation["dashboardUID"] = target.DashboardUID
+	}
+	data, err := json.Marshal(annotation)
+	if err != nil {
+		return fmt.Errorf("failed to marshal annotation: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(config.URL, "/")+"/api/annotations", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	return doAnnotationRequest(req)
+}
+
+// putDeploymentMetric puts a data point of the deployment metric, dimensioned by repository and environment,
+// through CloudWatch's query API
+func putDeploymentMetric(ctx context.Context, config *CloudWatchConfig, d *Deployment, at time.Time) error {
+	awsConfig, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(config.Region))
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	credentials, err := awsConfig.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get AWS credentials: %w", err)
+	}
+
+	namespace := config.Namespace
+	if namespace == "" {
+		namespace = defaultCloudWatchNamespace
+	}
+	form := url.Values{
+		"Action":                         {"PutMetricData"},
+		"Version":                        {"2010-08-01"},
+		"Namespace":                      {namespace},
+		"MetricData.member.1.MetricName": {cloudWatchMetric},
+		"MetricData.member.1.Value":      {"1"},
+		"MetricData.member.1.Unit":       {"Count"},
+		"MetricData.member.1.Timestamp":  {at.Format(time.RFC3339)},
+		"MetricData.member.1.Dimensions.member.1.Name":  {"Repository"},
+		"MetricData.member.1.Dimensions.member.1.Value": {d.Repository},
+	}
+	if d.Environment != "" {
+		form.Set("MetricData.member.1.Dimensions.member.2.Name", "Environment")
+		form.Set("MetricData.member.1.Dimensions.member.2.Value", d.Environment)
+	}
+	body := form.Encode()
+
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = "https://monitoring." + config.Region + ".amazonaws.com/"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	hash := sha256.Sum256([]byte(body))
+	if err := v4.NewSigner().SignHTTP(ctx, credentials, req, hex.EncodeToString(hash[:]), "monitoring", config.Region, time.Now()); err != nil {
+		return fmt.Errorf("failed to sign request: %w", err)
+	}
+	return doAnnotationRequest(req)
+}
+
+// doAnnotationRequest sends a request and turns an error status into an error
+func doAnnotationRequest(req *http.Request) error {
+	resp, err := annotationsHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", req.URL.Host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s returned %s: %s", req.URL.Host, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
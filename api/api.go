@@ -0,0 +1,9 @@
+// Package api holds the OpenAPI description of the VibeDeploy HTTP API.
+package api
+
+import _ "embed"
+
+// OpenAPISpec is the OpenAPI 3 document served at /api/openapi.json
+//
+//go:embed openapi.json
+var OpenAPISpec []byte
@@ -0,0 +1,136 @@
+// Package client is a Go client for the VibeDeploy HTTP API described in api/openapi.json. Its types and methods,
+// one per operation of the spec, are generated into client_gen.go; regenerate them after changing the spec.
+package client
+
+//go:generate go run ./gen -spec ../openapi.json -out client_gen.go
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Error is returned for non-2xx responses
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("vibedeploy API returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Client calls the VibeDeploy HTTP API
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// Option customises a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests (e.g. to add authentication or TLS settings)
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithAPIKey authenticates every request with a VibeDeploy API key
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// New creates a client for the API served at baseURL (e.g. "http://vibedeploy:8080")
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// call sends a request with an optional JSON body and decodes the JSON response into out, unless out is nil
+func (c *Client) call(ctx context.Context, method, path string, query url.Values, header http.Header, body, out interface{}) error {
+	resp, err := c.do(ctx, method, path, query, header, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", path, err)
+	}
+	return nil
+}
+
+// stream sends a request and returns the raw response body; the caller must close it
+func (c *Client) stream(ctx context.Context, method, path string, query url.Values, header http.Header, body interface{}) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, method, path, query, header, body)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, header http.Header, body interface{}) (*http.Response, error) {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		// Raw bodies, such as webhook payloads, are sent as they are
+		payload, ok := body.(json.RawMessage)
+		if !ok {
+			var err error
+			if payload, err = json.Marshal(body); err != nil {
+				return nil, fmt.Errorf("failed to marshal %s request: %w", path, err)
+			}
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request to %s failed: %w", path, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,508 @@
+// Command gen writes the Go client's types and methods, client_gen.go, from the OpenAPI document in
+// api/openapi.json, so the client follows the spec. Run it with `go generate ./api/client`.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// methods are the path item keys that are operations, in the order they are generated
+var methods = []string{"get", "put", "post", "patch", "delete"}
+
+// initialisms are the words of property and parameter names that Go spells in capitals
+var initialisms = map[string]string{
+	"api": "API", "cpu": "CPU", "http": "HTTP", "id": "ID", "json": "JSON", "oidc": "OIDC", "pr": "PR",
+	"sbom": "SBOM", "sboms": "SBOMs", "sha": "SHA", "sha256": "SHA256", "url": "URL",
+}
+
+// object is a JSON object that remembers the order of its keys, so the client follows the spec's order
+type object struct {
+	keys   []string
+	values map[string]json.RawMessage
+}
+
+func (o *object) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return fmt.Errorf("expected an object")
+	}
+	o.values = make(map[string]json.RawMessage)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key := tok.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		o.keys = append(o.keys, key)
+		o.values[key] = value
+	}
+	return nil
+}
+
+type spec struct {
+	Paths      object `json:"paths"`
+	Components struct {
+		Schemas   object              `json:"schemas"`
+		Responses map[string]response `json:"responses"`
+	} `json:"components"`
+}
+
+type schema struct {
+	Ref                  string   `json:"$ref"`
+	Type                 string   `json:"type"`
+	Format               string   `json:"format"`
+	Description          string   `json:"description"`
+	Nullable             bool     `json:"nullable"`
+	Required             []string `json:"required"`
+	Properties           object   `json:"properties"`
+	Items                *schema  `json:"items"`
+	AdditionalProperties *schema  `json:"additionalProperties"`
+}
+
+type parameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description"`
+	Schema      schema `json:"schema"`
+}
+
+type mediaType struct {
+	Schema schema `json:"schema"`
+}
+
+type response struct {
+	Ref     string               `json:"$ref"`
+	Content map[string]mediaType `json:"content"`
+}
+
+type operation struct {
+	OperationID string      `json:"operationId"`
+	Summary     string      `json:"summary"`
+	Parameters  []parameter `json:"parameters"`
+	RequestBody *struct {
+		Required bool                 `json:"required"`
+		Content  map[string]mediaType `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]response `json:"responses"`
+}
+
+// generator accumulates the generated source
+type generator struct {
+	spec spec
+	out  bytes.Buffer
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.out, format, args...)
+}
+
+func main() {
+	specPath := flag.String("spec", "../openapi.json", "OpenAPI document to generate the client from")
+	outPath := flag.String("out", "client_gen.go", "file to write the client to")
+	flag.Parse()
+
+	data, err := os.ReadFile(*specPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	source, err := generate(data)
+	if err != nil {
+		log.Fatalf("Failed to generate the client from %s: %v", *specPath, err)
+	}
+	if err := os.WriteFile(*outPath, source, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generate returns the formatted client source for an OpenAPI document
+func generate(data []byte) ([]byte, error) {
+	g := &generator{}
+	if err := json.Unmarshal(data, &g.spec); err != nil {
+		return nil, fmt.Errorf("failed to parse the spec: %w", err)
+	}
+
+	for _, name := range g.spec.Components.Schemas.keys {
+		var s schema
+		if err := json.Unmarshal(g.spec.Components.Schemas.values[name], &s); err != nil {
+			return nil, fmt.Errorf("schema %s: %w", name, err)
+		}
+		if err := g.schemaType(name, s); err != nil {
+			return nil, fmt.Errorf("schema %s: %w", name, err)
+		}
+	}
+	for _, path := range g.spec.Paths.keys {
+		var item map[string]json.RawMessage
+		if err := json.Unmarshal(g.spec.Paths.values[path], &item); err != nil {
+			return nil, fmt.Errorf("path %s: %w", path, err)
+		}
+		for _, method := range methods {
+			raw, ok := item[method]
+			if !ok {
+				continue
+			}
+			var op operation
+			if err := json.Unmarshal(raw, &op); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+			if err := g.operation(method, path, op); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+		}
+	}
+
+	// Only the packages the code uses are imported, which descriptions in comments don't count towards
+	code := g.out.String()
+	var uncommented strings.Builder
+	for _, line := range strings.Split(code, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "//") {
+			uncommented.WriteString(line + "\n")
+		}
+	}
+	var imports []string
+	for _, pkg := range []string{"context", "encoding/json", "io", "net/http", "net/url", "strconv", "time"} {
+		name := pkg[strings.LastIndex(pkg, "/")+1:]
+		if strings.Contains(uncommented.String(), name+".") {
+			imports = append(imports, fmt.Sprintf("%q", pkg))
+		}
+	}
+	source := "// Code generated by go run ./gen from api/openapi.json; DO NOT EDIT.\n\npackage client\n\nimport (\n" +
+		strings.Join(imports, "\n") + "\n)\n" + code
+	formatted, err := format.Source([]byte(source))
+	if err != nil {
+		return nil, fmt.Errorf("generated invalid Go: %w", err)
+	}
+	return formatted, nil
+}
+
+// schemaType writes the type of a component schema
+func (g *generator) schemaType(name string, s schema) error {
+	typ, err := g.goType(s, true)
+	if err != nil {
+		return err
+	}
+	g.printf("\n// %s is the %s schema", name, name)
+	if s.Description != "" {
+		g.printf(": %s", sentence(s.Description))
+	}
+	g.printf("\ntype %s %s\n", name, typ)
+	return nil
+}
+
+// goType returns the Go type of a schema; optional references and times are pointers, so absent ones stay absent
+func (g *generator) goType(s schema, required bool) (string, error) {
+	pointer := ""
+	if s.Nullable || (!required && (s.Ref != "" || s.Format == "date-time")) {
+		pointer = "*"
+	}
+	if s.Ref != "" {
+		return pointer + refName(s.Ref), nil
+	}
+	switch s.Type {
+	case "string":
+		if s.Format == "date-time" {
+			return pointer + "time.Time", nil
+		}
+		return pointer + "string", nil
+	case "integer":
+		if s.Format == "int64" {
+			return pointer + "int64", nil
+		}
+		return pointer + "int", nil
+	case "number":
+		return pointer + "float64", nil
+	case "boolean":
+		return pointer + "bool", nil
+	case "array":
+		if s.Items == nil {
+			return "", fmt.Errorf("array without items")
+		}
+		item, err := g.goType(*s.Items, true)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + item, nil
+	case "object":
+		if len(s.Properties.keys) > 0 {
+			return g.structType(s)
+		}
+		if s.AdditionalProperties != nil {
+			value := "json.RawMessage"
+			if a := s.AdditionalProperties; a.Type != "object" || len(a.Properties.keys) > 0 {
+				var err error
+				if value, err = g.goType(*a, true); err != nil {
+					return "", err
+				}
+			}
+			return "map[string]" + value, nil
+		}
+		return "json.RawMessage", nil
+	}
+	return "", fmt.Errorf("unsupported schema type %q", s.Type)
+}
+
+// structType returns a struct with a field for each of a schema's properties
+func (g *generator) structType(s schema) (string, error) {
+	required := make(map[string]bool, len(s.Required))
+	for _, name := range s.Required {
+		required[name] = true
+	}
+	var b strings.Builder
+	b.WriteString("struct {\n")
+	for _, name := range s.Properties.keys {
+		var property schema
+		if err := json.Unmarshal(s.Properties.values[name], &property); err != nil {
+			return "", fmt.Errorf("property %s: %w", name, err)
+		}
+		typ, err := g.goType(property, required[name])
+		if err != nil {
+			return "", fmt.Errorf("property %s: %w", name, err)
+		}
+		tag := name
+		if !required[name] {
+			tag += ",omitempty"
+		}
+		if property.Description != "" {
+			fmt.Fprintf(&b, "// %s\n", property.Description)
+		}
+		fmt.Fprintf(&b, "%s %s `json:%q`\n", goName(name), typ, tag)
+	}
+	b.WriteString("}")
+	return b.String(), nil
+}
+
+// operation writes the client method of an operation, and the type of its query and header parameters
+func (g *generator) operation(method, path string, op operation) error {
+	if op.OperationID == "" {
+		return fmt.Errorf("operation without an operationId")
+	}
+	name := upperFirst(op.OperationID)
+
+	// Path parameters are arguments; query and header parameters go in a <Name>Params struct
+	var pathParams, otherParams []parameter
+	for _, p := range op.Parameters {
+		if p.In == "path" {
+			pathParams = append(pathParams, p)
+		} else {
+			otherParams = append(otherParams, p)
+		}
+	}
+	args := []string{"ctx context.Context"}
+	for _, p := range pathParams {
+		args = append(args, argName(p.Name)+" string")
+	}
+	if len(otherParams) > 0 {
+		g.printf("\n// %sParams are the query and header parameters of %s\ntype %sParams struct {\n", name, name, name)
+		for _, p := range otherParams {
+			typ, err := paramType(p)
+			if err != nil {
+				return fmt.Errorf("parameter %s: %w", p.Name, err)
+			}
+			if p.Description != "" {
+				g.printf("// %s\n", p.Description)
+			}
+			g.printf("%s %s\n", goName(p.Name), typ)
+		}
+		g.printf("}\n")
+		args = append(args, "params "+name+"Params")
+	}
+
+	hasBody := false
+	if op.RequestBody != nil {
+		media, ok := op.RequestBody.Content["application/json"]
+		if !ok {
+			return fmt.Errorf("request body without application/json content")
+		}
+		typ, err := g.goType(media.Schema, op.RequestBody.Required)
+		if err != nil {
+			return fmt.Errorf("request body: %w", err)
+		}
+		args = append(args, "body "+typ)
+		hasBody = true
+	}
+
+	result, decoded, err := g.result(op)
+	if err != nil {
+		return err
+	}
+	returns := "error"
+	if result != "" {
+		returns = "(" + result + ", error)"
+	}
+
+	g.printf("\n// %s is %s %s: %s\n", name, strings.ToUpper(method), path, sentence(op.Summary))
+	g.printf("func (c *Client) %s(%s) %s {\n", name, strings.Join(args, ", "), returns)
+
+	target := fmt.Sprintf("%q", path)
+	for _, p := range pathParams {
+		target = strings.Replace(target, "{"+p.Name+"}", `" + url.PathEscape(`+argName(p.Name)+`) + "`, 1)
+	}
+	target = strings.TrimSuffix(strings.TrimPrefix(strings.ReplaceAll(target, ` + ""`, ""), `"" + `), ` + ""`)
+
+	query, header := "nil", "nil"
+	for _, p := range otherParams {
+		field := "params." + goName(p.Name)
+		switch p.In {
+		case "query":
+			if query == "nil" {
+				g.printf("query := url.Values{}\n")
+				query = "query"
+			}
+			switch typ, _ := paramType(p); typ {
+			case "[]string":
+				g.printf("for _, v := range %s {\nquery.Add(%q, v)\n}\n", field, p.Name)
+			case "int":
+				g.printf("if %s != 0 {\nquery.Set(%q, strconv.Itoa(%s))\n}\n", field, p.Name, field)
+			case "bool":
+				g.printf("if %s {\nquery.Set(%q, \"true\")\n}\n", field, p.Name)
+			default:
+				g.printf("if %s != \"\" {\nquery.Set(%q, %s)\n}\n", field, p.Name, field)
+			}
+		case "header":
+			if header == "nil" {
+				g.printf("header := http.Header{}\n")
+				header = "header"
+			}
+			g.printf("if %s != \"\" {\nheader.Set(%q, %s)\n}\n", field, p.Name, field)
+		default:
+			return fmt.Errorf("parameter %s is in %s, which the generator doesn't support", p.Name, p.In)
+		}
+	}
+
+	payload := "nil"
+	if hasBody {
+		payload = "body"
+		if !op.RequestBody.Required {
+			// An absent optional body sends none, rather than a JSON null
+			g.printf("var payload interface{}\nif body != nil {\npayload = body\n}\n")
+			payload = "payload"
+		}
+	}
+
+	call := fmt.Sprintf("http.Method%s, %s, %s, %s, %s", upperFirst(method), target, query, header, payload)
+	switch {
+	case result == "":
+		g.printf("return c.call(ctx, %s, nil)\n", call)
+	case result == "io.ReadCloser":
+		g.printf("return c.stream(ctx, %s)\n", call)
+	case strings.HasPrefix(result, "*"):
+		g.printf("var out %s\nif err := c.call(ctx, %s, &out); err != nil {\nreturn nil, err\n}\nreturn &out, nil\n", decoded, call)
+	default:
+		g.printf("var out %s\nerr := c.call(ctx, %s, &out)\nreturn out, err\n", decoded, call)
+	}
+	g.printf("}\n")
+	return nil
+}
+
+// result returns what an operation's method returns, and the type its JSON response is decoded into. Operations
+// without a response body return "", and those with other media types the body itself.
+func (g *generator) result(op operation) (string, string, error) {
+	var codes []string
+	for code := range op.Responses {
+		if strings.HasPrefix(code, "2") {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == 0 {
+		return "", "", fmt.Errorf("no 2xx response")
+	}
+	sort.Strings(codes)
+	resp := op.Responses[codes[0]]
+	if resp.Ref != "" {
+		resp = g.spec.Components.Responses[refName(resp.Ref)]
+	}
+	if len(resp.Content) == 0 {
+		return "", "", nil
+	}
+	media, ok := resp.Content["application/json"]
+	if !ok || len(resp.Content) > 1 {
+		return "io.ReadCloser", "", nil
+	}
+	typ, err := g.goType(media.Schema, true)
+	if err != nil {
+		return "", "", fmt.Errorf("response: %w", err)
+	}
+	if media.Schema.Ref != "" {
+		return "*" + typ, typ, nil
+	}
+	return typ, typ, nil
+}
+
+// paramType returns the Go type of a query or header parameter
+func paramType(p parameter) (string, error) {
+	switch p.Schema.Type {
+	case "string":
+		return "string", nil
+	case "integer":
+		return "int", nil
+	case "boolean":
+		return "bool", nil
+	case "array":
+		if p.Schema.Items != nil && p.Schema.Items.Type == "string" {
+			return "[]string", nil
+		}
+	}
+	return "", fmt.Errorf("unsupported parameter type %q", p.Schema.Type)
+}
+
+// goName turns a snake_case property or a dashed header name into an exported Go name
+func goName(name string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' }) {
+		if initialism, ok := initialisms[strings.ToLower(word)]; ok {
+			b.WriteString(initialism)
+		} else {
+			b.WriteString(upperFirst(word))
+		}
+	}
+	return b.String()
+}
+
+// argName returns the argument name of a path parameter
+func argName(name string) string {
+	if _, ok := initialisms[strings.ToLower(name)]; ok {
+		return strings.ToLower(name)
+	}
+	return lowerFirst(goName(name))
+}
+
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+// sentence lowercases the first word of a description so it can follow a colon, leaving names such as "GitHub" alone
+func sentence(s string) string {
+	word := s
+	if i := strings.IndexAny(s, " -"); i >= 0 {
+		word = s[:i]
+	}
+	if len(word) > 1 && strings.ToLower(word[1:]) != word[1:] {
+		return s
+	}
+	return lowerFirst(s)
+}
@@ -0,0 +1,177 @@
+package poppitv1
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	poppitpb "github.com/its-the-vibe/VibeDeploy/proto/poppit/v1"
+)
+
+// Content types a payload can be encoded with
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// protobufMarker prefixes protobuf payloads so readers can tell them apart from JSON, which is never marked
+var protobufMarker = []byte(ContentTypeProtobuf + "\n")
+
+// ContentType reports how a payload is encoded, from its marker
+func ContentType(data []byte) string {
+	if bytes.HasPrefix(data, protobufMarker) {
+		return ContentTypeProtobuf
+	}
+	return ContentTypeJSON
+}
+
+// EncodeCommand encodes a Command as JSON, or as a marked protobuf message
+func EncodeCommand(cmd *Command, contentType string) ([]byte, error) {
+	switch contentType {
+	case ContentTypeJSON:
+		return json.Marshal(cmd)
+	case ContentTypeProtobuf:
+		return MarshalProtobuf(cmd.toProto())
+	default:
+		return nil, fmt.Errorf("unsupported content type %q", contentType)
+	}
+}
+
+// EncodeCommandOutput encodes a CommandOutput as JSON, or as a marked protobuf message
+func EncodeCommandOutput(output *CommandOutput, contentType string) ([]byte, error) {
+	switch contentType {
+	case ContentTypeJSON:
+		return json.Marshal(output)
+	case ContentTypeProtobuf:
+		return MarshalProtobuf(output.toProto())
+	default:
+		return nil, fmt.Errorf("unsupported content type %q", contentType)
+	}
+}
+
+// ParseCommand decodes a Command in either encoding, ignoring unknown fields and skipping validation
+func ParseCommand(data []byte) (*Command, error) {
+	if ContentType(data) == ContentTypeProtobuf {
+		var pb poppitpb.Command
+		if err := proto.Unmarshal(data[len(protobufMarker):], &pb); err != nil {
+			return nil, err
+		}
+		return commandFromProto(&pb), nil
+	}
+	var cmd Command
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return nil, err
+	}
+	return &cmd, nil
+}
+
+// ParseCommandOutput decodes a CommandOutput in either encoding, ignoring unknown fields and skipping validation
+func ParseCommandOutput(data []byte) (*CommandOutput, error) {
+	if ContentType(data) == ContentTypeProtobuf {
+		var pb poppitpb.CommandOutput
+		if err := proto.Unmarshal(data[len(protobufMarker):], &pb); err != nil {
+			return nil, err
+		}
+		return commandOutputFromProto(&pb), nil
+	}
+	var output CommandOutput
+	if err := json.Unmarshal(data, &output); err != nil {
+		return nil, err
+	}
+	return &output, nil
+}
+
+// MarshalProtobuf encodes any protobuf message with the content-type marker, for payloads outside this package
+func MarshalProtobuf(m proto.Message) ([]byte, error) {
+	payload, err := proto.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, protobufMarker...), payload...), nil
+}
+
+// unmarshalStrict decodes a marked protobuf message, rejecting fields this version doesn't define
+func unmarshalStrict(data []byte, m proto.Message) error {
+	if err := proto.Unmarshal(data[len(protobufMarker):], m); err != nil {
+		return err
+	}
+	if hasUnknownFields(m.ProtoReflect()) {
+		return errors.New("message has unknown fields")
+	}
+	return nil
+}
+
+func hasUnknownFields(m protoreflect.Message) bool {
+	found := len(m.GetUnknown()) > 0
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Message() != nil && !fd.IsList() && !fd.IsMap() && hasUnknownFields(v.Message()) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+func (c *Command) toProto() *poppitpb.Command {
+	pb := &poppitpb.Command{
+		Repo:     c.Repo,
+		Branch:   c.Branch,
+		Type:     c.Type,
+		Dir:      c.Dir,
+		Commands: c.Commands,
+		Env:      c.Env,
+		Metadata: c.Metadata.toProto(),
+	}
+	if len(c.Timeouts) > 0 {
+		pb.Timeouts = make(map[string]int32, len(c.Timeouts))
+		for command, seconds := range c.Timeouts {
+			pb.Timeouts[command] = int32(seconds)
+		}
+	}
+	return pb
+}
+
+func commandFromProto(pb *poppitpb.Command) *Command {
+	cmd := &Command{
+		Repo:     pb.GetRepo(),
+		Branch:   pb.GetBranch(),
+		Type:     pb.GetType(),
+		Dir:      pb.GetDir(),
+		Commands: pb.GetCommands(),
+		Env:      pb.GetEnv(),
+		Metadata: metadataFromProto(pb.GetMetadata()),
+	}
+	if len(pb.GetTimeouts()) > 0 {
+		cmd.Timeouts = make(map[string]int, len(pb.GetTimeouts()))
+		for command, seconds := range pb.GetTimeouts() {
+			cmd.Timeouts[command] = int(seconds)
+		}
+	}
+	return cmd
+}
+
+func (m *CommandMetadata) toProto() *poppitpb.CommandMetadata {
+	if m == nil {
+		return nil
+	}
+	return &poppitpb.CommandMetadata{Channel: m.Channel, Ts: m.Ts, DeploymentId: m.DeploymentID, Workflow: m.Workflow}
+}
+
+func metadataFromProto(pb *poppitpb.CommandMetadata) *CommandMetadata {
+	if pb == nil {
+		return nil
+	}
+	return &CommandMetadata{Channel: pb.GetChannel(), Ts: pb.GetTs(), DeploymentID: pb.GetDeploymentId(), Workflow: pb.GetWorkflow()}
+}
+
+func (o *CommandOutput) toProto() *poppitpb.CommandOutput {
+	return &poppitpb.CommandOutput{Metadata: o.Metadata.toProto(), Type: o.Type, Command: o.Command, Output: o.Output, ExitCode: int32(o.ExitCode)}
+}
+
+func commandOutputFromProto(pb *poppitpb.CommandOutput) *CommandOutput {
+	return &CommandOutput{Metadata: metadataFromProto(pb.GetMetadata()), Type: pb.GetType(), Command: pb.GetCommand(), Output: pb.GetOutput(), ExitCode: int(pb.GetExitCode())}
+}
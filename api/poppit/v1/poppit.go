@@ -0,0 +1,155 @@
+// Package poppitv1 defines version 1 of the payloads VibeDeploy and Poppit exchange over Redis:
+// the Command VibeDeploy pushes to a Poppit list, and the CommandOutput Poppit publishes for each step.
+//
+// The JSON Schema documents embedded here describe the same payloads for consumers that are not
+// written in Go. Payloads may instead be protobuf-encoded with the messages in proto/poppit/v1,
+// marked with their content type (see ContentType). A breaking change to either payload belongs
+// in a new version of this package.
+package poppitv1
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	poppitpb "github.com/its-the-vibe/VibeDeploy/proto/poppit/v1"
+)
+
+// CommandSchema is the JSON Schema of a Command payload
+//
+//go:embed command.schema.json
+var CommandSchema []byte
+
+// CommandOutputSchema is the JSON Schema of a CommandOutput payload
+//
+//go:embed output.schema.json
+var CommandOutputSchema []byte
+
+// Command is a pipeline for Poppit to run in a repository's directory, one command after another
+type Command struct {
+	Repo     string   `json:"repo"`
+	Branch   string   `json:"branch"`
+	Type     string   `json:"type"`
+	Dir      string   `json:"dir"`
+	Commands []string `json:"commands"`
+	// Timeouts are per-command output deadlines in seconds, keyed by the command
+	Timeouts map[string]int `json:"timeouts,omitempty"`
+	// Env holds environment variables the executor sets for every command
+	Env      map[string]string `json:"env,omitempty"`
+	Metadata *CommandMetadata  `json:"metadata,omitempty"`
+}
+
+// CommandMetadata is passed through Poppit untouched, so output can be matched to its deployment
+type CommandMetadata struct {
+	Channel      string `json:"channel"`
+	Ts           string `json:"ts"`
+	DeploymentID string `json:"deployment_id,omitempty"`
+	Workflow     string `json:"workflow,omitempty"`
+}
+
+// CommandOutput is the output of one command of a Command, published once the command has run
+type CommandOutput struct {
+	Metadata *CommandMetadata `json:"metadata"`
+	Type     string           `json:"type"`
+	Command  string           `json:"command"`
+	Output   string           `json:"output"`
+	// ExitCode is the command's exit status. Zero, which executors that don't report it leave it at, is success.
+	ExitCode int `json:"exit_code,omitempty"`
+}
+
+// Validate checks the fields a Command must have for Poppit to run it
+func (c *Command) Validate() error {
+	var errs []error
+	for _, field := range []struct{ name, value string }{{"repo", c.Repo}, {"branch", c.Branch}, {"type", c.Type}, {"dir", c.Dir}} {
+		if field.value == "" {
+			errs = append(errs, fmt.Errorf("%s is required", field.name))
+		}
+	}
+	if len(c.Commands) == 0 {
+		errs = append(errs, errors.New("commands must not be empty"))
+	}
+	for i, command := range c.Commands {
+		if command == "" {
+			errs = append(errs, fmt.Errorf("commands[%d] is empty", i))
+		}
+	}
+	for command, seconds := range c.Timeouts {
+		if seconds <= 0 {
+			errs = append(errs, fmt.Errorf("timeout for %q must be positive", command))
+		}
+		if !contains(c.Commands, command) {
+			errs = append(errs, fmt.Errorf("timeout for %q names no command in the pipeline", command))
+		}
+	}
+	for name := range c.Env {
+		if name == "" {
+			errs = append(errs, errors.New("env has an empty variable name"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks the fields a CommandOutput must have for VibeDeploy to match it to a step
+func (o *CommandOutput) Validate() error {
+	var errs []error
+	if o.Type == "" {
+		errs = append(errs, errors.New("type is required"))
+	}
+	if o.Command == "" {
+		errs = append(errs, errors.New("command is required"))
+	}
+	return errors.Join(errs...)
+}
+
+// DecodeCommand strictly decodes and validates a Command payload in either encoding; unknown fields are an error
+func DecodeCommand(data []byte) (*Command, error) {
+	var cmd Command
+	if ContentType(data) == ContentTypeProtobuf {
+		var pb poppitpb.Command
+		if err := unmarshalStrict(data, &pb); err != nil {
+			return nil, fmt.Errorf("invalid command payload: %w", err)
+		}
+		cmd = *commandFromProto(&pb)
+	} else if err := decodeStrict(data, &cmd); err != nil {
+		return nil, fmt.Errorf("invalid command payload: %w", err)
+	}
+	if err := cmd.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid command payload: %w", err)
+	}
+	return &cmd, nil
+}
+
+// DecodeCommandOutput strictly decodes and validates a CommandOutput payload in either encoding; unknown fields are an error
+func DecodeCommandOutput(data []byte) (*CommandOutput, error) {
+	var output CommandOutput
+	if ContentType(data) == ContentTypeProtobuf {
+		var pb poppitpb.CommandOutput
+		if err := unmarshalStrict(data, &pb); err != nil {
+			return nil, fmt.Errorf("invalid command output payload: %w", err)
+		}
+		output = *commandOutputFromProto(&pb)
+	} else if err := decodeStrict(data, &output); err != nil {
+		return nil, fmt.Errorf("invalid command output payload: %w", err)
+	}
+	if err := output.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid command output payload: %w", err)
+	}
+	return &output, nil
+}
+
+func decodeStrict(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,234 @@
+package poppitv1
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	poppitpb "github.com/its-the-vibe/VibeDeploy/proto/poppit/v1"
+)
+
+// schemaDocument is the part of a JSON Schema the contract tests compare against the Go types
+type schemaDocument struct {
+	Required   []string                   `json:"required"`
+	Properties map[string]json.RawMessage `json:"properties"`
+	Defs       map[string]schemaDocument  `json:"$defs"`
+}
+
+func parseSchema(t *testing.T, data []byte) schemaDocument {
+	t.Helper()
+	var schema schemaDocument
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+	return schema
+}
+
+// jsonFields returns a struct's JSON field names, and which of them are always present (no omitempty)
+func jsonFields(v interface{}) (fields, always []string) {
+	typ := reflect.TypeOf(v)
+	for i := 0; i < typ.NumField(); i++ {
+		name, options, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		fields = append(fields, name)
+		if !strings.Contains(options, "omitempty") {
+			always = append(always, name)
+		}
+	}
+	sort.Strings(fields)
+	sort.Strings(always)
+	return fields, always
+}
+
+func propertyNames(schema schemaDocument) []string {
+	var names []string
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sorted(values []string) []string {
+	values = append([]string{}, values...)
+	sort.Strings(values)
+	return values
+}
+
+// subset reports whether every value of a is in b
+func subset(a, b []string) bool {
+	for _, value := range a {
+		if !contains(b, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSchemasMatchTypes(t *testing.T) {
+	command := parseSchema(t, CommandSchema)
+	output := parseSchema(t, CommandOutputSchema)
+	metadata, ok := command.Defs["metadata"]
+	if !ok {
+		t.Fatal("command schema has no metadata definition")
+	}
+
+	for _, tc := range []struct {
+		name   string
+		schema schemaDocument
+		value  interface{}
+	}{
+		{"Command", command, Command{}},
+		{"CommandMetadata", metadata, CommandMetadata{}},
+		{"CommandOutput", output, CommandOutput{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fields, always := jsonFields(tc.value)
+			if properties := propertyNames(tc.schema); !reflect.DeepEqual(properties, fields) {
+				t.Errorf("schema properties %q don't match the Go fields %q", properties, fields)
+			}
+			// A required property must never be dropped by omitempty
+			if required := sorted(tc.schema.Required); !subset(required, always) {
+				t.Errorf("required properties %q include fields the Go type may omit (always present: %q)", required, always)
+			}
+		})
+	}
+}
+
+func TestProtoMatchesTypes(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		message protoreflect.MessageDescriptor
+		value   interface{}
+	}{
+		{"Command", (&poppitpb.Command{}).ProtoReflect().Descriptor(), Command{}},
+		{"CommandMetadata", (&poppitpb.CommandMetadata{}).ProtoReflect().Descriptor(), CommandMetadata{}},
+		{"CommandOutput", (&poppitpb.CommandOutput{}).ProtoReflect().Descriptor(), CommandOutput{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var names []string
+			for i := 0; i < tc.message.Fields().Len(); i++ {
+				names = append(names, string(tc.message.Fields().Get(i).Name()))
+			}
+			if fields, _ := jsonFields(tc.value); !reflect.DeepEqual(sorted(names), fields) {
+				t.Errorf("protobuf fields %q don't match the Go fields %q", sorted(names), fields)
+			}
+		})
+	}
+}
+
+func TestFixturesConform(t *testing.T) {
+	data, err := os.ReadFile("testdata/command.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := DecodeCommand(data)
+	if err != nil {
+		t.Fatalf("command fixture does not conform: %v", err)
+	}
+	if cmd.Metadata == nil || cmd.Metadata.DeploymentID == "" {
+		t.Error("command fixture lost its metadata")
+	}
+
+	data, err = os.ReadFile("testdata/output.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeCommandOutput(data); err != nil {
+		t.Fatalf("output fixture does not conform: %v", err)
+	}
+}
+
+func TestDecodeRejectsDrift(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		payload string
+		decode  func([]byte) error
+	}{
+		{"unknown command field", `{"repo":"a/b","branch":"main","type":"vibe-deploy","dir":"/d","commands":["git pull"],"cwd":"/d"}`, decodeCommand},
+		{"missing dir", `{"repo":"a/b","branch":"main","type":"vibe-deploy","commands":["git pull"]}`, decodeCommand},
+		{"empty pipeline", `{"repo":"a/b","branch":"main","type":"vibe-deploy","dir":"/d","commands":[]}`, decodeCommand},
+		{"timeout for unknown command", `{"repo":"a/b","branch":"main","type":"vibe-deploy","dir":"/d","commands":["git pull"],"timeouts":{"git push":60}}`, decodeCommand},
+		{"timeouts as durations", `{"repo":"a/b","branch":"main","type":"vibe-deploy","dir":"/d","commands":["git pull"],"timeouts":{"git pull":"60s"}}`, decodeCommand},
+		{"unknown metadata field", `{"repo":"a/b","branch":"main","type":"vibe-deploy","dir":"/d","commands":["git pull"],"metadata":{"channel":"C1","ts":"1.2","thread":"1.2"}}`, decodeCommand},
+		{"output without command", `{"type":"vibe-deploy","output":"ok"}`, decodeOutput},
+		{"exit code as text", `{"type":"vibe-deploy","command":"git pull","output":"ok","exit_code":"1"}`, decodeOutput},
+		{"unknown output field", `{"type":"vibe-deploy","command":"git pull","output":"ok","status":"failed"}`, decodeOutput},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.decode([]byte(tc.payload)); err == nil {
+				t.Errorf("expected %s to be rejected", tc.payload)
+			}
+		})
+	}
+}
+
+func decodeCommand(data []byte) error {
+	_, err := DecodeCommand(data)
+	return err
+}
+
+func decodeOutput(data []byte) error {
+	_, err := DecodeCommandOutput(data)
+	return err
+}
+
+func TestProtobufRoundTrip(t *testing.T) {
+	data, err := os.ReadFile("testdata/command.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := DecodeCommand(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := EncodeCommand(cmd, ContentTypeProtobuf)
+	if err != nil {
+		t.Fatalf("failed to encode command: %v", err)
+	}
+	if ContentType(payload) != ContentTypeProtobuf {
+		t.Fatalf("protobuf payload is not marked: %q", payload)
+	}
+	decoded, err := DecodeCommand(payload)
+	if err != nil {
+		t.Fatalf("protobuf command does not conform: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, cmd) {
+		t.Errorf("command changed in the round trip:\n got %+v\nwant %+v", decoded, cmd)
+	}
+
+	output := &CommandOutput{Metadata: cmd.Metadata, Type: cmd.Type, Command: cmd.Commands[0], Output: "ok\n"}
+	payload, err = EncodeCommandOutput(output, ContentTypeProtobuf)
+	if err != nil {
+		t.Fatalf("failed to encode output: %v", err)
+	}
+	for name, decode := range map[string]func([]byte) (*CommandOutput, error){"strict": DecodeCommandOutput, "lenient": ParseCommandOutput} {
+		decoded, err := decode(payload)
+		if err != nil {
+			t.Fatalf("%s decode of protobuf output failed: %v", name, err)
+		}
+		if !reflect.DeepEqual(decoded, output) {
+			t.Errorf("%s decode changed the output:\n got %+v\nwant %+v", name, decoded, output)
+		}
+	}
+}
+
+func TestProtobufRejectsUnknownFields(t *testing.T) {
+	payload, err := EncodeCommand(&Command{Repo: "a/b", Branch: "main", Type: "vibe-deploy", Dir: "/d", Commands: []string{"git pull"}, Metadata: &CommandMetadata{Channel: "C1", Ts: "1.2"}}, ContentTypeProtobuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Field 99 of the metadata message is not part of v1: tag (99<<3 | varint), value 1, inside field 8
+	unknown := []byte{0xb8, 0x06, 0x01}
+	nested := append([]byte{0x42, byte(len(unknown))}, unknown...)
+	if _, err := DecodeCommand(append(payload, nested...)); err == nil {
+		t.Error("expected a command with an unknown metadata field to be rejected")
+	}
+	if _, err := DecodeCommand(append(payload, unknown...)); err == nil {
+		t.Error("expected a command with an unknown field to be rejected")
+	}
+}
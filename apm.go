@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// APM endpoints unless annotations set their own
+const (
+	defaultNewRelicURL  = "https://api.newrelic.com/graphql"
+	newRelicEUURL       = "https://api.eu.newrelic.com/graphql"
+	defaultHoneycombURL = "https://api.honeycomb.io"
+	honeycombMarkerType = "deploy"
+)
+
+// NewRelicConfig is the New Relic account whose change tracking records deployments
+type NewRelicConfig struct {
+	// TokenSecret names a user API key in the secrets provider
+	TokenSecret string `yaml:"token_secret"`
+	// Region is us (default) or eu
+	Region string `yaml:"region"`
+	// URL overrides the NerdGraph endpoint of the region
+	URL string `yaml:"url"`
+}
+
+func (c *NewRelicConfig) endpoint() string {
+	if c.URL != "" {
+		return c.URL
+	}
+	if c.Region == "eu" {
+		return newRelicEUURL
+	}
+	return defaultNewRelicURL
+}
+
+// HoneycombConfig is the Honeycomb environment whose datasets get a marker per deployment
+type HoneycombConfig struct {
+	// TokenSecret names a configuration API key with the markers permission in the secrets provider
+	TokenSecret string `yaml:"token_secret"`
+	// URL overrides https://api.honeycomb.io, e.g. https://api.eu1.honeycomb.io
+	URL string `yaml:"url"`
+}
+
+func (c *NewRelicConfig) validate() error {
+	if c.TokenSecret == "" {
+		return fmt.Errorf("annotations newrelic needs token_secret")
+	}
+	if c.Region != "" && c.Region != "us" && c.Region != "eu" {
+		return fmt.Errorf("annotations newrelic region must be us or eu, not %q", c.Region)
+	}
+	return nil
+}
+
+func (c *HoneycombConfig) validate() error {
+	if c.TokenSecret == "" {
+		return fmt.Errorf("annotations honeycomb needs token_secret")
+	}
+	return nil
+}
+
+// markAPM records a successful deployment against its service in New Relic and Honeycomb
+func (a *App) markAPM(ctx context.Context, config *AnnotationsConfig, service string, d *Deployment) {
+	if service == "" {
+		return
+	}
+	if config.NewRelic != nil {
+		if err := a.trackNewRelicDeployment(ctx, config.NewRelic, service, d); err != nil {
+			logError("Error tracking deployment %s in New Relic: %v", d.ID, err)
+		} else {
+			logInfo("Tracked deployment %s of %s in New Relic", d.ID, service)
+		}
+	}
+	if config.Honeycomb != nil {
+		if err := a.postHoneycombMarker(ctx, config.Honeycomb, service, d); err != nil {
+			logError("Error adding Honeycomb marker for deployment %s: %v", d.ID, err)
+		} else {
+			logInfo("Added Honeycomb marker for deployment %s to %s", d.ID, service)
+		}
+	}
+}
+
+// nerdGraph runs a NerdGraph query and decodes its data into out
+func nerdGraph(ctx context.Context, endpoint, key, query string, variables map[string]interface{}, out interface{}) error {
+	data, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return fmt.Errorf("failed to marshal query: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("API-Key", key)
+
+	resp, err := annotationsHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", req.URL.Host, err)
+	}
+	defer resp.Body.Close()
+	var response struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(response.Errors) > 0 {
+		return fmt.Errorf("new relic: %s", response.Errors[0].Message)
+	}
+	return json.Unmarshal(response.Data, out)
+}
+
+// trackNewRelicDeployment finds the APM entity named service and creates a change tracking deployment on it
+func (a *App) trackNewRelicDeployment(ctx context.Context, config *NewRelicConfig, service string, d *Deployment) error {
+	key, err := a.secrets.Secret(ctx, config.TokenSecret)
+	if err != nil {
+		return fmt.Errorf("could not resolve the New Relic key: %w", err)
+	}
+
+	var search struct {
+		Actor struct {
+			EntitySearch struct {
+				Results struct {
+					Entities []struct {
+						GUID string `json:"guid"`
+					} `json:"entities"`
+				} `json:"results"`
+			} `json:"entitySearch"`
+		} `json:"actor"`
+	}
+	entityQuery := fmt.Sprintf("domain = 'APM' AND name = '%s'", strings.ReplaceAll(service, "'", `\'`))
+	err = nerdGraph(ctx, config.endpoint(), key, `query($query: String!) { actor { entitySearch(query: $query) { results { entities { guid } } } } }`,
+		map[string]interface{}{"query": entityQuery}, &search)
+	if err != nil {
+		return fmt.Errorf("failed to find entity %s: %w", service, err)
+	}
+	entities := search.Actor.EntitySearch.Results.Entities
+	if len(entities) == 0 {
+		return fmt.Errorf("no APM entity is named %s", service)
+	}
+
+	version := deployedVersion(d)
+	if version == "" {
+		version = d.Branch
+	}
+	deployment := map[string]interface{}{
+		"entityGuid":     entities[0].GUID,
+		"version":        version,
+		"deploymentType": "BASIC",
+		"description":    annotationText(d),
+	}
+	if d.Build.GitSHA != "" {
+		deployment["commit"] = d.Build.GitSHA
+	}
+	if d.TriggeredBy != "" {
+		deployment["user"] = d.TriggeredBy
+	}
+	if link := a.deploymentURL(d); link != "" {
+		deployment["deepLink"] = link
+	}
+	var created json.RawMessage
+	return nerdGraph(ctx, config.endpoint(), key, `mutation($deployment: ChangeTrackingDeploymentInput!) { changeTrackingCreateDeployment(deployment: $deployment) { deploymentId } }`,
+		map[string]interface{}{"deployment": deployment}, &created)
+}
+
+// postHoneycombMarker adds a deploy marker to the dataset named service
+func (a *App) postHoneycombMarker(ctx context.Context, config *HoneycombConfig, service string, d *Deployment) error {
+	key, err := a.secrets.Secret(ctx, config.TokenSecret)
+	if err != nil {
+		return fmt.Errorf("could not resolve the Honeycomb key: %w", err)
+	}
+	baseURL := defaultHoneycombURL
+	if config.URL != "" {
+		baseURL = strings.TrimRight(config.URL, "/")
+	}
+	marker := map[string]interface{}{
+		"message": annotationText(d),
+		"type":    honeycombMarkerType,
+	}
+	if link := a.deploymentURL(d); link != "" {
+		marker["url"] = link
+	}
+	data, err := json.Marshal(marker)
+	if err != nil {
+		return fmt.Errorf("failed to marshal marker: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/1/markers/"+url.PathEscape(service), bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Honeycomb-Team", key)
+	return doAnnotationRequest(req)
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gocloud.dev/blob"
+	_ "gocloud.dev/blob/fileblob"
+	_ "gocloud.dev/blob/gcsblob"
+	_ "gocloud.dev/blob/s3blob"
+)
+
+const (
+	// auditExportedKey holds the stream ID of the last event included in an exported batch
+	auditExportedKey = "vibedeploy:audit:exported"
+	// auditLockKey stops several instances exporting the same events at once
+	auditLockKey = "vibedeploy:audit:lock"
+	// auditBatchVersion is bumped if the batch layout or hashing scheme changes
+	auditBatchVersion = 1
+)
+
+// AuditEntry is a stream entry exactly as stored, so its hash can be recomputed by anyone holding the batch
+type AuditEntry struct {
+	ID           string `json:"id"`
+	Type         string `json:"type"`
+	DeploymentID string `json:"deployment_id"`
+	Repository   string `json:"repository"`
+	Timestamp    string `json:"timestamp"`
+	Deployment   string `json:"deployment"`
+	// Delegation is the snapshot of approval delegation entries, which have no deployment
+	Delegation string `json:"delegation,omitempty"`
+	PrevHash   string `json:"prev_hash"`
+	Hash       string `json:"hash"`
+}
+
+// AuditBatch is a signed run of consecutive audit entries. PrevHash links it to the previous batch.
+type AuditBatch struct {
+	Version   int          `json:"version"`
+	CreatedAt time.Time    `json:"created_at"`
+	FirstID   string       `json:"first_id"`
+	LastID    string       `json:"last_id"`
+	PrevHash  string       `json:"prev_hash"`
+	HeadHash  string       `json:"head_hash"`
+	Entries   []AuditEntry `json:"entries"`
+}
+
+func auditEntryFromMessage(msg redis.XMessage) AuditEntry {
+	field := func(name string) string {
+		value, _ := msg.Values[name].(string)
+		return value
+	}
+	return AuditEntry{
+		ID:           msg.ID,
+		Type:         field("type"),
+		DeploymentID: field("deployment_id"),
+		Repository:   field("repository"),
+		Timestamp:    field("timestamp"),
+		Deployment:   field("deployment"),
+		Delegation:   field("delegation"),
+		PrevHash:     field("prev_hash"),
+		Hash:         field("hash"),
+	}
+}
+
+// verify recomputes the entry's hash over its snapshot, which is in exactly one of Deployment and Delegation
+func (e AuditEntry) verify() bool {
+	return e.Hash != "" && chainHash(e.PrevHash, e.Type, e.Timestamp, []byte(e.Deployment+e.Delegation)) == e.Hash
+}
+
+// verifyChain checks that entries are intact and each links to the one before it
+func verifyChain(entries []AuditEntry, prevHash string) error {
+	for _, entry := range entries {
+		if entry.PrevHash != prevHash {
+			return fmt.Errorf("entry %s does not link to the previous entry (expected prev_hash %q, got %q)", entry.ID, prevHash, entry.PrevHash)
+		}
+		if !entry.verify() {
+			return fmt.Errorf("entry %s has been modified (hash mismatch)", entry.ID)
+		}
+		prevHash = entry.Hash
+	}
+	return nil
+}
+
+// verifyEventsStream walks the whole events stream and checks its hash chain.
+// Entries written before chain hashing was introduced have no hash and are counted but not verified.
+func verifyEventsStream(ctx context.Context, redisClient *redis.Client) (verified, unchained int, err error) {
+	// Events the keyspace guardrails trimmed after they were exported leave the hash the rest chains from
+	prevHash, err := redisClient.Get(ctx, eventsBaseKey).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, 0, fmt.Errorf("failed to read chain base: %w", err)
+	}
+	start := "-"
+	for {
+		msgs, err := redisClient.XRangeN(ctx, eventsStreamKey, start, "+", replayBatchSize).Result()
+		if err != nil {
+			return verified, unchained, fmt.Errorf("failed to read events stream: %w", err)
+		}
+
+		for _, msg := range msgs {
+			entry := auditEntryFromMessage(msg)
+			if entry.Hash == "" && verified == 0 {
+				unchained++
+				continue
+			}
+			if err := verifyChain([]AuditEntry{entry}, prevHash); err != nil {
+				return verified, unchained, err
+			}
+			prevHash = entry.Hash
+			verified++
+		}
+
+		if len(msgs) < replayBatchSize {
+			break
+		}
+		start = "(" + msgs[len(msgs)-1].ID
+	}
+
+	head, err := redisClient.Get(ctx, eventsHeadKey).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return verified, unchained, fmt.Errorf("failed to read chain head: %w", err)
+	}
+	if head != prevHash {
+		return verified, unchained, fmt.Errorf("chain head %q does not match the last entry's hash %q; entries were removed from the end", head, prevHash)
+	}
+
+	return verified, unchained, nil
+}
+
+// loadSigningKey reads an Ed25519 private key from a PKCS #8 PEM file
+func loadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %s", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse audit signing key: %w", err)
+	}
+	signingKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("audit signing key must be an Ed25519 key")
+	}
+	return signingKey, nil
+}
+
+// loadVerifyKey reads an Ed25519 public key from a PKIX PEM file
+func loadVerifyKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %s", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	verifyKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key must be an Ed25519 key")
+	}
+	return verifyKey, nil
+}
+
+// AuditExporter uploads signed batches of new audit entries to object storage
+type AuditExporter struct {
+	redisClient *redis.Client
+	bucketURL   string
+	signingKey  ed25519.PrivateKey
+	interval    time.Duration
+}
+
+// newAuditExporter returns nil when AUDIT_EXPORT_URL is unset
+func newAuditExporter(config Config, redisClient *redis.Client) (*AuditExporter, error) {
+	if config.AuditExportURL == "" {
+		return nil, nil
+	}
+	if config.AuditSigningKey == "" {
+		return nil, fmt.Errorf("AUDIT_SIGNING_KEY is required when AUDIT_EXPORT_URL is set")
+	}
+	signingKey, err := loadSigningKey(config.AuditSigningKey)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditExporter{
+		redisClient: redisClient,
+		bucketURL:   config.AuditExportURL,
+		signingKey:  signingKey,
+		interval:    config.AuditExportInterval,
+	}, nil
+}
+
+// run exports a batch every interval until the context is cancelled
+func (e *AuditExporter) run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logInfo("Audit export context cancelled, exiting")
+			return
+		case <-ticker.C:
+			if _, err := e.export(ctx); err != nil {
+				logError("Error exporting audit batch: %v", err)
+			}
+		}
+	}
+}
+
+// export uploads every chained entry added since the last batch as one signed batch, returning the number exported
+func (e *AuditExporter) export(ctx context.Context) (int, error) {
+	locked, err := e.redisClient.SetNX(ctx, auditLockKey, "1", e.interval).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to take audit export lock: %w", err)
+	}
+	if !locked {
+		logDebug("Another instance is exporting audit entries, skipping")
+		return 0, nil
+	}
+	defer e.redisClient.Del(ctx, auditLockKey)
+
+	lastID, err := e.redisClient.Get(ctx, auditExportedKey).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, fmt.Errorf("failed to read last exported entry: %w", err)
+	}
+	start := "-"
+	if lastID != "" {
+		start = "(" + lastID
+	}
+
+	msgs, err := e.redisClient.XRange(ctx, eventsStreamKey, start, "+").Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read events stream: %w", err)
+	}
+	entries := make([]AuditEntry, 0, len(msgs))
+	for _, msg := range msgs {
+		if entry := auditEntryFromMessage(msg); entry.Hash != "" {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	if err := verifyChain(entries, entries[0].PrevHash); err != nil {
+		return 0, fmt.Errorf("refusing to export a broken chain: %w", err)
+	}
+
+	batch := AuditBatch{
+		Version:   auditBatchVersion,
+		CreatedAt: time.Now().UTC(),
+		FirstID:   entries[0].ID,
+		LastID:    entries[len(entries)-1].ID,
+		PrevHash:  entries[0].PrevHash,
+		HeadHash:  entries[len(entries)-1].Hash,
+		Entries:   entries,
+	}
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal audit batch: %w", err)
+	}
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(e.signingKey, body))
+
+	bucket, err := blob.OpenBucket(ctx, e.bucketURL)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open audit bucket %s: %w", e.bucketURL, err)
+	}
+	defer bucket.Close()
+
+	name := "audit-" + strings.ReplaceAll(batch.LastID, "-", "_") + ".json"
+	if err := bucket.WriteAll(ctx, name, body, &blob.WriterOptions{ContentType: "application/json"}); err != nil {
+		return 0, fmt.Errorf("failed to upload %s: %w", name, err)
+	}
+	if err := bucket.WriteAll(ctx, name+".sig", []byte(signature+"\n"), &blob.WriterOptions{ContentType: "text/plain"}); err != nil {
+		return 0, fmt.Errorf("failed to upload %s.sig: %w", name, err)
+	}
+
+	if err := e.redisClient.Set(ctx, auditExportedKey, batch.LastID, 0).Err(); err != nil {
+		return 0, fmt.Errorf("failed to record last exported entry: %w", err)
+	}
+
+	logInfo("Exported signed audit batch %s with %d entries (%s to %s)", name, len(entries), batch.FirstID, batch.LastID)
+	return len(entries), nil
+}
+
+// verifyAuditBatch checks a downloaded batch's signature and hash chain
+func verifyAuditBatch(body []byte, signature string, key ed25519.PublicKey) (*AuditBatch, error) {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(signature))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	if !ed25519.Verify(key, body, sig) {
+		return nil, fmt.Errorf("signature does not match the batch")
+	}
+
+	var batch AuditBatch
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return nil, fmt.Errorf("failed to parse audit batch: %w", err)
+	}
+	if err := verifyChain(batch.Entries, batch.PrevHash); err != nil {
+		return nil, err
+	}
+	if len(batch.Entries) > 0 && batch.Entries[len(batch.Entries)-1].Hash != batch.HeadHash {
+		return nil, fmt.Errorf("head_hash does not match the last entry")
+	}
+	return &batch, nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// apiKeysKey is the Redis hash of API keys, keyed by the SHA-256 of the token
+const apiKeysKey = "vibedeploy:apikeys"
+
+// apiKeyPrefix marks VibeDeploy API tokens so they are easy to spot in logs and secret scanners
+const apiKeyPrefix = "vd_"
+
+// Scope is the level of access granted to an API key; each scope includes the ones below it
+type Scope string
+
+const (
+	ScopeRead    Scope = "read"
+	ScopeTrigger Scope = "trigger"
+	ScopeAdmin   Scope = "admin"
+)
+
+var scopeRank = map[Scope]int{ScopeRead: 1, ScopeTrigger: 2, ScopeAdmin: 3}
+
+// ErrAPIKeyNotFound is returned when revoking a key ID that does not exist
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// APIKey is the stored record of an API key; the token itself is never stored
+type APIKey struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Scope Scope  `json:"scope"`
+	// Repos limits the key to the repositories matching these patterns; empty allows every repository
+	Repos     []string  `json:"repos,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// allows reports whether the key's scope covers the required scope
+func (k *APIKey) allows(required Scope) bool {
+	return scopeRank[k.Scope] >= scopeRank[required]
+}
+
+// parseScope validates a scope name
+func parseScope(raw string) (Scope, error) {
+	scope := Scope(raw)
+	if _, ok := scopeRank[scope]; !ok {
+		return "", fmt.Errorf("unknown scope %q (expected %s, %s or %s)", raw, ScopeRead, ScopeTrigger, ScopeAdmin)
+	}
+	return scope, nil
+}
+
+// hashAPIKey returns the storage key for a token
+func hashAPIKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// createAPIKey generates a new token and stores its hash, returning the token once
+func createAPIKey(ctx context.Context, redisClient *redis.Client, name string, scope Scope, repos []string) (string, *APIKey, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+	token := apiKeyPrefix + hex.EncodeToString(secret)
+
+	key := &APIKey{
+		ID:        hashAPIKey(token)[:12],
+		Name:      name,
+		Scope:     scope,
+		Repos:     repos,
+		CreatedAt: time.Now().UTC(),
+	}
+	payload, err := json.Marshal(key)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal API key: %w", err)
+	}
+	if err := redisClient.HSet(ctx, apiKeysKey, hashAPIKey(token), payload).Err(); err != nil {
+		return "", nil, fmt.Errorf("failed to store API key: %w", err)
+	}
+
+	return token, key, nil
+}
+
+// lookupAPIKey returns the key record for a token, or nil if the token is unknown
+func lookupAPIKey(ctx context.Context, redisClient *redis.Client, token string) (*APIKey, error) {
+	payload, err := redisClient.HGet(ctx, apiKeysKey, hashAPIKey(token)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API key: %w", err)
+	}
+
+	var key APIKey
+	if err := json.Unmarshal(payload, &key); err != nil {
+		return nil, fmt.Errorf("failed to parse API key: %w", err)
+	}
+	return &key, nil
+}
+
+// listAPIKeys returns every stored key, oldest first
+func listAPIKeys(ctx context.Context, redisClient *redis.Client) (map[string]*APIKey, []*APIKey, error) {
+	entries, err := redisClient.HGetAll(ctx, apiKeysKey).Result()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read API keys: %w", err)
+	}
+
+	byHash := make(map[string]*APIKey, len(entries))
+	keys := make([]*APIKey, 0, len(entries))
+	for hash, payload := range entries {
+		var key APIKey
+		if err := json.Unmarshal([]byte(payload), &key); err != nil {
+			logWarn("Skipping malformed API key record: %v", err)
+			continue
+		}
+		byHash[hash] = &key
+		keys = append(keys, &key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+
+	return byHash, keys, nil
+}
+
+// revokeAPIKey deletes the key with the given ID
+func revokeAPIKey(ctx context.Context, redisClient *redis.Client, id string) error {
+	byHash, _, err := listAPIKeys(ctx, redisClient)
+	if err != nil {
+		return err
+	}
+	for hash, key := range byHash {
+		if key.ID == id {
+			if err := redisClient.HDel(ctx, apiKeysKey, hash).Err(); err != nil {
+				return fmt.Errorf("failed to revoke API key: %w", err)
+			}
+			return nil
+		}
+	}
+	return ErrAPIKeyNotFound
+}
+
+// apiKeyActor is who a request authenticated by the key is recorded as, by the key's ID rather than whatever
+// the request body claims
+func apiKeyActor(key *APIKey) string {
+	return "apikey:" + key.ID
+}
+
+// scopeActions maps API scopes to the RBAC action that grants them
+var scopeActions = map[Scope]Action{ScopeRead: ActionView, ScopeTrigger: ActionDeploy, ScopeAdmin: ActionAdmin}
+
+// sessionAllows checks a dashboard session against a scope. With an rbac section the user needs a role
+// granting the matching action on at least one repository; per-repository checks happen in the handlers.
+func (a *App) sessionAllows(session *Session, scope Scope) bool {
+	if a.reposConfig != nil && a.reposConfig.RBAC != nil {
+		return a.reposConfig.RBAC.allows([]string{session.Email}, scopeActions[scope], "", anyEnvironment)
+	}
+	return scopeRank[session.Scope] >= scopeRank[scope]
+}
+
+// tokenFromQuery accepts the API key as a token query parameter, for clients such as calendar apps that can
+// only be given a URL. The parameter is removed so it isn't echoed back in links.
+func tokenFromQuery(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if token := query.Get("token"); token != "" && r.Header.Get("Authorization") == "" {
+			r = r.Clone(r.Context())
+			r.Header.Set("Authorization", "Bearer "+token)
+			query.Del("token")
+			r.URL.RawQuery = query.Encode()
+		}
+		next(w, r)
+	}
+}
+
+// requireScope wraps a handler so it only runs for requests bearing an API key or dashboard session
+// with at least the given scope. With REQUIRE_API_KEYS disabled and no OIDC login, read requests are
+// served without authentication and everything else is refused.
+func (a *App) requireScope(scope Scope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.config.RequireAPIKeys && a.oidc == nil {
+			if scope != ScopeRead {
+				http.Error(w, fmt.Sprintf("%s requests need REQUIRE_API_KEYS or OIDC login", scope), http.StatusForbidden)
+				return
+			}
+			next(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if (!ok || token == "") && a.oidc != nil {
+			session, err := a.oidc.sessionFor(r)
+			if err != nil {
+				logError("Error loading session: %v", err)
+				http.Error(w, "failed to verify session", http.StatusInternalServerError)
+				return
+			}
+			if session != nil {
+				if !a.sessionAllows(session, scope) {
+					logWarn("Dashboard user %s lacks %s scope for %s", session.Email, scope, r.URL.Path)
+					http.Error(w, fmt.Sprintf("%s does not have %s scope", session.Email, scope), http.StatusForbidden)
+					return
+				}
+				logDebug("Authenticated %s %s as dashboard user %s", r.Method, r.URL.Path, session.Email)
+				principal := &Principal{Identities: []string{session.Email}, Name: session.Email}
+				next(w, r.WithContext(withPrincipal(r.Context(), principal)))
+				return
+			}
+		}
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="vibedeploy"`)
+			http.Error(w, "missing API key", http.StatusUnauthorized)
+			return
+		}
+
+		key, err := lookupAPIKey(r.Context(), a.redisClient, token)
+		if err != nil {
+			logError("Error looking up API key: %v", err)
+			http.Error(w, "failed to verify API key", http.StatusInternalServerError)
+			return
+		}
+		if key == nil {
+			logWarn("Rejected request to %s from %s with unknown API key", r.URL.Path, r.RemoteAddr)
+			http.Error(w, "invalid API key", http.StatusUnauthorized)
+			return
+		}
+		if !key.allows(scope) {
+			logWarn("API key %s (%s) lacks %s scope for %s", key.ID, key.Name, scope, r.URL.Path)
+			http.Error(w, fmt.Sprintf("API key does not have %s scope", scope), http.StatusForbidden)
+			return
+		}
+
+		logDebug("Authenticated %s %s with API key %s (%s)", r.Method, r.URL.Path, key.ID, key.Name)
+		principal := &Principal{Name: apiKeyActor(key), Repos: key.Repos}
+		next(w, r.WithContext(withPrincipal(r.Context(), principal)))
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// AutoDeployConfig deploys merged PRs from dependency bots without waiting for anyone to react
+type AutoDeployConfig struct {
+	// Authors are the GitHub logins whose PRs deploy on merge, e.g. dependabot[bot] and renovate[bot]
+	Authors []string `yaml:"authors"`
+}
+
+// deploysAuthor reports whether PRs by the author deploy on merge
+func (c *AutoDeployConfig) deploysAuthor(author string) bool {
+	if c == nil || author == "" {
+		return false
+	}
+	for _, login := range c.Authors {
+		if strings.EqualFold(login, author) {
+			return true
+		}
+	}
+	return false
+}
+
+// PullRequestEvent is the subset of GitHub's pull_request webhook payload VibeDeploy reads
+type PullRequestEvent struct {
+	Action      string `json:"action"`
+	Number      int    `json:"number"`
+	PullRequest struct {
+		HTMLURL        string `json:"html_url"`
+		Merged         bool   `json:"merged"`
+		MergeCommitSHA string `json:"merge_commit_sha"`
+		User           struct {
+			Login string `json:"login"`
+		} `json:"user"`
+		Base struct {
+			Ref string `json:"ref"`
+		} `json:"base"`
+	} `json:"pull_request"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+// handlePullRequestEvent deploys merged PRs whose author the repository auto-deploys
+func (a *App) handlePullRequestEvent(w http.ResponseWriter, r *http.Request, body []byte) {
+	var event PullRequestEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if event.Action != "closed" || !event.PullRequest.Merged {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	a.processMergedPR(r.Context(), event)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// processMergedPR deploys the merge commit of a bot's PR to the first environment, as if someone had reacted with :rocket:.
+// PRs by anyone else still wait for a manual trigger.
+func (a *App) processMergedPR(ctx context.Context, event PullRequestEvent) {
+	repo, number, author := a.canonicalRepo(event.Repository.FullName), event.Number, event.PullRequest.User.Login
+	if !a.repoConfig(repo).AutoDeploy.deploysAuthor(author) {
+		logDebug("Not auto-deploying %s#%d by %s", repo, number, author)
+		return
+	}
+	if !isRepoAllowed(repo, a.allowedRepos) {
+		logInfo("Repository %s is not in the allowed list, not auto-deploying #%d", repo, number)
+		return
+	}
+	logInfo("Auto-deploying %s#%d by %s, merged into %s", repo, number, author, event.PullRequest.Base.Ref)
+
+	// The head branch is often deleted on merge, so deploy the base branch at the merge commit
+	metadata := &PRMetadata{
+		Repository:  repo,
+		Branch:      event.PullRequest.Base.Ref,
+		PRNumber:    number,
+		PRUrl:       event.PullRequest.HTMLURL,
+		Author:      author,
+		EventAction: event.Action,
+	}
+	options := DeployOptions{GitSHA: event.PullRequest.MergeCommitSHA}
+
+	// Report in the PR's Slack thread too, when it was posted there
+	channel, ts := a.linkedMessage(ctx, repo, number)
+
+	d, err := a.startDeployment(ctx, metadata, options, channel, ts, author)
+	if errors.Is(err, ErrDeploymentDeclined) {
+		logInfo("Auto-deployment of %s#%d declined: %s", repo, number, declinedReason(err))
+		return
+	}
+	if err != nil {
+		logError("Error auto-deploying %s#%d: %v", repo, number, err)
+		return
+	}
+	logInfo("Auto-deployment %s of %s#%d started", d.ID, repo, number)
+}
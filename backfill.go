@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/slack-go/slack"
+)
+
+// messageMetadataKey is a Redis hash of PR metadata backfilled for messages posted without any, keyed by channel
+// and timestamp
+const messageMetadataKey = "vibedeploy:message-metadata"
+
+// pullRequestLinkPattern matches a pull request URL in a message, on github.com or GitHub Enterprise
+var pullRequestLinkPattern = regexp.MustCompile(`https?://[^/\s|>]+/([\w.-]+/[\w.-]+)/pull/(\d+)`)
+
+// backfillPageSize is how many messages each conversations.history call asks for
+const backfillPageSize = 200
+
+// messageMetadata returns the PR metadata of a message: its own, or what was backfilled for it
+func (a *App) messageMetadata(ctx context.Context, channel, ts string) (*PRMetadata, error) {
+	var mapping *MetadataConfig
+	if a.reposConfig != nil {
+		mapping = a.reposConfig.MessageMetadata
+	}
+	metadata, err := getMessageMetadata(a.slackClient, channel, ts, mapping)
+	if err != nil {
+		return nil, err
+	}
+	if metadata != nil {
+		metadata.Repository = a.canonicalRepo(metadata.Repository)
+		return metadata, nil
+	}
+	data, err := a.redisClient.HGet(ctx, messageMetadataKey, channel+":"+ts).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backfilled metadata: %w", err)
+	}
+	var backfilled PRMetadata
+	if err := json.Unmarshal([]byte(data), &backfilled); err != nil {
+		return nil, fmt.Errorf("failed to parse backfilled metadata: %w", err)
+	}
+	backfilled.Repository = a.canonicalRepo(backfilled.Repository)
+	return &backfilled, nil
+}
+
+// messagePullRequest returns the link, repository and number of the first pull request a message links to
+func messagePullRequest(message slack.Message) (link, repo string, number int, ok bool) {
+	texts := []string{message.Text}
+	for _, attachment := range message.Attachments {
+		texts = append(texts, attachment.TitleLink, attachment.Title, attachment.Text, attachment.Fallback)
+	}
+	for _, text := range texts {
+		if link, repo, number, ok := pullRequestLink(text); ok {
+			return link, repo, number, true
+		}
+	}
+	return "", "", 0, false
+}
+
+// pullRequestLink returns the first pull request link in a text, with its repository and number
+func pullRequestLink(text string) (link, repo string, number int, ok bool) {
+	m := pullRequestLinkPattern.FindStringSubmatch(text)
+	if m == nil {
+		return "", "", 0, false
+	}
+	number, err := strconv.Atoi(m[2])
+	if err != nil || number <= 0 {
+		return "", "", 0, false
+	}
+	return m[0], m[1], number, true
+}
+
+// BackfillResult is what a backfill made of one message linking to a pull request
+type BackfillResult struct {
+	Ts       string
+	Metadata *PRMetadata
+	// Skipped says why the message wasn't registered, if it wasn't
+	Skipped string
+}
+
+// backfillChannel registers PR metadata for the recent messages of a channel that link to a pull request but
+// carry no metadata, reading each PR's branch and author through the GitHub App. A dry run registers nothing.
+func (a *App) backfillChannel(ctx context.Context, channel string, limit int, dryRun bool) ([]BackfillResult, error) {
+	if a.github == nil {
+		return nil, fmt.Errorf("backfilling needs the GitHub App, to read each PR's branch")
+	}
+	var results []BackfillResult
+	cursor := ""
+	for scanned := 0; scanned < limit; {
+		page := backfillPageSize
+		if limit-scanned < page {
+			page = limit - scanned
+		}
+		history, err := a.slackClient.GetConversationHistoryContext(ctx, &slack.GetConversationHistoryParameters{
+			ChannelID:          channel,
+			Cursor:             cursor,
+			Limit:              page,
+			IncludeAllMetadata: true,
+		})
+		if err != nil {
+			return results, fmt.Errorf("failed to read the history of %s: %w", channel, err)
+		}
+		for _, message := range history.Messages {
+			scanned++
+			if len(message.Metadata.EventPayload) > 0 {
+				continue
+			}
+			link, repo, number, ok := messagePullRequest(message)
+			if !ok {
+				continue
+			}
+			results = append(results, a.backfillMessage(ctx, channel, message.Timestamp, link, a.canonicalRepo(repo), number, dryRun))
+		}
+		cursor = history.ResponseMetaData.NextCursor
+		if !history.HasMore || cursor == "" || len(history.Messages) == 0 {
+			break
+		}
+	}
+	return results, nil
+}
+
+// backfillMessage registers the metadata of one message linking to a pull request
+func (a *App) backfillMessage(ctx context.Context, channel, ts, link, repo string, number int, dryRun bool) BackfillResult {
+	result := BackfillResult{Ts: ts}
+	field := channel + ":" + ts
+	if exists, err := a.redisClient.HExists(ctx, messageMetadataKey, field).Result(); err == nil && exists {
+		result.Skipped = "already registered"
+		return result
+	}
+	if !isRepoAllowed(repo, a.allowedRepos) {
+		result.Skipped = repo + " is not in the allowed list"
+		return result
+	}
+	pr, err := a.github.pullRequest(ctx, repo, number)
+	if err != nil {
+		result.Skipped = err.Error()
+		return result
+	}
+	result.Metadata = &PRMetadata{
+		PRNumber:   number,
+		Repository: repo,
+		PRUrl:      link,
+		Author:     pr.User.Login,
+		Branch:     pr.Head.Ref,
+	}
+	if dryRun {
+		return result
+	}
+	data, err := json.Marshal(result.Metadata)
+	if err != nil {
+		result.Skipped = err.Error()
+		return result
+	}
+	if err := a.redisClient.HSet(ctx, messageMetadataKey, field, data).Err(); err != nil {
+		result.Skipped = fmt.Sprintf("failed to register: %v", err)
+	}
+	return result
+}
+
+// runBackfill registers PR metadata for a channel's messages from before the notifier attached it
+func runBackfill(ctx context.Context, config Config, redisClient *redis.Client, args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	limit := fs.Int("limit", 1000, "how many of the channel's most recent messages to scan")
+	dryRun := fs.Bool("dry-run", false, "list what would be registered without registering it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *limit <= 0 {
+		return fmt.Errorf("usage: vibedeploy backfill [-limit N] [-dry-run] <channel ID>")
+	}
+	channel := fs.Arg(0)
+	app, err := queueAdminApp(config, redisClient)
+	if err != nil {
+		return err
+	}
+
+	results, err := app.backfillChannel(ctx, channel, *limit, *dryRun)
+	registered := 0
+	for _, r := range results {
+		if r.Skipped != "" {
+			fmt.Printf("%s\tskipped\t%s\n", r.Ts, r.Skipped)
+			continue
+		}
+		registered++
+		fmt.Printf("%s\t%s\t#%d\t%s\n", r.Ts, r.Metadata.Repository, r.Metadata.PRNumber, r.Metadata.Branch)
+	}
+	if err != nil {
+		return err
+	}
+	verb := "Registered"
+	if *dryRun {
+		verb = "Would register"
+	}
+	fmt.Printf("%s metadata for %d of %d PR messages in %s\n", verb, registered, len(results), channel)
+	return nil
+}
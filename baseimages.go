@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// baseImageDigestsKey is a Redis hash of each watched base image to the registry digest it was last seen at
+const baseImageDigestsKey = "vibedeploy:base-images"
+
+// baseImageClaimKeyPrefix starts the keys that let only one VibeDeploy instance announce each base image update
+const baseImageClaimKeyPrefix = "vibedeploy:base-images:"
+
+const baseImageClaimTTL = 24 * time.Hour
+
+// registryTimeout bounds each request to a registry
+const registryTimeout = 15 * time.Second
+
+// RebuildMetadataType is the Slack message metadata event type of rebuild offers, which carry the repository and branch
+// like a PR message so that :rocket: on them deploys
+const RebuildMetadataType = "vibedeploy_rebuild"
+
+// manifestMediaTypes are the manifests a tag may resolve to; lists and indexes come first so the digest covers every platform
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// BaseImagesConfig lists the images a repository's Dockerfiles build FROM, so their updates can be offered as rebuilds
+type BaseImagesConfig struct {
+	// Images are references such as node:20-alpine or ghcr.io/its-the-vibe/base:1
+	Images []string `yaml:"images"`
+	// Branch is rebuilt when one of them changes (default: main)
+	Branch string `yaml:"branch"`
+}
+
+func (c *BaseImagesConfig) validate() error {
+	if len(c.Images) == 0 {
+		return errors.New("base_images needs at least one image")
+	}
+	for _, image := range c.Images {
+		if _, err := parseImageReference(image); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *BaseImagesConfig) branch() string {
+	if c.Branch == "" {
+		return "main"
+	}
+	return c.Branch
+}
+
+// imageReference is where a tagged image lives in a registry
+type imageReference struct {
+	registry, repository, tag string
+}
+
+// parseImageReference splits an image reference the way docker does: a first component with a dot or port,
+// or localhost, is the registry, and anything else is on Docker Hub
+func parseImageReference(image string) (imageReference, error) {
+	if strings.Contains(image, "@") {
+		return imageReference{}, fmt.Errorf("base image %q is pinned to a digest, so it never changes", image)
+	}
+	ref := imageReference{registry: "registry-1.docker.io", repository: image, tag: "latest"}
+	if i := strings.LastIndex(ref.repository, ":"); i > strings.LastIndex(ref.repository, "/") {
+		ref.repository, ref.tag = ref.repository[:i], ref.repository[i+1:]
+	}
+	if first, rest, ok := strings.Cut(ref.repository, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		ref.registry, ref.repository = first, rest
+	} else if !ok {
+		ref.repository = "library/" + ref.repository
+	}
+	if ref.repository == "" || ref.tag == "" || strings.ContainsAny(ref.repository+ref.tag, " \t") {
+		return imageReference{}, fmt.Errorf("invalid base image %q", image)
+	}
+	return ref, nil
+}
+
+// imageDigest asks the registry which manifest the image's tag points at. Registries that want a token,
+// such as Docker Hub, get an anonymous one for pulling.
+func imageDigest(ctx context.Context, client *http.Client, ref imageReference) (string, error) {
+	manifestURL := fmt.Sprintf("https://%s/v2/%s/manifests/%s", ref.registry, ref.repository, ref.tag)
+	resp, err := manifestHead(ctx, client, manifestURL, "")
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		token, err := registryToken(ctx, client, resp.Header.Get("WWW-Authenticate"))
+		if err != nil {
+			return "", err
+		}
+		if resp, err = manifestHead(ctx, client, manifestURL, token); err != nil {
+			return "", err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry returned %s for %s", resp.Status, manifestURL)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("registry returned no digest for %s", manifestURL)
+	}
+	return digest, nil
+}
+
+func manifestHead(ctx context.Context, client *http.Client, manifestURL, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach registry: %w", err)
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// registryToken fetches a bearer token from the realm named in a registry's challenge
+func registryToken(ctx context.Context, client *http.Client, challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("registry wants %q authentication, which is not supported", scheme)
+	}
+	values := url.Values{}
+	var realm string
+	for _, param := range strings.Split(params, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		value = strings.Trim(value, `"`)
+		if name == "realm" {
+			realm = value
+		} else if name != "" {
+			values.Set(name, value)
+		}
+	}
+	if realm == "" {
+		return "", errors.New("registry challenge has no realm")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm+"?"+values.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get registry token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry token endpoint returned %s", resp.Status)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to parse registry token: %w", err)
+	}
+	if body.Token == "" {
+		body.Token = body.AccessToken
+	}
+	return body.Token, nil
+}
+
+// baseImageRepos maps each watched base image to the repositories built from it
+func (a *App) baseImageRepos() map[string][]string {
+	images := make(map[string][]string)
+	if a.reposConfig == nil {
+		return images
+	}
+	for repo, repoConfig := range a.reposConfig.Repos {
+		if repoConfig.BaseImages == nil {
+			continue
+		}
+		for _, image := range repoConfig.BaseImages.Images {
+			images[image] = append(images[image], repo)
+		}
+	}
+	for _, repos := range images {
+		sort.Strings(repos)
+	}
+	return images
+}
+
+// runBaseImageChecks periodically polls the registries of the watched base images
+func (a *App) runBaseImageChecks(ctx context.Context) {
+	client := &http.Client{Timeout: registryTimeout}
+	ticker := time.NewTicker(a.config.BaseImageCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		a.checkBaseImages(ctx, client)
+
+		select {
+		case <-ctx.Done():
+			logInfo("Base image check context cancelled, exiting")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkBaseImages offers a rebuild of every repository whose base image has a new digest.
+// The first digest seen for an image is only recorded.
+func (a *App) checkBaseImages(ctx context.Context, client *http.Client) {
+	images := a.baseImageRepos()
+	names := make([]string, 0, len(images))
+	for image := range images {
+		names = append(names, image)
+	}
+	sort.Strings(names)
+
+	for _, image := range names {
+		ref, err := parseImageReference(image)
+		if err != nil {
+			continue
+		}
+		digest, err := imageDigest(ctx, client, ref)
+		if err != nil {
+			logWarn("Error checking base image %s: %v", image, err)
+			continue
+		}
+		previous, err := a.redisClient.HGet(ctx, baseImageDigestsKey, image).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			logError("Error reading last digest of %s: %v", image, err)
+			continue
+		}
+		if previous == digest {
+			continue
+		}
+		if err := a.redisClient.HSet(ctx, baseImageDigestsKey, image, digest).Err(); err != nil {
+			logError("Error recording digest of %s: %v", image, err)
+			continue
+		}
+		if previous == "" {
+			logInfo("Watching base image %s at %s", image, shortHash(digest))
+			continue
+		}
+
+		// Every instance polls the same images; the first to claim the update announces it
+		claimed, err := a.redisClient.SetNX(ctx, baseImageClaimKeyPrefix+image+"@"+digest, 1, baseImageClaimTTL).Result()
+		if err != nil {
+			logError("Error claiming update of %s: %v", image, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		logInfo("Base image %s changed from %s to %s", image, shortHash(previous), shortHash(digest))
+		for _, repo := range images[image] {
+			a.offerRebuild(ctx, repo, image, previous, digest)
+		}
+	}
+}
+
+// offerRebuild posts a message that deploys the repository's branch with a clean build when someone reacts with :rocket:.
+// It goes to the repository's notification channel, or else the ops channel.
+func (a *App) offerRebuild(ctx context.Context, repo, image, previous, digest string) {
+	repoConfig := a.repoConfig(repo)
+	channel := repoConfig.NotificationChannel
+	if channel == "" {
+		channel = a.config.OpsAlertChannel
+	}
+	if channel == "" {
+		logInfo("Base image %s of %s changed, but there is no channel to offer a rebuild in", image, repo)
+		return
+	}
+	branch := repoConfig.BaseImages.branch()
+
+	text := a.messages.text("base_image.offer", map[string]interface{}{
+		"Image": image, "Repository": repo, "Previous": shortHash(previous), "Digest": shortHash(digest), "Branch": branch,
+	})
+	ts, err := a.postDeploymentMessage(ctx, channel, text, RebuildMetadataType, repo, branch)
+	if err != nil {
+		logError("Error offering rebuild of %s in %s: %v", repo, channel, err)
+		return
+	}
+	// The rebuild must pull the new base image rather than reuse cached layers
+	if err := a.publishSlackReaction(ctx, channel, ts, CleanBuildReaction, false); err != nil {
+		logError("Error publishing %s reaction: %v", CleanBuildReaction, err)
+	}
+	logInfo("Offered rebuild of %s (%s) in %s for %s", repo, branch, channel, image)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/slack-go/slack"
+)
+
+// benchRepository is the repository named in the synthetic PR metadata
+const benchRepository = "vibedeploy/bench"
+
+// benchExecutor records when each synthetic deployment reaches the executor, instead of running it
+type benchExecutor struct {
+	mu       sync.Mutex
+	received map[string]time.Time
+	done     chan struct{}
+	want     int
+}
+
+func (e *benchExecutor) Name() string {
+	return "bench"
+}
+
+func (e *benchExecutor) Execute(ctx context.Context, cmd PoppitCommand) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.received[cmd.Metadata.Ts] = time.Now()
+	if len(e.received) == e.want {
+		close(e.done)
+	}
+	return nil
+}
+
+// newBenchSlackServer stands in for the Slack API, answering conversations.history with PR metadata
+func newBenchSlackServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/conversations.history" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok": true,
+			"messages": []map[string]interface{}{{
+				"type": "message",
+				"ts":   r.FormValue("latest"),
+				"metadata": map[string]interface{}{
+					"event_type": "pull_request",
+					"event_payload": map[string]interface{}{
+						"repository": benchRepository,
+						"branch":     "bench",
+						"pr_number":  1,
+					},
+				},
+			}},
+		})
+	}))
+}
+
+// runBench publishes synthetic rocket reactions and measures how long each takes to reach the executor.
+// It runs against an embedded miniredis by default so it never touches real deployment state.
+func runBench(config Config, args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	count := fs.Int("n", 1000, "number of synthetic reaction events to publish")
+	redisAddr := fs.String("redis", "", "Redis address to benchmark against instead of an embedded miniredis")
+	redisDB := fs.Int("db", 15, "Redis database number to use with -redis")
+	channel := fs.String("channel", "vibedeploy-bench", "pub/sub channel to publish the reaction events on")
+	timeout := fs.Duration("timeout", 5*time.Minute, "give up if the events have not all been processed by then")
+	logLevel := fs.String("log-level", "WARN", "log level while the benchmark runs; INFO logs every event")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	currentLogLevel = parseLogLevel(*logLevel)
+	if *count <= 0 {
+		return fmt.Errorf("-n must be positive")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var redisClient *redis.Client
+	target := "embedded miniredis"
+	if *redisAddr == "" {
+		mr, err := miniredis.Run()
+		if err != nil {
+			return fmt.Errorf("failed to start miniredis: %w", err)
+		}
+		defer mr.Close()
+		redisClient = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	} else {
+		redisClient = redis.NewClient(&redis.Options{Addr: *redisAddr, Password: config.RedisPassword, DB: *redisDB})
+		target = fmt.Sprintf("%s db %d", *redisAddr, *redisDB)
+		logWarn("Benchmarking against %s; deployment records and events will be written there", target)
+	}
+	defer redisClient.Close()
+	if err := redisClient.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	slackServer := newBenchSlackServer()
+	defer slackServer.Close()
+
+	executor := &benchExecutor{received: make(map[string]time.Time), done: make(chan struct{}), want: *count}
+	benchConfig := config
+	benchConfig.RedisReactionList = "vibedeploy:bench:reactions"
+	policy, err := newCommandPolicy(nil)
+	if err != nil {
+		return err
+	}
+	app := &App{
+		config:      benchConfig,
+		redisClient: redisClient,
+		slackClient: slack.New("xoxb-bench", slack.OptionAPIURL(slackServer.URL+"/")),
+		executor:    executor,
+		deployments: &RedisDeploymentStore{redisClient: redisClient},
+		reposConfig: &AllowedReposConfig{},
+		policy:      policy,
+		shedder:     newLoadShedder(),
+	}
+
+	pubsub := redisClient.Subscribe(ctx, *channel)
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", *channel, err)
+	}
+	go func() {
+		for msg := range pubsub.Channel() {
+			app.processReactionEvent(ctx, msg.Payload)
+		}
+	}()
+
+	logInfo("Publishing %d synthetic reactions to %s on %s", *count, *channel, target)
+	published := make(map[string]time.Time, *count)
+	start := time.Now()
+	for i := 0; i < *count; i++ {
+		var event ReactionEvent
+		event.Event.Type = "reaction_added"
+		event.Event.User = "UBENCH"
+		event.Event.Reaction = RocketReaction
+		event.Event.Item.Type = "message"
+		event.Event.Item.Channel = "CBENCH"
+		event.Event.Item.Ts = fmt.Sprintf("1700000000.%06d", i)
+
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal reaction event: %w", err)
+		}
+		published[event.Event.Item.Ts] = time.Now()
+		if err := redisClient.Publish(ctx, *channel, payload).Err(); err != nil {
+			return fmt.Errorf("failed to publish reaction event: %w", err)
+		}
+	}
+
+	select {
+	case <-executor.done:
+	case <-ctx.Done():
+		executor.mu.Lock()
+		processed := len(executor.received)
+		executor.mu.Unlock()
+		return fmt.Errorf("only %d of %d events were processed before the timeout", processed, *count)
+	}
+	elapsed := time.Since(start)
+
+	executor.mu.Lock()
+	latencies := make([]time.Duration, 0, len(executor.received))
+	for ts, at := range executor.received {
+		latencies = append(latencies, at.Sub(published[ts]))
+	}
+	executor.mu.Unlock()
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	percentile := func(p float64) time.Duration {
+		return latencies[int(p*float64(len(latencies)-1))]
+	}
+	fmt.Printf("events:     %d\n", *count)
+	fmt.Printf("elapsed:    %s\n", elapsed.Round(time.Millisecond))
+	fmt.Printf("throughput: %.1f events/s\n", float64(*count)/elapsed.Seconds())
+	fmt.Printf("latency:    p50 %s  p95 %s  p99 %s  max %s\n",
+		percentile(0.50).Round(time.Microsecond), percentile(0.95).Round(time.Microsecond),
+		percentile(0.99).Round(time.Microsecond), latencies[len(latencies)-1].Round(time.Microsecond))
+	return nil
+}
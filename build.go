@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// CleanBuildReaction, added to the PR message before :rocket:, forces a build without cache
+const CleanBuildReaction = "snowflake"
+
+// BuildCommand is the build step without any cache options
+const BuildCommand = "docker compose build"
+
+// CacheFromEnvVar carries the repository's cache_from image to the compose file
+const CacheFromEnvVar = "VIBEDEPLOY_CACHE_FROM"
+
+// BuildConfig is the build section of a repository's settings
+type BuildConfig struct {
+	// NoCache always builds without the layer cache
+	NoCache bool `yaml:"no_cache"`
+	// Pull always pulls newer versions of base images
+	Pull bool `yaml:"pull"`
+	// CacheFrom is an image to seed the build cache from, referenced in the compose file as ${VIBEDEPLOY_CACHE_FROM}
+	CacheFrom string `yaml:"cache_from"`
+}
+
+// DeployOptions are per-deployment choices that change the generated pipeline
+type DeployOptions struct {
+	// CleanBuild builds without cache and re-pulls base images, whatever the repository's build settings
+	CleanBuild bool
+	// Services limits the build and up steps to these compose services; empty means the whole stack
+	Services []string
+	// IncidentID names the ongoing incident the deployment is for
+	IncidentID string
+	// Environment is the stage of the promotion chain to deploy to; empty means the first
+	Environment string
+	// GitSHA checks out this commit instead of the branch head, so a promotion ships exactly what was tested
+	GitSHA string
+	// PromotedFrom is the deployment being promoted
+	PromotedFrom string
+	// RolledBackFrom is the deployment a rollback replaces with the commit deployed before it
+	RolledBackFrom string
+	// Images pins compose services to these image digests, which are pulled instead of built
+	Images map[string]string
+	// Host deploys to this host instead of the environment's, and MigratedFrom is the host a migration moves off
+	Host         string
+	MigratedFrom string
+	// ReactedAt is when the reaction that started the deployment was added, for the latency objectives
+	ReactedAt time.Time
+	// Workspace is the deployment's own checkout in the repository's, already at the branch head
+	Workspace string
+	// Pipeline is the configured pipeline run instead of a built-in workflow
+	Pipeline *PipelineConfig
+}
+
+// buildCommand returns the build step for the repository's settings and the deployment's options
+func buildCommand(build *BuildConfig, options DeployOptions) string {
+	noCache, pull := options.CleanBuild, options.CleanBuild
+	if build != nil {
+		noCache = noCache || build.NoCache
+		pull = pull || build.Pull
+	}
+
+	command := BuildCommand
+	if noCache {
+		command += " --no-cache"
+	}
+	if pull {
+		command += " --pull"
+	}
+	return command
+}
+
+// buildEnv returns the cache source for the build, which a clean build deliberately ignores
+func buildEnv(build *BuildConfig, options DeployOptions) map[string]string {
+	if build == nil || build.CacheFrom == "" || options.CleanBuild {
+		return nil
+	}
+	return map[string]string{CacheFromEnvVar: build.CacheFrom}
+}
+
+// reactionOptions reads modifier reactions on the PR message that tune the deployment
+func (a *App) reactionOptions(ctx context.Context, channel, ts string) (DeployOptions, error) {
+	var options DeployOptions
+	reactions, err := a.slackClient.GetReactionsContext(ctx, slack.NewRefToMessage(channel, ts), slack.NewGetReactionsParameters())
+	if err != nil {
+		return options, fmt.Errorf("failed to get message reactions: %w", err)
+	}
+	for _, reaction := range reactions {
+		if reaction.Name == CleanBuildReaction {
+			options.CleanBuild = true
+		}
+	}
+	return options, nil
+}
+
+// mergeEnv adds extra to env, allocating it if needed
+func mergeEnv(env, extra map[string]string) map[string]string {
+	for name, value := range extra {
+		if env == nil {
+			env = make(map[string]string)
+		}
+		env[name] = value
+	}
+	return env
+}
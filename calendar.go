@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// icalTimeFormat is the UTC date-time format of iCalendar properties
+const icalTimeFormat = "20060102T150405Z"
+
+// icalLineLimit is the longest content line, in octets, before it must be folded
+const icalLineLimit = 75
+
+// icalEscaper escapes iCalendar TEXT values
+var icalEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+// buildCalendar renders deployments as an iCalendar (RFC 5545) document, one event per deployment
+func buildCalendar(name string, deployments []*Deployment) string {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//its-the-vibe//VibeDeploy//EN",
+		"CALSCALE:GREGORIAN",
+		"X-WR-CALNAME:" + icalEscaper.Replace(name),
+	}
+	now := time.Now().UTC()
+	for _, d := range deployments {
+		// Running deployments are shown up to now; restarts and fast pipelines still get a visible minute
+		end := now
+		if d.FinishedAt != nil {
+			end = *d.FinishedAt
+		}
+		if end.Sub(d.StartedAt) < time.Minute {
+			end = d.StartedAt.Add(time.Minute)
+		}
+		status := "CONFIRMED"
+		if d.Status == StatusQueued {
+			status = "TENTATIVE"
+		}
+
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			"UID:"+d.ID+"@vibedeploy",
+			"DTSTAMP:"+now.Format(icalTimeFormat),
+			"DTSTART:"+d.StartedAt.UTC().Format(icalTimeFormat),
+			"DTEND:"+end.UTC().Format(icalTimeFormat),
+			"SUMMARY:"+icalEscaper.Replace(feedEntryTitle(d)),
+			"DESCRIPTION:"+icalEscaper.Replace(feedEntrySummary(d)),
+			"CATEGORIES:"+icalEscaper.Replace(d.Status),
+			"STATUS:"+status,
+		)
+		if d.Build.GitSHA != "" {
+			lines = append(lines, fmt.Sprintf("URL:https://github.com/%s/commit/%s", d.Repository, d.Build.GitSHA))
+		}
+		lines = append(lines, "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(foldICalLine(line))
+		b.WriteString("\r\n")
+	}
+	return b.String()
+}
+
+// foldICalLine splits a content line into 75-octet pieces joined by CRLF and a space, without splitting a UTF-8 sequence
+func foldICalLine(line string) string {
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > icalLineLimit {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
+
+// handleDeploymentCalendar serves recent deployments of one or more repositories as an iCalendar feed
+func (a *App) handleDeploymentCalendar(w http.ResponseWriter, r *http.Request) {
+	repos := r.URL.Query()["repo"]
+	if len(repos) == 0 {
+		http.Error(w, "repo query parameter is required", http.StatusBadRequest)
+		return
+	}
+	branch := r.URL.Query().Get("branch")
+
+	var deployments []*Deployment
+	for _, repo := range repos {
+		if !a.authorizeRequest(w, r, ActionView, repo) {
+			return
+		}
+		list, err := a.deployments.List(r.Context(), repo, defaultHistoryLimit)
+		if err != nil {
+			logError("Error listing deployments for %s calendar: %v", repo, err)
+			http.Error(w, "failed to list deployments", http.StatusInternalServerError)
+			return
+		}
+		for _, d := range list {
+			if branch == "" || d.Branch == branch {
+				deployments = append(deployments, d)
+			}
+		}
+	}
+	sort.Slice(deployments, func(i, j int) bool { return deployments[i].StartedAt.After(deployments[j].StartedAt) })
+
+	name := "VibeDeploy: " + strings.Join(repos, ", ")
+	if branch != "" {
+		name += " (" + branch + ")"
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Write([]byte(buildCalendar(name, deployments)))
+}
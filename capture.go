@@ -0,0 +1,554 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/slack-go/slack"
+
+	poppitv1 "github.com/its-the-vibe/VibeDeploy/api/poppit/v1"
+)
+
+// Capture record directions
+const (
+	CaptureConsumed  = "in"
+	CapturePublished = "out"
+)
+
+// Capture record sources, naming what consumed or produced each payload
+const (
+	CaptureReaction      = "reaction"
+	CaptureCommandOutput = "command_output"
+	CaptureCallback      = "callback"
+	CaptureLinkShared    = "link_shared"
+	CaptureSlashCommand  = "slash_command"
+	CaptureInteraction   = "interaction"
+	CaptureSlackMetadata = "slack_metadata"
+	CapturePoppitCommand = "poppit_command"
+	CaptureSlackReaction = "slack_reaction"
+)
+
+// captureStreamMaxLen bounds the capture stream; older records are trimmed as new ones arrive
+const captureStreamMaxLen = 100000
+
+// redactedValue replaces secrets in captured payloads
+const redactedValue = "[REDACTED]"
+
+// redactedKeyParts mark JSON keys whose values are secrets, matched case-insensitively as substrings
+var redactedKeyParts = []string{"token", "secret", "password", "api_key", "authorization", "response_url"}
+
+// slackTokenPattern matches Slack tokens wherever they appear, such as in command output
+var slackTokenPattern = regexp.MustCompile(`xox[abeprs]-[A-Za-z0-9-]+`)
+
+// CaptureRecord is one consumed or published payload, in the order VibeDeploy handled them
+type CaptureRecord struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Source    string    `json:"source"`
+	Channel   string    `json:"channel,omitempty"`
+	// Payload is the redacted plaintext payload; payloads that are not JSON are stored as a JSON string
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Capture tees live traffic to a timestamped file and/or a Redis stream, so it can be replayed locally
+type Capture struct {
+	mu          sync.Mutex
+	file        *os.File
+	redisClient *redis.Client
+	stream      string
+}
+
+// newCapture opens the capture sinks, or returns nil when neither CAPTURE_DIR nor CAPTURE_STREAM is set
+func newCapture(config Config, redisClient *redis.Client) (*Capture, error) {
+	if config.CaptureDir == "" && config.CaptureStream == "" {
+		return nil, nil
+	}
+	c := &Capture{redisClient: redisClient, stream: config.CaptureStream}
+	if config.CaptureDir != "" {
+		if err := os.MkdirAll(config.CaptureDir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create CAPTURE_DIR: %w", err)
+		}
+		name := filepath.Join(config.CaptureDir, "capture-"+time.Now().UTC().Format("20060102T150405Z")+".jsonl")
+		file, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open capture file: %w", err)
+		}
+		c.file = file
+	}
+	return c, nil
+}
+
+// target describes where records go, for the startup log
+func (c *Capture) target() string {
+	var targets []string
+	if c.file != nil {
+		targets = append(targets, c.file.Name())
+	}
+	if c.stream != "" {
+		targets = append(targets, "stream "+c.stream)
+	}
+	return strings.Join(targets, " and ")
+}
+
+// consumed records a payload read from Redis or the executor callback, decrypting it first
+func (c *Capture) consumed(ctx context.Context, cipher *PayloadCipher, source, channel string, payload []byte) {
+	if c == nil {
+		return
+	}
+	plaintext, err := cipher.open(payload)
+	if err != nil {
+		plaintext = payload
+	}
+	// Protobuf output is stored as JSON so it can be redacted and read; replay accepts either encoding
+	if poppitv1.ContentType(plaintext) == poppitv1.ContentTypeProtobuf {
+		if output, err := poppitv1.ParseCommandOutput(plaintext); err == nil {
+			if encoded, err := json.Marshal(output); err == nil {
+				plaintext = encoded
+			}
+		}
+	}
+	c.record(ctx, CaptureConsumed, source, channel, plaintext)
+}
+
+// published records a plaintext payload VibeDeploy is about to push or publish
+func (c *Capture) published(ctx context.Context, source, channel string, payload []byte) {
+	if c == nil {
+		return
+	}
+	c.record(ctx, CapturePublished, source, channel, payload)
+}
+
+// metadata records the PR metadata read from a Slack message, which replay serves in place of Slack
+func (c *Capture) metadata(ctx context.Context, channel, ts string, metadata *PRMetadata) {
+	if c == nil {
+		return
+	}
+	payload, err := json.Marshal(capturedMetadata{Channel: channel, Ts: ts, Metadata: metadata})
+	if err != nil {
+		return
+	}
+	c.record(ctx, CaptureConsumed, CaptureSlackMetadata, "", payload)
+}
+
+func (c *Capture) record(ctx context.Context, direction, source, channel string, payload []byte) {
+	line, err := json.Marshal(CaptureRecord{
+		Time:      time.Now().UTC(),
+		Direction: direction,
+		Source:    source,
+		Channel:   channel,
+		Payload:   redactPayload(payload),
+	})
+	if err != nil {
+		logWarn("Failed to capture %s payload: %v", source, err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.file != nil {
+		if _, err := c.file.Write(append(line, '\n')); err != nil {
+			logWarn("Failed to write capture record: %v", err)
+		}
+	}
+	if c.stream != "" {
+		if err := c.redisClient.XAdd(ctx, &redis.XAddArgs{
+			Stream: c.stream,
+			MaxLen: captureStreamMaxLen,
+			Approx: true,
+			Values: map[string]interface{}{"record": line},
+		}).Err(); err != nil {
+			logWarn("Failed to add capture record to %s: %v", c.stream, err)
+		}
+	}
+}
+
+// capturedMetadata is the payload of a slack_metadata record
+type capturedMetadata struct {
+	Channel  string      `json:"channel"`
+	Ts       string      `json:"ts"`
+	Metadata *PRMetadata `json:"metadata"`
+}
+
+// redactPayload returns a payload with secrets replaced, as JSON
+func redactPayload(payload []byte) json.RawMessage {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		encoded, _ := json.Marshal(slackTokenPattern.ReplaceAllString(string(payload), redactedValue))
+		return encoded
+	}
+	encoded, err := json.Marshal(redactValue(value))
+	if err != nil {
+		return json.RawMessage(`null`)
+	}
+	return encoded
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			switch {
+			case key == "env":
+				// Environment variables carry resolved secrets such as registry passwords
+				if env, ok := field.(map[string]interface{}); ok {
+					for name := range env {
+						env[name] = redactedValue
+					}
+					continue
+				}
+			case isSecretKey(key):
+				if field != nil && field != "" {
+					v[key] = redactedValue
+				}
+				continue
+			}
+			v[key] = redactValue(field)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+		return v
+	case string:
+		return slackTokenPattern.ReplaceAllString(v, redactedValue)
+	default:
+		return v
+	}
+}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, part := range redactedKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// captureExecutor records every command before handing it to the real executor
+type captureExecutor struct {
+	next    Executor
+	capture *Capture
+}
+
+func (e *captureExecutor) Name() string {
+	return e.next.Name()
+}
+
+func (e *captureExecutor) Execute(ctx context.Context, cmd PoppitCommand) error {
+	if payload, err := json.Marshal(cmd); err == nil {
+		e.capture.published(ctx, CapturePoppitCommand, e.next.Name(), payload)
+	}
+	return e.next.Execute(ctx, cmd)
+}
+
+// runCapture runs the capture subcommand; `capture replay` needs no Redis unless it reads a stream
+func runCapture(config Config, args []string) error {
+	if len(args) == 0 || args[0] != "replay" {
+		return fmt.Errorf("usage: vibedeploy capture replay [-stream KEY | FILE]")
+	}
+	fs := flag.NewFlagSet("capture replay", flag.ContinueOnError)
+	stream := fs.String("stream", "", "read the capture from this Redis stream instead of a file")
+	logLevel := fs.String("log-level", "INFO", "log level while the capture replays")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	currentLogLevel = parseLogLevel(*logLevel)
+	ctx := context.Background()
+
+	var records []CaptureRecord
+	var err error
+	switch {
+	case *stream != "" && fs.NArg() == 0:
+		records, err = readCaptureStream(ctx, config, *stream)
+	case *stream == "" && fs.NArg() == 1:
+		records, err = readCaptureFile(fs.Arg(0))
+	default:
+		return fmt.Errorf("usage: vibedeploy capture replay [-stream KEY | FILE]")
+	}
+	if err != nil {
+		return err
+	}
+	return replayCapture(ctx, config, records, os.Stdout)
+}
+
+func readCaptureFile(path string) ([]CaptureRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []CaptureRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var record CaptureRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+func readCaptureStream(ctx context.Context, config Config, stream string) ([]CaptureRecord, error) {
+	redisClient := redis.NewClient(&redis.Options{Addr: config.RedisAddr, Password: config.RedisPassword})
+	defer redisClient.Close()
+
+	messages, err := redisClient.XRange(ctx, stream, "-", "+").Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capture stream %s: %w", stream, err)
+	}
+	records := make([]CaptureRecord, 0, len(messages))
+	for _, msg := range messages {
+		raw, _ := msg.Values["record"].(string)
+		var record CaptureRecord
+		if err := json.Unmarshal([]byte(raw), &record); err != nil {
+			return nil, fmt.Errorf("capture record %s: %w", msg.ID, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// rawPayload returns the payload as it was consumed, unwrapping payloads that were stored as a JSON string
+func (r CaptureRecord) rawPayload() []byte {
+	var text string
+	if len(r.Payload) > 0 && r.Payload[0] == '"' && json.Unmarshal(r.Payload, &text) == nil {
+		return []byte(text)
+	}
+	return r.Payload
+}
+
+// replayExecutor prints the commands a replay generates, and maps captured deployment IDs to replayed ones
+type replayExecutor struct {
+	mu       sync.Mutex
+	out      io.Writer
+	captured map[string][]string
+	ids      map[string]string
+	count    int
+}
+
+func (e *replayExecutor) Name() string {
+	return "replay"
+}
+
+func (e *replayExecutor) Execute(ctx context.Context, cmd PoppitCommand) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.count++
+	if cmd.Metadata != nil {
+		key := cmd.Metadata.Channel + "/" + cmd.Metadata.Ts
+		if ids := e.captured[key]; len(ids) > 0 {
+			e.ids[ids[0]] = cmd.Metadata.DeploymentID
+			e.captured[key] = ids[1:]
+		}
+	}
+	payload, _ := json.Marshal(cmd)
+	fmt.Fprintf(e.out, "    -> %s %s\n", CapturePoppitCommand, redactPayload(payload))
+	return nil
+}
+
+// replayedID returns the replayed deployment ID for one from the capture
+func (e *replayExecutor) replayedID(captured string) (string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	id, ok := e.ids[captured]
+	return id, ok
+}
+
+// newReplaySlackServer stands in for the Slack API: message metadata comes from the capture, and
+// messages VibeDeploy would post are printed instead
+func newReplaySlackServer(out io.Writer, metadata map[string]*PRMetadata) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		r.ParseForm()
+		method := strings.TrimPrefix(r.URL.Path, "/")
+		switch method {
+		case "conversations.history":
+			message := map[string]interface{}{"type": "message", "ts": r.FormValue("latest")}
+			if pr := metadata[r.FormValue("channel")+"/"+r.FormValue("latest")]; pr != nil {
+				message["metadata"] = map[string]interface{}{"event_type": "pull_request", "event_payload": pr}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "messages": []interface{}{message}})
+			return
+		case "chat.postMessage", "chat.postEphemeral", "chat.update", "chat.unfurl", "response":
+			mu.Lock()
+			fmt.Fprintf(out, "    -> slack %s %s: %s\n", method, r.FormValue("channel"), replyText(r))
+			mu.Unlock()
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "channel": r.FormValue("channel"), "ts": "1700000000.000001"})
+	}))
+}
+
+// replyText is the text of a Slack call, from its form or, for slash command responses, its JSON body
+func replyText(r *http.Request) string {
+	if text := r.FormValue("text"); text != "" {
+		return text
+	}
+	var body struct {
+		Text string `json:"text"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	return body.Text
+}
+
+// replayCapture feeds consumed payloads back through the pipeline in dry-run: against an embedded
+// miniredis and a stand-in Slack, with commands printed instead of executed
+func replayCapture(ctx context.Context, config Config, records []CaptureRecord, out io.Writer) error {
+	mr, err := miniredis.Run()
+	if err != nil {
+		return fmt.Errorf("failed to start miniredis: %w", err)
+	}
+	defer mr.Close()
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer redisClient.Close()
+
+	// Index what the capture says happened, so the replay can stand in for Slack and follow deployments
+	metadata := make(map[string]*PRMetadata)
+	executor := &replayExecutor{out: out, captured: make(map[string][]string), ids: make(map[string]string)}
+	capturedCommands := 0
+	for _, record := range records {
+		switch {
+		case record.Source == CaptureSlackMetadata:
+			var captured capturedMetadata
+			if json.Unmarshal(record.Payload, &captured) == nil {
+				metadata[captured.Channel+"/"+captured.Ts] = captured.Metadata
+			}
+		case record.Direction == CapturePublished && record.Source == CapturePoppitCommand:
+			capturedCommands++
+			var cmd PoppitCommand
+			if json.Unmarshal(record.Payload, &cmd) == nil && cmd.Metadata != nil {
+				key := cmd.Metadata.Channel + "/" + cmd.Metadata.Ts
+				executor.captured[key] = append(executor.captured[key], cmd.Metadata.DeploymentID)
+			}
+		}
+	}
+
+	slackServer := newReplaySlackServer(out, metadata)
+	defer slackServer.Close()
+
+	reposConfig, err := loadReposConfig(config.AllowedReposConfig)
+	if err != nil {
+		return fmt.Errorf("failed to load allowed repos config: %w", err)
+	}
+	replayConfig := config
+	replayConfig.RedisReactionList = "vibedeploy:replay:reactions"
+	replayConfig.HTTPAddr = ""
+	app := &App{
+		config:       replayConfig,
+		redisClient:  redisClient,
+		slackClient:  slack.New("xoxb-replay", slack.OptionAPIURL(slackServer.URL+"/")),
+		executor:     executor,
+		deployments:  &RedisDeploymentStore{redisClient: redisClient},
+		allowedRepos: reposConfig.allowedRepoSet(),
+		reposConfig:  reposConfig,
+		shedder:      newLoadShedder(),
+		secrets:      EnvSecretsProvider{},
+	}
+	if app.policy, err = newCommandPolicy(reposConfig.CommandPolicy); err != nil {
+		return err
+	}
+	if app.retry, err = newRetryPolicy(reposConfig.Retry); err != nil {
+		return err
+	}
+	if app.output, err = newOutputFilter(reposConfig.Output); err != nil {
+		return err
+	}
+
+	replayed := 0
+	for _, record := range records {
+		if record.Direction != CaptureConsumed || record.Source == CaptureSlackMetadata {
+			continue
+		}
+		fmt.Fprintf(out, "%s %s %s\n", record.Time.Format(time.RFC3339Nano), record.Source, record.Payload)
+		payload := string(record.rawPayload())
+		switch record.Source {
+		case CaptureReaction:
+			app.processReactionEvent(ctx, payload)
+		case CaptureCommandOutput, CaptureCallback:
+			app.processCommandOutput(ctx, executor.followDeployment(payload))
+		case CaptureLinkShared:
+			app.processLinkSharedEvent(ctx, payload)
+		case CaptureSlashCommand:
+			app.processSlashCommand(ctx, replyToServer(payload, slackServer.URL+"/response"))
+		case CaptureInteraction:
+			app.processInteraction(ctx, payload)
+		default:
+			fmt.Fprintf(out, "    (skipped unknown source %q)\n", record.Source)
+			continue
+		}
+		replayed++
+		printReplayedReactions(ctx, redisClient, replayConfig.RedisReactionList, out)
+	}
+
+	fmt.Fprintf(out, "replayed %d consumed payloads: %d Poppit commands generated (%d captured)\n", replayed, executor.count, capturedCommands)
+	return nil
+}
+
+// followDeployment points captured command output at the deployment the replay started in its place
+func (e *replayExecutor) followDeployment(payload string) string {
+	var output CommandOutput
+	if json.Unmarshal([]byte(payload), &output) != nil || output.Metadata == nil {
+		return payload
+	}
+	id, ok := e.replayedID(output.Metadata.DeploymentID)
+	if !ok {
+		return payload
+	}
+	output.Metadata.DeploymentID = id
+	encoded, err := json.Marshal(output)
+	if err != nil {
+		return payload
+	}
+	return string(encoded)
+}
+
+// replyToServer sends a slash command's replies to the stand-in Slack; the captured response URL is redacted
+func replyToServer(payload, url string) string {
+	var command map[string]interface{}
+	if json.Unmarshal([]byte(payload), &command) != nil {
+		return payload
+	}
+	command["response_url"] = url
+	encoded, err := json.Marshal(command)
+	if err != nil {
+		return payload
+	}
+	return string(encoded)
+}
+
+// printReplayedReactions drains the reactions the last payload produced
+func printReplayedReactions(ctx context.Context, redisClient *redis.Client, list string, out io.Writer) {
+	for {
+		payload, err := redisClient.LPop(ctx, list).Result()
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(out, "    -> %s %s\n", CaptureSlackReaction, payload)
+	}
+}
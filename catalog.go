@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// defaultCatalogAnnotation is the entity annotation that holds the deployed version
+const defaultCatalogAnnotation = "vibedeploy.io/deployed-version"
+
+var catalogHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// CatalogConfig is the catalog section of the repos config file: where deployment events are pushed so a
+// service catalog such as Backstage can keep each component's deployed version current
+type CatalogConfig struct {
+	// URL receives a POST per event, e.g. Backstage's events endpoint https://backstage.example.com/api/events/http/deployments
+	URL string `yaml:"url"`
+	// TokenSecret names a bearer token in the secrets provider
+	TokenSecret string `yaml:"token_secret"`
+	// Annotation is set to the deployed version on success (default: vibedeploy.io/deployed-version)
+	Annotation string `yaml:"annotation"`
+}
+
+func (c *CatalogConfig) validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("catalog url %q must be an http(s) URL", c.URL)
+	}
+	return nil
+}
+
+func (c *CatalogConfig) annotation() string {
+	if c.Annotation == "" {
+		return defaultCatalogAnnotation
+	}
+	return c.Annotation
+}
+
+// CatalogComponentConfig is the catalog section of a repository's settings
+type CatalogComponentConfig struct {
+	// Component is the entity ref the repository is catalogued as, e.g. component:default/vibemerge
+	Component string `yaml:"component"`
+	// Environments maps environments of the promotion chain to entity refs of their own
+	Environments map[string]string `yaml:"environments"`
+}
+
+func (c *CatalogComponentConfig) validate() error {
+	if c.Component == "" && len(c.Environments) == 0 {
+		return fmt.Errorf("catalog needs a component or environments")
+	}
+	return nil
+}
+
+// entityRef returns the catalog entity of the environment, or "" if it isn't catalogued
+func (c *CatalogComponentConfig) entityRef(environment string) string {
+	if ref, ok := c.Environments[environment]; ok {
+		return ref
+	}
+	return c.Component
+}
+
+// CatalogEvent is the body pushed to the catalog for each deployment event
+type CatalogEvent struct {
+	Type        string `json:"type"`
+	EntityRef   string `json:"entity_ref"`
+	Repository  string `json:"repository"`
+	Environment string `json:"environment,omitempty"`
+	// Annotations are what the entity's annotations should become; only successful deployments carry them
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Deployment  *Deployment       `json:"deployment"`
+}
+
+// deployedVersion is the deployment's release tag if the commit has one, or else its git SHA
+func deployedVersion(d *Deployment) string {
+	if len(d.Build.Tags) > 0 {
+		return d.Build.Tags[0]
+	}
+	return d.Build.GitSHA
+}
+
+// notifyCatalog pushes a deployment event to the service catalog. Catalog problems are logged and never
+// affect the deployment.
+func (a *App) notifyCatalog(ctx context.Context, eventType string, d *Deployment) {
+	if a.reposConfig == nil || a.reposConfig.Catalog == nil || workflowOf(d) != WorkflowDeploy {
+		return
+	}
+	component := a.repoConfig(d.Repository).Catalog
+	if component == nil {
+		return
+	}
+	ref := component.entityRef(d.Environment)
+	if ref == "" {
+		return
+	}
+	config := a.reposConfig.Catalog
+
+	event := CatalogEvent{Type: eventType, EntityRef: ref, Repository: d.Repository, Environment: d.Environment, Deployment: d}
+	if d.Status == StatusSucceeded {
+		if version := deployedVersion(d); version != "" {
+			event.Annotations = map[string]string{config.annotation(): version}
+		}
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		logError("Error marshalling catalog event for deployment %s: %v", d.ID, err)
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.URL, bytes.NewReader(data))
+	if err != nil {
+		logError("Error building catalog event for deployment %s: %v", d.ID, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if config.TokenSecret != "" {
+		token, err := a.secrets.Secret(ctx, config.TokenSecret)
+		if err != nil {
+			logError("Error resolving catalog token: %v", err)
+			return
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := catalogHTTPClient.Do(req)
+	if err != nil {
+		logError("Error pushing %s of deployment %s to the catalog: %v", eventType, d.ID, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		logError("Catalog returned %s for %s of deployment %s: %s", resp.Status, eventType, d.ID, strings.TrimSpace(string(message)))
+		return
+	}
+	logInfo("Pushed %s of deployment %s to catalog entity %s", eventType, d.ID, ref)
+}
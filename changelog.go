@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// maxChangelogHighlights is the most changelog lines quoted in an announcement
+const maxChangelogHighlights = 10
+
+// ChangelogConfig is the changelog section of a repository's settings
+type ChangelogConfig struct {
+	// Channel is the Slack channel ID announcements are posted to, e.g. #changelog
+	Channel string `yaml:"channel"`
+	// Branches are the production branches whose deployments are announced (default: main)
+	Branches []string `yaml:"branches"`
+	// File is the changelog highlights are taken from (default: CHANGELOG.md)
+	File string `yaml:"file"`
+}
+
+// announces reports whether deployments of a branch are announced
+func (c *ChangelogConfig) announces(branch string) bool {
+	if len(c.Branches) == 0 {
+		return branch == "main"
+	}
+	return containsString(c.Branches, branch)
+}
+
+// tagAt returns a tag pointing at the commit, or "" if none does among the most recent tags
+func (g *GitHubApp) tagAt(ctx context.Context, repo, sha string) (string, error) {
+	token, err := g.token(ctx, repo)
+	if err != nil {
+		return "", err
+	}
+	var tags []struct {
+		Name   string `json:"name"`
+		Commit struct {
+			SHA string `json:"sha"`
+		} `json:"commit"`
+	}
+	if err := g.do(ctx, token, http.MethodGet, "/repos/"+repo+"/tags?per_page=100", nil, &tags); err != nil {
+		return "", fmt.Errorf("failed to list tags: %w", err)
+	}
+	for _, tag := range tags {
+		if tag.Commit.SHA == sha {
+			return tag.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// fileAt returns a file's contents at a commit
+func (g *GitHubApp) fileAt(ctx context.Context, repo, path, sha string) (string, error) {
+	token, err := g.token(ctx, repo)
+	if err != nil {
+		return "", err
+	}
+	var file struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	if err := g.do(ctx, token, http.MethodGet, "/repos/"+repo+"/contents/"+path+"?ref="+sha, nil, &file); err != nil {
+		return "", fmt.Errorf("failed to get %s: %w", path, err)
+	}
+	if file.Encoding != "base64" {
+		return "", fmt.Errorf("unexpected %s encoding %q", path, file.Encoding)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(file.Content, "\n", ""))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return string(data), nil
+}
+
+// changelogHighlights returns the lines of the newest released section of a markdown changelog,
+// skipping an "Unreleased" section, with list markers turned into bullets
+func changelogHighlights(changelog string) []string {
+	var highlights []string
+	inSection := false
+	for _, line := range strings.Split(changelog, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "## ") {
+			if inSection {
+				break
+			}
+			inSection = !strings.Contains(strings.ToLower(trimmed), "unreleased")
+			continue
+		}
+		if !inSection || trimmed == "" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "### ") {
+			trimmed = "*" + strings.TrimPrefix(trimmed, "### ") + "*"
+		} else if strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* ") {
+			trimmed = "• " + trimmed[2:]
+		}
+		highlights = append(highlights, trimmed)
+		if len(highlights) == maxChangelogHighlights {
+			break
+		}
+	}
+	return highlights
+}
+
+// announceDeployment posts a successful production deployment to the repository's changelog channel
+func (a *App) announceDeployment(ctx context.Context, d *Deployment) {
+	config := a.repoConfig(d.Repository).Changelog
+	if config == nil || config.Channel == "" || !config.announces(d.Branch) {
+		return
+	}
+
+	version := shortSHA(d.Build.GitSHA)
+	var highlights []string
+	if a.github != nil && d.Build.GitSHA != "" {
+		if tag, err := a.github.tagAt(ctx, d.Repository, d.Build.GitSHA); err != nil {
+			logWarn("Could not look up the tag of %s for the changelog announcement: %v", d.Repository, err)
+		} else if tag != "" {
+			version = tag
+		}
+
+		file := config.File
+		if file == "" {
+			file = "CHANGELOG.md"
+		}
+		if changelog, err := a.github.fileAt(ctx, d.Repository, file, d.Build.GitSHA); err != nil {
+			logWarn("Could not read the changelog of %s for the announcement: %v", d.Repository, err)
+		} else {
+			highlights = changelogHighlights(changelog)
+		}
+	}
+
+	title := fmt.Sprintf(":tada: *%s*", d.Repository)
+	if version != "" {
+		title += fmt.Sprintf(" `%s`", version)
+	}
+	lines := []string{title + " is live"}
+	deployedBy := fmt.Sprintf("Deployed from `%s`", d.Branch)
+	if mention := formatMention(d.TriggeredBy); mention != "" {
+		deployedBy += " by " + mention
+	}
+	lines = append(lines, deployedBy)
+	lines = append(lines, highlights...)
+
+	if err := a.notifyChannel(ctx, config.Channel, strings.Join(lines, "\n"), false); err != nil {
+		logError("Error posting changelog announcement for deployment %s to channel %s: %v", d.ID, config.Channel, err)
+		return
+	}
+	logInfo("Announced deployment %s of %s %s in channel %s", d.ID, d.Repository, version, config.Channel)
+}
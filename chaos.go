@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Chaos injects failures so integration tests and game days can check that the watchdog, retries
+// and alerting really work. It is enabled with CHAOS_ENABLED=true and is deliberately undocumented
+// outside TESTING.md; never turn it on in production.
+type Chaos struct {
+	// dropOutputPercent is the share of command output messages ignored as if never received
+	dropOutputPercent int
+	// publishDelay holds back every command dispatch and reaction publish
+	publishDelay time.Duration
+	// slackRateLimitPercent is the share of Slack API calls answered with 429 Too Many Requests
+	slackRateLimitPercent int
+}
+
+// newChaos returns nil unless failure injection is enabled
+func newChaos(config Config) *Chaos {
+	if !config.ChaosEnabled {
+		return nil
+	}
+	return &Chaos{
+		dropOutputPercent:     clampPercent(config.ChaosDropOutputPercent),
+		publishDelay:          config.ChaosPublishDelay,
+		slackRateLimitPercent: clampPercent(config.ChaosSlackRateLimitPercent),
+	}
+}
+
+func clampPercent(percent int) int {
+	return max(0, min(percent, 100))
+}
+
+// roll reports whether an event with the given percent chance happens
+func roll(percent int) bool {
+	return percent > 0 && rand.IntN(100) < percent
+}
+
+// dropOutput reports whether a command output message should be thrown away
+func (c *Chaos) dropOutput() bool {
+	return c != nil && roll(c.dropOutputPercent)
+}
+
+// delayPublish waits out the publish delay, returning early if the context is cancelled
+func (c *Chaos) delayPublish(ctx context.Context) {
+	if c == nil || c.publishDelay <= 0 {
+		return
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(c.publishDelay):
+	}
+}
+
+// slackHTTPClient returns the HTTP client for the Slack API, rate limiting some calls when enabled
+func (c *Chaos) slackHTTPClient() *http.Client {
+	if c == nil || c.slackRateLimitPercent == 0 {
+		return &http.Client{}
+	}
+	return &http.Client{Transport: &rateLimitingTransport{next: http.DefaultTransport, percent: c.slackRateLimitPercent}}
+}
+
+// rateLimitingTransport answers a share of requests the way Slack does when rate limited
+type rateLimitingTransport struct {
+	next    http.RoundTripper
+	percent int
+}
+
+func (t *rateLimitingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !roll(t.percent) {
+		return t.next.RoundTrip(req)
+	}
+	logWarn("Chaos: answering Slack API call %s with 429", req.URL.Path)
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	header := make(http.Header)
+	header.Set("Retry-After", "1")
+	header.Set("Content-Type", "application/json")
+	return &http.Response{
+		Status:     "429 Too Many Requests",
+		StatusCode: http.StatusTooManyRequests,
+		Proto:      req.Proto,
+		ProtoMajor: req.ProtoMajor,
+		ProtoMinor: req.ProtoMinor,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(`{"ok":false,"error":"ratelimited"}`)),
+		Request:    req,
+	}, nil
+}
+
+// chaosExecutor delays every dispatch before handing it to the real executor
+type chaosExecutor struct {
+	next  Executor
+	chaos *Chaos
+}
+
+func (e *chaosExecutor) Name() string {
+	return e.next.Name()
+}
+
+func (e *chaosExecutor) Execute(ctx context.Context, cmd PoppitCommand) error {
+	e.chaos.delayPublish(ctx)
+	return e.next.Execute(ctx, cmd)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// coalesceKeyPrefix holds, per message, the deployment its first rocket started, for REACTION_COALESCE_WINDOW
+const coalesceKeyPrefix = "vibedeploy:coalesce:"
+
+// coalescePending marks a message whose first rocket is still starting its deployment
+const coalescePending = "pending"
+
+// coalescePollInterval is how often a later rocket checks whether the first one's deployment has started
+const coalescePollInterval = 100 * time.Millisecond
+
+// deployFromReaction starts a deployment for a rocket, unless another rocket on the same message started one
+// within REACTION_COALESCE_WINDOW, in which case the reactor is credited on that deployment instead. It returns
+// the deployment started or joined, or nil if there is neither.
+func (a *App) deployFromReaction(ctx context.Context, metadata *PRMetadata, options DeployOptions, channel, ts, user string) *Deployment {
+	window := a.config.ReactionCoalesceWindow
+	if window <= 0 {
+		return a.deployFromRocket(ctx, metadata, options, channel, ts, user)
+	}
+
+	key := coalesceKeyPrefix + channel + ":" + ts
+	// Only another instance can still be starting the first deployment, so waiting longer than the window is pointless
+	deadline := time.Now().Add(window)
+	for {
+		claimed, err := a.redisClient.SetNX(ctx, key, coalescePending, window).Result()
+		if err != nil {
+			// Better to risk a duplicate deployment than to drop the reaction
+			logError("Error coalescing reactions on message %s: %v", ts, err)
+			return a.deployFromRocket(ctx, metadata, options, channel, ts, user)
+		}
+		if claimed {
+			d := a.deployFromRocket(ctx, metadata, options, channel, ts, user)
+			if d == nil {
+				// Nothing to join, so the next rocket gets its own go
+				a.redisClient.Del(ctx, key)
+				return nil
+			}
+			if err := a.redisClient.SetXX(ctx, key, d.ID, redis.KeepTTL).Err(); err != nil {
+				logError("Error recording deployment %s for coalescing: %v", d.ID, err)
+			}
+			return d
+		}
+
+		id, err := a.redisClient.Get(ctx, key).Result()
+		switch {
+		case err == redis.Nil:
+			// The window closed, or the first rocket started nothing; claim the message again
+			continue
+		case err != nil:
+			logError("Error coalescing reactions on message %s: %v", ts, err)
+			return a.deployFromRocket(ctx, metadata, options, channel, ts, user)
+		case id != coalescePending:
+			return a.coalesceReaction(ctx, id, user)
+		}
+
+		if time.Now().After(deadline) {
+			logWarn("Deployment of message %s is still starting, not crediting %s's reaction", ts, user)
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(coalescePollInterval):
+		}
+	}
+}
+
+// coalescing reports whether rockets on the message are being coalesced into its deployment
+func (a *App) coalescing(ctx context.Context, channel, ts string) bool {
+	if a.config.ReactionCoalesceWindow <= 0 {
+		return false
+	}
+	n, err := a.redisClient.Exists(ctx, coalesceKeyPrefix+channel+":"+ts).Result()
+	return err == nil && n > 0
+}
+
+// deployFromRocket starts the deployment of a rocket reaction, returning nil if it didn't start
+func (a *App) deployFromRocket(ctx context.Context, metadata *PRMetadata, options DeployOptions, channel, ts, user string) *Deployment {
+	d, err := a.startDeployment(ctx, metadata, options, channel, ts, user)
+	if err != nil {
+		logError("Error starting deployment: %v", err)
+		return nil
+	}
+	return d
+}
+
+// coalesceReaction credits a reactor on the deployment another rocket started, and thanks them in its thread
+func (a *App) coalesceReaction(ctx context.Context, id, user string) *Deployment {
+	credited := false
+	d, err := updateDeployment(ctx, a.deployments, id, func(d *Deployment) {
+		if user == d.TriggeredBy || containsString(d.CoalescedReactors, user) {
+			return
+		}
+		d.CoalescedReactors = append(d.CoalescedReactors, user)
+		credited = true
+	})
+	if err != nil {
+		logError("Error crediting %s on deployment %s: %v", user, id, err)
+		return nil
+	}
+	if !credited {
+		logDebug("%s is already credited on deployment %s", user, id)
+		return d
+	}
+
+	logInfo("Coalesced %s's reaction into deployment %s", user, id)
+	a.recordEvent(ctx, EventDeploymentCoalesced, d)
+	text := a.messages.text("reaction.coalesced", map[string]interface{}{
+		"User":        user,
+		"TriggeredBy": d.TriggeredBy,
+		"Repository":  d.Repository,
+		"Branch":      d.Branch,
+	})
+	if err := a.postThreadMessage(ctx, d.Channel, d.Ts, text); err != nil {
+		logError("Error thanking %s for their reaction: %v", user, err)
+	}
+	return d
+}
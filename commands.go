@@ -0,0 +1,500 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	poppitv1 "github.com/its-the-vibe/VibeDeploy/api/poppit/v1"
+)
+
+// runSubcommand runs an admin subcommand (e.g. `vibedeploy replay`) against the configured Redis
+func runSubcommand(config Config, name string, args []string) error {
+	// The benchmark brings its own Redis unless told otherwise
+	if name == "bench" {
+		return runBench(config, args)
+	}
+	// Capture replay runs against an embedded miniredis too
+	if name == "capture" {
+		return runCapture(config, args)
+	}
+	// Showing the repos config needs no Redis
+	if name == "config" {
+		return runConfig(config, args)
+	}
+
+	ctx := context.Background()
+
+	redisClient := redis.NewClient(&redis.Options{
+		Addr:     config.RedisAddr,
+		Password: config.RedisPassword,
+	})
+	defer redisClient.Close()
+
+	if err := redisClient.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	switch name {
+	case "replay":
+		return runReplay(ctx, config, redisClient, args)
+	case "export":
+		return runExport(ctx, config, redisClient, args)
+	case "keys":
+		return runKeys(ctx, redisClient, args)
+	case "audit":
+		return runAudit(ctx, config, redisClient, args)
+	case "flags":
+		return runFlags(ctx, config, redisClient, args)
+	case "pool":
+		return runPool(ctx, config, redisClient, args)
+	case "queue":
+		return runQueue(ctx, config, redisClient, args)
+	case "workspaces":
+		return runWorkspaces(ctx, config, redisClient, args)
+	case "backfill":
+		return runBackfill(ctx, config, redisClient, args)
+	default:
+		return fmt.Errorf("unknown subcommand %q (available: replay, export, keys, audit, flags, pool, queue, workspaces, backfill, bench, capture, config)", name)
+	}
+}
+
+// runReplay rebuilds deployment records from the events stream and/or re-emits the events
+func runReplay(ctx context.Context, config Config, redisClient *redis.Client, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	from := fs.String("from", "-", "stream ID to start replaying from")
+	rebuild := fs.Bool("rebuild", true, "rebuild deployment records and history from the events")
+	emit := fs.String("emit", "", "Redis pub/sub channel to re-publish each event to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	contentType, err := queueContentType(config.QueueEncoding)
+	if err != nil {
+		return err
+	}
+
+	store, err := newDeploymentStore(config, redisClient)
+	if err != nil {
+		return fmt.Errorf("failed to open %s deployment store: %w", config.StoreBackend, err)
+	}
+	count, err := replayEvents(ctx, redisClient, *from, func(event *LifecycleEvent) error {
+		if *rebuild {
+			// Delegation events have no deployment to rebuild, only their audit log entry
+			if event.Deployment != nil {
+				if err := store.Save(ctx, event.Deployment); err != nil {
+					return fmt.Errorf("failed to rebuild deployment %s from event %s: %w", event.Deployment.ID, event.ID, err)
+				}
+			}
+			if recorder, ok := store.(EventRecorder); ok {
+				if err := recorder.RecordEvent(ctx, event); err != nil {
+					return fmt.Errorf("failed to rebuild audit log from event %s: %w", event.ID, err)
+				}
+			}
+		}
+		if *emit != "" {
+			payload, err := encodeLifecycleEvent(event, contentType)
+			if err != nil {
+				return fmt.Errorf("failed to marshal event %s: %w", event.ID, err)
+			}
+			if err := redisClient.Publish(ctx, *emit, payload).Err(); err != nil {
+				return fmt.Errorf("failed to publish event %s: %w", event.ID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	logInfo("Replayed %d lifecycle events from %s (rebuild: %t, emit: %q)", count, eventsStreamKey, *rebuild, *emit)
+	return nil
+}
+
+// encodeLifecycleEvent encodes an event for publishing: the stored JSON, or a marked vibedeploy.v1.DeploymentEvent
+func encodeLifecycleEvent(event *LifecycleEvent, contentType string) ([]byte, error) {
+	if contentType == poppitv1.ContentTypeProtobuf {
+		return poppitv1.MarshalProtobuf(toProtoEvent(event))
+	}
+	return json.Marshal(event)
+}
+
+// runExport writes deployment history as CSV or JSON to stdout or a file
+func runExport(ctx context.Context, config Config, redisClient *redis.Client, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", ExportFormatCSV, "output format: csv or json")
+	repo := fs.String("repo", "", "only export this repository (default: all)")
+	sinceRaw := fs.String("since", "", "only export deployments started at or after this time (RFC 3339 or YYYY-MM-DD)")
+	output := fs.String("o", "", "file to write to (default: stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	since, err := parseExportSince(*sinceRaw)
+	if err != nil {
+		return err
+	}
+
+	store, err := newDeploymentStore(config, redisClient)
+	if err != nil {
+		return fmt.Errorf("failed to open %s deployment store: %w", config.StoreBackend, err)
+	}
+
+	deployments, err := collectExport(ctx, store, *repo, since)
+	if err != nil {
+		return err
+	}
+
+	w := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *output, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return writeExport(w, *format, deployments)
+}
+
+// runKeys creates, lists and revokes HTTP API keys
+func runKeys(ctx context.Context, redisClient *redis.Client, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: vibedeploy keys create|list|revoke")
+	}
+
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("keys create", flag.ContinueOnError)
+		name := fs.String("name", "", "who or what the key is for")
+		scopeRaw := fs.String("scope", string(ScopeRead), "key scope: read, trigger or admin")
+		reposRaw := fs.String("repos", "", "comma-separated repository patterns the key is limited to, such as its-the-vibe/*")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *name == "" {
+			return fmt.Errorf("-name is required")
+		}
+		scope, err := parseScope(*scopeRaw)
+		if err != nil {
+			return err
+		}
+
+		var repos []string
+		for _, pattern := range strings.Split(*reposRaw, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern == "" {
+				continue
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid repository pattern %q: %w", pattern, err)
+			}
+			repos = append(repos, pattern)
+		}
+
+		token, key, err := createAPIKey(ctx, redisClient, *name, scope, repos)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created %s key %s for %q. The token is shown only once:\n%s\n", key.Scope, key.ID, key.Name, token)
+		return nil
+	case "list":
+		_, keys, err := listAPIKeys(ctx, redisClient)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			repos := "all"
+			if len(key.Repos) > 0 {
+				repos = strings.Join(key.Repos, ",")
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\t%s\n", key.ID, key.Scope, repos, key.CreatedAt.Format(time.RFC3339), key.Name)
+		}
+		return nil
+	case "revoke":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: vibedeploy keys revoke <id>")
+		}
+		if err := revokeAPIKey(ctx, redisClient, args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("Revoked key %s\n", args[1])
+		return nil
+	default:
+		return fmt.Errorf("unknown keys command %q (available: create, list, revoke)", args[0])
+	}
+}
+
+// runAudit verifies the audit hash chain, exports a signed batch now, or verifies a downloaded batch
+func runAudit(ctx context.Context, config Config, redisClient *redis.Client, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: vibedeploy audit verify|export|verify-batch")
+	}
+
+	switch args[0] {
+	case "verify":
+		verified, unchained, err := verifyEventsStream(ctx, redisClient)
+		if err != nil {
+			return fmt.Errorf("audit chain is broken after %d verified entries: %w", verified, err)
+		}
+		fmt.Printf("Audit chain intact: %d entries verified, %d older entries without hashes\n", verified, unchained)
+		return nil
+	case "export":
+		exporter, err := newAuditExporter(config, redisClient)
+		if err != nil {
+			return err
+		}
+		if exporter == nil {
+			return fmt.Errorf("AUDIT_EXPORT_URL is not set")
+		}
+		count, err := exporter.export(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Exported %d audit entries\n", count)
+		return nil
+	case "verify-batch":
+		fs := flag.NewFlagSet("audit verify-batch", flag.ContinueOnError)
+		publicKey := fs.String("public-key", "", "Ed25519 public key (PEM) matching AUDIT_SIGNING_KEY")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *publicKey == "" || fs.NArg() != 1 {
+			return fmt.Errorf("usage: vibedeploy audit verify-batch -public-key <pem> <batch.json>")
+		}
+
+		key, err := loadVerifyKey(*publicKey)
+		if err != nil {
+			return err
+		}
+		body, err := os.ReadFile(fs.Arg(0))
+		if err != nil {
+			return fmt.Errorf("failed to read batch: %w", err)
+		}
+		signature, err := os.ReadFile(fs.Arg(0) + ".sig")
+		if err != nil {
+			return fmt.Errorf("failed to read batch signature: %w", err)
+		}
+		batch, err := verifyAuditBatch(body, string(signature), key)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Batch verified: %d entries from %s to %s, chained from %q\n", len(batch.Entries), batch.FirstID, batch.LastID, batch.PrevHash)
+		return nil
+	default:
+		return fmt.Errorf("unknown audit command %q (available: verify, export, verify-batch)", args[0])
+	}
+}
+
+// runFlags lists feature flags and sets or clears their Redis overrides
+func runFlags(ctx context.Context, config Config, redisClient *redis.Client, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: vibedeploy flags list|set|clear")
+	}
+
+	switch args[0] {
+	case "list":
+		reposConfig, err := loadReposConfig(config.AllowedReposConfig)
+		if err != nil {
+			return err
+		}
+		app := &App{redisClient: redisClient, reposConfig: reposConfig}
+		for _, name := range knownFlagNames() {
+			rule, err := app.flagRule(ctx, name)
+			if err != nil {
+				return err
+			}
+			switch {
+			case rule == nil:
+				fmt.Printf("%s\tdefault\tenabled=%t\n", name, knownFlags[name])
+			case rule.Enabled:
+				fmt.Printf("%s\tset\tenabled=true\n", name)
+			default:
+				fmt.Printf("%s\tset\tenabled=false repos=%s users=%s\n", name, strings.Join(rule.Repos, ","), strings.Join(rule.Users, ","))
+			}
+		}
+		return nil
+	case "set":
+		fs := flag.NewFlagSet("flags set", flag.ContinueOnError)
+		enabled := fs.Bool("enabled", false, "turn the flag on everywhere")
+		repos := fs.String("repos", "", "comma-separated repositories or patterns to turn the flag on for")
+		users := fs.String("users", "", "comma-separated Slack user IDs to turn the flag on for")
+		if len(args) < 2 {
+			return fmt.Errorf("usage: vibedeploy flags set <name> [-enabled] [-repos a/b,c/*] [-users U123]")
+		}
+		if err := fs.Parse(args[2:]); err != nil {
+			return err
+		}
+
+		rule := FlagRule{Enabled: *enabled, Repos: splitList(*repos), Users: splitList(*users)}
+		if err := setFlagOverride(ctx, redisClient, args[1], rule); err != nil {
+			return err
+		}
+		fmt.Printf("Set %s override\n", args[1])
+		return nil
+	case "clear":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: vibedeploy flags clear <name>")
+		}
+		if err := clearFlagOverride(ctx, redisClient, args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("Cleared %s override\n", args[1])
+		return nil
+	default:
+		return fmt.Errorf("unknown flags command %q (available: list, set, clear)", args[0])
+	}
+}
+
+// runPool lists and releases port/hostname allocations
+func runPool(ctx context.Context, config Config, redisClient *redis.Client, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: vibedeploy pool list|release")
+	}
+
+	switch args[0] {
+	case "list":
+		allocations, err := listAllocations(ctx, redisClient)
+		if err != nil {
+			return err
+		}
+		for _, allocation := range allocations {
+			port := "-"
+			if allocation.Port != 0 {
+				port = strconv.Itoa(allocation.Port)
+			}
+			hostname := allocation.Hostname
+			if hostname == "" {
+				hostname = "-"
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\t%s\n", allocation.key(), allocation.Branch, port, hostname, allocation.AllocatedAt.Format(time.RFC3339))
+		}
+		return nil
+	case "release":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: vibedeploy pool release <owner/repo>[/<workspace>]")
+		}
+		if err := releaseAllocation(ctx, redisClient, args[1]); err != nil {
+			return err
+		}
+		// Releasing is the preview environment's teardown, so its route goes too
+		proxy, err := newRouteProvider(config)
+		if err != nil {
+			return err
+		}
+		if proxy != nil {
+			if err := proxy.Remove(ctx, args[1]); err != nil {
+				return err
+			}
+			fmt.Printf("Removed %s route for %s\n", proxy.Name(), args[1])
+		}
+		fmt.Printf("Released allocation for %s\n", args[1])
+		return nil
+	default:
+		return fmt.Errorf("unknown pool command %q (available: list, release)", args[0])
+	}
+}
+
+// runQueue lists deployments that no worker has picked up yet, or cancels one of them
+func runQueue(ctx context.Context, config Config, redisClient *redis.Client, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: vibedeploy queue list|cancel")
+	}
+	app, err := queueAdminApp(config, redisClient)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		queued, err := app.listQueuedDeployments(ctx)
+		if err != nil {
+			return err
+		}
+		for _, q := range queued {
+			d := q.Deployment
+			fmt.Printf("%s\t%s\t%s\t%s\t%d\t%s\n", d.ID, d.Repository, d.Branch, q.Queue, q.Position, d.StartedAt.Format(time.RFC3339))
+		}
+		return nil
+	case "cancel":
+		fs := flag.NewFlagSet("queue cancel", flag.ContinueOnError)
+		by := fs.String("by", os.Getenv("USER"), "who is cancelling, shown in Slack and the deployment record")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: vibedeploy queue cancel [-by NAME] <deployment ID>")
+		}
+		if *by == "" {
+			*by = "vibedeploy queue cancel"
+		}
+		d, err := app.cancelQueuedDeployment(ctx, fs.Arg(0), *by)
+		if err != nil {
+			return fmt.Errorf("failed to cancel deployment %s: %w", fs.Arg(0), err)
+		}
+		fmt.Printf("Cancelled deployment %s of %s branch %s\n", d.ID, d.Repository, d.Branch)
+		// A deployment dispatched into the freed slot may run over SSH from this process
+		app.waitForHosts()
+		return nil
+	default:
+		return fmt.Errorf("unknown queue command %q (available: list, cancel)", args[0])
+	}
+}
+
+// runWorkspaces lists the ephemeral workspaces of feature deployments and tears them down
+func runWorkspaces(ctx context.Context, config Config, redisClient *redis.Client, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: vibedeploy workspaces list|teardown")
+	}
+	app, err := queueAdminApp(config, redisClient)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		workspaces, err := app.listWorkspaces(ctx)
+		if err != nil {
+			return err
+		}
+		for _, w := range workspaces {
+			fmt.Printf("%s\t%s\t%s\t%s/%s\t%s\t%s\n", w.DeploymentID, w.Repository, w.Branch, w.Dir, w.Name, w.Project, w.CreatedAt.Format(time.RFC3339))
+		}
+		return nil
+	case "teardown":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: vibedeploy workspaces teardown <deployment ID>")
+		}
+		// The workspace's route goes with it
+		if app.proxy, err = newRouteProvider(config); err != nil {
+			return err
+		}
+		if err := app.teardownWorkspace(ctx, args[1]); err != nil {
+			return fmt.Errorf("failed to tear down workspace of deployment %s: %w", args[1], err)
+		}
+		fmt.Printf("Tearing down workspace of deployment %s\n", args[1])
+		// The teardown may run over SSH from this process
+		app.waitForHosts()
+		return nil
+	default:
+		return fmt.Errorf("unknown workspaces command %q (available: list, teardown)", args[0])
+	}
+}
+
+// splitList splits a comma-separated flag value, ignoring empty entries
+func splitList(value string) []string {
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
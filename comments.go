@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// GitHubSignatureHeader carries GitHub's HMAC-SHA256 signature of a webhook body, in the same format as SignatureHeader
+const GitHubSignatureHeader = "X-Hub-Signature-256"
+
+// DeployCommentCommand starts a deployment when it begins a PR comment
+const DeployCommentCommand = "/deploy"
+
+// commentTriggersKey is a Redis set of deployment IDs started from a PR comment, which get a reply when they finish
+const commentTriggersKey = "vibedeploy:comment-triggers"
+
+// linkedMessageLookback is how many recent deployments of a repository are searched for the PR's Slack message
+const linkedMessageLookback = 50
+
+// trustedCommenters are the author associations allowed to deploy by comment when no RBAC is configured
+var trustedCommenters = []string{"OWNER", "MEMBER", "COLLABORATOR"}
+
+// IssueCommentEvent is the subset of GitHub's issue_comment webhook payload VibeDeploy reads
+type IssueCommentEvent struct {
+	Action string `json:"action"`
+	Issue  struct {
+		Number      int              `json:"number"`
+		PullRequest *json.RawMessage `json:"pull_request"`
+	} `json:"issue"`
+	Comment struct {
+		Body              string `json:"body"`
+		AuthorAssociation string `json:"author_association"`
+		User              struct {
+			Login string `json:"login"`
+		} `json:"user"`
+	} `json:"comment"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+// parseDeployComment returns the options for a /deploy comment, or ok=false if the comment isn't one. The
+// comment may name an environment, which the caller checks against the repository's promotion chain.
+func parseDeployComment(body string) (options DeployOptions, ok bool, err error) {
+	line, _, _ := strings.Cut(strings.TrimSpace(body), "\n")
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != DeployCommentCommand {
+		return options, false, nil
+	}
+	for _, arg := range fields[1:] {
+		switch {
+		case arg == "clean":
+			options.CleanBuild = true
+		case options.Environment == "" && !options.CleanBuild:
+			options.Environment = arg
+		default:
+			return options, true, fmt.Errorf("unknown option `%s`; use `%s [environment] [clean]`", arg, DeployCommentCommand)
+		}
+	}
+	return options, true, nil
+}
+
+// postIssueComment comments on a pull request
+func (g *GitHubApp) postIssueComment(ctx context.Context, repo string, number int, body string) error {
+	token, err := g.token(ctx, repo)
+	if err != nil {
+		return err
+	}
+	if err := g.do(ctx, token, http.MethodPost, "/repos/"+repo+"/issues/"+strconv.Itoa(number)+"/comments", map[string]string{"body": body}, nil); err != nil {
+		return fmt.Errorf("failed to comment on #%d: %w", number, err)
+	}
+	return nil
+}
+
+// handleGitHubWebhook receives GitHub webhooks and starts a deployment for /deploy PR comments
+func (a *App) handleGitHubWebhook(w http.ResponseWriter, r *http.Request) {
+	if a.config.GitHubWebhookSecret == "" || a.github == nil {
+		http.Error(w, "GitHub webhooks are not enabled", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCallbackBodySize))
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	if !verifySignature([]byte(a.config.GitHubWebhookSecret), body, r.Header.Get(GitHubSignatureHeader)) {
+		logWarn("Rejected GitHub webhook from %s with invalid signature", r.RemoteAddr)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	// Everything else the app is subscribed to, including ping, is acknowledged and ignored
+	switch r.Header.Get("X-GitHub-Event") {
+	case "issue_comment":
+	case "pull_request":
+		a.handlePullRequestEvent(w, r, body)
+		return
+	default:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	var event IssueCommentEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if event.Action != "created" || event.Issue.PullRequest == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	a.processDeployComment(r.Context(), event)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// processDeployComment deploys the PR a /deploy comment was left on, replying on the PR
+func (a *App) processDeployComment(ctx context.Context, event IssueCommentEvent) {
+	options, ok, err := parseDeployComment(event.Comment.Body)
+	if !ok {
+		return
+	}
+
+	repo, number, login := a.canonicalRepo(event.Repository.FullName), event.Issue.Number, event.Comment.User.Login
+	logInfo("Processing %s comment by %s on %s#%d", DeployCommentCommand, login, repo, number)
+	reply := func(text string) {
+		if err := a.github.postIssueComment(ctx, repo, number, text); err != nil {
+			logError("Error replying to %s comment on %s#%d: %v", DeployCommentCommand, repo, number, err)
+		}
+	}
+
+	if err != nil {
+		reply(":warning: " + err.Error())
+		return
+	}
+	if !isRepoAllowed(repo, a.allowedRepos) {
+		logInfo("Repository %s is not in the allowed list, ignoring %s comment", repo, DeployCommentCommand)
+		return
+	}
+
+	repoConfig := a.repoConfig(repo)
+	i := repoConfig.environmentIndex(options.Environment)
+	if options.Environment != "" && i < 0 {
+		reply(fmt.Sprintf(":warning: %s has no environment `%s`.", repo, options.Environment))
+		return
+	}
+	if options.Environment == repoConfig.defaultEnvironment() {
+		options.Environment = ""
+	}
+
+	// With RBAC, commenters are matched as github:<login> and need what promoting to the environment needs;
+	// without it, only people with write access may deploy
+	if a.reposConfig != nil && a.reposConfig.RBAC != nil {
+		action := ActionDeploy
+		if i > 0 {
+			action = promotionAction(&repoConfig.Environments[i])
+		}
+		if !a.authorizeGate(ctx, []string{"github:" + login}, action, repo, options.Environment) {
+			target := repo
+			if options.Environment != "" {
+				target += " in " + options.Environment
+			}
+			reply(fmt.Sprintf(":no_entry: @%s may not %s %s.", login, action, target))
+			return
+		}
+	} else if !containsString(trustedCommenters, event.Comment.AuthorAssociation) {
+		logInfo("Ignoring %s comment by %s (%s) on %s#%d", DeployCommentCommand, login, event.Comment.AuthorAssociation, repo, number)
+		return
+	}
+
+	pr, err := a.github.pullRequest(ctx, repo, number)
+	if err != nil {
+		logError("Error loading %s#%d for %s comment: %v", repo, number, DeployCommentCommand, err)
+		reply(":x: Could not load the pull request to deploy it.")
+		return
+	}
+	// A fork's branch doesn't exist in the checkout, and its name is chosen by whoever opened the PR
+	if pr.Head.Repo == nil || !strings.EqualFold(pr.Head.Repo.FullName, repo) {
+		logWarn("Refusing %s comment by %s on %s#%d: the head branch is not in %s", DeployCommentCommand, login, repo, number, repo)
+		reply(fmt.Sprintf(":no_entry: Not deploying: #%d comes from a fork, and only branches of %s can be deployed.", number, repo))
+		return
+	}
+	metadata := &PRMetadata{Repository: repo, Branch: pr.Head.Ref, PRNumber: number, Author: pr.User.Login}
+
+	// Report in the PR's Slack thread too, when it was posted there
+	channel, ts := a.linkedMessage(ctx, repo, number)
+
+	d, err := a.startDeployment(ctx, metadata, options, channel, ts, login)
+	if err != nil {
+		logError("Error starting deployment from %s comment: %v", DeployCommentCommand, err)
+		if errors.Is(err, ErrDeploymentDeclined) {
+			reply(":construction: Not deploying: " + declinedReason(err))
+		} else {
+			reply(":x: Could not start the deployment: " + err.Error())
+		}
+		return
+	}
+
+	if err := a.redisClient.SAdd(ctx, commentTriggersKey, d.ID).Err(); err != nil {
+		logError("Error recording comment trigger for deployment %s: %v", d.ID, err)
+	}
+	reply(fmt.Sprintf(":gear: Deploying `%s` as `%s`.", metadata.Branch, d.ID))
+}
+
+// linkedMessage returns the Slack message the PR's earlier deployments reported to, if any
+func (a *App) linkedMessage(ctx context.Context, repo string, number int) (channel, ts string) {
+	deployments, err := a.deployments.List(ctx, repo, linkedMessageLookback)
+	if err != nil {
+		logError("Error looking up Slack message for %s#%d: %v", repo, number, err)
+		return "", ""
+	}
+	for _, d := range deployments {
+		if d.PRNumber == number && d.Channel != "" {
+			return d.Channel, d.Ts
+		}
+	}
+	return "", ""
+}
+
+// replyToComment reports a comment-triggered deployment's outcome on its PR
+func (a *App) replyToComment(ctx context.Context, d *Deployment) {
+	if a.github == nil || d.PRNumber == 0 {
+		return
+	}
+	// Only the instance that removes the marker replies
+	removed, err := a.redisClient.SRem(ctx, commentTriggersKey, d.ID).Result()
+	if err != nil || removed == 0 {
+		return
+	}
+
+	title := fmt.Sprintf(":rocket: Deployed `%s`", d.Branch)
+	switch d.Status {
+	case StatusFailed:
+		title = fmt.Sprintf(":x: Deployment of `%s` failed", d.Branch)
+	case StatusCancelled:
+		title = fmt.Sprintf(":no_entry_sign: Deployment of `%s` was cancelled by %s", d.Branch, d.CancelledBy)
+	}
+	if err := a.github.postIssueComment(ctx, d.Repository, d.PRNumber, title+"\n\n"+a.checkRunSummary(ctx, d)); err != nil {
+		logError("Error reporting deployment %s on %s#%d: %v", d.ID, d.Repository, d.PRNumber, err)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+// TestParseDeployComment checks the environment and clean arguments of /deploy comments
+func TestParseDeployComment(t *testing.T) {
+	for _, tc := range []struct {
+		body        string
+		environment string
+		clean       bool
+		ok          bool
+		invalid     bool
+	}{
+		{body: "/deploy", ok: true},
+		{body: "/deploy clean", clean: true, ok: true},
+		{body: "/deploy staging", environment: "staging", ok: true},
+		{body: "/deploy staging clean", environment: "staging", clean: true, ok: true},
+		{body: "/deploy staging\nwith a note", environment: "staging", ok: true},
+		{body: "/deploy staging prod", ok: true, invalid: true},
+		{body: "/deploy clean staging", ok: true, invalid: true},
+		{body: "please /deploy staging"},
+	} {
+		options, ok, err := parseDeployComment(tc.body)
+		if ok != tc.ok || (err != nil) != tc.invalid {
+			t.Errorf("parseDeployComment(%q) = ok %v, error %v; want ok %v, invalid %v", tc.body, ok, err, tc.ok, tc.invalid)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if options.Environment != tc.environment || options.CleanBuild != tc.clean {
+			t.Errorf("parseDeployComment(%q) = environment %q, clean %v; want %q, %v", tc.body, options.Environment, options.CleanBuild, tc.environment, tc.clean)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DeploymentComparison describes what changed between two recorded deployments of a repository
+type DeploymentComparison struct {
+	Repository    string              `json:"repository"`
+	From          *Deployment         `json:"from"`
+	To            *Deployment         `json:"to"`
+	Commits       CommitRange         `json:"commits"`
+	BranchChanged bool                `json:"branch_changed"`
+	Duration      DurationComparison  `json:"duration"`
+	ConfigChanges []ServiceDifference `json:"config_changes"`
+	ImageChanges  []ServiceDifference `json:"image_changes"`
+}
+
+// CommitRange is the span of commits between two deployments
+type CommitRange struct {
+	From       string `json:"from,omitempty"`
+	To         string `json:"to,omitempty"`
+	Changed    bool   `json:"changed"`
+	CompareURL string `json:"compare_url,omitempty"`
+}
+
+// DurationComparison reports how long each deployment took, in seconds
+type DurationComparison struct {
+	FromSeconds  *float64 `json:"from_seconds,omitempty"`
+	ToSeconds    *float64 `json:"to_seconds,omitempty"`
+	DeltaSeconds *float64 `json:"delta_seconds,omitempty"`
+}
+
+// ServiceDifference is a per-service (or per-container) value that differs between deployments
+type ServiceDifference struct {
+	Name string `json:"name"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// compareDeployments builds the comparison between two deployments of the same repository
+func compareDeployments(from, to *Deployment) (*DeploymentComparison, error) {
+	if from.Repository != to.Repository {
+		return nil, fmt.Errorf("deployments belong to different repositories (%s, %s)", from.Repository, to.Repository)
+	}
+
+	comparison := &DeploymentComparison{
+		Repository:    from.Repository,
+		From:          from,
+		To:            to,
+		BranchChanged: from.Branch != to.Branch,
+		Commits: CommitRange{
+			From:    from.Build.GitSHA,
+			To:      to.Build.GitSHA,
+			Changed: from.Build.GitSHA != to.Build.GitSHA,
+		},
+		ConfigChanges: diffStringMaps(from.Build.ConfigHashes, to.Build.ConfigHashes),
+		ImageChanges:  diffStringMaps(imageIDsByContainer(from.Build.Images), imageIDsByContainer(to.Build.Images)),
+	}
+
+	if comparison.Commits.Changed && from.Build.GitSHA != "" && to.Build.GitSHA != "" {
+		comparison.Commits.CompareURL = fmt.Sprintf("https://github.com/%s/compare/%s...%s", from.Repository, from.Build.GitSHA, to.Build.GitSHA)
+	}
+
+	fromDuration := deploymentDuration(from)
+	toDuration := deploymentDuration(to)
+	comparison.Duration.FromSeconds = fromDuration
+	comparison.Duration.ToSeconds = toDuration
+	if fromDuration != nil && toDuration != nil {
+		delta := *toDuration - *fromDuration
+		comparison.Duration.DeltaSeconds = &delta
+	}
+
+	return comparison, nil
+}
+
+// deploymentDuration returns how long a finished deployment took, or nil if it hasn't finished
+func deploymentDuration(d *Deployment) *float64 {
+	if d.FinishedAt == nil {
+		return nil
+	}
+	seconds := d.FinishedAt.Sub(d.StartedAt).Round(time.Second).Seconds()
+	return &seconds
+}
+
+func imageIDsByContainer(images []ImageInfo) map[string]string {
+	ids := make(map[string]string, len(images))
+	for _, image := range images {
+		ids[image.Container] = image.ID
+	}
+	return ids
+}
+
+// diffStringMaps lists keys whose values were added, removed or changed, sorted by key
+func diffStringMaps(from, to map[string]string) []ServiceDifference {
+	keys := make(map[string]bool)
+	for k := range from {
+		keys[k] = true
+	}
+	for k := range to {
+		keys[k] = true
+	}
+
+	diffs := make([]ServiceDifference, 0)
+	for k := range keys {
+		if from[k] != to[k] {
+			diffs = append(diffs, ServiceDifference{Name: k, From: from[k], To: to[k]})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Name < diffs[j].Name
+	})
+	return diffs
+}
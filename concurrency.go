@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	inFlightKey = "vibedeploy:inflight"
+	pendingKey  = "vibedeploy:pending"
+)
+
+// acquireSlotScript atomically drops expired slots and claims a new one if the cap allows. With ARGV[5] set, a
+// deployment without a slot waits behind those already pending, so new triggers don't jump the queue.
+// KEYS[1] = in-flight sorted set, KEYS[2] = pending list, ARGV = now (ms), expiry cutoff (ms), cap, deployment ID, queue
+var acquireSlotScript = redis.NewScript(`
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", ARGV[2])
+if redis.call("ZSCORE", KEYS[1], ARGV[4]) then
+	return 1
+end
+if ARGV[5] == "1" and redis.call("LLEN", KEYS[2]) > 0 then
+	return 0
+end
+if redis.call("ZCARD", KEYS[1]) < tonumber(ARGV[3]) then
+	redis.call("ZADD", KEYS[1], ARGV[1], ARGV[4])
+	return 1
+end
+return 0
+`)
+
+// ConcurrencyLimiter caps the number of deployments in flight across all worker queues.
+// Slots are held in Redis so the cap is shared by every VibeDeploy instance.
+type ConcurrencyLimiter struct {
+	redisClient *redis.Client
+	max         int
+	slotTTL     time.Duration
+}
+
+// TryAcquire claims a slot for the deployment, returning false when the cap is reached, or when behindPending is
+// set and other deployments are already waiting for one. A deployment that holds a slot keeps it either way.
+func (l *ConcurrencyLimiter) TryAcquire(ctx context.Context, deploymentID string, behindPending bool) (bool, error) {
+	now := time.Now()
+	cutoff := now.Add(-l.slotTTL)
+	queue := "0"
+	if behindPending {
+		queue = "1"
+	}
+	acquired, err := acquireSlotScript.Run(ctx, l.redisClient, []string{inFlightKey, pendingKey},
+		now.UnixMilli(), cutoff.UnixMilli(), l.max, deploymentID, queue).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire deployment slot: %w", err)
+	}
+	return acquired == 1, nil
+}
+
+// Release frees the slot held by a deployment
+func (l *ConcurrencyLimiter) Release(ctx context.Context, deploymentID string) error {
+	if err := l.redisClient.ZRem(ctx, inFlightKey, deploymentID).Err(); err != nil {
+		return fmt.Errorf("failed to release deployment slot: %w", err)
+	}
+	return nil
+}
+
+// dispatch hands a command to the executor, or parks it until a slot is free when the cap is reached
+func (a *App) dispatch(ctx context.Context, cmd PoppitCommand) error {
+	if a.limiter == nil || cmd.Metadata == nil || cmd.Metadata.DeploymentID == "" {
+		return a.execute(ctx, cmd)
+	}
+
+	// Deployments already waiting get the free slots first
+	a.drainPending(ctx)
+
+	acquired, err := a.limiter.TryAcquire(ctx, cmd.Metadata.DeploymentID, true)
+	if err != nil {
+		return err
+	}
+
+	if !acquired {
+		payload, err := json.Marshal(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to marshal pending command: %w", err)
+		}
+		if payload, err = a.cipher.seal(payload); err != nil {
+			return fmt.Errorf("failed to encrypt pending command: %w", err)
+		}
+		if err := a.redisClient.RPush(ctx, pendingKey, payload).Err(); err != nil {
+			return fmt.Errorf("failed to queue pending command: %w", err)
+		}
+		logInfo("Concurrency cap of %d reached, deployment %s waiting for a free slot", a.limiter.max, cmd.Metadata.DeploymentID)
+		return nil
+	}
+
+	if err := a.execute(ctx, cmd); err != nil {
+		if releaseErr := a.limiter.Release(ctx, cmd.Metadata.DeploymentID); releaseErr != nil {
+			logError("Error releasing slot for deployment %s: %v", cmd.Metadata.DeploymentID, releaseErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// execute hands a command to its host's executor and starts the output watchdog for its first step. A command
+// pushed to a Poppit queue may wait there for a worker, so its step's clock only starts once it is picked up.
+func (a *App) execute(ctx context.Context, cmd PoppitCommand) error {
+	executor, err := a.executorFor(cmd)
+	if err != nil {
+		return err
+	}
+	if err := executor.Execute(ctx, cmd); err != nil {
+		return err
+	}
+	if cmd.Metadata != nil && cmd.Metadata.DeploymentID != "" {
+		if _, queued := executor.(*PoppitExecutor); queued {
+			a.armPickupWatchdog(ctx, cmd.Metadata.DeploymentID)
+		} else {
+			a.armWatchdog(ctx, cmd.Metadata.DeploymentID, "")
+		}
+	}
+	return nil
+}
+
+// releaseSlot frees a finished deployment's slot and dispatches waiting deployments into the free capacity
+func (a *App) releaseSlot(ctx context.Context, deploymentID string) {
+	if a.limiter == nil {
+		return
+	}
+
+	if err := a.limiter.Release(ctx, deploymentID); err != nil {
+		logError("Error releasing slot for deployment %s: %v", deploymentID, err)
+		return
+	}
+
+	a.drainPending(ctx)
+}
+
+// drainPending dispatches waiting deployments into free capacity, unless none are waiting or deployments are
+// halted, when they stay queued until someone resumes
+func (a *App) drainPending(ctx context.Context) {
+	waiting, err := a.redisClient.LLen(ctx, pendingKey).Result()
+	if err != nil {
+		logError("Error reading pending deployments: %v", err)
+		return
+	}
+	if waiting == 0 {
+		return
+	}
+	if a.halted(ctx) {
+		logInfo("Deployments are halted, not dispatching pending deployments")
+		return
+	}
+	a.dispatchPending(ctx)
+}
+
+// runPendingDrains periodically drains the pending queue, for slots that were reclaimed after DEPLOYMENT_SLOT_TTL
+// rather than released by a finished deployment
+func (a *App) runPendingDrains(ctx context.Context) {
+	ticker := time.NewTicker(a.config.PendingDrainInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logInfo("Pending drain context cancelled, exiting")
+			return
+		case <-ticker.C:
+			a.drainPending(ctx)
+		}
+	}
+}
+
+// dispatchPending dispatches waiting deployments until the queue is empty or the cap is reached
+func (a *App) dispatchPending(ctx context.Context) {
+	for {
+		payload, err := a.redisClient.LPop(ctx, pendingKey).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return
+		}
+		if err != nil {
+			logError("Error reading pending deployments: %v", err)
+			return
+		}
+
+		plaintext, err := a.cipher.open(payload)
+		if err != nil {
+			logError("Dropping undecryptable pending command: %v", err)
+			continue
+		}
+
+		var cmd PoppitCommand
+		if err := json.Unmarshal(plaintext, &cmd); err != nil || cmd.Metadata == nil {
+			logError("Dropping malformed pending command: %v", err)
+			continue
+		}
+
+		acquired, err := a.limiter.TryAcquire(ctx, cmd.Metadata.DeploymentID, false)
+		if err != nil || !acquired {
+			// Put it back at the head of the queue for the next free slot
+			if pushErr := a.redisClient.LPush(ctx, pendingKey, payload).Err(); pushErr != nil {
+				logError("Error re-queueing pending deployment %s: %v", cmd.Metadata.DeploymentID, pushErr)
+			}
+			if err != nil {
+				logError("Error acquiring slot for pending deployment %s: %v", cmd.Metadata.DeploymentID, err)
+			}
+			return
+		}
+
+		if err := a.execute(ctx, cmd); err != nil {
+			logError("Error dispatching pending deployment %s: %v", cmd.Metadata.DeploymentID, err)
+			a.finishDeployment(ctx, cmd.Metadata.DeploymentID, StatusFailed)
+			continue
+		}
+
+		logInfo("Dispatched pending deployment %s for %s branch %s", cmd.Metadata.DeploymentID, cmd.Repo, cmd.Branch)
+	}
+}
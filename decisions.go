@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// decisionsKey is a Redis list of the most recent reaction decisions, newest first, shared by all instances
+const decisionsKey = "vibedeploy:decisions"
+
+// Decision outcomes
+const (
+	DecisionIgnored    = "ignored"
+	DecisionHandled    = "handled"
+	DecisionNotStarted = "not_started"
+)
+
+// DecisionCheck is one check a reaction event went through
+type DecisionCheck struct {
+	Check  string `json:"check"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Decision records why a reaction event did, or didn't, start anything
+type Decision struct {
+	EventID    string          `json:"event_id,omitempty"`
+	Reaction   string          `json:"reaction"`
+	User       string          `json:"user"`
+	Channel    string          `json:"channel"`
+	Ts         string          `json:"ts"`
+	Repository string          `json:"repository,omitempty"`
+	Workflow   string          `json:"workflow,omitempty"`
+	Instance   string          `json:"instance,omitempty"`
+	ReceivedAt time.Time       `json:"received_at"`
+	Outcome    string          `json:"outcome"`
+	Checks     []DecisionCheck `json:"checks"`
+}
+
+// newDecision starts the trace of a reaction event; it's handled unless a check says otherwise
+func newDecision(event ReactionEvent) *Decision {
+	host, _ := os.Hostname()
+	return &Decision{
+		EventID:    event.EventID,
+		Reaction:   event.Event.Reaction,
+		User:       event.Event.User,
+		Channel:    event.Event.Item.Channel,
+		Ts:         event.Event.Item.Ts,
+		Instance:   host,
+		ReceivedAt: time.Now().UTC(),
+		Outcome:    DecisionHandled,
+	}
+}
+
+// pass records a check the event passed
+func (d *Decision) pass(check, format string, v ...interface{}) {
+	d.Checks = append(d.Checks, DecisionCheck{Check: check, Passed: true, Detail: fmt.Sprintf(format, v...)})
+}
+
+// fail records the check that stopped the event, and the outcome it had
+func (d *Decision) fail(outcome, check, format string, v ...interface{}) {
+	d.Checks = append(d.Checks, DecisionCheck{Check: check, Detail: fmt.Sprintf(format, v...)})
+	d.Outcome = outcome
+}
+
+// recordDecision keeps the decision in the ring buffer of the last DECISION_TRACE_SIZE
+func (a *App) recordDecision(ctx context.Context, d *Decision) {
+	if a.config.DecisionTraceSize <= 0 {
+		return
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		logError("Error encoding decision for message %s: %v", d.Ts, err)
+		return
+	}
+	pipe := a.redisClient.TxPipeline()
+	pipe.LPush(ctx, decisionsKey, data)
+	pipe.LTrim(ctx, decisionsKey, 0, int64(a.config.DecisionTraceSize-1))
+	if _, err := pipe.Exec(ctx); err != nil {
+		logError("Error recording decision for message %s: %v", d.Ts, err)
+	}
+}
+
+// decisions returns the recorded decisions on a message, newest first, or all of them when channel and ts are empty
+func (a *App) decisions(ctx context.Context, channel, ts string) ([]Decision, error) {
+	values, err := a.redisClient.LRange(ctx, decisionsKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	decisions := make([]Decision, 0)
+	for _, value := range values {
+		var d Decision
+		if err := json.Unmarshal([]byte(value), &d); err != nil {
+			logWarn("Skipping unreadable decision: %v", err)
+			continue
+		}
+		if ts != "" && (d.Ts != ts || (channel != "" && d.Channel != channel)) {
+			continue
+		}
+		decisions = append(decisions, d)
+	}
+	return decisions, nil
+}
+
+// handleListDecisions serves the recorded decisions, on one message given by ?link= or ?channel= and ?ts=, or
+// all of them
+func (a *App) handleListDecisions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	channel, ts := query.Get("channel"), query.Get("ts")
+	if link := query.Get("link"); link != "" {
+		var err error
+		if channel, ts, err = parseMessageLink(link); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	decisions, err := a.decisions(r.Context(), channel, ts)
+	if err != nil {
+		logError("Error loading decisions: %v", err)
+		http.Error(w, "failed to load decisions", http.StatusInternalServerError)
+		return
+	}
+
+	// Dashboard users and API keys only see decisions on repositories they may view
+	visible := decisions
+	if principal, _ := r.Context().Value(principalKey{}).(*Principal); principal != nil {
+		visible = make([]Decision, 0, len(decisions))
+		for _, d := range decisions {
+			if d.Repository == "" || a.permits(principal, ActionView, d.Repository) {
+				visible = append(visible, d)
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, visible)
+}
+
+// whyCommand explains what became of the reactions on a message
+func (a *App) whyCommand(ctx context.Context, command slack.SlashCommand, args []string) *slack.WebhookMessage {
+	if len(args) != 1 {
+		return ephemeralReply("Usage: `why <message link>`")
+	}
+	if a.config.DecisionTraceSize <= 0 {
+		return ephemeralReply("Decision tracing is disabled; set `DECISION_TRACE_SIZE` to enable it.")
+	}
+	channel, ts, err := parseMessageLink(args[0])
+	if err != nil {
+		return ephemeralReply(fmt.Sprintf(":warning: %v. Use *Copy link* on the message.", err))
+	}
+	decisions, err := a.decisions(ctx, channel, ts)
+	if err != nil {
+		logError("Error loading decisions: %v", err)
+		return ephemeralReply(":warning: Could not load the decisions, please try again.")
+	}
+	if len(decisions) == 0 {
+		return ephemeralReply(fmt.Sprintf("No reactions on that message among the last %d. If one was added, its event never reached VibeDeploy; check the Slack relay.", a.config.DecisionTraceSize))
+	}
+
+	identities := a.slackIdentities(ctx, command.UserID)
+	var b strings.Builder
+	for _, d := range decisions {
+		if d.Repository != "" && !a.authorize(identities, ActionView, d.Repository, "") {
+			continue
+		}
+		fmt.Fprintf(&b, ":%s: by <@%s> at %s: *%s*\n", d.Reaction, d.User, d.ReceivedAt.Format(time.RFC3339), strings.ReplaceAll(d.Outcome, "_", " "))
+		for _, c := range d.Checks {
+			mark := ":white_check_mark:"
+			if !c.Passed {
+				mark = ":x:"
+			}
+			fmt.Fprintf(&b, "    %s %s", mark, c.Check)
+			if c.Detail != "" {
+				b.WriteString(": " + c.Detail)
+			}
+			b.WriteString("\n")
+		}
+	}
+	if b.Len() == 0 {
+		return ephemeralReply(":lock: You may not view the repository of that message.")
+	}
+	return ephemeralReply(strings.TrimRight(b.String(), "\n"))
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// delegationsKey is a Redis hash of delegation IDs to approval delegations as JSON
+const delegationsKey = "vibedeploy:delegations"
+
+// delegationDateLayout is how the delegate command takes the days of a window
+const delegationDateLayout = "2006-01-02"
+
+// Delegation lends an approver's approve permission to another user for a time window, e.g. while they are on holiday
+type Delegation struct {
+	ID string `json:"id"`
+	// From is the Slack user ID of the approver, and FromIdentities what their RBAC bindings are matched on
+	From           string   `json:"from"`
+	FromIdentities []string `json:"from_identities"`
+	// To is the Slack user ID of the delegate, and ToIdentities the identities that may use the delegation
+	To           string   `json:"to"`
+	ToIdentities []string `json:"to_identities"`
+	// Repos limits the delegation to some repositories (names or path.Match patterns); empty means all of From's
+	Repos     []string   `json:"repos,omitempty"`
+	Start     time.Time  `json:"start"`
+	End       time.Time  `json:"end"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedBy string     `json:"revoked_by,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// active reports whether the delegation's window contains t
+func (d *Delegation) active(t time.Time) bool {
+	return !t.Before(d.Start) && t.Before(d.End)
+}
+
+// heldBy reports whether any of the identities is the delegate
+func (d *Delegation) heldBy(identities []string) bool {
+	for _, identity := range identities {
+		for _, to := range d.ToIdentities {
+			if strings.EqualFold(identity, to) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func newDelegationID() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// delegations returns every delegation that hasn't ended, dropping the ones that have
+func (a *App) delegations(ctx context.Context) ([]*Delegation, error) {
+	raw, err := a.redisClient.HGetAll(ctx, delegationsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list delegations: %w", err)
+	}
+	now := time.Now()
+	var delegations []*Delegation
+	for id, data := range raw {
+		var delegation Delegation
+		if err := json.Unmarshal([]byte(data), &delegation); err != nil {
+			logError("Error parsing delegation %s: %v", id, err)
+			continue
+		}
+		if !now.Before(delegation.End) {
+			if err := a.redisClient.HDel(ctx, delegationsKey, id).Err(); err != nil {
+				logError("Error removing ended delegation %s: %v", id, err)
+			}
+			continue
+		}
+		delegations = append(delegations, &delegation)
+	}
+	sort.Slice(delegations, func(i, j int) bool { return delegations[i].Start.Before(delegations[j].Start) })
+	return delegations, nil
+}
+
+// delegatedApproval reports whether an active delegation to one of the identities lets them approve in the
+// repository's environment. The approver who delegated must still have the approve permission there.
+func (a *App) delegatedApproval(ctx context.Context, identities []string, repo, env string) bool {
+	if a.reposConfig == nil || a.reposConfig.RBAC == nil {
+		return false
+	}
+	delegations, err := a.delegations(ctx)
+	if err != nil {
+		logError("Error checking approval delegations: %v", err)
+		return false
+	}
+	now := time.Now()
+	for _, delegation := range delegations {
+		if !delegation.active(now) || !delegation.heldBy(identities) || !matchesAny(delegation.Repos, repo) {
+			continue
+		}
+		if a.reposConfig.RBAC.allows(delegation.FromIdentities, ActionApprove, repo, env) {
+			logInfo("Approval on %s in %s granted to %s by delegation %s from %s", repo, env, delegation.To, delegation.ID, delegation.From)
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeGate is authorize for the approval gate: approve is also granted through an active delegation
+func (a *App) authorizeGate(ctx context.Context, identities []string, action Action, repo, env string) bool {
+	if a.authorize(identities, action, repo, env) {
+		return true
+	}
+	return action == ActionApprove && a.delegatedApproval(ctx, identities, repo, env)
+}
+
+// approvesSomewhere reports whether the identities may approve in any environment of the repository,
+// or of any repository if repo is empty
+func (a *App) approvesSomewhere(identities []string, repo string) bool {
+	environments := []string{""}
+	for name, repoConfig := range a.reposConfig.Repos {
+		if repo != "" && !matchesAny([]string{repo}, name) {
+			continue
+		}
+		for _, env := range repoConfig.Environments {
+			environments = append(environments, env.Name)
+		}
+	}
+	for _, env := range environments {
+		if a.authorize(identities, ActionApprove, repo, env) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDelegationWindow reads `<end>` or `<start> <end>` from the start of args, returning the rest.
+// Days are YYYY-MM-DD in UTC, and include the whole end day; the end may also be a duration such as 72h.
+func parseDelegationWindow(args []string, now time.Time) (start, end time.Time, rest []string, err error) {
+	start = now
+	if len(args) >= 2 {
+		if day, err := time.Parse(delegationDateLayout, args[0]); err == nil {
+			if _, err := time.Parse(delegationDateLayout, args[1]); err == nil {
+				start, args = day, args[1:]
+			}
+		}
+	}
+	if len(args) == 0 {
+		return time.Time{}, time.Time{}, nil, fmt.Errorf("missing end of the delegation")
+	}
+	if day, err := time.Parse(delegationDateLayout, args[0]); err == nil {
+		end = day.AddDate(0, 0, 1)
+	} else if duration, err := time.ParseDuration(args[0]); err == nil && duration > 0 {
+		end = start.Add(duration)
+	} else {
+		return time.Time{}, time.Time{}, nil, fmt.Errorf("invalid end %q, expected YYYY-MM-DD or a duration such as 72h", args[0])
+	}
+	if !end.After(start) || !end.After(now) {
+		return time.Time{}, time.Time{}, nil, fmt.Errorf("the delegation would end before it starts")
+	}
+	return start, end, args[1:], nil
+}
+
+// delegateCommand handles `delegate`, `delegate <@user> [<start>] <end> [owner/repo ...]` and `delegate revoke <@user>`
+func (a *App) delegateCommand(ctx context.Context, command slack.SlashCommand, args []string) *slack.WebhookMessage {
+	const usage = "Usage: `delegate`, `delegate @user [YYYY-MM-DD] <YYYY-MM-DD|duration> [owner/repo ...]` or `delegate revoke @user`"
+	if len(args) == 0 {
+		return a.listDelegations(ctx, command.UserID)
+	}
+	if a.reposConfig == nil || a.reposConfig.RBAC == nil {
+		return ephemeralReply("There is no rbac section, so everyone may approve already.")
+	}
+	if args[0] == "revoke" {
+		if len(args) != 2 {
+			return ephemeralReply(usage)
+		}
+		return a.revokeDelegations(ctx, command.UserID, slackReference(args[1]))
+	}
+
+	to := slackReference(args[0])
+	if !isSlackID(to, 'U') && !isSlackID(to, 'W') {
+		return ephemeralReply(usage)
+	}
+	if to == command.UserID {
+		return ephemeralReply("You can't delegate approvals to yourself.")
+	}
+	start, end, repos, err := parseDelegationWindow(args[1:], time.Now().UTC())
+	if err != nil {
+		return ephemeralReply(fmt.Sprintf("%s. %s", err, usage))
+	}
+	// Patterns are kept as given; names are matched as the config spells them
+	for i, repo := range repos {
+		repos[i] = a.canonicalRepo(repo)
+	}
+
+	// Only approvals the approver has can be delegated
+	fromIdentities := a.slackIdentities(ctx, command.UserID)
+	scope := repos
+	if len(scope) == 0 {
+		scope = []string{""}
+	}
+	for _, repo := range scope {
+		if !a.approvesSomewhere(fromIdentities, repo) {
+			logInfo("User %s may not delegate approvals on %q", command.UserID, repo)
+			return ephemeralReply(":no_entry: You need the approve permission to delegate it.")
+		}
+	}
+
+	delegation := &Delegation{
+		ID:             newDelegationID(),
+		From:           command.UserID,
+		FromIdentities: fromIdentities,
+		To:             to,
+		ToIdentities:   a.slackIdentities(ctx, to),
+		Repos:          repos,
+		Start:          start,
+		End:            end,
+		CreatedAt:      time.Now().UTC(),
+	}
+	data, err := json.Marshal(delegation)
+	if err != nil {
+		logError("Error marshalling delegation: %v", err)
+		return ephemeralReply(":warning: Could not save the delegation, please try again.")
+	}
+	if err := a.redisClient.HSet(ctx, delegationsKey, delegation.ID, data).Err(); err != nil {
+		logError("Error saving delegation: %v", err)
+		return ephemeralReply(":warning: Could not save the delegation, please try again.")
+	}
+	a.recordDelegationEvent(ctx, EventApprovalDelegated, delegation)
+	logInfo("User %s delegated approvals on %v to %s from %s to %s", delegation.From, repos, to, start.Format(time.RFC3339), end.Format(time.RFC3339))
+	return channelReply(":handshake: " + describeDelegation(delegation))
+}
+
+// revokeDelegations ends every delegation the user gave to the delegate
+func (a *App) revokeDelegations(ctx context.Context, user, to string) *slack.WebhookMessage {
+	delegations, err := a.delegations(ctx)
+	if err != nil {
+		logError("Error loading delegations: %v", err)
+		return ephemeralReply(":warning: Could not read the delegations, please try again.")
+	}
+	revoked := 0
+	for _, delegation := range delegations {
+		if delegation.From != user || delegation.To != to {
+			continue
+		}
+		if err := a.redisClient.HDel(ctx, delegationsKey, delegation.ID).Err(); err != nil {
+			logError("Error revoking delegation %s: %v", delegation.ID, err)
+			return ephemeralReply(":warning: Could not revoke the delegation, please try again.")
+		}
+		now := time.Now().UTC()
+		delegation.RevokedBy, delegation.RevokedAt = user, &now
+		a.recordDelegationEvent(ctx, EventDelegationRevoked, delegation)
+		revoked++
+	}
+	if revoked == 0 {
+		return ephemeralReply(fmt.Sprintf("You haven't delegated approvals to %s.", formatMention(to)))
+	}
+	logInfo("User %s revoked %d delegations to %s", user, revoked, to)
+	return channelReply(fmt.Sprintf(":handshake: %s revoked their approval delegation to %s.", formatMention(user), formatMention(to)))
+}
+
+// listDelegations shows the delegations the user gave or holds
+func (a *App) listDelegations(ctx context.Context, user string) *slack.WebhookMessage {
+	delegations, err := a.delegations(ctx)
+	if err != nil {
+		logError("Error loading delegations: %v", err)
+		return ephemeralReply(":warning: Could not read the delegations, please try again.")
+	}
+	var lines []string
+	for _, delegation := range delegations {
+		if delegation.From == user || delegation.To == user {
+			lines = append(lines, "• "+describeDelegation(delegation))
+		}
+	}
+	if len(lines) == 0 {
+		return ephemeralReply("You have no approval delegations.")
+	}
+	return ephemeralReply(strings.Join(lines, "\n"))
+}
+
+func describeDelegation(d *Delegation) string {
+	scope := "everything they may approve"
+	if len(d.Repos) > 0 {
+		scope = strings.Join(d.Repos, ", ")
+	}
+	return fmt.Sprintf("%s delegated approvals on %s to %s from %s until %s.",
+		formatMention(d.From), scope, formatMention(d.To), d.Start.Format(time.RFC1123), d.End.Format(time.RFC1123))
+}
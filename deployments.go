@@ -0,0 +1,544 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Deployment statuses
+const (
+	StatusQueued    = "queued"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// isFinished reports whether a deployment has reached a status it won't leave
+func isFinished(status string) bool {
+	return status == StatusSucceeded || status == StatusFailed || status == StatusCancelled
+}
+
+// Build metadata capture steps appended to every pipeline
+const (
+	GitSHACommand     = "git rev-parse HEAD"
+	ConfigHashCommand = "docker compose config --hash '*'"
+	ImagesCommand     = "docker compose images --format json"
+	StatsCommand      = "docker compose stats --no-stream --format json"
+)
+
+// DigestsCommand prints "<service> <repository@digest>..." for each running container, so a promotion
+// can pin the exact images; it runs in repositories with a promotion chain
+const DigestsCommand = `docker compose ps --format '{{.Service}} {{.Image}}' | while read -r service image; do echo "$service $(docker image inspect --format '{{join .RepoDigests " "}}' "$image")"; done`
+
+const (
+	deploymentKeyPrefix = "vibedeploy:deployment:"
+	historyKeyPrefix    = "vibedeploy:history:"
+	repositoriesKey     = "vibedeploy:repositories"
+)
+
+// defaultHistoryLimit is the number of deployments returned when a query doesn't specify one
+const defaultHistoryLimit = 20
+
+// ErrDeploymentNotFound is returned when a deployment ID has no stored record
+var ErrDeploymentNotFound = errors.New("deployment not found")
+
+// Deployment is the recorded state of a single pipeline run
+type Deployment struct {
+	ID          string        `json:"id"`
+	Repository  string        `json:"repository"`
+	Branch      string        `json:"branch"`
+	PRNumber    int           `json:"pr_number,omitempty"`
+	Channel     string        `json:"channel"`
+	Ts          string        `json:"ts"`
+	TriggeredBy string        `json:"triggered_by,omitempty"`
+	Workflow    string        `json:"workflow,omitempty"`
+	Status      string        `json:"status"`
+	StartedAt   time.Time     `json:"started_at"`
+	FinishedAt  *time.Time    `json:"finished_at,omitempty"`
+	Build       BuildMetadata `json:"build"`
+
+	// Pipeline and Timeouts mirror the dispatched command so the watchdog can track progress
+	Pipeline        []string       `json:"pipeline,omitempty"`
+	Timeouts        map[string]int `json:"timeouts,omitempty"`
+	FailureReason   string         `json:"failure_reason,omitempty"`
+	FailureCategory string         `json:"failure_category,omitempty"`
+
+	// Resources is the containers' footprint sampled right after the deployment came up
+	Resources []ContainerResources `json:"resources,omitempty"`
+
+	// SBOMs summarise the bills of materials captured of the images, and Vulnerabilities is what the scan found
+	SBOMs           []SBOMInfo           `json:"sboms,omitempty"`
+	Vulnerabilities *VulnerabilityReport `json:"vulnerabilities,omitempty"`
+
+	PreviewURL string `json:"preview_url,omitempty"`
+	CheckRunID int64  `json:"check_run_id,omitempty"`
+
+	// Allocation is the port and hostname from the pool the deployment was given
+	Allocation *PoolAllocation `json:"allocation,omitempty"`
+
+	// IncidentID is the incident that was in progress when the deployment started
+	IncidentID string `json:"incident_id,omitempty"`
+
+	// Flags are the feature flag service flags the deployment checked, and turns on or off once it succeeds
+	Flags []FlagState `json:"flags,omitempty"`
+
+	// Retries counts re-queues after a transient failure, the last of which RetryReason explains
+	Retries     int    `json:"retries,omitempty"`
+	RetryReason string `json:"retry_reason,omitempty"`
+
+	// CoalescedReactors are the users whose rockets joined the deployment instead of starting their own
+	CoalescedReactors []string `json:"coalesced_reactors,omitempty"`
+
+	// CancelledBy is who cancelled the deployment before a worker picked it up
+	CancelledBy string `json:"cancelled_by,omitempty"`
+
+	// Environment is the promotion chain stage deployed to, and PromotedFrom the deployment whose commit was promoted
+	Environment  string `json:"environment,omitempty"`
+	PromotedFrom string `json:"promoted_from,omitempty"`
+	// RolledBackFrom is the deployment a rollback replaced with the commit deployed before it
+	RolledBackFrom string `json:"rolled_back_from,omitempty"`
+	// Completion is the command whose output completes the deployment, for repositories with their own steps
+	Completion string `json:"completion,omitempty"`
+	// Host is the entry of the hosts config the deployment ran on, or "" for the default executor
+	Host string `json:"host,omitempty"`
+	// Workspace is the deployment's own checkout, in repositories with ephemeral workspaces
+	Workspace string `json:"workspace,omitempty"`
+	// MigratedFrom is the host a migration moved the environment off, and tore down once Host was serving
+	MigratedFrom string `json:"migrated_from,omitempty"`
+}
+
+// BuildMetadata identifies exactly which artifacts a deployment is running
+type BuildMetadata struct {
+	GitSHA       string            `json:"git_sha,omitempty"`
+	ConfigHashes map[string]string `json:"config_hashes,omitempty"`
+	Images       []ImageInfo       `json:"images,omitempty"`
+	// Digests maps compose services to the registry digest of the image they ran, for services whose image has one
+	Digests map[string]string `json:"digests,omitempty"`
+	// Tags point at the commit, and Lockfiles maps dependency lockfiles to their SHA-256, in repositories with provenance settings
+	Tags      []string          `json:"tags,omitempty"`
+	Lockfiles map[string]string `json:"lockfiles,omitempty"`
+}
+
+// ImageInfo describes the image behind one compose container
+type ImageInfo struct {
+	Container  string `json:"container"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag"`
+	ID         string `json:"id"`
+}
+
+// Storage backends for deployment history
+const (
+	RedisStoreBackend    = "redis"
+	PostgresStoreBackend = "postgres"
+	SQLiteStoreBackend   = "sqlite"
+)
+
+// DeploymentStore persists deployment records and per-repo history
+type DeploymentStore interface {
+	Save(ctx context.Context, d *Deployment) error
+	Get(ctx context.Context, id string) (*Deployment, error)
+	// List returns up to limit deployments for a repository, newest first; limit <= 0 returns all
+	List(ctx context.Context, repo string, limit int) ([]*Deployment, error)
+	// Repositories returns every repository with recorded history
+	Repositories(ctx context.Context) ([]string, error)
+	// Prune deletes a repository's finished deployments started before cutoff (if non-zero)
+	// and any beyond the newest keep (if keep > 0), returning how many were removed
+	Prune(ctx context.Context, repo string, cutoff time.Time, keep int) (int, error)
+}
+
+// EventRecorder is implemented by stores that keep their own copy of the lifecycle event log
+type EventRecorder interface {
+	RecordEvent(ctx context.Context, event *LifecycleEvent) error
+}
+
+// newDeploymentStore builds the store selected by the STORE_BACKEND setting
+func newDeploymentStore(config Config, redisClient *redis.Client) (DeploymentStore, error) {
+	switch config.StoreBackend {
+	case RedisStoreBackend:
+		return &RedisDeploymentStore{redisClient: redisClient}, nil
+	case PostgresStoreBackend, SQLiteStoreBackend:
+		return openSQLStore(config.StoreBackend, config.StoreDSN)
+	default:
+		return nil, fmt.Errorf("unknown store backend %q (expected %s, %s or %s)", config.StoreBackend, RedisStoreBackend, PostgresStoreBackend, SQLiteStoreBackend)
+	}
+}
+
+// RedisDeploymentStore keeps deployment records as JSON strings with a sorted set per repository
+type RedisDeploymentStore struct {
+	redisClient *redis.Client
+}
+
+func newDeploymentID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102T150405"), hex.EncodeToString(b))
+}
+
+// Save writes a deployment record and indexes it in the repository's history
+func (s *RedisDeploymentStore) Save(ctx context.Context, d *Deployment) error {
+	payload, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("failed to marshal deployment: %w", err)
+	}
+
+	pipe := s.redisClient.TxPipeline()
+	pipe.Set(ctx, deploymentKeyPrefix+d.ID, payload, 0)
+	pipe.ZAdd(ctx, historyKeyPrefix+d.Repository, redis.Z{
+		Score:  float64(d.StartedAt.UnixMilli()),
+		Member: d.ID,
+	})
+	pipe.SAdd(ctx, repositoriesKey, d.Repository)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to store deployment: %w", err)
+	}
+
+	return nil
+}
+
+// Get loads a single deployment record by ID
+func (s *RedisDeploymentStore) Get(ctx context.Context, id string) (*Deployment, error) {
+	payload, err := s.redisClient.Get(ctx, deploymentKeyPrefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrDeploymentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load deployment: %w", err)
+	}
+
+	var d Deployment
+	if err := json.Unmarshal(payload, &d); err != nil {
+		return nil, fmt.Errorf("failed to parse deployment: %w", err)
+	}
+
+	return &d, nil
+}
+
+func (s *RedisDeploymentStore) List(ctx context.Context, repo string, limit int) ([]*Deployment, error) {
+	stop := int64(limit - 1)
+	if limit <= 0 {
+		stop = -1
+	}
+	ids, err := s.redisClient.ZRevRange(ctx, historyKeyPrefix+repo, 0, stop).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	deployments := make([]*Deployment, 0, len(ids))
+	for _, id := range ids {
+		d, err := s.Get(ctx, id)
+		if errors.Is(err, ErrDeploymentNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		deployments = append(deployments, d)
+	}
+
+	return deployments, nil
+}
+
+func (s *RedisDeploymentStore) Repositories(ctx context.Context) ([]string, error) {
+	repos, err := s.redisClient.SMembers(ctx, repositoriesKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repositories: %w", err)
+	}
+	return repos, nil
+}
+
+func (s *RedisDeploymentStore) Prune(ctx context.Context, repo string, cutoff time.Time, keep int) (int, error) {
+	key := historyKeyPrefix + repo
+	expired := make(map[string]bool)
+
+	if !cutoff.IsZero() {
+		ids, err := s.redisClient.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+			Min: "-inf",
+			Max: "(" + strconv.FormatInt(cutoff.UnixMilli(), 10),
+		}).Result()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read expired deployments: %w", err)
+		}
+		for _, id := range ids {
+			expired[id] = true
+		}
+	}
+
+	if keep > 0 {
+		ids, err := s.redisClient.ZRevRange(ctx, key, int64(keep), -1).Result()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read excess deployments: %w", err)
+		}
+		for _, id := range ids {
+			expired[id] = true
+		}
+	}
+
+	// Unfinished deployments are still referenced by the pending queue and their slots
+	for id := range expired {
+		d, err := s.Get(ctx, id)
+		if errors.Is(err, ErrDeploymentNotFound) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if !isFinished(d.Status) {
+			delete(expired, id)
+		}
+	}
+
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	pipe := s.redisClient.TxPipeline()
+	for id := range expired {
+		pipe.Del(ctx, deploymentKeyPrefix+id)
+		pipe.ZRem(ctx, key, id)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to prune deployments: %w", err)
+	}
+
+	return len(expired), nil
+}
+
+// updateDeployment applies fn to a stored deployment and saves the result
+func updateDeployment(ctx context.Context, store DeploymentStore, id string, fn func(d *Deployment)) (*Deployment, error) {
+	d, err := store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	fn(d)
+	if err := store.Save(ctx, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// isBuildMetadataCommand reports whether a command is one of the metadata capture steps
+func isBuildMetadataCommand(command string) bool {
+	switch command {
+	case GitSHACommand, ConfigHashCommand, ImagesCommand, DigestsCommand, TagsCommand:
+		return true
+	default:
+		return isLockfileCommand(command)
+	}
+}
+
+// applyBuildMetadata parses the output of a capture step into the build metadata
+func applyBuildMetadata(build *BuildMetadata, command, output string) error {
+	switch command {
+	case GitSHACommand:
+		build.GitSHA = strings.TrimSpace(output)
+	case ConfigHashCommand:
+		hashes, err := parseConfigHashes(output)
+		if err != nil {
+			return err
+		}
+		build.ConfigHashes = hashes
+	case ImagesCommand:
+		images, err := parseComposeImages(output)
+		if err != nil {
+			return err
+		}
+		build.Images = images
+	case DigestsCommand:
+		build.Digests = parseImageDigests(output)
+	case TagsCommand:
+		build.Tags = parseTags(output)
+	default:
+		if isLockfileCommand(command) {
+			hashes, err := parseLockfileHashes(output)
+			if err != nil {
+				return err
+			}
+			build.Lockfiles = hashes
+		}
+	}
+	return nil
+}
+
+// parseImageDigests parses DigestsCommand output, keeping the first digest of each service.
+// Images that were built locally and never pushed have no digest and are left out.
+func parseImageDigests(output string) map[string]string {
+	digests := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.Contains(fields[1], "@sha256:") {
+			continue
+		}
+		if _, ok := digests[fields[0]]; !ok {
+			digests[fields[0]] = fields[1]
+		}
+	}
+	if len(digests) == 0 {
+		return nil
+	}
+	return digests
+}
+
+// parseConfigHashes parses `docker compose config --hash` output ("<service> <hash>" per line)
+func parseConfigHashes(output string) (map[string]string, error) {
+	hashes := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("unexpected config hash line: %q", line)
+		}
+		hashes[fields[0]] = fields[1]
+	}
+	return hashes, nil
+}
+
+// parseComposeImages parses `docker compose images --format json` output
+func parseComposeImages(output string) ([]ImageInfo, error) {
+	var raw []struct {
+		ContainerName string `json:"ContainerName"`
+		Repository    string `json:"Repository"`
+		Tag           string `json:"Tag"`
+		ID            string `json:"ID"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(output)), &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse compose images: %w", err)
+	}
+
+	images := make([]ImageInfo, 0, len(raw))
+	for _, r := range raw {
+		images = append(images, ImageInfo{
+			Container:  r.ContainerName,
+			Repository: r.Repository,
+			Tag:        r.Tag,
+			ID:         r.ID,
+		})
+	}
+	return images, nil
+}
+
+// recordBuildMetadata stores the output of a capture step against its deployment
+func (a *App) recordBuildMetadata(ctx context.Context, output CommandOutput) {
+	if output.Metadata.DeploymentID == "" {
+		logDebug("Command output for %s has no deployment ID, not recording build metadata", output.Command)
+		return
+	}
+
+	var parseErr error
+	d, err := updateDeployment(ctx, a.deployments, output.Metadata.DeploymentID, func(d *Deployment) {
+		parseErr = applyBuildMetadata(&d.Build, output.Command, output.Output)
+	})
+	if err != nil {
+		logError("Error recording build metadata for deployment %s: %v", output.Metadata.DeploymentID, err)
+		return
+	}
+	if parseErr != nil {
+		logWarn("Could not parse output of %q for deployment %s: %v", output.Command, output.Metadata.DeploymentID, parseErr)
+		return
+	}
+
+	a.recordEvent(ctx, EventBuildMetadata, d)
+	if output.Command == GitSHACommand {
+		a.startCheckRun(ctx, d)
+	}
+	logDebug("Recorded output of %q for deployment %s", output.Command, output.Metadata.DeploymentID)
+}
+
+// finishDeployment marks a deployment as complete with the given status
+func (a *App) finishDeployment(ctx context.Context, id, status string) {
+	d, err := updateDeployment(ctx, a.deployments, id, func(d *Deployment) {
+		now := time.Now().UTC()
+		d.Status = status
+		d.FinishedAt = &now
+	})
+	if err != nil {
+		logError("Error marking deployment %s as %s: %v", id, status, err)
+	} else {
+		logInfo("Deployment %s marked as %s", id, status)
+		if status == StatusSucceeded && workflowOf(d) == WorkflowDeploy {
+			d = a.toggleFlags(ctx, d)
+		}
+		eventType := EventDeploymentSucceeded
+		switch status {
+		case StatusFailed:
+			eventType = EventDeploymentFailed
+		case StatusCancelled:
+			eventType = EventDeploymentCancelled
+		}
+		a.recordEvent(ctx, eventType, d)
+		a.confirmStatus(ctx, d)
+		a.notifyRepoChannel(ctx, d)
+		a.notifyIncidentChannel(ctx, d)
+		a.completeCheckRun(ctx, d)
+		a.replyToComment(ctx, d)
+		a.updateStatusPage(ctx, d)
+		a.notifyCatalog(ctx, eventType, d)
+		if status == StatusSucceeded {
+			a.postLog(ctx, d)
+		}
+		if status == StatusSucceeded && workflowOf(d) == WorkflowDeploy {
+			a.publishRoute(ctx, d)
+			a.registerEnvironment(ctx, d)
+			a.recordDeployedRef(ctx, d)
+			a.announceDeployment(ctx, d)
+			a.postProvenance(ctx, d)
+			a.annotateDeployment(ctx, d)
+			a.offerPromotion(ctx, d)
+		}
+	}
+
+	if d != nil {
+		a.closeWorkspaces(ctx, d)
+	}
+	a.disarmWatchdog(ctx, id)
+	a.clearRetry(ctx, id)
+	a.clearFailureSignature(ctx, id)
+	a.clearLog(ctx, id)
+	a.untrackActive(ctx, id)
+	a.releaseSlot(ctx, id)
+}
+
+// failDeployment records a failed deployment and swaps the gear reaction for the failure reaction
+func (a *App) failDeployment(ctx context.Context, id, reason string) {
+	// A transient failure gets one more run before anyone is told
+	if a.retryDeployment(ctx, id, reason) {
+		return
+	}
+
+	category := classifyFailure(reason, a.failureSignature(ctx, id))
+	failureCounts.inc(category)
+	d, err := updateDeployment(ctx, a.deployments, id, func(d *Deployment) {
+		d.FailureReason = reason
+		d.FailureCategory = category
+	})
+	if err != nil {
+		logError("Error recording failure reason for deployment %s: %v", id, err)
+	}
+	a.finishDeployment(ctx, id, StatusFailed)
+
+	if d == nil {
+		return
+	}
+
+	if err := a.publishSlackReaction(ctx, d.Channel, d.Ts, GearReaction, true); err != nil {
+		logError("Error removing gear reaction: %v", err)
+	}
+	reaction := a.failureReaction(d)
+	if err := a.publishSlackReaction(ctx, d.Channel, d.Ts, reaction, false); err != nil {
+		logError("Error publishing %s reaction: %v", reaction, err)
+	} else {
+		logInfo("Published %s reaction for channel %s, message %s", reaction, d.Channel, d.Ts)
+	}
+	a.notifyFailure(ctx, d)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// WorkflowDiagnostics runs read-only inspection commands and posts their output to the thread.
+// It is not recorded as a deployment and does not take a concurrency slot.
+const WorkflowDiagnostics = "diagnostics"
+
+const DiagnosticsReaction = "mag_right"
+
+// defaultDiagnosticsCommands run when a repository doesn't configure its own
+var defaultDiagnosticsCommands = []string{
+	"docker compose ps",
+	"docker compose logs --tail=100",
+}
+
+// diagnosticsCommands returns the repository's diagnostic commands, or the defaults
+func (c RepoConfig) diagnosticsCommands() []string {
+	if len(c.Diagnostics) > 0 {
+		return c.Diagnostics
+	}
+	return defaultDiagnosticsCommands
+}
+
+// startDiagnostics dispatches the repository's diagnostic commands, replying in the message thread with their output
+func (a *App) startDiagnostics(ctx context.Context, metadata *PRMetadata, channel, ts, user string) error {
+	repoConfig := a.repoConfig(metadata.Repository)
+	dir, err := repoConfig.pipelineDir(a.config.BaseDir, metadata, "")
+	if err != nil {
+		return err
+	}
+	cmd := PoppitCommand{
+		Repo:     metadata.Repository,
+		Branch:   metadata.Branch,
+		Type:     VibeDeployType,
+		Dir:      dir,
+		Commands: repoConfig.diagnosticsCommands(),
+		Metadata: &CommandMetadata{
+			Channel:  channel,
+			Ts:       ts,
+			Workflow: WorkflowDiagnostics,
+		},
+	}
+
+	// Diagnostics are meant to be read-only, but configured commands still have to pass the policy
+	if a.policy != nil {
+		if err := a.policy.check(cmd); err != nil {
+			a.alertViolation(ctx, &Deployment{ID: WorkflowDiagnostics, Repository: metadata.Repository, Branch: metadata.Branch, TriggeredBy: user}, err)
+			if postErr := a.postThreadMessage(ctx, channel, ts, fmt.Sprintf(":no_entry: Diagnostics refused: %v", err)); postErr != nil {
+				logError("Error posting diagnostics notice: %v", postErr)
+			}
+			return err
+		}
+	}
+
+	// Diagnostics look at the first environment, on whichever host it runs
+	executor, err := a.hostExecutor(a.targetHost(ctx, metadata.Repository, ""))
+	if err != nil {
+		return err
+	}
+	if err := executor.Execute(ctx, cmd); err != nil {
+		return fmt.Errorf("failed to dispatch diagnostics via %s executor: %w", executor.Name(), err)
+	}
+
+	logInfo("Dispatched %d diagnostic commands for %s via %s executor", len(cmd.Commands), metadata.Repository, executor.Name())
+	return nil
+}
+
+// postDiagnosticsOutput replies in the thread with one diagnostic command's output
+func (a *App) postDiagnosticsOutput(ctx context.Context, output CommandOutput) {
+	message := fmt.Sprintf(":mag_right: `%s`\n%s", output.Command, a.output.formatOutput(output.Output))
+	if err := a.postThreadMessage(ctx, output.Metadata.Channel, output.Metadata.Ts, message); err != nil {
+		logError("Error posting diagnostics output for %q: %v", output.Command, err)
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/slack-go/slack"
+)
+
+// digestSubscriptionsKey is a Redis hash of Slack user IDs to their digest subscription as JSON
+const digestSubscriptionsKey = "vibedeploy:digests"
+
+// digestSentKey is a Redis hash of Slack user IDs to the Unix time of the last digest slot they were sent
+const digestSentKey = "vibedeploy:digests:sent"
+
+// digestClaimKeyPrefix starts the keys that let only one VibeDeploy instance send each digest
+const digestClaimKeyPrefix = "vibedeploy:digests:claim:"
+
+// digestMaxLines bounds the deployments listed per repository; the counts still cover all of them
+const digestMaxLines = 5
+
+// digestScanLimit bounds how many of a repository's newest deployments are read for a digest
+const digestScanLimit = 500
+
+// Digest frequencies
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// DigestSubscription is a user's request for a DM summarising deployments of the repositories they own or follow
+type DigestSubscription struct {
+	Frequency string `json:"frequency"`
+	// Follows are repositories included besides the ones listing the user as an owner
+	Follows []string `json:"follows,omitempty"`
+}
+
+// period is how much history each digest covers
+func (s DigestSubscription) period() time.Duration {
+	if s.Frequency == DigestWeekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// digestSlot returns the most recent time a digest of the frequency was due: DIGEST_HOUR UTC every day,
+// or every Monday for weekly digests
+func digestSlot(now time.Time, frequency string, hour int) time.Time {
+	now = now.UTC()
+	slot := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, time.UTC)
+	if slot.After(now) {
+		slot = slot.AddDate(0, 0, -1)
+	}
+	if frequency == DigestWeekly {
+		slot = slot.AddDate(0, 0, -((int(slot.Weekday()) + 6) % 7))
+	}
+	return slot
+}
+
+// digestSubscriptions returns every user's subscription
+func (a *App) digestSubscriptions(ctx context.Context) (map[string]DigestSubscription, error) {
+	raw, err := a.redisClient.HGetAll(ctx, digestSubscriptionsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list digest subscriptions: %w", err)
+	}
+	subscriptions := make(map[string]DigestSubscription, len(raw))
+	for user, data := range raw {
+		var subscription DigestSubscription
+		if err := json.Unmarshal([]byte(data), &subscription); err != nil {
+			logError("Error parsing digest subscription of %s: %v", user, err)
+			continue
+		}
+		subscriptions[user] = subscription
+	}
+	return subscriptions, nil
+}
+
+// digestSubscription returns a user's subscription, or nil if they have none
+func (a *App) digestSubscription(ctx context.Context, user string) (*DigestSubscription, error) {
+	data, err := a.redisClient.HGet(ctx, digestSubscriptionsKey, user).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read digest subscription: %w", err)
+	}
+	var subscription DigestSubscription
+	if err := json.Unmarshal([]byte(data), &subscription); err != nil {
+		return nil, fmt.Errorf("failed to parse digest subscription: %w", err)
+	}
+	return &subscription, nil
+}
+
+func (a *App) saveDigestSubscription(ctx context.Context, user string, subscription *DigestSubscription) error {
+	data, err := json.Marshal(subscription)
+	if err != nil {
+		return fmt.Errorf("failed to marshal digest subscription: %w", err)
+	}
+	if err := a.redisClient.HSet(ctx, digestSubscriptionsKey, user, data).Err(); err != nil {
+		return fmt.Errorf("failed to save digest subscription: %w", err)
+	}
+	return nil
+}
+
+// ownedRepos returns the configured repositories listing the user's Slack ID among their owners
+func (a *App) ownedRepos(user string) []string {
+	var repos []string
+	if a.reposConfig == nil {
+		return repos
+	}
+	for repo, repoConfig := range a.reposConfig.Repos {
+		for _, owner := range repoConfig.Owners {
+			if strings.TrimSpace(owner) == user {
+				repos = append(repos, repo)
+				break
+			}
+		}
+	}
+	sort.Strings(repos)
+	return repos
+}
+
+// digestRepos returns the repositories a user's digest covers
+func (a *App) digestRepos(user string, subscription DigestSubscription) []string {
+	repos := a.ownedRepos(user)
+	for _, repo := range subscription.Follows {
+		if !containsString(repos, repo) {
+			repos = append(repos, repo)
+		}
+	}
+	sort.Strings(repos)
+	return repos
+}
+
+// runDigests sends each subscriber their digest once its slot has passed. An instance that was down
+// when a slot passed sends it on starting.
+func (a *App) runDigests(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		a.sendDueDigests(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			logInfo("Digest context cancelled, exiting")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendDueDigests sends the digests whose latest slot hasn't been sent yet
+func (a *App) sendDueDigests(ctx context.Context, now time.Time) {
+	subscriptions, err := a.digestSubscriptions(ctx)
+	if err != nil {
+		logError("Error loading digest subscriptions: %v", err)
+		return
+	}
+	if len(subscriptions) == 0 {
+		return
+	}
+	sent, err := a.redisClient.HGetAll(ctx, digestSentKey).Result()
+	if err != nil {
+		logError("Error loading sent digests: %v", err)
+		return
+	}
+
+	users := make([]string, 0, len(subscriptions))
+	for user := range subscriptions {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+
+	for _, user := range users {
+		subscription := subscriptions[user]
+		slot := digestSlot(now, subscription.Frequency, a.config.DigestHour)
+		if last, err := strconv.ParseInt(sent[user], 10, 64); err == nil && last >= slot.Unix() {
+			continue
+		}
+		// Every instance sees the same subscriptions; the first to claim the slot sends it
+		claimed, err := a.redisClient.SetNX(ctx, fmt.Sprintf("%s%s:%d", digestClaimKeyPrefix, user, slot.Unix()), 1, subscription.period()+time.Hour).Result()
+		if err != nil {
+			logError("Error claiming digest of %s: %v", user, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		if err := a.redisClient.HSet(ctx, digestSentKey, user, slot.Unix()).Err(); err != nil {
+			logError("Error recording digest of %s: %v", user, err)
+		}
+		a.sendDigest(ctx, user, subscription, slot.Add(-subscription.period()), slot)
+	}
+}
+
+// sendDigest DMs a user the deployments of their repositories started between since and until.
+// Nothing is sent for a quiet period.
+func (a *App) sendDigest(ctx context.Context, user string, subscription DigestSubscription, since, until time.Time) {
+	text, err := a.digestText(ctx, user, subscription, since, until)
+	if err != nil {
+		logError("Error building digest for %s: %v", user, err)
+		return
+	}
+	if text == "" {
+		logDebug("No deployments for the %s digest of %s", subscription.Frequency, user)
+		return
+	}
+	// Posting to a user ID delivers the message in the app's DM with them
+	if _, _, err := a.slackClient.PostMessageContext(ctx, user, slack.MsgOptionText(text, false)); err != nil {
+		logError("Error sending digest to %s: %v", user, err)
+		return
+	}
+	logInfo("Sent %s digest to %s", subscription.Frequency, user)
+}
+
+// digestText summarises the deployments a user may view, or returns "" if there were none
+func (a *App) digestText(ctx context.Context, user string, subscription DigestSubscription, since, until time.Time) (string, error) {
+	identities := a.slackIdentities(ctx, user)
+	var sections []string
+	for _, repo := range a.digestRepos(user, subscription) {
+		if !a.authorize(identities, ActionView, repo, "") {
+			continue
+		}
+		history, err := a.deployments.List(ctx, repo, digestScanLimit)
+		if err != nil {
+			return "", fmt.Errorf("failed to list deployments of %s: %w", repo, err)
+		}
+		var lines []string
+		counts := map[string]int{}
+		total := 0
+		for _, d := range history {
+			if d.StartedAt.Before(since) {
+				break
+			}
+			if !d.StartedAt.Before(until) {
+				continue
+			}
+			total++
+			counts[d.Status]++
+			if len(lines) < digestMaxLines {
+				lines = append(lines, "• "+a.deploymentSummary(d))
+			}
+		}
+		if total == 0 {
+			continue
+		}
+		section := a.messages.text("digest.repo", map[string]interface{}{
+			"Repository": repo,
+			"Total":      total,
+			"Succeeded":  counts[StatusSucceeded],
+			"Failed":     counts[StatusFailed],
+			"More":       total - len(lines),
+		})
+		sections = append(sections, section+"\n"+strings.Join(lines, "\n"))
+	}
+	if len(sections) == 0 {
+		return "", nil
+	}
+	header := a.messages.text("digest.header", map[string]interface{}{
+		"Frequency": subscription.Frequency,
+		"Since":     since.Format("Mon 2 Jan 15:04 MST"),
+	})
+	return header + "\n\n" + strings.Join(sections, "\n\n"), nil
+}
+
+// digestCommand handles `digest`, `digest daily|weekly [owner/repo ...]`, `digest unfollow <owner/repo>` and `digest off`
+func (a *App) digestCommand(ctx context.Context, command slack.SlashCommand, args []string) *slack.WebhookMessage {
+	const usage = "Usage: `digest`, `digest daily|weekly [owner/repo ...]`, `digest unfollow <owner/repo>` or `digest off`"
+	user := command.UserID
+	subscription, err := a.digestSubscription(ctx, user)
+	if err != nil {
+		logError("Error loading digest subscription of %s: %v", user, err)
+		return ephemeralReply(":warning: Could not read your digest subscription, please try again.")
+	}
+
+	if len(args) == 0 {
+		if subscription == nil {
+			return ephemeralReply("You have no deployment digest. Subscribe with `digest daily` or `digest weekly`.")
+		}
+		return ephemeralReply(a.digestStatus(user, *subscription))
+	}
+
+	switch args[0] {
+	case "off":
+		if err := a.redisClient.HDel(ctx, digestSubscriptionsKey, user).Err(); err != nil {
+			logError("Error removing digest subscription of %s: %v", user, err)
+			return ephemeralReply(":warning: Could not unsubscribe you, please try again.")
+		}
+		return ephemeralReply("You won't get deployment digests any more.")
+	case "unfollow":
+		if len(args) != 2 {
+			return ephemeralReply(usage)
+		}
+		unfollowed := a.canonicalRepo(args[1])
+		if subscription == nil || !containsString(subscription.Follows, unfollowed) {
+			return ephemeralReply(fmt.Sprintf("Your digest doesn't follow %s.", unfollowed))
+		}
+		follows := subscription.Follows[:0]
+		for _, repo := range subscription.Follows {
+			if repo != unfollowed {
+				follows = append(follows, repo)
+			}
+		}
+		subscription.Follows = follows
+	case DigestDaily, DigestWeekly:
+		if subscription == nil {
+			subscription = &DigestSubscription{}
+		}
+		if subscription.Frequency != args[0] {
+			// The first digest covers a whole period from now, rather than arriving at once
+			slot := digestSlot(time.Now(), args[0], a.config.DigestHour)
+			if err := a.redisClient.HSet(ctx, digestSentKey, user, slot.Unix()).Err(); err != nil {
+				logError("Error recording digest slot of %s: %v", user, err)
+			}
+		}
+		subscription.Frequency = args[0]
+		identities := a.slackIdentities(ctx, user)
+		for _, repo := range args[1:] {
+			repo = a.canonicalRepo(repo)
+			if !isRepoAllowed(repo, a.allowedRepos) {
+				return ephemeralReply(fmt.Sprintf("Repository %s is not in the allowed list.", repo))
+			}
+			if !a.authorize(identities, ActionView, repo, "") {
+				return ephemeralReply(fmt.Sprintf(":no_entry: You need the view permission on %s to follow it.", repo))
+			}
+			if !containsString(subscription.Follows, repo) {
+				subscription.Follows = append(subscription.Follows, repo)
+			}
+		}
+	default:
+		return ephemeralReply(usage)
+	}
+
+	if err := a.saveDigestSubscription(ctx, user, subscription); err != nil {
+		logError("Error saving digest subscription of %s: %v", user, err)
+		return ephemeralReply(":warning: Could not save your digest subscription, please try again.")
+	}
+	logInfo("User %s subscribed to a %s digest of %v", user, subscription.Frequency, a.digestRepos(user, *subscription))
+	return ephemeralReply(a.digestStatus(user, *subscription))
+}
+
+// digestStatus describes a subscription and when its next digest is due
+func (a *App) digestStatus(user string, subscription DigestSubscription) string {
+	repos := a.digestRepos(user, subscription)
+	next := digestSlot(time.Now(), subscription.Frequency, a.config.DigestHour).Add(subscription.period())
+	if len(repos) == 0 {
+		return fmt.Sprintf(":newspaper: You get a %s digest, but you own and follow no repositories yet. Follow one with `digest %s owner/repo`.",
+			subscription.Frequency, subscription.Frequency)
+	}
+	return fmt.Sprintf(":newspaper: You get a %s digest of %s. The next one is due %s.",
+		subscription.Frequency, strings.Join(repos, ", "), next.Format(time.RFC1123))
+}
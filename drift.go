@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WorkflowDrift inspects the running containers and compares them with the deployment on record.
+// Like diagnostics, it is not recorded as a deployment and does not take a concurrency slot.
+const WorkflowDrift = "drift"
+
+const DriftReaction = "triangular_ruler"
+
+// DriftCommand prints "<container> <service> <config hash> <image ID>" for each of the project's running containers.
+// The config hash label is what compose computed when it created the container, so it changes with any manual `up`.
+const DriftCommand = `docker compose ps -q | xargs -r docker inspect --format '{{.Name}} {{index .Config.Labels "com.docker.compose.service"}} {{index .Config.Labels "com.docker.compose.config-hash"}} {{.Image}}'`
+
+// runningContainer is one line of DriftCommand's output
+type runningContainer struct {
+	name, service, configHash, image string
+}
+
+func parseRunningContainers(output string) []runningContainer {
+	var containers []runningContainer
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			continue
+		}
+		containers = append(containers, runningContainer{strings.TrimPrefix(fields[0], "/"), fields[1], fields[2], fields[3]})
+	}
+	return containers
+}
+
+// sameImage compares image IDs, which are sometimes reported without the sha256: prefix or shortened
+func sameImage(a, b string) bool {
+	a, b = strings.TrimPrefix(a, "sha256:"), strings.TrimPrefix(b, "sha256:")
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return a != "" && strings.HasPrefix(b, a)
+}
+
+// detectDrift lists how the running containers differ from what the deployment recorded
+func detectDrift(build BuildMetadata, containers []runningContainer) []string {
+	var drift []string
+	if len(containers) == 0 {
+		return []string{"no containers are running"}
+	}
+
+	recordedImages := make(map[string]string, len(build.Images))
+	for _, image := range build.Images {
+		recordedImages[image.Container] = image.ID
+	}
+	running := make(map[string]bool)
+	for _, c := range containers {
+		running[c.service] = true
+		recorded, ok := build.ConfigHashes[c.service]
+		switch {
+		case !ok && len(build.ConfigHashes) > 0:
+			drift = append(drift, fmt.Sprintf("`%s` runs service `%s`, which the deployment didn't start", c.name, c.service))
+			continue
+		case ok && recorded != c.configHash:
+			drift = append(drift, fmt.Sprintf("`%s` was created from a different config (hash `%s`, deployed `%s`)", c.name, shortHash(c.configHash), shortHash(recorded)))
+		}
+		if image, ok := recordedImages[c.name]; ok && !sameImage(image, c.image) {
+			drift = append(drift, fmt.Sprintf("`%s` runs image `%s`, not the deployed `%s`", c.name, shortHash(c.image), shortHash(image)))
+		}
+	}
+	services := make([]string, 0, len(build.ConfigHashes))
+	for service := range build.ConfigHashes {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	for _, service := range services {
+		if !running[service] {
+			drift = append(drift, fmt.Sprintf("service `%s` is not running", service))
+		}
+	}
+	return drift
+}
+
+// shortHash abbreviates a hash or image ID for display
+func shortHash(hash string) string {
+	hash = strings.TrimPrefix(hash, "sha256:")
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+// driftTargets returns the deployment on record for each of the repository's environments
+func (a *App) driftTargets(ctx context.Context, repo string) ([]*Deployment, error) {
+	history, err := a.deployments.List(ctx, repo, defaultHistoryLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load history for %s: %w", repo, err)
+	}
+	first := a.repoConfig(repo).defaultEnvironment()
+	seen := make(map[string]bool)
+	var targets []*Deployment
+	for _, d := range history {
+		if d.Status != StatusSucceeded || workflowOf(d) != WorkflowDeploy {
+			continue
+		}
+		environment := d.Environment
+		if environment == "" {
+			environment = first
+		}
+		if seen[environment] {
+			continue
+		}
+		seen[environment] = true
+		targets = append(targets, d)
+	}
+	return targets, nil
+}
+
+// startDriftCheck dispatches the drift inspection for a deployment on record to the host it ran on.
+// channel and ts are where the result goes besides the ops channel, and may be empty.
+func (a *App) startDriftCheck(ctx context.Context, d *Deployment, channel, ts string) error {
+	repoConfig := a.repoConfig(d.Repository)
+	dir, err := repoConfig.pipelineDir(a.config.BaseDir, &PRMetadata{Repository: d.Repository, Branch: d.Branch, PRNumber: d.PRNumber}, d.Environment)
+	if err != nil {
+		return err
+	}
+	cmd := PoppitCommand{
+		Repo:     d.Repository,
+		Branch:   d.Branch,
+		Type:     VibeDeployType,
+		Dir:      dir,
+		Commands: []string{DriftCommand},
+		Env:      repoConfig.environmentEnv(d.Environment),
+		Metadata: &CommandMetadata{
+			Channel:      channel,
+			Ts:           ts,
+			DeploymentID: d.ID,
+			Workflow:     WorkflowDrift,
+		},
+	}
+	if d.Host != "" {
+		cmd.Env = mergeEnv(cmd.Env, map[string]string{HostEnvVar: d.Host})
+	}
+	if a.policy != nil {
+		if err := a.policy.check(cmd); err != nil {
+			return err
+		}
+	}
+	executor, err := a.executorFor(cmd)
+	if err != nil {
+		return err
+	}
+	if err := executor.Execute(ctx, cmd); err != nil {
+		return fmt.Errorf("failed to dispatch drift check via %s executor: %w", executor.Name(), err)
+	}
+	logDebug("Dispatched drift check of deployment %s of %s", d.ID, d.Repository)
+	return nil
+}
+
+// checkDriftFromReaction checks every environment of the PR's repository for a :triangular_ruler: reaction
+func (a *App) checkDriftFromReaction(ctx context.Context, metadata *PRMetadata, channel, ts string) {
+	targets, err := a.driftTargets(ctx, metadata.Repository)
+	if err != nil {
+		logError("Error finding deployments to check for drift: %v", err)
+		return
+	}
+	if len(targets) == 0 {
+		if err := a.postThreadMessage(ctx, channel, ts, fmt.Sprintf(":%s: *%s* has no successful deployment to compare against.", DriftReaction, metadata.Repository)); err != nil {
+			logError("Error posting drift notice: %v", err)
+		}
+		return
+	}
+	for _, d := range targets {
+		if err := a.startDriftCheck(ctx, d, channel, ts); err != nil {
+			logError("Error starting drift check of deployment %s: %v", d.ID, err)
+		}
+	}
+}
+
+// runDriftChecks periodically checks the deployment on record of every repository environment
+func (a *App) runDriftChecks(ctx context.Context) {
+	ticker := time.NewTicker(a.config.DriftCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logInfo("Drift check context cancelled, exiting")
+			return
+		case <-ticker.C:
+		}
+
+		repos, err := a.deployments.Repositories(ctx)
+		if err != nil {
+			logError("Error listing repositories for drift checks: %v", err)
+			continue
+		}
+		for _, repo := range repos {
+			targets, err := a.driftTargets(ctx, repo)
+			if err != nil {
+				logError("Error finding deployments to check for drift: %v", err)
+				continue
+			}
+			for _, d := range targets {
+				if err := a.startDriftCheck(ctx, d, "", ""); err != nil {
+					logError("Error starting drift check of deployment %s: %v", d.ID, err)
+				}
+			}
+		}
+	}
+}
+
+// reportDrift compares a drift check's output with its deployment, alerting the ops channel about any drift
+func (a *App) reportDrift(ctx context.Context, output CommandOutput) {
+	d, err := a.deployments.Get(ctx, output.Metadata.DeploymentID)
+	if err != nil {
+		logError("Error loading deployment %s for drift check: %v", output.Metadata.DeploymentID, err)
+		return
+	}
+	where := "*" + d.Repository + "*"
+	if d.Environment != "" {
+		where += " " + d.Environment
+	}
+	if d.Host != "" {
+		where += " on " + d.Host
+	}
+
+	drift := detectDrift(d.Build, parseRunningContainers(output.Output))
+	if len(drift) == 0 {
+		logDebug("No drift from deployment %s of %s", d.ID, d.Repository)
+		text := fmt.Sprintf(":%s: %s matches deployment `%s` of `%s`.", DriftReaction, where, d.ID, d.Branch)
+		if err := a.postThreadMessage(ctx, output.Metadata.Channel, output.Metadata.Ts, text); err != nil {
+			logError("Error posting drift check result: %v", err)
+		}
+		return
+	}
+
+	logWarn("Drift from deployment %s of %s: %s", d.ID, d.Repository, strings.Join(drift, "; "))
+	text := fmt.Sprintf(":%s: %s has drifted from deployment `%s` of `%s`, probably from docker commands run by hand on the host:\n• %s",
+		DriftReaction, where, d.ID, d.Branch, strings.Join(drift, "\n• "))
+	if err := a.postThreadMessage(ctx, output.Metadata.Channel, output.Metadata.Ts, text); err != nil {
+		logError("Error posting drift check result: %v", err)
+	}
+	if a.config.OpsAlertChannel != "" && a.config.OpsAlertChannel != output.Metadata.Channel {
+		if err := a.postThreadMessage(ctx, a.config.OpsAlertChannel, "", text); err != nil {
+			logError("Error posting drift alert to %s: %v", a.config.OpsAlertChannel, err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// PayloadAlgorithm is the value of the "enc" header on encrypted payloads
+const PayloadAlgorithm = "A256GCM"
+
+// EncryptedPayload is the envelope written to Redis in place of a plaintext JSON payload.
+// Consumers recognise it by the "enc" header; anything without one is treated as plaintext.
+type EncryptedPayload struct {
+	Enc        string `json:"enc"`
+	KeyID      string `json:"kid"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// PayloadCipher encrypts and decrypts Redis payloads with AES-256-GCM.
+// A nil *PayloadCipher leaves payloads in plaintext.
+type PayloadCipher struct {
+	aead  cipher.AEAD
+	keyID string
+}
+
+// newPayloadCipher loads the key from PAYLOAD_ENCRYPTION_KEY or PAYLOAD_ENCRYPTION_KEY_FILE
+// (e.g. a file rendered by Vault Agent); it returns nil when neither is set
+func newPayloadCipher(config Config) (*PayloadCipher, error) {
+	encoded := config.PayloadEncryptionKey
+	if encoded == "" && config.PayloadEncryptionKeyFile != "" {
+		data, err := os.ReadFile(config.PayloadEncryptionKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read payload encryption key: %w", err)
+		}
+		encoded = strings.TrimSpace(string(data))
+	}
+	if encoded == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("payload encryption key must be base64: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("payload encryption key must be 32 bytes, got %d", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM cipher: %w", err)
+	}
+
+	// The key ID lets consumers holding several keys pick the right one without revealing the key
+	sum := sha256.Sum256(key)
+	return &PayloadCipher{aead: aead, keyID: hex.EncodeToString(sum[:4])}, nil
+}
+
+// seal encrypts a payload into an envelope, or returns it unchanged when encryption is off
+func (c *PayloadCipher) seal(plaintext []byte) ([]byte, error) {
+	if c == nil {
+		return plaintext, nil
+	}
+
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	envelope, err := json.Marshal(EncryptedPayload{
+		Enc:        PayloadAlgorithm,
+		KeyID:      c.keyID,
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(c.aead.Seal(nil, nonce, plaintext, []byte(c.keyID))),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal encrypted payload: %w", err)
+	}
+	return envelope, nil
+}
+
+// open decrypts an envelope, passing plaintext payloads through so producers can be migrated one at a time
+func (c *PayloadCipher) open(payload []byte) ([]byte, error) {
+	var envelope EncryptedPayload
+	if err := json.Unmarshal(payload, &envelope); err != nil || envelope.Enc == "" {
+		return payload, nil
+	}
+
+	if c == nil {
+		return nil, errors.New("received an encrypted payload but no payload encryption key is configured")
+	}
+	if envelope.Enc != PayloadAlgorithm {
+		return nil, fmt.Errorf("unsupported payload encryption %q", envelope.Enc)
+	}
+	if envelope.KeyID != c.keyID {
+		return nil, fmt.Errorf("payload encrypted with unknown key %s", envelope.KeyID)
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(envelope.Nonce)
+	if err != nil || len(nonce) != c.aead.NonceSize() {
+		return nil, errors.New("invalid payload nonce")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(envelope.Ciphertext)
+	if err != nil {
+		return nil, errors.New("invalid payload ciphertext encoding")
+	}
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, []byte(envelope.KeyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt payload: %w", err)
+	}
+	return plaintext, nil
+}
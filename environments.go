@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/slack-go/slack"
+)
+
+// environmentsKey is a Redis hash of preview URL (host and path) to the environment deployed there
+const environmentsKey = "vibedeploy:environments"
+
+// Environment is the branch currently deployed behind a preview URL
+type Environment struct {
+	URL          string    `json:"url"`
+	Repository   string    `json:"repository"`
+	Branch       string    `json:"branch"`
+	PRNumber     int       `json:"pr_number,omitempty"`
+	GitSHA       string    `json:"git_sha,omitempty"`
+	DeployedBy   string    `json:"deployed_by,omitempty"`
+	DeploymentID string    `json:"deployment_id"`
+	DeployedAt   time.Time `json:"deployed_at"`
+}
+
+// LinkSharedEvent is a Slack link_shared event relayed over Redis
+type LinkSharedEvent struct {
+	Event struct {
+		Type      string `json:"type"`
+		Channel   string `json:"channel"`
+		User      string `json:"user"`
+		MessageTs string `json:"message_ts"`
+		Links     []struct {
+			Domain string `json:"domain"`
+			URL    string `json:"url"`
+		} `json:"links"`
+	} `json:"event"`
+}
+
+// environmentKey normalises a URL to the registry's lookup key: lowercased host plus path, without scheme or trailing slash
+func environmentKey(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+	return strings.ToLower(parsed.Host) + strings.TrimSuffix(parsed.Path, "/")
+}
+
+// registerEnvironment records a successful deployment as the one now behind its preview URL
+func (a *App) registerEnvironment(ctx context.Context, d *Deployment) {
+	key := environmentKey(d.PreviewURL)
+	if key == "" {
+		return
+	}
+
+	env := Environment{
+		URL:          d.PreviewURL,
+		Repository:   d.Repository,
+		Branch:       d.Branch,
+		PRNumber:     d.PRNumber,
+		GitSHA:       d.Build.GitSHA,
+		DeployedBy:   d.TriggeredBy,
+		DeploymentID: d.ID,
+		DeployedAt:   time.Now().UTC(),
+	}
+	if d.FinishedAt != nil {
+		env.DeployedAt = *d.FinishedAt
+	}
+
+	data, err := json.Marshal(env)
+	if err != nil {
+		logError("Error marshalling environment for %s: %v", d.PreviewURL, err)
+		return
+	}
+	if err := a.redisClient.HSet(ctx, environmentsKey, key, data).Err(); err != nil {
+		logError("Error registering environment %s: %v", d.PreviewURL, err)
+		return
+	}
+	logDebug("Registered %s branch %s at %s", d.Repository, d.Branch, d.PreviewURL)
+}
+
+// lookupEnvironment finds the environment serving a URL, matching the longest registered path prefix on the same host
+func (a *App) lookupEnvironment(ctx context.Context, raw string) (*Environment, error) {
+	key := environmentKey(raw)
+	for key != "" {
+		data, err := a.redisClient.HGet(ctx, environmentsKey, key).Result()
+		if err == nil {
+			var env Environment
+			if err := json.Unmarshal([]byte(data), &env); err != nil {
+				return nil, fmt.Errorf("failed to parse environment %s: %w", key, err)
+			}
+			return &env, nil
+		}
+		if !errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("failed to look up environment: %w", err)
+		}
+
+		i := strings.LastIndex(key, "/")
+		if i < 0 {
+			break
+		}
+		key = key[:i]
+	}
+	return nil, nil
+}
+
+// listEnvironments returns every registered environment, most recently deployed first
+func (a *App) listEnvironments(ctx context.Context) ([]Environment, error) {
+	entries, err := a.redisClient.HGetAll(ctx, environmentsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list environments: %w", err)
+	}
+
+	environments := make([]Environment, 0, len(entries))
+	for key, data := range entries {
+		var env Environment
+		if err := json.Unmarshal([]byte(data), &env); err != nil {
+			logWarn("Skipping environment %s: %v", key, err)
+			continue
+		}
+		environments = append(environments, env)
+	}
+	sort.Slice(environments, func(i, j int) bool {
+		return environments[i].DeployedAt.After(environments[j].DeployedAt)
+	})
+	return environments, nil
+}
+
+func (a *App) listenForLinkShared(ctx context.Context) {
+	pubsub := a.redisClient.Subscribe(ctx, a.config.RedisLinkShared)
+	defer pubsub.Close()
+
+	logInfo("Subscribed to Redis channel: %s", a.config.RedisLinkShared)
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			logInfo("Link shared listener context cancelled, exiting")
+			return
+		case msg := <-ch:
+			if msg == nil {
+				continue
+			}
+			logDebug("Received link shared event from channel: %s", a.config.RedisLinkShared)
+			a.capture.consumed(ctx, a.cipher, CaptureLinkShared, msg.Channel, []byte(msg.Payload))
+			a.processLinkSharedEvent(ctx, msg.Payload)
+		}
+	}
+}
+
+// processLinkSharedEvent unfurls any shared links that point at a registered preview environment
+func (a *App) processLinkSharedEvent(ctx context.Context, payload string) {
+	plaintext, err := a.cipher.open([]byte(payload))
+	if err != nil {
+		logError("Error decrypting link shared event: %v", err)
+		return
+	}
+
+	var event LinkSharedEvent
+	if err := json.Unmarshal(plaintext, &event); err != nil {
+		logError("Error parsing link shared event: %v", err)
+		return
+	}
+	if event.Event.Type != "link_shared" {
+		logDebug("Ignoring event type: %s", event.Event.Type)
+		return
+	}
+
+	unfurls := make(map[string]slack.Attachment)
+	for _, link := range event.Event.Links {
+		env, err := a.lookupEnvironment(ctx, link.URL)
+		if err != nil {
+			logError("Error looking up environment for %s: %v", link.URL, err)
+			continue
+		}
+		if env == nil {
+			logDebug("No environment registered for %s", link.URL)
+			continue
+		}
+		unfurls[link.URL] = environmentAttachment(env, time.Now())
+	}
+	if len(unfurls) == 0 {
+		return
+	}
+
+	if _, _, _, err := a.slackClient.UnfurlMessageContext(ctx, event.Event.Channel, event.Event.MessageTs, unfurls); err != nil {
+		logError("Error unfurling links in channel %s, message %s: %v", event.Event.Channel, event.Event.MessageTs, err)
+		return
+	}
+	logInfo("Unfurled %d preview links in channel %s, message %s", len(unfurls), event.Event.Channel, event.Event.MessageTs)
+}
+
+// environmentAttachment renders an environment as a Slack unfurl
+func environmentAttachment(env *Environment, now time.Time) slack.Attachment {
+	branch := fmt.Sprintf("`%s`", env.Branch)
+	if env.PRNumber > 0 {
+		branch = fmt.Sprintf("<https://github.com/%s/pull/%d|#%d> `%s`", env.Repository, env.PRNumber, env.PRNumber, env.Branch)
+	}
+	fields := []slack.AttachmentField{
+		{Title: "Repository", Value: env.Repository, Short: true},
+		{Title: "Branch", Value: branch, Short: true},
+	}
+	if env.GitSHA != "" {
+		fields = append(fields, slack.AttachmentField{Title: "Commit", Value: fmt.Sprintf("<https://github.com/%s/commit/%s|%s>", env.Repository, env.GitSHA, shortSHA(env.GitSHA)), Short: true})
+	}
+	if env.DeployedBy != "" {
+		fields = append(fields, slack.AttachmentField{Title: "Deployed by", Value: formatMention(env.DeployedBy), Short: true})
+	}
+	fields = append(fields, slack.AttachmentField{Title: "Deployed", Value: formatAge(now.Sub(env.DeployedAt)) + " ago", Short: true})
+
+	return slack.Attachment{
+		Title:  fmt.Sprintf("%s (%s)", env.Repository, env.Branch),
+		Fields: fields,
+		Footer: "VibeDeploy " + env.DeploymentID,
+	}
+}
+
+// formatAge renders a duration at a human scale, e.g. "45s", "12m", "3h" or "2d"
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
+
+// handleListEnvironments returns every registered preview environment
+func (a *App) handleListEnvironments(w http.ResponseWriter, r *http.Request) {
+	environments, err := a.listEnvironments(r.Context())
+	if err != nil {
+		logError("Error listing environments: %v", err)
+		http.Error(w, "failed to list environments", http.StatusInternalServerError)
+		return
+	}
+
+	// Dashboard users and API keys only see environments of repositories they may view
+	visible := environments
+	if principal, _ := r.Context().Value(principalKey{}).(*Principal); principal != nil {
+		visible = make([]Environment, 0, len(environments))
+		for _, env := range environments {
+			if a.permits(principal, ActionView, env.Repository) {
+				visible = append(visible, env)
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, visible)
+}
+
+// shortSHA abbreviates a commit SHA the way git does
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
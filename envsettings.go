@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// EnvFileEnvVar carries a rendered .env file to the step that writes it, so its secrets never appear in a command
+const EnvFileEnvVar = "VIBEDEPLOY_ENV_FILE"
+
+// envFilePrefix starts the step that writes an environment's .env file, readable only by the deploy user
+const envFilePrefix = "umask 077 && printenv " + EnvFileEnvVar + " > "
+
+// envVarNamePattern is what an environment setting may be called
+var envVarNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// envFilePathPattern keeps the generated file inside the checkout and free of shell metacharacters
+var envFilePathPattern = regexp.MustCompile(`^[A-Za-z0-9_.][A-Za-z0-9._/-]*$`)
+
+// validateSettings checks an environment's settings and secrets don't clash with each other or with VibeDeploy's variables
+func (env EnvironmentConfig) validateSettings() error {
+	for name := range env.Settings {
+		if err := validateSettingName(name); err != nil {
+			return err
+		}
+		if _, ok := env.Secrets[name]; ok {
+			return fmt.Errorf("%s is both a setting and a secret", name)
+		}
+	}
+	for name, secret := range env.Secrets {
+		if err := validateSettingName(name); err != nil {
+			return err
+		}
+		if secret == "" {
+			return fmt.Errorf("secret %s names no secret", name)
+		}
+	}
+	if env.EnvFile != "" && (!envFilePathPattern.MatchString(env.EnvFile) || path.Clean(env.EnvFile) != env.EnvFile || env.EnvFile == ".." || strings.HasPrefix(env.EnvFile, "../")) {
+		return fmt.Errorf("env_file %q must be a plain path inside the checkout", env.EnvFile)
+	}
+	return nil
+}
+
+func validateSettingName(name string) error {
+	if !envVarNamePattern.MatchString(name) {
+		return fmt.Errorf("%q is not a valid variable name", name)
+	}
+	if strings.HasPrefix(name, "VIBEDEPLOY_") || name == ComposeFileEnvVar {
+		return fmt.Errorf("%s is set by VibeDeploy and can't be overridden", name)
+	}
+	return nil
+}
+
+// envFileStep returns the step that writes the environment's .env file, or "" if it has none
+func (c RepoConfig) envFileStep(name string) string {
+	i := c.environmentIndex(name)
+	if i < 0 || c.Environments[i].EnvFile == "" {
+		return ""
+	}
+	return envFilePrefix + c.Environments[i].EnvFile
+}
+
+// environmentSettings resolves an environment's settings and secrets into the pipeline's env.
+// When the environment has an env_file, the same values are also rendered into it.
+func (a *App) environmentSettings(ctx context.Context, repoConfig RepoConfig, name string) (map[string]string, error) {
+	i := repoConfig.environmentIndex(name)
+	if i < 0 {
+		return nil, nil
+	}
+	env := repoConfig.Environments[i]
+	if len(env.Settings) == 0 && len(env.Secrets) == 0 {
+		return nil, nil
+	}
+
+	values := make(map[string]string, len(env.Settings)+len(env.Secrets))
+	for key, value := range env.Settings {
+		values[key] = value
+	}
+	for key, secret := range env.Secrets {
+		value, err := a.secrets.Secret(ctx, secret)
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve %s for %s from the %s secrets provider: %w", key, env.Name, a.secrets.Name(), err)
+		}
+		values[key] = value
+	}
+
+	if env.EnvFile != "" {
+		values[EnvFileEnvVar] = renderEnvFile(values)
+	}
+	return values, nil
+}
+
+// renderEnvFile formats values as a docker compose .env file, double-quoting each so any value survives
+func renderEnvFile(values map[string]string) string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "$", "$$")
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s=\"%s\"\n", name, escaper.Replace(values[name]))
+	}
+	return b.String()
+}
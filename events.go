@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// eventsStreamKey is the append-only Redis stream of deployment lifecycle events
+const eventsStreamKey = "vibedeploy:events"
+
+// eventsHeadKey holds the hash of the newest event in the stream, which the next event chains from
+const eventsHeadKey = "vibedeploy:events:head"
+
+// eventsBaseKey holds the hash of the last event trimmed from the stream, which the oldest remaining one chains from
+const eventsBaseKey = "vibedeploy:events:base"
+
+// appendEventAttempts bounds retries when another instance appends to the chain concurrently
+const appendEventAttempts = 10
+
+// Lifecycle event types
+const (
+	EventDeploymentQueued    = "deployment.queued"
+	EventBuildMetadata       = "deployment.build_metadata"
+	EventResourceUsage       = "deployment.resource_usage"
+	EventSecurityScan        = "deployment.security_scan"
+	EventDeploymentSucceeded = "deployment.succeeded"
+	EventDeploymentFailed    = "deployment.failed"
+	EventDeploymentRetried   = "deployment.retried"
+	EventDeploymentCancelled = "deployment.cancelled"
+	EventDeploymentCoalesced = "deployment.coalesced"
+	EventApprovalDelegated   = "approval.delegated"
+	EventDelegationRevoked   = "approval.delegation_revoked"
+)
+
+// replayBatchSize is the number of stream entries read per XRANGE call during replay
+const replayBatchSize = 500
+
+// LifecycleEvent is one entry in the events stream.
+// Each event carries a full snapshot of the deployment after the change, so replaying
+// the stream in order reproduces the latest state of every deployment.
+// Approval delegation events carry the delegation instead, and no deployment.
+type LifecycleEvent struct {
+	ID         string      `json:"id,omitempty"`
+	Type       string      `json:"type"`
+	Timestamp  time.Time   `json:"timestamp"`
+	Deployment *Deployment `json:"deployment,omitempty"`
+	Delegation *Delegation `json:"delegation,omitempty"`
+	// PrevHash and Hash chain every event to the one before it, so any edit or deletion is detectable
+	PrevHash string `json:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// chainHash returns the SHA-256 over the previous hash and the event's stored fields
+func chainHash(prevHash, eventType, timestamp string, snapshot []byte) string {
+	h := sha256.New()
+	for _, part := range []string{prevHash, eventType, timestamp} {
+		h.Write([]byte(part))
+		h.Write([]byte{'\n'})
+	}
+	h.Write(snapshot)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// appendEvent records a lifecycle event in the stream, chained to the previous event's hash
+func appendEvent(ctx context.Context, redisClient *redis.Client, eventType string, d *Deployment) (*LifecycleEvent, error) {
+	snapshot, err := json.Marshal(d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal deployment snapshot: %w", err)
+	}
+	event := &LifecycleEvent{Type: eventType, Deployment: d}
+	return event, appendChained(ctx, redisClient, event, snapshot, map[string]interface{}{
+		"deployment_id": d.ID,
+		"repository":    d.Repository,
+		"deployment":    snapshot,
+	})
+}
+
+// appendDelegationEvent records an approval delegation being granted or revoked in the stream, so it is
+// part of the audit trail. Its snapshot is stored in a delegation field, which replay ignores.
+func appendDelegationEvent(ctx context.Context, redisClient *redis.Client, eventType string, delegation *Delegation) (*LifecycleEvent, error) {
+	snapshot, err := json.Marshal(delegation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal delegation snapshot: %w", err)
+	}
+	event := &LifecycleEvent{Type: eventType, Delegation: delegation}
+	return event, appendChained(ctx, redisClient, event, snapshot, map[string]interface{}{
+		"delegation": snapshot,
+	})
+}
+
+// appendChained adds an entry with the given snapshot fields to the stream, filling in the event's
+// timestamp, stream ID and chain hashes
+func appendChained(ctx context.Context, redisClient *redis.Client, event *LifecycleEvent, snapshot []byte, fields map[string]interface{}) error {
+	now := time.Now().UTC()
+	timestamp := now.Format(time.RFC3339Nano)
+	event.Timestamp = now
+	eventType := event.Type
+
+	var err error
+	for attempt := 0; attempt < appendEventAttempts; attempt++ {
+		err = redisClient.Watch(ctx, func(tx *redis.Tx) error {
+			prevHash, err := tx.Get(ctx, eventsHeadKey).Result()
+			if err != nil && !errors.Is(err, redis.Nil) {
+				return err
+			}
+			hash := chainHash(prevHash, eventType, timestamp, snapshot)
+
+			var add *redis.StringCmd
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				values := map[string]interface{}{
+					"type":      eventType,
+					"timestamp": timestamp,
+					"prev_hash": prevHash,
+					"hash":      hash,
+				}
+				for name, value := range fields {
+					values[name] = value
+				}
+				add = pipe.XAdd(ctx, &redis.XAddArgs{Stream: eventsStreamKey, Values: values})
+				pipe.Set(ctx, eventsHeadKey, hash, 0)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			event.ID, event.PrevHash, event.Hash = add.Val(), prevHash, hash
+			return nil
+		}, eventsHeadKey)
+		if !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to append lifecycle event: %w", err)
+	}
+
+	return nil
+}
+
+// recordEvent appends a lifecycle event, logging rather than failing if the stream is unavailable.
+// Stores with their own audit log receive a copy of the event as well.
+func (a *App) recordEvent(ctx context.Context, eventType string, d *Deployment) {
+	event, err := appendEvent(ctx, a.redisClient, eventType, d)
+	if err != nil {
+		logError("Error recording %s event for deployment %s: %v", eventType, d.ID, err)
+		event = &LifecycleEvent{Type: eventType, Timestamp: time.Now().UTC(), Deployment: d}
+	}
+
+	if recorder, ok := a.deployments.(EventRecorder); ok {
+		if err := recorder.RecordEvent(ctx, event); err != nil {
+			logError("Error recording %s event for deployment %s in store: %v", eventType, d.ID, err)
+		}
+	}
+}
+
+// recordDelegationEvent appends an approval delegation event, to the store's audit log too
+func (a *App) recordDelegationEvent(ctx context.Context, eventType string, delegation *Delegation) {
+	event, err := appendDelegationEvent(ctx, a.redisClient, eventType, delegation)
+	if err != nil {
+		logError("Error recording %s event for delegation %s: %v", eventType, delegation.ID, err)
+		event = &LifecycleEvent{Type: eventType, Timestamp: time.Now().UTC(), Delegation: delegation}
+	}
+
+	if recorder, ok := a.deployments.(EventRecorder); ok {
+		if err := recorder.RecordEvent(ctx, event); err != nil {
+			logError("Error recording %s event for delegation %s in store: %v", eventType, delegation.ID, err)
+		}
+	}
+}
+
+// parseLifecycleEvent converts a stream entry back into a lifecycle event
+func parseLifecycleEvent(msg redis.XMessage) (*LifecycleEvent, error) {
+	eventType, _ := msg.Values["type"].(string)
+	snapshot, _ := msg.Values["deployment"].(string)
+	delegation, _ := msg.Values["delegation"].(string)
+	if eventType == "" || (snapshot == "" && delegation == "") {
+		return nil, fmt.Errorf("entry %s is missing type or deployment", msg.ID)
+	}
+
+	event := &LifecycleEvent{ID: msg.ID, Type: eventType}
+	if raw, ok := msg.Values["timestamp"].(string); ok {
+		event.Timestamp, _ = time.Parse(time.RFC3339Nano, raw)
+	}
+	event.PrevHash, _ = msg.Values["prev_hash"].(string)
+	event.Hash, _ = msg.Values["hash"].(string)
+	if delegation != "" {
+		if err := json.Unmarshal([]byte(delegation), &event.Delegation); err != nil {
+			return nil, fmt.Errorf("entry %s has an invalid delegation snapshot: %w", msg.ID, err)
+		}
+		return event, nil
+	}
+	if err := json.Unmarshal([]byte(snapshot), &event.Deployment); err != nil {
+		return nil, fmt.Errorf("entry %s has an invalid deployment snapshot: %w", msg.ID, err)
+	}
+
+	return event, nil
+}
+
+// replayEvents walks the events stream from the given ID in order, calling fn for each event
+func replayEvents(ctx context.Context, redisClient *redis.Client, from string, fn func(*LifecycleEvent) error) (int, error) {
+	count := 0
+	start := from
+	for {
+		msgs, err := redisClient.XRangeN(ctx, eventsStreamKey, start, "+", replayBatchSize).Result()
+		if err != nil {
+			return count, fmt.Errorf("failed to read events stream: %w", err)
+		}
+
+		for _, msg := range msgs {
+			event, err := parseLifecycleEvent(msg)
+			if err != nil {
+				logWarn("Skipping lifecycle event: %v", err)
+				continue
+			}
+			if err := fn(event); err != nil {
+				return count, err
+			}
+			count++
+		}
+
+		if len(msgs) < replayBatchSize {
+			return count, nil
+		}
+		// Continue after the last entry we read (exclusive range)
+		start = "(" + msgs[len(msgs)-1].ID
+	}
+}
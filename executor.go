@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	poppitv1 "github.com/its-the-vibe/VibeDeploy/api/poppit/v1"
+)
+
+const (
+	PoppitExecutorName  = "poppit"
+	WebhookExecutorName = "webhook"
+)
+
+// Values of QUEUE_ENCODING
+const (
+	QueueEncodingJSON     = "json"
+	QueueEncodingProtobuf = "protobuf"
+)
+
+// SignatureHeader carries the HMAC-SHA256 signature of webhook request and callback bodies
+const SignatureHeader = "X-VibeDeploy-Signature"
+
+// TimestampHeader carries the Unix time, in seconds, a webhook request or callback was signed at
+const TimestampHeader = "X-VibeDeploy-Timestamp"
+
+// signatureTolerance is how far a signed request's timestamp may be from the receiver's clock, so a captured
+// request can't be replayed later
+const signatureTolerance = 5 * time.Minute
+
+// webhookTimeout bounds how long a single webhook dispatch may take
+const webhookTimeout = 10 * time.Second
+
+// Executor dispatches a generated deployment command to whatever runs it
+type Executor interface {
+	Name() string
+	Execute(ctx context.Context, cmd PoppitCommand) error
+}
+
+// newExecutor builds the executor selected by the EXECUTOR setting
+func newExecutor(config Config, redisClient *redis.Client, payloadCipher *PayloadCipher) (Executor, error) {
+	contentType, err := queueContentType(config.QueueEncoding)
+	if err != nil {
+		return nil, err
+	}
+	switch config.Executor {
+	case PoppitExecutorName:
+		return &PoppitExecutor{redisClient: redisClient, queues: config.PoppitQueues, cipher: payloadCipher, contentType: contentType}, nil
+	case WebhookExecutorName:
+		return newWebhookExecutor(config, contentType)
+	default:
+		return nil, fmt.Errorf("unknown executor %q (expected %s or %s)", config.Executor, PoppitExecutorName, WebhookExecutorName)
+	}
+}
+
+// queueContentType maps the QUEUE_ENCODING setting to the content type queue payloads are encoded with
+func queueContentType(encoding string) (string, error) {
+	switch encoding {
+	case QueueEncodingJSON:
+		return poppitv1.ContentTypeJSON, nil
+	case QueueEncodingProtobuf:
+		return poppitv1.ContentTypeProtobuf, nil
+	default:
+		return "", fmt.Errorf("unknown QUEUE_ENCODING %q (expected %s or %s)", encoding, QueueEncodingJSON, QueueEncodingProtobuf)
+	}
+}
+
+// PoppitExecutor pushes commands onto the Redis lists consumed by Poppit workers.
+// With several queues, each repository is pinned to one queue so its own deployments
+// stay serialised while unrelated repositories deploy in parallel.
+type PoppitExecutor struct {
+	redisClient *redis.Client
+	queues      []string
+	cipher      *PayloadCipher
+	contentType string
+}
+
+func (e *PoppitExecutor) Name() string {
+	return PoppitExecutorName
+}
+
+func (e *PoppitExecutor) Execute(ctx context.Context, cmd PoppitCommand) error {
+	payload, err := poppitv1.EncodeCommand(&cmd, e.contentType)
+	if err != nil {
+		return fmt.Errorf("failed to marshal Poppit command: %w", err)
+	}
+	if payload, err = e.cipher.seal(payload); err != nil {
+		return fmt.Errorf("failed to encrypt Poppit command: %w", err)
+	}
+
+	queue := e.queueFor(cmd.Repo)
+	if err := e.redisClient.RPush(ctx, queue, payload).Err(); err != nil {
+		return fmt.Errorf("failed to push to Redis list %s: %w", queue, err)
+	}
+	logDebug("Pushed command for %s onto queue %s", cmd.Repo, queue)
+
+	return nil
+}
+
+// queueFor picks the worker queue for a repository
+func (e *PoppitExecutor) queueFor(repo string) string {
+	if len(e.queues) == 1 {
+		return e.queues[0]
+	}
+	h := fnv.New32a()
+	h.Write([]byte(repo))
+	return e.queues[h.Sum32()%uint32(len(e.queues))]
+}
+
+// WebhookExecutor POSTs commands to an external job runner over HTTPS.
+// The runner reports completion by calling back to the VibeDeploy HTTP server.
+type WebhookExecutor struct {
+	url         string
+	secret      []byte
+	contentType string
+	httpClient  *http.Client
+}
+
+func newWebhookExecutor(config Config, contentType string) (*WebhookExecutor, error) {
+	if config.WebhookURL == "" {
+		return nil, fmt.Errorf("WEBHOOK_URL is required for the %s executor", WebhookExecutorName)
+	}
+	if config.WebhookSecret == "" {
+		return nil, fmt.Errorf("WEBHOOK_SECRET is required for the %s executor", WebhookExecutorName)
+	}
+	if config.HTTPAddr == "" {
+		return nil, fmt.Errorf("HTTP_ADDR is required for the %s executor to receive completion callbacks", WebhookExecutorName)
+	}
+
+	parsed, err := url.Parse(config.WebhookURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WEBHOOK_URL: %w", err)
+	}
+	if parsed.Scheme != "https" {
+		return nil, fmt.Errorf("WEBHOOK_URL must use https, got %q", parsed.Scheme)
+	}
+
+	return &WebhookExecutor{
+		url:         config.WebhookURL,
+		secret:      []byte(config.WebhookSecret),
+		contentType: contentType,
+		httpClient:  &http.Client{Timeout: webhookTimeout},
+	}, nil
+}
+
+func (e *WebhookExecutor) Name() string {
+	return WebhookExecutorName
+}
+
+func (e *WebhookExecutor) Execute(ctx context.Context, cmd PoppitCommand) error {
+	payload, err := poppitv1.EncodeCommand(&cmd, e.contentType)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook command: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", e.contentType)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, signRequest(e.secret, timestamp, payload))
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to POST webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	return nil
+}
+
+// signPayload returns the signature header value for a request body
+func signPayload(secret, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifySignature checks a signature header value in constant time
+func verifySignature(secret, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(signPayload(secret, payload)), []byte(signature))
+}
+
+// signRequest returns the signature header value for a webhook request or callback, which covers the
+// timestamp header as well as the body: the HMAC of "<timestamp>.<body>"
+func signRequest(secret []byte, timestamp string, payload []byte) string {
+	return signPayload(secret, append([]byte(timestamp+"."), payload...))
+}
+
+// verifyRequest checks a webhook request or callback's signature, and that it was signed within
+// signatureTolerance of now
+func verifyRequest(secret []byte, timestamp string, payload []byte, signature string, now time.Time) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing or invalid %s header", TimestampHeader)
+	}
+	skew := now.Sub(time.Unix(seconds, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > signatureTolerance {
+		return fmt.Errorf("timestamp is %s off, more than the %s allowed", skew.Round(time.Second), signatureTolerance)
+	}
+	if !hmac.Equal([]byte(signRequest(secret, timestamp, payload)), []byte(signature)) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
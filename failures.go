@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Failure categories a failed deployment is classified into
+const (
+	FailureGit         = "git"
+	FailureBuild       = "build"
+	FailureCompose     = "compose"
+	FailureHealthCheck = "health_check"
+	FailureTimeout     = "timeout"
+	FailureOther       = "other"
+)
+
+// failureSignaturesKey is a Redis hash of deployment ID to the category the latest step's output points at, so a
+// pipeline that stops after printing an error isn't reported as a mere timeout
+const failureSignaturesKey = "vibedeploy:failures:signatures"
+
+// failurePatterns recognise each category from step output, checked in order: a container that never turns
+// healthy also fails compose, and a build can print git's errors
+var failurePatterns = []struct {
+	category string
+	patterns []*regexp.Regexp
+}{
+	{FailureHealthCheck, []*regexp.Regexp{
+		regexp.MustCompile(`(?i)container \S+ is unhealthy`),
+		regexp.MustCompile(`(?i)dependency failed to start`),
+		regexp.MustCompile(`(?i)health ?check (failed|timed out)`),
+	}},
+	{FailureBuild, []*regexp.Regexp{
+		regexp.MustCompile(`(?i)failed to solve`),
+		regexp.MustCompile(`(?i)did not complete successfully: exit code`),
+		regexp.MustCompile(`(?i)executor failed running`),
+		regexp.MustCompile(`npm ERR!`),
+		regexp.MustCompile(`(?i)error building image`),
+	}},
+	{FailureGit, []*regexp.Regexp{
+		regexp.MustCompile(`^fatal: `),
+		regexp.MustCompile(`(?i)couldn't find remote ref`),
+		regexp.MustCompile(`^CONFLICT \(`),
+		regexp.MustCompile(`(?i)pathspec '.*' did not match`),
+		regexp.MustCompile(`Permission denied \(publickey\)`),
+	}},
+	{FailureCompose, []*regexp.Regexp{
+		regexp.MustCompile(`(?i)no such service`),
+		regexp.MustCompile(`(?i)yaml: line \d+`),
+		regexp.MustCompile(`(?i)no configuration file provided`),
+		regexp.MustCompile(`(?i)port is already allocated|address already in use`),
+		regexp.MustCompile(`(?i)error response from daemon`),
+	}},
+}
+
+// failureHints are the message catalog keys of each category's suggested next step
+var failureHints = map[string]string{
+	FailureGit:         "failure.hint.git",
+	FailureBuild:       "failure.hint.build",
+	FailureCompose:     "failure.hint.compose",
+	FailureHealthCheck: "failure.hint.health_check",
+	FailureTimeout:     "failure.hint.timeout",
+}
+
+// matchFailure returns the category the output points at, or ""
+func matchFailure(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		for _, category := range failurePatterns {
+			for _, re := range category.patterns {
+				if re.MatchString(line) {
+					return category.category
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// commandFailure returns the category of a step that failed without saying why, from the step itself
+func commandFailure(command string) string {
+	switch {
+	case strings.HasPrefix(command, "git "):
+		return FailureGit
+	case isBuildCommand(command):
+		return FailureBuild
+	case strings.HasPrefix(command, "docker compose "):
+		return FailureCompose
+	}
+	return ""
+}
+
+// isBuildCommand reports whether a step builds the images
+func isBuildCommand(command string) bool {
+	return strings.HasPrefix(command, "docker compose build") || strings.HasPrefix(command, "docker build")
+}
+
+// classifyFailure returns the category of a failure, from what the failing step printed, else the reason it
+// was failed with
+func classifyFailure(reason, signature string) string {
+	if signature != "" {
+		return signature
+	}
+	if category := matchFailure(reason); category != "" {
+		return category
+	}
+	if strings.Contains(reason, "timed out") {
+		return FailureTimeout
+	}
+	return FailureOther
+}
+
+// recordFailureSignature notes the category a step's output points at, or forgets the last one's if it points
+// at none, so only the step the pipeline stopped at counts
+func (a *App) recordFailureSignature(ctx context.Context, output CommandOutput) {
+	if output.Metadata == nil || output.Metadata.DeploymentID == "" {
+		return
+	}
+	var err error
+	if category := matchFailure(output.Output); category != "" {
+		logDebug("Output of %q for deployment %s looks like a %s failure", output.Command, output.Metadata.DeploymentID, category)
+		err = a.redisClient.HSet(ctx, failureSignaturesKey, output.Metadata.DeploymentID, category).Err()
+	} else {
+		err = a.redisClient.HDel(ctx, failureSignaturesKey, output.Metadata.DeploymentID).Err()
+	}
+	if err != nil {
+		logError("Error recording failure signature for deployment %s: %v", output.Metadata.DeploymentID, err)
+	}
+}
+
+// recordFailedStep notes the category of a step that failed on a host executor: what it printed points at, else
+// the step itself
+func (a *App) recordFailedStep(ctx context.Context, output CommandOutput) {
+	category := matchFailure(output.Output)
+	if category == "" {
+		category = commandFailure(output.Command)
+	}
+	if category == "" {
+		return
+	}
+	if err := a.redisClient.HSet(ctx, failureSignaturesKey, output.Metadata.DeploymentID, category).Err(); err != nil {
+		logError("Error recording failure signature for deployment %s: %v", output.Metadata.DeploymentID, err)
+	}
+}
+
+// failureSignature returns the category the deployment's latest step output points at, or ""
+func (a *App) failureSignature(ctx context.Context, id string) string {
+	category, _ := a.redisClient.HGet(ctx, failureSignaturesKey, id).Result()
+	return category
+}
+
+// clearFailureSignature drops a finished deployment's failure signature
+func (a *App) clearFailureSignature(ctx context.Context, id string) {
+	if err := a.redisClient.HDel(ctx, failureSignaturesKey, id).Err(); err != nil {
+		logError("Error clearing failure signature of deployment %s: %v", id, err)
+	}
+}
+
+// failureHint returns the suggested next step for a failure's category, or ""
+func (a *App) failureHint(d *Deployment) string {
+	key, ok := failureHints[d.FailureCategory]
+	if !ok {
+		return ""
+	}
+	return a.messages.text(key, map[string]interface{}{"Repository": d.Repository, "Branch": d.Branch})
+}
+
+// failureCounts counts this instance's failed deployments by category, for /metrics
+var failureCounts = &categoryCounts{counts: make(map[string]int64)}
+
+type categoryCounts struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (c *categoryCounts) inc(category string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[category]++
+}
+
+// writeFailureMetrics writes the failure counters in the Prometheus text format
+func writeFailureMetrics(b *strings.Builder) {
+	b.WriteString("# HELP vibedeploy_deployment_failures_total Failed deployments by failure category.\n")
+	b.WriteString("# TYPE vibedeploy_deployment_failures_total counter\n")
+	failureCounts.mu.Lock()
+	defer failureCounts.mu.Unlock()
+	categories := make([]string, 0, len(failureCounts.counts))
+	for category := range failureCounts.counts {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		fmt.Fprintf(b, "vibedeploy_deployment_failures_total{category=%q} %d\n", category, failureCounts.counts[category])
+	}
+}
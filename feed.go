@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// atomNamespace is the XML namespace of Atom 1.0 documents
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+// AtomFeed is an Atom 1.0 feed of a repository's deployments
+type AtomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []AtomLink  `xml:"link"`
+	Entries []AtomEntry `xml:"entry"`
+}
+
+// AtomLink is an Atom link element
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+// AtomEntry is one deployment in the feed
+type AtomEntry struct {
+	ID       string       `xml:"id"`
+	Title    string       `xml:"title"`
+	Updated  string       `xml:"updated"`
+	Author   *AtomAuthor  `xml:"author,omitempty"`
+	Links    []AtomLink   `xml:"link,omitempty"`
+	Category AtomCategory `xml:"category"`
+	Summary  string       `xml:"summary"`
+}
+
+// AtomAuthor names the person who triggered a deployment
+type AtomAuthor struct {
+	Name string `xml:"name"`
+}
+
+// AtomCategory tags an entry with the deployment status
+type AtomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// buildAtomFeed renders a repository's deployments, newest first, as an Atom feed
+func buildAtomFeed(repo, selfURL string, deployments []*Deployment) *AtomFeed {
+	feed := &AtomFeed{
+		Xmlns:   atomNamespace,
+		ID:      "urn:vibedeploy:repo:" + repo,
+		Title:   "VibeDeploy deployments of " + repo,
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Links:   []AtomLink{{Href: selfURL, Rel: "self"}, {Href: "https://github.com/" + repo}},
+	}
+
+	for i, d := range deployments {
+		updated := d.StartedAt
+		if d.FinishedAt != nil {
+			updated = *d.FinishedAt
+		}
+		if i == 0 {
+			feed.Updated = updated.UTC().Format(time.RFC3339)
+		}
+
+		entry := AtomEntry{
+			ID:       "urn:vibedeploy:deployment:" + d.ID,
+			Title:    feedEntryTitle(d),
+			Updated:  updated.UTC().Format(time.RFC3339),
+			Category: AtomCategory{Term: d.Status},
+			Summary:  feedEntrySummary(d),
+		}
+		if d.TriggeredBy != "" {
+			entry.Author = &AtomAuthor{Name: d.TriggeredBy}
+		}
+		if d.Build.GitSHA != "" {
+			entry.Links = append(entry.Links, AtomLink{Href: fmt.Sprintf("https://github.com/%s/commit/%s", d.Repository, d.Build.GitSHA)})
+		} else if d.PRNumber > 0 {
+			entry.Links = append(entry.Links, AtomLink{Href: fmt.Sprintf("https://github.com/%s/pull/%d", d.Repository, d.PRNumber)})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	return feed
+}
+
+// feedEntryTitle describes a deployment's outcome in one line
+func feedEntryTitle(d *Deployment) string {
+	if workflowOf(d) == WorkflowRestart {
+		switch d.Status {
+		case StatusSucceeded:
+			return fmt.Sprintf("Restarted %s (%s)", d.Repository, d.Branch)
+		case StatusFailed:
+			return fmt.Sprintf("Restart of %s (%s) failed", d.Repository, d.Branch)
+		case StatusCancelled:
+			return fmt.Sprintf("Restart of %s (%s) cancelled", d.Repository, d.Branch)
+		default:
+			return fmt.Sprintf("Restarting %s (%s)", d.Repository, d.Branch)
+		}
+	}
+
+	switch d.Status {
+	case StatusSucceeded:
+		return fmt.Sprintf("Deployed %s (%s)", d.Repository, d.Branch)
+	case StatusFailed:
+		return fmt.Sprintf("Deployment of %s (%s) failed", d.Repository, d.Branch)
+	case StatusCancelled:
+		return fmt.Sprintf("Deployment of %s (%s) cancelled", d.Repository, d.Branch)
+	default:
+		return fmt.Sprintf("Deploying %s (%s)", d.Repository, d.Branch)
+	}
+}
+
+// feedEntrySummary lists the details of a deployment as plain text
+func feedEntrySummary(d *Deployment) string {
+	lines := []string{"Status: " + d.Status, "Branch: " + d.Branch}
+	if d.PRNumber > 0 {
+		lines = append(lines, "Pull request: #"+strconv.Itoa(d.PRNumber))
+	}
+	if d.Build.GitSHA != "" {
+		lines = append(lines, "Commit: "+d.Build.GitSHA)
+	}
+	if d.TriggeredBy != "" {
+		lines = append(lines, "Triggered by: "+d.TriggeredBy)
+	}
+	lines = append(lines, "Started: "+d.StartedAt.UTC().Format(time.RFC3339))
+	if d.FinishedAt != nil {
+		lines = append(lines, "Finished: "+d.FinishedAt.UTC().Format(time.RFC3339))
+	}
+	if d.FailureReason != "" {
+		lines = append(lines, "Reason: "+d.FailureReason)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// handleDeploymentFeed serves a repository's recent deployments as an Atom feed
+func (a *App) handleDeploymentFeed(w http.ResponseWriter, r *http.Request) {
+	repo := r.URL.Query().Get("repo")
+	if repo == "" {
+		http.Error(w, "repo query parameter is required", http.StatusBadRequest)
+		return
+	}
+	if !a.authorizeRequest(w, r, ActionView, repo) {
+		return
+	}
+
+	deployments, err := a.deployments.List(r.Context(), repo, defaultHistoryLimit)
+	if err != nil {
+		logError("Error listing deployments for %s feed: %v", repo, err)
+		http.Error(w, "failed to list deployments", http.StatusInternalServerError)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	selfURL := fmt.Sprintf("%s://%s%s", scheme, r.Host, r.URL.RequestURI())
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	if err := xml.NewEncoder(w).Encode(buildAtomFeed(repo, selfURL, deployments)); err != nil {
+		logError("Error encoding deployment feed: %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// flagsKey is the Redis hash of feature flag overrides, keyed by flag name
+const flagsKey = "vibedeploy:flags"
+
+// Feature flags gating behaviors that can be rolled out gradually
+const (
+	FlagFailureThreadReplies = "failure_thread_replies"
+	FlagRepoChannelSummaries = "repo_channel_summaries"
+	FlagThreadLogs           = "thread_logs"
+)
+
+// knownFlags lists every flag with its default when neither the config file nor Redis sets it
+var knownFlags = map[string]bool{
+	FlagFailureThreadReplies: true,
+	FlagRepoChannelSummaries: true,
+	FlagThreadLogs:           true,
+}
+
+// FlagRule decides where a flag is on. Enabled turns it on everywhere; otherwise it is only on
+// for the listed repositories (names or path.Match patterns) and users.
+type FlagRule struct {
+	Enabled bool     `yaml:"enabled" json:"enabled"`
+	Repos   []string `yaml:"repos" json:"repos,omitempty"`
+	Users   []string `yaml:"users" json:"users,omitempty"`
+}
+
+// evaluate applies the rule to a repository and user; either may be empty
+func (r FlagRule) evaluate(repo, user string) bool {
+	if r.Enabled {
+		return true
+	}
+	if repo != "" && len(r.Repos) > 0 && matchesAny(r.Repos, repo) {
+		return true
+	}
+	return user != "" && containsString(r.Users, user)
+}
+
+// flagRule returns the rule in effect for a flag: a Redis override, then the config file, then nil for the default
+func (a *App) flagRule(ctx context.Context, name string) (*FlagRule, error) {
+	payload, err := a.redisClient.HGet(ctx, flagsKey, name).Bytes()
+	if err == nil {
+		var rule FlagRule
+		if err := json.Unmarshal(payload, &rule); err != nil {
+			return nil, fmt.Errorf("invalid Redis override for flag %s: %w", name, err)
+		}
+		return &rule, nil
+	}
+	if !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("failed to read flag %s: %w", name, err)
+	}
+
+	if a.reposConfig != nil {
+		if rule, ok := a.reposConfig.FeatureFlags[name]; ok {
+			return &rule, nil
+		}
+	}
+	return nil, nil
+}
+
+// flagEnabled reports whether a feature flag is on for a repository and user.
+// Errors fall back to the flag's default so a Redis blip doesn't flip behavior.
+func (a *App) flagEnabled(ctx context.Context, name, repo, user string) bool {
+	rule, err := a.flagRule(ctx, name)
+	if err != nil {
+		logWarn("Error evaluating feature flag %s, using default: %v", name, err)
+	}
+	if rule == nil {
+		return knownFlags[name]
+	}
+	return rule.evaluate(repo, user)
+}
+
+// validateFeatureFlags rejects unknown flag names so typos in config don't silently do nothing
+func validateFeatureFlags(flags map[string]FlagRule) error {
+	for name := range flags {
+		if _, ok := knownFlags[name]; !ok {
+			return fmt.Errorf("unknown feature flag %q (known flags: %s)", name, strings.Join(knownFlagNames(), ", "))
+		}
+	}
+	return nil
+}
+
+func knownFlagNames() []string {
+	names := make([]string, 0, len(knownFlags))
+	for name := range knownFlags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// setFlagOverride stores a rule in Redis, taking precedence over the config file on every instance
+func setFlagOverride(ctx context.Context, redisClient *redis.Client, name string, rule FlagRule) error {
+	if _, ok := knownFlags[name]; !ok {
+		return fmt.Errorf("unknown feature flag %q (known flags: %s)", name, strings.Join(knownFlagNames(), ", "))
+	}
+	payload, err := json.Marshal(rule)
+	if err != nil {
+		return fmt.Errorf("failed to marshal flag rule: %w", err)
+	}
+	if err := redisClient.HSet(ctx, flagsKey, name, payload).Err(); err != nil {
+		return fmt.Errorf("failed to store flag %s: %w", name, err)
+	}
+	return nil
+}
+
+// clearFlagOverride removes a Redis override so the config file or default applies again
+func clearFlagOverride(ctx context.Context, redisClient *redis.Client, name string) error {
+	if err := redisClient.HDel(ctx, flagsKey, name).Err(); err != nil {
+		return fmt.Errorf("failed to clear flag %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Flag services deployments can check and toggle flags in
+const (
+	LaunchDarklyServiceName = "launchdarkly"
+	UnleashServiceName      = "unleash"
+)
+
+// defaultLaunchDarklyURL is LaunchDarkly's API unless flag_service sets a relay or federal instance
+const defaultLaunchDarklyURL = "https://app.launchdarkly.com"
+
+// PR labels that name flags: FlagRequireLabelPrefix must exist, the others are turned on or off once deployed
+const (
+	FlagRequireLabelPrefix = "flag:"
+	FlagEnableLabelPrefix  = "flag-on:"
+	FlagDisableLabelPrefix = "flag-off:"
+)
+
+// What a deployment did with a flag
+const (
+	FlagActionVerified = "verified"
+	FlagActionEnabled  = "enabled"
+	FlagActionDisabled = "disabled"
+)
+
+// errFlagNotFound is returned by flag services for flags that don't exist
+var errFlagNotFound = errors.New("flag not found")
+
+var flagServiceHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// FlagServiceConfig is the flag_service section of the repos config file: the LaunchDarkly or Unleash
+// instance deployments check and toggle flags in
+type FlagServiceConfig struct {
+	// Provider is launchdarkly or unleash
+	Provider string `yaml:"provider"`
+	// URL is the API's address; required for Unleash, and https://app.launchdarkly.com by default
+	URL string `yaml:"url"`
+	// TokenSecret names an API access token (LaunchDarkly) or admin token (Unleash) in the secrets provider
+	TokenSecret string `yaml:"token_secret"`
+	// Project holds the flags (default: default)
+	Project string `yaml:"project"`
+	// Environment is the flag environment of deployments without one of their own, e.g. production
+	Environment string `yaml:"environment"`
+}
+
+func (c *FlagServiceConfig) validate() error {
+	switch c.Provider {
+	case LaunchDarklyServiceName, UnleashServiceName:
+	default:
+		return fmt.Errorf("unknown flag_service provider %q (expected %s or %s)", c.Provider, LaunchDarklyServiceName, UnleashServiceName)
+	}
+	if c.URL == "" && c.Provider == UnleashServiceName {
+		return fmt.Errorf("flag_service provider %s needs url", UnleashServiceName)
+	}
+	if c.URL != "" {
+		u, err := url.Parse(c.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("flag_service url %q must be an http(s) URL", c.URL)
+		}
+	}
+	if c.TokenSecret == "" || c.Environment == "" {
+		return fmt.Errorf("flag_service needs token_secret and environment")
+	}
+	return nil
+}
+
+// FlagsConfig is the flags section of a repository's settings
+type FlagsConfig struct {
+	// Require are flags that must exist before the repository deploys, such as its kill switch
+	Require []string `yaml:"require"`
+	// Labels also reads flags from the PR's flag:, flag-on: and flag-off: labels
+	Labels bool `yaml:"labels"`
+	// Environments maps environments of the promotion chain to the flag service's environments
+	Environments map[string]string `yaml:"environments"`
+}
+
+// FlagState is a flag's state in the deployment's environment, and what the deployment did with it
+type FlagState struct {
+	Name   string `json:"name"`
+	On     bool   `json:"on"`
+	Action string `json:"action"`
+	// Error is why the flag couldn't be toggled
+	Error string `json:"error,omitempty"`
+}
+
+// FlagService reads and toggles flags of one project
+type FlagService interface {
+	Name() string
+	// Flag returns whether a flag is on in an environment, or errFlagNotFound
+	Flag(ctx context.Context, name, environment string) (bool, error)
+	Set(ctx context.Context, name, environment string, on bool, comment string) error
+}
+
+// flagService returns the configured flag service, or nil without one
+func (a *App) flagService(ctx context.Context) (FlagService, error) {
+	if a.reposConfig == nil || a.reposConfig.FlagService == nil {
+		return nil, nil
+	}
+	config := a.reposConfig.FlagService
+	token, err := a.secrets.Secret(ctx, config.TokenSecret)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve the %s token from the %s secrets provider: %w", config.Provider, a.secrets.Name(), err)
+	}
+	project := config.Project
+	if project == "" {
+		project = "default"
+	}
+	baseURL := strings.TrimRight(config.URL, "/")
+	if config.Provider == LaunchDarklyServiceName {
+		if baseURL == "" {
+			baseURL = defaultLaunchDarklyURL
+		}
+		return &LaunchDarklyService{url: baseURL, project: project, token: token}, nil
+	}
+	return &UnleashService{url: baseURL, project: project, token: token}, nil
+}
+
+// flagEnvironment is the flag service environment a deployment environment toggles flags in
+func (a *App) flagEnvironment(config *FlagsConfig, environment string) string {
+	if mapped, ok := config.Environments[environment]; ok {
+		return mapped
+	}
+	return a.reposConfig.FlagService.Environment
+}
+
+// deploymentFlags returns the flags a deployment checks and the state each should be left in: nil to verify only
+func (a *App) deploymentFlags(ctx context.Context, metadata *PRMetadata, config *FlagsConfig) map[string]*bool {
+	flags := make(map[string]*bool)
+	for _, name := range config.Require {
+		flags[name] = nil
+	}
+	if !config.Labels || a.github == nil || metadata.PRNumber == 0 {
+		return flags
+	}
+	labels, err := a.github.pullRequestLabels(ctx, metadata.Repository, metadata.PRNumber)
+	if err != nil {
+		logError("Error reading labels of %s#%d, ignoring flag labels: %v", metadata.Repository, metadata.PRNumber, err)
+		return flags
+	}
+	on, off := true, false
+	for _, label := range labels {
+		switch {
+		case strings.HasPrefix(label, FlagEnableLabelPrefix):
+			flags[strings.TrimPrefix(label, FlagEnableLabelPrefix)] = &on
+		case strings.HasPrefix(label, FlagDisableLabelPrefix):
+			flags[strings.TrimPrefix(label, FlagDisableLabelPrefix)] = &off
+		case strings.HasPrefix(label, FlagRequireLabelPrefix):
+			if _, ok := flags[strings.TrimPrefix(label, FlagRequireLabelPrefix)]; !ok {
+				flags[strings.TrimPrefix(label, FlagRequireLabelPrefix)] = nil
+			}
+		}
+	}
+	delete(flags, "")
+	return flags
+}
+
+// checkFlags verifies that every flag a deployment names exists, returning ErrDeploymentDeclined for missing ones.
+// The flags to toggle are recorded as pending and turned on or off once the deployment succeeds. As with label
+// rules, a flag service that can't be reached is logged and doesn't stop deployments.
+func (a *App) checkFlags(ctx context.Context, metadata *PRMetadata, repoConfig RepoConfig, environment string) ([]FlagState, error) {
+	config := repoConfig.Flags
+	if config == nil {
+		return nil, nil
+	}
+	flags := a.deploymentFlags(ctx, metadata, config)
+	if len(flags) == 0 {
+		return nil, nil
+	}
+	service, err := a.flagService(ctx)
+	if err != nil {
+		logError("Error checking flags of %s, ignoring them: %v", metadata.Repository, err)
+		return nil, nil
+	}
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	flagEnvironment := a.flagEnvironment(config, environment)
+	var states []FlagState
+	var missing []string
+	for _, name := range names {
+		on, err := service.Flag(ctx, name, flagEnvironment)
+		if errors.Is(err, errFlagNotFound) {
+			missing = append(missing, "`"+name+"`")
+			continue
+		}
+		if err != nil {
+			logError("Error reading flag %s from %s, ignoring it: %v", name, service.Name(), err)
+			continue
+		}
+		state := FlagState{Name: name, On: on, Action: FlagActionVerified}
+		if want := flags[name]; want != nil && *want != on {
+			state.Action = FlagActionDisabled
+			if *want {
+				state.Action = FlagActionEnabled
+			}
+		}
+		states = append(states, state)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s has no flag %s in %s", ErrDeploymentDeclined, service.Name(), strings.Join(missing, ", "), flagEnvironment)
+	}
+	return states, nil
+}
+
+// toggleFlags turns on or off the flags a successful deployment's PR asked for, recording their new state
+func (a *App) toggleFlags(ctx context.Context, d *Deployment) *Deployment {
+	config := a.repoConfig(d.Repository).Flags
+	pending := false
+	for _, state := range d.Flags {
+		pending = pending || state.Action != FlagActionVerified
+	}
+	if config == nil || !pending {
+		return d
+	}
+	service, err := a.flagService(ctx)
+	if err != nil {
+		logError("Error toggling flags of deployment %s: %v", d.ID, err)
+		return d
+	}
+
+	flagEnvironment := a.flagEnvironment(config, d.Environment)
+	states := make([]FlagState, len(d.Flags))
+	var failed []string
+	for i, state := range d.Flags {
+		if state.Action != FlagActionVerified {
+			on := state.Action == FlagActionEnabled
+			comment := fmt.Sprintf("VibeDeploy deployment %s of %s", d.ID, d.Repository)
+			if d.PRNumber != 0 {
+				comment += fmt.Sprintf("#%d", d.PRNumber)
+			}
+			if err := service.Set(ctx, state.Name, flagEnvironment, on, comment); err != nil {
+				logError("Error turning %s flag %s for deployment %s: %v", map[bool]string{true: "on", false: "off"}[on], state.Name, d.ID, err)
+				state.Error = err.Error()
+				failed = append(failed, "`"+state.Name+"`")
+			} else {
+				state.On = on
+				logInfo("Turned %s flag %s in %s for deployment %s", map[bool]string{true: "on", false: "off"}[on], state.Name, flagEnvironment, d.ID)
+			}
+		}
+		states[i] = state
+	}
+	if len(failed) > 0 {
+		text := a.messages.text("flags.failed", map[string]interface{}{"Service": service.Name(), "Flags": strings.Join(failed, ", ")})
+		if err := a.postThreadMessage(ctx, d.Channel, d.Ts, text); err != nil {
+			logError("Error posting flag notice for deployment %s: %v", d.ID, err)
+		}
+	}
+
+	updated, err := updateDeployment(ctx, a.deployments, d.ID, func(d *Deployment) {
+		d.Flags = states
+	})
+	if err != nil {
+		logError("Error recording flags of deployment %s: %v", d.ID, err)
+		return d
+	}
+	return updated
+}
+
+// formatFlags describes a deployment's flags for its summary, e.g. "`checkout-kill-switch` off, `new-checkout` turned on"
+func formatFlags(states []FlagState) string {
+	parts := make([]string, 0, len(states))
+	for _, state := range states {
+		part := "`" + state.Name + "` "
+		switch {
+		case state.Error != "":
+			part += "could not be " + map[bool]string{true: "turned on", false: "turned off"}[state.Action == FlagActionEnabled]
+		case state.Action == FlagActionEnabled:
+			part += "turned on"
+		case state.Action == FlagActionDisabled:
+			part += "turned off"
+		case state.On:
+			part += "on"
+		default:
+			part += "off"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// flagServiceRequest sends a request to a flag service's API and decodes the response into out, if given
+func flagServiceRequest(ctx context.Context, method, endpoint, contentType, token string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	// Both services take the bare token
+	req.Header.Set("Authorization", token)
+
+	resp, err := flagServiceHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", req.URL.Host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errFlagNotFound
+	}
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s returned %s: %s", req.URL.Host, resp.Status, strings.TrimSpace(string(message)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// LaunchDarklyService uses LaunchDarkly's REST API, toggling with semantic patches
+type LaunchDarklyService struct {
+	url     string
+	project string
+	token   string
+}
+
+func (s *LaunchDarklyService) Name() string {
+	return LaunchDarklyServiceName
+}
+
+func (s *LaunchDarklyService) flagURL(name string) string {
+	return s.url + "/api/v2/flags/" + url.PathEscape(s.project) + "/" + url.PathEscape(name)
+}
+
+func (s *LaunchDarklyService) Flag(ctx context.Context, name, environment string) (bool, error) {
+	var flag struct {
+		Environments map[string]struct {
+			On bool `json:"on"`
+		} `json:"environments"`
+	}
+	if err := flagServiceRequest(ctx, http.MethodGet, s.flagURL(name)+"?env="+url.QueryEscape(environment), "", s.token, nil, &flag); err != nil {
+		return false, err
+	}
+	env, ok := flag.Environments[environment]
+	if !ok {
+		return false, errFlagNotFound
+	}
+	return env.On, nil
+}
+
+func (s *LaunchDarklyService) Set(ctx context.Context, name, environment string, on bool, comment string) error {
+	kind := "turnFlagOff"
+	if on {
+		kind = "turnFlagOn"
+	}
+	patch := map[string]interface{}{
+		"environmentKey": environment,
+		"comment":        comment,
+		"instructions":   []map[string]string{{"kind": kind}},
+	}
+	return flagServiceRequest(ctx, http.MethodPatch, s.flagURL(name), "application/json; domain-model=launchdarkly.semanticpatch", s.token, patch, nil)
+}
+
+// UnleashService uses Unleash's admin API
+type UnleashService struct {
+	url     string
+	project string
+	token   string
+}
+
+func (s *UnleashService) Name() string {
+	return UnleashServiceName
+}
+
+func (s *UnleashService) featureURL(name string) string {
+	return s.url + "/api/admin/projects/" + url.PathEscape(s.project) + "/features/" + url.PathEscape(name)
+}
+
+func (s *UnleashService) Flag(ctx context.Context, name, environment string) (bool, error) {
+	var feature struct {
+		Environments []struct {
+			Name    string `json:"name"`
+			Enabled bool   `json:"enabled"`
+		} `json:"environments"`
+	}
+	if err := flagServiceRequest(ctx, http.MethodGet, s.featureURL(name), "", s.token, nil, &feature); err != nil {
+		return false, err
+	}
+	for _, env := range feature.Environments {
+		if env.Name == environment {
+			return env.Enabled, nil
+		}
+	}
+	return false, errFlagNotFound
+}
+
+// Set toggles the feature in the environment. Unleash records who toggled it against the token, so the
+// comment goes unused.
+func (s *UnleashService) Set(ctx context.Context, name, environment string, on bool, comment string) error {
+	state := "off"
+	if on {
+		state = "on"
+	}
+	return flagServiceRequest(ctx, http.MethodPost, s.featureURL(name)+"/environments/"+url.PathEscape(environment)+"/"+state, "", s.token, nil, nil)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// GateReaction marks a deployment declined because the PR isn't ready
+const GateReaction = "construction"
+
+// GateConfig is the gate section of a repository's settings
+type GateConfig struct {
+	// RejectDrafts declines to deploy draft pull requests
+	RejectDrafts bool `yaml:"reject_drafts"`
+	// RequiredChecks are check run names or commit status contexts that must have passed
+	RequiredChecks []string `yaml:"required_checks"`
+}
+
+// pullRequest is the subset of GitHub's pull request fields VibeDeploy uses
+type pullRequest struct {
+	Title string `json:"title"`
+	Draft bool   `json:"draft"`
+	Head  struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+		// Repo is the repository the head branch lives in, which differs from the base for forks; null once deleted
+		Repo *struct {
+			FullName string `json:"full_name"`
+		} `json:"repo"`
+	} `json:"head"`
+	Base struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+	User struct {
+		Login string `json:"login"`
+	} `json:"user"`
+}
+
+func (g *GitHubApp) pullRequest(ctx context.Context, repo string, number int) (*pullRequest, error) {
+	token, err := g.token(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	var pr pullRequest
+	if err := g.do(ctx, token, http.MethodGet, "/repos/"+repo+"/pulls/"+strconv.Itoa(number), nil, &pr); err != nil {
+		return nil, fmt.Errorf("failed to get #%d: %w", number, err)
+	}
+	return &pr, nil
+}
+
+// checkStates returns the state of every check run and commit status on a ref, keyed by name.
+// A check run's state is its conclusion once completed, otherwise its status.
+func (g *GitHubApp) checkStates(ctx context.Context, repo, ref string) (map[string]string, error) {
+	token, err := g.token(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	var runs struct {
+		CheckRuns []struct {
+			Name       string `json:"name"`
+			Status     string `json:"status"`
+			Conclusion string `json:"conclusion"`
+		} `json:"check_runs"`
+	}
+	if err := g.do(ctx, token, http.MethodGet, "/repos/"+repo+"/commits/"+ref+"/check-runs?per_page=100", nil, &runs); err != nil {
+		return nil, fmt.Errorf("failed to list check runs: %w", err)
+	}
+	var combined struct {
+		Statuses []struct {
+			Context string `json:"context"`
+			State   string `json:"state"`
+		} `json:"statuses"`
+	}
+	if err := g.do(ctx, token, http.MethodGet, "/repos/"+repo+"/commits/"+ref+"/status", nil, &combined); err != nil {
+		return nil, fmt.Errorf("failed to get commit statuses: %w", err)
+	}
+
+	states := make(map[string]string)
+	for _, status := range combined.Statuses {
+		states[status.Context] = status.State
+	}
+	for _, run := range runs.CheckRuns {
+		if run.Status == "completed" {
+			states[run.Name] = run.Conclusion
+		} else {
+			states[run.Name] = run.Status
+		}
+	}
+	return states, nil
+}
+
+// checkPassed reports whether a check run conclusion or commit status state counts as green
+func checkPassed(state string) bool {
+	switch state {
+	case "success", "neutral", "skipped":
+		return true
+	}
+	return false
+}
+
+// checkGate returns ErrDeploymentDeclined if the PR is a draft or a required check hasn't passed.
+// Unlike label rules, the gate declines when GitHub can't be asked, since it exists to keep red builds out.
+func (a *App) checkGate(ctx context.Context, metadata *PRMetadata, gate *GateConfig) error {
+	if gate == nil || a.github == nil || (!gate.RejectDrafts && len(gate.RequiredChecks) == 0) {
+		return nil
+	}
+
+	ref := metadata.Branch
+	if metadata.PRNumber != 0 {
+		pr, err := a.github.pullRequest(ctx, metadata.Repository, metadata.PRNumber)
+		if err != nil {
+			return fmt.Errorf("%w: could not check %s#%d: %v", ErrDeploymentDeclined, metadata.Repository, metadata.PRNumber, err)
+		}
+		if gate.RejectDrafts && pr.Draft {
+			return fmt.Errorf("%w: %s#%d is a draft", ErrDeploymentDeclined, metadata.Repository, metadata.PRNumber)
+		}
+		ref = pr.Head.SHA
+	}
+	if len(gate.RequiredChecks) == 0 {
+		return nil
+	}
+
+	states, err := a.github.checkStates(ctx, metadata.Repository, ref)
+	if err != nil {
+		return fmt.Errorf("%w: could not check CI status of %s: %v", ErrDeploymentDeclined, metadata.Branch, err)
+	}
+	var pending []string
+	for _, name := range gate.RequiredChecks {
+		state, ok := states[name]
+		if !ok {
+			state = "missing"
+		}
+		if !checkPassed(state) {
+			pending = append(pending, fmt.Sprintf("`%s` (%s)", name, state))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: required checks on `%s` have not passed: %s", ErrDeploymentDeclined, metadata.Branch, strings.Join(pending, ", "))
+	}
+	return nil
+}
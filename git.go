@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// GitTokenEnvVar carries the HTTPS token to git's credential helper, so it never appears in a command
+const GitTokenEnvVar = "VIBEDEPLOY_GIT_TOKEN"
+
+// defaultGitTokenUsername is the username GitHub expects with an installation or fine-grained token
+const defaultGitTokenUsername = "x-access-token"
+
+// GitConfig is the git section of a repository's settings, for private repositories on hosts without global
+// credentials. It is passed to git through GIT_CONFIG_* environment variables, so the pipeline's commands stay
+// the same and nothing secret is in them.
+type GitConfig struct {
+	// DeployKey is the path of an SSH private key on the executor's host, used for fetches over SSH
+	DeployKey string `yaml:"deploy_key"`
+	// KnownHosts is a known_hosts file for DeployKey, for hosts whose keys aren't in the user's
+	KnownHosts string `yaml:"known_hosts"`
+
+	// TokenSecret is a name looked up in the secrets provider, sent as the password of HTTPS fetches.
+	// SSH remotes of Host are fetched over HTTPS instead, so the token applies to them as well.
+	TokenSecret   string `yaml:"token_secret"`
+	TokenUsername string `yaml:"token_username"`
+	// Host is the git host the token is for (default: github.com)
+	Host string `yaml:"host"`
+
+	// CredentialHelper is a git credential.helper to use, e.g. "store --file /etc/vibedeploy/git-credentials"
+	// or "!gh auth git-credential"
+	CredentialHelper string `yaml:"credential_helper"`
+}
+
+// validate checks that the settings can be passed to git as they are
+func (c *GitConfig) validate() error {
+	if c.DeployKey == "" && c.TokenSecret == "" && c.CredentialHelper == "" {
+		return fmt.Errorf("git needs deploy_key, token_secret or credential_helper")
+	}
+	if c.DeployKey != "" && c.TokenSecret != "" {
+		return fmt.Errorf("git takes deploy_key for SSH remotes or token_secret for HTTPS ones, not both")
+	}
+	for name, path := range map[string]string{"deploy_key": c.DeployKey, "known_hosts": c.KnownHosts} {
+		if path != "" && (!filepath.IsAbs(path) || strings.ContainsAny(path, " \t\n;&|$`'\"\\")) {
+			return fmt.Errorf("git %s must be an absolute path without spaces or quotes, not %q", name, path)
+		}
+	}
+	if c.KnownHosts != "" && c.DeployKey == "" {
+		return fmt.Errorf("git known_hosts only applies with deploy_key")
+	}
+	if c.TokenSecret == "" && (c.TokenUsername != "" || c.Host != "") {
+		return fmt.Errorf("git token_username and host only apply with token_secret")
+	}
+	if strings.ContainsAny(c.TokenUsername+c.Host, " \t\n;&|$`'\"\\/") {
+		return fmt.Errorf("invalid git token_username %q or host %q", c.TokenUsername, c.Host)
+	}
+	if strings.ContainsAny(c.CredentialHelper, "\n") {
+		return fmt.Errorf("git credential_helper must be one line")
+	}
+	return nil
+}
+
+// settings returns the git config the repository's fetches need, in the order git applies it
+func (c *GitConfig) settings() [][2]string {
+	var settings [][2]string
+	if c.DeployKey != "" {
+		command := "ssh -i " + c.DeployKey + " -o IdentitiesOnly=yes"
+		if c.KnownHosts != "" {
+			command += " -o UserKnownHostsFile=" + c.KnownHosts
+		}
+		settings = append(settings, [2]string{"core.sshCommand", command})
+	}
+	// Each helper is asked in turn; an empty one first drops any helper the host's git config sets
+	if c.TokenSecret != "" || c.CredentialHelper != "" {
+		settings = append(settings, [2]string{"credential.helper", ""})
+	}
+	if c.TokenSecret != "" {
+		host, username := c.Host, c.TokenUsername
+		if host == "" {
+			host = "github.com"
+		}
+		if username == "" {
+			username = defaultGitTokenUsername
+		}
+		// The helper reads the token from the environment when git asks for it, so git never prints it
+		helper := fmt.Sprintf(`!f() { test "$1" = get && echo username=%s && echo "password=$%s"; }; f`, username, GitTokenEnvVar)
+		settings = append(settings,
+			[2]string{"credential.https://" + host + ".helper", helper},
+			[2]string{"url.https://" + host + "/.insteadOf", "git@" + host + ":"},
+			[2]string{"url.https://" + host + "/.insteadOf", "ssh://git@" + host + "/"},
+		)
+	}
+	if c.CredentialHelper != "" {
+		settings = append(settings, [2]string{"credential.helper", c.CredentialHelper})
+	}
+	return settings
+}
+
+// gitEnv resolves the repository's git credentials into the environment of its pipeline, or returns nil if it
+// has none. git reads GIT_CONFIG_COUNT and the numbered keys and values as if they were in its config file.
+func (a *App) gitEnv(ctx context.Context, git *GitConfig) (map[string]string, error) {
+	if git == nil {
+		return nil, nil
+	}
+	env := make(map[string]string)
+	settings := git.settings()
+	for i, setting := range settings {
+		env["GIT_CONFIG_KEY_"+strconv.Itoa(i)] = setting[0]
+		env["GIT_CONFIG_VALUE_"+strconv.Itoa(i)] = setting[1]
+	}
+	env["GIT_CONFIG_COUNT"] = strconv.Itoa(len(settings))
+	// Nobody can answer a prompt, so a missing credential fails the fetch instead of hanging it
+	env["GIT_TERMINAL_PROMPT"] = "0"
+	if git.TokenSecret != "" {
+		token, err := a.secrets.Secret(ctx, git.TokenSecret)
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve git credentials from the %s secrets provider: %w", a.secrets.Name(), err)
+		}
+		env[GitTokenEnvVar] = token
+	}
+	return env, nil
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// checkRunName is the name of the check run VibeDeploy reports on the PR head commit
+const checkRunName = "VibeDeploy"
+
+// GitHubApp authenticates as a GitHub App to report check runs on deployed commits
+type GitHubApp struct {
+	appID      string
+	key        *rsa.PrivateKey
+	apiURL     string
+	httpClient *http.Client
+
+	mu            sync.Mutex
+	installations map[string]int64 // repository owner -> installation ID
+	tokens        map[int64]installationToken
+}
+
+type installationToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+// newGitHubApp returns nil when no GitHub App is configured
+func newGitHubApp(config Config) (*GitHubApp, error) {
+	if config.GitHubAppID == "" {
+		return nil, nil
+	}
+	if config.GitHubAppPrivateKey == "" {
+		return nil, fmt.Errorf("GITHUB_APP_PRIVATE_KEY is required when GITHUB_APP_ID is set")
+	}
+
+	data, err := os.ReadFile(config.GitHubAppPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GitHub App private key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %s", config.GitHubAppPrivateKey)
+	}
+	// GitHub issues PKCS #1 keys, but accept PKCS #8 too
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, err8 := x509.ParsePKCS8PrivateKey(block.Bytes)
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if err8 != nil || !ok {
+			return nil, fmt.Errorf("failed to parse GitHub App private key: %w", err)
+		}
+		key = rsaKey
+	}
+
+	return &GitHubApp{
+		appID:         config.GitHubAppID,
+		key:           key,
+		apiURL:        strings.TrimSuffix(config.GitHubAPIURL, "/"),
+		httpClient:    &http.Client{Timeout: 15 * time.Second},
+		installations: make(map[string]int64),
+		tokens:        make(map[int64]installationToken),
+	}, nil
+}
+
+// appJWT returns a short-lived RS256 JWT identifying the app itself
+func (g *GitHubApp) appJWT() (string, error) {
+	now := time.Now()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		// Backdated to allow for clock drift, as GitHub recommends
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": g.appID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, g.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GitHub App JWT: %w", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// token returns an installation access token for the installation covering the repository
+func (g *GitHubApp) token(ctx context.Context, repo string) (string, error) {
+	owner, _, _ := strings.Cut(repo, "/")
+
+	g.mu.Lock()
+	installationID, known := g.installations[owner]
+	cached := g.tokens[installationID]
+	g.mu.Unlock()
+	if known && time.Until(cached.expiresAt) > time.Minute {
+		return cached.token, nil
+	}
+
+	jwt, err := g.appJWT()
+	if err != nil {
+		return "", err
+	}
+	if !known {
+		var installation struct {
+			ID int64 `json:"id"`
+		}
+		if err := g.do(ctx, jwt, http.MethodGet, "/repos/"+repo+"/installation", nil, &installation); err != nil {
+			return "", fmt.Errorf("failed to find GitHub App installation for %s: %w", repo, err)
+		}
+		installationID = installation.ID
+	}
+
+	var issued struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := g.do(ctx, jwt, http.MethodPost, "/app/installations/"+strconv.FormatInt(installationID, 10)+"/access_tokens", nil, &issued); err != nil {
+		return "", fmt.Errorf("failed to create installation token: %w", err)
+	}
+
+	g.mu.Lock()
+	g.installations[owner] = installationID
+	g.tokens[installationID] = installationToken{token: issued.Token, expiresAt: issued.ExpiresAt}
+	g.mu.Unlock()
+	return issued.Token, nil
+}
+
+// do sends a GitHub REST API request and decodes the JSON response into out
+func (g *GitHubApp) do(ctx context.Context, bearer, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request body: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, g.apiURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+bearer)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call GitHub: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("GitHub returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode GitHub response: %w", err)
+	}
+	return nil
+}
+
+// CheckRun is the subset of the GitHub check run fields VibeDeploy sets
+type CheckRun struct {
+	Name        string          `json:"name,omitempty"`
+	HeadSHA     string          `json:"head_sha,omitempty"`
+	Status      string          `json:"status"`
+	Conclusion  string          `json:"conclusion,omitempty"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	CompletedAt *time.Time      `json:"completed_at,omitempty"`
+	DetailsURL  string          `json:"details_url,omitempty"`
+	ExternalID  string          `json:"external_id,omitempty"`
+	Output      *CheckRunOutput `json:"output,omitempty"`
+}
+
+// CheckRunOutput is the title and markdown summary shown on the check run
+type CheckRunOutput struct {
+	Title   string `json:"title"`
+	Summary string `json:"summary"`
+}
+
+// createCheckRun creates a check run and returns its ID
+func (g *GitHubApp) createCheckRun(ctx context.Context, repo string, run CheckRun) (int64, error) {
+	token, err := g.token(ctx, repo)
+	if err != nil {
+		return 0, err
+	}
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	if err := g.do(ctx, token, http.MethodPost, "/repos/"+repo+"/check-runs", run, &created); err != nil {
+		return 0, fmt.Errorf("failed to create check run: %w", err)
+	}
+	return created.ID, nil
+}
+
+// updateCheckRun updates an existing check run
+func (g *GitHubApp) updateCheckRun(ctx context.Context, repo string, id int64, run CheckRun) error {
+	token, err := g.token(ctx, repo)
+	if err != nil {
+		return err
+	}
+	if err := g.do(ctx, token, http.MethodPatch, "/repos/"+repo+"/check-runs/"+strconv.FormatInt(id, 10), run, nil); err != nil {
+		return fmt.Errorf("failed to update check run: %w", err)
+	}
+	return nil
+}
+
+// startCheckRun reports an in-progress check run once the deployed commit is known
+func (a *App) startCheckRun(ctx context.Context, d *Deployment) {
+	if a.github == nil || d.Build.GitSHA == "" || d.CheckRunID != 0 || d.Status != StatusQueued {
+		return
+	}
+
+	run := CheckRun{
+		Name:       checkRunName,
+		HeadSHA:    d.Build.GitSHA,
+		Status:     "in_progress",
+		StartedAt:  &d.StartedAt,
+		DetailsURL: a.deploymentURL(d),
+		ExternalID: d.ID,
+		Output:     &CheckRunOutput{Title: "Deploying " + d.Branch, Summary: a.checkRunSummary(ctx, d)},
+	}
+	id, err := a.github.createCheckRun(ctx, d.Repository, run)
+	if err != nil {
+		logError("Error creating check run for deployment %s: %v", d.ID, err)
+		return
+	}
+
+	if _, err := updateDeployment(ctx, a.deployments, d.ID, func(d *Deployment) {
+		d.CheckRunID = id
+	}); err != nil {
+		logError("Error recording check run for deployment %s: %v", d.ID, err)
+	}
+	logInfo("Created check run %d for deployment %s", id, d.ID)
+}
+
+// completeCheckRun concludes the deployment's check run with its outcome
+func (a *App) completeCheckRun(ctx context.Context, d *Deployment) {
+	if a.github == nil || d.CheckRunID == 0 {
+		return
+	}
+
+	run := CheckRun{Status: "completed", CompletedAt: d.FinishedAt, Conclusion: "success"}
+	title := "Deployed " + d.Branch
+	switch d.Status {
+	case StatusFailed:
+		run.Conclusion = "failure"
+		title = "Deployment of " + d.Branch + " failed"
+	case StatusCancelled:
+		run.Conclusion = "cancelled"
+		title = "Deployment of " + d.Branch + " cancelled"
+	}
+	run.Output = &CheckRunOutput{Title: title, Summary: a.checkRunSummary(ctx, d)}
+
+	if err := a.github.updateCheckRun(ctx, d.Repository, d.CheckRunID, run); err != nil {
+		logError("Error completing check run for deployment %s: %v", d.ID, err)
+		return
+	}
+	logInfo("Completed check run %d for deployment %s as %s", d.CheckRunID, d.ID, run.Conclusion)
+}
+
+// checkRunSummary renders the markdown summary of a deployment for its check run
+func (a *App) checkRunSummary(ctx context.Context, d *Deployment) string {
+	lines := []string{fmt.Sprintf("**Status:** %s", d.Status)}
+	if seconds := deploymentDuration(d); seconds != nil {
+		lines = append(lines, fmt.Sprintf("**Duration:** %s", time.Duration(*seconds)*time.Second))
+	}
+	if d.TriggeredBy != "" {
+		lines = append(lines, fmt.Sprintf("**Triggered by:** %s", d.TriggeredBy))
+	}
+	if d.PreviewURL != "" {
+		lines = append(lines, fmt.Sprintf("**Preview:** %s", d.PreviewURL))
+	}
+	if d.FailureCategory != "" {
+		lines = append(lines, fmt.Sprintf("**Failure (%s):** %s", d.FailureCategory, d.FailureReason))
+	} else if d.FailureReason != "" {
+		lines = append(lines, fmt.Sprintf("**Failure:** %s", d.FailureReason))
+	}
+	if d.Channel != "" {
+		if permalink, err := a.slackClient.GetPermalinkContext(ctx, &slack.PermalinkParameters{Channel: d.Channel, Ts: d.Ts}); err == nil {
+			lines = append(lines, fmt.Sprintf("**Log:** [Slack thread](%s)", permalink))
+		} else {
+			logDebug("Could not get permalink for message %s in channel %s: %v", d.Ts, d.Channel, err)
+		}
+	}
+	if url := a.deploymentURL(d); url != "" {
+		lines = append(lines, fmt.Sprintf("**Record:** [%s](%s)", d.ID, url))
+	}
+	return strings.Join(lines, "\n\n")
+}
+
+// deploymentURL links to the deployment record on the HTTP API, when PUBLIC_URL is set
+func (a *App) deploymentURL(d *Deployment) string {
+	if a.config.PublicURL == "" {
+		return ""
+	}
+	return strings.TrimSuffix(a.config.PublicURL, "/") + "/api/deployments/" + d.ID
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+)
+
+// githubLoginEndpoint returns the OAuth endpoints GitHub serves next to its API; GitHub Enterprise Server
+// serves the API under /api/v3 of the same host
+func githubLoginEndpoint(apiURL string) oauth2.Endpoint {
+	if apiURL == "https://api.github.com" {
+		return github.Endpoint
+	}
+	base := strings.TrimSuffix(apiURL, "/api/v3")
+	return oauth2.Endpoint{
+		AuthURL:  base + "/login/oauth/authorize",
+		TokenURL: base + "/login/oauth/access_token",
+	}
+}
+
+// githubLoginScopes are the OAuth scopes a GitHub login asks for; organisations are only read when
+// OIDC_ALLOWED_GROUPS names some
+func githubLoginScopes(orgs bool) []string {
+	scopes := []string{"read:user", "user:email"}
+	if orgs {
+		scopes = append(scopes, "read:org")
+	}
+	return scopes
+}
+
+// githubIdentity reads the signed-in GitHub user, their primary email address and, when groups are
+// allowed, the logins of their organisations. GitHub issues no ID token, so the API is the source.
+func (o *OIDCAuth) githubIdentity(ctx context.Context, token *oauth2.Token) (*loginIdentity, error) {
+	client := o.oauth.Client(ctx, token)
+
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+	if err := o.githubGet(ctx, client, "/user", &user); err != nil {
+		return nil, err
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := o.githubGet(ctx, client, "/user/emails", &emails); err != nil {
+		return nil, err
+	}
+	identity := &loginIdentity{Subject: "github:" + strconv.FormatInt(user.ID, 10), Name: user.Name}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+	for _, email := range emails {
+		if !email.Primary {
+			continue
+		}
+		if !email.Verified {
+			return nil, errEmailNotVerified
+		}
+		identity.Email = email.Email
+	}
+	if identity.Email == "" {
+		return nil, fmt.Errorf("GitHub user %s has no primary email address", user.Login)
+	}
+
+	if len(o.allowedGroups) > 0 {
+		var orgs []struct {
+			Login string `json:"login"`
+		}
+		if err := o.githubGet(ctx, client, "/user/orgs?per_page=100", &orgs); err != nil {
+			return nil, err
+		}
+		for _, org := range orgs {
+			identity.Groups = append(identity.Groups, org.Login)
+		}
+	}
+	return identity, nil
+}
+
+// githubGet calls the GitHub API as the signed-in user and decodes the JSON response into out
+func (o *OIDCAuth) githubGet(ctx context.Context, client *http.Client, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.githubAPI+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call GitHub: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("GitHub returned %s for %s: %s", resp.Status, path, strings.TrimSpace(string(message)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode GitHub response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	vibedeployv1 "github.com/its-the-vibe/VibeDeploy/proto/vibedeploy/v1"
+)
+
+// watchBlockTimeout bounds each blocking read of the events stream so cancelled watchers exit promptly
+const watchBlockTimeout = 5 * time.Second
+
+// grpcDeploymentServer implements the DeploymentService gRPC API on top of the App
+type grpcDeploymentServer struct {
+	vibedeployv1.UnimplementedDeploymentServiceServer
+	app *App
+}
+
+// newGRPCServer builds a gRPC server that requires and verifies client certificates (mTLS)
+func newGRPCServer(app *App) (*grpc.Server, error) {
+	config := app.config
+	if config.GRPCTLSCert == "" || config.GRPCTLSKey == "" || config.GRPCClientCA == "" {
+		return nil, fmt.Errorf("GRPC_TLS_CERT, GRPC_TLS_KEY and GRPC_CLIENT_CA are required when GRPC_ADDR is set")
+	}
+
+	cert, err := tls.LoadX509KeyPair(config.GRPCTLSCert, config.GRPCTLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load gRPC server certificate: %w", err)
+	}
+
+	caPEM, err := os.ReadFile(config.GRPCClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gRPC client CA: %w", err)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in %s", config.GRPCClientCA)
+	}
+
+	creds := credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	})
+
+	server := grpc.NewServer(grpc.Creds(creds))
+	vibedeployv1.RegisterDeploymentServiceServer(server, &grpcDeploymentServer{app: app})
+	return server, nil
+}
+
+// runGRPCServer serves the gRPC API until the context is cancelled
+func (a *App) runGRPCServer(ctx context.Context, server *grpc.Server) {
+	listener, err := net.Listen("tcp", a.config.GRPCAddr)
+	if err != nil {
+		logError("Failed to listen for gRPC on %s: %v", a.config.GRPCAddr, err)
+		return
+	}
+
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+
+	logInfo("gRPC server listening on %s (mTLS)", a.config.GRPCAddr)
+	if err := server.Serve(listener); err != nil {
+		logError("gRPC server error: %v", err)
+	}
+}
+
+func (s *grpcDeploymentServer) TriggerDeployment(ctx context.Context, req *vibedeployv1.TriggerDeploymentRequest) (*vibedeployv1.TriggerDeploymentResponse, error) {
+	var metadata *PRMetadata
+	switch {
+	case req.GetChannel() != "" && req.GetTs() != "":
+		var err error
+		metadata, err = s.app.messageMetadata(ctx, req.GetChannel(), req.GetTs())
+		if err != nil {
+			return nil, status.Errorf(codes.Unavailable, "failed to read message metadata: %v", err)
+		}
+		if metadata == nil {
+			return nil, status.Error(codes.FailedPrecondition, "message has no PR metadata")
+		}
+	case req.GetRepository() != "" && req.GetBranch() != "":
+		metadata = &PRMetadata{
+			Repository: s.app.canonicalRepo(req.GetRepository()),
+			Branch:     req.GetBranch(),
+			PRNumber:   int(req.GetPrNumber()),
+		}
+	default:
+		return nil, status.Error(codes.InvalidArgument, "either channel and ts, or repository and branch, are required")
+	}
+
+	if !isRepoAllowed(metadata.Repository, s.app.allowedRepos) {
+		return nil, status.Errorf(codes.PermissionDenied, "repository %s is not in the allowed list", metadata.Repository)
+	}
+
+	logInfo("gRPC trigger for %s branch %s by %q", metadata.Repository, metadata.Branch, req.GetTriggeredBy())
+	deployment, err := s.app.startDeployment(ctx, metadata, DeployOptions{}, req.GetChannel(), req.GetTs(), req.GetTriggeredBy())
+	if errors.Is(err, ErrDeploymentDeclined) {
+		return nil, status.Errorf(codes.FailedPrecondition, "%v", err)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "%v", err)
+	}
+
+	return &vibedeployv1.TriggerDeploymentResponse{Deployment: toProtoDeployment(deployment)}, nil
+}
+
+func (s *grpcDeploymentServer) GetStatus(ctx context.Context, req *vibedeployv1.GetStatusRequest) (*vibedeployv1.Deployment, error) {
+	deployment, err := s.app.deployments.Get(ctx, req.GetId())
+	if errors.Is(err, ErrDeploymentNotFound) {
+		return nil, status.Errorf(codes.NotFound, "deployment %s not found", req.GetId())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	return toProtoDeployment(deployment), nil
+}
+
+// WatchDeployments tails the lifecycle events stream and forwards new events to the client
+func (s *grpcDeploymentServer) WatchDeployments(req *vibedeployv1.WatchDeploymentsRequest, stream grpc.ServerStreamingServer[vibedeployv1.DeploymentEvent]) error {
+	ctx := stream.Context()
+	lastID := "$"
+
+	// Each watcher holds a goroutine and a blocking Redis read, so cap how many run at once
+	if n := watcherCount.Add(1); s.app.config.MaxGRPCWatchers > 0 && n > int64(s.app.config.MaxGRPCWatchers) {
+		watcherCount.Add(-1)
+		s.app.shed(ctx, "grpc_watchers", fmt.Sprintf("rejected watcher, %d already connected", n-1))
+		return status.Errorf(codes.ResourceExhausted, "too many watchers (MAX_GRPC_WATCHERS=%d)", s.app.config.MaxGRPCWatchers)
+	}
+	defer watcherCount.Add(-1)
+
+	for {
+		streams, err := s.app.redisClient.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{eventsStreamKey, lastID},
+			Block:   watchBlockTimeout,
+		}).Result()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return status.Errorf(codes.Unavailable, "failed to read events: %v", err)
+		}
+
+		for _, xstream := range streams {
+			for _, msg := range xstream.Messages {
+				lastID = msg.ID
+				event, err := parseLifecycleEvent(msg)
+				if err != nil {
+					logWarn("Skipping lifecycle event for watcher: %v", err)
+					continue
+				}
+				if event.Deployment == nil || (req.GetRepository() != "" && event.Deployment.Repository != req.GetRepository()) {
+					continue
+				}
+				if err := stream.Send(toProtoEvent(event)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// toProtoEvent converts a lifecycle event to its gRPC representation
+func toProtoEvent(event *LifecycleEvent) *vibedeployv1.DeploymentEvent {
+	pb := &vibedeployv1.DeploymentEvent{
+		Id:        event.ID,
+		Type:      event.Type,
+		Timestamp: timestamppb.New(event.Timestamp),
+	}
+	if event.Deployment != nil {
+		pb.Deployment = toProtoDeployment(event.Deployment)
+	}
+	return pb
+}
+
+// toProtoDeployment converts a deployment record to its gRPC representation
+func toProtoDeployment(d *Deployment) *vibedeployv1.Deployment {
+	pb := &vibedeployv1.Deployment{
+		Id:            d.ID,
+		Repository:    d.Repository,
+		Branch:        d.Branch,
+		PrNumber:      int32(d.PRNumber),
+		Channel:       d.Channel,
+		Ts:            d.Ts,
+		Status:        d.Status,
+		StartedAt:     timestamppb.New(d.StartedAt),
+		GitSha:        d.Build.GitSHA,
+		FailureReason: d.FailureReason,
+		TriggeredBy:   d.TriggeredBy,
+	}
+	if d.FinishedAt != nil {
+		pb.FinishedAt = timestamppb.New(*d.FinishedAt)
+	}
+	return pb
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/slack-go/slack"
+)
+
+// HaltReaction engages the kill switch when an admin adds it to any message
+const HaltReaction = "octagonal_sign"
+
+// haltKey holds the kill switch as JSON; it is absent while deployments run normally
+const haltKey = "vibedeploy:halt"
+
+// ErrAlreadyHalted is returned when engaging the kill switch while it is already engaged
+var ErrAlreadyHalted = errors.New("deployments are already halted")
+
+// Halt records who engaged the kill switch and when
+type Halt struct {
+	HaltedBy string    `json:"halted_by"`
+	HaltedAt time.Time `json:"halted_at"`
+}
+
+// activeHalt returns the engaged kill switch, or nil if deployments are running normally
+func (a *App) activeHalt(ctx context.Context) (*Halt, error) {
+	data, err := a.redisClient.Get(ctx, haltKey).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read halt: %w", err)
+	}
+	var halt Halt
+	if err := json.Unmarshal([]byte(data), &halt); err != nil {
+		return nil, fmt.Errorf("failed to parse halt: %w", err)
+	}
+	return &halt, nil
+}
+
+// halted reports whether the kill switch is engaged
+func (a *App) halted(ctx context.Context) bool {
+	halt, err := a.activeHalt(ctx)
+	if err != nil {
+		// Like incident mode, don't stop deploys for everyone because the flag can't be read
+		logError("Error checking the kill switch: %v", err)
+		return false
+	}
+	return halt != nil
+}
+
+// checkHalt returns ErrDeploymentDeclined while the kill switch is engaged
+func (a *App) checkHalt(ctx context.Context) error {
+	halt, err := a.activeHalt(ctx)
+	if err != nil {
+		logError("Error checking the kill switch: %v", err)
+		return nil
+	}
+	if halt == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: VibeDeploy was halted by %s at %s", ErrDeploymentDeclined, formatMention(halt.HaltedBy), halt.HaltedAt.Format(time.RFC1123))
+}
+
+// haltDeployments engages the kill switch so no new deployments or restarts start, optionally cancelling
+// every command VibeDeploy has queued that no worker has picked up yet. It returns how many were purged.
+func (a *App) haltDeployments(ctx context.Context, by string, purge bool) (*Halt, int, error) {
+	halt := &Halt{HaltedBy: by, HaltedAt: time.Now().UTC()}
+	data, err := json.Marshal(halt)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to marshal halt: %w", err)
+	}
+	halted, err := a.redisClient.SetNX(ctx, haltKey, data, 0).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to halt deployments: %w", err)
+	}
+	if !halted {
+		return nil, 0, ErrAlreadyHalted
+	}
+	logWarn("Deployments halted by %s", by)
+
+	if !purge {
+		return halt, 0, nil
+	}
+	entries, err := a.queuedEntries(ctx)
+	if err != nil {
+		return halt, 0, err
+	}
+	purged := 0
+	for _, entry := range entries {
+		// Poppit queues may be shared with other services; leave their commands alone
+		if entry.cmd.Type != VibeDeployType {
+			continue
+		}
+		if _, err := a.cancelQueuedDeployment(ctx, entry.cmd.Metadata.DeploymentID, by); err != nil {
+			if !errors.Is(err, ErrDeploymentNotQueued) {
+				logError("Error purging deployment %s: %v", entry.cmd.Metadata.DeploymentID, err)
+			}
+			continue
+		}
+		purged++
+	}
+	logWarn("Purged %d queued deployments on halt", purged)
+	return halt, purged, nil
+}
+
+// resumeDeployments disengages the kill switch and dispatches deployments that waited for a slot meanwhile
+func (a *App) resumeDeployments(ctx context.Context) (*Halt, error) {
+	halt, err := a.activeHalt(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if halt == nil {
+		return nil, nil
+	}
+	if err := a.redisClient.Del(ctx, haltKey).Err(); err != nil {
+		return nil, fmt.Errorf("failed to resume deployments: %w", err)
+	}
+	logInfo("Deployments resumed after halt by %s", halt.HaltedBy)
+	if a.limiter != nil {
+		a.dispatchPending(ctx)
+	}
+	return halt, nil
+}
+
+// haltAnnouncement is the status message posted when the kill switch is engaged
+func haltAnnouncement(halt *Halt, purged int, purge bool) string {
+	text := fmt.Sprintf(":octagonal_sign: *VibeDeploy is halted.* %s stopped all new deployments and restarts.", formatMention(halt.HaltedBy))
+	if purge {
+		text += fmt.Sprintf(" %d queued deployments were cancelled.", purged)
+	} else {
+		text += " Deployments already queued for Poppit will still run."
+	}
+	return text + " Resume with `resume` once the cause is fixed."
+}
+
+// announceHalt posts a kill switch status message to the ops alert channel, unless it is already being posted there
+func (a *App) announceHalt(ctx context.Context, channel, text string) {
+	if a.config.OpsAlertChannel == "" || a.config.OpsAlertChannel == channel {
+		return
+	}
+	if err := a.postThreadMessage(ctx, a.config.OpsAlertChannel, "", text); err != nil {
+		logError("Error posting kill switch status to %s: %v", a.config.OpsAlertChannel, err)
+	}
+}
+
+// haltFromReaction engages the kill switch for an admin's :octagonal_sign: reaction, posting the status in the reaction's channel
+func (a *App) haltFromReaction(ctx context.Context, user, channel string) {
+	if !a.authorize(a.slackIdentities(ctx, user), ActionAdmin, "", "") {
+		logInfo("User %s may not halt deployments, ignoring reaction", user)
+		return
+	}
+	halt, purged, err := a.haltDeployments(ctx, user, false)
+	if errors.Is(err, ErrAlreadyHalted) {
+		logInfo("Ignoring %s reaction from %s: deployments are already halted", HaltReaction, user)
+		return
+	}
+	if err != nil {
+		logError("Error halting deployments: %v", err)
+		return
+	}
+	text := haltAnnouncement(halt, purged, false)
+	if err := a.postThreadMessage(ctx, channel, "", text); err != nil {
+		logError("Error posting kill switch status to %s: %v", channel, err)
+	}
+	a.announceHalt(ctx, channel, text)
+}
+
+// haltCommand handles `halt`, `halt purge` and `halt status`
+func (a *App) haltCommand(ctx context.Context, command slack.SlashCommand, args []string) *slack.WebhookMessage {
+	if len(args) == 1 && args[0] == "status" {
+		halt, err := a.activeHalt(ctx)
+		if err != nil {
+			logError("Error loading halt: %v", err)
+			return ephemeralReply(":warning: Could not read the kill switch, please try again.")
+		}
+		if halt == nil {
+			return ephemeralReply("Deployments are running normally.")
+		}
+		return ephemeralReply(fmt.Sprintf(":octagonal_sign: Deployments halted since %s by %s.", halt.HaltedAt.Format(time.RFC1123), formatMention(halt.HaltedBy)))
+	}
+	if len(args) > 1 || (len(args) == 1 && args[0] != "purge") {
+		return ephemeralReply("Usage: `halt [purge]` or `halt status`")
+	}
+
+	// The kill switch stops deploys for everyone, so it takes an admin
+	if !a.authorize(a.slackIdentities(ctx, command.UserID), ActionAdmin, "", "") {
+		logInfo("User %s may not halt deployments", command.UserID)
+		return ephemeralReply(":no_entry: You need the admin permission to halt deployments.")
+	}
+
+	purge := len(args) == 1
+	halt, purged, err := a.haltDeployments(ctx, command.UserID, purge)
+	if errors.Is(err, ErrAlreadyHalted) {
+		return ephemeralReply("Deployments are already halted; check `halt status`.")
+	}
+	if err != nil && halt == nil {
+		logError("Error halting deployments: %v", err)
+		return ephemeralReply(":warning: Could not halt deployments, please try again.")
+	}
+	text := haltAnnouncement(halt, purged, purge)
+	if err != nil {
+		logError("Error purging queued deployments: %v", err)
+		text = haltAnnouncement(halt, purged, false) + "\n:warning: The queue could not be purged."
+	}
+	a.announceHalt(ctx, command.ChannelID, text)
+	return channelReply(text)
+}
+
+// resumeCommand handles `resume`
+func (a *App) resumeCommand(ctx context.Context, command slack.SlashCommand) *slack.WebhookMessage {
+	if !a.authorize(a.slackIdentities(ctx, command.UserID), ActionAdmin, "", "") {
+		logInfo("User %s may not resume deployments", command.UserID)
+		return ephemeralReply(":no_entry: You need the admin permission to resume deployments.")
+	}
+	halt, err := a.resumeDeployments(ctx)
+	if err != nil {
+		logError("Error resuming deployments: %v", err)
+		return ephemeralReply(":warning: Could not resume deployments, please try again.")
+	}
+	if halt == nil {
+		return ephemeralReply("Deployments are not halted.")
+	}
+	text := fmt.Sprintf(":white_check_mark: Deployments resumed by %s after a halt of %s.", formatMention(command.UserID), time.Since(halt.HaltedAt).Round(time.Minute))
+	a.announceHalt(ctx, command.ChannelID, text)
+	return channelReply(text)
+}
+
+// FreezeRequest is the body of POST /api/freeze
+type FreezeRequest struct {
+	// HaltedBy is shown in Slack; dashboard sessions are recorded by email instead
+	HaltedBy string `json:"halted_by,omitempty"`
+	// Purge also cancels every queued command no worker has picked up yet
+	Purge bool `json:"purge,omitempty"`
+}
+
+// FreezeStatus is the kill switch as the HTTP API reports it
+type FreezeStatus struct {
+	Frozen   bool       `json:"frozen"`
+	HaltedBy string     `json:"halted_by,omitempty"`
+	HaltedAt *time.Time `json:"halted_at,omitempty"`
+	Purged   int        `json:"purged,omitempty"`
+}
+
+func freezeStatus(halt *Halt) FreezeStatus {
+	if halt == nil {
+		return FreezeStatus{}
+	}
+	return FreezeStatus{Frozen: true, HaltedBy: halt.HaltedBy, HaltedAt: &halt.HaltedAt}
+}
+
+// handleGetFreeze serves GET /api/freeze
+func (a *App) handleGetFreeze(w http.ResponseWriter, r *http.Request) {
+	halt, err := a.activeHalt(r.Context())
+	if err != nil {
+		logError("Error loading halt: %v", err)
+		http.Error(w, "failed to read the kill switch", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, freezeStatus(halt))
+}
+
+// handleFreeze serves POST /api/freeze, engaging the kill switch like `halt`
+func (a *App) handleFreeze(w http.ResponseWriter, r *http.Request) {
+	var req FreezeRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCallbackBodySize)).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+	}
+	if !a.authorizeRequest(w, r, ActionAdmin, "") {
+		return
+	}
+
+	by := req.HaltedBy
+	if principal, _ := r.Context().Value(principalKey{}).(*Principal); principal != nil {
+		by = principal.Name
+	}
+	if by == "" {
+		by = "the HTTP API"
+	}
+
+	halt, purged, err := a.haltDeployments(r.Context(), by, req.Purge)
+	if errors.Is(err, ErrAlreadyHalted) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil && halt == nil {
+		logError("Error halting deployments: %v", err)
+		http.Error(w, "failed to halt deployments", http.StatusInternalServerError)
+		return
+	}
+	text := haltAnnouncement(halt, purged, req.Purge)
+	if err != nil {
+		logError("Error purging queued deployments: %v", err)
+		text = haltAnnouncement(halt, purged, false) + "\n:warning: The queue could not be purged."
+	}
+	a.announceHalt(r.Context(), "", text)
+
+	status := freezeStatus(halt)
+	status.Purged = purged
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleUnfreeze serves DELETE /api/freeze, lifting the kill switch like `resume`
+func (a *App) handleUnfreeze(w http.ResponseWriter, r *http.Request) {
+	if !a.authorizeRequest(w, r, ActionAdmin, "") {
+		return
+	}
+	halt, err := a.resumeDeployments(r.Context())
+	if err != nil {
+		logError("Error resuming deployments: %v", err)
+		http.Error(w, "failed to resume deployments", http.StatusInternalServerError)
+		return
+	}
+	if halt == nil {
+		http.Error(w, "deployments are not halted", http.StatusConflict)
+		return
+	}
+	a.announceHalt(r.Context(), "", fmt.Sprintf(":white_check_mark: Deployments resumed through the HTTP API after a halt of %s.", time.Since(halt.HaltedAt).Round(time.Minute)))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/slack-go/slack"
+)
+
+// HostEnvVar names the host a pipeline runs on; it also routes the command to that host's executor
+const HostEnvVar = "VIBEDEPLOY_HOST"
+
+// hostOverridesKey is a Redis hash of "<repo>@<environment>" to the host a migration moved the environment to
+const hostOverridesKey = "vibedeploy:hosts"
+
+// hostHistoryLimit is how many of a repository's recent deployments the hosts command looks through
+const hostHistoryLimit = 50
+
+// HostConfig is a machine of the fleet that environments can be deployed to
+type HostConfig struct {
+	// Queue is the Poppit queue whose workers run on the host
+	Queue string `yaml:"queue"`
+	// SSH runs the host's pipelines over SSH instead, for hosts without a Poppit worker
+	SSH *SSHTargetConfig `yaml:"ssh"`
+	// Upstream is the address the reverse proxy reaches the host's stacks at (default: PROXY_UPSTREAM_HOST)
+	Upstream string `yaml:"upstream"`
+}
+
+// validateHosts checks each host is reached in exactly one way
+func validateHosts(hosts map[string]HostConfig) error {
+	for name, host := range hosts {
+		if !environmentNamePattern.MatchString(name) {
+			return fmt.Errorf("host has invalid name %q (lowercase letters, digits and dashes)", name)
+		}
+		if (host.Queue == "") == (host.SSH == nil) {
+			return fmt.Errorf("host %q needs exactly one of queue or ssh", name)
+		}
+		if host.SSH != nil {
+			if err := host.SSH.validate(); err != nil {
+				return fmt.Errorf("host %q: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// environmentHost is the host an environment is deployed to, or "" for the default executor
+func (c RepoConfig) environmentHost(name string) string {
+	if i := c.environmentIndex(name); i >= 0 {
+		return c.Environments[i].Host
+	}
+	return ""
+}
+
+// targetHost is the host a repository environment is deployed to: where a migration moved it, or else its configured host
+func (a *App) targetHost(ctx context.Context, repo, environment string) string {
+	repoConfig := a.repoConfig(repo)
+	if i := repoConfig.environmentIndex(environment); i >= 0 {
+		environment = repoConfig.Environments[i].Name
+	}
+	host, err := a.redisClient.HGet(ctx, hostOverridesKey, repo+"@"+environment).Result()
+	if err == nil && host != "" {
+		return host
+	}
+	if err != nil && !errors.Is(err, redis.Nil) {
+		logError("Error reading host of %s@%s, using the configured one: %v", repo, environment, err)
+	}
+	return repoConfig.environmentHost(environment)
+}
+
+// upstreamHost is where the reverse proxy reaches a deployment's stack
+func (a *App) upstreamHost(d *Deployment) string {
+	if a.reposConfig != nil {
+		if host, ok := a.reposConfig.Hosts[d.Host]; ok && host.Upstream != "" {
+			return host.Upstream
+		}
+	}
+	return a.config.ProxyUpstreamHost
+}
+
+// newHostExecutors builds an executor per configured host. SSH hosts report their pipelines' output
+// straight to the app, as if it had come from a Poppit worker.
+func (a *App) newHostExecutors(hosts map[string]HostConfig, redisClient *redis.Client) (map[string]Executor, error) {
+	if len(hosts) == 0 {
+		return nil, nil
+	}
+	contentType, err := queueContentType(a.config.QueueEncoding)
+	if err != nil {
+		return nil, err
+	}
+	executors := make(map[string]Executor, len(hosts))
+	for name, host := range hosts {
+		if host.SSH != nil {
+			executors[name] = &SSHExecutor{host: name, config: *host.SSH, secrets: a.secrets, report: a.handleCommandOutput, fail: a.failStep}
+			continue
+		}
+		executors[name] = &PoppitExecutor{redisClient: redisClient, queues: []string{host.Queue}, cipher: a.cipher, contentType: contentType}
+	}
+	return executors, nil
+}
+
+// hostExecutor returns the executor for a host, or the default executor for ""
+func (a *App) hostExecutor(host string) (Executor, error) {
+	if host == "" {
+		return a.executor, nil
+	}
+	executor, ok := a.hosts[host]
+	if !ok {
+		return nil, fmt.Errorf("host %q is not configured", host)
+	}
+	return executor, nil
+}
+
+// executorFor returns the executor of the host the command was generated for
+func (a *App) executorFor(cmd PoppitCommand) (Executor, error) {
+	return a.hostExecutor(cmd.Env[HostEnvVar])
+}
+
+// waitForHosts blocks until pipelines started on SSH hosts have finished, for subcommands that dispatch before exiting
+func (a *App) waitForHosts() {
+	for _, executor := range a.hosts {
+		if ssh, ok := executor.(*SSHExecutor); ok {
+			ssh.wait()
+		}
+	}
+}
+
+// hostQueues are the Poppit queues of the configured hosts
+func (a *App) hostQueues() []string {
+	var queues []string
+	if a.reposConfig != nil {
+		for _, host := range a.reposConfig.Hosts {
+			if host.Queue != "" {
+				queues = append(queues, host.Queue)
+			}
+		}
+	}
+	sort.Strings(queues)
+	return queues
+}
+
+// failStep fails the deployment whose pipeline step failed on a host executor's worker
+func (a *App) failStep(ctx context.Context, output CommandOutput, reason string) {
+	if output.Metadata == nil || output.Metadata.DeploymentID == "" || output.Metadata.Workflow == WorkflowDrift {
+		// Diagnostics and drift checks have no deployment to fail, but their output still belongs in the thread
+		a.handleCommandOutput(ctx, output)
+		return
+	}
+	logWarn("Deployment %s failed: %s", output.Metadata.DeploymentID, reason)
+	a.recordRetrySignature(ctx, output)
+	a.recordFailedStep(ctx, output)
+	a.postFailedOutput(ctx, output)
+	a.failDeployment(ctx, output.Metadata.DeploymentID, reason)
+}
+
+// failMessage swaps the gear for the failure reaction when a step of a pipeline without a deployment record failed
+func (a *App) failMessage(ctx context.Context, output CommandOutput, reason string) {
+	logWarn("Pipeline for message %s in channel %s failed: %s", output.Metadata.Ts, output.Metadata.Channel, reason)
+	if err := a.publishSlackReaction(ctx, output.Metadata.Channel, output.Metadata.Ts, GearReaction, true); err != nil {
+		logError("Error removing gear reaction: %v", err)
+	}
+	if err := a.publishSlackReaction(ctx, output.Metadata.Channel, output.Metadata.Ts, FailureReaction, false); err != nil {
+		logError("Error publishing %s reaction: %v", FailureReaction, err)
+	}
+	if err := a.postThreadMessage(ctx, output.Metadata.Channel, output.Metadata.Ts, ":x: "+reason); err != nil {
+		logError("Error posting failure of %q in channel %s: %v", output.Command, output.Metadata.Channel, err)
+	}
+}
+
+// hostDeployments returns the latest deployment of each repository environment that targets a host, by host
+func (a *App) hostDeployments(ctx context.Context, identities []string) (map[string][]*Deployment, error) {
+	byHost := make(map[string][]*Deployment)
+	if a.reposConfig == nil {
+		return byHost, nil
+	}
+	for repo, repoConfig := range a.reposConfig.Repos {
+		targeted := make(map[string]string)
+		for _, env := range repoConfig.Environments {
+			if host := a.targetHost(ctx, repo, env.Name); host != "" && a.authorize(identities, ActionView, repo, env.Name) {
+				targeted[env.Name] = host
+			}
+		}
+		if len(targeted) == 0 {
+			continue
+		}
+
+		history, err := a.deployments.List(ctx, repo, hostHistoryLimit)
+		if err != nil {
+			return nil, err
+		}
+		for name, host := range targeted {
+			for _, d := range history {
+				if d.Host == host && (d.Environment == name || (d.Environment == "" && name == repoConfig.defaultEnvironment())) {
+					byHost[host] = append(byHost[host], d)
+					break
+				}
+			}
+		}
+	}
+	return byHost, nil
+}
+
+// hostsCommand handles `hosts` and `hosts <name>`
+func (a *App) hostsCommand(ctx context.Context, command slack.SlashCommand, args []string) *slack.WebhookMessage {
+	if len(args) > 1 {
+		return ephemeralReply("Usage: `hosts [name]`")
+	}
+	if a.reposConfig == nil || len(a.reposConfig.Hosts) == 0 {
+		return ephemeralReply("No hosts are configured.")
+	}
+	names := make([]string, 0, len(a.reposConfig.Hosts))
+	for name := range a.reposConfig.Hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(args) == 1 {
+		if _, ok := a.reposConfig.Hosts[args[0]]; !ok {
+			return ephemeralReply(fmt.Sprintf("Unknown host `%s`. Hosts: %s", args[0], strings.Join(names, ", ")))
+		}
+		names = args
+	}
+
+	byHost, err := a.hostDeployments(ctx, a.slackIdentities(ctx, command.UserID))
+	if err != nil {
+		logError("Error listing deployments per host: %v", err)
+		return ephemeralReply(":warning: Could not load deployments, please try again.")
+	}
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "*%s*\n", name)
+		deployments := byHost[name]
+		if len(deployments) == 0 {
+			b.WriteString("    nothing deployed\n")
+			continue
+		}
+		sort.Slice(deployments, func(i, j int) bool {
+			return deployments[i].Repository+"@"+deployments[i].Environment < deployments[j].Repository+"@"+deployments[j].Environment
+		})
+		for _, d := range deployments {
+			fmt.Fprintf(&b, "    • *%s* %s `%s` %s %s ago", d.Repository, d.Environment, d.Branch, d.Status, time.Since(d.StartedAt).Round(time.Minute))
+			if d.Build.GitSHA != "" {
+				fmt.Fprintf(&b, " at `%s`", shortSHA(d.Build.GitSHA))
+			}
+			b.WriteString("\n")
+		}
+	}
+	return ephemeralReply(strings.TrimRight(b.String(), "\n"))
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/its-the-vibe/VibeDeploy/api"
+)
+
+// maxCallbackBodySize limits the size of completion callbacks accepted from job runners
+const maxCallbackBodySize = 1 << 20
+
+// runHTTPServer serves the VibeDeploy HTTP endpoints until the context is cancelled
+func (a *App) runHTTPServer(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /executor/callback", a.handleExecutorCallback)
+	mux.HandleFunc("POST /github/webhook", a.handleGitHubWebhook)
+	mux.HandleFunc("POST /slack/workflow", a.requireScope(ScopeTrigger, a.handleWorkflowTrigger))
+	mux.HandleFunc("GET /api/deployments", a.requireScope(ScopeRead, a.handleListDeployments))
+	mux.HandleFunc("POST /api/deployments", a.requireScope(ScopeTrigger, a.handleTriggerDeployment))
+	mux.HandleFunc("GET /api/deployments/{id}", a.requireScope(ScopeRead, a.handleGetDeployment))
+	mux.HandleFunc("POST /api/deployments/{id}/cancel", a.requireScope(ScopeTrigger, a.handleCancelDeployment))
+	mux.HandleFunc("POST /api/deployments/{id}/promote", a.requireScope(ScopeTrigger, a.handlePromoteDeployment))
+	mux.HandleFunc("GET /api/deployments/{id}/lineage", a.requireScope(ScopeRead, a.handleDeploymentLineage))
+	mux.HandleFunc("GET /api/deployments/{id}/sbom", a.requireScope(ScopeRead, a.handleDeploymentSBOM))
+	mux.HandleFunc("GET /api/deployments/export", a.requireScope(ScopeAdmin, a.handleExportDeployments))
+	mux.HandleFunc("GET /api/deployments/compare", a.requireScope(ScopeRead, a.handleCompareDeployments))
+	mux.HandleFunc("GET /api/deployments/current", a.requireScope(ScopeRead, a.handleCurrentDeployment))
+	mux.HandleFunc("GET /api/deployments/feed.atom", a.requireScope(ScopeRead, a.handleDeploymentFeed))
+	mux.HandleFunc("GET /api/deployments/calendar.ics", tokenFromQuery(a.requireScope(ScopeRead, a.handleDeploymentCalendar)))
+	mux.HandleFunc("GET /api/repos", a.requireScope(ScopeRead, a.handleListRepositories))
+	mux.HandleFunc("GET /api/environments", a.requireScope(ScopeRead, a.handleListEnvironments))
+	mux.HandleFunc("GET /api/workspaces", a.requireScope(ScopeRead, a.handleListWorkspaces))
+	mux.HandleFunc("DELETE /api/workspaces/{id}", a.requireScope(ScopeTrigger, a.handleTeardownWorkspace))
+	mux.HandleFunc("GET /api/queue", a.requireScope(ScopeRead, a.handleListQueue))
+	mux.HandleFunc("GET /api/status", a.requireScope(ScopeRead, a.handleStatus))
+	mux.HandleFunc("GET /api/decisions", a.requireScope(ScopeRead, a.handleListDecisions))
+	mux.HandleFunc("GET /api/freeze", a.requireScope(ScopeRead, a.handleGetFreeze))
+	mux.HandleFunc("POST /api/freeze", a.requireScope(ScopeAdmin, a.handleFreeze))
+	mux.HandleFunc("DELETE /api/freeze", a.requireScope(ScopeAdmin, a.handleUnfreeze))
+	mux.HandleFunc("GET /api/openapi.json", a.requireScope(ScopeRead, handleOpenAPISpec))
+	mux.HandleFunc("GET /metrics", a.requireScope(ScopeRead, a.handleMetrics))
+	if a.oidc != nil {
+		mux.HandleFunc("GET /auth/login", a.oidc.handleLogin)
+		mux.HandleFunc("GET /auth/callback", a.oidc.handleCallback)
+		mux.HandleFunc("POST /auth/logout", a.oidc.handleLogout)
+		mux.HandleFunc("GET /auth/me", a.oidc.handleWhoAmI)
+	}
+
+	var handler http.Handler = mux
+	filter, err := newIPFilter(a.config)
+	if err != nil {
+		logError("Invalid HTTP address filter, not starting HTTP server: %v", err)
+		return
+	}
+	if a.config.MaxHTTPRequests > 0 {
+		handler = a.limitConcurrency(a.config.MaxHTTPRequests, handler)
+	}
+	if filter != nil {
+		handler = filter.wrap(handler)
+	}
+
+	server := &http.Server{
+		Addr:              a.config.HTTPAddr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logError("Error shutting down HTTP server: %v", err)
+		}
+	}()
+
+	logInfo("HTTP server listening on %s", a.config.HTTPAddr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logError("HTTP server error: %v", err)
+	}
+}
+
+// handleExecutorCallback receives completion callbacks from the webhook executor's job runner.
+// The body uses the same format as Poppit command output messages.
+func (a *App) handleExecutorCallback(w http.ResponseWriter, r *http.Request) {
+	if a.config.WebhookSecret == "" {
+		http.Error(w, "webhook callbacks are not enabled", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCallbackBodySize))
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := verifyRequest([]byte(a.config.WebhookSecret), r.Header.Get(TimestampHeader), body, r.Header.Get(SignatureHeader), time.Now()); err != nil {
+		logWarn("Rejected executor callback from %s: %v", r.RemoteAddr, err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	logDebug("Received executor callback from %s", r.RemoteAddr)
+	a.capture.consumed(r.Context(), a.cipher, CaptureCallback, r.URL.Path, body)
+	a.processCommandOutput(r.Context(), string(body))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListDeployments returns the deployment history for a repository, newest first
+func (a *App) handleListDeployments(w http.ResponseWriter, r *http.Request) {
+	repo := r.URL.Query().Get("repo")
+	if repo == "" {
+		http.Error(w, "repo query parameter is required", http.StatusBadRequest)
+		return
+	}
+	if !a.authorizeRequest(w, r, ActionView, repo) {
+		return
+	}
+
+	limit := defaultHistoryLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	deployments, err := a.deployments.List(r.Context(), repo, limit)
+	if err != nil {
+		logError("Error listing deployments for %s: %v", repo, err)
+		http.Error(w, "failed to list deployments", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, deployments)
+}
+
+// TriggerRequest is the body of POST /api/deployments
+type TriggerRequest struct {
+	Repository  string `json:"repository"`
+	Branch      string `json:"branch"`
+	PRNumber    int    `json:"pr_number,omitempty"`
+	TriggeredBy string `json:"triggered_by,omitempty"`
+	// IncidentID references the ongoing incident, for branches and PRs that don't name it
+	IncidentID string `json:"incident_id,omitempty"`
+	// MessageLink is a Slack permalink to a PR message, deployed in place of repository and branch, with its
+	// reactions and thread as for a :rocket: on it
+	MessageLink string `json:"message_link,omitempty"`
+}
+
+// handleTriggerDeployment starts a deployment of a repository branch
+func (a *App) handleTriggerDeployment(w http.ResponseWriter, r *http.Request) {
+	var req TriggerRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCallbackBodySize)).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	var channel, ts string
+	if req.MessageLink != "" {
+		if req.Repository != "" || req.Branch != "" || req.PRNumber != 0 {
+			http.Error(w, "message_link replaces repository, branch and pr_number", http.StatusBadRequest)
+			return
+		}
+		var metadata *PRMetadata
+		var err error
+		channel, ts, metadata, err = a.resolveMessageLink(r.Context(), req.MessageLink)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if metadata == nil {
+			http.Error(w, "the message has no PR metadata", http.StatusUnprocessableEntity)
+			return
+		}
+		req.Repository, req.Branch, req.PRNumber = metadata.Repository, metadata.Branch, metadata.PRNumber
+	}
+	if req.Repository == "" || req.Branch == "" {
+		http.Error(w, "repository and branch, or message_link, are required", http.StatusBadRequest)
+		return
+	}
+	req.Repository = a.canonicalRepo(req.Repository)
+	if !isRepoAllowed(req.Repository, a.allowedRepos) {
+		http.Error(w, "repository "+req.Repository+" is not in the allowed list", http.StatusForbidden)
+		return
+	}
+	if !a.authorizeRequest(w, r, ActionDeploy, req.Repository) {
+		return
+	}
+
+	// The deployment is triggered by the authenticated caller, which policies and quotas see; the body's
+	// triggered_by is only logged
+	by := ""
+	if principal, _ := r.Context().Value(principalKey{}).(*Principal); principal != nil {
+		by = principal.Name
+	}
+
+	metadata := &PRMetadata{Repository: req.Repository, Branch: req.Branch, PRNumber: req.PRNumber}
+	logInfo("HTTP trigger for %s branch %s by %q (triggered_by %q)", metadata.Repository, metadata.Branch, by, req.TriggeredBy)
+	deployment, err := a.startDeployment(r.Context(), metadata, DeployOptions{IncidentID: req.IncidentID}, channel, ts, by)
+	if errors.Is(err, ErrDeploymentDeclined) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		logError("Error starting deployment for %s: %v", req.Repository, err)
+		http.Error(w, "failed to start deployment", http.StatusServiceUnavailable)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, deployment)
+}
+
+// handleGetDeployment returns a single deployment record including its build metadata
+func (a *App) handleGetDeployment(w http.ResponseWriter, r *http.Request) {
+	deployment, err := a.deployments.Get(r.Context(), r.PathValue("id"))
+	if errors.Is(err, ErrDeploymentNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logError("Error loading deployment %s: %v", r.PathValue("id"), err)
+		http.Error(w, "failed to load deployment", http.StatusInternalServerError)
+		return
+	}
+	if !a.authorizeRequest(w, r, ActionView, deployment.Repository) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, deployment)
+}
+
+// handleExportDeployments streams deployment history as CSV or JSON for compliance reporting
+func (a *App) handleExportDeployments(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = ExportFormatCSV
+	}
+	if format != ExportFormatCSV && format != ExportFormatJSON {
+		http.Error(w, "format must be csv or json", http.StatusBadRequest)
+		return
+	}
+
+	since, err := parseExportSince(r.URL.Query().Get("since"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	deployments, err := collectExport(r.Context(), a.deployments, r.URL.Query().Get("repo"), since)
+	if err != nil {
+		logError("Error collecting deployments for export: %v", err)
+		http.Error(w, "failed to export deployments", http.StatusInternalServerError)
+		return
+	}
+
+	contentType := "text/csv"
+	if format == ExportFormatJSON {
+		contentType = "application/json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "attachment; filename=deployments."+format)
+	if err := writeExport(w, format, deployments); err != nil {
+		logError("Error writing deployment export: %v", err)
+	}
+}
+
+// handleCompareDeployments returns the commit range, duration delta and config differences between two deployments
+func (a *App) handleCompareDeployments(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	repo, fromID, toID := query.Get("repo"), query.Get("from"), query.Get("to")
+	if repo == "" || fromID == "" || toID == "" {
+		http.Error(w, "repo, from and to query parameters are required", http.StatusBadRequest)
+		return
+	}
+	if !a.authorizeRequest(w, r, ActionView, repo) {
+		return
+	}
+
+	deployments := make([]*Deployment, 0, 2)
+	for _, id := range []string{fromID, toID} {
+		d, err := a.deployments.Get(r.Context(), id)
+		if errors.Is(err, ErrDeploymentNotFound) || (err == nil && d.Repository != repo) {
+			http.Error(w, "deployment "+id+" not found for "+repo, http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logError("Error loading deployment %s: %v", id, err)
+			http.Error(w, "failed to load deployment", http.StatusInternalServerError)
+			return
+		}
+		deployments = append(deployments, d)
+	}
+
+	comparison, err := compareDeployments(deployments[0], deployments[1])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, comparison)
+}
+
+// handleCurrentDeployment returns what a repository's first environment runs, and what a rollback would redeploy
+func (a *App) handleCurrentDeployment(w http.ResponseWriter, r *http.Request) {
+	repo := r.URL.Query().Get("repo")
+	if repo == "" {
+		http.Error(w, "repo query parameter is required", http.StatusBadRequest)
+		return
+	}
+	if !a.authorizeRequest(w, r, ActionView, repo) {
+		return
+	}
+
+	refs, err := a.deployedRefs(r.Context(), repo)
+	if err != nil {
+		logError("Error loading deployed refs of %s: %v", repo, err)
+		http.Error(w, "failed to load deployed refs", http.StatusInternalServerError)
+		return
+	}
+	if refs.Current == nil {
+		http.Error(w, repo+" has no successful deployment", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, refs)
+}
+
+// RepositoryStatus is a known repository and its most recent deployment
+type RepositoryStatus struct {
+	Repository     string      `json:"repository"`
+	Allowed        bool        `json:"allowed"`
+	LastDeployment *Deployment `json:"last_deployment,omitempty"`
+}
+
+// handleListRepositories lists every repository that is allowlisted or has recorded history
+func (a *App) handleListRepositories(w http.ResponseWriter, r *http.Request) {
+	repos, err := a.deployments.Repositories(r.Context())
+	if err != nil {
+		logError("Error listing repositories: %v", err)
+		http.Error(w, "failed to list repositories", http.StatusInternalServerError)
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, repo := range repos {
+		seen[repo] = true
+	}
+	for repo := range a.allowedRepos {
+		if !seen[repo] {
+			repos = append(repos, repo)
+		}
+	}
+	sort.Strings(repos)
+
+	statuses := make([]RepositoryStatus, 0, len(repos))
+	for _, repo := range repos {
+		status := RepositoryStatus{Repository: repo, Allowed: isRepoAllowed(repo, a.allowedRepos)}
+		latest, err := a.deployments.List(r.Context(), repo, 1)
+		if err != nil {
+			logError("Error loading latest deployment for %s: %v", repo, err)
+		} else if len(latest) > 0 {
+			status.LastDeployment = latest[0]
+		}
+		statuses = append(statuses, status)
+	}
+
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// handleOpenAPISpec serves the OpenAPI document describing this API
+func handleOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(api.OpenAPISpec)
+}
+
+// writeJSON encodes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logError("Error encoding JSON response: %v", err)
+	}
+}
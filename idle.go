@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/slack-go/slack"
+)
+
+// WorkflowIdle samples a workspace's network traffic. Like a drift check, it is not recorded as a deployment
+// and does not take a concurrency slot.
+const WorkflowIdle = "idle"
+
+// KeepReaction on a "still need this?" notice keeps the idle workspace
+const KeepReaction = "pushpin"
+
+// idleProbeSuffix follows `docker compose -p <project>` to print "<container> <received> / <sent>" for each
+// of the workspace's containers
+const idleProbeSuffix = " stats --no-stream --format '{{.Name}} {{.NetIO}}'"
+
+// workspaceActivityKey is a Redis hash of deployment ID to its workspace's traffic, while the workspace runs
+const workspaceActivityKey = "vibedeploy:workspaces:activity"
+
+// idleNoticeKeyPrefix maps a "still need this?" notice to the deployment whose workspace it is about
+const idleNoticeKeyPrefix = "vibedeploy:idle:notices:"
+
+// WorkspaceActivity is what the idle checks know about a workspace's traffic
+type WorkspaceActivity struct {
+	// Bytes is the workspace's containers' network traffic at the last sample, received and sent
+	Bytes        uint64    `json:"bytes"`
+	LastActiveAt time.Time `json:"last_active_at"`
+	// NoticeTs is the "still need this?" notice, in the thread of NoticeThread, and TeardownAt when the workspace
+	// goes without an answer
+	NoticeChannel string     `json:"notice_channel,omitempty"`
+	NoticeThread  string     `json:"notice_thread,omitempty"`
+	NoticeTs      string     `json:"notice_ts,omitempty"`
+	TeardownAt    *time.Time `json:"teardown_at,omitempty"`
+}
+
+// thread is where replies to the notice go: the deployment's thread, or the notice's own in the ops channel
+func (activity *WorkspaceActivity) thread() string {
+	if activity.NoticeThread != "" {
+		return activity.NoticeThread
+	}
+	return activity.NoticeTs
+}
+
+// parseNetIO sums the received and sent bytes of idleProbeSuffix's output
+func parseNetIO(output string) (uint64, int, error) {
+	var total uint64
+	containers := 0
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		_, netIO, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			continue
+		}
+		received, sent, ok := strings.Cut(netIO, "/")
+		if !ok {
+			return 0, 0, fmt.Errorf("invalid network I/O %q", netIO)
+		}
+		for _, size := range []string{received, sent} {
+			n, err := parseByteSize(strings.TrimSpace(size))
+			if err != nil {
+				return 0, 0, err
+			}
+			total += n
+		}
+		containers++
+	}
+	return total, containers, nil
+}
+
+// workspaceActivity returns a workspace's traffic on record, or nil before its first sample
+func (a *App) workspaceActivity(ctx context.Context, id string) (*WorkspaceActivity, error) {
+	data, err := a.redisClient.HGet(ctx, workspaceActivityKey, id).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load activity: %w", err)
+	}
+	var activity WorkspaceActivity
+	if err := json.Unmarshal([]byte(data), &activity); err != nil {
+		return nil, fmt.Errorf("failed to parse activity: %w", err)
+	}
+	return &activity, nil
+}
+
+func (a *App) saveWorkspaceActivity(ctx context.Context, id string, activity *WorkspaceActivity) error {
+	data, err := json.Marshal(activity)
+	if err != nil {
+		return fmt.Errorf("failed to marshal activity: %w", err)
+	}
+	if err := a.redisClient.HSet(ctx, workspaceActivityKey, id, data).Err(); err != nil {
+		return fmt.Errorf("failed to record activity: %w", err)
+	}
+	return nil
+}
+
+// runIdleChecks periodically samples every workspace's traffic, and tears down those whose "still need this?"
+// notice went unanswered
+func (a *App) runIdleChecks(ctx context.Context) {
+	ticker := time.NewTicker(a.config.IdleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logInfo("Idle check context cancelled, exiting")
+			return
+		case <-ticker.C:
+		}
+
+		workspaces, err := a.listWorkspaces(ctx)
+		if err != nil {
+			logError("Error listing workspaces for idle checks: %v", err)
+			continue
+		}
+		for _, w := range workspaces {
+			activity, err := a.workspaceActivity(ctx, w.DeploymentID)
+			if err != nil {
+				logError("Error checking workspace of deployment %s: %v", w.DeploymentID, err)
+				continue
+			}
+			if activity != nil && activity.TeardownAt != nil && time.Now().After(*activity.TeardownAt) {
+				a.teardownIdleWorkspace(ctx, w, activity)
+				continue
+			}
+			if err := a.startIdleProbe(ctx, w); err != nil {
+				logError("Error starting idle check of deployment %s: %v", w.DeploymentID, err)
+			}
+		}
+	}
+}
+
+// startIdleProbe dispatches the traffic sample of a workspace to the host it runs on
+func (a *App) startIdleProbe(ctx context.Context, w *Workspace) error {
+	cmd := PoppitCommand{
+		Repo:     w.Repository,
+		Branch:   w.Branch,
+		Type:     VibeDeployType,
+		Dir:      w.Dir,
+		Commands: []string{composeProjectPrefix + w.Project + idleProbeSuffix},
+		Metadata: &CommandMetadata{
+			DeploymentID: w.DeploymentID,
+			Workflow:     WorkflowIdle,
+		},
+	}
+	if w.Host != "" {
+		cmd.Env = map[string]string{HostEnvVar: w.Host}
+	}
+	if a.policy != nil {
+		if err := a.policy.check(cmd); err != nil {
+			return err
+		}
+	}
+	executor, err := a.executorFor(cmd)
+	if err != nil {
+		return err
+	}
+	if err := executor.Execute(ctx, cmd); err != nil {
+		return fmt.Errorf("failed to dispatch idle check via %s executor: %w", executor.Name(), err)
+	}
+	logDebug("Dispatched idle check of workspace %s of %s", w.Name, w.Repository)
+	return nil
+}
+
+// recordTraffic compares a workspace's traffic sample with the last one. A workspace whose traffic hasn't moved
+// for IDLE_AFTER gets a "still need this?" notice in its deployment's thread, and is torn down IDLE_TEARDOWN_GRACE
+// later unless someone keeps it or it gets traffic again.
+func (a *App) recordTraffic(ctx context.Context, output CommandOutput) {
+	id := output.Metadata.DeploymentID
+	w, err := a.getWorkspace(ctx, id)
+	if err != nil {
+		// Torn down since the probe was dispatched
+		logDebug("Ignoring idle check of deployment %s: %v", id, err)
+		return
+	}
+	bytes, containers, err := parseNetIO(output.Output)
+	if err != nil {
+		logWarn("Could not read the traffic of workspace %s of %s: %v", w.Name, w.Repository, err)
+		return
+	}
+	activity, err := a.workspaceActivity(ctx, id)
+	if err != nil {
+		logError("Error checking workspace of deployment %s: %v", id, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	switch {
+	case activity == nil:
+		activity = &WorkspaceActivity{Bytes: bytes, LastActiveAt: now}
+	case containers == 0:
+		// A stack that isn't running serves no one, however long ago it last did
+	case bytes < activity.Bytes || bytes-activity.Bytes > a.config.IdleTrafficThreshold:
+		// Counters start over when containers restart, which is activity too
+		if activity.TeardownAt != nil {
+			logInfo("Workspace %s of %s has traffic again, keeping it", w.Name, w.Repository)
+		}
+		activity = &WorkspaceActivity{Bytes: bytes, LastActiveAt: now}
+	default:
+		// Health checks and the containers talking among themselves don't count as use
+		activity.Bytes = bytes
+	}
+	if activity.TeardownAt == nil && now.Sub(activity.LastActiveAt) >= a.config.IdleAfter {
+		a.noticeIdleWorkspace(ctx, w, activity, now)
+	}
+	if err := a.saveWorkspaceActivity(ctx, id, activity); err != nil {
+		logError("Error recording traffic of workspace %s: %v", w.Name, err)
+	}
+}
+
+// noticeIdleWorkspace asks the workspace's deployer whether they still need it, and schedules its teardown
+func (a *App) noticeIdleWorkspace(ctx context.Context, w *Workspace, activity *WorkspaceActivity, now time.Time) {
+	teardownAt := now.Add(a.config.IdleTeardownGrace)
+	activity.TeardownAt = &teardownAt
+	logInfo("Workspace %s of %s has been idle since %s, tearing it down at %s unless kept", w.Name, w.Repository, activity.LastActiveAt.Format(time.RFC3339), teardownAt.Format(time.RFC3339))
+
+	channel, ts := a.config.OpsAlertChannel, ""
+	if d, err := a.deployments.Get(ctx, w.DeploymentID); err == nil && d.Channel != "" {
+		channel, ts = d.Channel, d.Ts
+	}
+	if channel == "" {
+		return
+	}
+	text := a.messages.text("idle.notice", map[string]interface{}{
+		"User":       w.TriggeredBy,
+		"Repository": w.Repository,
+		"Branch":     w.Branch,
+		"Idle":       formatAge(now.Sub(activity.LastActiveAt)),
+		"Grace":      formatAge(a.config.IdleTeardownGrace),
+		"Reaction":   KeepReaction,
+	})
+	_, noticeTs, err := a.slackClient.PostMessageContext(ctx, channel, slack.MsgOptionText(text, false), slack.MsgOptionTS(ts))
+	if err != nil {
+		logError("Error posting idle notice for workspace %s: %v", w.Name, err)
+		return
+	}
+	activity.NoticeChannel, activity.NoticeThread, activity.NoticeTs = channel, ts, noticeTs
+	// The notice only keeps the workspace until its teardown
+	if err := a.redisClient.Set(ctx, idleNoticeKeyPrefix+channel+":"+noticeTs, w.DeploymentID, a.config.IdleTeardownGrace).Err(); err != nil {
+		logError("Error recording idle notice for workspace %s: %v", w.Name, err)
+	}
+}
+
+// keepFromReaction keeps the idle workspace a :pushpin: on its notice is about, checking it again after IDLE_AFTER
+func (a *App) keepFromReaction(ctx context.Context, channel, ts, user string) {
+	id, err := a.redisClient.Get(ctx, idleNoticeKeyPrefix+channel+":"+ts).Result()
+	if err != nil {
+		logDebug("No idle notice on message %s in channel %s", ts, channel)
+		return
+	}
+	w, err := a.getWorkspace(ctx, id)
+	if err != nil {
+		logDebug("Ignoring %s reaction for deployment %s: %v", KeepReaction, id, err)
+		return
+	}
+	if !a.authorize(a.slackIdentities(ctx, user), ActionDeploy, w.Repository, "") {
+		logInfo("User %s may not %s %s, ignoring %s reaction", user, ActionDeploy, w.Repository, KeepReaction)
+		return
+	}
+	activity, err := a.workspaceActivity(ctx, id)
+	if err != nil || activity == nil || activity.TeardownAt == nil {
+		return
+	}
+	a.redisClient.Del(ctx, idleNoticeKeyPrefix+channel+":"+ts)
+	thread := activity.thread()
+	activity = &WorkspaceActivity{Bytes: activity.Bytes, LastActiveAt: time.Now().UTC()}
+	if err := a.saveWorkspaceActivity(ctx, id, activity); err != nil {
+		logError("Error keeping workspace %s: %v", w.Name, err)
+		return
+	}
+	logInfo("%s is keeping workspace %s of %s", user, w.Name, w.Repository)
+	text := a.messages.text("idle.kept", map[string]interface{}{
+		"User":       user,
+		"Repository": w.Repository,
+		"Branch":     w.Branch,
+		"IdleAfter":  formatAge(a.config.IdleAfter),
+		"Reaction":   KeepReaction,
+	})
+	if err := a.postThreadMessage(ctx, channel, thread, text); err != nil {
+		logError("Error posting keep notice: %v", err)
+	}
+}
+
+// teardownIdleWorkspace tears down a workspace nobody kept after its idle notice
+func (a *App) teardownIdleWorkspace(ctx context.Context, w *Workspace, activity *WorkspaceActivity) {
+	// Every instance checks; the first to claim the workspace tears it down
+	if claimed, err := a.redisClient.HDel(ctx, workspaceActivityKey, w.DeploymentID).Result(); err != nil || claimed == 0 {
+		return
+	}
+	idle := formatAge(time.Since(activity.LastActiveAt))
+	logInfo("Tearing down workspace %s of %s, idle for %s", w.Name, w.Repository, idle)
+	if err := a.teardownWorkspace(ctx, w.DeploymentID); err != nil {
+		logError("Error tearing down idle workspace of deployment %s: %v", w.DeploymentID, err)
+		return
+	}
+	if activity.NoticeChannel == "" {
+		return
+	}
+	text := a.messages.text("idle.teardown", map[string]interface{}{
+		"Repository": w.Repository,
+		"Branch":     w.Branch,
+		"Idle":       idle,
+	})
+	if err := a.postThreadMessage(ctx, activity.NoticeChannel, activity.thread(), text); err != nil {
+		logError("Error posting idle teardown notice: %v", err)
+	}
+}
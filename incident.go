@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/slack-go/slack"
+)
+
+// incidentKey holds the active incident as JSON; it is absent when there is none
+const incidentKey = "vibedeploy:incident"
+
+// Incident is an ongoing incident declared with the slash command
+type Incident struct {
+	ID        string    `json:"id"`
+	Channel   string    `json:"channel"`
+	StartedBy string    `json:"started_by"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// activeIncident returns the ongoing incident, or nil if there is none
+func (a *App) activeIncident(ctx context.Context) (*Incident, error) {
+	data, err := a.redisClient.Get(ctx, incidentKey).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read incident: %w", err)
+	}
+	var incident Incident
+	if err := json.Unmarshal([]byte(data), &incident); err != nil {
+		return nil, fmt.Errorf("failed to parse incident: %w", err)
+	}
+	return &incident, nil
+}
+
+// incidentCommand handles `incident start <id> [#channel]`, `incident end` and `incident`
+func (a *App) incidentCommand(ctx context.Context, command slack.SlashCommand, args []string) *slack.WebhookMessage {
+	incident, err := a.activeIncident(ctx)
+	if err != nil {
+		logError("Error loading incident: %v", err)
+		return ephemeralReply(":warning: Could not read the incident state, please try again.")
+	}
+
+	if len(args) == 0 {
+		if incident == nil {
+			return ephemeralReply("No incident is in progress.")
+		}
+		return ephemeralReply(fmt.Sprintf(":rotating_light: Incident *%s* in progress since %s, started by %s. Deploys must reference it and are posted to <#%s>.",
+			incident.ID, incident.StartedAt.Format(time.RFC1123), formatMention(incident.StartedBy), incident.Channel))
+	}
+
+	// Incident mode changes how everyone deploys, so it takes an approver
+	if !a.authorize(a.slackIdentities(ctx, command.UserID), ActionApprove, "", "") {
+		logInfo("User %s may not start or end incidents", command.UserID)
+		return ephemeralReply(":no_entry: You need the approve permission to start or end an incident.")
+	}
+
+	switch args[0] {
+	case "start":
+		if len(args) < 2 || len(args) > 3 {
+			return ephemeralReply("Usage: `incident start <id> [#channel]`")
+		}
+		if incident != nil {
+			return ephemeralReply(fmt.Sprintf("Incident *%s* is already in progress; end it first.", incident.ID))
+		}
+		channel := command.ChannelID
+		if len(args) == 3 {
+			if channel = parseChannelArg(args[2]); channel == "" {
+				return ephemeralReply(fmt.Sprintf("%q is not a channel; pick one with `#`.", args[2]))
+			}
+		}
+		incident = &Incident{ID: args[1], Channel: channel, StartedBy: command.UserID, StartedAt: time.Now().UTC()}
+		data, err := json.Marshal(incident)
+		if err != nil {
+			logError("Error marshaling incident: %v", err)
+			return ephemeralReply(":warning: Could not start the incident.")
+		}
+		started, err := a.redisClient.SetNX(ctx, incidentKey, data, 0).Result()
+		if err != nil {
+			logError("Error starting incident %s: %v", incident.ID, err)
+			return ephemeralReply(":warning: Could not start the incident, please try again.")
+		}
+		if !started {
+			return ephemeralReply("Another incident was started at the same time; check `incident`.")
+		}
+		logInfo("Incident %s started by %s, posting deploy activity to %s", incident.ID, command.UserID, incident.Channel)
+		if channel != command.ChannelID {
+			text := fmt.Sprintf(":rotating_light: Incident *%s* started by %s; deploy activity will be posted here.", incident.ID, formatMention(command.UserID))
+			if err := a.postThreadMessage(ctx, channel, "", text); err != nil {
+				logError("Error announcing incident %s: %v", incident.ID, err)
+			}
+		}
+		return channelReply(fmt.Sprintf(":rotating_light: Incident *%s* started by %s. Deploys must reference `%s` in the branch name or PR title until it ends.",
+			incident.ID, formatMention(command.UserID), incident.ID))
+	case "end":
+		if incident == nil {
+			return ephemeralReply("No incident is in progress.")
+		}
+		if err := a.redisClient.Del(ctx, incidentKey).Err(); err != nil {
+			logError("Error ending incident %s: %v", incident.ID, err)
+			return ephemeralReply(":warning: Could not end the incident, please try again.")
+		}
+		logInfo("Incident %s ended by %s", incident.ID, command.UserID)
+		text := fmt.Sprintf(":white_check_mark: Incident *%s* ended by %s after %s.", incident.ID, formatMention(command.UserID), time.Since(incident.StartedAt).Round(time.Minute))
+		if incident.Channel != command.ChannelID {
+			if err := a.postThreadMessage(ctx, incident.Channel, "", text); err != nil {
+				logError("Error announcing end of incident %s: %v", incident.ID, err)
+			}
+		}
+		return channelReply(text)
+	default:
+		return ephemeralReply(slashCommandUsage)
+	}
+}
+
+// parseChannelArg returns the channel ID from an escaped mention such as <#C012AB3CD|incidents>, or a bare ID
+func parseChannelArg(arg string) string {
+	if strings.HasPrefix(arg, "<#") && strings.HasSuffix(arg, ">") {
+		arg, _, _ = strings.Cut(strings.TrimSuffix(strings.TrimPrefix(arg, "<#"), ">"), "|")
+	}
+	if isSlackID(arg, 'C') || isSlackID(arg, 'G') {
+		return arg
+	}
+	return ""
+}
+
+// incidentReference returns the ID of the ongoing incident a run belongs to, or "" when there is none.
+// While an incident is in progress a deploy must name it in its branch, its PR title or the trigger's
+// incident ID, so only work on the incident reaches the shared environment; restarts are always tagged.
+func (a *App) incidentReference(ctx context.Context, workflow string, metadata *PRMetadata, options DeployOptions) (string, error) {
+	incident, err := a.activeIncident(ctx)
+	if err != nil {
+		// Don't stop deploys for everyone because the flag can't be read
+		logError("Error checking for an incident: %v", err)
+		return "", nil
+	}
+	if incident == nil {
+		return "", nil
+	}
+	if workflow != WorkflowDeploy || mentionsIncident(options.IncidentID, incident.ID) || mentionsIncident(metadata.Branch, incident.ID) {
+		return incident.ID, nil
+	}
+
+	if a.github != nil && metadata.PRNumber > 0 {
+		pr, err := a.github.pullRequest(ctx, metadata.Repository, metadata.PRNumber)
+		if err != nil {
+			logError("Error loading #%d of %s to check for incident %s: %v", metadata.PRNumber, metadata.Repository, incident.ID, err)
+		} else if mentionsIncident(pr.Title, incident.ID) {
+			return incident.ID, nil
+		}
+	}
+	return "", fmt.Errorf("%w: incident %s is in progress; reference it in the branch name or PR title", ErrDeploymentDeclined, incident.ID)
+}
+
+func mentionsIncident(text, id string) bool {
+	return id != "" && strings.Contains(strings.ToLower(text), strings.ToLower(id))
+}
+
+// notifyIncidentChannel posts a deployment summary to the incident channel while the incident it belongs to is still in progress
+func (a *App) notifyIncidentChannel(ctx context.Context, d *Deployment) {
+	if d.IncidentID == "" {
+		return
+	}
+	incident, err := a.activeIncident(ctx)
+	if err != nil {
+		logError("Error loading incident for deployment %s: %v", d.ID, err)
+		return
+	}
+	if incident == nil || incident.ID != d.IncidentID {
+		return
+	}
+
+	text := fmt.Sprintf("[%s] %s", d.IncidentID, a.deploymentSummary(d))
+	if triggeredBy := formatMention(d.TriggeredBy); triggeredBy != "" {
+		text += " by " + triggeredBy
+	}
+	if err := a.postThreadMessage(ctx, incident.Channel, "", text); err != nil {
+		logError("Error posting %s summary for deployment %s to incident channel %s: %v", d.Status, d.ID, incident.Channel, err)
+		return
+	}
+	logInfo("Posted %s summary for deployment %s to incident channel %s", d.Status, d.ID, incident.Channel)
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// infraRunsKey is a Redis hash of deployment ID to the infrastructure run it is waiting on, as JSON
+const infraRunsKey = "vibedeploy:infra:runs"
+
+// infraPollKey lets only one VibeDeploy instance poll the runs each interval
+const infraPollKey = "vibedeploy:infra:poll"
+
+// Reactions on an infrastructure deployment's message that decide a plan waiting for approval
+const (
+	ApplyReaction   = "white_check_mark"
+	DiscardReaction = "wastebasket"
+)
+
+// WorkflowInfraPlan is what the apply and discard reactions act on: the plan of an infrastructure run
+const WorkflowInfraPlan = "infra-plan"
+
+// Infrastructure providers
+const (
+	TerraformCloudProviderName = "terraform_cloud"
+	SpaceliftProviderName      = "spacelift"
+)
+
+// Phases of an infrastructure run, whatever the provider calls its states
+const (
+	InfraPhaseRunning          = "running"
+	InfraPhaseAwaitingApproval = "awaiting_approval"
+	InfraPhaseApplied          = "applied"
+	InfraPhaseFailed           = "failed"
+	InfraPhaseDiscarded        = "discarded"
+)
+
+// InfraConfig is the infra section of a repository's settings: its deployments are runs in Terraform Cloud
+// or Spacelift rather than a pipeline on a deploy host
+type InfraConfig struct {
+	// Provider is terraform_cloud or spacelift
+	Provider string `yaml:"provider"`
+	// URL is the provider's address: https://app.terraform.io (default) or https://<account>.app.spacelift.io
+	URL string `yaml:"url"`
+	// TokenSecret names the Terraform Cloud API token, or the Spacelift API key secret, in the secrets provider
+	TokenSecret string `yaml:"token_secret"`
+	// APIKeyID is the ID of the Spacelift API key
+	APIKeyID string `yaml:"api_key_id"`
+
+	// Organization and Workspace name the Terraform Cloud workspace
+	Organization string `yaml:"organization"`
+	Workspace    string `yaml:"workspace"`
+	// Stack is the Spacelift stack ID
+	Stack string `yaml:"stack"`
+	// Environments maps environments of the promotion chain to workspaces or stacks of their own
+	Environments map[string]string `yaml:"environments"`
+}
+
+func (c *InfraConfig) validate() error {
+	switch c.Provider {
+	case TerraformCloudProviderName:
+		if c.Organization == "" || (c.Workspace == "" && len(c.Environments) == 0) {
+			return fmt.Errorf("provider %s needs organization and a workspace", TerraformCloudProviderName)
+		}
+	case SpaceliftProviderName:
+		if c.URL == "" || c.APIKeyID == "" || (c.Stack == "" && len(c.Environments) == 0) {
+			return fmt.Errorf("provider %s needs url, api_key_id and a stack", SpaceliftProviderName)
+		}
+	default:
+		return fmt.Errorf("unknown infra provider %q (expected %s or %s)", c.Provider, TerraformCloudProviderName, SpaceliftProviderName)
+	}
+	if c.TokenSecret == "" {
+		return fmt.Errorf("infra needs token_secret")
+	}
+	return nil
+}
+
+// target returns the workspace or stack an environment deploys to
+func (c *InfraConfig) target(environment string) string {
+	if target, ok := c.Environments[environment]; ok {
+		return target
+	}
+	if c.Provider == SpaceliftProviderName {
+		return c.Stack
+	}
+	return c.Workspace
+}
+
+// InfraRun is the state of a run as VibeDeploy sees it
+type InfraRun struct {
+	ID string
+	// State is the provider's own name for it, and Phase what it means to the deployment
+	State string
+	Phase string
+	// Summary describes the plan, e.g. "+2 ~1 -0"
+	Summary string
+	GitSHA  string
+}
+
+// InfraProvider starts and steers runs through a provider's API
+type InfraProvider interface {
+	Name() string
+	Trigger(ctx context.Context, target, message string) (string, error)
+	Run(ctx context.Context, target, id string) (*InfraRun, error)
+	Apply(ctx context.Context, target, id, comment string) error
+	Discard(ctx context.Context, target, id, comment string) error
+	RunURL(target, id string) string
+}
+
+// InfraRunRecord tracks a deployment's run until it finishes
+type InfraRunRecord struct {
+	DeploymentID string `json:"deployment_id"`
+	Repository   string `json:"repository"`
+	Environment  string `json:"environment,omitempty"`
+	Target       string `json:"target"`
+	RunID        string `json:"run_id"`
+	URL          string `json:"url"`
+	Phase        string `json:"phase"`
+	Channel      string `json:"channel"`
+	Ts           string `json:"ts"`
+}
+
+// infraRuns returns the runs deployments are waiting on
+func (a *App) infraRuns(ctx context.Context) ([]*InfraRunRecord, error) {
+	raw, err := a.redisClient.HGetAll(ctx, infraRunsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list infrastructure runs: %w", err)
+	}
+	records := make([]*InfraRunRecord, 0, len(raw))
+	for id, data := range raw {
+		var record InfraRunRecord
+		if err := json.Unmarshal([]byte(data), &record); err != nil {
+			logError("Error parsing infrastructure run of deployment %s: %v", id, err)
+			continue
+		}
+		records = append(records, &record)
+	}
+	return records, nil
+}
+
+func (a *App) saveInfraRun(ctx context.Context, record *InfraRunRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal infrastructure run: %w", err)
+	}
+	if err := a.redisClient.HSet(ctx, infraRunsKey, record.DeploymentID, data).Err(); err != nil {
+		return fmt.Errorf("failed to save infrastructure run: %w", err)
+	}
+	return nil
+}
+
+// hasInfraRepos reports whether any repository deploys through an infrastructure provider
+func (a *App) hasInfraRepos() bool {
+	if a.reposConfig == nil {
+		return false
+	}
+	for _, repoConfig := range a.reposConfig.Repos {
+		if repoConfig.Infra != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// infraProvider returns the provider of a repository's settings, with its credentials resolved
+func (a *App) infraProvider(ctx context.Context, config *InfraConfig) (InfraProvider, error) {
+	secret, err := a.secrets.Secret(ctx, config.TokenSecret)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve %s credentials from the %s secrets provider: %w", config.Provider, a.secrets.Name(), err)
+	}
+	return newInfraProvider(config, secret), nil
+}
+
+// startInfraRun triggers the run that carries out an infrastructure deployment
+func (a *App) startInfraRun(ctx context.Context, d *Deployment, config *InfraConfig) error {
+	provider, err := a.infraProvider(ctx, config)
+	if err != nil {
+		a.failDeployment(ctx, d.ID, err.Error())
+		return err
+	}
+	target := config.target(d.Environment)
+	message := fmt.Sprintf("VibeDeploy deployment %s of %s", d.ID, d.Branch)
+	if d.TriggeredBy != "" {
+		message += " by " + d.TriggeredBy
+	}
+	id, err := provider.Trigger(ctx, target, message)
+	if err != nil {
+		a.failDeployment(ctx, d.ID, fmt.Sprintf(":building_construction: could not start a %s run of %s: %v", provider.Name(), target, err))
+		return fmt.Errorf("failed to trigger %s run: %w", provider.Name(), err)
+	}
+
+	record := &InfraRunRecord{
+		DeploymentID: d.ID, Repository: d.Repository, Environment: d.Environment, Target: target,
+		RunID: id, URL: provider.RunURL(target, id), Phase: InfraPhaseRunning, Channel: d.Channel, Ts: d.Ts,
+	}
+	if err := a.saveInfraRun(ctx, record); err != nil {
+		a.failDeployment(ctx, d.ID, err.Error())
+		return err
+	}
+	text := a.messages.text("infra.started", map[string]interface{}{"Provider": provider.Name(), "Target": target, "URL": record.URL})
+	if err := a.postThreadMessage(ctx, d.Channel, d.Ts, text); err != nil {
+		logError("Error posting infrastructure run of deployment %s: %v", d.ID, err)
+	}
+	logInfo("Started %s run %s of %s for deployment %s", provider.Name(), id, target, d.ID)
+	return nil
+}
+
+// runInfraPolls periodically follows the runs deployments are waiting on
+func (a *App) runInfraPolls(ctx context.Context) {
+	ticker := time.NewTicker(a.config.InfraPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logInfo("Infrastructure run polling context cancelled, exiting")
+			return
+		case <-ticker.C:
+		}
+
+		// Every instance ticks; the first to claim the interval polls
+		claimed, err := a.redisClient.SetNX(ctx, infraPollKey, 1, a.config.InfraPollInterval).Result()
+		if err != nil {
+			logError("Error claiming infrastructure run poll: %v", err)
+			continue
+		}
+		if claimed {
+			a.pollInfraRuns(ctx)
+		}
+	}
+}
+
+// pollInfraRuns moves each deployment on as its run changes phase
+func (a *App) pollInfraRuns(ctx context.Context) {
+	records, err := a.infraRuns(ctx)
+	if err != nil {
+		logError("Error loading infrastructure runs: %v", err)
+		return
+	}
+	for _, record := range records {
+		config := a.repoConfig(record.Repository).Infra
+		if config == nil {
+			logWarn("Repository %s no longer has infra settings, forgetting run %s", record.Repository, record.RunID)
+			a.redisClient.HDel(ctx, infraRunsKey, record.DeploymentID)
+			continue
+		}
+		provider, err := a.infraProvider(ctx, config)
+		if err != nil {
+			logError("Error polling run %s: %v", record.RunID, err)
+			continue
+		}
+		run, err := provider.Run(ctx, record.Target, record.RunID)
+		if err != nil {
+			logWarn("Error polling %s run %s: %v", provider.Name(), record.RunID, err)
+			continue
+		}
+		if run.Phase != record.Phase {
+			a.advanceInfraRun(ctx, provider, record, run)
+		}
+	}
+}
+
+// advanceInfraRun reports a run's new phase and finishes its deployment once the run is over
+func (a *App) advanceInfraRun(ctx context.Context, provider InfraProvider, record *InfraRunRecord, run *InfraRun) {
+	logInfo("%s run %s of deployment %s is %s (%s)", provider.Name(), run.ID, record.DeploymentID, run.Phase, run.State)
+	if run.GitSHA != "" {
+		if _, err := updateDeployment(ctx, a.deployments, record.DeploymentID, func(d *Deployment) {
+			d.Build.GitSHA = run.GitSHA
+		}); err != nil {
+			logError("Error recording commit of deployment %s: %v", record.DeploymentID, err)
+		}
+	}
+
+	switch run.Phase {
+	case InfraPhaseAwaitingApproval:
+		record.Phase = run.Phase
+		if err := a.saveInfraRun(ctx, record); err != nil {
+			logError("Error updating run of deployment %s: %v", record.DeploymentID, err)
+			return
+		}
+		text := a.messages.text("infra.plan", map[string]interface{}{
+			"Target": record.Target, "Summary": run.Summary, "URL": record.URL, "Action": a.infraApprovalAction(record),
+			"ApplyReaction": ApplyReaction, "DiscardReaction": DiscardReaction,
+		})
+		if err := a.postThreadMessage(ctx, record.Channel, record.Ts, text); err != nil {
+			logError("Error posting plan of deployment %s: %v", record.DeploymentID, err)
+		}
+	case InfraPhaseApplied:
+		a.redisClient.HDel(ctx, infraRunsKey, record.DeploymentID)
+		a.finishDeployment(ctx, record.DeploymentID, StatusSucceeded)
+		if err := a.publishSlackReaction(ctx, record.Channel, record.Ts, GearReaction, true); err != nil {
+			logError("Error removing gear reaction: %v", err)
+		}
+		if err := a.publishSlackReaction(ctx, record.Channel, record.Ts, RocketReaction, false); err != nil {
+			logError("Error publishing rocket reaction: %v", err)
+		}
+	case InfraPhaseFailed, InfraPhaseDiscarded:
+		a.redisClient.HDel(ctx, infraRunsKey, record.DeploymentID)
+		a.failDeployment(ctx, record.DeploymentID, fmt.Sprintf(":building_construction: %s run %s ended %s", provider.Name(), run.ID, run.State))
+	default:
+		record.Phase = run.Phase
+		if err := a.saveInfraRun(ctx, record); err != nil {
+			logError("Error updating run of deployment %s: %v", record.DeploymentID, err)
+		}
+	}
+}
+
+// infraApprovalAction is the permission applying a plan takes: approve in environments that require approval
+func (a *App) infraApprovalAction(record *InfraRunRecord) Action {
+	repoConfig := a.repoConfig(record.Repository)
+	if i := repoConfig.environmentIndex(record.Environment); i >= 0 {
+		return promotionAction(&repoConfig.Environments[i])
+	}
+	return ActionDeploy
+}
+
+// decideInfraPlan applies or discards the plan waiting for approval on a deployment's message
+func (a *App) decideInfraPlan(ctx context.Context, reaction, channel, ts, user string) {
+	records, err := a.infraRuns(ctx)
+	if err != nil {
+		logError("Error loading infrastructure runs: %v", err)
+		return
+	}
+	var record *InfraRunRecord
+	for _, r := range records {
+		if r.Channel == channel && r.Ts == ts && r.Phase == InfraPhaseAwaitingApproval {
+			record = r
+		}
+	}
+	if record == nil {
+		logDebug("No plan waiting for approval on message %s in channel %s", ts, channel)
+		return
+	}
+	if action := a.infraApprovalAction(record); !a.authorizeGate(ctx, a.slackIdentities(ctx, user), action, record.Repository, record.Environment) {
+		logInfo("User %s may not %s %s in %s, ignoring %s reaction", user, action, record.Repository, record.Environment, reaction)
+		text := fmt.Sprintf(":lock: Deciding this plan needs the %s permission.", action)
+		if err := a.postThreadMessage(ctx, channel, ts, text); err != nil {
+			logError("Error posting approval notice: %v", err)
+		}
+		return
+	}
+	config := a.repoConfig(record.Repository).Infra
+	if config == nil {
+		return
+	}
+	provider, err := a.infraProvider(ctx, config)
+	if err != nil {
+		logError("Error deciding run %s: %v", record.RunID, err)
+		return
+	}
+
+	comment := fmt.Sprintf("%s from Slack by %s", map[bool]string{true: "Applied", false: "Discarded"}[reaction == ApplyReaction], user)
+	if reaction == ApplyReaction {
+		err = provider.Apply(ctx, record.Target, record.RunID, comment)
+	} else {
+		err = provider.Discard(ctx, record.Target, record.RunID, comment)
+	}
+	if err != nil {
+		logError("Error deciding %s run %s: %v", provider.Name(), record.RunID, err)
+		if postErr := a.postThreadMessage(ctx, channel, ts, fmt.Sprintf(":warning: Could not decide the plan: %v", err)); postErr != nil {
+			logError("Error posting plan notice: %v", postErr)
+		}
+		return
+	}
+
+	key := "infra.applying"
+	if reaction == DiscardReaction {
+		key = "infra.discarded"
+		// Discarding is a decision, not a failure, so the deployment is cancelled
+		a.redisClient.HDel(ctx, infraRunsKey, record.DeploymentID)
+		if _, err := updateDeployment(ctx, a.deployments, record.DeploymentID, func(d *Deployment) {
+			d.CancelledBy = user
+		}); err != nil {
+			logError("Error recording who discarded deployment %s: %v", record.DeploymentID, err)
+		}
+		a.finishDeployment(ctx, record.DeploymentID, StatusCancelled)
+		if err := a.publishSlackReaction(ctx, channel, ts, GearReaction, true); err != nil {
+			logError("Error removing gear reaction: %v", err)
+		}
+		if err := a.publishSlackReaction(ctx, channel, ts, CancelledReaction, false); err != nil {
+			logError("Error publishing %s reaction: %v", CancelledReaction, err)
+		}
+	} else {
+		record.Phase = InfraPhaseRunning
+		if err := a.saveInfraRun(ctx, record); err != nil {
+			logError("Error updating run of deployment %s: %v", record.DeploymentID, err)
+		}
+	}
+	logInfo("User %s decided %s run %s with %s", user, provider.Name(), record.RunID, reaction)
+	if err := a.postThreadMessage(ctx, channel, ts, a.messages.text(key, map[string]interface{}{"User": user, "Target": record.Target})); err != nil {
+		logError("Error posting plan decision: %v", err)
+	}
+}
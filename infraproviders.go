@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// defaultTerraformCloudURL is where Terraform Cloud workspaces live unless infra sets a Terraform Enterprise URL
+const defaultTerraformCloudURL = "https://app.terraform.io"
+
+var infraHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+// newInfraProvider returns the provider of validated infra settings, authenticating with secret
+func newInfraProvider(config *InfraConfig, secret string) InfraProvider {
+	if config.Provider == SpaceliftProviderName {
+		return &SpaceliftProvider{url: strings.TrimRight(config.URL, "/"), keyID: config.APIKeyID, keySecret: secret}
+	}
+	baseURL := defaultTerraformCloudURL
+	if config.URL != "" {
+		baseURL = strings.TrimRight(config.URL, "/")
+	}
+	return &TerraformCloudProvider{url: baseURL, organization: config.Organization, token: secret}
+}
+
+// infraRequest sends a JSON request to a provider's API and decodes the response into out, if given
+func infraRequest(ctx context.Context, method, endpoint, contentType, token string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := infraHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", req.URL.Host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s returned %s: %s", req.URL.Host, resp.Status, strings.TrimSpace(string(message)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// planSummary describes a plan's resource changes the way terraform does
+func planSummary(add, change, destroy int) string {
+	return fmt.Sprintf("+%d ~%d -%d", add, change, destroy)
+}
+
+// TerraformCloudProvider runs workspaces through the Terraform Cloud (or Enterprise) API
+type TerraformCloudProvider struct {
+	url          string
+	organization string
+	token        string
+}
+
+const terraformCloudContentType = "application/vnd.api+json"
+
+func (p *TerraformCloudProvider) Name() string {
+	return TerraformCloudProviderName
+}
+
+func (p *TerraformCloudProvider) request(ctx context.Context, method, path string, body, out interface{}) error {
+	return infraRequest(ctx, method, p.url+"/api/v2"+path, terraformCloudContentType, p.token, body, out)
+}
+
+// Trigger queues a run of the workspace's current configuration
+func (p *TerraformCloudProvider) Trigger(ctx context.Context, workspace, message string) (string, error) {
+	var ws struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := p.request(ctx, http.MethodGet, "/organizations/"+url.PathEscape(p.organization)+"/workspaces/"+url.PathEscape(workspace), nil, &ws); err != nil {
+		return "", fmt.Errorf("failed to find workspace %s: %w", workspace, err)
+	}
+
+	body := map[string]interface{}{
+		"data": map[string]interface{}{
+			"type":       "runs",
+			"attributes": map[string]interface{}{"message": message},
+			"relationships": map[string]interface{}{
+				"workspace": map[string]interface{}{"data": map[string]string{"type": "workspaces", "id": ws.Data.ID}},
+			},
+		},
+	}
+	var run struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := p.request(ctx, http.MethodPost, "/runs", body, &run); err != nil {
+		return "", fmt.Errorf("failed to create run: %w", err)
+	}
+	return run.Data.ID, nil
+}
+
+// Run returns a run's status and, once planned, its resource changes
+func (p *TerraformCloudProvider) Run(ctx context.Context, workspace, id string) (*InfraRun, error) {
+	var response struct {
+		Data struct {
+			Attributes struct {
+				Status  string `json:"status"`
+				Actions struct {
+					IsConfirmable bool `json:"is-confirmable"`
+				} `json:"actions"`
+			} `json:"attributes"`
+		} `json:"data"`
+		Included []struct {
+			Type       string `json:"type"`
+			Attributes struct {
+				Additions    int `json:"resource-additions"`
+				Changes      int `json:"resource-changes"`
+				Destructions int `json:"resource-destructions"`
+			} `json:"attributes"`
+		} `json:"included"`
+	}
+	if err := p.request(ctx, http.MethodGet, "/runs/"+url.PathEscape(id)+"?include=plan", nil, &response); err != nil {
+		return nil, err
+	}
+
+	attributes := response.Data.Attributes
+	run := &InfraRun{ID: id, State: attributes.Status, Phase: InfraPhaseRunning}
+	switch {
+	case attributes.Actions.IsConfirmable:
+		run.Phase = InfraPhaseAwaitingApproval
+	case attributes.Status == "applied" || attributes.Status == "planned_and_finished":
+		run.Phase = InfraPhaseApplied
+	case attributes.Status == "discarded":
+		run.Phase = InfraPhaseDiscarded
+	case attributes.Status == "errored" || attributes.Status == "canceled" || attributes.Status == "force_canceled":
+		run.Phase = InfraPhaseFailed
+	}
+	for _, included := range response.Included {
+		if included.Type == "plans" {
+			run.Summary = planSummary(included.Attributes.Additions, included.Attributes.Changes, included.Attributes.Destructions)
+		}
+	}
+	return run, nil
+}
+
+func (p *TerraformCloudProvider) Apply(ctx context.Context, workspace, id, comment string) error {
+	return p.request(ctx, http.MethodPost, "/runs/"+url.PathEscape(id)+"/actions/apply", map[string]string{"comment": comment}, nil)
+}
+
+func (p *TerraformCloudProvider) Discard(ctx context.Context, workspace, id, comment string) error {
+	return p.request(ctx, http.MethodPost, "/runs/"+url.PathEscape(id)+"/actions/discard", map[string]string{"comment": comment}, nil)
+}
+
+func (p *TerraformCloudProvider) RunURL(workspace, id string) string {
+	return fmt.Sprintf("%s/app/%s/workspaces/%s/runs/%s", p.url, url.PathEscape(p.organization), url.PathEscape(workspace), url.PathEscape(id))
+}
+
+// SpaceliftProvider runs stacks through Spacelift's GraphQL API, authenticating with an API key
+type SpaceliftProvider struct {
+	url       string
+	keyID     string
+	keySecret string
+	// jwt is exchanged for the API key on first use
+	jwt string
+}
+
+func (p *SpaceliftProvider) Name() string {
+	return SpaceliftProviderName
+}
+
+// query runs a GraphQL operation and decodes its data into out
+func (p *SpaceliftProvider) query(ctx context.Context, query string, variables map[string]interface{}, out interface{}) error {
+	if p.jwt == "" && !strings.Contains(query, "apiKeyUser") {
+		var auth struct {
+			APIKeyUser struct {
+				JWT string `json:"jwt"`
+			} `json:"apiKeyUser"`
+		}
+		err := p.query(ctx, `mutation($id: ID!, $secret: String!) { apiKeyUser(id: $id, secret: $secret) { jwt } }`,
+			map[string]interface{}{"id": p.keyID, "secret": p.keySecret}, &auth)
+		if err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+		if auth.APIKeyUser.JWT == "" {
+			return fmt.Errorf("failed to authenticate: API key %s was rejected", p.keyID)
+		}
+		p.jwt = auth.APIKeyUser.JWT
+	}
+
+	var response struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	body := map[string]interface{}{"query": query, "variables": variables}
+	if err := infraRequest(ctx, http.MethodPost, p.url+"/graphql", "application/json", p.jwt, body, &response); err != nil {
+		return err
+	}
+	if len(response.Errors) > 0 {
+		return fmt.Errorf("spacelift: %s", response.Errors[0].Message)
+	}
+	if err := json.Unmarshal(response.Data, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// Trigger queues a tracked run of the stack's branch
+func (p *SpaceliftProvider) Trigger(ctx context.Context, stack, message string) (string, error) {
+	var response struct {
+		RunTrigger struct {
+			ID string `json:"id"`
+		} `json:"runTrigger"`
+	}
+	if err := p.query(ctx, `mutation($stack: ID!) { runTrigger(stack: $stack) { id } }`, map[string]interface{}{"stack": stack}, &response); err != nil {
+		return "", fmt.Errorf("failed to trigger stack %s: %w", stack, err)
+	}
+	return response.RunTrigger.ID, nil
+}
+
+// Run returns a run's state, commit and resource changes
+func (p *SpaceliftProvider) Run(ctx context.Context, stack, id string) (*InfraRun, error) {
+	var response struct {
+		Stack *struct {
+			Run *struct {
+				State  string `json:"state"`
+				Commit struct {
+					Hash string `json:"hash"`
+				} `json:"commit"`
+				Delta *struct {
+					Added   int `json:"added"`
+					Changed int `json:"changed"`
+					Deleted int `json:"deleted"`
+				} `json:"delta"`
+			} `json:"run"`
+		} `json:"stack"`
+	}
+	query := `query($stack: ID!, $run: ID!) { stack(id: $stack) { run(id: $run) { state commit { hash } delta { added changed deleted } } } }`
+	if err := p.query(ctx, query, map[string]interface{}{"stack": stack, "run": id}, &response); err != nil {
+		return nil, err
+	}
+	if response.Stack == nil || response.Stack.Run == nil {
+		return nil, fmt.Errorf("run %s of stack %s not found", id, stack)
+	}
+
+	state := response.Stack.Run
+	run := &InfraRun{ID: id, State: strings.ToLower(state.State), Phase: InfraPhaseRunning, GitSHA: state.Commit.Hash}
+	switch state.State {
+	case "UNCONFIRMED":
+		run.Phase = InfraPhaseAwaitingApproval
+	case "FINISHED":
+		run.Phase = InfraPhaseApplied
+	case "DISCARDED":
+		run.Phase = InfraPhaseDiscarded
+	case "FAILED", "STOPPED", "CANCELED":
+		run.Phase = InfraPhaseFailed
+	}
+	if state.Delta != nil {
+		run.Summary = planSummary(state.Delta.Added, state.Delta.Changed, state.Delta.Deleted)
+	}
+	return run, nil
+}
+
+// Apply confirms an unconfirmed run. Spacelift keeps no comment with the confirmation.
+func (p *SpaceliftProvider) Apply(ctx context.Context, stack, id, comment string) error {
+	var response json.RawMessage
+	return p.query(ctx, `mutation($stack: ID!, $run: ID!) { runConfirm(stack: $stack, run: $run) { id } }`,
+		map[string]interface{}{"stack": stack, "run": id}, &response)
+}
+
+func (p *SpaceliftProvider) Discard(ctx context.Context, stack, id, comment string) error {
+	var response json.RawMessage
+	return p.query(ctx, `mutation($stack: ID!, $run: ID!) { runDiscard(stack: $stack, run: $run) { id } }`,
+		map[string]interface{}{"stack": stack, "run": id}, &response)
+}
+
+func (p *SpaceliftProvider) RunURL(stack, id string) string {
+	return fmt.Sprintf("%s/stack/%s/run/%s", p.url, url.PathEscape(stack), url.PathEscape(id))
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// instancesKey is a Redis hash of instance ID to the latest heartbeat of each running VibeDeploy instance
+const instancesKey = "vibedeploy:instances"
+
+// leaderKey holds the ID of the instance that watches the topology, leased for leaderLeaseBeats heartbeats
+const leaderKey = "vibedeploy:leader"
+
+// leaderLeaseBeats is how many heartbeats the leader's lease lasts, and how many an instance may miss before it
+// drops out of the topology
+const leaderLeaseBeats = 3
+
+// eventConsumersKeyPrefix starts the sets of instances that took each Slack event; a set with more than one
+// member means their claims overlapped, e.g. because a Redis failover lost one
+const eventConsumersKeyPrefix = "vibedeploy:event-consumers:"
+
+// splitBrainKey is a Redis hash of the split-brain conditions detected in the last splitBrainTTL
+const splitBrainKey = "vibedeploy:split-brain"
+
+const splitBrainTTL = time.Hour
+
+// Split-brain conditions
+const (
+	SplitBrainLeaders           = "leaders"
+	SplitBrainOverlappingClaims = "overlapping_claims"
+)
+
+// Heartbeat is what an instance last reported of itself
+type Heartbeat struct {
+	ID          string     `json:"id"`
+	Hostname    string     `json:"hostname"`
+	Image       string     `json:"image,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	SeenAt      time.Time  `json:"seen_at"`
+	LeaderUntil *time.Time `json:"leader_until,omitempty"`
+	Subscribed  bool       `json:"subscribed"`
+	Draining    bool       `json:"draining"`
+	// Consumed counts the Slack events the instance took, and Overlaps those another instance took too
+	Consumed int64 `json:"consumed"`
+	Overlaps int64 `json:"overlaps"`
+}
+
+// SplitBrainCondition is a sign that the instances disagree about who does what
+type SplitBrainCondition struct {
+	Kind       string    `json:"kind"`
+	Instances  []string  `json:"instances"`
+	Event      string    `json:"event,omitempty"`
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// Topology is the instances sharing the Redis server, as served by GET /api/status
+type Topology struct {
+	Leader    string      `json:"leader,omitempty"`
+	Instances []Heartbeat `json:"instances"`
+	// Subscribers is how many clients Redis counts on REDIS_PUBSUB_CHANNEL
+	Subscribers int64                 `json:"subscribers"`
+	SplitBrain  []SplitBrainCondition `json:"split_brain,omitempty"`
+}
+
+// instanceState is what this instance reports in its heartbeats
+type instanceState struct {
+	id         string
+	hostname   string
+	startedAt  time.Time
+	subscribed atomic.Bool
+	draining   atomic.Bool
+	consumed   atomic.Int64
+	overlaps   atomic.Int64
+}
+
+// newInstanceState names this instance INSTANCE_ID, or its hostname with a random suffix, so replicas that
+// share a hostname still tell apart, and returns nil when heartbeats are disabled
+func newInstanceState(config Config) *instanceState {
+	if config.HeartbeatInterval <= 0 {
+		return nil
+	}
+	host, _ := os.Hostname()
+	id := config.InstanceID
+	if id == "" {
+		b := make([]byte, 3)
+		_, _ = rand.Read(b)
+		id = fmt.Sprintf("%s-%s", host, hex.EncodeToString(b))
+	}
+	return &instanceState{id: id, hostname: host, startedAt: time.Now().UTC()}
+}
+
+// markSubscribed notes that the instance takes reaction events
+func (s *instanceState) markSubscribed() {
+	if s != nil {
+		s.subscribed.Store(true)
+	}
+}
+
+// markDraining notes that the instance no longer takes reaction events
+func (s *instanceState) markDraining() {
+	if s != nil {
+		s.draining.Store(true)
+	}
+}
+
+// runHeartbeats reports this instance every HEARTBEAT_INTERVAL; the leader also checks the topology
+func (a *App) runHeartbeats(ctx context.Context) {
+	ticker := time.NewTicker(a.config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		a.heartbeat(ctx)
+
+		select {
+		case <-ctx.Done():
+			logInfo("Heartbeat context cancelled, exiting")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// heartbeat renews the leader lease if this instance holds it or nobody does, and publishes the heartbeat
+func (a *App) heartbeat(ctx context.Context) {
+	if a.instance == nil {
+		return
+	}
+	now := time.Now().UTC()
+	beat := Heartbeat{
+		ID:         a.instance.id,
+		Hostname:   a.instance.hostname,
+		Image:      a.config.SelfImageDigest,
+		StartedAt:  a.instance.startedAt,
+		SeenAt:     now,
+		Subscribed: a.instance.subscribed.Load(),
+		Draining:   a.instance.draining.Load(),
+		Consumed:   a.instance.consumed.Load(),
+		Overlaps:   a.instance.overlaps.Load(),
+	}
+	leader := !beat.Draining && a.renewLeadership(ctx)
+	if leader {
+		until := now.Add(a.leaderLease())
+		beat.LeaderUntil = &until
+	}
+
+	data, err := json.Marshal(beat)
+	if err != nil {
+		logError("Error marshalling heartbeat: %v", err)
+		return
+	}
+	if err := a.redisClient.HSet(ctx, instancesKey, a.instance.id, data).Err(); err != nil {
+		logError("Error publishing heartbeat of %s: %v", a.instance.id, err)
+		return
+	}
+	if leader {
+		a.checkTopology(ctx)
+	}
+}
+
+func (a *App) leaderLease() time.Duration {
+	return leaderLeaseBeats * a.config.HeartbeatInterval
+}
+
+// renewLeadership reports whether this instance holds the leader lease, taking it if it has lapsed
+func (a *App) renewLeadership(ctx context.Context) bool {
+	taken, err := a.redisClient.SetNX(ctx, leaderKey, a.instance.id, a.leaderLease()).Result()
+	if err != nil {
+		logError("Error taking the leader lease: %v", err)
+		return false
+	}
+	if taken {
+		logInfo("Instance %s is now the leader", a.instance.id)
+		return true
+	}
+	holder, err := a.redisClient.Get(ctx, leaderKey).Result()
+	if err != nil || holder != a.instance.id {
+		return false
+	}
+	if err := a.redisClient.Expire(ctx, leaderKey, a.leaderLease()).Err(); err != nil {
+		logError("Error renewing the leader lease: %v", err)
+	}
+	return true
+}
+
+// checkTopology drops the instances that stopped reporting and the split-brain conditions that have aged out,
+// and alerts on two instances both believing they lead
+func (a *App) checkTopology(ctx context.Context) {
+	now := time.Now()
+	beats, err := a.heartbeats(ctx)
+	if err != nil {
+		logError("Error loading heartbeats: %v", err)
+		return
+	}
+	var leaders []string
+	for _, beat := range beats {
+		if now.Sub(beat.SeenAt) > a.leaderLease() {
+			logInfo("Instance %s stopped reporting %s ago", beat.ID, now.Sub(beat.SeenAt).Round(time.Second))
+			if err := a.redisClient.HDel(ctx, instancesKey, beat.ID).Err(); err != nil {
+				logError("Error dropping instance %s: %v", beat.ID, err)
+			}
+			continue
+		}
+		if beat.LeaderUntil != nil && beat.LeaderUntil.After(now) {
+			leaders = append(leaders, beat.ID)
+		}
+	}
+	if len(leaders) > 1 {
+		a.recordSplitBrain(ctx, SplitBrainCondition{Kind: SplitBrainLeaders, Instances: leaders})
+	}
+
+	conditions, err := a.splitBrainConditions(ctx)
+	if err != nil {
+		logError("Error loading split-brain conditions: %v", err)
+		return
+	}
+	for key, c := range conditions {
+		if now.Sub(c.DetectedAt) > splitBrainTTL {
+			if err := a.redisClient.HDel(ctx, splitBrainKey, key).Err(); err != nil {
+				logError("Error dropping split-brain condition %s: %v", key, err)
+			}
+		}
+	}
+}
+
+// claimEvent records that this instance took a Slack event, so an event two instances both took is noticed
+func (a *App) claimEvent(ctx context.Context, eventID string) {
+	if a.instance == nil {
+		return
+	}
+	a.instance.consumed.Add(1)
+	key := eventConsumersKeyPrefix + eventID
+	pipe := a.redisClient.TxPipeline()
+	pipe.SAdd(ctx, key, a.instance.id)
+	pipe.Expire(ctx, key, seenEventTTL)
+	members := pipe.SMembers(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logError("Error recording the consumer of event %s: %v", eventID, err)
+		return
+	}
+	if consumers := members.Val(); len(consumers) > 1 {
+		a.instance.overlaps.Add(1)
+		sort.Strings(consumers)
+		logWarn("Event %s was taken by instances %s", eventID, strings.Join(consumers, ", "))
+		a.recordSplitBrain(ctx, SplitBrainCondition{Kind: SplitBrainOverlappingClaims, Instances: consumers, Event: eventID})
+	}
+}
+
+// recordSplitBrain keeps a split-brain condition for splitBrainTTL, alerting OPS_ALERT_CHANNEL the first time
+// any instance detects it
+func (a *App) recordSplitBrain(ctx context.Context, c SplitBrainCondition) {
+	sort.Strings(c.Instances)
+	c.DetectedAt = time.Now().UTC()
+	data, err := json.Marshal(c)
+	if err != nil {
+		logError("Error marshalling split-brain condition: %v", err)
+		return
+	}
+	key := c.Kind + ":" + strings.Join(c.Instances, ",")
+	if c.Event != "" {
+		key = c.Kind + ":" + c.Event
+	}
+	recorded, err := a.redisClient.HSetNX(ctx, splitBrainKey, key, data).Result()
+	if err != nil {
+		logError("Error recording split-brain condition %s: %v", key, err)
+		return
+	}
+	if !recorded {
+		return
+	}
+	logWarn("Split brain: %s among instances %s", c.Kind, strings.Join(c.Instances, ", "))
+	if a.config.OpsAlertChannel == "" {
+		return
+	}
+	text := a.messages.text("split_brain."+c.Kind, map[string]interface{}{"Instances": strings.Join(c.Instances, "`, `"), "Event": c.Event})
+	if err := a.postThreadMessage(ctx, a.config.OpsAlertChannel, "", text); err != nil {
+		logError("Error posting split-brain alert: %v", err)
+	}
+}
+
+// heartbeats returns the latest heartbeat of every instance, including those that stopped reporting
+func (a *App) heartbeats(ctx context.Context) ([]Heartbeat, error) {
+	entries, err := a.redisClient.HGetAll(ctx, instancesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	beats := make([]Heartbeat, 0, len(entries))
+	for id, data := range entries {
+		var beat Heartbeat
+		if err := json.Unmarshal([]byte(data), &beat); err != nil {
+			logWarn("Skipping unreadable heartbeat of %s: %v", id, err)
+			continue
+		}
+		beats = append(beats, beat)
+	}
+	sort.Slice(beats, func(i, j int) bool { return beats[i].StartedAt.Before(beats[j].StartedAt) })
+	return beats, nil
+}
+
+// splitBrainConditions returns the recorded split-brain conditions by key
+func (a *App) splitBrainConditions(ctx context.Context) (map[string]SplitBrainCondition, error) {
+	entries, err := a.redisClient.HGetAll(ctx, splitBrainKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	conditions := make(map[string]SplitBrainCondition, len(entries))
+	for key, data := range entries {
+		var c SplitBrainCondition
+		if err := json.Unmarshal([]byte(data), &c); err != nil {
+			logWarn("Skipping unreadable split-brain condition %s: %v", key, err)
+			continue
+		}
+		conditions[key] = c
+	}
+	return conditions, nil
+}
+
+// topology returns the instances still reporting, oldest first, and the split-brain conditions of the last
+// splitBrainTTL
+func (a *App) topology(ctx context.Context) (*Topology, error) {
+	beats, err := a.heartbeats(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load heartbeats: %w", err)
+	}
+	conditions, err := a.splitBrainConditions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load split-brain conditions: %w", err)
+	}
+
+	t := &Topology{Instances: make([]Heartbeat, 0, len(beats))}
+	t.Leader, _ = a.redisClient.Get(ctx, leaderKey).Result()
+	for _, beat := range beats {
+		if time.Since(beat.SeenAt) <= a.leaderLease() {
+			t.Instances = append(t.Instances, beat)
+		}
+	}
+	if subscribers, err := a.redisClient.PubSubNumSub(ctx, a.config.RedisPubSub).Result(); err == nil {
+		t.Subscribers = subscribers[a.config.RedisPubSub]
+	}
+	for _, c := range conditions {
+		if time.Since(c.DetectedAt) <= splitBrainTTL {
+			t.SplitBrain = append(t.SplitBrain, c)
+		}
+	}
+	sort.Slice(t.SplitBrain, func(i, j int) bool { return t.SplitBrain[i].DetectedAt.Before(t.SplitBrain[j].DetectedAt) })
+	return t, nil
+}
+
+// handleStatus serves the instances sharing the Redis server
+func (a *App) handleStatus(w http.ResponseWriter, r *http.Request) {
+	t, err := a.topology(r.Context())
+	if err != nil {
+		logError("Error loading topology: %v", err)
+		http.Error(w, "failed to load topology", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+// statusCommand lists the running instances and any split brain among them
+func (a *App) statusCommand(ctx context.Context) *slack.WebhookMessage {
+	if a.instance == nil {
+		return ephemeralReply("Instance heartbeats are disabled, so the other instances are unknown.")
+	}
+	t, err := a.topology(ctx)
+	if err != nil {
+		logError("Error loading topology: %v", err)
+		return ephemeralReply(":warning: Could not load the instances, please try again.")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d instances*, %d subscribed to `%s`\n", len(t.Instances), t.Subscribers, a.config.RedisPubSub)
+	for _, beat := range t.Instances {
+		fmt.Fprintf(&b, "• `%s` on %s, up %s, seen %s ago", beat.ID, beat.Hostname, time.Since(beat.StartedAt).Round(time.Minute), time.Since(beat.SeenAt).Round(time.Second))
+		if beat.Image != "" {
+			fmt.Fprintf(&b, ", image `%s`", shortHash(beat.Image))
+		}
+		if beat.ID == t.Leader {
+			b.WriteString(" :crown: leader")
+		}
+		switch {
+		case beat.Draining:
+			b.WriteString(" :hourglass: draining")
+		case !beat.Subscribed:
+			b.WriteString(" :warning: not subscribed")
+		}
+		if beat.ID == a.instance.id {
+			b.WriteString(" (this one)")
+		}
+		b.WriteString("\n")
+	}
+	for _, c := range t.SplitBrain {
+		fmt.Fprintf(&b, ":rotating_light: Split brain %s ago: ", time.Since(c.DetectedAt).Round(time.Minute))
+		switch c.Kind {
+		case SplitBrainLeaders:
+			fmt.Fprintf(&b, "`%s` all held the leader lease\n", strings.Join(c.Instances, "`, `"))
+		default:
+			fmt.Fprintf(&b, "`%s` all took event `%s`\n", strings.Join(c.Instances, "`, `"), c.Event)
+		}
+	}
+	return ephemeralReply(strings.TrimRight(b.String(), "\n"))
+}
+
+// writeInstanceMetrics writes the topology and this instance's event claims in the Prometheus text format
+func (a *App) writeInstanceMetrics(ctx context.Context, b *strings.Builder) {
+	if a.instance == nil {
+		return
+	}
+	t, err := a.topology(ctx)
+	if err != nil {
+		logError("Error serving instance metrics: %v", err)
+		return
+	}
+	b.WriteString("# HELP vibedeploy_instances Instances reporting heartbeats.\n")
+	b.WriteString("# TYPE vibedeploy_instances gauge\n")
+	fmt.Fprintf(b, "vibedeploy_instances %d\n", len(t.Instances))
+	b.WriteString("# HELP vibedeploy_instance_heartbeat_age_seconds Time since each instance's last heartbeat.\n")
+	b.WriteString("# TYPE vibedeploy_instance_heartbeat_age_seconds gauge\n")
+	for _, beat := range t.Instances {
+		fmt.Fprintf(b, "vibedeploy_instance_heartbeat_age_seconds{instance=%q} %g\n", beat.ID, time.Since(beat.SeenAt).Seconds())
+	}
+	b.WriteString("# HELP vibedeploy_instance_leader Whether each instance holds the leader lease.\n")
+	b.WriteString("# TYPE vibedeploy_instance_leader gauge\n")
+	for _, beat := range t.Instances {
+		leader := 0
+		if beat.ID == t.Leader {
+			leader = 1
+		}
+		fmt.Fprintf(b, "vibedeploy_instance_leader{instance=%q} %d\n", beat.ID, leader)
+	}
+	b.WriteString("# HELP vibedeploy_reaction_subscribers Clients subscribed to the reaction events channel.\n")
+	b.WriteString("# TYPE vibedeploy_reaction_subscribers gauge\n")
+	fmt.Fprintf(b, "vibedeploy_reaction_subscribers %d\n", t.Subscribers)
+	b.WriteString("# HELP vibedeploy_split_brain_conditions Split-brain conditions detected in the last hour.\n")
+	b.WriteString("# TYPE vibedeploy_split_brain_conditions gauge\n")
+	counts := map[string]int{SplitBrainLeaders: 0, SplitBrainOverlappingClaims: 0}
+	for _, c := range t.SplitBrain {
+		counts[c.Kind]++
+	}
+	for _, kind := range []string{SplitBrainLeaders, SplitBrainOverlappingClaims} {
+		fmt.Fprintf(b, "vibedeploy_split_brain_conditions{kind=%q} %d\n", kind, counts[kind])
+	}
+	b.WriteString("# HELP vibedeploy_events_consumed_total Slack events this instance took.\n")
+	b.WriteString("# TYPE vibedeploy_events_consumed_total counter\n")
+	fmt.Fprintf(b, "vibedeploy_events_consumed_total{instance=%q} %d\n", a.instance.id, a.instance.consumed.Load())
+	b.WriteString("# HELP vibedeploy_event_claim_overlaps_total Slack events this instance took that another instance took too.\n")
+	b.WriteString("# TYPE vibedeploy_event_claim_overlaps_total counter\n")
+	fmt.Fprintf(b, "vibedeploy_event_claim_overlaps_total{instance=%q} %d\n", a.instance.id, a.instance.overlaps.Load())
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// configCommand replies with the settings VibeDeploy resolved for a repository, and what stands between the user
+// and deploying it, so a reaction that did nothing can be explained without an operator
+func (a *App) configCommand(ctx context.Context, command slack.SlashCommand, args []string) *slack.WebhookMessage {
+	if len(args) != 1 {
+		return ephemeralReply("Usage: `config <owner/repo>` or `config <message link>`")
+	}
+	repo := args[0]
+	// A PR message stands for its repository
+	if isMessageLink(repo) {
+		_, _, metadata, err := a.resolveMessageLink(ctx, repo)
+		if err != nil {
+			logError("Error resolving %s: %v", repo, err)
+			return ephemeralReply(":warning: Could not read that message; check the link, and that VibeDeploy is in its channel.")
+		}
+		if metadata == nil {
+			return ephemeralReply(":shrug: That message has no PR metadata, so it names no repository.")
+		}
+		repo = metadata.Repository
+	} else {
+		repo = a.canonicalRepo(repo)
+	}
+	identities := a.slackIdentities(ctx, command.UserID)
+	if !a.authorize(identities, ActionView, repo, "") {
+		return ephemeralReply(fmt.Sprintf(":lock: You may not view *%s*.", repo))
+	}
+	repoConfig := a.repoConfig(repo)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%s*", repo)
+	if repoConfig.Profile != "" {
+		fmt.Fprintf(&b, " (profile `%s`)", repoConfig.Profile)
+	}
+	b.WriteString("\n")
+	if a.reposConfig == nil || a.reposConfig.Repos == nil || !a.hasRepoSettings(repo) {
+		b.WriteString("No settings in the repos config; the defaults apply.\n")
+	}
+
+	// Why a reaction might be ignored, in the order a :rocket: is checked
+	switch {
+	case !isRepoAllowed(repo, a.allowedRepos):
+		b.WriteString(":no_entry_sign: Not in `allowed_repos`, so reactions on its PRs are ignored.\n")
+	case !a.authorize(identities, ActionDeploy, repo, ""):
+		b.WriteString(":lock: You may not deploy it; your reactions are ignored.\n")
+	default:
+		b.WriteString(":white_check_mark: You may deploy it.\n")
+	}
+	if err := a.checkHalt(ctx); err != nil {
+		fmt.Fprintf(&b, ":octagonal_sign: Deployments are halted: %s.\n", declinedReason(err))
+	}
+	if gate := repoConfig.Gate; gate != nil {
+		var rules []string
+		if gate.RejectDrafts {
+			rules = append(rules, "not a draft")
+		}
+		if len(gate.RequiredChecks) > 0 {
+			rules = append(rules, "passing `"+strings.Join(gate.RequiredChecks, "`, `")+"`")
+		}
+		if len(rules) > 0 {
+			fmt.Fprintf(&b, ":construction: PRs must be %s.\n", strings.Join(rules, " and "))
+		}
+	}
+
+	b.WriteString("\n*Pipeline*\n")
+	metadata := &PRMetadata{Repository: repo, Branch: "<branch>"}
+	if dir, err := repoConfig.pipelineDir(a.config.BaseDir, metadata, ""); err == nil {
+		fmt.Fprintf(&b, "Runs in `%s`.\n", dir)
+	} else {
+		fmt.Fprintf(&b, ":warning: %v.\n", err)
+	}
+	if repoConfig.Infra != nil {
+		b.WriteString("Infrastructure runs instead of a pipeline; see the repos config.\n")
+	} else {
+		for i, step := range workflowSteps(WorkflowDeploy, metadata, repoConfig, DeployOptions{}, "") {
+			fmt.Fprintf(&b, "%d. `%s`", i+1, redactCommand(step.Command))
+			if timeout := repoConfig.stepTimeout(step.Name, a.config.DefaultStepTimeout); timeout > 0 {
+				fmt.Fprintf(&b, " (timeout %s)", timeout)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	b.WriteString("\n*Environments*\n")
+	environments := repoConfig.Environments
+	if len(environments) == 0 {
+		environments = []EnvironmentConfig{{Name: "default"}}
+	}
+	for i, env := range environments {
+		fmt.Fprintf(&b, "• `%s`", env.Name)
+		if env.Host != "" {
+			fmt.Fprintf(&b, " on host `%s`", env.Host)
+		}
+		if votes := repoConfig.requiredVotes(env.Name); votes > 1 {
+			fmt.Fprintf(&b, ", %d votes", votes)
+		}
+		// A :rocket: is checked without an environment; promotions against the target
+		action, scope := ActionDeploy, ""
+		if i > 0 {
+			action, scope = promotionAction(&environments[i]), env.Name
+		}
+		if action == ActionApprove {
+			b.WriteString(", needs approval")
+		}
+		verb := "deployed"
+		if i > 0 {
+			verb = "promoted"
+		}
+		fmt.Fprintf(&b, ", %s by %s", verb, a.describeHolders(action, repo, scope))
+		if len(env.Settings) > 0 {
+			names := make([]string, 0, len(env.Settings))
+			for name := range env.Settings {
+				value := env.Settings[name]
+				if isSecretKey(name) {
+					value = redactedValue
+				}
+				names = append(names, fmt.Sprintf("%s=%s", name, value))
+			}
+			sort.Strings(names)
+			fmt.Fprintf(&b, "\n    settings: `%s`", strings.Join(names, "`, `"))
+		}
+		if len(env.Secrets) > 0 {
+			names := make([]string, 0, len(env.Secrets))
+			for name := range env.Secrets {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			fmt.Fprintf(&b, "\n    secrets: `%s` %s", strings.Join(names, "`, `"), redactedValue)
+		}
+		b.WriteString("\n")
+	}
+	if len(repoConfig.Owners) > 0 || repoConfig.OnCall != "" {
+		owners := make([]string, 0, len(repoConfig.Owners))
+		for _, owner := range repoConfig.Owners {
+			owners = append(owners, formatMention(owner))
+		}
+		if repoConfig.OnCall != "" {
+			owners = append(owners, "on-call @"+repoConfig.OnCall)
+		}
+		fmt.Fprintf(&b, "Failures tag %s.\n", strings.Join(owners, ", "))
+	}
+
+	b.WriteString("\n*Reactions*\n")
+	for _, r := range a.repoReactions(repoConfig) {
+		fmt.Fprintf(&b, "• :%s: %s\n", r[0], r[1])
+	}
+	return ephemeralReply(strings.TrimRight(b.String(), "\n"))
+}
+
+// hasRepoSettings reports whether the repos config has a section for the repository
+func (a *App) hasRepoSettings(repo string) bool {
+	_, ok := a.reposConfig.Repos[repo]
+	return ok
+}
+
+// describeHolders names who may perform an action in an environment
+func (a *App) describeHolders(action Action, repo, env string) string {
+	if a.reposConfig == nil || a.reposConfig.RBAC == nil {
+		return "anyone (no rbac section)"
+	}
+	holders := a.reposConfig.RBAC.holders(action, repo, env)
+	if len(holders) == 0 {
+		return "nobody"
+	}
+	for i, holder := range holders {
+		if !strings.HasPrefix(holder, "group ") {
+			holders[i] = formatMention(holder)
+		}
+	}
+	return strings.Join(holders, ", ")
+}
+
+// repoReactions lists the reactions that do something on the repository's PR messages, with what each does
+func (a *App) repoReactions(repoConfig RepoConfig) [][2]string {
+	deploy := "deploys"
+	if votes := repoConfig.requiredVotes(repoConfig.defaultEnvironment()); votes > 1 {
+		deploy = fmt.Sprintf("votes to deploy, %d votes needed", votes)
+	}
+	reactions := [][2]string{
+		{RocketReaction, deploy},
+		{CleanBuildReaction, "added before the :" + RocketReaction + ": builds without cache"},
+		{RepeatReaction, "restarts the containers without rebuilding"},
+		{RewindReaction, "redeploys the commit deployed before the current one"},
+		{DiagnosticsReaction, "posts diagnostics"},
+		{DriftReaction, "checks what runs against the deployment on record"},
+	}
+	if len(repoConfig.Environments) > 1 {
+		reactions = append(reactions, [2]string{PromoteReaction, "on a successful deployment, promotes it to the next environment"})
+	}
+	if repoConfig.Infra != nil {
+		reactions = append(reactions, [2]string{ApplyReaction, "applies a planned run"}, [2]string{DiscardReaction, "discards a planned run"})
+	}
+	if repoConfig.EphemeralWorkspaces {
+		reactions = append(reactions, [2]string{KeepReaction, "on an idle notice, keeps the workspace"})
+	}
+
+	// Triggers in the repos config turn built-in reactions off, or start other workflows
+	described := make(map[string]string, len(reactions))
+	for _, r := range reactions {
+		if workflow, ok := reactionWorkflows[r[0]]; ok {
+			described[workflow] = r[1]
+		}
+	}
+	enabled := reactions[:0]
+	for _, r := range reactions {
+		if workflow, ok := reactionWorkflows[r[0]]; !ok || a.triggersWorkflow(r[0], workflow) {
+			enabled = append(enabled, r)
+		}
+	}
+	reactions = enabled
+	if a.reposConfig != nil {
+		emojis := make([]string, 0, len(a.reposConfig.Triggers))
+		for emoji := range a.reposConfig.Triggers {
+			emojis = append(emojis, emoji)
+		}
+		sort.Strings(emojis)
+		for _, emoji := range emojis {
+			workflow := a.reposConfig.Triggers[emoji]
+			if builtin, ok := reactionWorkflows[emoji]; workflow == "" || (ok && builtin == workflow) {
+				continue
+			}
+			text, ok := described[workflow]
+			if !ok {
+				text = fmt.Sprintf("runs the `%s` pipeline", workflow)
+				if pipeline := a.pipeline(workflow); pipeline != nil {
+					text += fmt.Sprintf(", marked :%s: or :%s:", pipeline.successEmoji(), pipeline.failureEmoji())
+				}
+			}
+			reactions = append(reactions, [2]string{emoji, text})
+		}
+	}
+	return append(reactions, [2]string{HaltReaction, "halts all deployments (admins)"})
+}
+
+// triggersWorkflow reports whether a reaction still starts its built-in workflow
+func (a *App) triggersWorkflow(reaction, workflow string) bool {
+	w, ok := a.reactionWorkflow(reaction)
+	return ok && w == workflow
+}
+
+// redactCommand hides secrets a pipeline step could carry
+func redactCommand(command string) string {
+	return slackTokenPattern.ReplaceAllString(command, redactedValue)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// IPFilter restricts which client addresses may use the HTTP listener.
+// When the immediate peer is a trusted reverse proxy, the client address is taken from X-Forwarded-For.
+type IPFilter struct {
+	allowed        []netip.Prefix
+	callbackAllow  []netip.Prefix
+	trustedProxies []netip.Prefix
+}
+
+// parseCIDRs parses a list of CIDRs or bare addresses
+func parseCIDRs(setting string, values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q in %s: %w", value, setting, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q in %s: %w", value, setting, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// newIPFilter returns nil when no allow-list or trusted proxy is configured
+func newIPFilter(config Config) (*IPFilter, error) {
+	if len(config.HTTPAllowedCIDRs) == 0 && len(config.HTTPCallbackCIDRs) == 0 && len(config.HTTPTrustedProxies) == 0 {
+		return nil, nil
+	}
+
+	allowed, err := parseCIDRs("HTTP_ALLOWED_CIDRS", config.HTTPAllowedCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	callbackAllow, err := parseCIDRs("HTTP_CALLBACK_ALLOWED_CIDRS", config.HTTPCallbackCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	trustedProxies, err := parseCIDRs("HTTP_TRUSTED_PROXIES", config.HTTPTrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IPFilter{allowed: allowed, callbackAllow: callbackAllow, trustedProxies: trustedProxies}, nil
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr returns the real client address of a request. X-Forwarded-For is only consulted when the
+// peer is a trusted proxy, and is read right to left so a client cannot spoof its way past the proxies.
+func (f *IPFilter) clientAddr(r *http.Request) (netip.Addr, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid remote address %q: %w", r.RemoteAddr, err)
+	}
+	addr = addr.Unmap()
+
+	if !containsAddr(f.trustedProxies, addr) {
+		return addr, nil
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// Everything left of a malformed entry is untrustworthy
+			return addr, nil
+		}
+		addr = hop.Unmap()
+		if !containsAddr(f.trustedProxies, addr) {
+			return addr, nil
+		}
+	}
+	return addr, nil
+}
+
+// wrap rejects requests from addresses outside the allow-lists and rewrites RemoteAddr to the client address
+func (f *IPFilter) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, err := f.clientAddr(r)
+		if err != nil {
+			logWarn("Rejected HTTP request: %v", err)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		allowed := f.allowed
+		if r.URL.Path == "/executor/callback" && len(f.callbackAllow) > 0 {
+			allowed = f.callbackAllow
+		}
+		if len(allowed) > 0 && !containsAddr(allowed, addr) {
+			logWarn("Rejected %s %s from %s: address not in allow-list", r.Method, r.URL.Path, addr)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		r.RemoteAddr = addr.String()
+		next.ServeHTTP(w, r)
+	})
+}
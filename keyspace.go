@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Areas VibeDeploy's Redis keys are accounted under
+const (
+	KeyspaceHistory  = "history"
+	KeyspaceLogs     = "logs"
+	KeyspaceOutbox   = "outbox"
+	KeyspaceRegistry = "registry"
+	KeyspaceOther    = "other"
+)
+
+var keyspaceAreas = []string{KeyspaceHistory, KeyspaceLogs, KeyspaceOutbox, KeyspaceRegistry, KeyspaceOther}
+
+// keyspaceAreaPrefixes assign keys to areas by prefix; the capture stream is in the logs too, and the rest is other
+var keyspaceAreaPrefixes = []struct {
+	area     string
+	prefixes []string
+}{
+	{KeyspaceHistory, []string{deploymentKeyPrefix, historyKeyPrefix, repositoriesKey, sbomKeyPrefix}},
+	{KeyspaceLogs, []string{deploymentLogKeyPrefix}},
+	{KeyspaceOutbox, []string{eventsStreamKey, heldChannelsKey}},
+	{KeyspaceRegistry, []string{environmentsKey, workspacesKey, poolAllocationsKey, hostOverridesKey, certificatesKey, messageMetadataKey, deployedRefsKey}},
+}
+
+// keyspacePattern matches every key VibeDeploy writes, besides a CAPTURE_STREAM named otherwise
+const keyspacePattern = "vibedeploy:*"
+
+const keyspaceScanCount = 1000
+
+// keyspaceUsageKey is a Redis hash of the latest measurement of each area, so every instance can serve it
+const keyspaceUsageKey = "vibedeploy:keyspace:usage"
+
+// keyspaceLockKey lets one instance measure per KEYSPACE_CHECK_INTERVAL
+const keyspaceLockKey = "vibedeploy:keyspace:lock"
+
+// keyspaceAlertKey limits the warning that the keys near KEYSPACE_MAX_BYTES to one per keyspaceAlertTTL
+const keyspaceAlertKey = "vibedeploy:keyspace:alerted"
+
+const keyspaceAlertTTL = time.Hour
+
+// keyspaceWarnRatio is the share of KEYSPACE_MAX_BYTES past which the ops channel is warned
+const keyspaceWarnRatio = 0.8
+
+// minCaptureEntries is as far as emergency pruning trims the capture stream
+const minCaptureEntries = 1000
+
+// emergencyHistoryPerRepo is how many deployments per repository emergency pruning keeps
+const emergencyHistoryPerRepo = 50
+
+// KeyspaceUsage is the keys of an area and the memory Redis reports for them
+type KeyspaceUsage struct {
+	Keys  int64 `json:"keys"`
+	Bytes int64 `json:"bytes"`
+}
+
+// runKeyspaceChecks periodically measures VibeDeploy's keys, pruning them when they are over budget
+func (a *App) runKeyspaceChecks(ctx context.Context) {
+	ticker := time.NewTicker(a.config.KeyspaceCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		a.checkKeyspace(ctx)
+
+		select {
+		case <-ctx.Done():
+			logInfo("Keyspace check context cancelled, exiting")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkKeyspace measures VibeDeploy's keys, warns as they near KEYSPACE_MAX_BYTES and prunes them past it
+func (a *App) checkKeyspace(ctx context.Context) {
+	claimed, err := a.redisClient.SetNX(ctx, keyspaceLockKey, 1, a.config.KeyspaceCheckInterval).Result()
+	if err != nil {
+		logError("Error claiming the keyspace check: %v", err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	usage, err := a.measureKeyspace(ctx)
+	if err != nil {
+		logError("Error measuring VibeDeploy's Redis keys: %v", err)
+		return
+	}
+	used := keyspaceTotal(usage)
+	logInfo("VibeDeploy's Redis keys use %s: %s", formatBytes(uint64(used)), describeKeyspace(usage))
+
+	limit := a.config.KeyspaceMaxBytes
+	switch {
+	case limit <= 0:
+	case used > limit:
+		logWarn("VibeDeploy's Redis keys are over the %s budget, pruning", formatBytes(uint64(limit)))
+		actions, now := a.pruneKeyspace(ctx, limit)
+		if len(actions) == 0 {
+			actions = []string{"nothing could be pruned"}
+		}
+		a.alertKeyspace(ctx, "keyspace.pruned", map[string]interface{}{
+			"Used": formatBytes(uint64(used)), "Limit": formatBytes(uint64(limit)), "Now": formatBytes(uint64(now)), "Actions": strings.Join(actions, "; "),
+		})
+	case float64(used) > keyspaceWarnRatio*float64(limit):
+		alerted, err := a.redisClient.SetNX(ctx, keyspaceAlertKey, 1, keyspaceAlertTTL).Result()
+		if err != nil || !alerted {
+			return
+		}
+		a.alertKeyspace(ctx, "keyspace.warning", map[string]interface{}{
+			"Used": formatBytes(uint64(used)), "Limit": formatBytes(uint64(limit)), "Areas": describeKeyspace(usage),
+		})
+	}
+}
+
+// measureKeyspace adds up the memory of VibeDeploy's keys by area and records it for /metrics
+func (a *App) measureKeyspace(ctx context.Context) (map[string]KeyspaceUsage, error) {
+	usage := make(map[string]KeyspaceUsage, len(keyspaceAreas))
+	var cursor uint64
+	for {
+		keys, next, err := a.redisClient.Scan(ctx, cursor, keyspacePattern, keyspaceScanCount).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan keys: %w", err)
+		}
+		if err := a.addKeyspaceUsage(ctx, usage, keys); err != nil {
+			return nil, err
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	if stream := a.config.CaptureStream; stream != "" && !strings.HasPrefix(stream, "vibedeploy:") {
+		if err := a.addKeyspaceUsage(ctx, usage, []string{stream}); err != nil {
+			return nil, err
+		}
+	}
+
+	fields := make(map[string]interface{}, len(usage))
+	for area, u := range usage {
+		data, err := json.Marshal(u)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s usage: %w", area, err)
+		}
+		fields[area] = data
+	}
+	pipe := a.redisClient.TxPipeline()
+	pipe.Del(ctx, keyspaceUsageKey)
+	if len(fields) > 0 {
+		pipe.HSet(ctx, keyspaceUsageKey, fields)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		logError("Error recording keyspace usage: %v", err)
+	}
+	return usage, nil
+}
+
+// addKeyspaceUsage adds the memory of keys to their areas; keys deleted meanwhile are skipped
+func (a *App) addKeyspaceUsage(ctx context.Context, usage map[string]KeyspaceUsage, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	pipe := a.redisClient.Pipeline()
+	sizes := make([]*redis.IntCmd, len(keys))
+	for i, key := range keys {
+		sizes[i] = pipe.MemoryUsage(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return fmt.Errorf("failed to measure keys: %w", err)
+	}
+	for i, key := range keys {
+		size, err := sizes[i].Result()
+		if err != nil {
+			continue
+		}
+		area := a.keyspaceArea(key)
+		u := usage[area]
+		u.Keys++
+		u.Bytes += size
+		usage[area] = u
+	}
+	return nil
+}
+
+// keyspaceArea returns the area a key is accounted under
+func (a *App) keyspaceArea(key string) string {
+	if a.config.CaptureStream != "" && key == a.config.CaptureStream {
+		return KeyspaceLogs
+	}
+	for _, area := range keyspaceAreaPrefixes {
+		for _, prefix := range area.prefixes {
+			if strings.HasPrefix(key, prefix) {
+				return area.area
+			}
+		}
+	}
+	return KeyspaceOther
+}
+
+func keyspaceTotal(usage map[string]KeyspaceUsage) int64 {
+	var total int64
+	for _, u := range usage {
+		total += u.Bytes
+	}
+	return total
+}
+
+// describeKeyspace lists the areas from the largest down
+func describeKeyspace(usage map[string]KeyspaceUsage) string {
+	areas := make([]string, 0, len(usage))
+	for area := range usage {
+		areas = append(areas, area)
+	}
+	sort.Slice(areas, func(i, j int) bool { return usage[areas[i]].Bytes > usage[areas[j]].Bytes })
+	parts := make([]string, 0, len(areas))
+	for _, area := range areas {
+		parts = append(parts, fmt.Sprintf("%s %s in %d keys", area, formatBytes(uint64(usage[area].Bytes)), usage[area].Keys))
+	}
+	if len(parts) == 0 {
+		return "no keys"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// pruneKeyspace frees memory, the most expendable data first, until the keys are back under limit: captured
+// payloads, then lifecycle events the audit export already holds, then all but the latest deployments of each
+// repository. The registry of what is running is never pruned. It returns what it did and the memory used after.
+func (a *App) pruneKeyspace(ctx context.Context, limit int64) ([]string, int64) {
+	var actions []string
+	used := func() int64 {
+		usage, err := a.measureKeyspace(ctx)
+		if err != nil {
+			logError("Error measuring VibeDeploy's Redis keys: %v", err)
+			return 0
+		}
+		return keyspaceTotal(usage)
+	}
+
+	if stream := a.config.CaptureStream; stream != "" {
+		before, err := a.redisClient.XLen(ctx, stream).Result()
+		if err != nil {
+			logError("Error reading the length of %s: %v", stream, err)
+		}
+		entries := before
+		for entries >= 2*minCaptureEntries {
+			entries /= 2
+			if err := a.redisClient.XTrimMaxLen(ctx, stream, entries).Err(); err != nil {
+				logError("Error trimming %s: %v", stream, err)
+				break
+			}
+			if now := used(); now <= limit {
+				return append(actions, fmt.Sprintf("trimmed `%s` from %d to %d entries", stream, before, entries)), now
+			}
+		}
+		if entries < before {
+			actions = append(actions, fmt.Sprintf("trimmed `%s` from %d to %d entries", stream, before, entries))
+		}
+	}
+
+	if removed, err := a.trimExportedEvents(ctx); err != nil {
+		logError("Error trimming exported lifecycle events: %v", err)
+	} else if removed > 0 {
+		actions = append(actions, fmt.Sprintf("removed %d lifecycle events already exported", removed))
+		if now := used(); now <= limit {
+			return actions, now
+		}
+	}
+
+	// History kept in a SQL store takes no Redis memory
+	if a.config.StoreBackend == RedisStoreBackend {
+		keep := emergencyHistoryPerRepo
+		if a.config.HistoryMaxPerRepo > 0 && a.config.HistoryMaxPerRepo < keep {
+			keep = a.config.HistoryMaxPerRepo
+		}
+		repos, err := a.deployments.Repositories(ctx)
+		if err != nil {
+			logError("Error listing repositories to prune: %v", err)
+		}
+		total := 0
+		for _, repo := range repos {
+			removed, err := a.deployments.Prune(ctx, repo, time.Time{}, keep)
+			if err != nil {
+				logError("Error pruning history for %s: %v", repo, err)
+				continue
+			}
+			total += removed
+		}
+		if total > 0 {
+			actions = append(actions, fmt.Sprintf("pruned %d deployments, keeping the latest %d of each repository", total, keep))
+		}
+	}
+	return actions, used()
+}
+
+// trimExportedEvents removes the lifecycle events up to the last one the audit export included, keeping the
+// hash the oldest remaining event chains from so the stream still verifies
+func (a *App) trimExportedEvents(ctx context.Context) (int64, error) {
+	lastID, err := a.redisClient.Get(ctx, auditExportedKey).Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the last exported event: %w", err)
+	}
+	// The events after the exported one are kept, so it is the one the remaining stream chains from
+	msgs, err := a.redisClient.XRangeN(ctx, eventsStreamKey, lastID, lastID, 1).Result()
+	if err != nil || len(msgs) == 0 {
+		return 0, err
+	}
+	before, err := a.redisClient.XLen(ctx, eventsStreamKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the length of the events stream: %w", err)
+	}
+
+	pipe := a.redisClient.TxPipeline()
+	pipe.Set(ctx, eventsBaseKey, auditEntryFromMessage(msgs[0]).Hash, 0)
+	pipe.XTrimMinID(ctx, eventsStreamKey, lastID)
+	pipe.XDel(ctx, eventsStreamKey, lastID)
+	length := pipe.XLen(ctx, eventsStreamKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to trim the events stream: %w", err)
+	}
+	return before - length.Val(), nil
+}
+
+// alertKeyspace posts a keyspace message to the ops channel
+func (a *App) alertKeyspace(ctx context.Context, key string, data map[string]interface{}) {
+	if a.config.OpsAlertChannel == "" {
+		return
+	}
+	if err := a.postThreadMessage(ctx, a.config.OpsAlertChannel, "", a.messages.text(key, data)); err != nil {
+		logError("Error posting %s alert: %v", key, err)
+	}
+}
+
+// writeKeyspaceMetrics writes the latest keyspace measurement in the Prometheus text format
+func (a *App) writeKeyspaceMetrics(ctx context.Context, b *strings.Builder) {
+	entries, err := a.redisClient.HGetAll(ctx, keyspaceUsageKey).Result()
+	if err != nil {
+		logError("Error serving keyspace metrics: %v", err)
+		return
+	}
+	if len(entries) == 0 {
+		return
+	}
+	usage := make(map[string]KeyspaceUsage, len(entries))
+	for area, data := range entries {
+		var u KeyspaceUsage
+		if err := json.Unmarshal([]byte(data), &u); err == nil {
+			usage[area] = u
+		}
+	}
+	b.WriteString("# HELP vibedeploy_redis_keyspace_bytes Memory of VibeDeploy's Redis keys by area, as last measured.\n")
+	b.WriteString("# TYPE vibedeploy_redis_keyspace_bytes gauge\n")
+	for _, area := range keyspaceAreas {
+		fmt.Fprintf(b, "vibedeploy_redis_keyspace_bytes{area=%q} %d\n", area, usage[area].Bytes)
+	}
+	b.WriteString("# HELP vibedeploy_redis_keyspace_keys VibeDeploy's Redis keys by area, as last measured.\n")
+	b.WriteString("# TYPE vibedeploy_redis_keyspace_keys gauge\n")
+	for _, area := range keyspaceAreas {
+		fmt.Fprintf(b, "vibedeploy_redis_keyspace_keys{area=%q} %d\n", area, usage[area].Keys)
+	}
+	if a.config.KeyspaceMaxBytes > 0 {
+		b.WriteString("# HELP vibedeploy_redis_keyspace_limit_bytes KEYSPACE_MAX_BYTES, past which VibeDeploy prunes its keys.\n")
+		b.WriteString("# TYPE vibedeploy_redis_keyspace_limit_bytes gauge\n")
+		fmt.Fprintf(b, "vibedeploy_redis_keyspace_limit_bytes %d\n", a.config.KeyspaceMaxBytes)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrDeploymentDeclined is returned when a deployment is refused because of the PR's state, rather than a failure
+var ErrDeploymentDeclined = errors.New("deployment declined")
+
+// LabelRule is what a PR label does to deployments of the PR, from a repository's labels section
+type LabelRule struct {
+	// Block refuses to deploy the PR, e.g. for a no-deploy label
+	Block bool `yaml:"block"`
+	// CleanBuild builds without cache, as if the :snowflake: reaction were present
+	CleanBuild bool `yaml:"clean_build"`
+}
+
+// declinedReason is a declined deployment's reason without the ErrDeploymentDeclined prefix, for replies to users
+func declinedReason(err error) string {
+	return strings.TrimPrefix(err.Error(), ErrDeploymentDeclined.Error()+": ")
+}
+
+// pullRequestLabels returns the names of a pull request's labels
+func (g *GitHubApp) pullRequestLabels(ctx context.Context, repo string, number int) ([]string, error) {
+	token, err := g.token(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	var labels []struct {
+		Name string `json:"name"`
+	}
+	if err := g.do(ctx, token, http.MethodGet, "/repos/"+repo+"/issues/"+strconv.Itoa(number)+"/labels?per_page=100", nil, &labels); err != nil {
+		return nil, fmt.Errorf("failed to list labels of #%d: %w", number, err)
+	}
+	names := make([]string, 0, len(labels))
+	for _, label := range labels {
+		names = append(names, label.Name)
+	}
+	return names, nil
+}
+
+// applyLabelRules adjusts a deployment's options for the PR's labels, returning ErrDeploymentDeclined if a label blocks it.
+// Labels that can't be read are logged and ignored, so a GitHub outage doesn't stop deployments.
+func (a *App) applyLabelRules(ctx context.Context, metadata *PRMetadata, repoConfig RepoConfig, options *DeployOptions) error {
+	if len(repoConfig.Labels) == 0 || a.github == nil || metadata.PRNumber == 0 {
+		return nil
+	}
+
+	labels, err := a.github.pullRequestLabels(ctx, metadata.Repository, metadata.PRNumber)
+	if err != nil {
+		logError("Error reading labels of %s#%d, ignoring label rules: %v", metadata.Repository, metadata.PRNumber, err)
+		return nil
+	}
+
+	var blocking []string
+	for _, label := range labels {
+		rule, ok := repoConfig.Labels[label]
+		if !ok {
+			continue
+		}
+		if rule.Block {
+			blocking = append(blocking, "`"+label+"`")
+		}
+		if rule.CleanBuild && !options.CleanBuild {
+			logInfo("%s#%d is labelled %s, building without cache", metadata.Repository, metadata.PRNumber, label)
+			options.CleanBuild = true
+		}
+	}
+	if len(blocking) > 0 {
+		sort.Strings(blocking)
+		return fmt.Errorf("%w: %s#%d is labelled %s", ErrDeploymentDeclined, metadata.Repository, metadata.PRNumber, strings.Join(blocking, ", "))
+	}
+	return nil
+}
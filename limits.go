@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// shedAlertInterval throttles load-shedding alerts to one per kind per interval
+const shedAlertInterval = 5 * time.Minute
+
+// LoadShedder counts work that was rejected because a bound was reached, and alerts about it
+type LoadShedder struct {
+	mu         sync.Mutex
+	counts     map[string]int64
+	lastAlerts map[string]time.Time
+}
+
+func newLoadShedder() *LoadShedder {
+	return &LoadShedder{counts: make(map[string]int64), lastAlerts: make(map[string]time.Time)}
+}
+
+// shed records that work of the given kind was dropped, logging every time and alerting at most once per interval
+func (a *App) shed(ctx context.Context, kind, detail string) {
+	logWarn("Shedding %s: %s", kind, detail)
+
+	a.shedder.mu.Lock()
+	a.shedder.counts[kind]++
+	total := a.shedder.counts[kind]
+	alert := time.Since(a.shedder.lastAlerts[kind]) >= shedAlertInterval
+	if alert {
+		a.shedder.lastAlerts[kind] = time.Now()
+	}
+	a.shedder.mu.Unlock()
+
+	if !alert || a.config.OpsAlertChannel == "" {
+		return
+	}
+	text := fmt.Sprintf(":warning: VibeDeploy is shedding load: %s (%s). %d shed since startup.", kind, detail, total)
+	if err := a.postThreadMessage(ctx, a.config.OpsAlertChannel, "", text); err != nil {
+		logError("Error posting load shedding alert: %v", err)
+	}
+}
+
+// shedCounts returns a copy of the shed counters
+func (s *LoadShedder) shedCounts() map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[string]int64, len(s.counts))
+	for kind, count := range s.counts {
+		counts[kind] = count
+	}
+	return counts
+}
+
+// activeKey is a sorted set of unfinished deployment IDs scored by start time (ms)
+const activeKey = "vibedeploy:active"
+
+// trackActive adds a started deployment to the active set
+func (a *App) trackActive(ctx context.Context, d *Deployment) {
+	if err := a.redisClient.ZAdd(ctx, activeKey, redis.Z{Score: float64(d.StartedAt.UnixMilli()), Member: d.ID}).Err(); err != nil {
+		logError("Error tracking active deployment %s: %v", d.ID, err)
+	}
+}
+
+// untrackActive removes a finished deployment from the active set
+func (a *App) untrackActive(ctx context.Context, id string) {
+	if err := a.redisClient.ZRem(ctx, activeKey, id).Err(); err != nil {
+		logError("Error untracking deployment %s: %v", id, err)
+	}
+}
+
+// checkDeploymentCapacity rejects a new deployment when too many are already tracked or waiting for a slot
+func (a *App) checkDeploymentCapacity(ctx context.Context) error {
+	if a.config.MaxTrackedDeployments > 0 {
+		// Deployments that never reported back stop counting once their slot would have expired
+		cutoff := time.Now().Add(-a.config.DeploymentSlotTTL).UnixMilli()
+		if err := a.redisClient.ZRemRangeByScore(ctx, activeKey, "-inf", fmt.Sprintf("(%d", cutoff)).Err(); err != nil {
+			return fmt.Errorf("failed to expire active deployments: %w", err)
+		}
+		tracked, err := a.redisClient.ZCard(ctx, activeKey).Result()
+		if err != nil {
+			return fmt.Errorf("failed to count active deployments: %w", err)
+		}
+		if tracked >= int64(a.config.MaxTrackedDeployments) {
+			return fmt.Errorf("%d deployments are already in progress (MAX_TRACKED_DEPLOYMENTS=%d)", tracked, a.config.MaxTrackedDeployments)
+		}
+	}
+
+	if a.config.MaxPendingDeployments > 0 {
+		pending, err := a.redisClient.LLen(ctx, pendingKey).Result()
+		if err != nil {
+			return fmt.Errorf("failed to count pending deployments: %w", err)
+		}
+		if pending >= int64(a.config.MaxPendingDeployments) {
+			return fmt.Errorf("%d deployments are already waiting for a slot (MAX_PENDING_DEPLOYMENTS=%d)", pending, a.config.MaxPendingDeployments)
+		}
+	}
+
+	return nil
+}
+
+// queueReactionEvents moves reaction events from the subscription into a bounded queue,
+// shedding events instead of letting the backlog grow without limit
+func (a *App) queueReactionEvents(ctx context.Context, messages <-chan string, queue chan<- string) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case payload, ok := <-messages:
+			if !ok {
+				return
+			}
+			select {
+			case queue <- payload:
+			default:
+				a.shed(ctx, "reaction events", fmt.Sprintf("event queue is full (MAX_QUEUED_EVENTS=%d)", cap(queue)))
+			}
+		}
+	}
+}
+
+// limitConcurrency caps the number of HTTP requests served at once, answering 503 beyond it
+func (a *App) limitConcurrency(max int, next http.Handler) http.Handler {
+	slots := make(chan struct{}, max)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+			next.ServeHTTP(w, r)
+		default:
+			a.shed(r.Context(), "HTTP requests", fmt.Sprintf("%d requests already in progress (MAX_HTTP_REQUESTS)", max))
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, "server busy", http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// watcherCount is the number of open gRPC WatchDeployments streams
+var watcherCount atomic.Int64
+
+// runStateDump periodically logs the size of VibeDeploy's in-memory and Redis-held state
+func (a *App) runStateDump(ctx context.Context, queue chan string) {
+	ticker := time.NewTicker(a.config.StateDumpInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.dumpState(ctx, queue)
+		}
+	}
+}
+
+func (a *App) dumpState(ctx context.Context, queue chan string) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	pipe := a.redisClient.Pipeline()
+	inFlight := pipe.ZCard(ctx, inFlightKey)
+	pending := pipe.LLen(ctx, pendingKey)
+	active := pipe.ZCard(ctx, activeKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logError("Error reading state sizes: %v", err)
+	}
+
+	counts := a.shedder.shedCounts()
+	kinds := make([]string, 0, len(counts))
+	for kind, count := range counts {
+		kinds = append(kinds, fmt.Sprintf("%s=%d", strings.ReplaceAll(kind, " ", "_"), count))
+	}
+	sort.Strings(kinds)
+
+	logInfo("State: goroutines=%d heap_alloc_mb=%.1f event_queue=%d/%d active=%d in_flight=%d pending=%d grpc_watchers=%d shed=[%s]",
+		runtime.NumGoroutine(), float64(mem.HeapAlloc)/(1<<20), len(queue), cap(queue),
+		active.Val(), inFlight.Val(), pending.Val(), watcherCount.Load(), strings.Join(kinds, " "))
+}
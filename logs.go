@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// deploymentLogKeyPrefix prefixes the Redis list of each running deployment's step output, in order
+const deploymentLogKeyPrefix = "vibedeploy:logs:"
+
+// deploymentLogTTL drops the log of a deployment that never finished
+const deploymentLogTTL = 24 * time.Hour
+
+// appendLog adds a step's processed output to its deployment's log. The inspection steps' output is JSON for the
+// build metadata, which the record and the thread show in their own way.
+func (a *App) appendLog(ctx context.Context, output CommandOutput) {
+	if isBuildMetadataCommand(output.Command) || output.Command == StatsCommand || isScanCommand(output.Command) || isSBOMCommand(output.Command) {
+		return
+	}
+	entry := "$ " + output.Command
+	if text := strings.TrimRight(a.output.process(output.Output), "\n"); strings.TrimSpace(text) != "" {
+		entry += "\n" + text
+	}
+	key := deploymentLogKeyPrefix + output.Metadata.DeploymentID
+	pipe := a.redisClient.TxPipeline()
+	pipe.RPush(ctx, key, entry)
+	pipe.Expire(ctx, key, deploymentLogTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logError("Error recording output of %q for deployment %s: %v", output.Command, output.Metadata.DeploymentID, err)
+	}
+}
+
+// postLog replies in a successful deployment's thread with what its steps printed, keeping the tail if it is too
+// long to post. A failed one gets its failing step's output instead.
+func (a *App) postLog(ctx context.Context, d *Deployment) {
+	if d.Channel == "" || !a.flagEnabled(ctx, FlagThreadLogs, d.Repository, d.TriggeredBy) {
+		return
+	}
+	entries, err := a.redisClient.LRange(ctx, deploymentLogKeyPrefix+d.ID, 0, -1).Result()
+	if err != nil {
+		logError("Error loading the log of deployment %s: %v", d.ID, err)
+		return
+	}
+	if len(entries) == 0 {
+		return
+	}
+	text := fmt.Sprintf(":page_facing_up: Output of the `%s` pipeline\n%s", workflowOf(d), codeBlock(strings.Join(entries, "\n")))
+	if err := a.postThreadMessage(ctx, d.Channel, d.Ts, text); err != nil {
+		logError("Error posting the log of deployment %s: %v", d.ID, err)
+	}
+}
+
+// clearLog drops a deployment's log, once it finished or before a retry runs the pipeline again
+func (a *App) clearLog(ctx context.Context, id string) {
+	if err := a.redisClient.Del(ctx, deploymentLogKeyPrefix+id).Err(); err != nil {
+		logError("Error clearing the log of deployment %s: %v", id, err)
+	}
+}
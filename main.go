@@ -3,36 +3,168 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/slack-go/slack"
 	"gopkg.in/yaml.v3"
+
+	poppitv1 "github.com/its-the-vibe/VibeDeploy/api/poppit/v1"
 )
 
 type Config struct {
 	RedisAddr          string
 	RedisPassword      string
 	SlackToken         string
+	SlackAPIURL        string
 	BaseDir            string
 	RedisPubSub        string
 	RedisListName      string
 	RedisOutputChannel string
 	RedisReactionList  string
+	RedisLinkShared    string
+	RedisSlashCommands string
+	RedisInteractions  string
 	LogLevel           LogLevel
 	AllowedReposConfig string
+	Executor           string
+	QueueEncoding      string
+	WebhookURL         string
+	WebhookSecret      string
+	HTTPAddr           string
+	RequireAPIKeys     bool
+	PoppitQueues       []string
+	MaxConcurrent      int
+	DeploymentSlotTTL  time.Duration
+	DefaultStepTimeout time.Duration
+	StoreBackend       string
+	StoreDSN           string
+
+	PendingDrainInterval time.Duration
+
+	HistoryRetentionDays int
+	HistoryMaxPerRepo    int
+	HistoryPruneInterval time.Duration
+
+	HTTPAllowedCIDRs   []string
+	HTTPCallbackCIDRs  []string
+	HTTPTrustedProxies []string
+
+	PayloadEncryptionKey     string
+	PayloadEncryptionKeyFile string
+
+	GRPCAddr     string
+	GRPCTLSCert  string
+	GRPCTLSKey   string
+	GRPCClientCA string
+
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCSessionTTL   time.Duration
+	OIDCTriggerUsers []string
+	OIDCAdminUsers   []string
+
+	OIDCAllowedDomains      []string
+	OIDCAllowedGroups       []string
+	GitHubLoginClientID     string
+	GitHubLoginClientSecret string
+
+	AuditExportURL      string
+	AuditSigningKey     string
+	AuditExportInterval time.Duration
+
+	MaxTrackedDeployments   int
+	MaxPendingDeployments   int
+	MaxQueuedEvents         int
+	ReactionCoalesceWindow  time.Duration
+	MaxHTTPRequests         int
+	MaxGRPCWatchers         int
+	StateDumpInterval       time.Duration
+	OpsAlertChannel         string
+	DriftCheckInterval      time.Duration
+	IdleCheckInterval       time.Duration
+	IdleAfter               time.Duration
+	IdleTeardownGrace       time.Duration
+	IdleTrafficThreshold    uint64
+	BaseImageCheckInterval  time.Duration
+	InfraPollInterval       time.Duration
+	SelfUpdateImage         string
+	SelfImageDigest         string
+	SelfUpdateCheckInterval time.Duration
+	DrainTimeout            time.Duration
+	InstanceID              string
+	HeartbeatInterval       time.Duration
+	KeyspaceCheckInterval   time.Duration
+	KeyspaceMaxBytes        int64
+	DecisionTraceSize       int
+	DigestHour              int
+
+	// The reaction latency objectives, and the burn rate that alerts OPS_ALERT_CHANNEL
+	SLOTarget        float64
+	SLOGearLatency   time.Duration
+	SLOQueuedLatency time.Duration
+	SLOBurnRate      float64
+
+	MessagesFile     string
+	MessagesLanguage string
+	AccessibleStatus bool
+
+	OPAURL      string
+	OPATimeout  time.Duration
+	OPAFailOpen bool
+
+	GitHubAppID         string
+	GitHubAppPrivateKey string
+	GitHubAPIURL        string
+	PublicURL           string
+	GitHubWebhookSecret string
+
+	PortPool     string
+	HostnamePool []string
+
+	MaxWorkspacesPerRepo int
+	MaxWorkspacesPerUser int
+
+	ProxyProvider      string
+	ProxyUpstreamHost  string
+	TraefikDynamicDir  string
+	TraefikEntryPoints []string
+	CaddyAdminURL      string
+	CaddyServer        string
+
+	SecretsProvider string
+	SecretsDir      string
+
+	ChaosEnabled               bool
+	ChaosDropOutputPercent     int
+	ChaosPublishDelay          time.Duration
+	ChaosSlackRateLimitPercent int
+
+	CaptureDir    string
+	CaptureStream string
 }
 
 const RocketReaction = "rocket"
 const GearReaction = "gear"
+const FailureReaction = "x"
 const VibeDeployType = "vibe-deploy"
 const DeploymentCommand = "docker compose up -d"
 
+// seenEventKeyPrefix marks a Slack event ID as handled for seenEventTTL, which comfortably covers Slack's retries
+const seenEventKeyPrefix = "vibedeploy:seen-event:"
+const seenEventTTL = time.Hour
+
 // LogLevel represents the severity of a log message
 type LogLevel int
 
@@ -108,10 +240,13 @@ func logError(format string, v ...interface{}) {
 }
 
 type ReactionEvent struct {
-	Event struct {
+	EventID   string `json:"event_id"`
+	EventTime int64  `json:"event_time"`
+	Event     struct {
 		Type     string `json:"type"`
 		User     string `json:"user"`
 		Reaction string `json:"reaction"`
+		EventTs  string `json:"event_ts"`
 		Item     struct {
 			Type    string `json:"type"`
 			Channel string `json:"channel"`
@@ -134,29 +269,34 @@ type PRMetadata struct {
 }
 
 type AllowedReposConfig struct {
-	AllowedRepos []string `yaml:"allowed_repos"`
-}
-
-type PoppitCommand struct {
-	Repo     string           `json:"repo"`
-	Branch   string           `json:"branch"`
-	Type     string           `json:"type"`
-	Dir      string           `json:"dir"`
-	Commands []string         `json:"commands"`
-	Metadata *CommandMetadata `json:"metadata,omitempty"`
+	AllowedRepos  []string              `yaml:"allowed_repos"`
+	Repos         map[string]RepoConfig `yaml:"repos"`
+	Profiles      map[string]RepoConfig `yaml:"profiles"`
+	RBAC          *RBACConfig           `yaml:"rbac"`
+	CommandPolicy *CommandPolicyConfig  `yaml:"command_policy"`
+	FeatureFlags  map[string]FlagRule   `yaml:"feature_flags"`
+	Retry         *RetryConfig          `yaml:"retry"`
+	Output        *OutputConfig         `yaml:"output"`
+	Hosts         map[string]HostConfig `yaml:"hosts"`
+	Notifications *NotificationsConfig  `yaml:"notifications"`
+	Catalog       *CatalogConfig        `yaml:"catalog"`
+	Annotations   *AnnotationsConfig    `yaml:"annotations"`
+	FlagService   *FlagServiceConfig    `yaml:"flag_service"`
+	// Pipelines are named command lists, and Triggers map emojis to them or to the built-in workflows
+	Pipelines map[string]*PipelineConfig `yaml:"pipelines"`
+	Triggers  map[string]string          `yaml:"triggers"`
+	// MessageMetadata maps the fields of notifiers that name them differently
+	MessageMetadata *MetadataConfig `yaml:"message_metadata"`
+	// Directories maps owners to the directory under BASE_DIR their repositories are checked out in
+	Directories map[string]string `yaml:"directories"`
 }
 
-type CommandMetadata struct {
-	Channel string `json:"channel"`
-	Ts      string `json:"ts"`
-}
-
-type CommandOutput struct {
-	Metadata *CommandMetadata `json:"metadata"`
-	Type     string           `json:"type"`
-	Command  string           `json:"command"`
-	Output   string           `json:"output"`
-}
+// The Poppit payloads are defined in a versioned package shared with Poppit's side of the queue
+type (
+	PoppitCommand   = poppitv1.Command
+	CommandMetadata = poppitv1.CommandMetadata
+	CommandOutput   = poppitv1.CommandOutput
+)
 
 type SlackReaction struct {
 	Reaction string `json:"reaction"`
@@ -167,17 +307,137 @@ type SlackReaction struct {
 
 func loadConfig() Config {
 	logLevel := parseLogLevel(getEnv("LOG_LEVEL", "INFO"))
+	listName := getEnv("REDIS_LIST_NAME", "poppit-commands")
 	return Config{
 		RedisAddr:          getEnv("REDIS_ADDR", "localhost:6379"),
 		RedisPassword:      getEnv("REDIS_PASSWORD", ""),
 		SlackToken:         getEnv("SLACK_BOT_TOKEN", ""),
+		SlackAPIURL:        getEnv("SLACK_API_URL", ""),
 		BaseDir:            getEnv("BASE_DIR", "/app/repos"),
 		RedisPubSub:        getEnv("REDIS_PUBSUB_CHANNEL", "slack-relay-reaction-added"),
-		RedisListName:      getEnv("REDIS_LIST_NAME", "poppit-commands"),
+		RedisListName:      listName,
 		RedisOutputChannel: getEnv("REDIS_OUTPUT_CHANNEL", "poppit:command-output"),
 		RedisReactionList:  getEnv("REDIS_REACTION_LIST", "slack_reactions"),
+		RedisLinkShared:    getEnv("REDIS_LINK_SHARED_CHANNEL", ""),
+		RedisSlashCommands: getEnv("REDIS_SLASH_COMMAND_CHANNEL", ""),
+		RedisInteractions:  getEnv("REDIS_INTERACTIVITY_CHANNEL", ""),
 		LogLevel:           logLevel,
 		AllowedReposConfig: getEnv("ALLOWED_REPOS_CONFIG", ""),
+		Executor:           strings.ToLower(getEnv("EXECUTOR", PoppitExecutorName)),
+		QueueEncoding:      strings.ToLower(getEnv("QUEUE_ENCODING", QueueEncodingJSON)),
+		WebhookURL:         getEnv("WEBHOOK_URL", ""),
+		WebhookSecret:      getEnv("WEBHOOK_SECRET", ""),
+		HTTPAddr:           getEnv("HTTP_ADDR", ""),
+		RequireAPIKeys:     strings.ToLower(getEnv("REQUIRE_API_KEYS", "true")) != "false",
+		PoppitQueues:       getEnvList("POPPIT_QUEUES", []string{listName}),
+		MaxConcurrent:      getEnvInt("MAX_CONCURRENT_DEPLOYMENTS", 0),
+		DeploymentSlotTTL:  getEnvDuration("DEPLOYMENT_SLOT_TTL", time.Hour),
+		DefaultStepTimeout: getEnvDuration("DEFAULT_STEP_TIMEOUT", 0),
+		StoreBackend:       strings.ToLower(getEnv("STORE_BACKEND", RedisStoreBackend)),
+		StoreDSN:           getEnv("STORE_DSN", ""),
+
+		PendingDrainInterval: getEnvDuration("PENDING_DRAIN_INTERVAL", time.Minute),
+
+		HistoryRetentionDays: getEnvInt("HISTORY_RETENTION_DAYS", 0),
+		HistoryMaxPerRepo:    getEnvInt("HISTORY_MAX_PER_REPO", 0),
+		HistoryPruneInterval: getEnvDuration("HISTORY_PRUNE_INTERVAL", time.Hour),
+
+		HTTPAllowedCIDRs:   getEnvList("HTTP_ALLOWED_CIDRS", nil),
+		HTTPCallbackCIDRs:  getEnvList("HTTP_CALLBACK_ALLOWED_CIDRS", nil),
+		HTTPTrustedProxies: getEnvList("HTTP_TRUSTED_PROXIES", nil),
+
+		PayloadEncryptionKey:     getEnv("PAYLOAD_ENCRYPTION_KEY", ""),
+		PayloadEncryptionKeyFile: getEnv("PAYLOAD_ENCRYPTION_KEY_FILE", ""),
+
+		GRPCAddr:     getEnv("GRPC_ADDR", ""),
+		GRPCTLSCert:  getEnv("GRPC_TLS_CERT", ""),
+		GRPCTLSKey:   getEnv("GRPC_TLS_KEY", ""),
+		GRPCClientCA: getEnv("GRPC_CLIENT_CA", ""),
+
+		OIDCIssuer:       getEnv("OIDC_ISSUER", ""),
+		OIDCClientID:     getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:  getEnv("OIDC_REDIRECT_URL", ""),
+		OIDCSessionTTL:   getEnvDuration("OIDC_SESSION_TTL", 12*time.Hour),
+		OIDCTriggerUsers: getEnvList("OIDC_TRIGGER_USERS", nil),
+		OIDCAdminUsers:   getEnvList("OIDC_ADMIN_USERS", nil),
+
+		OIDCAllowedDomains:      getEnvList("OIDC_ALLOWED_DOMAINS", nil),
+		OIDCAllowedGroups:       getEnvList("OIDC_ALLOWED_GROUPS", nil),
+		GitHubLoginClientID:     getEnv("GITHUB_LOGIN_CLIENT_ID", ""),
+		GitHubLoginClientSecret: getEnv("GITHUB_LOGIN_CLIENT_SECRET", ""),
+
+		AuditExportURL:      getEnv("AUDIT_EXPORT_URL", ""),
+		AuditSigningKey:     getEnv("AUDIT_SIGNING_KEY", ""),
+		AuditExportInterval: getEnvDuration("AUDIT_EXPORT_INTERVAL", time.Hour),
+
+		MaxTrackedDeployments:   getEnvInt("MAX_TRACKED_DEPLOYMENTS", 0),
+		MaxPendingDeployments:   getEnvInt("MAX_PENDING_DEPLOYMENTS", 0),
+		MaxQueuedEvents:         getEnvInt("MAX_QUEUED_EVENTS", 1000),
+		ReactionCoalesceWindow:  getEnvDuration("REACTION_COALESCE_WINDOW", 5*time.Second),
+		MaxHTTPRequests:         getEnvInt("MAX_HTTP_REQUESTS", 256),
+		MaxGRPCWatchers:         getEnvInt("MAX_GRPC_WATCHERS", 100),
+		StateDumpInterval:       getEnvDuration("STATE_DUMP_INTERVAL", 5*time.Minute),
+		OpsAlertChannel:         getEnv("OPS_ALERT_CHANNEL", ""),
+		DriftCheckInterval:      getEnvDuration("DRIFT_CHECK_INTERVAL", 0),
+		IdleCheckInterval:       getEnvDuration("IDLE_CHECK_INTERVAL", 0),
+		IdleAfter:               getEnvDuration("IDLE_AFTER", 24*time.Hour),
+		IdleTeardownGrace:       getEnvDuration("IDLE_TEARDOWN_GRACE", 24*time.Hour),
+		IdleTrafficThreshold:    uint64(getEnvInt("IDLE_TRAFFIC_THRESHOLD", 65536)),
+		BaseImageCheckInterval:  getEnvDuration("BASE_IMAGE_CHECK_INTERVAL", 0),
+		InfraPollInterval:       getEnvDuration("INFRA_POLL_INTERVAL", 15*time.Second),
+		SelfUpdateImage:         getEnv("SELF_UPDATE_IMAGE", ""),
+		SelfImageDigest:         getEnv("SELF_IMAGE_DIGEST", ""),
+		SelfUpdateCheckInterval: getEnvDuration("SELF_UPDATE_CHECK_INTERVAL", time.Hour),
+		DrainTimeout:            getEnvDuration("DRAIN_TIMEOUT", time.Minute),
+		InstanceID:              getEnv("INSTANCE_ID", ""),
+		HeartbeatInterval:       getEnvDuration("HEARTBEAT_INTERVAL", 15*time.Second),
+		KeyspaceCheckInterval:   getEnvDuration("KEYSPACE_CHECK_INTERVAL", 0),
+		KeyspaceMaxBytes:        int64(getEnvInt("KEYSPACE_MAX_BYTES", 0)),
+		DecisionTraceSize:       getEnvInt("DECISION_TRACE_SIZE", 500),
+		SLOTarget:               getEnvFloat("SLO_TARGET", 0.95),
+		SLOGearLatency:          getEnvDuration("SLO_GEAR_LATENCY", 3*time.Second),
+		SLOQueuedLatency:        getEnvDuration("SLO_QUEUED_LATENCY", 5*time.Second),
+		SLOBurnRate:             getEnvFloat("SLO_BURN_RATE", 14.4),
+		DigestHour:              getEnvInt("DIGEST_HOUR", 9),
+
+		MessagesFile:     getEnv("MESSAGES_FILE", ""),
+		MessagesLanguage: getEnv("MESSAGES_LANGUAGE", DefaultMessageLanguage),
+		AccessibleStatus: strings.ToLower(getEnv("ACCESSIBLE_STATUS", "false")) == "true",
+
+		OPAURL:      getEnv("OPA_URL", ""),
+		OPATimeout:  getEnvDuration("OPA_TIMEOUT", 5*time.Second),
+		OPAFailOpen: strings.ToLower(getEnv("OPA_FAIL_OPEN", "false")) == "true",
+
+		GitHubAppID:         getEnv("GITHUB_APP_ID", ""),
+		GitHubAppPrivateKey: getEnv("GITHUB_APP_PRIVATE_KEY", ""),
+		GitHubAPIURL:        getEnv("GITHUB_API_URL", "https://api.github.com"),
+		PublicURL:           getEnv("PUBLIC_URL", ""),
+		GitHubWebhookSecret: getEnv("GITHUB_WEBHOOK_SECRET", ""),
+
+		PortPool:     getEnv("PORT_POOL", ""),
+		HostnamePool: getEnvList("HOSTNAME_POOL", nil),
+
+		MaxWorkspacesPerRepo: getEnvInt("MAX_WORKSPACES_PER_REPO", 0),
+		MaxWorkspacesPerUser: getEnvInt("MAX_WORKSPACES_PER_USER", 0),
+
+		ProxyProvider:      strings.ToLower(getEnv("PROXY_PROVIDER", "")),
+		ProxyUpstreamHost:  getEnv("PROXY_UPSTREAM_HOST", "127.0.0.1"),
+		TraefikDynamicDir:  getEnv("TRAEFIK_DYNAMIC_DIR", ""),
+		TraefikEntryPoints: getEnvList("TRAEFIK_ENTRYPOINTS", nil),
+		CaddyAdminURL:      getEnv("CADDY_ADMIN_URL", ""),
+		CaddyServer:        getEnv("CADDY_SERVER", "srv0"),
+
+		SecretsProvider: strings.ToLower(getEnv("SECRETS_PROVIDER", EnvSecretsProviderName)),
+		SecretsDir:      getEnv("SECRETS_DIR", "/run/secrets"),
+
+		ChaosEnabled:               strings.ToLower(getEnv("CHAOS_ENABLED", "false")) == "true",
+		ChaosDropOutputPercent:     getEnvInt("CHAOS_DROP_OUTPUT_PERCENT", 0),
+		ChaosPublishDelay:          getEnvDuration("CHAOS_PUBLISH_DELAY", 0),
+		ChaosSlackRateLimitPercent: getEnvInt("CHAOS_SLACK_RATE_LIMIT_PERCENT", 0),
+
+		CaptureDir:    getEnv("CAPTURE_DIR", ""),
+		CaptureStream: getEnv("CAPTURE_STREAM", ""),
 	}
 }
 
@@ -188,19 +448,75 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
-// loadAllowedRepos loads the list of allowed repositories from the config file
-// Returns (nil, nil) if no config file is specified or if the file doesn't exist (allow all repos)
-func loadAllowedRepos(configPath string) (map[string]bool, error) {
+// getEnvInt reads an integer environment variable, falling back to the default if unset or invalid
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("[WARN] Invalid integer for %s: %q, using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvFloat reads a decimal environment variable, falling back to the default if unset or invalid
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("[WARN] Invalid number for %s: %q, using default %g", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvDuration reads a duration environment variable (e.g. "90s", "1h"), falling back to the default if unset or invalid
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("[WARN] Invalid duration for %s: %q, using default %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvList reads a comma-separated environment variable, ignoring empty entries
+func getEnvList(key string, defaultValue []string) []string {
+	var values []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	if len(values) == 0 {
+		return defaultValue
+	}
+	return values
+}
+
+// loadReposConfig loads the allowed repositories and per-repo settings from the config file
+// Returns an empty config if no config file is specified or if the file doesn't exist (allow all repos)
+func loadReposConfig(configPath string) (*AllowedReposConfig, error) {
 	// If no config path specified, allow all repos
 	if configPath == "" {
 		logInfo("No allowed repos config specified, allowing all repositories")
-		return nil, nil
+		return &AllowedReposConfig{}, nil
 	}
 
 	// Check if file exists
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		logInfo("Allowed repos config file not found at %s, allowing all repositories", configPath)
-		return nil, nil
+		return &AllowedReposConfig{}, nil
 	}
 
 	// Read the config file
@@ -209,20 +525,172 @@ func loadAllowedRepos(configPath string) (map[string]bool, error) {
 		return nil, fmt.Errorf("failed to read allowed repos config: %w", err)
 	}
 
-	// Parse YAML
+	// Parse YAML, merging in the profiles repositories build on
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse allowed repos config: %w", err)
+	}
+	if err := resolveProfiles(&doc); err != nil {
+		return nil, fmt.Errorf("invalid profiles in allowed repos config: %w", err)
+	}
 	var config AllowedReposConfig
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	if err := doc.Decode(&config); err != nil {
 		return nil, fmt.Errorf("failed to parse allowed repos config: %w", err)
 	}
 
-	// Convert to map for faster lookup
+	if config.AllowedRepos == nil {
+		logInfo("No allowed_repos list in %s, allowing all repositories", configPath)
+	} else {
+		logInfo("Loaded %d allowed repositories from config", len(config.AllowedRepos))
+	}
+	if len(config.Repos) > 0 {
+		logInfo("Loaded settings for %d repositories from config", len(config.Repos))
+	}
+	if len(config.Profiles) > 0 {
+		logInfo("Loaded %d repository profiles from config", len(config.Profiles))
+	}
+	for repo, repoConfig := range config.Repos {
+		if repoConfig.TLS != nil {
+			if err := repoConfig.TLS.validate(); err != nil {
+				return nil, fmt.Errorf("invalid tls settings for %s: %w", repo, err)
+			}
+		}
+		if repoConfig.Registry != nil {
+			if err := repoConfig.Registry.validate(); err != nil {
+				return nil, fmt.Errorf("invalid registry settings for %s: %w", repo, err)
+			}
+		}
+		if repoConfig.Git != nil {
+			if err := repoConfig.Git.validate(); err != nil {
+				return nil, fmt.Errorf("invalid git settings for %s: %w", repo, err)
+			}
+		}
+		if repoConfig.Commands != nil {
+			if repoConfig.Infra != nil {
+				return nil, fmt.Errorf("%s has commands, but infra deployments don't run a pipeline", repo)
+			}
+			if err := repoConfig.Commands.validate(); err != nil {
+				return nil, fmt.Errorf("invalid commands for %s: %w", repo, err)
+			}
+		}
+		if repoConfig.BaseImages != nil {
+			if err := repoConfig.BaseImages.validate(); err != nil {
+				return nil, fmt.Errorf("invalid base_images settings for %s: %w", repo, err)
+			}
+		}
+		if repoConfig.Catalog != nil {
+			if config.Catalog == nil {
+				return nil, fmt.Errorf("%s has catalog settings, but there is no top-level catalog section", repo)
+			}
+			if err := repoConfig.Catalog.validate(); err != nil {
+				return nil, fmt.Errorf("invalid catalog settings for %s: %w", repo, err)
+			}
+		}
+		if repoConfig.Annotations != nil && config.Annotations == nil {
+			return nil, fmt.Errorf("%s has annotations settings, but there is no top-level annotations section", repo)
+		}
+		if repoConfig.Flags != nil && config.FlagService == nil {
+			return nil, fmt.Errorf("%s has flags settings, but there is no top-level flag_service section", repo)
+		}
+		if repoConfig.Votes < 0 {
+			return nil, fmt.Errorf("invalid votes for %s: %d is negative", repo, repoConfig.Votes)
+		}
+		if repoConfig.MaxWorkspaces < 0 {
+			return nil, fmt.Errorf("invalid max_workspaces for %s: %d is negative", repo, repoConfig.MaxWorkspaces)
+		}
+		if repoConfig.Infra != nil {
+			if err := repoConfig.Infra.validate(); err != nil {
+				return nil, fmt.Errorf("invalid infra settings for %s: %w", repo, err)
+			}
+		}
+		if repoConfig.Provenance != nil {
+			if err := repoConfig.Provenance.validate(); err != nil {
+				return nil, fmt.Errorf("invalid provenance settings for %s: %w", repo, err)
+			}
+		}
+		if repoConfig.SecurityScan != nil {
+			if err := repoConfig.SecurityScan.validate(); err != nil {
+				return nil, fmt.Errorf("invalid security_scan settings for %s: %w", repo, err)
+			}
+		}
+		if repoConfig.StatusPage != nil {
+			if err := repoConfig.StatusPage.validate(); err != nil {
+				return nil, fmt.Errorf("invalid status_page settings for %s: %w", repo, err)
+			}
+		}
+		if err := validateEnvironments(repoConfig.Environments); err != nil {
+			return nil, fmt.Errorf("invalid environments for %s: %w", repo, err)
+		}
+		for _, env := range repoConfig.Environments {
+			if _, ok := config.Hosts[env.Host]; env.Host != "" && !ok {
+				return nil, fmt.Errorf("invalid environments for %s: %q deploys to unknown host %q", repo, env.Name, env.Host)
+			}
+		}
+		if err := repoConfig.validateSchedules(); err != nil {
+			return nil, fmt.Errorf("invalid schedules for %s: %w", repo, err)
+		}
+	}
+	if err := validateHosts(config.Hosts); err != nil {
+		return nil, err
+	}
+	if err := validateDirectories(config.Directories, config.Repos); err != nil {
+		return nil, err
+	}
+	if err := validatePipelines(config.Pipelines, config.Triggers); err != nil {
+		return nil, err
+	}
+	if len(config.Pipelines) > 0 || len(config.Triggers) > 0 {
+		logInfo("Loaded %d pipelines and %d triggers from config", len(config.Pipelines), len(config.Triggers))
+	}
+	if config.RBAC != nil {
+		if err := config.RBAC.validate(); err != nil {
+			return nil, err
+		}
+		logInfo("Loaded %d RBAC role bindings from config", len(config.RBAC.Bindings))
+	}
+	if err := validateFeatureFlags(config.FeatureFlags); err != nil {
+		return nil, err
+	}
+	if config.Notifications != nil {
+		if err := config.Notifications.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if config.Catalog != nil {
+		if err := config.Catalog.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if config.Annotations != nil {
+		if err := config.Annotations.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if config.FlagService != nil {
+		if err := config.FlagService.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if config.MessageMetadata != nil {
+		if err := config.MessageMetadata.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &config, nil
+}
+
+// allowedRepoSet converts the allowlist to a map for faster lookup
+// Returns nil if the config has no allowed_repos list (allow all repos)
+func (c *AllowedReposConfig) allowedRepoSet() map[string]bool {
+	if c.AllowedRepos == nil {
+		return nil
+	}
+
 	allowedRepos := make(map[string]bool)
-	for _, repo := range config.AllowedRepos {
+	for _, repo := range c.AllowedRepos {
 		allowedRepos[repo] = true
 	}
-
-	logInfo("Loaded %d allowed repositories from config", len(allowedRepos))
-	return allowedRepos, nil
+	return allowedRepos
 }
 
 // isRepoAllowed checks if a repository is in the allowed list
@@ -237,18 +705,54 @@ func isRepoAllowed(repo string, allowedRepos map[string]bool) bool {
 	return allowedRepos[repo]
 }
 
+// App holds the long-lived clients and configuration shared by the event handlers
+type App struct {
+	config       Config
+	redisClient  *redis.Client
+	slackClient  *slack.Client
+	executor     Executor
+	hosts        map[string]Executor
+	deployments  DeploymentStore
+	limiter      *ConcurrencyLimiter
+	allowedRepos map[string]bool
+	reposConfig  *AllowedReposConfig
+	oidc         *OIDCAuth
+	policy       *CommandPolicy
+	cipher       *PayloadCipher
+	shedder      *LoadShedder
+	github       *GitHubApp
+	pool         *AllocationPool
+	proxy        RouteProvider
+	secrets      SecretsProvider
+	retry        *RetryPolicy
+	output       *OutputFilter
+	instance     *instanceState
+	chaos        *Chaos
+	capture      *Capture
+	messages     *MessageCatalog
+	opa          *OPAPolicy
+}
+
 func main() {
 	config := loadConfig()
 
 	// Set the global log level
 	currentLogLevel = config.LogLevel
 
+	// Run an admin subcommand instead of the service if one was given
+	if len(os.Args) > 1 {
+		if err := runSubcommand(config, os.Args[1], os.Args[2:]); err != nil {
+			log.Fatalf("%s: %v", os.Args[1], err)
+		}
+		return
+	}
+
 	if config.SlackToken == "" {
 		log.Fatal("SLACK_BOT_TOKEN environment variable is required")
 	}
 
 	// Load allowed repos configuration
-	allowedRepos, err := loadAllowedRepos(config.AllowedReposConfig)
+	reposConfig, err := loadReposConfig(config.AllowedReposConfig)
 	if err != nil {
 		log.Fatalf("Failed to load allowed repos configuration: %v", err)
 	}
@@ -269,17 +773,281 @@ func main() {
 	}
 	logInfo("Connected to Redis at %s", config.RedisAddr)
 
+	// Failure injection for integration tests and game days
+	chaos := newChaos(config)
+	if chaos != nil {
+		logWarn("Chaos enabled: dropping %d%% of command output, delaying publishes by %s, rate limiting %d%% of Slack calls",
+			chaos.dropOutputPercent, chaos.publishDelay, chaos.slackRateLimitPercent)
+	}
+
 	// Setup Slack client
-	slackClient := slack.New(config.SlackToken)
+	var slackOptions []slack.Option
+	if config.SlackAPIURL != "" {
+		slackOptions = append(slackOptions, slack.OptionAPIURL(strings.TrimSuffix(config.SlackAPIURL, "/")+"/"))
+	}
+	if chaos != nil {
+		slackOptions = append(slackOptions, slack.OptionHTTPClient(chaos.slackHTTPClient()))
+	}
+	slackClient := slack.New(config.SlackToken, slackOptions...)
+
+	// Load the message texts, with any overrides and translation
+	messageCatalog, err := newMessageCatalog(config)
+	if err != nil {
+		log.Fatalf("Failed to load messages: %v", err)
+	}
+	if config.MessagesFile != "" {
+		logInfo("Using messages from %s in %s", config.MessagesFile, messageCatalog.language)
+	}
+
+	// Setup optional encryption of payloads stored in Redis
+	payloadCipher, err := newPayloadCipher(config)
+	if err != nil {
+		log.Fatalf("Failed to configure payload encryption: %v", err)
+	}
+	if payloadCipher != nil {
+		logInfo("Encrypting Redis queue payloads with key %s", payloadCipher.keyID)
+	}
+
+	// Setup the executor that runs generated deployment commands
+	executor, err := newExecutor(config, redisClient, payloadCipher)
+	if err != nil {
+		log.Fatalf("Failed to configure executor: %v", err)
+	}
+	if chaos != nil {
+		executor = &chaosExecutor{next: executor, chaos: chaos}
+	}
+	logInfo("Using %s executor", executor.Name())
+
+	// Tee live traffic for debugging, if asked to
+	capture, err := newCapture(config, redisClient)
+	if err != nil {
+		log.Fatalf("Failed to configure traffic capture: %v", err)
+	}
+	if capture != nil {
+		executor = &captureExecutor{next: executor, capture: capture}
+		logWarn("Capturing consumed and published payloads to %s", capture.target())
+	}
+
+	// Setup the deployment history store
+	deployments, err := newDeploymentStore(config, redisClient)
+	if err != nil {
+		log.Fatalf("Failed to open %s deployment store: %v", config.StoreBackend, err)
+	}
+	logInfo("Using %s deployment store", config.StoreBackend)
+
+	app := &App{
+		config:       config,
+		redisClient:  redisClient,
+		slackClient:  slackClient,
+		executor:     executor,
+		deployments:  deployments,
+		allowedRepos: reposConfig.allowedRepoSet(),
+		reposConfig:  reposConfig,
+		cipher:       payloadCipher,
+		shedder:      newLoadShedder(),
+		chaos:        chaos,
+		capture:      capture,
+		messages:     messageCatalog,
+		instance:     newInstanceState(config),
+	}
+	if config.MaxConcurrent > 0 {
+		app.limiter = &ConcurrencyLimiter{redisClient: redisClient, max: config.MaxConcurrent, slotTTL: config.DeploymentSlotTTL}
+		logInfo("Limiting to %d concurrent deployments", config.MaxConcurrent)
+	}
+	app.policy, err = newCommandPolicy(reposConfig.CommandPolicy)
+	if err != nil {
+		log.Fatalf("Failed to load command policy: %v", err)
+	}
+	app.retry, err = newRetryPolicy(reposConfig.Retry)
+	if err != nil {
+		log.Fatalf("Failed to load retry patterns: %v", err)
+	}
+	if app.retry != nil {
+		logInfo("Retrying deployments once on %d transient failure patterns", len(app.retry.patterns))
+	}
+	app.output, err = newOutputFilter(reposConfig.Output)
+	if err != nil {
+		log.Fatalf("Failed to load output processors: %v", err)
+	}
+	app.oidc, err = newOIDCAuth(ctx, config, redisClient)
+	if err != nil {
+		log.Fatalf("Failed to configure OIDC login: %v", err)
+	}
+	if app.oidc != nil && config.OIDCIssuer != "" {
+		logInfo("Dashboard login enabled via OIDC issuer %s", config.OIDCIssuer)
+	} else if app.oidc != nil {
+		logInfo("Dashboard login enabled via GitHub")
+	}
+	app.github, err = newGitHubApp(config)
+	if err != nil {
+		log.Fatalf("Failed to configure GitHub App: %v", err)
+	}
+	if app.github != nil {
+		logInfo("Reporting deployments as GitHub check runs for app %s", config.GitHubAppID)
+	}
+	app.opa, err = newOPAPolicy(config)
+	if err != nil {
+		log.Fatalf("Failed to configure deployment policy: %v", err)
+	}
+	if app.opa != nil {
+		logInfo("Checking deployments against the OPA policy at %s", config.OPAURL)
+	}
+	app.pool, err = newAllocationPool(config)
+	if err != nil {
+		log.Fatalf("Failed to configure allocation pool: %v", err)
+	}
+	if app.pool != nil {
+		logInfo("Allocating from a pool of %d ports and %d hostnames", len(app.pool.ports), len(app.pool.hostnames))
+	}
+	app.proxy, err = newRouteProvider(config)
+	if err != nil {
+		log.Fatalf("Failed to configure reverse proxy: %v", err)
+	}
+	if app.proxy != nil {
+		logInfo("Publishing preview routes to %s", app.proxy.Name())
+	}
+	app.secrets, err = newSecretsProvider(config)
+	if err != nil {
+		log.Fatalf("Failed to configure secrets provider: %v", err)
+	}
+	app.hosts, err = app.newHostExecutors(reposConfig.Hosts, redisClient)
+	if err != nil {
+		log.Fatalf("Failed to configure hosts: %v", err)
+	}
+	for name, executor := range app.hosts {
+		if chaos != nil {
+			executor = &chaosExecutor{next: executor, chaos: chaos}
+		}
+		if capture != nil {
+			executor = &captureExecutor{next: executor, capture: capture}
+		}
+		app.hosts[name] = executor
+		logInfo("Deploying to host %s via %s executor", name, executor.Name())
+	}
 
 	// Subscribe to Redis pub/sub channel
 	pubsub := redisClient.Subscribe(ctx, config.RedisPubSub)
 	defer pubsub.Close()
 
 	logInfo("Subscribed to Redis channel: %s (log level: %s)", config.RedisPubSub, config.LogLevel.String())
+	if _, err := pubsub.Receive(ctx); err != nil {
+		log.Fatalf("Failed to subscribe to %s: %v", config.RedisPubSub, err)
+	}
+	app.takeOver(ctx)
+	app.instance.markSubscribed()
 
 	// Start command output listener in a goroutine
-	go listenForCommandOutput(ctx, redisClient, config)
+	go app.listenForCommandOutput(ctx)
+
+	// Start the step timeout watchdog
+	go app.runWatchdog(ctx)
+
+	// Unfurl preview environment links when link_shared events are relayed
+	if config.RedisLinkShared != "" {
+		go app.listenForLinkShared(ctx)
+	}
+
+	// Handle slash commands such as incident mode when they are relayed
+	if config.RedisSlashCommands != "" {
+		go app.listenForSlashCommands(ctx)
+	}
+
+	// Handle the deploy shortcut and its modal when interactivity payloads are relayed
+	if config.RedisInteractions != "" {
+		go app.listenForInteractions(ctx)
+	}
+
+	// Periodically compare what's running with the deployments on record
+	if config.DriftCheckInterval > 0 {
+		logInfo("Checking deployments for drift every %s", config.DriftCheckInterval)
+		go app.runDriftChecks(ctx)
+	}
+	if config.IdleCheckInterval > 0 {
+		logInfo("Checking workspaces for traffic every %s", config.IdleCheckInterval)
+		go app.runIdleChecks(ctx)
+	}
+
+	// Post notifications held back during channels' quiet hours once they end
+	if len(app.notificationsConfig().QuietHours) > 0 {
+		go app.runQuietHours(ctx)
+	}
+
+	// Offer rebuilds when the base images repositories build from are updated
+	if config.BaseImageCheckInterval > 0 && len(app.baseImageRepos()) > 0 {
+		logInfo("Checking base images for updates every %s", config.BaseImageCheckInterval)
+		go app.runBaseImageChecks(ctx)
+	}
+
+	// Report this instance to the others and watch for split brain among them
+	if app.instance != nil {
+		logInfo("Publishing heartbeats as instance %s every %s", app.instance.id, config.HeartbeatInterval)
+		go app.runHeartbeats(ctx)
+	}
+
+	// Measure VibeDeploy's share of Redis, pruning it when it outgrows its budget
+	if config.KeyspaceCheckInterval > 0 {
+		logInfo("Checking VibeDeploy's Redis keys every %s", config.KeyspaceCheckInterval)
+		go app.runKeyspaceChecks(ctx)
+	}
+
+	// Tell the ops channel when a newer VibeDeploy image is published
+	if config.SelfUpdateImage != "" && config.SelfUpdateCheckInterval > 0 {
+		if _, err := parseImageReference(config.SelfUpdateImage); err != nil {
+			log.Fatalf("Invalid SELF_UPDATE_IMAGE: %v", err)
+		}
+		logInfo("Checking %s for updates every %s", config.SelfUpdateImage, config.SelfUpdateCheckInterval)
+		go app.runSelfUpdateChecks(ctx)
+	}
+
+	// Follow the Terraform Cloud and Spacelift runs infrastructure deployments wait on
+	if config.InfraPollInterval > 0 && app.hasInfraRepos() {
+		logInfo("Polling infrastructure runs every %s", config.InfraPollInterval)
+		go app.runInfraPolls(ctx)
+	}
+
+	// DM the deployment digests users subscribed to with the slash command
+	if config.RedisSlashCommands != "" {
+		go app.runDigests(ctx)
+	}
+
+	// Rebuild branches on their repositories' schedules
+	if app.hasSchedules() {
+		go app.runSchedules(ctx)
+	}
+
+	// Dispatch waiting deployments into slots freed by expiry, which no finished deployment releases
+	if app.limiter != nil && config.PendingDrainInterval > 0 {
+		go app.runPendingDrains(ctx)
+	}
+
+	// Start background history pruning if a retention policy is configured
+	if config.HistoryRetentionDays > 0 || config.HistoryMaxPerRepo > 0 {
+		go app.runRetention(ctx)
+	}
+
+	// Start the signed audit batch export if a destination is configured
+	auditExporter, err := newAuditExporter(config, redisClient)
+	if err != nil {
+		log.Fatalf("Failed to configure audit export: %v", err)
+	}
+	if auditExporter != nil {
+		logInfo("Exporting signed audit batches to %s every %s", config.AuditExportURL, config.AuditExportInterval)
+		go auditExporter.run(ctx)
+	}
+
+	// Start the HTTP server if a listen address is configured
+	if config.HTTPAddr != "" {
+		go app.runHTTPServer(ctx)
+	}
+
+	// Start the gRPC API if a listen address is configured
+	if config.GRPCAddr != "" {
+		grpcServer, err := newGRPCServer(app)
+		if err != nil {
+			log.Fatalf("Failed to configure gRPC server: %v", err)
+		}
+		go app.runGRPCServer(ctx, grpcServer)
+	}
 
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -288,94 +1056,576 @@ func main() {
 	go func() {
 		<-sigChan
 		logInfo("Shutting down...")
-		cancel()
+		// A second signal stops right away
+		go func() {
+			<-sigChan
+			logInfo("Stopping without draining")
+			cancel()
+		}()
+		app.drainForRestart(ctx, pubsub)
+	}()
+
+	// Buffer incoming reactions in a bounded queue so a burst can't grow memory without limit
+	queueSize := config.MaxQueuedEvents
+	if queueSize <= 0 {
+		queueSize = 1
+	}
+	messages := make(chan string)
+	queue := make(chan string, queueSize)
+	go func() {
+		for msg := range pubsub.Channel() {
+			app.capture.consumed(ctx, app.cipher, CaptureReaction, msg.Channel, []byte(msg.Payload))
+			messages <- msg.Payload
+		}
+		close(messages)
+	}()
+	go func() {
+		app.queueReactionEvents(ctx, messages, queue)
+		close(queue)
 	}()
 
+	// Periodically log the size of in-flight state
+	if config.StateDumpInterval > 0 {
+		go app.runStateDump(ctx, queue)
+	}
+
+	// Alert when reactions get slow enough to burn the latency objectives' error budget
+	if config.SLOBurnRate > 0 {
+		go app.runSLOChecks(ctx)
+	}
+
 	// Process messages
-	ch := pubsub.Channel()
 	for {
 		select {
 		case <-ctx.Done():
 			logInfo("Context cancelled, exiting")
 			return
-		case msg := <-ch:
-			if msg == nil {
-				continue
+		case payload, ok := <-queue:
+			if !ok {
+				// Unsubscribed to restart, and every buffered event is processed
+				logInfo("Drained reaction events, exiting")
+				return
 			}
 			logDebug("Received message from channel: %s", config.RedisPubSub)
-			processReactionEvent(ctx, msg.Payload, slackClient, redisClient, config, allowedRepos)
+			app.processReactionEvent(ctx, payload)
 		}
 	}
 }
 
-func processReactionEvent(ctx context.Context, payload string, slackClient *slack.Client, redisClient *redis.Client, config Config, allowedRepos map[string]bool) {
+func (a *App) processReactionEvent(ctx context.Context, payload string) {
+	plaintext, err := a.cipher.open([]byte(payload))
+	if err != nil {
+		logError("Error decrypting reaction event: %v", err)
+		return
+	}
+
 	var event ReactionEvent
-	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+	if err := json.Unmarshal(plaintext, &event); err != nil {
 		logError("Error parsing reaction event: %v", err)
 		return
 	}
 
-	// Only process rocket emoji reactions
-	if event.Event.Reaction != RocketReaction {
-		logDebug("Ignoring reaction: %s (not %s)", event.Event.Reaction, RocketReaction)
+	// Each check is traced, so `why` can explain a reaction that did nothing
+	decision := newDecision(event)
+	defer a.recordDecision(ctx, decision)
+
+	// Only process reactions that start a workflow
+	workflow, ok := a.reactionWorkflow(event.Event.Reaction)
+	if !ok && event.Event.Reaction != HaltReaction {
+		logDebug("Ignoring reaction: %s (not a trigger)", event.Event.Reaction)
+		decision.fail(DecisionIgnored, "reaction", ":%s: starts nothing", event.Event.Reaction)
 		return
 	}
+	if workflow == "" {
+		decision.pass("reaction", ":%s: halts deployments", event.Event.Reaction)
+	} else {
+		decision.Workflow = workflow
+		decision.pass("reaction", ":%s: starts %s", event.Event.Reaction, workflow)
+	}
 
 	// Only process message items
 	if event.Event.Item.Type != "message" {
 		logDebug("Ignoring item type: %s (not message)", event.Event.Item.Type)
+		decision.fail(DecisionIgnored, "item type", "%s, not a message", event.Event.Item.Type)
 		return
 	}
+	decision.pass("item type", "message")
 
 	// Check if the reaction is from the bot itself by comparing with authorizations
 	for _, auth := range event.Authorizations {
 		if auth.IsBot && auth.UserID == event.Event.User {
-			logInfo("Ignoring %s reaction from bot user %s on message %s in channel %s", RocketReaction, event.Event.User, event.Event.Item.Ts, event.Event.Item.Channel)
+			logInfo("Ignoring %s reaction from bot user %s on message %s in channel %s", event.Event.Reaction, event.Event.User, event.Event.Item.Ts, event.Event.Item.Channel)
+			decision.fail(DecisionIgnored, "reactor", "the bot's own reaction")
 			return
 		}
 	}
 
-	logInfo("Processing %s reaction on message %s in channel %s", RocketReaction, event.Event.Item.Ts, event.Event.Item.Channel)
+	// Slack retries deliveries it thinks failed, so the same event can be relayed more than once
+	if event.EventID != "" && !a.firstDelivery(ctx, event.EventID) {
+		logInfo("Ignoring duplicate delivery of event %s", event.EventID)
+		decision.fail(DecisionIgnored, "delivery", "a retry of event %s, already handled", event.EventID)
+		return
+	}
+
+	logInfo("Processing %s reaction on message %s in channel %s", event.Event.Reaction, event.Event.Item.Ts, event.Event.Item.Channel)
+
+	// The kill switch works on any message, so it doesn't need PR metadata
+	if event.Event.Reaction == HaltReaction {
+		a.haltFromReaction(ctx, event.Event.User, event.Event.Item.Channel)
+		return
+	}
+
+	// Plans are decided on the deployment's message, whose run is on record
+	if workflow == WorkflowInfraPlan {
+		a.decideInfraPlan(ctx, event.Event.Reaction, event.Event.Item.Channel, event.Event.Item.Ts, event.Event.User)
+		return
+	}
+
+	// Numbers on a quota rejection tear down the workspaces it lists
+	if workflow == WorkflowTeardown {
+		a.teardownFromReaction(ctx, event.Event.Reaction, event.Event.Item.Channel, event.Event.Item.Ts, event.Event.User)
+		return
+	}
+
+	// A pin on an idle notice keeps the workspace
+	if workflow == WorkflowIdle {
+		a.keepFromReaction(ctx, event.Event.Item.Channel, event.Event.Item.Ts, event.Event.User)
+		return
+	}
 
 	// Fetch message from Slack
-	metadata, err := getMessageMetadata(slackClient, event.Event.Item.Channel, event.Event.Item.Ts)
+	metadata, err := a.messageMetadata(ctx, event.Event.Item.Channel, event.Event.Item.Ts)
 	if err != nil {
 		logError("Error getting message metadata: %v", err)
+		decision.fail(DecisionNotStarted, "metadata", "could not read the message: %v", err)
 		return
 	}
+	a.capture.metadata(ctx, event.Event.Item.Channel, event.Event.Item.Ts, metadata)
 
 	if metadata == nil {
 		logDebug("No PR metadata found in message, skipping")
+		decision.fail(DecisionIgnored, "metadata", "the message has no PR metadata")
 		return
 	}
 
 	logInfo("Found PR metadata: %s #%d (branch: %s)", metadata.Repository, metadata.PRNumber, metadata.Branch)
+	decision.Repository = metadata.Repository
+	decision.pass("metadata", "%s #%d, branch %s", metadata.Repository, metadata.PRNumber, metadata.Branch)
 
 	// Check if repository is allowed
-	if !isRepoAllowed(metadata.Repository, allowedRepos) {
+	if !isRepoAllowed(metadata.Repository, a.allowedRepos) {
 		logInfo("Repository %s is not in the allowed list, ignoring reaction", metadata.Repository)
+		decision.fail(DecisionIgnored, "allow-list", "%s is not in allowed_repos", metadata.Repository)
 		return
 	}
+	decision.pass("allow-list", "%s is allowed", metadata.Repository)
+
+	// Diagnostics and drift checks only read state, so viewing the repository is enough; promotions are checked against the target environment
+	action := ActionDeploy
+	if workflow == WorkflowDiagnostics || workflow == WorkflowDrift {
+		action = ActionView
+	}
+	environment := a.repoConfig(metadata.Repository).defaultEnvironment()
+	if workflow != WorkflowPromote && !a.authorize(a.slackIdentities(ctx, event.Event.User), action, metadata.Repository, environment) {
+		logInfo("User %s may not %s %s, ignoring reaction", event.Event.User, action, metadata.Repository)
+		decision.fail(DecisionIgnored, "authorized", "<@%s> lacks %s on %s", event.Event.User, action, metadata.Repository)
+		return
+	}
+	if workflow != WorkflowPromote {
+		decision.pass("authorized", "<@%s> may %s %s", event.Event.User, action, metadata.Repository)
+	}
+
+	switch workflow {
+	case WorkflowDiagnostics:
+		if err := a.startDiagnostics(ctx, metadata, event.Event.Item.Channel, event.Event.Item.Ts, event.Event.User); err != nil {
+			logError("Error starting diagnostics: %v", err)
+		}
+	case WorkflowDrift:
+		a.checkDriftFromReaction(ctx, metadata, event.Event.Item.Channel, event.Event.Item.Ts)
+	case WorkflowPromote:
+		a.promoteFromReaction(ctx, metadata, event.Event.Item.Channel, event.Event.Item.Ts, event.Event.User)
+	case WorkflowRollback:
+		options := DeployOptions{ReactedAt: event.reactedAt()}
+		d, err := a.startRollback(ctx, metadata, options, event.Event.Item.Channel, event.Event.Item.Ts, event.Event.User)
+		if err != nil {
+			logError("Error starting rollback: %v", err)
+			decision.fail(DecisionNotStarted, "deployment", "declined: %s", declinedReason(err))
+			return
+		}
+		decision.pass("deployment", "rollback %s", d.ID)
+	case WorkflowRestart:
+		if _, err := a.startRestart(ctx, metadata, event.Event.Item.Channel, event.Event.Item.Ts, event.Event.User); err != nil {
+			logError("Error starting restart: %v", err)
+		}
+	case WorkflowDeploy:
+		// Modifier reactions only tune the deployment, so carry on with defaults if they can't be read
+		options, err := a.reactionOptions(ctx, event.Event.Item.Channel, event.Event.Item.Ts)
+		if err != nil {
+			logError("Error reading modifier reactions: %v", err)
+		}
+		if options.CleanBuild {
+			logInfo("Found %s reaction, building %s without cache", CleanBuildReaction, metadata.Repository)
+		}
+		options.ReactedAt = event.reactedAt()
+		// Repositories and environments with a vote deploy once enough people allowed to have rocketed the message
+		allowed := func(user string) bool {
+			return a.authorize(a.slackIdentities(ctx, user), ActionDeploy, metadata.Repository, environment)
+		}
+		if !a.castVote(ctx, event.Event.Reaction, metadata.Repository, environment, event.Event.Item.Channel, event.Event.Item.Ts, allowed) {
+			decision.fail(DecisionNotStarted, "votes", "counted towards the %d votes %s needs", a.repoConfig(metadata.Repository).requiredVotes(environment), environment)
+			return
+		}
+		d := a.deployFromReaction(ctx, metadata, options, event.Event.Item.Channel, event.Event.Item.Ts, event.Event.User)
+		if d == nil {
+			a.reopenVote(ctx, event.Event.Reaction, event.Event.Item.Channel, event.Event.Item.Ts)
+			decision.fail(DecisionNotStarted, "deployment", "declined; the message's thread says why")
+			return
+		}
+		decision.pass("deployment", "deployment %s", d.ID)
+	default:
+		// Any other workflow is a configured pipeline
+		options := DeployOptions{ReactedAt: event.reactedAt()}
+		d, err := a.startPipeline(ctx, workflow, metadata, options, event.Event.Item.Channel, event.Event.Item.Ts, event.Event.User)
+		if err != nil {
+			logError("Error starting %s: %v", workflow, err)
+			decision.fail(DecisionNotStarted, "deployment", "declined: %s", declinedReason(err))
+			return
+		}
+		decision.pass("deployment", "%s run %s", workflow, d.ID)
+	}
+}
+
+// firstDelivery reports whether this is the first time the event has been seen
+func (a *App) firstDelivery(ctx context.Context, eventID string) bool {
+	first, err := a.redisClient.SetNX(ctx, seenEventKeyPrefix+eventID, 1, seenEventTTL).Result()
+	if err != nil {
+		// Better to risk a duplicate deployment than to drop the reaction
+		logError("Error checking delivery of event %s: %v", eventID, err)
+		return true
+	}
+	if first {
+		a.claimEvent(ctx, eventID)
+	}
+	return first
+}
+
+// startDeployment records a deployment for the PR and dispatches its pipeline.
+// channel and ts identify the Slack message that receives status reactions; both may be
+// empty for deployments triggered without a message.
+func (a *App) startDeployment(ctx context.Context, metadata *PRMetadata, options DeployOptions, channel, ts, user string) (*Deployment, error) {
+	return a.startWorkflow(ctx, WorkflowDeploy, metadata, options, channel, ts, user)
+}
+
+// startWorkflow records and dispatches a run of the given workflow
+func (a *App) startWorkflow(ctx context.Context, workflow string, metadata *PRMetadata, options DeployOptions, channel, ts, user string) (*Deployment, error) {
+	// Nothing new starts while the kill switch is engaged
+	if err := a.checkHalt(ctx); err != nil {
+		logInfo("Declining %s of %s (%s): %s", workflow, metadata.Repository, metadata.Branch, declinedReason(err))
+		if postErr := a.postThreadMessage(ctx, channel, ts, a.messages.text("declined.halt", map[string]interface{}{"Reason": declinedReason(err)})); postErr != nil {
+			logError("Error posting halt notice: %v", postErr)
+		}
+		return nil, err
+	}
+
+	// The PR's labels may refuse the deployment or change how it builds; a promotion or rollback ships what already passed them
+	if workflow == WorkflowDeploy && options.PromotedFrom == "" && options.RolledBackFrom == "" {
+		if err := a.applyLabelRules(ctx, metadata, a.repoConfig(metadata.Repository), &options); err != nil {
+			if postErr := a.postThreadMessage(ctx, channel, ts, a.messages.text("declined.labels", map[string]interface{}{"Reason": declinedReason(err)})); postErr != nil {
+				logError("Error posting label notice: %v", postErr)
+			}
+			return nil, err
+		}
+
+		// Drafts and red builds aren't worth putting in the shared environment
+		if err := a.checkGate(ctx, metadata, a.repoConfig(metadata.Repository).Gate); err != nil {
+			logInfo("Declining deployment of %s (%s): %s", metadata.Repository, metadata.Branch, declinedReason(err))
+			if reactErr := a.publishSlackReaction(ctx, channel, ts, GateReaction, false); reactErr != nil {
+				logError("Error publishing %s reaction: %v", GateReaction, reactErr)
+			}
+			if postErr := a.postThreadMessage(ctx, channel, ts, a.messages.text("declined.gate", map[string]interface{}{"Reason": declinedReason(err)})); postErr != nil {
+				logError("Error posting gate notice: %v", postErr)
+			}
+			return nil, err
+		}
+	}
+
+	// Flags the repository or PR names have to exist before the code that uses them ships
+	var flags []FlagState
+	if workflow == WorkflowDeploy {
+		environment := options.Environment
+		if environment == "" {
+			environment = a.repoConfig(metadata.Repository).defaultEnvironment()
+		}
+		var err error
+		flags, err = a.checkFlags(ctx, metadata, a.repoConfig(metadata.Repository), environment)
+		if err != nil {
+			logInfo("Declining deployment of %s (%s): %s", metadata.Repository, metadata.Branch, declinedReason(err))
+			if postErr := a.postThreadMessage(ctx, channel, ts, a.messages.text("declined.flags", map[string]interface{}{"Reason": declinedReason(err)})); postErr != nil {
+				logError("Error posting flag notice: %v", postErr)
+			}
+			return nil, err
+		}
+
+		// Protected environments only take signed commits from PRs targeting protected branches
+		sha, err := a.verifyRef(ctx, metadata, a.repoConfig(metadata.Repository), options)
+		if err != nil {
+			logInfo("Declining deployment of %s (%s): %s", metadata.Repository, metadata.Branch, declinedReason(err))
+			if postErr := a.postThreadMessage(ctx, channel, ts, a.messages.text("declined.verify", map[string]interface{}{"Reason": declinedReason(err)})); postErr != nil {
+				logError("Error posting verification notice: %v", postErr)
+			}
+			return nil, err
+		}
+		if sha != "" {
+			options.GitSHA = sha
+		}
+	}
+
+	// During an incident, only deploys that reference it go ahead
+	incidentID, err := a.incidentReference(ctx, workflow, metadata, options)
+	if err != nil {
+		logInfo("Declining deployment of %s (%s): %s", metadata.Repository, metadata.Branch, declinedReason(err))
+		if postErr := a.postThreadMessage(ctx, channel, ts, a.messages.text("declined.incident", map[string]interface{}{"Reason": declinedReason(err)})); postErr != nil {
+			logError("Error posting incident notice: %v", postErr)
+		}
+		return nil, err
+	}
+
+	// Security teams can encode further rules in rego
+	if err := a.checkPolicy(ctx, workflow, metadata, options, user); err != nil {
+		logInfo("Declining %s of %s (%s): %s", workflow, metadata.Repository, metadata.Branch, declinedReason(err))
+		if postErr := a.postThreadMessage(ctx, channel, ts, a.messages.text("declined.policy", map[string]interface{}{"Reason": declinedReason(err), "User": user})); postErr != nil {
+			logError("Error posting policy notice: %v", postErr)
+		}
+		return nil, err
+	}
+
+	// Shed the deployment rather than pile up more state when at capacity
+	if err := a.checkDeploymentCapacity(ctx); err != nil {
+		a.shed(ctx, "deployments", err.Error())
+		if postErr := a.postThreadMessage(ctx, channel, ts, a.messages.text("declined.capacity", nil)); postErr != nil {
+			logError("Error posting capacity notice: %v", postErr)
+		}
+		return nil, err
+	}
+
+	// The branch is part of a commands dir, which must not lead out of the checkouts
+	repoConfig := a.repoConfig(metadata.Repository)
+	dir, dirErr := repoConfig.pipelineDir(a.config.BaseDir, metadata, options.Environment)
+	if dirErr != nil {
+		err := fmt.Errorf("%w: %v", ErrDeploymentDeclined, dirErr)
+		if postErr := a.postThreadMessage(ctx, channel, ts, a.messages.text("declined.dir", map[string]interface{}{"Reason": declinedReason(err)})); postErr != nil {
+			logError("Error posting commands dir notice: %v", postErr)
+		}
+		return nil, err
+	}
+
+	deploymentID := newDeploymentID()
+	if repoConfig.usesWorkspace(workflow, options) {
+		// Workspaces run side by side on the shared host, so they are limited per repository and per user
+		if err := a.checkWorkspaceQuota(ctx, metadata, repoConfig, channel, ts, user); err != nil {
+			return nil, err
+		}
+		options.Workspace = workspacePrefix + deploymentID
+	}
+
+	// Reserve a port and hostname for the feature deployment before anything starts; later environments have their own
+	var allocation *PoolAllocation
+	if workflow == WorkflowDeploy && a.pool != nil && options.PromotedFrom == "" && repoConfig.environmentIndex(options.Environment) <= 0 {
+		var err error
+		allocation, err = a.pool.allocate(ctx, a.redisClient, metadata.Repository, options.Workspace, metadata.Branch)
+		if errors.Is(err, ErrPoolExhausted) {
+			allocations, listErr := listAllocations(ctx, a.redisClient)
+			if listErr != nil {
+				logError("Error listing allocations: %v", listErr)
+			}
+			if postErr := a.postThreadMessage(ctx, channel, ts, exhaustedPoolMessage(metadata.Repository, err, allocations)); postErr != nil {
+				logError("Error posting pool exhaustion notice: %v", postErr)
+			}
+			return nil, err
+		}
+		if err != nil {
+			return nil, err
+		}
+		logInfo("Allocated %s", allocation)
+	}
 
 	// Publish gear reaction to indicate deployment is starting
-	if err := publishSlackReaction(ctx, redisClient, event.Event.Item.Channel, event.Event.Item.Ts, GearReaction, false, config); err != nil {
+	if err := a.publishSlackReaction(ctx, channel, ts, GearReaction, false); err != nil {
 		logError("Error publishing gear reaction: %v", err)
 		// Continue even if reaction fails - deployment should still proceed
-	} else {
-		logInfo("Published gear reaction for channel %s, message %s", event.Event.Item.Channel, event.Event.Item.Ts)
+	} else if channel != "" {
+		logInfo("Published gear reaction for channel %s, message %s", channel, ts)
+		a.observeLatency(ctx, SLOGearReaction, options.ReactedAt)
 	}
 
-	// Create and publish Poppit command
-	poppitCmd := createPoppitCommand(metadata, config, event.Event.Item.Channel, event.Event.Item.Ts)
-	if err := publishPoppitCommand(ctx, redisClient, poppitCmd, config); err != nil {
-		logError("Error publishing Poppit command: %v", err)
-		return
+	// Create the deployment command
+	certificate := a.certificateStep(ctx, repoConfig, allocation)
+	if workflow == WorkflowDeploy && options.PromotedFrom == "" && options.RolledBackFrom == "" {
+		options.Services = a.selectServices(ctx, metadata, repoConfig)
+	}
+	if options.Environment == "" {
+		options.Environment = repoConfig.defaultEnvironment()
+	}
+	poppitCmd := createPoppitCommand(workflow, metadata, a.config, repoConfig, options, certificate, channel, ts, deploymentID)
+	poppitCmd.Env = mergeEnv(allocation.env(), repoConfig.environmentEnv(options.Environment))
+	poppitCmd.Env = mergeEnv(poppitCmd.Env, imageEnv(options.Images))
+	host := options.Host
+	if host == "" {
+		host = a.targetHost(ctx, metadata.Repository, options.Environment)
+	}
+	if host != "" {
+		poppitCmd.Env = mergeEnv(poppitCmd.Env, map[string]string{HostEnvVar: host})
+	}
+	var workspace *Workspace
+	if options.Workspace != "" {
+		workspace = &Workspace{
+			DeploymentID: deploymentID,
+			Repository:   metadata.Repository,
+			Branch:       metadata.Branch,
+			Dir:          dir,
+			Name:         options.Workspace,
+			Project:      composeProjectName(metadata.Repository, deploymentID),
+			Host:         host,
+			TriggeredBy:  user,
+			CreatedAt:    time.Now().UTC(),
+		}
+		poppitCmd.Env = mergeEnv(poppitCmd.Env, map[string]string{ComposeProjectEnvVar: workspace.Project})
+	}
+	// Deployments and configured pipelines fetch, which private repositories need the git settings for
+	var gitEnv map[string]string
+	var credentialsErr error
+	if workflow == WorkflowDeploy || options.Pipeline != nil {
+		gitEnv, credentialsErr = a.gitEnv(ctx, repoConfig.Git)
+		poppitCmd.Env = mergeEnv(poppitCmd.Env, gitEnv)
+	}
+	if workflow == WorkflowDeploy && credentialsErr == nil {
+		var registryEnv, settings map[string]string
+		registryEnv, credentialsErr = a.registryEnv(ctx, repoConfig.Registry)
+		poppitCmd.Env = mergeEnv(poppitCmd.Env, registryEnv)
+		poppitCmd.Env = mergeEnv(poppitCmd.Env, buildEnv(repoConfig.Build, options))
+		if credentialsErr == nil {
+			settings, credentialsErr = a.environmentSettings(ctx, repoConfig, options.Environment)
+		}
+		poppitCmd.Env = mergeEnv(poppitCmd.Env, settings)
+	}
+
+	previewURL := repoConfig.previewURL(metadata, allocation)
+	if i := repoConfig.environmentIndex(options.Environment); i > 0 {
+		previewURL = repoConfig.Environments[i].URL
 	}
 
-	logInfo("Successfully published Poppit command for %s branch %s", metadata.Repository, metadata.Branch)
+	// A repository's own steps complete with its own command, which output is matched against
+	completion := ""
+	if workflow == WorkflowDeploy && options.Pipeline == nil {
+		completion = repoConfig.Commands.completion(metadata)
+	}
+
+	// Record the deployment before dispatching so command output can always be matched to it
+	deployment := &Deployment{
+		ID:             deploymentID,
+		Repository:     metadata.Repository,
+		Branch:         metadata.Branch,
+		PRNumber:       metadata.PRNumber,
+		Channel:        channel,
+		Ts:             ts,
+		TriggeredBy:    user,
+		Workflow:       workflow,
+		Status:         StatusQueued,
+		StartedAt:      time.Now().UTC(),
+		Pipeline:       poppitCmd.Commands,
+		Timeouts:       poppitCmd.Timeouts,
+		PreviewURL:     previewURL,
+		Allocation:     allocation,
+		IncidentID:     incidentID,
+		Flags:          flags,
+		Environment:    options.Environment,
+		PromotedFrom:   options.PromotedFrom,
+		RolledBackFrom: options.RolledBackFrom,
+		Host:           host,
+		MigratedFrom:   options.MigratedFrom,
+		Completion:     completion,
+	}
+	// The workspace is created by a command of its own, from the repository's checkout, before the pipeline runs in it
+	var prepare PoppitCommand
+	if workspace != nil {
+		deployment.Workspace = workspace.Dir + "/" + workspace.Name
+		prepare = workspaceCommand(workspace, poppitCmd.Metadata)
+		prepare.Env = mergeEnv(prepare.Env, gitEnv)
+		deployment.Pipeline, deployment.Timeouts = workspacePipeline(prepare, poppitCmd, repoConfig, a.config)
+	}
+	// The old host's teardown is dispatched separately, but is part of the migration the record tracks
+	if options.MigratedFrom != "" {
+		deployment.Pipeline, deployment.Timeouts = migrationPipeline(poppitCmd, repoConfig, a.config)
+	}
+	// Infrastructure deployments are a provider's run, not a pipeline
+	infra := workflow == WorkflowDeploy && repoConfig.Infra != nil
+	if infra {
+		deployment.Pipeline, deployment.Timeouts = nil, nil
+	}
+	if err := a.deployments.Save(ctx, deployment); err != nil {
+		logError("Error recording deployment %s: %v", deployment.ID, err)
+		// Continue even if recording fails - deployment should still proceed
+	}
+	a.recordEvent(ctx, EventDeploymentQueued, deployment)
+	a.trackActive(ctx, deployment)
+
+	// Credentials are resolved up front, but reported once the deployment is on record
+	if credentialsErr != nil {
+		a.failDeployment(ctx, deployment.ID, credentialsErr.Error())
+		return nil, credentialsErr
+	}
+
+	if infra {
+		if err := a.startInfraRun(ctx, deployment, repoConfig.Infra); err != nil {
+			return nil, err
+		}
+		a.confirmStatus(ctx, deployment)
+		a.notifyRepoChannel(ctx, deployment)
+		a.notifyIncidentChannel(ctx, deployment)
+		a.updateStatusPage(ctx, deployment)
+		a.notifyCatalog(ctx, EventDeploymentQueued, deployment)
+		return deployment, nil
+	}
+
+	// Refuse to dispatch anything outside the command policy
+	if a.policy != nil {
+		err := a.policy.check(poppitCmd)
+		if err == nil && workspace != nil {
+			err = a.policy.check(prepare)
+		}
+		if err != nil {
+			a.alertViolation(ctx, deployment, err)
+			a.failDeployment(ctx, deployment.ID, err.Error())
+			return nil, err
+		}
+	}
+
+	// Hand the command to the executor
+	a.rememberForRetry(ctx, poppitCmd)
+	dispatched := poppitCmd
+	if workspace != nil {
+		if err := a.openWorkspace(ctx, workspace, poppitCmd); err != nil {
+			a.failDeployment(ctx, deployment.ID, err.Error())
+			return nil, err
+		}
+		dispatched = prepare
+	}
+	if err := a.dispatch(ctx, dispatched); err != nil {
+		a.failDeployment(ctx, deployment.ID, fmt.Sprintf("could not dispatch via %s executor: %v", a.executor.Name(), err))
+		return nil, fmt.Errorf("failed to dispatch command via %s executor: %w", a.executor.Name(), err)
+	}
+	a.confirmStatus(ctx, deployment)
+	a.notifyRepoChannel(ctx, deployment)
+	a.notifyIncidentChannel(ctx, deployment)
+	a.updateStatusPage(ctx, deployment)
+	a.notifyCatalog(ctx, EventDeploymentQueued, deployment)
+	a.observeLatency(ctx, SLOQueued, options.ReactedAt)
+
+	logInfo("Successfully dispatched command via %s executor for %s branch %s", a.executor.Name(), metadata.Repository, metadata.Branch)
+	return deployment, nil
 }
 
-func getMessageMetadata(slackClient *slack.Client, channel, timestamp string) (*PRMetadata, error) {
+func getMessageMetadata(slackClient *slack.Client, channel, timestamp string, mapping *MetadataConfig) (*PRMetadata, error) {
 	// Fetch the message
 	historyParams := &slack.GetConversationHistoryParameters{
 		ChannelID:          channel,
@@ -396,73 +1646,90 @@ func getMessageMetadata(slackClient *slack.Client, channel, timestamp string) (*
 
 	message := history.Messages[0]
 
+	// Anything older answers for a timestamp with no message, e.g. a thread reply's
+	if message.Timestamp != timestamp {
+		return nil, nil
+	}
+
 	// Check if message has metadata
 	if len(message.Metadata.EventPayload) == 0 {
 		return nil, nil
 	}
 
-	// Parse metadata
-	metadataJSON, err := json.Marshal(message.Metadata.EventPayload)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal metadata: %w", err)
+	// Parse metadata, whatever shape the notifier gave it
+	metadata, missing := parseMetadata(message.Metadata.EventType, message.Metadata.EventPayload, mapping)
+	if metadata == nil {
+		// A payload with half of what a PR needs most likely comes from a notifier that renamed a field
+		keys := make([]string, 0, len(message.Metadata.EventPayload))
+		for key := range message.Metadata.EventPayload {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		report := logDebug
+		if len(missing) == 1 {
+			report = logWarn
+		}
+		report("Metadata of message %s (event type %q) has no %s; its keys are %s. Map them under message_metadata if it is a PR.",
+			timestamp, message.Metadata.EventType, strings.Join(missing, " or "), strings.Join(keys, ", "))
+		return nil, nil
 	}
 
-	var metadata PRMetadata
-	if err := json.Unmarshal(metadataJSON, &metadata); err != nil {
-		return nil, fmt.Errorf("failed to parse PR metadata: %w", err)
+	return metadata, nil
+}
+
+// pipelineStep is a named command in the deployment pipeline.
+// Names are used to look up per-step settings such as timeouts in the repo config.
+type pipelineStep struct {
+	Name    string
+	Command string
+}
+
+func createPoppitCommand(workflow string, metadata *PRMetadata, config Config, repoConfig RepoConfig, options DeployOptions, certificate, channel, timestamp, deploymentID string) PoppitCommand {
+	// startDeployment has declined branches whose dir would be outside the checkouts
+	dir, _ := repoConfig.pipelineDir(config.BaseDir, metadata, options.Environment)
+	if options.Workspace != "" {
+		dir += "/" + options.Workspace
 	}
 
-	// Verify required fields are present
-	if metadata.Repository == "" || metadata.Branch == "" {
-		return nil, nil
+	steps := workflowSteps(workflow, metadata, repoConfig, options, certificate)
+
+	commands := make([]string, 0, len(steps))
+	var timeouts map[string]int
+	for _, step := range steps {
+		commands = append(commands, step.Command)
+		if timeout := repoConfig.stepTimeout(step.Name, config.DefaultStepTimeout); timeout > 0 {
+			if timeouts == nil {
+				timeouts = make(map[string]int)
+			}
+			timeouts[step.Command] = int(timeout.Seconds())
+		}
 	}
 
-	return &metadata, nil
-}
-
-func createPoppitCommand(metadata *PRMetadata, config Config, channel, timestamp string) PoppitCommand {
-	dir := fmt.Sprintf("%s/%s", config.BaseDir, metadata.Repository)
-
-	return PoppitCommand{
-		Repo:   metadata.Repository,
-		Branch: metadata.Branch,
-		Type:   VibeDeployType,
-		Dir:    dir,
-		Commands: []string{
-			"git fetch origin",
-			fmt.Sprintf("git checkout %s", metadata.Branch),
-			"git pull",
-			"docker compose build",
-			"docker compose down",
-			DeploymentCommand,
-			// try commenting out checking out main,
-			// so that projects which rely on the feature branch files
-			// might work
-			// "git checkout main",
-		},
+	command := PoppitCommand{
+		Repo:     metadata.Repository,
+		Branch:   metadata.Branch,
+		Type:     VibeDeployType,
+		Dir:      dir,
+		Commands: commands,
+		Timeouts: timeouts,
 		Metadata: &CommandMetadata{
-			Channel: channel,
-			Ts:      timestamp,
+			Channel:      channel,
+			Ts:           timestamp,
+			DeploymentID: deploymentID,
 		},
 	}
-}
-
-func publishPoppitCommand(ctx context.Context, redisClient *redis.Client, cmd PoppitCommand, config Config) error {
-	payload, err := json.Marshal(cmd)
-	if err != nil {
-		return fmt.Errorf("failed to marshal Poppit command: %w", err)
-	}
-
-	if err := redisClient.RPush(ctx, config.RedisListName, payload).Err(); err != nil {
-		return fmt.Errorf("failed to push to Redis list: %w", err)
+	// A configured pipeline's output is told apart by its name, since its commands are anyone's
+	if options.Pipeline != nil {
+		command.Metadata.Workflow = workflow
 	}
-
-	return nil
+	return command
 }
 
-func listenForCommandOutput(ctx context.Context, redisClient *redis.Client, config Config) {
+func (a *App) listenForCommandOutput(ctx context.Context) {
+	config := a.config
+
 	// Subscribe to command output channel
-	pubsub := redisClient.Subscribe(ctx, config.RedisOutputChannel)
+	pubsub := a.redisClient.Subscribe(ctx, config.RedisOutputChannel)
 	defer pubsub.Close()
 
 	logInfo("Subscribed to Redis channel: %s", config.RedisOutputChannel)
@@ -479,40 +1746,151 @@ func listenForCommandOutput(ctx context.Context, redisClient *redis.Client, conf
 				continue
 			}
 			logDebug("Received command output message from channel: %s", config.RedisOutputChannel)
-			processCommandOutput(ctx, msg.Payload, redisClient, config)
+			a.capture.consumed(ctx, a.cipher, CaptureCommandOutput, msg.Channel, []byte(msg.Payload))
+			if a.chaos.dropOutput() {
+				logWarn("Chaos: dropping command output message")
+				continue
+			}
+			a.processCommandOutput(ctx, msg.Payload)
 		}
 	}
 }
 
-func processCommandOutput(ctx context.Context, payload string, redisClient *redis.Client, config Config) {
-	var output CommandOutput
-	if err := json.Unmarshal([]byte(payload), &output); err != nil {
+func (a *App) processCommandOutput(ctx context.Context, payload string) {
+	plaintext, err := a.cipher.open([]byte(payload))
+	if err != nil {
+		logError("Error decrypting command output: %v", err)
+		return
+	}
+
+	parsed, err := poppitv1.ParseCommandOutput(plaintext)
+	if err != nil {
 		logError("Error parsing command output: %v", err)
 		return
 	}
+	a.handleCommandOutput(ctx, *parsed)
+}
 
+// handleCommandOutput acts on the output of one pipeline step, however the executor delivered it
+func (a *App) handleCommandOutput(ctx context.Context, output CommandOutput) {
 	// Only process vibe-deploy type commands
 	if output.Type != VibeDeployType {
 		logDebug("Ignoring command output type: %s (not %s)", output.Type, VibeDeployType)
 		return
 	}
 
-	// Only process docker compose up -d command
-	if output.Command != DeploymentCommand {
-		logDebug("Ignoring command: %s (not %s)", output.Command, DeploymentCommand)
-		return
-	}
-
 	// Check if metadata is present
 	if output.Metadata == nil {
 		logWarn("Command output missing metadata (channel and timestamp required), cannot send reaction")
 		return
 	}
 
+	// Diagnostics aren't a deployment; their output just goes to the thread
+	if output.Metadata.Workflow == WorkflowDiagnostics {
+		a.postDiagnosticsOutput(ctx, output)
+		return
+	}
+
+	// Neither is a drift check, which only names the deployment it compares against
+	if output.Metadata.Workflow == WorkflowDrift {
+		a.reportDrift(ctx, output)
+		return
+	}
+
+	// Nor is a workspace's traffic sample
+	if output.Metadata.Workflow == WorkflowIdle {
+		a.recordTraffic(ctx, output)
+		return
+	}
+
+	// Nor is a workspace's teardown
+	if output.Metadata.Workflow == WorkflowTeardown {
+		logDebug("Workspace teardown ran %q", output.Command)
+		return
+	}
+
+	// A step that exited with an error stopped the pipeline, so nothing after it will report. The certificate
+	// step explains its own failures.
+	if output.ExitCode != 0 && !isCertificateCommand(output.Command) {
+		reason := fmt.Sprintf("`%s` exited with status %d", output.Command, output.ExitCode)
+		if output.Metadata.DeploymentID == "" {
+			a.failMessage(ctx, output, reason)
+		} else {
+			a.failStep(ctx, output, reason)
+		}
+		return
+	}
+
+	// Any output proves the step finished, so start the clock on the next one
+	if output.Metadata.DeploymentID != "" {
+		a.armWatchdog(ctx, output.Metadata.DeploymentID, output.Command)
+		a.appendLog(ctx, output)
+		a.continueMigration(ctx, output)
+		a.continueWorkspace(ctx, output)
+	}
+
+	// SBOMs and scan reports are JSON about the images' packages, whose descriptions could pass for transient errors
+	if isScanCommand(output.Command) {
+		a.recordScan(ctx, output)
+		return
+	}
+	if isSBOMCommand(output.Command) {
+		a.recordSBOM(ctx, output)
+		return
+	}
+
+	// Remember transient failures so the deployment can be retried if the step then fails, and what kind of
+	// failure the output points at in case the pipeline stops here
+	a.recordRetrySignature(ctx, output)
+	a.recordFailureSignature(ctx, output)
+
+	// Record the new containers' footprint and report it in the thread
+	if output.Command == StatsCommand {
+		a.recordResources(ctx, output)
+		return
+	}
+
+	// A certificate failure fails the deployment with its own reason rather than a generic step error
+	if isCertificateCommand(output.Command) {
+		a.recordCertificate(ctx, output)
+		return
+	}
+
+	// Capture build metadata from the pipeline's inspection steps
+	if isBuildMetadataCommand(output.Command) {
+		a.recordBuildMetadata(ctx, output)
+		return
+	}
+
+	// Configured pipelines complete with their last step, and mark it with their own reaction
+	if pipeline := a.pipeline(output.Metadata.Workflow); pipeline != nil {
+		a.completePipeline(ctx, output, pipeline)
+		return
+	}
+
+	// Only process the command that completes a workflow
+	if !a.completesWorkflow(ctx, output) {
+		logDebug("Ignoring command: %s (not %s or %s)", output.Command, DeploymentCommand, RestartCommand)
+		return
+	}
+
 	logInfo("Processing completion for %s in channel %s, message %s", VibeDeployType, output.Metadata.Channel, output.Metadata.Ts)
 
+	if output.Metadata.DeploymentID != "" {
+		// An earlier step, such as the certificate, may already have failed the deployment
+		if d, err := a.deployments.Get(ctx, output.Metadata.DeploymentID); err == nil && d.Status == StatusFailed {
+			logInfo("Ignoring completion of deployment %s, which already failed: %s", d.ID, d.FailureReason)
+			return
+		} else if err == nil && d.MigratedFrom != "" && output.Command != TeardownCommand {
+			// A migration is only complete once the old host is torn down
+			logDebug("Deployment %s is up on %s, waiting for %s to be torn down", d.ID, d.Host, d.MigratedFrom)
+			return
+		}
+		a.finishDeployment(ctx, output.Metadata.DeploymentID, StatusSucceeded)
+	}
+
 	// Remove gear reaction to indicate deployment is no longer in progress
-	if err := publishSlackReaction(ctx, redisClient, output.Metadata.Channel, output.Metadata.Ts, GearReaction, true, config); err != nil {
+	if err := a.publishSlackReaction(ctx, output.Metadata.Channel, output.Metadata.Ts, GearReaction, true); err != nil {
 		logError("Error removing gear reaction: %v", err)
 		// Continue even if reaction removal fails
 	} else {
@@ -520,7 +1898,7 @@ func processCommandOutput(ctx context.Context, payload string, redisClient *redi
 	}
 
 	// Publish rocket reaction to indicate success
-	if err := publishSlackReaction(ctx, redisClient, output.Metadata.Channel, output.Metadata.Ts, RocketReaction, false, config); err != nil {
+	if err := a.publishSlackReaction(ctx, output.Metadata.Channel, output.Metadata.Ts, RocketReaction, false); err != nil {
 		logError("Error publishing rocket reaction: %v", err)
 		// Continue even if final reaction fails - deployment was still successful
 	} else {
@@ -528,7 +1906,12 @@ func processCommandOutput(ctx context.Context, payload string, redisClient *redi
 	}
 }
 
-func publishSlackReaction(ctx context.Context, redisClient *redis.Client, channel, timestamp, reaction string, remove bool, config Config) error {
+func (a *App) publishSlackReaction(ctx context.Context, channel, timestamp, reaction string, remove bool) error {
+	// Deployments triggered without a Slack message have nothing to react to
+	if channel == "" {
+		return nil
+	}
+
 	slackReaction := SlackReaction{
 		Reaction: reaction,
 		Channel:  channel,
@@ -540,8 +1923,13 @@ func publishSlackReaction(ctx context.Context, redisClient *redis.Client, channe
 	if err != nil {
 		return fmt.Errorf("failed to marshal slack reaction: %w", err)
 	}
+	a.capture.published(ctx, CaptureSlackReaction, a.config.RedisReactionList, payload)
+	if payload, err = a.cipher.seal(payload); err != nil {
+		return fmt.Errorf("failed to encrypt slack reaction: %w", err)
+	}
 
-	if err := redisClient.RPush(ctx, config.RedisReactionList, payload).Err(); err != nil {
+	a.chaos.delayPublish(ctx)
+	if err := a.redisClient.RPush(ctx, a.config.RedisReactionList, payload).Err(); err != nil {
 		return fmt.Errorf("failed to push to Redis list: %w", err)
 	}
 
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// messageLinkPattern matches a Slack message permalink, e.g. https://acme.slack.com/archives/C0123/p1712345678000100
+var messageLinkPattern = regexp.MustCompile(`/archives/([A-Z0-9]+)/p(\d{10})(\d{6})`)
+
+// threadTsPattern matches the timestamp of a thread's parent message
+var threadTsPattern = regexp.MustCompile(`^\d{10}\.\d{6}$`)
+
+// parseMessageLink returns the channel and timestamp of the message a Slack permalink points at. A link to a
+// reply points at the message it replies to, since that is the one with the PR metadata. Slack sends links in
+// slash commands as <url> or <url|label>.
+func parseMessageLink(link string) (channel, ts string, err error) {
+	link = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(link), "<"), ">")
+	if i := strings.Index(link, "|"); i >= 0 {
+		link = link[:i]
+	}
+	m := messageLinkPattern.FindStringSubmatch(link)
+	if m == nil {
+		return "", "", fmt.Errorf("%q is not a Slack message link", link)
+	}
+	channel, ts = m[1], m[2]+"."+m[3]
+	if u, err := url.Parse(link); err == nil {
+		if parent := u.Query().Get("thread_ts"); threadTsPattern.MatchString(parent) {
+			ts = parent
+		}
+	}
+	return channel, ts, nil
+}
+
+// isMessageLink reports whether a command argument is a Slack message permalink rather than a name
+func isMessageLink(arg string) bool {
+	return messageLinkPattern.MatchString(arg)
+}
+
+// resolveMessageLink reads the PR a Slack permalink points at. The metadata is nil when the message has none.
+func (a *App) resolveMessageLink(ctx context.Context, link string) (channel, ts string, metadata *PRMetadata, err error) {
+	channel, ts, err = parseMessageLink(link)
+	if err != nil {
+		return "", "", nil, err
+	}
+	metadata, err = a.messageMetadata(ctx, channel, ts)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("could not read the message: %w", err)
+	}
+	return channel, ts, metadata, nil
+}
+
+// messageTarget checks that the PR of a message can be deployed by the user, returning it, or why not
+func (a *App) messageTarget(ctx context.Context, metadata *PRMetadata, user string) (*PRMetadata, string) {
+	if metadata == nil {
+		return nil, ":shrug: This message has no PR metadata, so there is nothing to deploy from it."
+	}
+	if !isRepoAllowed(metadata.Repository, a.allowedRepos) {
+		return nil, fmt.Sprintf(":no_entry_sign: *%s* is not in the allowed list.", metadata.Repository)
+	}
+	if !a.authorize(a.slackIdentities(ctx, user), ActionDeploy, metadata.Repository, "") {
+		return nil, fmt.Sprintf(":lock: You may not deploy *%s*.", metadata.Repository)
+	}
+	return metadata, ""
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultMessageLanguage is the language of the built-in texts, used for any message a language doesn't translate
+const DefaultMessageLanguage = "en"
+
+//go:embed messages/en.yaml
+var defaultMessages []byte
+
+// messageFuncs are available to every message template
+var messageFuncs = template.FuncMap{
+	"mention": formatMention,
+	"short":   shortSHA,
+}
+
+// MessageCatalog renders the Slack message texts from templates: the configured language's overrides,
+// then that language's built-in texts, then the built-in English ones
+type MessageCatalog struct {
+	language  string
+	templates []map[string]*template.Template
+}
+
+// newMessageCatalog loads the built-in texts and the optional overrides file, checking every template parses
+// and every overridden message exists
+func newMessageCatalog(config Config) (*MessageCatalog, error) {
+	defaults, err := parseMessages(defaultMessages)
+	if err != nil {
+		return nil, fmt.Errorf("invalid built-in messages: %w", err)
+	}
+	language := config.MessagesLanguage
+	if language == "" {
+		language = DefaultMessageLanguage
+	}
+
+	catalog := &MessageCatalog{language: language}
+	if config.MessagesFile != "" {
+		data, err := os.ReadFile(config.MessagesFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read messages file: %w", err)
+		}
+		overrides, err := parseMessages(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid messages file %s: %w", config.MessagesFile, err)
+		}
+		for lang, messages := range overrides {
+			for key := range messages {
+				if _, ok := defaults[DefaultMessageLanguage][key]; !ok {
+					return nil, fmt.Errorf("messages file %s: unknown message %q in %s", config.MessagesFile, key, lang)
+				}
+			}
+		}
+		catalog.templates = append(catalog.templates, overrides[language])
+	}
+	catalog.templates = append(catalog.templates, defaults[language], defaults[DefaultMessageLanguage])
+	return catalog, nil
+}
+
+// parseMessages parses a catalog of language to message key to template
+func parseMessages(data []byte) (map[string]map[string]*template.Template, error) {
+	var raw map[string]map[string]string
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	parsed := make(map[string]map[string]*template.Template, len(raw))
+	for lang, messages := range raw {
+		parsed[lang] = make(map[string]*template.Template, len(messages))
+		for key, text := range messages {
+			tmpl, err := template.New(key).Funcs(messageFuncs).Option("missingkey=zero").Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("message %q in %s: %w", key, lang, err)
+			}
+			parsed[lang][key] = tmpl
+		}
+	}
+	return parsed, nil
+}
+
+// defaultCatalog is used by apps built without one, such as the CLI's
+var defaultCatalog = func() *MessageCatalog {
+	catalog, err := newMessageCatalog(Config{})
+	if err != nil {
+		panic(err)
+	}
+	return catalog
+}()
+
+// text renders a message. A template that fails to render falls back to the next one for the key,
+// so a broken override never loses the message.
+func (m *MessageCatalog) text(key string, data map[string]interface{}) string {
+	if m == nil {
+		m = defaultCatalog
+	}
+	for _, templates := range m.templates {
+		tmpl, ok := templates[key]
+		if !ok {
+			continue
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data); err != nil {
+			logError("Error rendering message %s in %s: %v", key, m.language, err)
+			continue
+		}
+		return b.String()
+	}
+	logError("No text for message %s", key)
+	return key
+}
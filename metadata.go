@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PR metadata fields, by their names in VibeDeploy's own payload
+const (
+	MetadataPRNumber    = "pr_number"
+	MetadataRepository  = "repository"
+	MetadataPRUrl       = "pr_url"
+	MetadataAuthor      = "author"
+	MetadataBranch      = "branch"
+	MetadataEventAction = "event_action"
+)
+
+// metadataAliases are the payload keys each field is read from when the config maps it to none of its own, in
+// order. A dotted key reads a nested object, so GitHub-shaped payloads work as they are.
+var metadataAliases = map[string][]string{
+	MetadataPRNumber:    {"pr_number", "prNumber", "number", "pr", "pull_request.number"},
+	MetadataRepository:  {"repository", "repo", "repository.full_name", "repo_name", "full_name"},
+	MetadataPRUrl:       {"pr_url", "prUrl", "url", "html_url", "pull_request.html_url"},
+	MetadataAuthor:      {"author", "user", "user.login", "login", "pull_request.user.login"},
+	MetadataBranch:      {"branch", "head_ref", "head_branch", "ref", "pull_request.head.ref"},
+	MetadataEventAction: {"event_action", "action"},
+}
+
+// MetadataConfig maps the fields of message metadata from notifiers that don't use VibeDeploy's field names,
+// configured under message_metadata. Each field maps to payload keys tried in order, before the built-in aliases.
+type MetadataConfig struct {
+	// Fields apply to messages of any event type
+	Fields map[string][]string `yaml:"fields"`
+	// EventTypes apply to messages of one event type, before Fields
+	EventTypes map[string]map[string][]string `yaml:"event_types"`
+}
+
+func (c *MetadataConfig) validate() error {
+	mappings := map[string]map[string][]string{"fields": c.Fields}
+	for eventType, fields := range c.EventTypes {
+		if strings.TrimSpace(eventType) == "" {
+			return fmt.Errorf("message_metadata has an empty event type")
+		}
+		mappings["event type "+eventType] = fields
+	}
+	for where, fields := range mappings {
+		for field, keys := range fields {
+			if _, ok := metadataAliases[field]; !ok {
+				return fmt.Errorf("message_metadata %s maps unknown field %q (one of %s)", where, field, strings.Join(metadataFields(), ", "))
+			}
+			for _, key := range keys {
+				if key == "" || strings.HasPrefix(key, ".") || strings.HasSuffix(key, ".") || strings.Contains(key, "..") {
+					return fmt.Errorf("message_metadata %s maps %s to invalid key %q", where, field, key)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// metadataFields are the names of the PR metadata fields, sorted
+func metadataFields() []string {
+	fields := make([]string, 0, len(metadataAliases))
+	for field := range metadataAliases {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// keys returns the payload keys a field is read from for an event type, the configured ones first
+func (c *MetadataConfig) keys(eventType, field string) []string {
+	var keys []string
+	if c != nil {
+		keys = append(keys, c.EventTypes[eventType][field]...)
+		keys = append(keys, c.Fields[field]...)
+	}
+	return append(keys, metadataAliases[field]...)
+}
+
+// parseMetadata reads PR metadata from a message's metadata payload, whatever the notifier calls its fields and
+// whether it sends numbers as numbers or strings. It returns nil, and the fields it couldn't find, when the
+// payload lacks the repository or the branch.
+func parseMetadata(eventType string, payload map[string]interface{}, config *MetadataConfig) (*PRMetadata, []string) {
+	lookup := func(field string, parse func(interface{}) (interface{}, bool)) interface{} {
+		for _, key := range config.keys(eventType, field) {
+			if value, ok := payloadValue(payload, key); ok {
+				if parsed, ok := parse(value); ok {
+					return parsed
+				}
+			}
+		}
+		return nil
+	}
+	text := func(field string) string {
+		value, _ := lookup(field, metadataString).(string)
+		return value
+	}
+
+	metadata := &PRMetadata{
+		Repository:  text(MetadataRepository),
+		PRUrl:       text(MetadataPRUrl),
+		Author:      text(MetadataAuthor),
+		Branch:      strings.TrimPrefix(text(MetadataBranch), "refs/heads/"),
+		EventAction: text(MetadataEventAction),
+	}
+	metadata.PRNumber, _ = lookup(MetadataPRNumber, metadataNumber).(int)
+
+	// The PR's link names its repository and number, for payloads that only carry the link
+	if _, repo, number, ok := pullRequestLink(metadata.PRUrl); ok {
+		if metadata.Repository == "" {
+			metadata.Repository = repo
+		}
+		if metadata.PRNumber == 0 {
+			metadata.PRNumber = number
+		}
+	}
+
+	var missing []string
+	if metadata.Repository == "" {
+		missing = append(missing, MetadataRepository)
+	}
+	if metadata.Branch == "" {
+		missing = append(missing, MetadataBranch)
+	}
+	if len(missing) > 0 {
+		return nil, missing
+	}
+	return metadata, nil
+}
+
+// payloadValue returns the value at a key of a payload, following dots into nested objects
+func payloadValue(payload map[string]interface{}, key string) (interface{}, bool) {
+	// A key with a dot in its name beats a nested object
+	if value, ok := payload[key]; ok {
+		return value, true
+	}
+	head, rest, nested := strings.Cut(key, ".")
+	if !nested {
+		return nil, false
+	}
+	object, ok := payload[head].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	return payloadValue(object, rest)
+}
+
+// metadataString accepts a non-empty string, or a number as its digits
+func metadataString(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case string:
+		v = strings.TrimSpace(v)
+		return v, v != ""
+	case float64:
+		if v == math.Trunc(v) {
+			return strconv.FormatInt(int64(v), 10), true
+		}
+	}
+	return nil, false
+}
+
+// metadataNumber accepts a positive whole number, as a number or a string such as "42" or "#42"
+func metadataNumber(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case float64:
+		if v > 0 && v == math.Trunc(v) && v <= math.MaxInt32 {
+			return int(v), true
+		}
+	case string:
+		if n, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(v), "#")); err == nil && n > 0 {
+			return n, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// TeardownCommand stops a migrated environment's stack on the host it moved off
+const TeardownCommand = "docker compose down --remove-orphans"
+
+// ErrNoMigration explains why an environment can't be migrated
+var ErrNoMigration = errors.New("cannot migrate")
+
+// migrationPipeline is what a migration's record tracks: the pipeline on the new host, then the old host's teardown
+func migrationPipeline(cmd PoppitCommand, repoConfig RepoConfig, config Config) ([]string, map[string]int) {
+	pipeline := append(append([]string{}, cmd.Commands...), TeardownCommand)
+	timeouts := make(map[string]int, len(cmd.Timeouts)+1)
+	for command, seconds := range cmd.Timeouts {
+		timeouts[command] = seconds
+	}
+	if timeout := repoConfig.stepTimeout("teardown", config.DefaultStepTimeout); timeout > 0 {
+		timeouts[TeardownCommand] = int(timeout.Seconds())
+	}
+	return pipeline, timeouts
+}
+
+// migrationSource returns the environment's most recent successful deployment, whose commit the migration redeploys
+func (a *App) migrationSource(ctx context.Context, repo, environment string) (*Deployment, error) {
+	history, err := a.deployments.List(ctx, repo, defaultHistoryLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load history for %s: %w", repo, err)
+	}
+	first := a.repoConfig(repo).defaultEnvironment()
+	for _, d := range history {
+		if d.Status != StatusSucceeded || workflowOf(d) != WorkflowDeploy || d.Build.GitSHA == "" {
+			continue
+		}
+		if d.Environment == environment || (d.Environment == "" && environment == first) {
+			return d, nil
+		}
+	}
+	return nil, nil
+}
+
+// startMigration moves a repository environment to another host as one tracked deployment: deploy the running commit
+// to the new host and wait for it to be healthy, switch deployments and routes over, then tear the old host down.
+// Progress is posted in a thread under a new message in the channel.
+func (a *App) startMigration(ctx context.Context, repo, environment, to, channel, user string) (*Deployment, error) {
+	repoConfig := a.repoConfig(repo)
+	i := repoConfig.environmentIndex(environment)
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %s has no environment %q", ErrNoMigration, repo, environment)
+	}
+	environment = repoConfig.Environments[i].Name
+	if _, ok := a.hosts[to]; !ok {
+		return nil, fmt.Errorf("%w: host %q is not configured", ErrNoMigration, to)
+	}
+	from := a.targetHost(ctx, repo, environment)
+	if from == "" {
+		return nil, fmt.Errorf("%w: %s %s is not deployed to a configured host; set its host first", ErrNoMigration, repo, environment)
+	}
+	if from == to {
+		return nil, fmt.Errorf("%w: %s %s already runs on %s", ErrNoMigration, repo, environment, to)
+	}
+	source, err := a.migrationSource(ctx, repo, environment)
+	if err != nil {
+		return nil, err
+	}
+	if source == nil {
+		return nil, fmt.Errorf("%w: %s %s has no successful deployment to move", ErrNoMigration, repo, environment)
+	}
+
+	text := fmt.Sprintf(":truck: %s is migrating *%s* %s from *%s* to *%s* at `%s`", formatMention(user), repo, environment, from, to, shortSHA(source.Build.GitSHA))
+	_, ts, err := a.slackClient.PostMessageContext(ctx, channel, slack.MsgOptionText(text, false))
+	if err != nil {
+		return nil, fmt.Errorf("failed to post migration message: %w", err)
+	}
+	logInfo("Migrating %s %s from %s to %s at %s", repo, environment, from, to, shortSHA(source.Build.GitSHA))
+
+	metadata := &PRMetadata{Repository: repo, Branch: source.Branch, PRNumber: source.PRNumber}
+	options := DeployOptions{Environment: environment, GitSHA: source.Build.GitSHA, PromotedFrom: source.ID, Host: to, MigratedFrom: from}
+	options.Images = a.reusableImages(ctx, source, environment+" on "+to, channel, ts)
+	d, err := a.startWorkflow(ctx, WorkflowDeploy, metadata, options, channel, ts, user)
+	if err != nil {
+		return nil, err
+	}
+	a.postMigrationStep(ctx, d, 1, fmt.Sprintf("deploying to *%s*", to))
+	return d, nil
+}
+
+// postMigrationStep posts a migration's progress in its thread
+func (a *App) postMigrationStep(ctx context.Context, d *Deployment, step int, text string) {
+	if err := a.postThreadMessage(ctx, d.Channel, d.Ts, fmt.Sprintf("Step %d/4: %s", step, text)); err != nil {
+		logError("Error posting progress of migration %s: %v", d.ID, err)
+	}
+}
+
+// continueMigration moves a migration on from the output of its steps: once the last step on the new host
+// reports, the environment is cut over to it and the old host is torn down
+func (a *App) continueMigration(ctx context.Context, output CommandOutput) {
+	d, err := a.deployments.Get(ctx, output.Metadata.DeploymentID)
+	if err != nil || d.MigratedFrom == "" || d.Status != StatusQueued {
+		return
+	}
+	switch {
+	case output.Command == TeardownCommand:
+		a.postMigrationStep(ctx, d, 4, fmt.Sprintf("stopped on *%s*. *%s* %s now runs on *%s*.", d.MigratedFrom, d.Repository, d.Environment, d.Host))
+	case nextPipelineCommand(d.Pipeline, output.Command) == TeardownCommand:
+		a.cutOver(ctx, d)
+	}
+}
+
+// cutOver points the environment at the migration's new host, then dispatches the old host's teardown
+func (a *App) cutOver(ctx context.Context, d *Deployment) {
+	a.postMigrationStep(ctx, d, 2, fmt.Sprintf("healthy on *%s*", d.Host))
+
+	if err := a.redisClient.HSet(ctx, hostOverridesKey, d.Repository+"@"+d.Environment, d.Host).Err(); err != nil {
+		logError("Error switching %s %s to %s: %v", d.Repository, d.Environment, d.Host, err)
+		a.failDeployment(ctx, d.ID, fmt.Sprintf("running on %s, but deployments could not be switched over from %s: %v", d.Host, d.MigratedFrom, err))
+		return
+	}
+	a.publishRoute(ctx, d)
+	step := fmt.Sprintf("new deployments of *%s* %s go to *%s*", d.Repository, d.Environment, d.Host)
+	if a.proxy != nil && d.Allocation != nil && d.Allocation.Hostname != "" {
+		step += fmt.Sprintf(" and `%s` routes to it", d.Allocation.Hostname)
+	}
+	a.postMigrationStep(ctx, d, 3, step)
+
+	repoConfig := a.repoConfig(d.Repository)
+	dir, err := repoConfig.pipelineDir(a.config.BaseDir, &PRMetadata{Repository: d.Repository, Branch: d.Branch, PRNumber: d.PRNumber}, d.Environment)
+	if err != nil {
+		logError("Error tearing down %s on %s after migrating it: %v", d.Repository, d.MigratedFrom, err)
+		return
+	}
+	teardown := PoppitCommand{
+		Repo:     d.Repository,
+		Branch:   d.Branch,
+		Type:     VibeDeployType,
+		Dir:      dir,
+		Commands: []string{TeardownCommand},
+		Timeouts: map[string]int{},
+		Env:      mergeEnv(repoConfig.environmentEnv(d.Environment), map[string]string{HostEnvVar: d.MigratedFrom}),
+		Metadata: &CommandMetadata{Channel: d.Channel, Ts: d.Ts, DeploymentID: d.ID},
+	}
+	if seconds := d.Timeouts[TeardownCommand]; seconds > 0 {
+		teardown.Timeouts[TeardownCommand] = seconds
+	}
+	if a.policy != nil {
+		if err := a.policy.check(teardown); err != nil {
+			a.alertViolation(ctx, d, err)
+			a.failDeployment(ctx, d.ID, err.Error())
+			return
+		}
+	}
+	executor, err := a.executorFor(teardown)
+	if err == nil {
+		err = executor.Execute(ctx, teardown)
+	}
+	if err != nil {
+		logError("Error dispatching teardown of migration %s: %v", d.ID, err)
+		a.failDeployment(ctx, d.ID, fmt.Sprintf("running on %s, but %s could not be torn down: %v", d.Host, d.MigratedFrom, err))
+	}
+}
+
+// migrateCommand handles `migrate <owner/repo> <host> [environment]`
+func (a *App) migrateCommand(ctx context.Context, command slack.SlashCommand, args []string) *slack.WebhookMessage {
+	if len(args) < 2 || len(args) > 3 {
+		return ephemeralReply("Usage: `migrate <owner/repo> <host> [environment]`")
+	}
+	repo, to, environment := a.canonicalRepo(args[0]), args[1], ""
+	if len(args) == 3 {
+		environment = args[2]
+	}
+
+	// Moving an environment between machines touches both of them, so it takes an admin
+	if !a.authorize(a.slackIdentities(ctx, command.UserID), ActionAdmin, repo, environment) {
+		logInfo("User %s may not migrate %s", command.UserID, repo)
+		return ephemeralReply(":no_entry: You need the admin permission to migrate deployments between hosts.")
+	}
+	if !isRepoAllowed(repo, a.allowedRepos) {
+		return ephemeralReply(fmt.Sprintf("`%s` is not an allowed repository.", repo))
+	}
+
+	d, err := a.startMigration(ctx, repo, environment, to, command.ChannelID, command.UserID)
+	if errors.Is(err, ErrNoMigration) {
+		return ephemeralReply(":warning: Not migrating: " + strings.TrimPrefix(err.Error(), ErrNoMigration.Error()+": "))
+	}
+	if errors.Is(err, ErrDeploymentDeclined) {
+		// startWorkflow already explained in the thread
+		return ephemeralReply(":warning: Not migrating: " + declinedReason(err))
+	}
+	if err != nil {
+		logError("Error starting migration of %s to %s: %v", repo, to, err)
+		return ephemeralReply(":warning: Could not start the migration, please try again.")
+	}
+	return ephemeralReply(fmt.Sprintf("Migration `%s` started; progress is in the thread.", d.ID))
+}
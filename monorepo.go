@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// compareFileLimit is the most files GitHub's compare API lists; a diff this large may be truncated
+const compareFileLimit = 300
+
+// ServicesConfig is the services section of a repository's settings, for monorepos
+type ServicesConfig struct {
+	// Base is the branch changes are compared against (default: main)
+	Base string `yaml:"base"`
+	// Paths maps path prefixes, e.g. "services/api/", to the compose services that must be redeployed when they change
+	Paths map[string][]string `yaml:"paths"`
+}
+
+// changedFiles lists the files that differ between two refs, and whether the list is complete
+func (g *GitHubApp) changedFiles(ctx context.Context, repo, base, head string) ([]string, bool, error) {
+	token, err := g.token(ctx, repo)
+	if err != nil {
+		return nil, false, err
+	}
+	var comparison struct {
+		Files []struct {
+			Filename         string `json:"filename"`
+			PreviousFilename string `json:"previous_filename"`
+		} `json:"files"`
+	}
+	if err := g.do(ctx, token, http.MethodGet, "/repos/"+repo+"/compare/"+base+"..."+head, nil, &comparison); err != nil {
+		return nil, false, fmt.Errorf("failed to compare %s...%s: %w", base, head, err)
+	}
+
+	var files []string
+	for _, file := range comparison.Files {
+		files = append(files, file.Filename)
+		// A file moved out of a service still changes that service
+		if file.PreviousFilename != "" {
+			files = append(files, file.PreviousFilename)
+		}
+	}
+	return files, len(comparison.Files) < compareFileLimit, nil
+}
+
+// servicesFor maps changed files to compose services. It returns nil, meaning the whole stack,
+// when any file falls outside every configured path.
+func (c *ServicesConfig) servicesFor(files []string) []string {
+	selected := make(map[string]bool)
+	for _, file := range files {
+		matched := false
+		for prefix, services := range c.Paths {
+			if strings.HasPrefix(file, prefix) {
+				matched = true
+				for _, service := range services {
+					selected[service] = true
+				}
+			}
+		}
+		if !matched {
+			return nil
+		}
+	}
+
+	services := make([]string, 0, len(selected))
+	for service := range selected {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	return services
+}
+
+// selectServices picks the compose services a monorepo deployment should rebuild, or nil for the whole stack
+func (a *App) selectServices(ctx context.Context, metadata *PRMetadata, repoConfig RepoConfig) []string {
+	config := repoConfig.Services
+	if config == nil || len(config.Paths) == 0 || a.github == nil {
+		return nil
+	}
+	base := config.Base
+	if base == "" {
+		base = "main"
+	}
+	if metadata.Branch == base {
+		return nil
+	}
+
+	files, complete, err := a.github.changedFiles(ctx, metadata.Repository, base, metadata.Branch)
+	if err != nil {
+		logError("Error listing changed files of %s, deploying the whole stack: %v", metadata.Repository, err)
+		return nil
+	}
+	if !complete || len(files) == 0 {
+		return nil
+	}
+
+	services := config.servicesFor(files)
+	if len(services) > 0 {
+		logInfo("%s (%s) only changes services %s", metadata.Repository, metadata.Branch, strings.Join(services, ", "))
+	}
+	return services
+}
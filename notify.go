@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// postDeploymentMessage posts a message carrying a repository and branch in its metadata, like a PR message,
+// so reactions on it deploy that branch. It returns the message's timestamp.
+func (a *App) postDeploymentMessage(ctx context.Context, channel, text, eventType, repo, branch string) (string, error) {
+	_, ts, err := a.slackClient.PostMessageContext(ctx, channel,
+		slack.MsgOptionText(text, false),
+		slack.MsgOptionMetadata(slack.SlackMetadata{
+			EventType:    eventType,
+			EventPayload: map[string]interface{}{"repository": repo, "branch": branch},
+		}),
+	)
+	return ts, err
+}
+
+// postThreadMessage posts a reply in the thread of the given message
+func (a *App) postThreadMessage(ctx context.Context, channel, ts, text string) error {
+	if channel == "" {
+		return nil
+	}
+	_, _, err := a.slackClient.PostMessageContext(ctx, channel,
+		slack.MsgOptionText(text, false),
+		slack.MsgOptionTS(ts),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to post thread message: %w", err)
+	}
+	return nil
+}
+
+// formatMention converts an owner entry to Slack mention markup.
+// User IDs (U…/W…) and user group IDs (S…) become real mentions; anything else
+// (e.g. "@team-api") is passed through as plain text.
+func formatMention(owner string) string {
+	owner = strings.TrimSpace(owner)
+	switch {
+	case owner == "":
+		return ""
+	case isSlackID(owner, 'U'), isSlackID(owner, 'W'):
+		return "<@" + owner + ">"
+	case isSlackID(owner, 'S'):
+		return "<!subteam^" + owner + ">"
+	default:
+		return owner
+	}
+}
+
+// isSlackID reports whether s looks like a Slack ID with the given prefix (e.g. U012AB3CD)
+func isSlackID(s string, prefix byte) bool {
+	if len(s) < 2 || s[0] != prefix {
+		return false
+	}
+	for _, r := range s[1:] {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// ownerMentions returns the mention markup for a repository's owners, or "" if none are configured
+func (a *App) ownerMentions(repo string) string {
+	var mentions []string
+	for _, owner := range a.repoConfig(repo).Owners {
+		if mention := formatMention(owner); mention != "" {
+			mentions = append(mentions, mention)
+		}
+	}
+	return strings.Join(mentions, " ")
+}
+
+// oncallMention looks up the repository's on-call user group by handle, so whoever is in it now gets the alert.
+// It returns "" when no group is configured, it can't be found or it is empty, and the owners are tagged instead.
+func (a *App) oncallMention(ctx context.Context, repo string) string {
+	handle := strings.TrimPrefix(a.repoConfig(repo).OnCall, "@")
+	if handle == "" {
+		return ""
+	}
+	groups, err := a.slackClient.GetUserGroupsContext(ctx, slack.GetUserGroupsOptionIncludeUsers(true))
+	if err != nil {
+		logWarn("Error looking up on-call group @%s of %s, tagging owners instead: %v", handle, repo, err)
+		return ""
+	}
+	for _, group := range groups {
+		if group.Handle != handle || group.DateDelete != 0 {
+			continue
+		}
+		if len(group.Users) == 0 {
+			logWarn("On-call group @%s of %s is empty, tagging owners instead", handle, repo)
+			return ""
+		}
+		return formatMention(group.ID)
+	}
+	logWarn("On-call group @%s of %s not found, tagging owners instead", handle, repo)
+	return ""
+}
+
+// notifyFailure posts a thread reply on the deployment's message, tagging the on-call group or else the repository owners
+func (a *App) notifyFailure(ctx context.Context, d *Deployment) {
+	if !a.flagEnabled(ctx, FlagFailureThreadReplies, d.Repository, d.TriggeredBy) {
+		return
+	}
+
+	text := a.messages.text("failure.reply", map[string]interface{}{"Repository": d.Repository, "Branch": d.Branch, "Reason": d.FailureReason})
+	mentions := a.oncallMention(ctx, d.Repository)
+	if mentions == "" {
+		mentions = a.ownerMentions(d.Repository)
+	}
+	if hint := a.failureHint(d); hint != "" {
+		text += "\n" + hint
+	}
+	if mentions != "" {
+		text += "\n" + a.messages.text("failure.cc", map[string]interface{}{"Mentions": mentions})
+	}
+
+	if err := a.postThreadMessage(ctx, d.Channel, d.Ts, text); err != nil {
+		logError("Error posting failure notification for deployment %s: %v", d.ID, err)
+		return
+	}
+	logInfo("Posted failure notification for deployment %s in channel %s", d.ID, d.Channel)
+}
+
+// notifyRepoChannel posts a deployment summary to the repository's own notification channel, if configured
+func (a *App) notifyRepoChannel(ctx context.Context, d *Deployment) {
+	channel := a.repoConfig(d.Repository).NotificationChannel
+	if channel == "" || !a.flagEnabled(ctx, FlagRepoChannelSummaries, d.Repository, d.TriggeredBy) {
+		return
+	}
+
+	text := a.deploymentSummary(d)
+	if permalink, err := a.slackClient.GetPermalinkContext(ctx, &slack.PermalinkParameters{Channel: d.Channel, Ts: d.Ts}); err == nil {
+		text = a.messages.text("summary.link", map[string]interface{}{"Summary": text, "Permalink": permalink})
+	} else {
+		logDebug("Could not get permalink for message %s in channel %s: %v", d.Ts, d.Channel, err)
+	}
+
+	// Failures can't wait for quiet hours to end
+	if err := a.notifyChannel(ctx, channel, text, d.Status == StatusFailed); err != nil {
+		logError("Error posting %s summary for deployment %s to channel %s: %v", d.Status, d.ID, channel, err)
+		return
+	}
+	logInfo("Posted %s summary for deployment %s to channel %s", d.Status, d.ID, channel)
+}
+
+// deploymentSummary is a one-line description of a deployment's current state
+func (a *App) deploymentSummary(d *Deployment) string {
+	data := map[string]interface{}{
+		"Repository":  d.Repository,
+		"Branch":      d.Branch,
+		"PRNumber":    d.PRNumber,
+		"Environment": d.Environment,
+		"Reason":      d.FailureReason,
+		"CancelledBy": d.CancelledBy,
+		"Flags":       formatFlags(d.Flags),
+	}
+	data["Target"] = a.messages.text("summary.target", data)
+	if seconds := deploymentDuration(d); seconds != nil && d.Status == StatusSucceeded {
+		data["Duration"] = time.Duration(*seconds) * time.Second
+	}
+
+	workflow := WorkflowDeploy
+	if workflowOf(d) == WorkflowRestart {
+		workflow = WorkflowRestart
+	}
+	status := "running"
+	switch d.Status {
+	case StatusSucceeded, StatusFailed, StatusCancelled:
+		status = string(d.Status)
+	}
+	return a.messages.text("summary."+workflow+"."+status, data)
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/oauth2"
+)
+
+const (
+	sessionCookieName = "vibedeploy_session"
+	stateCookieName   = "vibedeploy_oidc_state"
+	sessionKeyPrefix  = "vibedeploy:session:"
+)
+
+// Session is a browser login established through OIDC
+type Session struct {
+	Subject string    `json:"subject"`
+	Email   string    `json:"email"`
+	Name    string    `json:"name,omitempty"`
+	Scope   Scope     `json:"scope"`
+	Expires time.Time `json:"expires"`
+}
+
+// errEmailNotVerified is returned when the provider has not verified the signed-in user's email address
+var errEmailNotVerified = errors.New("email address is not verified")
+
+// OIDCAuth signs dashboard users in with an OpenID Connect provider (Google, Okta, or any other issuer
+// with discovery), or with GitHub's OAuth apps, and keeps their sessions in Redis
+type OIDCAuth struct {
+	redisClient *redis.Client
+	oauth       oauth2.Config
+	verifier    *oidc.IDTokenVerifier
+	// githubAPI is the GitHub API URL when users sign in with GitHub rather than an OIDC issuer
+	githubAPI      string
+	sessionTTL     time.Duration
+	users          map[string]Scope
+	allowedDomains []string
+	allowedGroups  []string
+	secure         bool
+}
+
+// loginIdentity is who the provider says signed in
+type loginIdentity struct {
+	Subject string
+	Email   string
+	Name    string
+	// Groups are the groups claim of an OIDC provider, or the organisations of a GitHub user
+	Groups []string
+}
+
+// newOIDCAuth discovers the issuer's endpoints, or sets up GitHub login; it returns nil when neither
+// OIDC_ISSUER nor GITHUB_LOGIN_CLIENT_ID is set
+func newOIDCAuth(ctx context.Context, config Config, redisClient *redis.Client) (*OIDCAuth, error) {
+	if config.OIDCIssuer == "" && config.GitHubLoginClientID == "" {
+		return nil, nil
+	}
+	if config.OIDCIssuer != "" && config.GitHubLoginClientID != "" {
+		return nil, fmt.Errorf("set either OIDC_ISSUER or GITHUB_LOGIN_CLIENT_ID, not both")
+	}
+
+	users := make(map[string]Scope)
+	for _, email := range config.OIDCTriggerUsers {
+		users[strings.ToLower(email)] = ScopeTrigger
+	}
+	for _, email := range config.OIDCAdminUsers {
+		users[strings.ToLower(email)] = ScopeAdmin
+	}
+	auth := &OIDCAuth{
+		redisClient:    redisClient,
+		sessionTTL:     config.OIDCSessionTTL,
+		users:          users,
+		allowedDomains: config.OIDCAllowedDomains,
+		allowedGroups:  config.OIDCAllowedGroups,
+		secure:         strings.HasPrefix(config.OIDCRedirectURL, "https://"),
+	}
+
+	if config.GitHubLoginClientID != "" {
+		if config.GitHubLoginClientSecret == "" || config.OIDCRedirectURL == "" {
+			return nil, fmt.Errorf("GITHUB_LOGIN_CLIENT_SECRET and OIDC_REDIRECT_URL are required when GITHUB_LOGIN_CLIENT_ID is set")
+		}
+		auth.githubAPI = strings.TrimRight(config.GitHubAPIURL, "/")
+		auth.oauth = oauth2.Config{
+			ClientID:     config.GitHubLoginClientID,
+			ClientSecret: config.GitHubLoginClientSecret,
+			RedirectURL:  config.OIDCRedirectURL,
+			Endpoint:     githubLoginEndpoint(auth.githubAPI),
+			Scopes:       githubLoginScopes(len(auth.allowedGroups) > 0),
+		}
+		return auth, nil
+	}
+
+	if config.OIDCClientID == "" || config.OIDCClientSecret == "" || config.OIDCRedirectURL == "" {
+		return nil, fmt.Errorf("OIDC_CLIENT_ID, OIDC_CLIENT_SECRET and OIDC_REDIRECT_URL are required when OIDC_ISSUER is set")
+	}
+	provider, err := oidc.NewProvider(ctx, config.OIDCIssuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC issuer %s: %w", config.OIDCIssuer, err)
+	}
+
+	// Providers such as Okta and Dex only include the groups claim when asked for it
+	scopes := []string{oidc.ScopeOpenID, "email", "profile"}
+	if len(auth.allowedGroups) > 0 {
+		scopes = append(scopes, "groups")
+	}
+	auth.oauth = oauth2.Config{
+		ClientID:     config.OIDCClientID,
+		ClientSecret: config.OIDCClientSecret,
+		RedirectURL:  config.OIDCRedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopes,
+	}
+	auth.verifier = provider.Verifier(&oidc.Config{ClientID: config.OIDCClientID})
+	return auth, nil
+}
+
+// scopeFor maps a verified identity to a scope. Listed users get theirs; anyone else gets read access only
+// with an email domain in OIDC_ALLOWED_DOMAINS or a group in OIDC_ALLOWED_GROUPS, and no scope otherwise.
+func (o *OIDCAuth) scopeFor(identity *loginIdentity) Scope {
+	if scope, ok := o.users[strings.ToLower(identity.Email)]; ok {
+		return scope
+	}
+	_, domain, _ := strings.Cut(identity.Email, "@")
+	for _, allowed := range o.allowedDomains {
+		if strings.EqualFold(domain, strings.TrimPrefix(allowed, "@")) {
+			return ScopeRead
+		}
+	}
+	for _, group := range identity.Groups {
+		for _, allowed := range o.allowedGroups {
+			if strings.EqualFold(group, allowed) {
+				return ScopeRead
+			}
+		}
+	}
+	return ""
+}
+
+// handleLogin redirects the browser to the identity provider
+func (o *OIDCAuth) handleLogin(w http.ResponseWriter, r *http.Request) {
+	state, err := randomToken()
+	if err != nil {
+		http.Error(w, "failed to start login", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookieName,
+		Value:    state + "|" + safeReturnPath(r.URL.Query().Get("return_to")),
+		Path:     "/auth/",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   o.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, o.oauth.AuthCodeURL(state), http.StatusFound)
+}
+
+// handleCallback exchanges the authorization code, verifies the ID token and starts a session
+func (o *OIDCAuth) handleCallback(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(stateCookieName)
+	state, returnTo, _ := strings.Cut(cookieValue(cookie, err), "|")
+	if state == "" || r.URL.Query().Get("state") != state {
+		http.Error(w, "invalid login state", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: stateCookieName, Path: "/auth/", MaxAge: -1})
+
+	token, err := o.oauth.Exchange(r.Context(), r.URL.Query().Get("code"))
+	if err != nil {
+		logWarn("Login code exchange failed: %v", err)
+		http.Error(w, "login failed", http.StatusUnauthorized)
+		return
+	}
+	var identity *loginIdentity
+	if o.githubAPI != "" {
+		identity, err = o.githubIdentity(r.Context(), token)
+	} else {
+		identity, err = o.idTokenIdentity(r.Context(), token)
+	}
+	if errors.Is(err, errEmailNotVerified) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		logWarn("Dashboard login failed: %v", err)
+		http.Error(w, "login failed", http.StatusUnauthorized)
+		return
+	}
+
+	session := &Session{
+		Subject: identity.Subject,
+		Email:   identity.Email,
+		Name:    identity.Name,
+		Scope:   o.scopeFor(identity),
+		Expires: time.Now().Add(o.sessionTTL),
+	}
+	id, err := o.saveSession(r.Context(), session)
+	if err != nil {
+		logError("Error saving session for %s: %v", identity.Email, err)
+		http.Error(w, "failed to start session", http.StatusInternalServerError)
+		return
+	}
+
+	if session.Scope == "" {
+		logInfo("Dashboard login by %s with no scope", session.Email)
+	} else {
+		logInfo("Dashboard login by %s with %s scope", session.Email, session.Scope)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    id,
+		Path:     "/",
+		Expires:  session.Expires,
+		HttpOnly: true,
+		Secure:   o.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, returnTo, http.StatusFound)
+}
+
+// idTokenIdentity verifies the ID token of an OIDC login and reads the user from its claims
+func (o *OIDCAuth) idTokenIdentity(ctx context.Context, token *oauth2.Token) (*loginIdentity, error) {
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("identity provider did not return an ID token")
+	}
+	idToken, err := o.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("ID token verification failed: %w", err)
+	}
+
+	var claims struct {
+		Email         string   `json:"email"`
+		EmailVerified *bool    `json:"email_verified"`
+		Name          string   `json:"name"`
+		Groups        []string `json:"groups"`
+	}
+	if err := idToken.Claims(&claims); err != nil || claims.Email == "" {
+		return nil, fmt.Errorf("identity provider did not return an email address")
+	}
+	if claims.EmailVerified != nil && !*claims.EmailVerified {
+		return nil, errEmailNotVerified
+	}
+	return &loginIdentity{Subject: idToken.Subject, Email: claims.Email, Name: claims.Name, Groups: claims.Groups}, nil
+}
+
+// handleLogout ends the current session
+func (o *OIDCAuth) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		if err := o.redisClient.Del(r.Context(), sessionKeyPrefix+hashAPIKey(cookie.Value)).Err(); err != nil {
+			logError("Error deleting session: %v", err)
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Path: "/", MaxAge: -1})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleWhoAmI returns the signed-in user so the UI can decide which buttons to show
+func (o *OIDCAuth) handleWhoAmI(w http.ResponseWriter, r *http.Request) {
+	session, err := o.sessionFor(r)
+	if err != nil {
+		logError("Error loading session: %v", err)
+		http.Error(w, "failed to load session", http.StatusInternalServerError)
+		return
+	}
+	if session == nil {
+		http.Error(w, "not signed in", http.StatusUnauthorized)
+		return
+	}
+	writeJSON(w, http.StatusOK, session)
+}
+
+// saveSession stores a session under the hash of a new random ID and returns the ID for the cookie
+func (o *OIDCAuth) saveSession(ctx context.Context, session *Session) (string, error) {
+	id, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(session)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal session: %w", err)
+	}
+	if err := o.redisClient.Set(ctx, sessionKeyPrefix+hashAPIKey(id), payload, o.sessionTTL).Err(); err != nil {
+		return "", fmt.Errorf("failed to store session: %w", err)
+	}
+	return id, nil
+}
+
+// sessionFor returns the session behind the request's cookie, or nil if there is none
+func (o *OIDCAuth) sessionFor(r *http.Request) (*Session, error) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return nil, nil
+	}
+
+	payload, err := o.redisClient.Get(r.Context(), sessionKeyPrefix+hashAPIKey(cookie.Value)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session: %w", err)
+	}
+
+	var session Session
+	if err := json.Unmarshal(payload, &session); err != nil {
+		return nil, fmt.Errorf("failed to parse session: %w", err)
+	}
+	return &session, nil
+}
+
+// randomToken returns 32 random bytes, hex-encoded
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// safeReturnPath only allows redirects back to a local path after login
+func safeReturnPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.Contains(path, "\\") {
+		return "/"
+	}
+	return path
+}
+
+func cookieValue(cookie *http.Cookie, err error) string {
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
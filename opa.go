@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// opaDefaultReason is shown when a policy denies a deployment without saying why
+const opaDefaultReason = "the deployment policy does not allow it"
+
+// OPAPolicy asks an Open Policy Agent server whether a deployment may start, so rules can live in rego
+// rather than in VibeDeploy
+type OPAPolicy struct {
+	// url is the policy decision's Data API document, e.g. http://opa:8181/v1/data/vibedeploy/deploy
+	url      string
+	failOpen bool
+	client   *http.Client
+}
+
+// OPAInput is the input document the policy is evaluated against
+type OPAInput struct {
+	Workflow    string      `json:"workflow"`
+	Repository  string      `json:"repository"`
+	Branch      string      `json:"branch"`
+	Environment string      `json:"environment,omitempty"`
+	User        string      `json:"user"`
+	Metadata    *PRMetadata `json:"metadata"`
+	GitSHA      string      `json:"git_sha,omitempty"`
+	// PromotedFrom is the deployment being promoted, for promotions
+	PromotedFrom string `json:"promoted_from,omitempty"`
+	CleanBuild   bool   `json:"clean_build"`
+	// Time is when the deployment was requested, in UTC; Weekday and Hour save the policy the date arithmetic
+	Time    time.Time `json:"time"`
+	Weekday string    `json:"weekday"`
+	Hour    int       `json:"hour"`
+}
+
+// OPADecision is the policy's result: either a plain boolean or an object with allow and reason
+type OPADecision struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason"`
+}
+
+// newOPAPolicy returns nil when OPA_URL is unset
+func newOPAPolicy(config Config) (*OPAPolicy, error) {
+	if config.OPAURL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(config.OPAURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("OPA_URL %q must be an http(s) URL", config.OPAURL)
+	}
+	return &OPAPolicy{
+		url:      config.OPAURL,
+		failOpen: config.OPAFailOpen,
+		client:   &http.Client{Timeout: config.OPATimeout},
+	}, nil
+}
+
+// evaluate queries the policy for the input
+func (p *OPAPolicy) evaluate(ctx context.Context, input OPAInput) (*OPADecision, error) {
+	body, err := json.Marshal(map[string]interface{}{"input": input})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal policy input: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach OPA: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("OPA returned %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse OPA response: %w", err)
+	}
+	// An undefined document means no rule matched, which denies
+	if len(response.Result) == 0 {
+		return &OPADecision{Reason: opaDefaultReason}, nil
+	}
+	var decision OPADecision
+	if err := json.Unmarshal(response.Result, &decision.Allow); err != nil {
+		if err := json.Unmarshal(response.Result, &decision); err != nil {
+			return nil, fmt.Errorf("policy result must be a boolean or an object with allow and reason, got %s", response.Result)
+		}
+	}
+	if !decision.Allow && decision.Reason == "" {
+		decision.Reason = opaDefaultReason
+	}
+	return &decision, nil
+}
+
+// checkPolicy returns ErrDeploymentDeclined with the policy's reason when it denies the deployment.
+// If OPA can't be asked, the deployment is declined unless OPA_FAIL_OPEN is set.
+func (a *App) checkPolicy(ctx context.Context, workflow string, metadata *PRMetadata, options DeployOptions, user string) error {
+	if a.opa == nil {
+		return nil
+	}
+	environment := options.Environment
+	if environment == "" {
+		environment = a.repoConfig(metadata.Repository).defaultEnvironment()
+	}
+	now := time.Now().UTC()
+	input := OPAInput{
+		Workflow:     workflow,
+		Repository:   metadata.Repository,
+		Branch:       metadata.Branch,
+		Environment:  environment,
+		User:         user,
+		Metadata:     metadata,
+		GitSHA:       options.GitSHA,
+		PromotedFrom: options.PromotedFrom,
+		CleanBuild:   options.CleanBuild,
+		Time:         now,
+		Weekday:      now.Weekday().String(),
+		Hour:         now.Hour(),
+	}
+
+	decision, err := a.opa.evaluate(ctx, input)
+	if err != nil {
+		if a.opa.failOpen {
+			logError("Error evaluating deployment policy, allowing %s of %s: %v", workflow, metadata.Repository, err)
+			return nil
+		}
+		logError("Error evaluating deployment policy, declining %s of %s: %v", workflow, metadata.Repository, err)
+		return fmt.Errorf("%w: the deployment policy could not be evaluated", ErrDeploymentDeclined)
+	}
+	if !decision.Allow {
+		return fmt.Errorf("%w: %s", ErrDeploymentDeclined, decision.Reason)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxPostedOutput is the most output posted per command; longer output keeps its tail
+const maxPostedOutput = 3500
+
+// highlightMarker leads the lines a highlight processor matches
+const highlightMarker = "▶ "
+
+// defaultErrorPattern finds the line a failure summary quotes when no highlight patterns are configured
+var defaultErrorPattern = regexp.MustCompile(`(?i)\b(error|err!|fatal|failed|panic|exception)\b`)
+
+// OutputConfig is the output section of the repos config file
+type OutputConfig struct {
+	// Processors run in order over command output before it is posted to Slack
+	Processors []OutputProcessorConfig `yaml:"processors"`
+	// Summary leads a failed step's output with the line that most looks like the error
+	Summary bool `yaml:"summary"`
+}
+
+// OutputProcessorConfig is one output processor; exactly one of its fields is set
+type OutputProcessorConfig struct {
+	// Drop leaves out lines matching a regular expression, e.g. layer hashes and progress bars
+	Drop string `yaml:"drop"`
+	// Extract keeps only lines matching a regular expression, or just their first group if it has one
+	Extract string `yaml:"extract"`
+	// Tail keeps the last lines
+	Tail int `yaml:"tail"`
+	// Highlight marks lines matching a regular expression as errors
+	Highlight string `yaml:"highlight"`
+}
+
+// outputProcessor is a compiled OutputProcessorConfig
+type outputProcessor struct {
+	drop, extract, highlight *regexp.Regexp
+	tail                     int
+}
+
+// OutputFilter turns command output into what is worth posting
+type OutputFilter struct {
+	processors []outputProcessor
+	summary    bool
+}
+
+// newOutputFilter compiles the configured processors, or returns nil when there is no output section
+func newOutputFilter(config *OutputConfig) (*OutputFilter, error) {
+	if config == nil {
+		return nil, nil
+	}
+	filter := &OutputFilter{summary: config.Summary}
+	for i, processor := range config.Processors {
+		var compiled outputProcessor
+		set := 0
+		for _, field := range []struct {
+			pattern string
+			re      **regexp.Regexp
+		}{{processor.Drop, &compiled.drop}, {processor.Extract, &compiled.extract}, {processor.Highlight, &compiled.highlight}} {
+			if field.pattern == "" {
+				continue
+			}
+			re, err := regexp.Compile(field.pattern)
+			if err != nil {
+				return nil, fmt.Errorf("output processor %d: invalid pattern %q: %w", i+1, field.pattern, err)
+			}
+			*field.re = re
+			set++
+		}
+		if processor.Tail < 0 {
+			return nil, fmt.Errorf("output processor %d: tail must not be negative", i+1)
+		}
+		if processor.Tail > 0 {
+			compiled.tail = processor.Tail
+			set++
+		}
+		if set != 1 {
+			return nil, fmt.Errorf("output processor %d must set exactly one of drop, extract, tail and highlight", i+1)
+		}
+		filter.processors = append(filter.processors, compiled)
+	}
+	return filter, nil
+}
+
+// process runs the processors over output in order
+func (f *OutputFilter) process(output string) string {
+	if f == nil {
+		return output
+	}
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	for _, p := range f.processors {
+		var kept []string
+		switch {
+		case p.drop != nil:
+			for _, line := range lines {
+				if !p.drop.MatchString(line) {
+					kept = append(kept, line)
+				}
+			}
+		case p.extract != nil:
+			for _, line := range lines {
+				match := p.extract.FindStringSubmatch(line)
+				switch {
+				case match == nil:
+				case len(match) > 1:
+					kept = append(kept, match[1])
+				default:
+					kept = append(kept, line)
+				}
+			}
+		case p.tail > 0:
+			kept = lines
+			if len(kept) > p.tail {
+				kept = kept[len(kept)-p.tail:]
+			}
+		case p.highlight != nil:
+			for _, line := range lines {
+				if p.highlight.MatchString(line) && !strings.HasPrefix(line, highlightMarker) {
+					line = highlightMarker + line
+				}
+				kept = append(kept, line)
+			}
+		}
+		lines = kept
+	}
+	return strings.Join(lines, "\n")
+}
+
+// summarize returns the first line of output, not dropped by a processor, that looks like an error: one a
+// highlight processor matches, or without highlights one mentioning an error. It is "" without summaries.
+func (f *OutputFilter) summarize(output string) string {
+	if f == nil || !f.summary {
+		return ""
+	}
+	var drops, patterns []*regexp.Regexp
+	for _, p := range f.processors {
+		if p.drop != nil {
+			drops = append(drops, p.drop)
+		}
+		if p.highlight != nil {
+			patterns = append(patterns, p.highlight)
+		}
+	}
+	if len(patterns) == 0 {
+		patterns = []*regexp.Regexp{defaultErrorPattern}
+	}
+
+lines:
+	for _, line := range strings.Split(output, "\n") {
+		for _, re := range drops {
+			if re.MatchString(line) {
+				continue lines
+			}
+		}
+		for _, re := range patterns {
+			if re.MatchString(line) {
+				return strings.TrimSpace(line)
+			}
+		}
+	}
+	return ""
+}
+
+// formatOutput is processed output as a code block, keeping its tail if it is too long to post
+func (f *OutputFilter) formatOutput(output string) string {
+	return codeBlock(f.process(output))
+}
+
+// codeBlock is text as a code block, keeping its tail if it is too long to post
+func codeBlock(text string) string {
+	text = strings.TrimRight(text, "\n")
+	if len(text) > maxPostedOutput {
+		text = "…" + text[len(text)-maxPostedOutput:]
+	}
+	if text == "" {
+		text = "(no output)"
+	}
+	// Keep the output from closing the code block early
+	text = strings.ReplaceAll(text, "```", "'''")
+	return "```\n" + text + "\n```"
+}
+
+// postFailedOutput replies in the deployment's thread with what its failing step printed, led by a summary of
+// where it failed
+func (a *App) postFailedOutput(ctx context.Context, output CommandOutput) {
+	if output.Metadata.Channel == "" || strings.TrimSpace(output.Output) == "" {
+		return
+	}
+	lead := fmt.Sprintf(":scroll: `%s` failed", output.Command)
+	if line := a.output.summarize(output.Output); line != "" {
+		if d, err := a.deployments.Get(ctx, output.Metadata.DeploymentID); err == nil {
+			for i, command := range d.Pipeline {
+				if command == output.Command {
+					lead = fmt.Sprintf(":scroll: `%s` failed at step %d", output.Command, i+1)
+					break
+				}
+			}
+		}
+		lead += ": " + strings.ReplaceAll(line, "`", "'")
+	}
+	if err := a.postThreadMessage(ctx, output.Metadata.Channel, output.Metadata.Ts, lead+"\n"+a.output.formatOutput(output.Output)); err != nil {
+		logError("Error posting output of %q for deployment %s: %v", output.Command, output.Metadata.DeploymentID, err)
+	}
+}
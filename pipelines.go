@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Branches a configured pipeline can run on, besides a branch named outright
+const (
+	// PipelineBranchPR checks out the PR's branch, as a deployment does
+	PipelineBranchPR = "pr"
+	// PipelineBranchNone runs in the checkout as it is
+	PipelineBranchNone = "none"
+)
+
+// DefaultPipelineSuccessEmoji marks a configured pipeline that finished; the rocket is for deployments
+const DefaultPipelineSuccessEmoji = "heavy_check_mark"
+
+// triggerableWorkflows are the built-in workflows another emoji can be mapped to
+var triggerableWorkflows = []string{WorkflowDeploy, WorkflowRestart, WorkflowRollback, WorkflowDiagnostics, WorkflowDrift, WorkflowPromote}
+
+// builtinWorkflows can't be the names of configured pipelines
+var builtinWorkflows = []string{WorkflowDeploy, WorkflowRestart, WorkflowRollback, WorkflowDiagnostics, WorkflowDrift, WorkflowPromote, WorkflowInfraPlan, WorkflowIdle, WorkflowTeardown}
+
+var emojiNamePattern = regexp.MustCompile(`^[a-z0-9_+'-]+$`)
+
+// PipelineConfig is a named list of commands an emoji runs on PR messages, configured under pipelines
+type PipelineConfig struct {
+	// Branch is pr (the default) for the PR's branch, none for the checkout as it is, or the name of a branch
+	Branch string `yaml:"branch"`
+	// Steps run in order in the repository's directory, as a deployment's do
+	Steps []PipelineStepConfig `yaml:"steps"`
+	// SuccessEmoji replaces the gear when the last step reported, and FailureEmoji when a step failed
+	SuccessEmoji string `yaml:"success_emoji"`
+	FailureEmoji string `yaml:"failure_emoji"`
+}
+
+// PipelineStepConfig is a command of a configured pipeline; its name is what timeouts are set under
+type PipelineStepConfig struct {
+	Name string `yaml:"name"`
+	Run  string `yaml:"run"`
+}
+
+func (p *PipelineConfig) validate() error {
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("has no steps")
+	}
+	for i, step := range p.Steps {
+		if strings.TrimSpace(step.Run) == "" {
+			return fmt.Errorf("step %d has nothing to run", i+1)
+		}
+	}
+	if strings.ContainsAny(p.Branch, " \t\n;&|$`'\"") {
+		return fmt.Errorf("invalid branch %q", p.Branch)
+	}
+	for _, emoji := range []string{p.SuccessEmoji, p.FailureEmoji} {
+		if emoji != "" && !emojiNamePattern.MatchString(emoji) {
+			return fmt.Errorf("invalid emoji %q (its name, without colons)", emoji)
+		}
+	}
+	return nil
+}
+
+// steps returns the pipeline's commands for a PR, after the git steps its branch setting needs
+func (p *PipelineConfig) steps(metadata *PRMetadata) []pipelineStep {
+	var steps []pipelineStep
+	switch branch := p.Branch; branch {
+	case PipelineBranchNone:
+	case "", PipelineBranchPR:
+		branch = metadata.Branch
+		fallthrough
+	default:
+		steps = append(steps,
+			pipelineStep{"fetch", "git fetch origin"},
+			pipelineStep{"checkout", "git checkout " + shellQuote(branch)},
+			pipelineStep{"pull", "git pull"},
+		)
+	}
+	steps = append(steps, pipelineStep{"sha", GitSHACommand})
+	for i, step := range p.Steps {
+		name := step.Name
+		if name == "" {
+			name = fmt.Sprintf("step-%d", i+1)
+		}
+		steps = append(steps, pipelineStep{name, step.Run})
+	}
+	return steps
+}
+
+// completes reports whether a command's output means the pipeline finished
+func (p *PipelineConfig) completes(command string) bool {
+	return command == p.Steps[len(p.Steps)-1].Run
+}
+
+func (p *PipelineConfig) successEmoji() string {
+	if p.SuccessEmoji != "" {
+		return p.SuccessEmoji
+	}
+	return DefaultPipelineSuccessEmoji
+}
+
+func (p *PipelineConfig) failureEmoji() string {
+	if p.FailureEmoji != "" {
+		return p.FailureEmoji
+	}
+	return FailureReaction
+}
+
+// validatePipelines checks the configured pipelines and that every trigger starts a workflow that exists
+func validatePipelines(pipelines map[string]*PipelineConfig, triggers map[string]string) error {
+	for name, pipeline := range pipelines {
+		if !environmentNamePattern.MatchString(name) {
+			return fmt.Errorf("pipeline has invalid name %q (lowercase letters, digits and dashes)", name)
+		}
+		if containsString(builtinWorkflows, name) {
+			return fmt.Errorf("pipeline %q has the name of a built-in workflow", name)
+		}
+		if pipeline == nil {
+			return fmt.Errorf("pipeline %q has no steps", name)
+		}
+		if err := pipeline.validate(); err != nil {
+			return fmt.Errorf("pipeline %q %w", name, err)
+		}
+	}
+	for emoji, workflow := range triggers {
+		if !emojiNamePattern.MatchString(emoji) {
+			return fmt.Errorf("trigger has invalid emoji %q (its name, without colons)", emoji)
+		}
+		if emoji == HaltReaction {
+			return fmt.Errorf("the %s trigger is the kill switch and can't be remapped", HaltReaction)
+		}
+		if _, ok := pipelines[workflow]; workflow != "" && !ok && !containsString(triggerableWorkflows, workflow) {
+			return fmt.Errorf("trigger %s starts unknown pipeline %q", emoji, workflow)
+		}
+	}
+	return nil
+}
+
+// reactionWorkflow returns the workflow a reaction starts: its trigger in the repos config, or the built-in one.
+// A trigger set to nothing turns a built-in reaction off.
+func (a *App) reactionWorkflow(reaction string) (string, bool) {
+	if a.reposConfig != nil {
+		if workflow, ok := a.reposConfig.Triggers[reaction]; ok {
+			return workflow, workflow != ""
+		}
+	}
+	workflow, ok := reactionWorkflows[reaction]
+	return workflow, ok
+}
+
+// pipeline returns the configured pipeline a workflow names, or nil for the built-in workflows
+func (a *App) pipeline(workflow string) *PipelineConfig {
+	if a.reposConfig == nil {
+		return nil
+	}
+	return a.reposConfig.Pipelines[workflow]
+}
+
+// startPipeline runs a configured pipeline on the PR, with a deployment record of its own
+func (a *App) startPipeline(ctx context.Context, workflow string, metadata *PRMetadata, options DeployOptions, channel, ts, user string) (*Deployment, error) {
+	options.Pipeline = a.pipeline(workflow)
+	if options.Pipeline == nil {
+		return nil, fmt.Errorf("unknown pipeline %q", workflow)
+	}
+	return a.startWorkflow(ctx, workflow, metadata, options, channel, ts, user)
+}
+
+// completePipeline finishes a configured pipeline's run once its last step reported
+func (a *App) completePipeline(ctx context.Context, output CommandOutput, pipeline *PipelineConfig) {
+	if !pipeline.completes(output.Command) {
+		logDebug("Ignoring command: %s (not the last step of %s)", output.Command, output.Metadata.Workflow)
+		return
+	}
+	logInfo("Processing completion of %s in channel %s, message %s", output.Metadata.Workflow, output.Metadata.Channel, output.Metadata.Ts)
+	if output.Metadata.DeploymentID != "" {
+		// An earlier step may already have failed the run
+		if d, err := a.deployments.Get(ctx, output.Metadata.DeploymentID); err == nil && d.Status == StatusFailed {
+			logInfo("Ignoring completion of %s %s, which already failed: %s", d.Workflow, d.ID, d.FailureReason)
+			return
+		}
+		a.finishDeployment(ctx, output.Metadata.DeploymentID, StatusSucceeded)
+	}
+	if err := a.publishSlackReaction(ctx, output.Metadata.Channel, output.Metadata.Ts, GearReaction, true); err != nil {
+		logError("Error removing gear reaction: %v", err)
+	}
+	if err := a.publishSlackReaction(ctx, output.Metadata.Channel, output.Metadata.Ts, pipeline.successEmoji(), false); err != nil {
+		logError("Error publishing %s reaction: %v", pipeline.successEmoji(), err)
+	}
+}
+
+// failureReaction is the reaction a failed run gets: its pipeline's, or the built-in one
+func (a *App) failureReaction(d *Deployment) string {
+	if pipeline := a.pipeline(d.Workflow); pipeline != nil {
+		return pipeline.failureEmoji()
+	}
+	return FailureReaction
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Placeholders accepted in command policy templates
+const (
+	// refPlaceholder matches a git branch or tag name, bare or single-quoted
+	refPlaceholder = "{ref}"
+	// argPlaceholder matches one argument without shell metacharacters
+	argPlaceholder = "{arg}"
+	// argsPlaceholder matches any number of such arguments, and may only end a template
+	argsPlaceholder = "{args}"
+)
+
+const (
+	refPattern  = `[A-Za-z0-9_][A-Za-z0-9._/+-]*`
+	argPattern  = `[A-Za-z0-9_./:=@%+,{}'*-]+`
+	argsPattern = `( +` + argPattern + `)*`
+	// quotedRefPattern also matches a ref single-quoted, as VibeDeploy quotes the refs it puts in commands
+	quotedRefPattern = `(` + refPattern + `|'` + refPattern + `')`
+)
+
+// builtinCommandTemplates cover the pipeline VibeDeploy generates itself, and are always allowed
+var builtinCommandTemplates = []string{
+	"git fetch origin",
+	"git checkout " + refPlaceholder,
+	"git checkout --detach " + refPlaceholder,
+	"git pull",
+	workspaceAddPrefix + argPlaceholder + " " + refPlaceholder,
+	workspaceRemovePrefix + argPlaceholder,
+	composeProjectPrefix + argPlaceholder + workspaceDownSuffix,
+	composeProjectPrefix + argPlaceholder + idleProbeSuffix,
+	GitSHACommand,
+	BuildCommand + " " + argsPlaceholder,
+	ConfigHashCommand,
+	"docker compose down",
+	DeploymentCommand + " " + argsPlaceholder,
+	ImagesCommand,
+	StatsCommand,
+	DigestsCommand,
+	TagsCommand,
+	lockfileCommandPrefix + argPlaceholder + " " + argsPlaceholder,
+	PullImagesCommand,
+	envFilePrefix + argPlaceholder,
+	RestartCommand,
+	TeardownCommand,
+	DriftCommand,
+	legoCommandPrefix + "--accept-tos --email {arg} --dns {arg} --domains {arg} --path {arg} run",
+	wildcardCommandPrefix + "{arg} {arg} {arg}",
+	registryLoginPrefix + "{arg} --password-stdin {args}",
+	ComposePushCommand,
+	"docker push {arg}",
+}
+
+// CommandPolicyConfig is the command_policy section of the repos config file
+type CommandPolicyConfig struct {
+	// AllowedCommands are extra command templates, e.g. "make migrate" or "docker compose run --rm {arg} {args}"
+	AllowedCommands []string `yaml:"allowed_commands"`
+	// AllowedBinaries allow any invocation of these programs, as long as the arguments are plain words
+	AllowedBinaries []string `yaml:"allowed_binaries"`
+	// AlertChannel is a Slack channel ID that is told about every violation
+	AlertChannel string `yaml:"alert_channel"`
+}
+
+// CommandPolicy validates generated commands against an allow-list before they are dispatched
+type CommandPolicy struct {
+	templates    []*regexp.Regexp
+	alertChannel string
+}
+
+// newCommandPolicy compiles the built-in templates plus any configured ones
+func newCommandPolicy(config *CommandPolicyConfig) (*CommandPolicy, error) {
+	templates := append([]string{}, builtinCommandTemplates...)
+	templates = append(templates, defaultDiagnosticsCommands...)
+	templates = append(templates, securityScanCommands()...)
+	policy := &CommandPolicy{}
+	if config != nil {
+		templates = append(templates, config.AllowedCommands...)
+		for _, binary := range config.AllowedBinaries {
+			if strings.ContainsAny(binary, " \t{}") {
+				return nil, fmt.Errorf("allowed binary %q must be a single program name", binary)
+			}
+			templates = append(templates, binary+" "+argsPlaceholder)
+		}
+		policy.alertChannel = config.AlertChannel
+	}
+
+	for _, template := range templates {
+		re, err := compileCommandTemplate(template)
+		if err != nil {
+			return nil, err
+		}
+		policy.templates = append(policy.templates, re)
+	}
+	return policy, nil
+}
+
+// compileCommandTemplate turns a template into an anchored regular expression.
+// Everything except placeholders is matched literally, and words may only be separated by spaces.
+func compileCommandTemplate(template string) (*regexp.Regexp, error) {
+	fields := strings.Fields(template)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty command template")
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	for i, field := range fields {
+		switch field {
+		case refPlaceholder:
+			b.WriteString(" +" + quotedRefPattern)
+		case argPlaceholder:
+			b.WriteString(" +" + argPattern)
+		case argsPlaceholder:
+			if i != len(fields)-1 {
+				return nil, fmt.Errorf("%s must be the last word of command template %q", argsPlaceholder, template)
+			}
+			b.WriteString(argsPattern)
+		default:
+			if i > 0 {
+				b.WriteString(" +")
+			}
+			// {ref} and {arg} may also be part of a word, as in BRANCH={ref}
+			literal := regexp.QuoteMeta(field)
+			literal = strings.ReplaceAll(literal, regexp.QuoteMeta(refPlaceholder), quotedRefPattern)
+			literal = strings.ReplaceAll(literal, regexp.QuoteMeta(argPlaceholder), argPattern)
+			b.WriteString(literal)
+		}
+	}
+	b.WriteString(" *$")
+
+	// A leading placeholder has no space before it
+	pattern := strings.Replace(b.String(), "^ +", "^ *", 1)
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid command template %q: %w", template, err)
+	}
+	return re, nil
+}
+
+// check returns an error naming the first command that matches no template
+func (p *CommandPolicy) check(cmd PoppitCommand) error {
+	for _, command := range cmd.Commands {
+		if strings.IndexFunc(command, unicode.IsControl) >= 0 {
+			return fmt.Errorf("command %q contains a line break or other control character", command)
+		}
+		if !p.allows(command) {
+			return fmt.Errorf("command %q is not allowed by the command policy", command)
+		}
+	}
+	return nil
+}
+
+// allows matches the command as it will be dispatched, so a line break can't hide a second command
+// after an allowed one
+func (p *CommandPolicy) allows(command string) bool {
+	if strings.IndexFunc(command, unicode.IsControl) >= 0 {
+		return false
+	}
+	for _, re := range p.templates {
+		if re.MatchString(command) {
+			return true
+		}
+	}
+	return false
+}
+
+// alertViolation tells the policy alert channel that a pipeline was rejected
+func (a *App) alertViolation(ctx context.Context, d *Deployment, violation error) {
+	logError("Command policy violation in deployment %s of %s (branch %s, triggered by %q): %v", d.ID, d.Repository, d.Branch, d.TriggeredBy, violation)
+	if a.policy == nil || a.policy.alertChannel == "" {
+		return
+	}
+
+	triggeredBy := formatMention(d.TriggeredBy)
+	if triggeredBy == "" {
+		triggeredBy = "an API client"
+	}
+	text := fmt.Sprintf(":rotating_light: Rejected deployment of *%s* (`%s`) triggered by %s: %v", d.Repository, d.Branch, triggeredBy, violation)
+	if err := a.postThreadMessage(ctx, a.policy.alertChannel, "", text); err != nil {
+		logError("Error posting command policy alert: %v", err)
+	}
+}
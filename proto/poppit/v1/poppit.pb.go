@@ -0,0 +1,360 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: poppit/v1/poppit.proto
+
+package poppitv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Command is a pipeline for Poppit to run in a repository's directory, one command after another.
+type Command struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Repo     string                 `protobuf:"bytes,1,opt,name=repo,proto3" json:"repo,omitempty"`
+	Branch   string                 `protobuf:"bytes,2,opt,name=branch,proto3" json:"branch,omitempty"`
+	Type     string                 `protobuf:"bytes,3,opt,name=type,proto3" json:"type,omitempty"`
+	Dir      string                 `protobuf:"bytes,4,opt,name=dir,proto3" json:"dir,omitempty"`
+	Commands []string               `protobuf:"bytes,5,rep,name=commands,proto3" json:"commands,omitempty"`
+	// Per-command output deadlines in seconds, keyed by the command.
+	Timeouts map[string]int32 `protobuf:"bytes,6,rep,name=timeouts,proto3" json:"timeouts,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	// Environment variables the executor sets for every command.
+	Env           map[string]string `protobuf:"bytes,7,rep,name=env,proto3" json:"env,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Metadata      *CommandMetadata  `protobuf:"bytes,8,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Command) Reset() {
+	*x = Command{}
+	mi := &file_poppit_v1_poppit_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Command) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Command) ProtoMessage() {}
+
+func (x *Command) ProtoReflect() protoreflect.Message {
+	mi := &file_poppit_v1_poppit_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Command.ProtoReflect.Descriptor instead.
+func (*Command) Descriptor() ([]byte, []int) {
+	return file_poppit_v1_poppit_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Command) GetRepo() string {
+	if x != nil {
+		return x.Repo
+	}
+	return ""
+}
+
+func (x *Command) GetBranch() string {
+	if x != nil {
+		return x.Branch
+	}
+	return ""
+}
+
+func (x *Command) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Command) GetDir() string {
+	if x != nil {
+		return x.Dir
+	}
+	return ""
+}
+
+func (x *Command) GetCommands() []string {
+	if x != nil {
+		return x.Commands
+	}
+	return nil
+}
+
+func (x *Command) GetTimeouts() map[string]int32 {
+	if x != nil {
+		return x.Timeouts
+	}
+	return nil
+}
+
+func (x *Command) GetEnv() map[string]string {
+	if x != nil {
+		return x.Env
+	}
+	return nil
+}
+
+func (x *Command) GetMetadata() *CommandMetadata {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+// CommandMetadata is passed through Poppit untouched, so output can be matched to its deployment.
+type CommandMetadata struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Channel       string                 `protobuf:"bytes,1,opt,name=channel,proto3" json:"channel,omitempty"`
+	Ts            string                 `protobuf:"bytes,2,opt,name=ts,proto3" json:"ts,omitempty"`
+	DeploymentId  string                 `protobuf:"bytes,3,opt,name=deployment_id,json=deploymentId,proto3" json:"deployment_id,omitempty"`
+	Workflow      string                 `protobuf:"bytes,4,opt,name=workflow,proto3" json:"workflow,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommandMetadata) Reset() {
+	*x = CommandMetadata{}
+	mi := &file_poppit_v1_poppit_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommandMetadata) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandMetadata) ProtoMessage() {}
+
+func (x *CommandMetadata) ProtoReflect() protoreflect.Message {
+	mi := &file_poppit_v1_poppit_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandMetadata.ProtoReflect.Descriptor instead.
+func (*CommandMetadata) Descriptor() ([]byte, []int) {
+	return file_poppit_v1_poppit_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CommandMetadata) GetChannel() string {
+	if x != nil {
+		return x.Channel
+	}
+	return ""
+}
+
+func (x *CommandMetadata) GetTs() string {
+	if x != nil {
+		return x.Ts
+	}
+	return ""
+}
+
+func (x *CommandMetadata) GetDeploymentId() string {
+	if x != nil {
+		return x.DeploymentId
+	}
+	return ""
+}
+
+func (x *CommandMetadata) GetWorkflow() string {
+	if x != nil {
+		return x.Workflow
+	}
+	return ""
+}
+
+// CommandOutput is the output of one command of a Command, published once the command has run.
+type CommandOutput struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Metadata *CommandMetadata       `protobuf:"bytes,1,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	Type     string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Command  string                 `protobuf:"bytes,3,opt,name=command,proto3" json:"command,omitempty"`
+	Output   string                 `protobuf:"bytes,4,opt,name=output,proto3" json:"output,omitempty"`
+	// The command's exit status; 0 is success.
+	ExitCode      int32 `protobuf:"varint,5,opt,name=exit_code,json=exitCode,proto3" json:"exit_code,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommandOutput) Reset() {
+	*x = CommandOutput{}
+	mi := &file_poppit_v1_poppit_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommandOutput) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandOutput) ProtoMessage() {}
+
+func (x *CommandOutput) ProtoReflect() protoreflect.Message {
+	mi := &file_poppit_v1_poppit_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandOutput.ProtoReflect.Descriptor instead.
+func (*CommandOutput) Descriptor() ([]byte, []int) {
+	return file_poppit_v1_poppit_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *CommandOutput) GetMetadata() *CommandMetadata {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *CommandOutput) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *CommandOutput) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+func (x *CommandOutput) GetOutput() string {
+	if x != nil {
+		return x.Output
+	}
+	return ""
+}
+
+func (x *CommandOutput) GetExitCode() int32 {
+	if x != nil {
+		return x.ExitCode
+	}
+	return 0
+}
+
+var File_poppit_v1_poppit_proto protoreflect.FileDescriptor
+
+const file_poppit_v1_poppit_proto_rawDesc = "" +
+	"\n" +
+	"\x16poppit/v1/poppit.proto\x12\tpoppit.v1\"\x91\x03\n" +
+	"\aCommand\x12\x12\n" +
+	"\x04repo\x18\x01 \x01(\tR\x04repo\x12\x16\n" +
+	"\x06branch\x18\x02 \x01(\tR\x06branch\x12\x12\n" +
+	"\x04type\x18\x03 \x01(\tR\x04type\x12\x10\n" +
+	"\x03dir\x18\x04 \x01(\tR\x03dir\x12\x1a\n" +
+	"\bcommands\x18\x05 \x03(\tR\bcommands\x12<\n" +
+	"\btimeouts\x18\x06 \x03(\v2 .poppit.v1.Command.TimeoutsEntryR\btimeouts\x12-\n" +
+	"\x03env\x18\a \x03(\v2\x1b.poppit.v1.Command.EnvEntryR\x03env\x126\n" +
+	"\bmetadata\x18\b \x01(\v2\x1a.poppit.v1.CommandMetadataR\bmetadata\x1a;\n" +
+	"\rTimeoutsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x05R\x05value:\x028\x01\x1a6\n" +
+	"\bEnvEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"|\n" +
+	"\x0fCommandMetadata\x12\x18\n" +
+	"\achannel\x18\x01 \x01(\tR\achannel\x12\x0e\n" +
+	"\x02ts\x18\x02 \x01(\tR\x02ts\x12#\n" +
+	"\rdeployment_id\x18\x03 \x01(\tR\fdeploymentId\x12\x1a\n" +
+	"\bworkflow\x18\x04 \x01(\tR\bworkflow\"\xaa\x01\n" +
+	"\rCommandOutput\x126\n" +
+	"\bmetadata\x18\x01 \x01(\v2\x1a.poppit.v1.CommandMetadataR\bmetadata\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x18\n" +
+	"\acommand\x18\x03 \x01(\tR\acommand\x12\x16\n" +
+	"\x06output\x18\x04 \x01(\tR\x06output\x12\x1b\n" +
+	"\texit_code\x18\x05 \x01(\x05R\bexitCodeB=Z;github.com/its-the-vibe/VibeDeploy/proto/poppit/v1;poppitv1b\x06proto3"
+
+var (
+	file_poppit_v1_poppit_proto_rawDescOnce sync.Once
+	file_poppit_v1_poppit_proto_rawDescData []byte
+)
+
+func file_poppit_v1_poppit_proto_rawDescGZIP() []byte {
+	file_poppit_v1_poppit_proto_rawDescOnce.Do(func() {
+		file_poppit_v1_poppit_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_poppit_v1_poppit_proto_rawDesc), len(file_poppit_v1_poppit_proto_rawDesc)))
+	})
+	return file_poppit_v1_poppit_proto_rawDescData
+}
+
+var file_poppit_v1_poppit_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_poppit_v1_poppit_proto_goTypes = []any{
+	(*Command)(nil),         // 0: poppit.v1.Command
+	(*CommandMetadata)(nil), // 1: poppit.v1.CommandMetadata
+	(*CommandOutput)(nil),   // 2: poppit.v1.CommandOutput
+	nil,                     // 3: poppit.v1.Command.TimeoutsEntry
+	nil,                     // 4: poppit.v1.Command.EnvEntry
+}
+var file_poppit_v1_poppit_proto_depIdxs = []int32{
+	3, // 0: poppit.v1.Command.timeouts:type_name -> poppit.v1.Command.TimeoutsEntry
+	4, // 1: poppit.v1.Command.env:type_name -> poppit.v1.Command.EnvEntry
+	1, // 2: poppit.v1.Command.metadata:type_name -> poppit.v1.CommandMetadata
+	1, // 3: poppit.v1.CommandOutput.metadata:type_name -> poppit.v1.CommandMetadata
+	4, // [4:4] is the sub-list for method output_type
+	4, // [4:4] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_poppit_v1_poppit_proto_init() }
+func file_poppit_v1_poppit_proto_init() {
+	if File_poppit_v1_poppit_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_poppit_v1_poppit_proto_rawDesc), len(file_poppit_v1_poppit_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_poppit_v1_poppit_proto_goTypes,
+		DependencyIndexes: file_poppit_v1_poppit_proto_depIdxs,
+		MessageInfos:      file_poppit_v1_poppit_proto_msgTypes,
+	}.Build()
+	File_poppit_v1_poppit_proto = out.File
+	file_poppit_v1_poppit_proto_goTypes = nil
+	file_poppit_v1_poppit_proto_depIdxs = nil
+}
@@ -0,0 +1,565 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: vibedeploy/v1/deployments.proto
+
+package vibedeployv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type TriggerDeploymentRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Slack message carrying PR metadata. When set, repository and branch are read from it.
+	Channel string `protobuf:"bytes,1,opt,name=channel,proto3" json:"channel,omitempty"`
+	Ts      string `protobuf:"bytes,2,opt,name=ts,proto3" json:"ts,omitempty"`
+	// Deploy a repository and branch directly, without a Slack message.
+	Repository string `protobuf:"bytes,3,opt,name=repository,proto3" json:"repository,omitempty"`
+	Branch     string `protobuf:"bytes,4,opt,name=branch,proto3" json:"branch,omitempty"`
+	PrNumber   int32  `protobuf:"varint,5,opt,name=pr_number,json=prNumber,proto3" json:"pr_number,omitempty"`
+	// Who asked for the deployment, recorded in history.
+	TriggeredBy   string `protobuf:"bytes,6,opt,name=triggered_by,json=triggeredBy,proto3" json:"triggered_by,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TriggerDeploymentRequest) Reset() {
+	*x = TriggerDeploymentRequest{}
+	mi := &file_vibedeploy_v1_deployments_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TriggerDeploymentRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TriggerDeploymentRequest) ProtoMessage() {}
+
+func (x *TriggerDeploymentRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_vibedeploy_v1_deployments_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TriggerDeploymentRequest.ProtoReflect.Descriptor instead.
+func (*TriggerDeploymentRequest) Descriptor() ([]byte, []int) {
+	return file_vibedeploy_v1_deployments_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *TriggerDeploymentRequest) GetChannel() string {
+	if x != nil {
+		return x.Channel
+	}
+	return ""
+}
+
+func (x *TriggerDeploymentRequest) GetTs() string {
+	if x != nil {
+		return x.Ts
+	}
+	return ""
+}
+
+func (x *TriggerDeploymentRequest) GetRepository() string {
+	if x != nil {
+		return x.Repository
+	}
+	return ""
+}
+
+func (x *TriggerDeploymentRequest) GetBranch() string {
+	if x != nil {
+		return x.Branch
+	}
+	return ""
+}
+
+func (x *TriggerDeploymentRequest) GetPrNumber() int32 {
+	if x != nil {
+		return x.PrNumber
+	}
+	return 0
+}
+
+func (x *TriggerDeploymentRequest) GetTriggeredBy() string {
+	if x != nil {
+		return x.TriggeredBy
+	}
+	return ""
+}
+
+type TriggerDeploymentResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Deployment    *Deployment            `protobuf:"bytes,1,opt,name=deployment,proto3" json:"deployment,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TriggerDeploymentResponse) Reset() {
+	*x = TriggerDeploymentResponse{}
+	mi := &file_vibedeploy_v1_deployments_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TriggerDeploymentResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TriggerDeploymentResponse) ProtoMessage() {}
+
+func (x *TriggerDeploymentResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_vibedeploy_v1_deployments_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TriggerDeploymentResponse.ProtoReflect.Descriptor instead.
+func (*TriggerDeploymentResponse) Descriptor() ([]byte, []int) {
+	return file_vibedeploy_v1_deployments_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *TriggerDeploymentResponse) GetDeployment() *Deployment {
+	if x != nil {
+		return x.Deployment
+	}
+	return nil
+}
+
+type GetStatusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatusRequest) Reset() {
+	*x = GetStatusRequest{}
+	mi := &file_vibedeploy_v1_deployments_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatusRequest) ProtoMessage() {}
+
+func (x *GetStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_vibedeploy_v1_deployments_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatusRequest.ProtoReflect.Descriptor instead.
+func (*GetStatusRequest) Descriptor() ([]byte, []int) {
+	return file_vibedeploy_v1_deployments_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetStatusRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type WatchDeploymentsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Only stream events for this repository (all repositories when empty).
+	Repository    string `protobuf:"bytes,1,opt,name=repository,proto3" json:"repository,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchDeploymentsRequest) Reset() {
+	*x = WatchDeploymentsRequest{}
+	mi := &file_vibedeploy_v1_deployments_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchDeploymentsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchDeploymentsRequest) ProtoMessage() {}
+
+func (x *WatchDeploymentsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_vibedeploy_v1_deployments_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchDeploymentsRequest.ProtoReflect.Descriptor instead.
+func (*WatchDeploymentsRequest) Descriptor() ([]byte, []int) {
+	return file_vibedeploy_v1_deployments_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *WatchDeploymentsRequest) GetRepository() string {
+	if x != nil {
+		return x.Repository
+	}
+	return ""
+}
+
+type DeploymentEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Lifecycle event type, e.g. "deployment.queued" or "deployment.succeeded".
+	Type       string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Timestamp  *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Deployment *Deployment            `protobuf:"bytes,3,opt,name=deployment,proto3" json:"deployment,omitempty"`
+	// ID of the entry in the vibedeploy:events stream.
+	Id            string `protobuf:"bytes,4,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeploymentEvent) Reset() {
+	*x = DeploymentEvent{}
+	mi := &file_vibedeploy_v1_deployments_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeploymentEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeploymentEvent) ProtoMessage() {}
+
+func (x *DeploymentEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_vibedeploy_v1_deployments_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeploymentEvent.ProtoReflect.Descriptor instead.
+func (*DeploymentEvent) Descriptor() ([]byte, []int) {
+	return file_vibedeploy_v1_deployments_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *DeploymentEvent) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *DeploymentEvent) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *DeploymentEvent) GetDeployment() *Deployment {
+	if x != nil {
+		return x.Deployment
+	}
+	return nil
+}
+
+func (x *DeploymentEvent) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type Deployment struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Repository    string                 `protobuf:"bytes,2,opt,name=repository,proto3" json:"repository,omitempty"`
+	Branch        string                 `protobuf:"bytes,3,opt,name=branch,proto3" json:"branch,omitempty"`
+	PrNumber      int32                  `protobuf:"varint,4,opt,name=pr_number,json=prNumber,proto3" json:"pr_number,omitempty"`
+	Channel       string                 `protobuf:"bytes,5,opt,name=channel,proto3" json:"channel,omitempty"`
+	Ts            string                 `protobuf:"bytes,6,opt,name=ts,proto3" json:"ts,omitempty"`
+	Status        string                 `protobuf:"bytes,7,opt,name=status,proto3" json:"status,omitempty"`
+	StartedAt     *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=started_at,json=startedAt,proto3" json:"started_at,omitempty"`
+	FinishedAt    *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=finished_at,json=finishedAt,proto3" json:"finished_at,omitempty"`
+	GitSha        string                 `protobuf:"bytes,10,opt,name=git_sha,json=gitSha,proto3" json:"git_sha,omitempty"`
+	FailureReason string                 `protobuf:"bytes,11,opt,name=failure_reason,json=failureReason,proto3" json:"failure_reason,omitempty"`
+	TriggeredBy   string                 `protobuf:"bytes,12,opt,name=triggered_by,json=triggeredBy,proto3" json:"triggered_by,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Deployment) Reset() {
+	*x = Deployment{}
+	mi := &file_vibedeploy_v1_deployments_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Deployment) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Deployment) ProtoMessage() {}
+
+func (x *Deployment) ProtoReflect() protoreflect.Message {
+	mi := &file_vibedeploy_v1_deployments_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Deployment.ProtoReflect.Descriptor instead.
+func (*Deployment) Descriptor() ([]byte, []int) {
+	return file_vibedeploy_v1_deployments_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Deployment) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Deployment) GetRepository() string {
+	if x != nil {
+		return x.Repository
+	}
+	return ""
+}
+
+func (x *Deployment) GetBranch() string {
+	if x != nil {
+		return x.Branch
+	}
+	return ""
+}
+
+func (x *Deployment) GetPrNumber() int32 {
+	if x != nil {
+		return x.PrNumber
+	}
+	return 0
+}
+
+func (x *Deployment) GetChannel() string {
+	if x != nil {
+		return x.Channel
+	}
+	return ""
+}
+
+func (x *Deployment) GetTs() string {
+	if x != nil {
+		return x.Ts
+	}
+	return ""
+}
+
+func (x *Deployment) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Deployment) GetStartedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartedAt
+	}
+	return nil
+}
+
+func (x *Deployment) GetFinishedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.FinishedAt
+	}
+	return nil
+}
+
+func (x *Deployment) GetGitSha() string {
+	if x != nil {
+		return x.GitSha
+	}
+	return ""
+}
+
+func (x *Deployment) GetFailureReason() string {
+	if x != nil {
+		return x.FailureReason
+	}
+	return ""
+}
+
+func (x *Deployment) GetTriggeredBy() string {
+	if x != nil {
+		return x.TriggeredBy
+	}
+	return ""
+}
+
+var File_vibedeploy_v1_deployments_proto protoreflect.FileDescriptor
+
+const file_vibedeploy_v1_deployments_proto_rawDesc = "" +
+	"\n" +
+	"\x1fvibedeploy/v1/deployments.proto\x12\rvibedeploy.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xbc\x01\n" +
+	"\x18TriggerDeploymentRequest\x12\x18\n" +
+	"\achannel\x18\x01 \x01(\tR\achannel\x12\x0e\n" +
+	"\x02ts\x18\x02 \x01(\tR\x02ts\x12\x1e\n" +
+	"\n" +
+	"repository\x18\x03 \x01(\tR\n" +
+	"repository\x12\x16\n" +
+	"\x06branch\x18\x04 \x01(\tR\x06branch\x12\x1b\n" +
+	"\tpr_number\x18\x05 \x01(\x05R\bprNumber\x12!\n" +
+	"\ftriggered_by\x18\x06 \x01(\tR\vtriggeredBy\"V\n" +
+	"\x19TriggerDeploymentResponse\x129\n" +
+	"\n" +
+	"deployment\x18\x01 \x01(\v2\x19.vibedeploy.v1.DeploymentR\n" +
+	"deployment\"\"\n" +
+	"\x10GetStatusRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"9\n" +
+	"\x17WatchDeploymentsRequest\x12\x1e\n" +
+	"\n" +
+	"repository\x18\x01 \x01(\tR\n" +
+	"repository\"\xaa\x01\n" +
+	"\x0fDeploymentEvent\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x128\n" +
+	"\ttimestamp\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x129\n" +
+	"\n" +
+	"deployment\x18\x03 \x01(\v2\x19.vibedeploy.v1.DeploymentR\n" +
+	"deployment\x12\x0e\n" +
+	"\x02id\x18\x04 \x01(\tR\x02id\"\x8e\x03\n" +
+	"\n" +
+	"Deployment\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1e\n" +
+	"\n" +
+	"repository\x18\x02 \x01(\tR\n" +
+	"repository\x12\x16\n" +
+	"\x06branch\x18\x03 \x01(\tR\x06branch\x12\x1b\n" +
+	"\tpr_number\x18\x04 \x01(\x05R\bprNumber\x12\x18\n" +
+	"\achannel\x18\x05 \x01(\tR\achannel\x12\x0e\n" +
+	"\x02ts\x18\x06 \x01(\tR\x02ts\x12\x16\n" +
+	"\x06status\x18\a \x01(\tR\x06status\x129\n" +
+	"\n" +
+	"started_at\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\tstartedAt\x12;\n" +
+	"\vfinished_at\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"finishedAt\x12\x17\n" +
+	"\agit_sha\x18\n" +
+	" \x01(\tR\x06gitSha\x12%\n" +
+	"\x0efailure_reason\x18\v \x01(\tR\rfailureReason\x12!\n" +
+	"\ftriggered_by\x18\f \x01(\tR\vtriggeredBy2\xa2\x02\n" +
+	"\x11DeploymentService\x12f\n" +
+	"\x11TriggerDeployment\x12'.vibedeploy.v1.TriggerDeploymentRequest\x1a(.vibedeploy.v1.TriggerDeploymentResponse\x12G\n" +
+	"\tGetStatus\x12\x1f.vibedeploy.v1.GetStatusRequest\x1a\x19.vibedeploy.v1.Deployment\x12\\\n" +
+	"\x10WatchDeployments\x12&.vibedeploy.v1.WatchDeploymentsRequest\x1a\x1e.vibedeploy.v1.DeploymentEvent0\x01BEZCgithub.com/its-the-vibe/VibeDeploy/proto/vibedeploy/v1;vibedeployv1b\x06proto3"
+
+var (
+	file_vibedeploy_v1_deployments_proto_rawDescOnce sync.Once
+	file_vibedeploy_v1_deployments_proto_rawDescData []byte
+)
+
+func file_vibedeploy_v1_deployments_proto_rawDescGZIP() []byte {
+	file_vibedeploy_v1_deployments_proto_rawDescOnce.Do(func() {
+		file_vibedeploy_v1_deployments_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_vibedeploy_v1_deployments_proto_rawDesc), len(file_vibedeploy_v1_deployments_proto_rawDesc)))
+	})
+	return file_vibedeploy_v1_deployments_proto_rawDescData
+}
+
+var file_vibedeploy_v1_deployments_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_vibedeploy_v1_deployments_proto_goTypes = []any{
+	(*TriggerDeploymentRequest)(nil),  // 0: vibedeploy.v1.TriggerDeploymentRequest
+	(*TriggerDeploymentResponse)(nil), // 1: vibedeploy.v1.TriggerDeploymentResponse
+	(*GetStatusRequest)(nil),          // 2: vibedeploy.v1.GetStatusRequest
+	(*WatchDeploymentsRequest)(nil),   // 3: vibedeploy.v1.WatchDeploymentsRequest
+	(*DeploymentEvent)(nil),           // 4: vibedeploy.v1.DeploymentEvent
+	(*Deployment)(nil),                // 5: vibedeploy.v1.Deployment
+	(*timestamppb.Timestamp)(nil),     // 6: google.protobuf.Timestamp
+}
+var file_vibedeploy_v1_deployments_proto_depIdxs = []int32{
+	5, // 0: vibedeploy.v1.TriggerDeploymentResponse.deployment:type_name -> vibedeploy.v1.Deployment
+	6, // 1: vibedeploy.v1.DeploymentEvent.timestamp:type_name -> google.protobuf.Timestamp
+	5, // 2: vibedeploy.v1.DeploymentEvent.deployment:type_name -> vibedeploy.v1.Deployment
+	6, // 3: vibedeploy.v1.Deployment.started_at:type_name -> google.protobuf.Timestamp
+	6, // 4: vibedeploy.v1.Deployment.finished_at:type_name -> google.protobuf.Timestamp
+	0, // 5: vibedeploy.v1.DeploymentService.TriggerDeployment:input_type -> vibedeploy.v1.TriggerDeploymentRequest
+	2, // 6: vibedeploy.v1.DeploymentService.GetStatus:input_type -> vibedeploy.v1.GetStatusRequest
+	3, // 7: vibedeploy.v1.DeploymentService.WatchDeployments:input_type -> vibedeploy.v1.WatchDeploymentsRequest
+	1, // 8: vibedeploy.v1.DeploymentService.TriggerDeployment:output_type -> vibedeploy.v1.TriggerDeploymentResponse
+	5, // 9: vibedeploy.v1.DeploymentService.GetStatus:output_type -> vibedeploy.v1.Deployment
+	4, // 10: vibedeploy.v1.DeploymentService.WatchDeployments:output_type -> vibedeploy.v1.DeploymentEvent
+	8, // [8:11] is the sub-list for method output_type
+	5, // [5:8] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_vibedeploy_v1_deployments_proto_init() }
+func file_vibedeploy_v1_deployments_proto_init() {
+	if File_vibedeploy_v1_deployments_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_vibedeploy_v1_deployments_proto_rawDesc), len(file_vibedeploy_v1_deployments_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_vibedeploy_v1_deployments_proto_goTypes,
+		DependencyIndexes: file_vibedeploy_v1_deployments_proto_depIdxs,
+		MessageInfos:      file_vibedeploy_v1_deployments_proto_msgTypes,
+	}.Build()
+	File_vibedeploy_v1_deployments_proto = out.File
+	file_vibedeploy_v1_deployments_proto_goTypes = nil
+	file_vibedeploy_v1_deployments_proto_depIdxs = nil
+}
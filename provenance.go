@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TagsCommand lists the tags of the checked-out commit, which make a deployment a release
+const TagsCommand = "git tag --points-at HEAD"
+
+// lockfileCommandPrefix starts the step that hashes the repository's dependency lockfiles
+const lockfileCommandPrefix = "sha256sum "
+
+// lockfilePattern is what a lockfile path may look like, so it can be passed to sha256sum as is
+var lockfilePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_./@+-]*$`)
+
+// ProvenanceConfig is the provenance section of a repository's settings
+type ProvenanceConfig struct {
+	// Tags are path.Match patterns of the tags that mark releases (default: v*)
+	Tags []string `yaml:"tags"`
+	// Lockfiles are dependency lockfiles hashed into the manifest, relative to the checkout, e.g. go.sum
+	Lockfiles []string `yaml:"lockfiles"`
+	// GitHubRelease also attaches the manifest to the tag's GitHub release, through the GitHub App
+	GitHubRelease bool `yaml:"github_release"`
+}
+
+func (c *ProvenanceConfig) validate() error {
+	for _, pattern := range c.Tags {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid tag pattern %q: %w", pattern, err)
+		}
+	}
+	for _, lockfile := range c.Lockfiles {
+		if !lockfilePattern.MatchString(lockfile) || strings.Contains(lockfile, "..") {
+			return fmt.Errorf("invalid lockfile %q", lockfile)
+		}
+	}
+	return nil
+}
+
+// releaseTag returns the first of the commit's tags that marks a release, or ""
+func (c *ProvenanceConfig) releaseTag(tags []string) string {
+	patterns := c.Tags
+	if len(patterns) == 0 {
+		patterns = []string{"v*"}
+	}
+	for _, tag := range tags {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, tag); ok {
+				return tag
+			}
+		}
+	}
+	return ""
+}
+
+// steps returns the capture steps the manifest is built from
+func (c *ProvenanceConfig) steps() []pipelineStep {
+	if c == nil {
+		return nil
+	}
+	steps := []pipelineStep{{"tags", TagsCommand}}
+	if len(c.Lockfiles) > 0 {
+		steps = append(steps, pipelineStep{"lockfiles", lockfileCommandPrefix + strings.Join(c.Lockfiles, " ")})
+	}
+	return steps
+}
+
+// isLockfileCommand reports whether a command is the lockfile hashing step
+func isLockfileCommand(command string) bool {
+	return strings.HasPrefix(command, lockfileCommandPrefix)
+}
+
+// parseTags parses TagsCommand output, one tag per line
+func parseTags(output string) []string {
+	var tags []string
+	for _, line := range strings.Split(output, "\n") {
+		if tag := strings.TrimSpace(line); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// parseLockfileHashes parses sha256sum output ("<hash>  <path>" per line)
+func parseLockfileHashes(output string) (map[string]string, error) {
+	hashes := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 || len(fields[0]) != 64 {
+			return nil, fmt.Errorf("unexpected sha256sum line: %q", line)
+		}
+		hashes[strings.TrimPrefix(fields[1], "*")] = fields[0]
+	}
+	return hashes, nil
+}
+
+// ProvenanceManifest records exactly what a release deployment put into an environment
+type ProvenanceManifest struct {
+	Repository   string            `json:"repository"`
+	Tag          string            `json:"tag"`
+	GitSHA       string            `json:"git_sha"`
+	Environment  string            `json:"environment,omitempty"`
+	DeploymentID string            `json:"deployment_id"`
+	DeployedAt   time.Time         `json:"deployed_at"`
+	DeployedBy   string            `json:"deployed_by,omitempty"`
+	Images       []ProvenanceImage `json:"images"`
+	Lockfiles    map[string]string `json:"lockfiles,omitempty"`
+	SBOMs        []SBOMInfo        `json:"sboms,omitempty"`
+}
+
+// ProvenanceImage is one container's image, with its registry digest when it was pushed
+type ProvenanceImage struct {
+	Container  string `json:"container"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag"`
+	ID         string `json:"id"`
+	Digest     string `json:"digest,omitempty"`
+}
+
+// provenanceManifest builds the manifest of a finished deployment
+func provenanceManifest(d *Deployment, tag string) *ProvenanceManifest {
+	manifest := &ProvenanceManifest{
+		Repository:   d.Repository,
+		Tag:          tag,
+		GitSHA:       d.Build.GitSHA,
+		Environment:  d.Environment,
+		DeploymentID: d.ID,
+		DeployedBy:   d.TriggeredBy,
+		Lockfiles:    d.Build.Lockfiles,
+		SBOMs:        d.SBOMs,
+		Images:       []ProvenanceImage{},
+	}
+	if d.FinishedAt != nil {
+		manifest.DeployedAt = *d.FinishedAt
+	}
+	// Digests are keyed by service, and images by container, which compose names <project>-<service>-<n>
+	services := make([]string, 0, len(d.Build.Digests))
+	for service := range d.Build.Digests {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	for _, image := range d.Build.Images {
+		entry := ProvenanceImage{Container: image.Container, Repository: image.Repository, Tag: image.Tag, ID: image.ID}
+		for _, service := range services {
+			if strings.Contains(image.Container, "-"+service+"-") {
+				entry.Digest = d.Build.Digests[service]
+				break
+			}
+		}
+		manifest.Images = append(manifest.Images, entry)
+	}
+	return manifest
+}
+
+// GitHubRelease is the subset of a GitHub release VibeDeploy uses
+type GitHubRelease struct {
+	ID        int64  `json:"id"`
+	HTMLURL   string `json:"html_url"`
+	UploadURL string `json:"upload_url"`
+}
+
+// releaseByTag returns the release of a tag
+func (g *GitHubApp) releaseByTag(ctx context.Context, repo, tag string) (*GitHubRelease, error) {
+	token, err := g.token(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	var release GitHubRelease
+	if err := g.do(ctx, token, http.MethodGet, "/repos/"+repo+"/releases/tags/"+url.PathEscape(tag), nil, &release); err != nil {
+		return nil, fmt.Errorf("failed to get release %s: %w", tag, err)
+	}
+	return &release, nil
+}
+
+// uploadReleaseAsset attaches a JSON file to a release. Uploads go to the host in the release's
+// upload_url template rather than the API.
+func (g *GitHubApp) uploadReleaseAsset(ctx context.Context, repo string, release *GitHubRelease, name string, data []byte) error {
+	token, err := g.token(ctx, repo)
+	if err != nil {
+		return err
+	}
+	uploadURL, _, _ := strings.Cut(release.UploadURL, "{")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL+"?name="+url.QueryEscape(name), bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call GitHub: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("GitHub returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// postProvenance publishes the manifest of a successful release deployment in its thread and, if configured,
+// on the tag's GitHub release
+func (a *App) postProvenance(ctx context.Context, d *Deployment) {
+	config := a.repoConfig(d.Repository).Provenance
+	if config == nil {
+		return
+	}
+	tag := config.releaseTag(d.Build.Tags)
+	if tag == "" {
+		return
+	}
+	manifest := provenanceManifest(d, tag)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		logError("Error marshalling provenance manifest of deployment %s: %v", d.ID, err)
+		return
+	}
+
+	releaseURL := ""
+	if config.GitHubRelease && a.github != nil {
+		release, err := a.github.releaseByTag(ctx, d.Repository, tag)
+		if err == nil {
+			err = a.github.uploadReleaseAsset(ctx, d.Repository, release, "provenance-"+d.ID+".json", data)
+		}
+		if err != nil {
+			logWarn("Could not attach the provenance manifest of deployment %s to release %s: %v", d.ID, tag, err)
+		} else {
+			releaseURL = release.HTMLURL
+			logInfo("Attached provenance manifest of deployment %s to release %s of %s", d.ID, tag, d.Repository)
+		}
+	}
+
+	text := a.messages.text("provenance.manifest", map[string]interface{}{
+		"Repository": d.Repository, "Tag": tag, "ReleaseURL": releaseURL, "Manifest": string(data),
+	})
+	if err := a.postThreadMessage(ctx, d.Channel, d.Ts, text); err != nil {
+		logError("Error posting provenance manifest of deployment %s: %v", d.ID, err)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Reverse proxy providers
+const (
+	TraefikProxyName = "traefik"
+	CaddyProxyName   = "caddy"
+)
+
+// ProxyRoute maps a preview hostname to the port the repository's stack listens on
+type ProxyRoute struct {
+	Repository string
+	Hostname   string
+	Upstream   string // host:port
+}
+
+// RouteProvider publishes and removes reverse proxy routes for preview hostnames
+type RouteProvider interface {
+	Name() string
+	Upsert(ctx context.Context, route ProxyRoute) error
+	Remove(ctx context.Context, repo string) error
+}
+
+// newRouteProvider builds the provider selected by PROXY_PROVIDER, or nil if none is configured
+func newRouteProvider(config Config) (RouteProvider, error) {
+	switch config.ProxyProvider {
+	case "":
+		return nil, nil
+	case TraefikProxyName:
+		if config.TraefikDynamicDir == "" {
+			return nil, fmt.Errorf("TRAEFIK_DYNAMIC_DIR is required for the %s proxy provider", TraefikProxyName)
+		}
+		return &TraefikFileProvider{dir: config.TraefikDynamicDir, entryPoints: config.TraefikEntryPoints}, nil
+	case CaddyProxyName:
+		if config.CaddyAdminURL == "" {
+			return nil, fmt.Errorf("CADDY_ADMIN_URL is required for the %s proxy provider", CaddyProxyName)
+		}
+		return &CaddyAPIProvider{
+			adminURL:   strings.TrimSuffix(config.CaddyAdminURL, "/"),
+			server:     config.CaddyServer,
+			httpClient: &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown PROXY_PROVIDER %q (expected %s or %s)", config.ProxyProvider, TraefikProxyName, CaddyProxyName)
+	}
+}
+
+// routeName is the router/service name for a repository, e.g. "vibedeploy-its-the-vibe-vibemerge"
+func routeName(repo string) string {
+	return "vibedeploy-" + strings.Trim(nonLabelChars.ReplaceAllString(strings.ToLower(repo), "-"), "-")
+}
+
+// TraefikFileProvider writes one dynamic configuration file per repository for Traefik's file provider
+type TraefikFileProvider struct {
+	dir         string
+	entryPoints []string
+}
+
+func (p *TraefikFileProvider) Name() string {
+	return TraefikProxyName
+}
+
+type traefikConfig struct {
+	HTTP struct {
+		Routers  map[string]traefikRouter  `yaml:"routers"`
+		Services map[string]traefikService `yaml:"services"`
+	} `yaml:"http"`
+}
+
+type traefikRouter struct {
+	Rule        string   `yaml:"rule"`
+	Service     string   `yaml:"service"`
+	EntryPoints []string `yaml:"entryPoints,omitempty"`
+}
+
+type traefikService struct {
+	LoadBalancer struct {
+		Servers []struct {
+			URL string `yaml:"url"`
+		} `yaml:"servers"`
+	} `yaml:"loadBalancer"`
+}
+
+func (p *TraefikFileProvider) path(repo string) string {
+	return filepath.Join(p.dir, routeName(repo)+".yml")
+}
+
+func (p *TraefikFileProvider) Upsert(ctx context.Context, route ProxyRoute) error {
+	name := routeName(route.Repository)
+
+	var service traefikService
+	service.LoadBalancer.Servers = append(service.LoadBalancer.Servers, struct {
+		URL string `yaml:"url"`
+	}{URL: "http://" + route.Upstream})
+
+	var config traefikConfig
+	config.HTTP.Routers = map[string]traefikRouter{
+		name: {Rule: fmt.Sprintf("Host(`%s`)", route.Hostname), Service: name, EntryPoints: p.entryPoints},
+	}
+	config.HTTP.Services = map[string]traefikService{name: service}
+
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal Traefik config: %w", err)
+	}
+
+	// Write then rename so Traefik's watcher never reads a half-written file
+	tmp := p.path(route.Repository) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write Traefik config: %w", err)
+	}
+	if err := os.Rename(tmp, p.path(route.Repository)); err != nil {
+		return fmt.Errorf("failed to install Traefik config: %w", err)
+	}
+	return nil
+}
+
+func (p *TraefikFileProvider) Remove(ctx context.Context, repo string) error {
+	if err := os.Remove(p.path(repo)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove Traefik config: %w", err)
+	}
+	return nil
+}
+
+// CaddyAPIProvider manages one route per repository through Caddy's admin API
+type CaddyAPIProvider struct {
+	adminURL   string
+	server     string
+	httpClient *http.Client
+}
+
+func (p *CaddyAPIProvider) Name() string {
+	return CaddyProxyName
+}
+
+func (p *CaddyAPIProvider) Upsert(ctx context.Context, route ProxyRoute) error {
+	// Caddy has no upsert, so replace any existing route with the same @id
+	if err := p.Remove(ctx, route.Repository); err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{
+		"@id":   routeName(route.Repository),
+		"match": []map[string]interface{}{{"host": []string{route.Hostname}}},
+		"handle": []map[string]interface{}{{
+			"handler":   "reverse_proxy",
+			"upstreams": []map[string]string{{"dial": route.Upstream}},
+		}},
+		"terminal": true,
+	}
+	return p.do(ctx, http.MethodPost, "/config/apps/http/servers/"+p.server+"/routes", body, false)
+}
+
+func (p *CaddyAPIProvider) Remove(ctx context.Context, repo string) error {
+	return p.do(ctx, http.MethodDelete, "/id/"+routeName(repo), nil, true)
+}
+
+// do calls the Caddy admin API; with allowMissing, an unknown @id is not an error
+func (p *CaddyAPIProvider) do(ctx context.Context, method, path string, body interface{}, allowMissing bool) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal Caddy route: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.adminURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to build Caddy request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call Caddy admin API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Caddy answers an unknown @id with 404, or 400 on older versions
+	if allowMissing && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest) {
+		return nil
+	}
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("Caddy admin API returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// publishRoute points the deployment's allocated hostname at its allocated port
+func (a *App) publishRoute(ctx context.Context, d *Deployment) {
+	if a.proxy == nil || d.Allocation == nil || d.Allocation.Hostname == "" || d.Allocation.Port == 0 {
+		return
+	}
+
+	route := ProxyRoute{
+		Repository: d.Allocation.key(),
+		Hostname:   d.Allocation.Hostname,
+		Upstream:   a.upstreamHost(d) + ":" + strconv.Itoa(d.Allocation.Port),
+	}
+	if err := a.proxy.Upsert(ctx, route); err != nil {
+		logError("Error publishing %s route for %s: %v", a.proxy.Name(), route.Hostname, err)
+		text := fmt.Sprintf(":warning: Deployed, but the %s route for `%s` could not be published: %v", a.proxy.Name(), route.Hostname, err)
+		if postErr := a.postThreadMessage(ctx, d.Channel, d.Ts, text); postErr != nil {
+			logError("Error posting route failure notice: %v", postErr)
+		}
+		return
+	}
+	logInfo("Published %s route %s -> %s", a.proxy.Name(), route.Hostname, route.Upstream)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/slack-go/slack"
+
+	poppitv1 "github.com/its-the-vibe/VibeDeploy/api/poppit/v1"
+)
+
+// CancelledReaction replaces the gear reaction on a deployment cancelled before it started
+const CancelledReaction = "no_entry_sign"
+
+// ErrDeploymentNotQueued is returned when cancelling a deployment that a worker has already picked up
+var ErrDeploymentNotQueued = errors.New("deployment is no longer queued")
+
+// QueuedDeployment is a deployment whose command is still waiting in a Redis list for a worker
+type QueuedDeployment struct {
+	// Queue is the list holding the command: a Poppit worker queue, or vibedeploy:pending while waiting for a slot
+	Queue      string      `json:"queue"`
+	Position   int         `json:"position"`
+	Deployment *Deployment `json:"deployment"`
+}
+
+// queuedEntry is a raw list entry and the command it decodes to
+type queuedEntry struct {
+	queue    string
+	position int
+	payload  string
+	cmd      *PoppitCommand
+}
+
+// queueLists are the lists a queued command can wait in, in the order they are drained
+func (a *App) queueLists() []string {
+	lists := []string{pendingKey}
+	// Only the Poppit executor queues commands in Redis; webhook runners take them straight away
+	if a.config.Executor == PoppitExecutorName {
+		lists = append(lists, a.config.PoppitQueues...)
+	}
+	return append(lists, a.hostQueues()...)
+}
+
+// queuedEntries decodes every command waiting in the queue lists
+func (a *App) queuedEntries(ctx context.Context) ([]queuedEntry, error) {
+	var entries []queuedEntry
+	for _, list := range a.queueLists() {
+		payloads, err := a.redisClient.LRange(ctx, list, 0, -1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", list, err)
+		}
+		for i, payload := range payloads {
+			plaintext, err := a.cipher.open([]byte(payload))
+			if err != nil {
+				logWarn("Skipping undecryptable entry %d of %s: %v", i, list, err)
+				continue
+			}
+			cmd, err := poppitv1.ParseCommand(plaintext)
+			if err != nil || cmd.Metadata == nil || cmd.Metadata.DeploymentID == "" {
+				continue
+			}
+			entries = append(entries, queuedEntry{queue: list, position: i, payload: payload, cmd: cmd})
+		}
+	}
+	return entries, nil
+}
+
+// listQueuedDeployments returns the deployments no worker has picked up yet
+func (a *App) listQueuedDeployments(ctx context.Context) ([]QueuedDeployment, error) {
+	entries, err := a.queuedEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	queued := make([]QueuedDeployment, 0, len(entries))
+	for _, entry := range entries {
+		d, err := a.deployments.Get(ctx, entry.cmd.Metadata.DeploymentID)
+		if err != nil {
+			logDebug("Skipping queued command for deployment %s: %v", entry.cmd.Metadata.DeploymentID, err)
+			continue
+		}
+		queued = append(queued, QueuedDeployment{Queue: entry.queue, Position: entry.position, Deployment: d})
+	}
+	return queued, nil
+}
+
+// cancelQueuedDeployment removes a deployment's command from its queue before a worker picks it up,
+// then records the cancellation and updates the deployment's Slack message
+func (a *App) cancelQueuedDeployment(ctx context.Context, id, by string) (*Deployment, error) {
+	d, err := a.deployments.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if d.Status != StatusQueued {
+		return nil, ErrDeploymentNotQueued
+	}
+
+	entries, err := a.queuedEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	removed := false
+	for _, entry := range entries {
+		if entry.cmd.Metadata.DeploymentID != id {
+			continue
+		}
+		// LREM of the exact payload is atomic: it fails once a worker has popped the entry, and only one canceller wins
+		count, err := a.redisClient.LRem(ctx, entry.queue, 1, entry.payload).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove deployment %s from %s: %w", id, entry.queue, err)
+		}
+		if count > 0 {
+			logInfo("Removed deployment %s from %s", id, entry.queue)
+			removed = true
+			break
+		}
+	}
+	if !removed {
+		return nil, ErrDeploymentNotQueued
+	}
+
+	if _, err := updateDeployment(ctx, a.deployments, id, func(d *Deployment) {
+		d.CancelledBy = by
+	}); err != nil {
+		logError("Error recording who cancelled deployment %s: %v", id, err)
+	}
+	a.finishDeployment(ctx, id, StatusCancelled)
+
+	if d, err = a.deployments.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := a.publishSlackReaction(ctx, d.Channel, d.Ts, GearReaction, true); err != nil {
+		logError("Error removing gear reaction: %v", err)
+	}
+	if err := a.publishSlackReaction(ctx, d.Channel, d.Ts, CancelledReaction, false); err != nil {
+		logError("Error publishing %s reaction: %v", CancelledReaction, err)
+	}
+	if d.Channel != "" {
+		text := fmt.Sprintf(":no_entry_sign: Deployment of *%s* (`%s`) was cancelled by %s before it started", d.Repository, d.Branch, formatMention(by))
+		if err := a.postThreadMessage(ctx, d.Channel, d.Ts, text); err != nil {
+			logError("Error posting cancellation of deployment %s: %v", d.ID, err)
+		}
+	}
+	return d, nil
+}
+
+// handleListQueue returns the deployments waiting for a worker, in the order they will run per queue
+func (a *App) handleListQueue(w http.ResponseWriter, r *http.Request) {
+	queued, err := a.listQueuedDeployments(r.Context())
+	if err != nil {
+		logError("Error listing queued deployments: %v", err)
+		http.Error(w, "failed to list queued deployments", http.StatusInternalServerError)
+		return
+	}
+
+	// Dashboard users and API keys only see deployments of repositories they may view
+	visible := queued
+	if principal, _ := r.Context().Value(principalKey{}).(*Principal); principal != nil {
+		visible = make([]QueuedDeployment, 0, len(queued))
+		for _, q := range queued {
+			if a.permits(principal, ActionView, q.Deployment.Repository) {
+				visible = append(visible, q)
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, visible)
+}
+
+// CancelRequest is the optional body of POST /api/deployments/{id}/cancel
+type CancelRequest struct {
+	CancelledBy string `json:"cancelled_by,omitempty"`
+}
+
+// handleCancelDeployment cancels a deployment that no worker has picked up yet
+func (a *App) handleCancelDeployment(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var req CancelRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCallbackBodySize)).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	d, err := a.deployments.Get(r.Context(), id)
+	if errors.Is(err, ErrDeploymentNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logError("Error loading deployment %s: %v", id, err)
+		http.Error(w, "failed to load deployment", http.StatusInternalServerError)
+		return
+	}
+	if !a.authorizeRequest(w, r, ActionDeploy, d.Repository) {
+		return
+	}
+
+	by := req.CancelledBy
+	if principal, _ := r.Context().Value(principalKey{}).(*Principal); principal != nil {
+		by = principal.Name
+	}
+	if by == "" {
+		by = "the HTTP API"
+	}
+
+	logInfo("HTTP cancel of deployment %s by %q", id, by)
+	d, err = a.cancelQueuedDeployment(r.Context(), id, by)
+	if errors.Is(err, ErrDeploymentNotQueued) {
+		http.Error(w, fmt.Sprintf("deployment %s is no longer queued", id), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		logError("Error cancelling deployment %s: %v", id, err)
+		http.Error(w, "failed to cancel deployment", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, d)
+}
+
+// queueAdminApp builds the parts of the service that cancelling a deployment touches, for the queue subcommand.
+// Cancelling frees a concurrency slot, so it includes the executor that dispatches the next pending deployment.
+func queueAdminApp(config Config, redisClient *redis.Client) (*App, error) {
+	reposConfig, err := loadReposConfig(config.AllowedReposConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load allowed repos config: %w", err)
+	}
+	var slackOptions []slack.Option
+	if config.SlackAPIURL != "" {
+		slackOptions = append(slackOptions, slack.OptionAPIURL(strings.TrimSuffix(config.SlackAPIURL, "/")+"/"))
+	}
+
+	app := &App{
+		config:       config,
+		redisClient:  redisClient,
+		slackClient:  slack.New(config.SlackToken, slackOptions...),
+		allowedRepos: reposConfig.allowedRepoSet(),
+		reposConfig:  reposConfig,
+		shedder:      newLoadShedder(),
+	}
+	if app.cipher, err = newPayloadCipher(config); err != nil {
+		return nil, err
+	}
+	if app.executor, err = newExecutor(config, redisClient, app.cipher); err != nil {
+		return nil, err
+	}
+	if app.deployments, err = newDeploymentStore(config, redisClient); err != nil {
+		return nil, err
+	}
+	if config.MaxConcurrent > 0 {
+		app.limiter = &ConcurrencyLimiter{redisClient: redisClient, max: config.MaxConcurrent, slotTTL: config.DeploymentSlotTTL}
+	}
+	if app.secrets, err = newSecretsProvider(config); err != nil {
+		return nil, err
+	}
+	if app.hosts, err = app.newHostExecutors(reposConfig.Hosts, redisClient); err != nil {
+		return nil, err
+	}
+	if app.github, err = newGitHubApp(config); err != nil {
+		return nil, err
+	}
+	if app.policy, err = newCommandPolicy(reposConfig.CommandPolicy); err != nil {
+		return nil, err
+	}
+	if app.messages, err = newMessageCatalog(config); err != nil {
+		return nil, err
+	}
+	return app, nil
+}
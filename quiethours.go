@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// heldChannelsKey is a Redis set of the channels with notifications held back for the end of their quiet hours
+const heldChannelsKey = "vibedeploy:notifications:held"
+
+// heldNotificationsKeyPrefix starts the Redis list of each channel's held notifications, oldest first
+const heldNotificationsKeyPrefix = "vibedeploy:notifications:held:"
+
+// recentNotificationKeyPrefix starts the keys that remember a notification was just posted, so repeats are coalesced
+const recentNotificationKeyPrefix = "vibedeploy:notifications:recent:"
+
+// NotificationsConfig tunes how deployment notifications reach channels
+type NotificationsConfig struct {
+	// QuietHours maps channel IDs to the hours during which their non-critical notifications are held back
+	QuietHours map[string]QuietHoursConfig `yaml:"quiet_hours"`
+	// CoalesceWindow drops a notification identical to one posted to the same channel this recently
+	CoalesceWindow Duration `yaml:"coalesce_window"`
+}
+
+// QuietHoursConfig is a daily window, which may span midnight, e.g. 22:00 to 08:00
+type QuietHoursConfig struct {
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+	// Timezone is the IANA zone the times are in (default: UTC)
+	Timezone string `yaml:"timezone"`
+}
+
+func (c *NotificationsConfig) validate() error {
+	for channel, quiet := range c.QuietHours {
+		if _, _, _, err := quiet.parse(); err != nil {
+			return fmt.Errorf("invalid quiet_hours for %s: %w", channel, err)
+		}
+	}
+	return nil
+}
+
+// parse returns the window's start and end as minutes since midnight, and its zone
+func (c QuietHoursConfig) parse() (start, end int, location *time.Location, err error) {
+	if start, err = minuteOfDay(c.Start); err != nil {
+		return 0, 0, nil, err
+	}
+	if end, err = minuteOfDay(c.End); err != nil {
+		return 0, 0, nil, err
+	}
+	if start == end {
+		return 0, 0, nil, fmt.Errorf("start and end are both %s", c.Start)
+	}
+	location = time.UTC
+	if c.Timezone != "" {
+		if location, err = time.LoadLocation(c.Timezone); err != nil {
+			return 0, 0, nil, fmt.Errorf("invalid timezone %q: %w", c.Timezone, err)
+		}
+	}
+	return start, end, location, nil
+}
+
+func minuteOfDay(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// contains reports whether t falls within the quiet hours
+func (c QuietHoursConfig) contains(t time.Time) bool {
+	start, end, location, err := c.parse()
+	if err != nil {
+		return false
+	}
+	t = t.In(location)
+	minute := t.Hour()*60 + t.Minute()
+	if start < end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// notificationsConfig returns the notifications section, or an empty one
+func (a *App) notificationsConfig() NotificationsConfig {
+	if a.reposConfig == nil || a.reposConfig.Notifications == nil {
+		return NotificationsConfig{}
+	}
+	return *a.reposConfig.Notifications
+}
+
+// notifyChannel posts a notification to a channel. Repeats of a notification within the coalesce window are dropped,
+// and non-critical ones are held back while the channel has quiet hours, to be posted together when they end.
+func (a *App) notifyChannel(ctx context.Context, channel, text string, critical bool) error {
+	config := a.notificationsConfig()
+	if window := time.Duration(config.CoalesceWindow); window > 0 {
+		sum := sha256.Sum256([]byte(text))
+		first, err := a.redisClient.SetNX(ctx, recentNotificationKeyPrefix+channel+":"+hex.EncodeToString(sum[:]), 1, window).Result()
+		if err != nil {
+			// Better a repeat than a lost notification
+			logError("Error checking for repeats of a notification to %s: %v", channel, err)
+		} else if !first {
+			logDebug("Coalesced a repeated notification to %s", channel)
+			return nil
+		}
+	}
+
+	if quiet, ok := config.QuietHours[channel]; ok && !critical && quiet.contains(time.Now()) {
+		pipe := a.redisClient.TxPipeline()
+		pipe.RPush(ctx, heldNotificationsKeyPrefix+channel, text)
+		pipe.SAdd(ctx, heldChannelsKey, channel)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("failed to hold notification for quiet hours: %w", err)
+		}
+		logDebug("Holding a notification to %s until its quiet hours end", channel)
+		return nil
+	}
+
+	if _, _, err := a.slackClient.PostMessageContext(ctx, channel, slack.MsgOptionText(text, false)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// runQuietHours posts the notifications held for each channel once its quiet hours are over
+func (a *App) runQuietHours(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		a.releaseHeldNotifications(ctx)
+
+		select {
+		case <-ctx.Done():
+			logInfo("Quiet hours context cancelled, exiting")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// releaseHeldNotifications posts each channel's held notifications as one message, unless it is still quiet there
+func (a *App) releaseHeldNotifications(ctx context.Context) {
+	channels, err := a.redisClient.SMembers(ctx, heldChannelsKey).Result()
+	if err != nil {
+		logError("Error listing channels with held notifications: %v", err)
+		return
+	}
+	sort.Strings(channels)
+	quietHours := a.notificationsConfig().QuietHours
+
+	for _, channel := range channels {
+		if quiet, ok := quietHours[channel]; ok && quiet.contains(time.Now()) {
+			continue
+		}
+		// Taking the list and deleting it in one transaction means only one instance posts it
+		pipe := a.redisClient.TxPipeline()
+		held := pipe.LRange(ctx, heldNotificationsKeyPrefix+channel, 0, -1)
+		pipe.Del(ctx, heldNotificationsKeyPrefix+channel)
+		pipe.SRem(ctx, heldChannelsKey, channel)
+		if _, err := pipe.Exec(ctx); err != nil {
+			logError("Error taking held notifications for %s: %v", channel, err)
+			continue
+		}
+		texts := held.Val()
+		if len(texts) == 0 {
+			continue
+		}
+
+		text := a.messages.text("quiet_hours.held", nil) + "\n" + strings.Join(texts, "\n")
+		if _, _, err := a.slackClient.PostMessageContext(ctx, channel, slack.MsgOptionText(text, false)); err != nil {
+			logError("Error posting held notifications to %s: %v", channel, err)
+			// Put them back for the next attempt
+			pipe := a.redisClient.TxPipeline()
+			pipe.LPush(ctx, heldNotificationsKeyPrefix+channel, reversed(texts)...)
+			pipe.SAdd(ctx, heldChannelsKey, channel)
+			if _, err := pipe.Exec(ctx); err != nil {
+				logError("Error restoring held notifications for %s: %v", channel, err)
+			}
+			continue
+		}
+		logInfo("Posted %d held notifications to %s", len(texts), channel)
+	}
+}
+
+// reversed returns the texts newest first, as LPush needs them to restore the original order
+func reversed(texts []string) []interface{} {
+	values := make([]interface{}, len(texts))
+	for i, text := range texts {
+		values[len(texts)-1-i] = text
+	}
+	return values
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// quotaOffersKeyPrefix holds, per quota rejection message, a Redis hash of number reaction to the deployment whose
+// workspace it tears down
+const quotaOffersKeyPrefix = "vibedeploy:quota:offers:"
+
+// quotaOfferTTL is how long a rejection's teardown reactions keep working
+const quotaOfferTTL = 24 * time.Hour
+
+// teardownReactions are the reactions offered on a quota rejection, one per workspace listed
+var teardownReactions = []string{"one", "two", "three", "four", "five", "six", "seven", "eight", "nine"}
+
+// ErrQuotaExceeded is returned for a feature deployment that would run more workspaces than a quota allows
+var ErrQuotaExceeded = errors.New("active environment quota reached")
+
+// workspaceQuota returns how many workspaces of a repository may run at once, or 0 for no limit
+func (a *App) workspaceQuota(repoConfig RepoConfig) int {
+	if repoConfig.MaxWorkspaces > 0 {
+		return repoConfig.MaxWorkspaces
+	}
+	return a.config.MaxWorkspacesPerRepo
+}
+
+// checkWorkspaceQuota refuses a feature deployment that would run more of the repository's, or the user's,
+// workspaces at once than allowed. A deployment of a branch replaces the branch's workspace, so the branch's own
+// workspaces don't count. The rejection lists the workspaces in the way, each with a reaction that tears it down.
+func (a *App) checkWorkspaceQuota(ctx context.Context, metadata *PRMetadata, repoConfig RepoConfig, channel, ts, user string) error {
+	repoQuota, userQuota := a.workspaceQuota(repoConfig), a.config.MaxWorkspacesPerUser
+	if repoQuota <= 0 && (userQuota <= 0 || user == "") {
+		return nil
+	}
+	workspaces, err := a.listWorkspaces(ctx)
+	if err != nil {
+		// The quota protects the host, so a deployment that can't be counted doesn't start
+		return err
+	}
+
+	var repoWorkspaces, userWorkspaces []*Workspace
+	for _, w := range workspaces {
+		if w.Repository == metadata.Repository && w.Branch == metadata.Branch {
+			continue
+		}
+		if w.Repository == metadata.Repository {
+			repoWorkspaces = append(repoWorkspaces, w)
+		}
+		if user != "" && w.TriggeredBy == user {
+			userWorkspaces = append(userWorkspaces, w)
+		}
+	}
+
+	var reason string
+	var blocking []*Workspace
+	switch {
+	case userQuota > 0 && user != "" && len(userWorkspaces) >= userQuota:
+		reason = fmt.Sprintf("you already run %d of %d feature environments", len(userWorkspaces), userQuota)
+		blocking = userWorkspaces
+	case repoQuota > 0 && len(repoWorkspaces) >= repoQuota:
+		reason = fmt.Sprintf("%s already runs %d of %d feature environments", metadata.Repository, len(repoWorkspaces), repoQuota)
+		blocking = repoWorkspaces
+	default:
+		return nil
+	}
+	logInfo("Not deploying %s (%s) for %s: %s", metadata.Repository, metadata.Branch, user, reason)
+	a.offerTeardown(ctx, metadata, channel, ts, user, reason, blocking)
+	return fmt.Errorf("%w: %s", ErrQuotaExceeded, reason)
+}
+
+// offerTeardown replies to a quota rejection with the workspaces in the way, reacting with a number for each so
+// one tap tears it down
+func (a *App) offerTeardown(ctx context.Context, metadata *PRMetadata, channel, ts, user, reason string, workspaces []*Workspace) {
+	if channel == "" {
+		return
+	}
+	if len(workspaces) > len(teardownReactions) {
+		workspaces = workspaces[:len(teardownReactions)]
+	}
+	lines := make([]string, 0, len(workspaces))
+	for i, w := range workspaces {
+		line := fmt.Sprintf(":%s: *%s* `%s` (%s", teardownReactions[i], w.Repository, w.Branch, w.DeploymentID)
+		if w.TriggeredBy != "" && w.TriggeredBy != user {
+			line += ", deployed by " + formatMention(w.TriggeredBy)
+		}
+		lines = append(lines, line+", since "+w.CreatedAt.Format("Jan 2 15:04 MST")+")")
+	}
+	text := a.messages.text("declined.quota", map[string]interface{}{
+		"User":       user,
+		"Repository": metadata.Repository,
+		"Branch":     metadata.Branch,
+		"Reason":     reason,
+		"Workspaces": strings.Join(lines, "\n"),
+	})
+	_, replyTs, err := a.slackClient.PostMessageContext(ctx, channel, slack.MsgOptionText(text, false), slack.MsgOptionTS(ts))
+	if err != nil {
+		logError("Error posting quota rejection: %v", err)
+		return
+	}
+	if len(workspaces) == 0 {
+		return
+	}
+
+	// The teardown notices go in the PR message's thread, next to the rejection
+	key := quotaOffersKeyPrefix + channel + ":" + replyTs
+	offers := map[string]interface{}{"thread": ts}
+	for i, w := range workspaces {
+		offers[teardownReactions[i]] = w.DeploymentID
+	}
+	pipe := a.redisClient.TxPipeline()
+	pipe.HSet(ctx, key, offers)
+	pipe.Expire(ctx, key, quotaOfferTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logError("Error recording teardown offers on message %s: %v", replyTs, err)
+		return
+	}
+	for i := range workspaces {
+		if err := a.publishSlackReaction(ctx, channel, replyTs, teardownReactions[i], false); err != nil {
+			logError("Error publishing %s reaction: %v", teardownReactions[i], err)
+		}
+	}
+}
+
+// teardownFromReaction tears down the workspace a number reaction on a quota rejection stands for
+func (a *App) teardownFromReaction(ctx context.Context, reaction, channel, ts, user string) {
+	key := quotaOffersKeyPrefix + channel + ":" + ts
+	id, err := a.redisClient.HGet(ctx, key, reaction).Result()
+	if err != nil {
+		logDebug("No teardown offered as :%s: on message %s in channel %s", reaction, ts, channel)
+		return
+	}
+	w, err := a.getWorkspace(ctx, id)
+	if errors.Is(err, ErrWorkspaceNotFound) {
+		logInfo("Workspace of deployment %s is already torn down", id)
+		return
+	}
+	if err != nil {
+		logError("Error loading workspace of deployment %s: %v", id, err)
+		return
+	}
+	if !a.authorize(a.slackIdentities(ctx, user), ActionDeploy, w.Repository, "") {
+		logInfo("User %s may not %s %s, ignoring :%s: reaction", user, ActionDeploy, w.Repository, reaction)
+		return
+	}
+	// Only the instance that claims the offer tears the workspace down
+	if claimed, err := a.redisClient.HDel(ctx, key, reaction).Result(); err != nil || claimed == 0 {
+		return
+	}
+	if thread, err := a.redisClient.HGet(ctx, key, "thread").Result(); err == nil {
+		ts = thread
+	}
+
+	if err := a.teardownWorkspace(ctx, id); err != nil {
+		logError("Error tearing down workspace of deployment %s: %v", id, err)
+		if postErr := a.postThreadMessage(ctx, channel, ts, fmt.Sprintf(":warning: Could not tear down *%s* `%s`: %v", w.Repository, w.Branch, err)); postErr != nil {
+			logError("Error posting teardown notice: %v", postErr)
+		}
+		return
+	}
+	text := a.messages.text("quota.teardown", map[string]interface{}{
+		"User":       user,
+		"Repository": w.Repository,
+		"Branch":     w.Branch,
+		"Deployment": w.DeploymentID,
+	})
+	if err := a.postThreadMessage(ctx, channel, ts, text); err != nil {
+		logError("Error posting teardown notice: %v", err)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Action is something a principal may do to a repository
+type Action string
+
+const (
+	ActionView    Action = "view"
+	ActionDeploy  Action = "deploy"
+	ActionApprove Action = "approve"
+	ActionAdmin   Action = "admin"
+)
+
+// defaultRoles are the built-in roles; the rbac.roles config section may redefine them or add more
+var defaultRoles = map[string][]Action{
+	"viewer":   {ActionView},
+	"deployer": {ActionView, ActionDeploy},
+	"approver": {ActionView, ActionDeploy, ActionApprove},
+	"admin":    {ActionView, ActionDeploy, ActionApprove, ActionAdmin},
+}
+
+// RBACConfig is the rbac section of the repos config file
+type RBACConfig struct {
+	// Groups maps a group name to its members (Slack user IDs or email addresses)
+	Groups map[string][]string `yaml:"groups"`
+	// Roles maps a role name to the actions it grants, overriding or extending defaultRoles
+	Roles    map[string][]Action `yaml:"roles"`
+	Bindings []RoleBinding       `yaml:"bindings"`
+}
+
+// RoleBinding grants a role to users and groups on a set of repositories and environments
+type RoleBinding struct {
+	Role   string   `yaml:"role"`
+	Users  []string `yaml:"users"`
+	Groups []string `yaml:"groups"`
+	// Repos are repository names or path.Match patterns such as its-the-vibe/*; empty means all repositories
+	Repos []string `yaml:"repos"`
+	// Environments restricts the binding to these environments; empty means all environments
+	Environments []string `yaml:"environments"`
+}
+
+// validate checks that every binding names a known role and group
+func (c *RBACConfig) validate() error {
+	for i, binding := range c.Bindings {
+		if _, ok := c.roleActions(binding.Role); !ok {
+			return fmt.Errorf("rbac binding %d uses unknown role %q", i, binding.Role)
+		}
+		for _, group := range binding.Groups {
+			if _, ok := c.Groups[group]; !ok {
+				return fmt.Errorf("rbac binding %d uses unknown group %q", i, group)
+			}
+		}
+		for _, pattern := range binding.Repos {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rbac binding %d has invalid repo pattern %q: %w", i, pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *RBACConfig) roleActions(role string) ([]Action, bool) {
+	if actions, ok := c.Roles[role]; ok {
+		return actions, true
+	}
+	actions, ok := defaultRoles[role]
+	return actions, ok
+}
+
+// anyEnvironment matches every environment binding, for checks that only ask whether an identity may take
+// the action somewhere
+const anyEnvironment = "*"
+
+// allows reports whether any of the principal's identities may perform the action on the repository
+// in the environment. An empty repo matches any repository binding, for checks that are not repo-specific.
+func (c *RBACConfig) allows(identities []string, action Action, repo, env string) bool {
+	for _, binding := range c.Bindings {
+		if !c.bindingCovers(binding, identities) {
+			continue
+		}
+		if repo != "" && !matchesAny(binding.Repos, repo) {
+			continue
+		}
+		if len(binding.Environments) > 0 && env != anyEnvironment && !containsString(binding.Environments, env) {
+			continue
+		}
+		actions, _ := c.roleActions(binding.Role)
+		for _, granted := range actions {
+			if granted == action {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// holders returns the users and groups granted the action on the repository in the environment, in binding order
+func (c *RBACConfig) holders(action Action, repo, env string) []string {
+	var holders []string
+	seen := make(map[string]bool)
+	for _, binding := range c.Bindings {
+		if !matchesAny(binding.Repos, repo) || (len(binding.Environments) > 0 && !containsString(binding.Environments, env)) {
+			continue
+		}
+		actions, _ := c.roleActions(binding.Role)
+		granted := false
+		for _, a := range actions {
+			granted = granted || a == action
+		}
+		if !granted {
+			continue
+		}
+		for _, user := range binding.Users {
+			if !seen[user] {
+				seen[user] = true
+				holders = append(holders, user)
+			}
+		}
+		for _, group := range binding.Groups {
+			if !seen["group:"+group] {
+				seen["group:"+group] = true
+				holders = append(holders, fmt.Sprintf("group %s (%d)", group, len(c.Groups[group])))
+			}
+		}
+	}
+	return holders
+}
+
+// bindingCovers reports whether a binding applies to any of the identities, directly or through a group
+func (c *RBACConfig) bindingCovers(binding RoleBinding, identities []string) bool {
+	for _, identity := range identities {
+		for _, user := range binding.Users {
+			if strings.EqualFold(user, identity) {
+				return true
+			}
+		}
+		for _, group := range binding.Groups {
+			for _, member := range c.Groups[group] {
+				if strings.EqualFold(member, identity) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// authorize consults the RBAC config; without an rbac section every action is allowed. An empty env is the
+// repository's default environment, the one its feature deployments go to.
+func (a *App) authorize(identities []string, action Action, repo, env string) bool {
+	if a.reposConfig == nil || a.reposConfig.RBAC == nil {
+		return true
+	}
+	if env == "" && repo != "" {
+		env = a.repoConfig(repo).defaultEnvironment()
+	}
+	return a.reposConfig.RBAC.allows(identities, action, repo, env)
+}
+
+// slackIdentities returns the Slack user ID and, when RBAC is configured, the user's email address
+// so bindings can name people the same way for Slack and the dashboard
+func (a *App) slackIdentities(ctx context.Context, userID string) []string {
+	identities := []string{userID}
+	if a.reposConfig == nil || a.reposConfig.RBAC == nil {
+		return identities
+	}
+
+	user, err := a.slackClient.GetUserInfoContext(ctx, userID)
+	if err != nil {
+		logWarn("Error looking up Slack user %s for RBAC, matching on user ID only: %v", userID, err)
+		return identities
+	}
+	if user.Profile.Email != "" {
+		identities = append(identities, user.Profile.Email)
+	}
+	return identities
+}
+
+// principalKey is the request context key for the authenticated principal
+type principalKey struct{}
+
+// Principal is who an HTTP request was authenticated as
+type Principal struct {
+	// Identities are matched against RBAC users and group members; API keys have none and rely on their scope
+	Identities []string
+	Name       string
+	// Repos is an API key's repository allow-list
+	Repos []string
+}
+
+func withPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// permits reports whether a principal may take the action on the repository: dashboard users through RBAC,
+// API keys through their repository allow-list. Requests served without authentication have no principal.
+func (a *App) permits(principal *Principal, action Action, repo string) bool {
+	if principal == nil {
+		return true
+	}
+	if len(principal.Identities) == 0 {
+		return matchesAny(principal.Repos, repo)
+	}
+	return a.authorize(principal.Identities, action, repo, "")
+}
+
+// authorizeRequest applies RBAC to a request authenticated as a dashboard user, and the repository
+// allow-list to one authenticated by API key
+func (a *App) authorizeRequest(w http.ResponseWriter, r *http.Request, action Action, repo string) bool {
+	principal, _ := r.Context().Value(principalKey{}).(*Principal)
+	if a.permits(principal, action, repo) {
+		return true
+	}
+
+	logWarn("Denied %s on %s to %s", action, repo, principal.Name)
+	http.Error(w, fmt.Sprintf("%s may not %s %s", principal.Name, action, repo), http.StatusForbidden)
+	return false
+}
+
+func matchesAny(patterns []string, repo string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, repo); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+// TestEnvironmentScopedBinding checks that a binding restricted to an environment grants deploys there and nowhere else
+func TestEnvironmentScopedBinding(t *testing.T) {
+	a := &App{reposConfig: &AllowedReposConfig{
+		Repos: map[string]RepoConfig{
+			"its-the-vibe/VibeMerge": {Environments: []EnvironmentConfig{{Name: "dev"}, {Name: "prod"}}},
+		},
+		RBAC: &RBACConfig{
+			Groups:   map[string][]string{"interns": {"U034EF5GH"}},
+			Bindings: []RoleBinding{{Role: "deployer", Groups: []string{"interns"}, Repos: []string{"its-the-vibe/*"}, Environments: []string{"dev"}}},
+		},
+	}}
+	interns := []string{"U034EF5GH"}
+
+	for _, tc := range []struct {
+		name    string
+		action  Action
+		repo    string
+		env     string
+		allowed bool
+	}{
+		{"deploy to dev", ActionDeploy, "its-the-vibe/VibeMerge", "dev", true},
+		{"deploy to the default environment", ActionDeploy, "its-the-vibe/VibeMerge", "", true},
+		{"view in the default environment", ActionView, "its-the-vibe/VibeMerge", "", true},
+		{"deploy to prod", ActionDeploy, "its-the-vibe/VibeMerge", "prod", false},
+		{"deploy without a promotion chain", ActionDeploy, "its-the-vibe/VibeLog", "", false},
+		{"approve in dev", ActionApprove, "its-the-vibe/VibeMerge", "dev", false},
+	} {
+		if got := a.authorize(interns, tc.action, tc.repo, tc.env); got != tc.allowed {
+			t.Errorf("%s: authorize = %v, want %v", tc.name, got, tc.allowed)
+		}
+	}
+	if !a.reposConfig.RBAC.allows(interns, ActionDeploy, "", anyEnvironment) {
+		t.Error("expected the binding to count for a check of any environment")
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// RegistryPasswordEnvVar carries the registry password to the login step, so it never appears in a command
+const RegistryPasswordEnvVar = "VIBEDEPLOY_REGISTRY_PASSWORD"
+
+// registryLoginPrefix starts the login step; the password is piped in from the environment
+const registryLoginPrefix = "printenv " + RegistryPasswordEnvVar + " | docker login --username "
+
+const ComposePushCommand = "docker compose push"
+
+// RegistryConfig is the registry section of a repository's settings
+type RegistryConfig struct {
+	// Server is the registry host, e.g. ghcr.io (default: Docker Hub)
+	Server string `yaml:"server"`
+	// Username and PasswordSecret log in to the registry; PasswordSecret is a name looked up in the secrets provider
+	Username       string `yaml:"username"`
+	PasswordSecret string `yaml:"password_secret"`
+
+	// Push runs docker compose push after the build
+	Push bool `yaml:"push"`
+	// Images are pushed individually with docker push, for images not built by the compose file
+	Images []string `yaml:"images"`
+}
+
+// validate checks that login settings are complete and something is pushed
+func (c *RegistryConfig) validate() error {
+	if (c.Username == "") != (c.PasswordSecret == "") {
+		return fmt.Errorf("registry needs both username and password_secret to log in")
+	}
+	if !c.Push && len(c.Images) == 0 && c.Username == "" {
+		return fmt.Errorf("registry has nothing to do: set push, images or login credentials")
+	}
+	return nil
+}
+
+// loginStep returns the docker login step, or "" if the registry needs no login
+func (c *RegistryConfig) loginStep() string {
+	if c == nil || c.Username == "" {
+		return ""
+	}
+	return strings.TrimSpace(registryLoginPrefix + c.Username + " --password-stdin " + c.Server)
+}
+
+// pushSteps returns the push steps, in the order they run
+func (c *RegistryConfig) pushSteps() []string {
+	if c == nil {
+		return nil
+	}
+	var steps []string
+	if c.Push {
+		steps = append(steps, ComposePushCommand)
+	}
+	for _, image := range c.Images {
+		steps = append(steps, "docker push "+image)
+	}
+	return steps
+}
+
+// registryEnv resolves the registry password for the login step, or returns nil if there is no login
+func (a *App) registryEnv(ctx context.Context, registry *RegistryConfig) (map[string]string, error) {
+	if registry == nil || registry.PasswordSecret == "" {
+		return nil, nil
+	}
+	password, err := a.secrets.Secret(ctx, registry.PasswordSecret)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve registry credentials from the %s secrets provider: %w", a.secrets.Name(), err)
+	}
+	return map[string]string{RegistryPasswordEnvVar: password}, nil
+}
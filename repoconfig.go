@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RepoConfig holds the per-repository settings from the repos section of the config file
+type RepoConfig struct {
+	// Profile names the entry of the profiles section these settings are laid over
+	Profile string `yaml:"profile"`
+
+	// Directory is the repository's checkout, under BASE_DIR unless absolute, when it isn't BASE_DIR/<owner>/<name>
+	Directory string `yaml:"directory"`
+
+	// Commands are templates of the deployment pipeline, its directory and completion command, for repositories
+	// that don't deploy with docker compose
+	Commands *CommandTemplates `yaml:"commands"`
+
+	// Timeouts maps pipeline step names (or "default") to the longest the step may run without producing output
+	Timeouts map[string]Duration `yaml:"timeouts"`
+
+	// Owners are Slack user IDs, user group IDs or handles tagged on failures and other repo-specific alerts
+	Owners []string `yaml:"owners"`
+
+	// OnCall is the handle of a Slack user group, e.g. team-api-oncall, resolved when a failure is posted and tagged
+	// in place of the owners
+	OnCall string `yaml:"oncall"`
+
+	// NotificationChannel additionally receives start/success/failure summaries for this repo's deployments
+	NotificationChannel string `yaml:"notification_channel"`
+
+	// PreviewURL is where a deployed branch can be reached, with {branch} (as a DNS label), {pr},
+	// and the pool's {port} and {hostname} placeholders
+	PreviewURL string `yaml:"preview_url"`
+
+	// Diagnostics are the read-only commands run by the :mag_right: reaction
+	Diagnostics []string `yaml:"diagnostics"`
+
+	// TLS provisions a certificate for the allocated hostname before the stack is brought up
+	TLS *TLSConfig `yaml:"tls"`
+
+	// Changelog announces successful deployments of production branches in a changelog channel
+	Changelog *ChangelogConfig `yaml:"changelog"`
+
+	// StatusPage updates a customer-facing status page component while the repository deploys
+	StatusPage *StatusPageConfig `yaml:"status_page"`
+
+	// Gate declines deployments of drafts or of commits whose required checks haven't passed
+	Gate *GateConfig `yaml:"gate"`
+
+	// AutoDeploy deploys PRs by these authors when they are merged, without a reaction
+	AutoDeploy *AutoDeployConfig `yaml:"auto_deploy"`
+
+	// Labels maps PR label names to what they do to deployments of the PR
+	Labels map[string]LabelRule `yaml:"labels"`
+
+	// Build sets cache options for the build step
+	Build *BuildConfig `yaml:"build"`
+
+	// Services maps changed paths to compose services, so a monorepo PR only redeploys what it touches
+	Services *ServicesConfig `yaml:"services"`
+
+	// BaseImages are watched for updates, which are offered as rebuilds
+	BaseImages *BaseImagesConfig `yaml:"base_images"`
+
+	// Registry adds docker login and push steps around the build
+	Registry *RegistryConfig `yaml:"registry"`
+
+	// Git sets the credentials fetches of a private repository use, on hosts without global ones
+	Git *GitConfig `yaml:"git"`
+
+	// Catalog maps the repository to service catalog entities whose deployed version is kept current
+	Catalog *CatalogComponentConfig `yaml:"catalog"`
+
+	// Annotations mark successful deployments on Grafana and CloudWatch dashboards
+	Annotations *RepoAnnotationsConfig `yaml:"annotations"`
+
+	// Flags are feature flag service flags checked before, and toggled after, deployments of the repository
+	Flags *FlagsConfig `yaml:"flags"`
+
+	// Infra deploys through Terraform Cloud or Spacelift runs instead of a pipeline
+	Infra *InfraConfig `yaml:"infra"`
+
+	// Provenance posts a manifest of what a tagged release deployment deployed
+	Provenance *ProvenanceConfig `yaml:"provenance"`
+
+	// SecurityScan captures SBOMs of the built images and scans them for vulnerabilities before they are pushed
+	SecurityScan *SecurityScanConfig `yaml:"security_scan"`
+
+	// Environments is the promotion chain in order: branches deploy to the first, and each successful
+	// deployment can be promoted, at the same commit, to the next
+	Environments []EnvironmentConfig `yaml:"environments"`
+
+	// Schedules rebuild and redeploy branches on cron schedules
+	Schedules []ScheduleConfig `yaml:"schedules"`
+
+	// EphemeralWorkspaces deploys each feature deployment from its own worktree of the checkout, deploy-<id>, as a
+	// compose project of its own, so several branches can run side by side
+	EphemeralWorkspaces bool `yaml:"ephemeral_workspaces"`
+	// MaxWorkspaces is how many of the repository's workspaces may run at once (default: MAX_WORKSPACES_PER_REPO)
+	MaxWorkspaces int `yaml:"max_workspaces"`
+
+	// Votes is how many distinct authorized :rocket: (or, for promotions, :arrow_double_up:) reactions a message
+	// needs before it deploys; environments can set their own (default: 1)
+	Votes int `yaml:"votes"`
+}
+
+// Duration is a time.Duration that unmarshals from strings such as "90s" or "15m"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var raw string
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", raw, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// repoConfig returns the settings for a repository, or the zero value if none are configured
+func (a *App) repoConfig(repo string) RepoConfig {
+	if a.reposConfig == nil {
+		return RepoConfig{}
+	}
+	return a.reposConfig.withDirectory(repo, a.reposConfig.Repos[repo])
+}
+
+// stepTimeout resolves the timeout for a pipeline step, falling back to the repo default and then the global default
+func (c RepoConfig) stepTimeout(step string, globalDefault time.Duration) time.Duration {
+	if timeout, ok := c.Timeouts[step]; ok {
+		return time.Duration(timeout)
+	}
+	if timeout, ok := c.Timeouts["default"]; ok {
+		return time.Duration(timeout)
+	}
+	return globalDefault
+}
+
+// nonLabelChars matches runs of characters that are not allowed in a DNS label
+var nonLabelChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// previewURL expands the preview URL template for a deployment, or returns "" if none is configured
+func (c RepoConfig) previewURL(metadata *PRMetadata, allocation *PoolAllocation) string {
+	if c.PreviewURL == "" {
+		return ""
+	}
+	branch := strings.Trim(nonLabelChars.ReplaceAllString(strings.ToLower(metadata.Branch), "-"), "-")
+	replacements := []string{"{branch}", branch, "{pr}", strconv.Itoa(metadata.PRNumber)}
+	if allocation != nil {
+		replacements = append(replacements, "{port}", strconv.Itoa(allocation.Port), "{hostname}", allocation.Hostname)
+	}
+	return strings.NewReplacer(replacements...).Replace(c.PreviewURL)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// repoNamePattern matches owner/name, as GitHub allows them
+var repoNamePattern = regexp.MustCompile(`^[\w.-]+/[\w.-]+$`)
+
+// scpLikePattern matches a clone URL in scp form, e.g. git@github.com:owner/name.git
+var scpLikePattern = regexp.MustCompile(`^[\w.-]+@[\w.-]+:(.+)$`)
+
+// normalizeRepository turns the forms a repository is given in into owner/name: clone URLs over HTTPS or SSH,
+// with or without .git, and links into the repository on the web. Anything else is returned as it was given.
+func normalizeRepository(repo string) string {
+	name := strings.TrimSpace(repo)
+	if m := scpLikePattern.FindStringSubmatch(name); m != nil && !strings.Contains(name, "://") {
+		name = m[1]
+	} else if _, rest, ok := strings.Cut(name, "://"); ok {
+		// The host, with any user and port, is up to the first slash
+		if _, path, ok := strings.Cut(rest, "/"); ok {
+			name = path
+		} else {
+			return strings.TrimSpace(repo)
+		}
+		// A link into the repository, e.g. to a pull request, names it with its first two segments
+		if parts := strings.SplitN(name, "/", 3); len(parts) == 3 {
+			name = parts[0] + "/" + parts[1]
+		}
+	}
+	name = strings.TrimSuffix(strings.Trim(name, "/"), ".git")
+	if !repoNamePattern.MatchString(name) {
+		return strings.TrimSpace(repo)
+	}
+	return name
+}
+
+// canonicalRepo returns a repository as the config spells it, for names that differ only in case or form from
+// one it lists, since GitHub names are case-insensitive. Repositories it doesn't list are only normalized.
+func (a *App) canonicalRepo(repo string) string {
+	name := normalizeRepository(repo)
+	if a.reposConfig == nil {
+		return name
+	}
+	if _, ok := a.reposConfig.Repos[name]; ok {
+		return name
+	}
+	for _, known := range a.reposConfig.AllowedRepos {
+		if strings.EqualFold(known, name) {
+			return known
+		}
+	}
+	for known := range a.reposConfig.Repos {
+		if strings.EqualFold(known, name) {
+			return known
+		}
+	}
+	return name
+}
+
+// repoDirectory returns where a repository is checked out: its directory setting, its owner's entry under
+// directories, or BASE_DIR/<owner>/<name>. A relative directory is under BASE_DIR.
+func (c RepoConfig) repoDirectory(baseDir, repo string) string {
+	if c.Directory == "" {
+		return fmt.Sprintf("%s/%s", baseDir, repo)
+	}
+	if filepath.IsAbs(c.Directory) {
+		return c.Directory
+	}
+	return fmt.Sprintf("%s/%s", baseDir, c.Directory)
+}
+
+// withDirectory fills in a repository's directory from its owner's entry under directories
+func (c *AllowedReposConfig) withDirectory(repo string, repoConfig RepoConfig) RepoConfig {
+	if repoConfig.Directory != "" {
+		return repoConfig
+	}
+	owner, name, ok := strings.Cut(repo, "/")
+	if dir, mapped := c.Directories[owner]; ok && mapped {
+		repoConfig.Directory = strings.TrimSuffix(dir, "/") + "/" + name
+	}
+	return repoConfig
+}
+
+// validateDirectories checks the directory settings, which end up in the pipeline's working directory
+func validateDirectories(directories map[string]string, repos map[string]RepoConfig) error {
+	check := func(where, dir string) error {
+		if strings.ContainsAny(dir, " \t\n;&|$`'\"") {
+			return fmt.Errorf("invalid %s %q", where, dir)
+		}
+		for _, part := range strings.Split(dir, "/") {
+			if part == ".." {
+				return fmt.Errorf("invalid %s %q: it must not contain ..", where, dir)
+			}
+		}
+		return nil
+	}
+	for owner, dir := range directories {
+		if strings.Contains(owner, "/") || dir == "" {
+			return fmt.Errorf("directories maps owners to a directory, not %q to %q", owner, dir)
+		}
+		if err := check("directory for "+owner, dir); err != nil {
+			return err
+		}
+	}
+	for repo, repoConfig := range repos {
+		if err := check("directory for "+repo, repoConfig.Directory); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// resourceGrowthWarning is the memory growth over the previous deployment that gets called out in the thread
+const resourceGrowthWarning = 2.0
+
+// ContainerResources is the CPU and memory footprint of one container right after a deployment
+type ContainerResources struct {
+	Container     string  `json:"container"`
+	CPUPercent    float64 `json:"cpu_percent"`
+	MemoryBytes   uint64  `json:"memory_bytes"`
+	MemoryPercent float64 `json:"memory_percent"`
+}
+
+// byteUnits maps the size suffixes docker stats uses to their multipliers
+var byteUnits = map[string]float64{
+	"B":   1,
+	"kB":  1e3,
+	"KB":  1e3,
+	"MB":  1e6,
+	"GB":  1e9,
+	"TB":  1e12,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+}
+
+// parseComposeStats parses `docker compose stats --no-stream --format json` output (one JSON object per line)
+func parseComposeStats(output string) ([]ContainerResources, error) {
+	type rawStats struct {
+		Name     string `json:"Name"`
+		CPUPerc  string `json:"CPUPerc"`
+		MemUsage string `json:"MemUsage"`
+		MemPerc  string `json:"MemPerc"`
+	}
+
+	var raw []rawStats
+	output = strings.TrimSpace(output)
+	if strings.HasPrefix(output, "[") {
+		if err := json.Unmarshal([]byte(output), &raw); err != nil {
+			return nil, fmt.Errorf("failed to parse compose stats: %w", err)
+		}
+	} else {
+		for _, line := range strings.Split(output, "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			var r rawStats
+			if err := json.Unmarshal([]byte(line), &r); err != nil {
+				return nil, fmt.Errorf("failed to parse compose stats line %q: %w", line, err)
+			}
+			raw = append(raw, r)
+		}
+	}
+
+	resources := make([]ContainerResources, 0, len(raw))
+	for _, r := range raw {
+		cpu, err := parsePercent(r.CPUPerc)
+		if err != nil {
+			return nil, err
+		}
+		memPercent, err := parsePercent(r.MemPerc)
+		if err != nil {
+			return nil, err
+		}
+		// MemUsage is "<used> / <limit>"
+		used, _, _ := strings.Cut(r.MemUsage, "/")
+		memory, err := parseByteSize(strings.TrimSpace(used))
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, ContainerResources{
+			Container:     r.Name,
+			CPUPercent:    cpu,
+			MemoryBytes:   memory,
+			MemoryPercent: memPercent,
+		})
+	}
+	return resources, nil
+}
+
+// parsePercent parses a docker stats percentage such as "12.5%"
+func parsePercent(s string) (float64, error) {
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "%"))
+	if s == "" || s == "--" {
+		return 0, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid percentage %q", s)
+	}
+	return v, nil
+}
+
+// parseByteSize parses a docker stats size such as "45.3MiB" or "1.2GB"
+func parseByteSize(s string) (uint64, error) {
+	if s == "" || s == "--" {
+		return 0, nil
+	}
+	i := strings.LastIndexAny(s, "0123456789.") + 1
+	multiplier, ok := byteUnits[strings.TrimSpace(s[i:])]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	v, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return uint64(v * multiplier), nil
+}
+
+// totalResources sums CPU and memory over all containers
+func totalResources(resources []ContainerResources) (cpu float64, memory uint64) {
+	for _, r := range resources {
+		cpu += r.CPUPercent
+		memory += r.MemoryBytes
+	}
+	return cpu, memory
+}
+
+// formatBytes renders a byte count with a binary unit, e.g. "45.3MiB"
+func formatBytes(n uint64) string {
+	for _, unit := range []string{"TiB", "GiB", "MiB", "KiB"} {
+		if size := byteUnits[unit]; float64(n) >= size {
+			return fmt.Sprintf("%.1f%s", float64(n)/size, unit)
+		}
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// resourceReport describes a deployment's footprint, compared with the previous deployment's when known
+func resourceReport(d, previous *Deployment) string {
+	cpu, memory := totalResources(d.Resources)
+	report := fmt.Sprintf(":bar_chart: Resource usage after deploy: %.1f%% CPU, %s memory across %d containers", cpu, formatBytes(memory), len(d.Resources))
+
+	if previous != nil {
+		prevCPU, prevMemory := totalResources(previous.Resources)
+		report += fmt.Sprintf(" (previous deploy: %.1f%% CPU, %s)", prevCPU, formatBytes(prevMemory))
+		if prevMemory > 0 && float64(memory) >= resourceGrowthWarning*float64(prevMemory) {
+			report += fmt.Sprintf("\n:warning: Memory is %.1fx the previous deployment", float64(memory)/float64(prevMemory))
+		}
+	}
+
+	for _, r := range d.Resources {
+		report += fmt.Sprintf("\n• `%s` %.1f%% CPU, %s (%.1f%%)", r.Container, r.CPUPercent, formatBytes(r.MemoryBytes), r.MemoryPercent)
+	}
+	return report
+}
+
+// recordResources stores the output of the stats step against its deployment and reports it in the thread
+func (a *App) recordResources(ctx context.Context, output CommandOutput) {
+	if output.Metadata.DeploymentID == "" {
+		logDebug("Stats output has no deployment ID, not recording resource usage")
+		return
+	}
+
+	resources, err := parseComposeStats(output.Output)
+	if err != nil {
+		logWarn("Could not parse resource usage for deployment %s: %v", output.Metadata.DeploymentID, err)
+		return
+	}
+
+	d, err := updateDeployment(ctx, a.deployments, output.Metadata.DeploymentID, func(d *Deployment) {
+		d.Resources = resources
+	})
+	if err != nil {
+		logError("Error recording resource usage for deployment %s: %v", output.Metadata.DeploymentID, err)
+		return
+	}
+	a.recordEvent(ctx, EventResourceUsage, d)
+
+	if err := a.postThreadMessage(ctx, d.Channel, d.Ts, resourceReport(d, a.previousResources(ctx, d))); err != nil {
+		logError("Error posting resource report for deployment %s: %v", d.ID, err)
+	}
+}
+
+// previousResources returns the most recent earlier deployment of the same repository that recorded resource usage
+func (a *App) previousResources(ctx context.Context, d *Deployment) *Deployment {
+	history, err := a.deployments.List(ctx, d.Repository, defaultHistoryLimit)
+	if err != nil {
+		logError("Error loading history for %s: %v", d.Repository, err)
+		return nil
+	}
+	for _, prev := range history {
+		if prev.ID != d.ID && prev.StartedAt.Before(d.StartedAt) && len(prev.Resources) > 0 {
+			return prev
+		}
+	}
+	return nil
+}
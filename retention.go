@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Export formats
+const (
+	ExportFormatJSON = "json"
+	ExportFormatCSV  = "csv"
+)
+
+// exportCSVHeader lists the columns written by CSV exports
+var exportCSVHeader = []string{"id", "repository", "branch", "pr_number", "status", "started_at", "finished_at", "git_sha", "failure_reason", "failure_category"}
+
+// runRetention periodically prunes deployment history according to the retention settings
+func (a *App) runRetention(ctx context.Context) {
+	ticker := time.NewTicker(a.config.HistoryPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		a.pruneHistory(ctx)
+
+		select {
+		case <-ctx.Done():
+			logInfo("Retention context cancelled, exiting")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pruneHistory applies the retention policy to every repository with recorded history
+func (a *App) pruneHistory(ctx context.Context) {
+	var cutoff time.Time
+	if a.config.HistoryRetentionDays > 0 {
+		cutoff = time.Now().AddDate(0, 0, -a.config.HistoryRetentionDays)
+	}
+
+	repos, err := a.deployments.Repositories(ctx)
+	if err != nil {
+		logError("Error listing repositories for retention: %v", err)
+		return
+	}
+
+	total := 0
+	for _, repo := range repos {
+		removed, err := a.deployments.Prune(ctx, repo, cutoff, a.config.HistoryMaxPerRepo)
+		if err != nil {
+			logError("Error pruning history for %s: %v", repo, err)
+			continue
+		}
+		if removed > 0 {
+			logDebug("Pruned %d deployments from %s history", removed, repo)
+		}
+		total += removed
+	}
+
+	if total > 0 {
+		logInfo("Retention pruned %d deployments across %d repositories", total, len(repos))
+	}
+}
+
+// collectExport gathers deployments for export, optionally limited to one repository and a start time, oldest first
+func collectExport(ctx context.Context, store DeploymentStore, repo string, since time.Time) ([]*Deployment, error) {
+	repos := []string{repo}
+	if repo == "" {
+		var err error
+		if repos, err = store.Repositories(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var deployments []*Deployment
+	for _, r := range repos {
+		history, err := store.List(ctx, r, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history for %s: %w", r, err)
+		}
+		for _, d := range history {
+			if d.StartedAt.Before(since) {
+				continue
+			}
+			deployments = append(deployments, d)
+		}
+	}
+
+	sort.Slice(deployments, func(i, j int) bool {
+		return deployments[i].StartedAt.Before(deployments[j].StartedAt)
+	})
+	return deployments, nil
+}
+
+// writeExport writes deployments in the requested format
+func writeExport(w io.Writer, format string, deployments []*Deployment) error {
+	switch format {
+	case ExportFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(deployments)
+	case ExportFormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(exportCSVHeader); err != nil {
+			return err
+		}
+		for _, d := range deployments {
+			finishedAt := ""
+			if d.FinishedAt != nil {
+				finishedAt = d.FinishedAt.Format(time.RFC3339)
+			}
+			record := []string{
+				d.ID,
+				d.Repository,
+				d.Branch,
+				strconv.Itoa(d.PRNumber),
+				d.Status,
+				d.StartedAt.Format(time.RFC3339),
+				finishedAt,
+				d.Build.GitSHA,
+				d.FailureReason,
+				d.FailureCategory,
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return fmt.Errorf("unknown export format %q (expected %s or %s)", format, ExportFormatJSON, ExportFormatCSV)
+	}
+}
+
+// parseExportSince parses the optional since filter (RFC 3339 timestamp or YYYY-MM-DD date)
+func parseExportSince(raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid since %q (expected RFC 3339 or YYYY-MM-DD)", raw)
+	}
+	return t, nil
+}
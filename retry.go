@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// retryCommandsKey is a Redis hash of deployment ID to its dispatched command (sealed like pending commands),
+	// kept so a retry runs exactly the same pipeline
+	retryCommandsKey = "vibedeploy:retry:commands"
+	// retrySignaturesKey is a Redis hash of deployment ID to the retryable output line its pipeline printed
+	retrySignaturesKey = "vibedeploy:retry:signatures"
+)
+
+// maxDeploymentRetries is how often a pipeline is re-queued before its failure is reported
+const maxDeploymentRetries = 1
+
+// RetryConfig is the retry section of the repos config file
+type RetryConfig struct {
+	// Patterns are regular expressions over step output that mark a failure as transient,
+	// e.g. "net/http: TLS handshake timeout" or "(?i)registry.*i/o timeout"
+	Patterns []string `yaml:"patterns"`
+}
+
+// RetryPolicy recognises transient failures from their output
+type RetryPolicy struct {
+	patterns []*regexp.Regexp
+}
+
+// newRetryPolicy compiles the configured patterns, or returns nil when there are none
+func newRetryPolicy(config *RetryConfig) (*RetryPolicy, error) {
+	if config == nil || len(config.Patterns) == 0 {
+		return nil, nil
+	}
+	policy := &RetryPolicy{}
+	for _, pattern := range config.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retry pattern %q: %w", pattern, err)
+		}
+		policy.patterns = append(policy.patterns, re)
+	}
+	return policy, nil
+}
+
+// match returns the first output line matching a retryable pattern, or ""
+func (p *RetryPolicy) match(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		for _, re := range p.patterns {
+			if re.MatchString(line) {
+				return strings.TrimSpace(line)
+			}
+		}
+	}
+	return ""
+}
+
+// rememberForRetry keeps the command a deployment is about to be dispatched with
+func (a *App) rememberForRetry(ctx context.Context, cmd PoppitCommand) {
+	if a.retry == nil || cmd.Metadata == nil || cmd.Metadata.DeploymentID == "" {
+		return
+	}
+	payload, err := json.Marshal(cmd)
+	if err != nil {
+		logError("Error marshaling command of deployment %s for retry: %v", cmd.Metadata.DeploymentID, err)
+		return
+	}
+	if payload, err = a.cipher.seal(payload); err != nil {
+		logError("Error encrypting command of deployment %s for retry: %v", cmd.Metadata.DeploymentID, err)
+		return
+	}
+	if err := a.redisClient.HSet(ctx, retryCommandsKey, cmd.Metadata.DeploymentID, payload).Err(); err != nil {
+		logError("Error storing command of deployment %s for retry: %v", cmd.Metadata.DeploymentID, err)
+	}
+}
+
+// recordRetrySignature notes that a step printed a transient failure, so the deployment is retried if it then fails
+func (a *App) recordRetrySignature(ctx context.Context, output CommandOutput) {
+	if a.retry == nil || output.Metadata.DeploymentID == "" {
+		return
+	}
+	line := a.retry.match(output.Output)
+	if line == "" {
+		return
+	}
+	logInfo("Output of %q for deployment %s looks transient: %s", output.Command, output.Metadata.DeploymentID, line)
+	if err := a.redisClient.HSet(ctx, retrySignaturesKey, output.Metadata.DeploymentID, line).Err(); err != nil {
+		logError("Error recording retry signature for deployment %s: %v", output.Metadata.DeploymentID, err)
+	}
+}
+
+// retryDeployment re-dispatches a failing deployment's pipeline once if its output showed a transient failure.
+// It reports whether the deployment was re-queued, in which case the failure is not reported.
+func (a *App) retryDeployment(ctx context.Context, id, reason string) bool {
+	if a.retry == nil {
+		return false
+	}
+	// A halted VibeDeploy shouldn't run broken pipelines a second time
+	if a.halted(ctx) {
+		return false
+	}
+
+	// Only the instance that claims the signature retries
+	signature, err := a.redisClient.HGet(ctx, retrySignaturesKey, id).Result()
+	if errors.Is(err, redis.Nil) {
+		return false
+	}
+	if err != nil {
+		logError("Error reading retry signature for deployment %s: %v", id, err)
+		return false
+	}
+	if claimed, err := a.redisClient.HDel(ctx, retrySignaturesKey, id).Result(); err != nil || claimed == 0 {
+		return false
+	}
+
+	payload, err := a.redisClient.HGet(ctx, retryCommandsKey, id).Bytes()
+	if err != nil {
+		logError("Error loading command of deployment %s for retry: %v", id, err)
+		return false
+	}
+	plaintext, err := a.cipher.open(payload)
+	if err != nil {
+		logError("Error decrypting command of deployment %s for retry: %v", id, err)
+		return false
+	}
+	var cmd PoppitCommand
+	if err := json.Unmarshal(plaintext, &cmd); err != nil {
+		logError("Error parsing command of deployment %s for retry: %v", id, err)
+		return false
+	}
+
+	retried := false
+	d, err := updateDeployment(ctx, a.deployments, id, func(d *Deployment) {
+		if d.Status != StatusQueued || d.Retries >= maxDeploymentRetries {
+			return
+		}
+		d.Retries++
+		d.RetryReason = signature
+		retried = true
+	})
+	if err != nil {
+		logError("Error recording retry of deployment %s: %v", id, err)
+		return false
+	}
+	if !retried {
+		return false
+	}
+
+	logWarn("Retrying deployment %s after a transient failure (%s): %s", id, reason, signature)
+	a.disarmWatchdog(ctx, id)
+	a.clearLog(ctx, id)
+	a.recordEvent(ctx, EventDeploymentRetried, d)
+	text := fmt.Sprintf(":repeat_one: The pipeline hit what looks like a transient failure, retrying once:\n```\n%s\n```", strings.ReplaceAll(signature, "```", "'''"))
+	if err := a.postThreadMessage(ctx, d.Channel, d.Ts, text); err != nil {
+		logError("Error posting retry notice for deployment %s: %v", id, err)
+	}
+
+	// The deployment still holds its concurrency slot, so skip the limiter
+	if err := a.execute(ctx, cmd); err != nil {
+		logError("Error re-dispatching deployment %s: %v", id, err)
+		return false
+	}
+	return true
+}
+
+// clearRetry drops a finished deployment's retry state
+func (a *App) clearRetry(ctx context.Context, id string) {
+	if a.retry == nil {
+		return
+	}
+	pipe := a.redisClient.TxPipeline()
+	pipe.HDel(ctx, retryCommandsKey, id)
+	pipe.HDel(ctx, retrySignaturesKey, id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logError("Error clearing retry state for deployment %s: %v", id, err)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// WorkflowRollback redeploys the commit that was deployed before the current one. It runs as a deployment of
+// that commit, so it is recorded with the deploy workflow and the deployment it rolled back from.
+const WorkflowRollback = "rollback"
+
+const RewindReaction = "rewind"
+
+// deployedRefsKey is a Redis hash of each repository's current and previous successfully deployed refs
+const deployedRefsKey = "vibedeploy:deployed-refs"
+
+// DeployedRef is a branch and commit a deployment brought up
+type DeployedRef struct {
+	Branch       string    `json:"branch"`
+	GitSHA       string    `json:"git_sha"`
+	PRNumber     int       `json:"pr_number,omitempty"`
+	DeploymentID string    `json:"deployment_id"`
+	DeployedAt   time.Time `json:"deployed_at"`
+}
+
+// DeployedRefs are what a repository's first environment runs and what it ran before
+type DeployedRefs struct {
+	Repository string       `json:"repository"`
+	Current    *DeployedRef `json:"current,omitempty"`
+	Previous   *DeployedRef `json:"previous,omitempty"`
+}
+
+// deployedRef is the ref a deployment record brought up
+func deployedRef(d *Deployment) *DeployedRef {
+	ref := &DeployedRef{
+		Branch:       d.Branch,
+		GitSHA:       d.Build.GitSHA,
+		PRNumber:     d.PRNumber,
+		DeploymentID: d.ID,
+		DeployedAt:   d.StartedAt,
+	}
+	if d.FinishedAt != nil {
+		ref.DeployedAt = *d.FinishedAt
+	}
+	return ref
+}
+
+// recordsRef reports whether a successful deployment replaced what a rollback would: later environments of a
+// promotion chain and ephemeral workspaces aren't what the shared checkout runs
+func (a *App) recordsRef(d *Deployment) bool {
+	environment := a.repoConfig(d.Repository).defaultEnvironment()
+	return d.Build.GitSHA != "" && d.Workspace == "" && (d.Environment == environment || d.Environment == "")
+}
+
+// recordDeployedRef makes a successful deployment's commit the repository's current ref, and the one it replaced
+// the previous. Redeploying the current commit keeps the previous one.
+func (a *App) recordDeployedRef(ctx context.Context, d *Deployment) {
+	if !a.recordsRef(d) {
+		return
+	}
+
+	refs, err := a.deployedRefs(ctx, d.Repository)
+	if err != nil {
+		logError("Error loading deployed refs of %s: %v", d.Repository, err)
+		return
+	}
+	ref := deployedRef(d)
+	if refs.Current != nil && refs.Current.GitSHA != ref.GitSHA {
+		refs.Previous = refs.Current
+	}
+	refs.Current = ref
+
+	data, err := json.Marshal(refs)
+	if err != nil {
+		logError("Error marshalling deployed refs of %s: %v", d.Repository, err)
+		return
+	}
+	if err := a.redisClient.HSet(ctx, deployedRefsKey, d.Repository, data).Err(); err != nil {
+		logError("Error recording deployed ref of %s: %v", d.Repository, err)
+		return
+	}
+	logDebug("Recorded %s at %s (%s) as deployed", d.Repository, shortSHA(ref.GitSHA), ref.Branch)
+}
+
+// deployedRefs returns a repository's recorded refs. Repositories last deployed before refs were recorded have
+// theirs read from the deployment history, and ones never deployed have none.
+func (a *App) deployedRefs(ctx context.Context, repo string) (*DeployedRefs, error) {
+	refs := &DeployedRefs{Repository: repo}
+	data, err := a.redisClient.HGet(ctx, deployedRefsKey, repo).Result()
+	if err == redis.Nil {
+		return a.historyRefs(ctx, repo)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(data), refs); err != nil {
+		return nil, fmt.Errorf("failed to parse deployed refs: %w", err)
+	}
+	refs.Repository = repo
+	return refs, nil
+}
+
+// historyRefs finds a repository's current and previous refs in its recent deployment history
+func (a *App) historyRefs(ctx context.Context, repo string) (*DeployedRefs, error) {
+	history, err := a.deployments.List(ctx, repo, defaultHistoryLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load history for %s: %w", repo, err)
+	}
+	refs := &DeployedRefs{Repository: repo}
+	for _, d := range history {
+		if d.Status != StatusSucceeded || workflowOf(d) != WorkflowDeploy || !a.recordsRef(d) {
+			continue
+		}
+		switch {
+		case refs.Current == nil:
+			refs.Current = deployedRef(d)
+		case d.Build.GitSHA != refs.Current.GitSHA:
+			refs.Previous = deployedRef(d)
+			return refs, nil
+		}
+	}
+	return refs, nil
+}
+
+// startRollback redeploys the repository's previously deployed commit, whichever branch the message is for.
+// Rolling back twice returns to the commit the first rollback replaced.
+func (a *App) startRollback(ctx context.Context, metadata *PRMetadata, options DeployOptions, channel, ts, user string) (*Deployment, error) {
+	refs, err := a.deployedRefs(ctx, metadata.Repository)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load deployed refs of %s: %w", metadata.Repository, err)
+	}
+	if refs.Current == nil || refs.Previous == nil {
+		if postErr := a.postThreadMessage(ctx, channel, ts, fmt.Sprintf(":rewind: Nothing to roll back to: %s has no earlier successful deployment on record.", metadata.Repository)); postErr != nil {
+			logError("Error posting rollback notice: %v", postErr)
+		}
+		return nil, fmt.Errorf("no earlier deployment of %s to roll back to", metadata.Repository)
+	}
+
+	current, previous := refs.Current, refs.Previous
+	text := fmt.Sprintf(":rewind: Rolling %s back from `%s` (%s) to `%s` (%s).", metadata.Repository, current.Branch, shortSHA(current.GitSHA), previous.Branch, shortSHA(previous.GitSHA))
+	if err := a.postThreadMessage(ctx, channel, ts, text); err != nil {
+		logError("Error posting rollback notice: %v", err)
+	}
+	rollback := &PRMetadata{Repository: metadata.Repository, Branch: previous.Branch, PRNumber: previous.PRNumber}
+	options.GitSHA = previous.GitSHA
+	options.RolledBackFrom = current.DeploymentID
+	return a.startDeployment(ctx, rollback, options, channel, ts, user)
+}
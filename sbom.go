@@ -0,0 +1,468 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sbomKeyPrefix starts the Redis hash of image to SBOM document kept for each deployment
+const sbomKeyPrefix = "vibedeploy:sboms:"
+
+// Security scanners, each of which also produces the SBOM
+const (
+	// ScannerGrype scans with grype and captures the SBOM with syft
+	ScannerGrype = "grype"
+	// ScannerTrivy does both with trivy
+	ScannerTrivy = "trivy"
+)
+
+// Security scan actions when a finding reaches the severity threshold
+const (
+	ScanActionBlock = "block"
+	ScanActionWarn  = "warn"
+)
+
+// severityRanks orders the severities scanners report; anything else ranks lowest
+var severityRanks = map[string]int{"negligible": 1, "low": 2, "medium": 3, "high": 4, "critical": 5}
+
+// scanSeverities are the accepted thresholds, in the order trivy lists them
+var scanSeverities = []string{"low", "medium", "high", "critical"}
+
+// maxReportedFindings bounds the findings kept on the deployment record and listed in Slack
+const (
+	maxReportedFindings = 50
+	maxPostedFindings   = 10
+)
+
+// The SBOM and scan steps loop over the compose file's images and print one "<image> <JSON>" line each.
+// They are recognised by these prefixes, since the pipeline is generated and uses nothing else like them.
+const (
+	imageLoopPrefix = "for image in $(docker compose config --images); do "
+	scanStepPrefix  = "status=0; " + imageLoopPrefix
+)
+
+// SecurityScanConfig is the security_scan section of a repository's settings
+type SecurityScanConfig struct {
+	// Scanner is grype (default) or trivy
+	Scanner string `yaml:"scanner"`
+	// Severity is the lowest severity that blocks or warns: low, medium, high or critical (default)
+	Severity string `yaml:"severity"`
+	// Action is block (default), which fails the deployment before it is pushed or brought up, or warn
+	Action string `yaml:"action"`
+	// SBOM captures a CycloneDX software bill of materials of each image before it is scanned
+	SBOM bool `yaml:"sbom"`
+}
+
+func (c *SecurityScanConfig) validate() error {
+	if c.Scanner != "" && c.Scanner != ScannerGrype && c.Scanner != ScannerTrivy {
+		return fmt.Errorf("unknown scanner %q (expected %s or %s)", c.Scanner, ScannerGrype, ScannerTrivy)
+	}
+	if c.Severity != "" && severityRanks[c.Severity] < severityRanks[scanSeverities[0]] {
+		return fmt.Errorf("unknown severity %q (expected one of %s)", c.Severity, strings.Join(scanSeverities, ", "))
+	}
+	if c.Action != "" && c.Action != ScanActionBlock && c.Action != ScanActionWarn {
+		return fmt.Errorf("unknown action %q (expected %s or %s)", c.Action, ScanActionBlock, ScanActionWarn)
+	}
+	return nil
+}
+
+func (c *SecurityScanConfig) scanner() string {
+	if c.Scanner == "" {
+		return ScannerGrype
+	}
+	return c.Scanner
+}
+
+func (c *SecurityScanConfig) severity() string {
+	if c.Severity == "" {
+		return "critical"
+	}
+	return c.Severity
+}
+
+func (c *SecurityScanConfig) blocks() bool {
+	return c.Action != ScanActionWarn
+}
+
+// sbomStep returns the SBOM capture step, or "" if the repository doesn't keep SBOMs
+func (c *SecurityScanConfig) sbomStep() string {
+	if c == nil || !c.SBOM {
+		return ""
+	}
+	return sbomCommand(c.scanner())
+}
+
+// scanStep returns the vulnerability scan step, or "" if the repository isn't scanned
+func (c *SecurityScanConfig) scanStep() string {
+	if c == nil {
+		return ""
+	}
+	return scanCommand(c.scanner(), c.severity(), c.blocks())
+}
+
+func sbomCommand(scanner string) string {
+	tool := `syft -q -o cyclonedx-json "$image"`
+	if scanner == ScannerTrivy {
+		tool = `trivy image -q -f cyclonedx "$image"`
+	}
+	return imageLoopPrefix + `echo "$image $(` + tool + ` | tr -d '\n')"; done`
+}
+
+// scanCommand runs the scanner on every image. When blocking, the step exits non-zero if any image has a
+// finding at or above the threshold (or couldn't be scanned), which stops the pipeline before the push.
+func scanCommand(scanner, severity string, block bool) string {
+	var tool string
+	switch scanner {
+	case ScannerTrivy:
+		var severities []string
+		for _, s := range scanSeverities {
+			if severityRanks[s] >= severityRanks[severity] {
+				severities = append(severities, strings.ToUpper(s))
+			}
+		}
+		tool = "trivy image -q -f json --severity " + strings.Join(severities, ",")
+		if block {
+			tool += " --exit-code 1"
+		}
+	default:
+		tool = "grype -q -o json"
+		if block {
+			tool += " --fail-on " + severity
+		}
+	}
+	onFailure := "true"
+	if block {
+		onFailure = "status=1"
+	}
+	return scanStepPrefix + `report=$(` + tool + ` "$image") || ` + onFailure +
+		`; echo "$image $(printf '%s' "$report" | tr -d '\n')"; done; exit $status`
+}
+
+// securityScanCommands are every SBOM and scan step the settings can generate, for the command policy
+func securityScanCommands() []string {
+	var commands []string
+	for _, scanner := range []string{ScannerGrype, ScannerTrivy} {
+		commands = append(commands, sbomCommand(scanner))
+		for _, severity := range scanSeverities {
+			commands = append(commands, scanCommand(scanner, severity, true), scanCommand(scanner, severity, false))
+		}
+	}
+	return commands
+}
+
+// isSBOMCommand reports whether a command is an SBOM capture step
+func isSBOMCommand(command string) bool {
+	return strings.HasPrefix(command, imageLoopPrefix)
+}
+
+// isScanCommand reports whether a command is a vulnerability scan step
+func isScanCommand(command string) bool {
+	return strings.HasPrefix(command, scanStepPrefix)
+}
+
+// SBOMInfo summarises the SBOM captured for one image; the document itself is served by the API
+type SBOMInfo struct {
+	Image      string `json:"image"`
+	Format     string `json:"format"`
+	Components int    `json:"components"`
+	SHA256     string `json:"sha256"`
+}
+
+// VulnerabilityReport is what the security scan found in a deployment's images
+type VulnerabilityReport struct {
+	Scanner   string `json:"scanner"`
+	Threshold string `json:"threshold"`
+	// Counts maps each severity to the number of findings, across every image
+	Counts map[string]int `json:"counts,omitempty"`
+	// Findings are the ones at or above the threshold, most severe first
+	Findings []VulnerabilityFinding `json:"findings,omitempty"`
+	// Unscanned are images the scanner couldn't report on
+	Unscanned []string `json:"unscanned,omitempty"`
+	// Blocked is set when the findings failed the deployment
+	Blocked bool `json:"blocked,omitempty"`
+}
+
+// VulnerabilityFinding is one vulnerability in one package of an image
+type VulnerabilityFinding struct {
+	ID       string `json:"id"`
+	Severity string `json:"severity"`
+	Image    string `json:"image"`
+	Package  string `json:"package"`
+	Version  string `json:"version"`
+	FixedIn  string `json:"fixed_in,omitempty"`
+}
+
+// splitImageLines parses the "<image> <JSON>" lines the SBOM and scan steps print, in order
+func splitImageLines(output string) (images []string, documents map[string]string) {
+	documents = make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		image, document, _ := strings.Cut(strings.TrimSpace(line), " ")
+		if image == "" {
+			continue
+		}
+		if _, seen := documents[image]; !seen {
+			images = append(images, image)
+		}
+		documents[image] = strings.TrimSpace(document)
+	}
+	return images, documents
+}
+
+// parseScanReport reads a grype or trivy JSON report into findings
+func parseScanReport(image, document string) ([]VulnerabilityFinding, error) {
+	var report struct {
+		// grype
+		Matches []struct {
+			Vulnerability struct {
+				ID       string `json:"id"`
+				Severity string `json:"severity"`
+				Fix      struct {
+					Versions []string `json:"versions"`
+				} `json:"fix"`
+			} `json:"vulnerability"`
+			Artifact struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"artifact"`
+		} `json:"matches"`
+		// trivy
+		Results []struct {
+			Vulnerabilities []struct {
+				VulnerabilityID  string `json:"VulnerabilityID"`
+				PkgName          string `json:"PkgName"`
+				InstalledVersion string `json:"InstalledVersion"`
+				FixedVersion     string `json:"FixedVersion"`
+				Severity         string `json:"Severity"`
+			} `json:"Vulnerabilities"`
+		} `json:"Results"`
+	}
+	if err := json.Unmarshal([]byte(document), &report); err != nil {
+		return nil, fmt.Errorf("failed to parse scan report of %s: %w", image, err)
+	}
+
+	var findings []VulnerabilityFinding
+	for _, match := range report.Matches {
+		findings = append(findings, VulnerabilityFinding{
+			ID:       match.Vulnerability.ID,
+			Severity: strings.ToLower(match.Vulnerability.Severity),
+			Image:    image,
+			Package:  match.Artifact.Name,
+			Version:  match.Artifact.Version,
+			FixedIn:  strings.Join(match.Vulnerability.Fix.Versions, ", "),
+		})
+	}
+	for _, result := range report.Results {
+		for _, v := range result.Vulnerabilities {
+			findings = append(findings, VulnerabilityFinding{
+				ID:       v.VulnerabilityID,
+				Severity: strings.ToLower(v.Severity),
+				Image:    image,
+				Package:  v.PkgName,
+				Version:  v.InstalledVersion,
+				FixedIn:  v.FixedVersion,
+			})
+		}
+	}
+	return findings, nil
+}
+
+// buildVulnerabilityReport collects the scan step's output of every image into a report
+func buildVulnerabilityReport(config *SecurityScanConfig, output string) *VulnerabilityReport {
+	report := &VulnerabilityReport{Scanner: config.scanner(), Threshold: config.severity(), Counts: make(map[string]int)}
+	threshold := severityRanks[report.Threshold]
+	images, documents := splitImageLines(output)
+	for _, image := range images {
+		findings, err := parseScanReport(image, documents[image])
+		if err != nil {
+			logWarn("%v", err)
+			report.Unscanned = append(report.Unscanned, image)
+			continue
+		}
+		for _, finding := range findings {
+			report.Counts[finding.Severity]++
+			if severityRanks[finding.Severity] >= threshold {
+				report.Findings = append(report.Findings, finding)
+			}
+		}
+	}
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return severityRanks[report.Findings[i].Severity] > severityRanks[report.Findings[j].Severity]
+	})
+	if len(report.Findings) > maxReportedFindings {
+		report.Findings = report.Findings[:maxReportedFindings]
+	}
+	return report
+}
+
+// findingCount is how many findings reached the threshold, including any beyond those kept
+func (r *VulnerabilityReport) findingCount() int {
+	total := 0
+	for severity, count := range r.Counts {
+		if severityRanks[severity] >= severityRanks[r.Threshold] {
+			total += count
+		}
+	}
+	return total
+}
+
+// findingLines lists the first findings for the Slack thread
+func (r *VulnerabilityReport) findingLines() string {
+	var lines []string
+	for i, f := range r.Findings {
+		if i == maxPostedFindings {
+			break
+		}
+		line := fmt.Sprintf("• `%s` %s in %s %s (%s)", f.ID, f.Severity, f.Package, f.Version, f.Image)
+		if f.FixedIn != "" {
+			line += ", fixed in " + f.FixedIn
+		}
+		lines = append(lines, line)
+	}
+	if more := r.findingCount() - len(lines); more > 0 {
+		lines = append(lines, fmt.Sprintf("…and %d more", more))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// recordSBOM keeps the SBOM documents of a deployment's images and summarises them on its record
+func (a *App) recordSBOM(ctx context.Context, output CommandOutput) {
+	if output.Metadata.DeploymentID == "" {
+		return
+	}
+	id := output.Metadata.DeploymentID
+	images, documents := splitImageLines(output.Output)
+	key := sbomKeyPrefix + id
+	var sboms []SBOMInfo
+	for _, image := range images {
+		var document struct {
+			BOMFormat  string            `json:"bomFormat"`
+			Components []json.RawMessage `json:"components"`
+		}
+		if err := json.Unmarshal([]byte(documents[image]), &document); err != nil {
+			logWarn("Could not parse SBOM of %s for deployment %s: %v", image, id, err)
+			continue
+		}
+		if err := a.redisClient.HSet(ctx, key, image, documents[image]).Err(); err != nil {
+			logError("Error saving SBOM of %s for deployment %s: %v", image, id, err)
+			continue
+		}
+		sum := sha256.Sum256([]byte(documents[image]))
+		sboms = append(sboms, SBOMInfo{
+			Image:      image,
+			Format:     strings.ToLower(document.BOMFormat),
+			Components: len(document.Components),
+			SHA256:     hex.EncodeToString(sum[:]),
+		})
+	}
+	// The documents go with the deployment record once retention drops it
+	if a.config.HistoryRetentionDays > 0 {
+		a.redisClient.Expire(ctx, key, time.Duration(a.config.HistoryRetentionDays)*24*time.Hour)
+	}
+
+	d, err := updateDeployment(ctx, a.deployments, id, func(d *Deployment) {
+		d.SBOMs = sboms
+	})
+	if err != nil {
+		logError("Error recording SBOMs for deployment %s: %v", id, err)
+		return
+	}
+	a.recordEvent(ctx, EventBuildMetadata, d)
+	logInfo("Captured SBOMs of %d images for deployment %s", len(sboms), id)
+}
+
+// recordScan stores the vulnerability scan's findings, reports them in the thread and, under the block
+// action, fails the deployment
+func (a *App) recordScan(ctx context.Context, output CommandOutput) {
+	if output.Metadata.DeploymentID == "" {
+		return
+	}
+	id := output.Metadata.DeploymentID
+	existing, err := a.deployments.Get(ctx, id)
+	if err != nil {
+		logError("Error loading deployment %s for security scan: %v", id, err)
+		return
+	}
+	config := a.repoConfig(existing.Repository).SecurityScan
+	if config == nil {
+		return
+	}
+
+	report := buildVulnerabilityReport(config, output.Output)
+	count := report.findingCount()
+	report.Blocked = config.blocks() && (count > 0 || len(report.Unscanned) > 0)
+	d, err := updateDeployment(ctx, a.deployments, id, func(d *Deployment) {
+		d.Vulnerabilities = report
+	})
+	if err != nil {
+		logError("Error recording security scan for deployment %s: %v", id, err)
+		return
+	}
+	a.recordEvent(ctx, EventSecurityScan, d)
+	logInfo("Security scan of deployment %s found %d %s+ vulnerabilities, %d images unscanned", id, count, report.Threshold, len(report.Unscanned))
+
+	if len(report.Unscanned) > 0 {
+		text := a.messages.text("scan.failed", map[string]interface{}{
+			"Scanner": report.Scanner, "Images": strings.Join(report.Unscanned, ", "), "Blocked": report.Blocked,
+		})
+		if err := a.postThreadMessage(ctx, d.Channel, d.Ts, text); err != nil {
+			logError("Error posting security scan failure for deployment %s: %v", id, err)
+		}
+	}
+	if count > 0 {
+		text := a.messages.text("scan.findings", map[string]interface{}{
+			"Scanner": report.Scanner, "Count": count, "Severity": report.Threshold, "Blocked": report.Blocked, "Findings": report.findingLines(),
+		})
+		if err := a.postThreadMessage(ctx, d.Channel, d.Ts, text); err != nil {
+			logError("Error posting security scan findings for deployment %s: %v", id, err)
+		}
+	}
+
+	if !report.Blocked {
+		return
+	}
+	reason := fmt.Sprintf(":shield: %d vulnerabilities rated %s or worse", count, report.Threshold)
+	if count == 0 {
+		reason = fmt.Sprintf(":shield: %s could not scan %s", report.Scanner, strings.Join(report.Unscanned, ", "))
+	}
+	a.failDeployment(ctx, id, reason)
+}
+
+// handleDeploymentSBOM serves the SBOM documents captured for a deployment, keyed by image
+func (a *App) handleDeploymentSBOM(w http.ResponseWriter, r *http.Request) {
+	d, err := a.deployments.Get(r.Context(), r.PathValue("id"))
+	if errors.Is(err, ErrDeploymentNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logError("Error loading deployment %s: %v", r.PathValue("id"), err)
+		http.Error(w, "failed to load deployment", http.StatusInternalServerError)
+		return
+	}
+	if !a.authorizeRequest(w, r, ActionView, d.Repository) {
+		return
+	}
+	raw, err := a.redisClient.HGetAll(r.Context(), sbomKeyPrefix+d.ID).Result()
+	if err != nil {
+		logError("Error loading SBOMs of deployment %s: %v", d.ID, err)
+		http.Error(w, "failed to load SBOMs", http.StatusInternalServerError)
+		return
+	}
+	if len(raw) == 0 {
+		http.Error(w, "deployment has no SBOM", http.StatusNotFound)
+		return
+	}
+	documents := make(map[string]json.RawMessage, len(raw))
+	for image, document := range raw {
+		documents[image] = json.RawMessage(document)
+	}
+	writeJSON(w, http.StatusOK, documents)
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// ScheduleTriggeredBy is recorded as who triggered a scheduled deployment
+const ScheduleTriggeredBy = "schedule"
+
+// scheduleClaimKeyPrefix starts the keys that let only one VibeDeploy instance run each scheduled slot
+const scheduleClaimKeyPrefix = "vibedeploy:schedule:"
+
+// scheduleClaimTTL is how long a claimed slot is remembered, comfortably longer than instances' clocks disagree
+const scheduleClaimTTL = time.Hour
+
+// ScheduleConfig rebuilds and redeploys a branch on a cron schedule, e.g. to pick up base image updates overnight
+type ScheduleConfig struct {
+	// Cron is a standard five-field expression: minute, hour, day of month, month, day of week
+	Cron   string `yaml:"cron"`
+	Branch string `yaml:"branch"`
+	// Environment is the environment to deploy to (default: the first)
+	Environment string `yaml:"environment"`
+	// CleanBuild builds without cache and re-pulls base images
+	CleanBuild bool `yaml:"clean_build"`
+	// Timezone is the IANA zone the expression is read in (default: UTC)
+	Timezone string `yaml:"timezone"`
+}
+
+// cronSchedule is a parsed cron expression; each field is a bitmask of the values it matches
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// With both day fields restricted, cron runs on days matching either
+	domAny, dowAny bool
+	location       *time.Location
+}
+
+// cronField is the range of one field of a cron expression
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{{"minute", 0, 59}, {"hour", 0, 23}, {"day of month", 1, 31}, {"month", 1, 12}, {"day of week", 0, 7}}
+
+// parse parses the schedule's cron expression and time zone
+func (s ScheduleConfig) parse() (*cronSchedule, error) {
+	fields := strings.Fields(s.Cron)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron %q needs %d fields, has %d", s.Cron, len(cronFields), len(fields))
+	}
+	masks := make([]uint64, len(fields))
+	for i, field := range fields {
+		mask, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron %q: %w", s.Cron, err)
+		}
+		masks[i] = mask
+	}
+	location := time.UTC
+	if s.Timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(s.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", s.Timezone, err)
+		}
+	}
+	// Sunday is both 0 and 7
+	if masks[4]&(1<<7) != 0 {
+		masks[4] |= 1
+	}
+	return &cronSchedule{
+		minute: masks[0], hour: masks[1], dom: masks[2], month: masks[3], dow: masks[4],
+		domAny: fields[2] == "*", dowAny: fields[4] == "*",
+		location: location,
+	}, nil
+}
+
+// parseCronField parses a comma-separated list of *, values, ranges and /steps
+func parseCronField(field string, f cronField) (uint64, error) {
+	var mask uint64
+	for _, part := range strings.Split(field, ",") {
+		expr, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %s %q", f.name, part)
+			}
+			expr = part[:i]
+		}
+		low, high := f.min, f.max
+		switch {
+		case expr == "*":
+		case strings.Contains(expr, "-"):
+			bounds := strings.SplitN(expr, "-", 2)
+			var err1, err2 error
+			low, err1 = strconv.Atoi(bounds[0])
+			high, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("invalid range in %s %q", f.name, part)
+			}
+		default:
+			value, err := strconv.Atoi(expr)
+			if err != nil {
+				return 0, fmt.Errorf("invalid %s %q", f.name, part)
+			}
+			low, high = value, value
+			if step > 1 {
+				high = f.max
+			}
+		}
+		if low < f.min || high > f.max || low > high {
+			return 0, fmt.Errorf("%s %q is outside %d-%d", f.name, part, f.min, f.max)
+		}
+		for v := low; v <= high; v += step {
+			mask |= 1 << v
+		}
+	}
+	return mask, nil
+}
+
+// matches reports whether the schedule runs in the minute starting at t
+func (c *cronSchedule) matches(t time.Time) bool {
+	t = t.In(c.location)
+	if c.minute&(1<<t.Minute()) == 0 || c.hour&(1<<t.Hour()) == 0 || c.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	dom, dow := c.dom&(1<<t.Day()) != 0, c.dow&(1<<int(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// validateSchedules checks each schedule parses and deploys to an environment that may be deployed unattended
+func (c RepoConfig) validateSchedules() error {
+	for i, s := range c.Schedules {
+		if _, err := s.parse(); err != nil {
+			return fmt.Errorf("schedule %d: %w", i, err)
+		}
+		if s.Branch == "" {
+			return fmt.Errorf("schedule %d needs a branch", i)
+		}
+		if s.Environment == "" {
+			continue
+		}
+		env := c.environmentIndex(s.Environment)
+		if env < 0 {
+			return fmt.Errorf("schedule %d deploys to unknown environment %q", i, s.Environment)
+		}
+		if c.Environments[env].RequireApproval {
+			return fmt.Errorf("schedule %d deploys to %q, which requires approval", i, s.Environment)
+		}
+	}
+	return nil
+}
+
+// hasSchedules reports whether any repository has a schedule to run
+func (a *App) hasSchedules() bool {
+	if a.reposConfig != nil {
+		for _, repoConfig := range a.reposConfig.Repos {
+			if len(repoConfig.Schedules) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// runSchedules starts every repository's scheduled deployments as their minute comes round.
+// Minutes are checked in order from the last one checked, so a late tick doesn't skip a run.
+func (a *App) runSchedules(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	checked := time.Now().Truncate(time.Minute)
+	for {
+		select {
+		case <-ctx.Done():
+			logInfo("Schedule context cancelled, exiting")
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now().Truncate(time.Minute)
+		for minute := checked.Add(time.Minute); !minute.After(now); minute = minute.Add(time.Minute) {
+			a.runScheduledMinute(ctx, minute)
+		}
+		checked = now
+	}
+}
+
+// runScheduledMinute starts the deployments scheduled for the minute starting at t
+func (a *App) runScheduledMinute(ctx context.Context, t time.Time) {
+	repos := make([]string, 0, len(a.reposConfig.Repos))
+	for repo := range a.reposConfig.Repos {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+
+	for _, repo := range repos {
+		for i, s := range a.reposConfig.Repos[repo].Schedules {
+			schedule, err := s.parse()
+			if err != nil || !schedule.matches(t) {
+				continue
+			}
+			// Every instance runs the same schedules; the first to claim the slot deploys it
+			key := fmt.Sprintf("%s%s:%d:%d", scheduleClaimKeyPrefix, repo, i, t.Unix())
+			claimed, err := a.redisClient.SetNX(ctx, key, 1, scheduleClaimTTL).Result()
+			if err != nil {
+				logError("Error claiming schedule %d of %s: %v", i, repo, err)
+				continue
+			}
+			if !claimed {
+				logDebug("Schedule %d of %s at %s already started elsewhere", i, repo, t.Format(time.RFC3339))
+				continue
+			}
+			a.startScheduledDeployment(ctx, repo, s)
+		}
+	}
+}
+
+// startScheduledDeployment deploys a schedule's branch. It is announced in the repository's notification channel,
+// if it has one, so its progress reactions and failure replies go there.
+func (a *App) startScheduledDeployment(ctx context.Context, repo string, s ScheduleConfig) {
+	if !isRepoAllowed(repo, a.allowedRepos) {
+		logWarn("Skipping schedule of %s, which is not an allowed repository", repo)
+		return
+	}
+	logInfo("Starting scheduled deployment of %s (%s) to %q", repo, s.Branch, s.Environment)
+
+	var ts string
+	channel := a.repoConfig(repo).NotificationChannel
+	if channel != "" {
+		text := a.messages.text("schedule.announce", map[string]interface{}{"Repository": repo, "Branch": s.Branch, "Environment": s.Environment, "Cron": s.Cron})
+		var err error
+		if _, ts, err = a.slackClient.PostMessageContext(ctx, channel, slack.MsgOptionText(text, false)); err != nil {
+			logError("Error announcing scheduled deployment of %s in %s: %v", repo, channel, err)
+			channel = ""
+		}
+	}
+
+	metadata := &PRMetadata{Repository: repo, Branch: s.Branch}
+	options := DeployOptions{Environment: s.Environment, CleanBuild: s.CleanBuild}
+	d, err := a.startDeployment(ctx, metadata, options, channel, ts, ScheduleTriggeredBy)
+	if errors.Is(err, ErrDeploymentDeclined) {
+		// startWorkflow already explained in the thread
+		logInfo("Scheduled deployment of %s (%s) declined: %s", repo, s.Branch, declinedReason(err))
+		return
+	}
+	if err != nil {
+		logError("Error starting scheduled deployment of %s (%s): %v", repo, s.Branch, err)
+		return
+	}
+	logInfo("Scheduled deployment %s of %s (%s) started", d.ID, repo, s.Branch)
+}
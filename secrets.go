@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Secrets providers
+const (
+	EnvSecretsProviderName  = "env"
+	FileSecretsProviderName = "file"
+)
+
+// SecretsProvider resolves named secrets, such as registry passwords, when a pipeline needs them
+type SecretsProvider interface {
+	Name() string
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+// newSecretsProvider builds the provider selected by SECRETS_PROVIDER
+func newSecretsProvider(config Config) (SecretsProvider, error) {
+	switch config.SecretsProvider {
+	case EnvSecretsProviderName:
+		return EnvSecretsProvider{}, nil
+	case FileSecretsProviderName:
+		if config.SecretsDir == "" {
+			return nil, fmt.Errorf("SECRETS_DIR is required for the %s secrets provider", FileSecretsProviderName)
+		}
+		return FileSecretsProvider{dir: config.SecretsDir}, nil
+	default:
+		return nil, fmt.Errorf("unknown SECRETS_PROVIDER %q (expected %s or %s)", config.SecretsProvider, EnvSecretsProviderName, FileSecretsProviderName)
+	}
+}
+
+// EnvSecretsProvider reads secrets from VibeDeploy's own environment variables
+type EnvSecretsProvider struct{}
+
+func (EnvSecretsProvider) Name() string {
+	return EnvSecretsProviderName
+}
+
+func (EnvSecretsProvider) Secret(ctx context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return "", fmt.Errorf("secret %s is not set in the environment", name)
+	}
+	return value, nil
+}
+
+// FileSecretsProvider reads one secret per file, as mounted by Docker or Kubernetes secrets
+type FileSecretsProvider struct {
+	dir string
+}
+
+func (FileSecretsProvider) Name() string {
+	return FileSecretsProviderName
+}
+
+func (p FileSecretsProvider) Secret(ctx context.Context, name string) (string, error) {
+	// Secret names come from the config file, but still must not escape the secrets directory
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid secret name %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(p.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("secret %s not found in %s", name, p.dir)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %s: %w", name, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
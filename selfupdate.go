@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// selfUpdateClaimKeyPrefix starts the keys that let only one VibeDeploy instance announce each new image
+const selfUpdateClaimKeyPrefix = "vibedeploy:self-update:"
+
+const selfUpdateClaimTTL = 7 * 24 * time.Hour
+
+// restartLockKey is held by an instance draining for a restart until its replacement, or any new instance,
+// has subscribed to the reaction events, so a rolling restart takes the instances down one at a time
+const restartLockKey = "vibedeploy:restart"
+
+// restartPollInterval is how often a draining instance checks whether the previous one has been replaced
+const restartPollInterval = time.Second
+
+// runSelfUpdateChecks periodically asks the registry whether SELF_UPDATE_IMAGE points at a newer image than the
+// one running
+func (a *App) runSelfUpdateChecks(ctx context.Context) {
+	client := &http.Client{Timeout: registryTimeout}
+	ticker := time.NewTicker(a.config.SelfUpdateCheckInterval)
+	defer ticker.Stop()
+
+	running := a.config.SelfImageDigest
+	for {
+		running = a.checkSelfUpdate(ctx, client, running)
+
+		select {
+		case <-ctx.Done():
+			logInfo("Self-update check context cancelled, exiting")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkSelfUpdate announces a new image in the ops channel, returning the digest of the running one. Without
+// SELF_IMAGE_DIGEST, the first digest seen is taken to be the one running.
+func (a *App) checkSelfUpdate(ctx context.Context, client *http.Client, running string) string {
+	ref, err := parseImageReference(a.config.SelfUpdateImage)
+	if err != nil {
+		return running
+	}
+	digest, err := imageDigest(ctx, client, ref)
+	if err != nil {
+		logWarn("Error checking %s for updates: %v", a.config.SelfUpdateImage, err)
+		return running
+	}
+	if running == "" {
+		logInfo("Running %s at %s", a.config.SelfUpdateImage, shortHash(digest))
+		return digest
+	}
+	if digest == running {
+		return running
+	}
+
+	// Every instance polls the same image; the first to claim the update announces it
+	claimed, err := a.redisClient.SetNX(ctx, selfUpdateClaimKeyPrefix+digest, 1, selfUpdateClaimTTL).Result()
+	if err != nil {
+		logError("Error claiming update to %s: %v", shortHash(digest), err)
+		return running
+	}
+	if !claimed {
+		return running
+	}
+	logInfo("%s was updated from %s to %s", a.config.SelfUpdateImage, shortHash(running), shortHash(digest))
+	if a.config.OpsAlertChannel == "" {
+		return running
+	}
+	text := a.messages.text("self_update.available", map[string]interface{}{
+		"Image": a.config.SelfUpdateImage, "Running": shortHash(running), "Digest": shortHash(digest), "DrainTimeout": a.config.DrainTimeout,
+	})
+	if err := a.postThreadMessage(ctx, a.config.OpsAlertChannel, "", text); err != nil {
+		logError("Error announcing update to %s: %v", shortHash(digest), err)
+	}
+	return running
+}
+
+// drainForRestart waits for any instance restarting before this one to be replaced, then stops taking reaction
+// events; those already buffered are still processed. Command output and the other listeners keep running
+// until the buffer is empty, so deployments in flight keep reporting.
+func (a *App) drainForRestart(ctx context.Context, pubsub *redis.PubSub) {
+	host, _ := os.Hostname()
+	deadline := time.Now().Add(a.config.DrainTimeout)
+	for {
+		claimed, err := a.redisClient.SetNX(ctx, restartLockKey, host, a.config.DrainTimeout).Result()
+		if err != nil {
+			logError("Error taking the restart lock: %v", err)
+			break
+		}
+		if claimed {
+			break
+		}
+		if time.Now().After(deadline) {
+			logWarn("Another instance is still restarting after %s, draining anyway", a.config.DrainTimeout)
+			break
+		}
+		logDebug("Waiting for the instance restarting before this one to be replaced")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(restartPollInterval):
+		}
+	}
+
+	if peers, err := a.redisClient.PubSubNumSub(ctx, a.config.RedisPubSub).Result(); err == nil && peers[a.config.RedisPubSub] <= 1 {
+		logWarn("No other instance is subscribed to %s; reactions until this one is replaced are lost", a.config.RedisPubSub)
+	}
+	logInfo("Draining: no longer taking reaction events")
+	if err := pubsub.Close(); err != nil {
+		logError("Error unsubscribing from %s: %v", a.config.RedisPubSub, err)
+	}
+	a.instance.markDraining()
+	a.heartbeat(ctx)
+}
+
+// takeOver releases the restart lock once this instance is subscribed to the reaction events, letting the next
+// instance of a rolling restart drain
+func (a *App) takeOver(ctx context.Context) {
+	previous, err := a.redisClient.GetDel(ctx, restartLockKey).Result()
+	if err != nil {
+		return
+	}
+	logInfo("Took over reaction events from restarting instance %s", previous)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/slack-go/slack"
+)
+
+// DeployShortcutCallbackID is the callback ID of the "Deploy this PR" message shortcut in the Slack app's settings
+const DeployShortcutCallbackID = "deploy_pr"
+
+// deployModalCallbackID identifies the submissions of the modal the shortcut opens
+const deployModalCallbackID = "vibedeploy_deploy"
+
+// Block and action IDs of the deploy modal's inputs
+const (
+	deployModalEnvironment = "environment"
+	deployModalOptions     = "options"
+	deployModalCleanBuild  = "clean_build"
+)
+
+// deployModalMetadata is the modal's private metadata: the PR message the shortcut was used on
+type deployModalMetadata struct {
+	Channel string `json:"channel"`
+	Ts      string `json:"ts"`
+}
+
+func (a *App) listenForInteractions(ctx context.Context) {
+	pubsub := a.redisClient.Subscribe(ctx, a.config.RedisInteractions)
+	defer pubsub.Close()
+
+	logInfo("Subscribed to Redis channel: %s", a.config.RedisInteractions)
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			logInfo("Interaction listener context cancelled, exiting")
+			return
+		case msg := <-ch:
+			if msg == nil {
+				continue
+			}
+			logDebug("Received interaction from channel: %s", a.config.RedisInteractions)
+			a.capture.consumed(ctx, a.cipher, CaptureInteraction, msg.Channel, []byte(msg.Payload))
+			a.processInteraction(ctx, msg.Payload)
+		}
+	}
+}
+
+// processInteraction handles a relayed Slack interactivity payload: the "Deploy this PR" shortcut, and the
+// submission of the modal it opens
+func (a *App) processInteraction(ctx context.Context, payload string) {
+	plaintext, err := a.cipher.open([]byte(payload))
+	if err != nil {
+		logError("Error decrypting interaction: %v", err)
+		return
+	}
+
+	var interaction slack.InteractionCallback
+	if err := json.Unmarshal(plaintext, &interaction); err != nil {
+		logError("Error parsing interaction: %v", err)
+		return
+	}
+
+	switch {
+	case interaction.Type == slack.InteractionTypeMessageAction && interaction.CallbackID == DeployShortcutCallbackID:
+		a.openDeployModal(ctx, interaction)
+	case interaction.Type == slack.InteractionTypeViewSubmission && interaction.View.CallbackID == deployModalCallbackID:
+		a.submitDeployModal(ctx, interaction)
+	default:
+		logDebug("Ignoring %s interaction %q", interaction.Type, interaction.CallbackID)
+	}
+}
+
+// shortcutTarget reads the PR a shortcut or modal is about, telling the user privately if it can't be deployed
+func (a *App) shortcutTarget(ctx context.Context, channel, ts, user string) *PRMetadata {
+	metadata, err := a.messageMetadata(ctx, channel, ts)
+	if err != nil {
+		logError("Error getting message metadata: %v", err)
+		a.postEphemeral(ctx, channel, user, ":warning: Could not read the message, please try again.")
+		return nil
+	}
+	metadata, refusal := a.messageTarget(ctx, metadata, user)
+	if metadata == nil {
+		a.postEphemeral(ctx, channel, user, refusal)
+	}
+	return metadata
+}
+
+// openDeployModal opens the deploy parameters for the PR message the shortcut was used on
+func (a *App) openDeployModal(ctx context.Context, interaction slack.InteractionCallback) {
+	channel, ts, user := interaction.Channel.ID, interaction.Message.Timestamp, interaction.User.ID
+	if ts == "" {
+		ts = interaction.MessageTs
+	}
+	logInfo("Processing %s shortcut from user %s on message %s in channel %s", DeployShortcutCallbackID, user, ts, channel)
+	metadata := a.shortcutTarget(ctx, channel, ts, user)
+	if metadata == nil {
+		return
+	}
+	private, err := json.Marshal(deployModalMetadata{Channel: channel, Ts: ts})
+	if err != nil {
+		logError("Error marshalling deploy modal metadata: %v", err)
+		return
+	}
+
+	view := deployModal(metadata, a.repoConfig(metadata.Repository))
+	view.PrivateMetadata = string(private)
+	if _, err := a.slackClient.OpenViewContext(ctx, interaction.TriggerID, view); err != nil {
+		logError("Error opening deploy modal for user %s: %v", user, err)
+	}
+}
+
+// deployModal is the form of a deployment's parameters: the environment, for repositories with a promotion
+// chain, and the options the modifier reactions set
+func deployModal(metadata *PRMetadata, repoConfig RepoConfig) slack.ModalViewRequest {
+	plain := func(text string) *slack.TextBlockObject {
+		return slack.NewTextBlockObject(slack.PlainTextType, text, false, false)
+	}
+
+	target := fmt.Sprintf("*%s* `%s`", metadata.Repository, metadata.Branch)
+	if metadata.PRNumber > 0 {
+		target = fmt.Sprintf("*%s* #%d `%s`", metadata.Repository, metadata.PRNumber, metadata.Branch)
+	}
+	blocks := []slack.Block{slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, target, false, false), nil, nil)}
+
+	if len(repoConfig.Environments) > 1 {
+		options := make([]*slack.OptionBlockObject, 0, len(repoConfig.Environments))
+		for _, environment := range repoConfig.Environments {
+			options = append(options, slack.NewOptionBlockObject(environment.Name, plain(environment.Name), nil))
+		}
+		selector := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, plain("Environment"), deployModalEnvironment, options...)
+		selector.InitialOption = options[0]
+		blocks = append(blocks, slack.NewInputBlock(deployModalEnvironment, plain("Environment"), nil, selector))
+	}
+
+	cleanBuild := slack.NewOptionBlockObject(deployModalCleanBuild, plain("Clean build"), plain("Build without cache and re-pull base images"))
+	options := slack.NewInputBlock(deployModalOptions, plain("Options"), nil, slack.NewCheckboxGroupsBlockElement(deployModalOptions, cleanBuild))
+	options.Optional = true
+	blocks = append(blocks, options)
+
+	return slack.ModalViewRequest{
+		Type:       slack.VTModal,
+		CallbackID: deployModalCallbackID,
+		Title:      plain("Deploy this PR"),
+		Submit:     plain("Deploy"),
+		Close:      plain("Cancel"),
+		Blocks:     slack.Blocks{BlockSet: blocks},
+	}
+}
+
+// submitDeployModal deploys the PR message of a submitted deploy modal, as a :rocket: with the chosen parameters would
+func (a *App) submitDeployModal(ctx context.Context, interaction slack.InteractionCallback) {
+	var private deployModalMetadata
+	if err := json.Unmarshal([]byte(interaction.View.PrivateMetadata), &private); err != nil || private.Channel == "" {
+		logError("Error reading deploy modal metadata: %v", err)
+		return
+	}
+	user := interaction.User.ID
+	metadata := a.shortcutTarget(ctx, private.Channel, private.Ts, user)
+	if metadata == nil {
+		return
+	}
+	repoConfig := a.repoConfig(metadata.Repository)
+
+	var options DeployOptions
+	if interaction.View.State != nil {
+		values := interaction.View.State.Values
+		if selected := values[deployModalEnvironment][deployModalEnvironment].SelectedOption.Value; selected != "" && selected != repoConfig.defaultEnvironment() {
+			options.Environment = selected
+		}
+		for _, option := range values[deployModalOptions][deployModalOptions].SelectedOptions {
+			if option.Value == deployModalCleanBuild {
+				options.CleanBuild = true
+			}
+		}
+	}
+
+	// Later environments need what promoting to them needs
+	if i := repoConfig.environmentIndex(options.Environment); i > 0 {
+		if action := promotionAction(&repoConfig.Environments[i]); !a.authorizeGate(ctx, a.slackIdentities(ctx, user), action, metadata.Repository, options.Environment) {
+			a.postEphemeral(ctx, private.Channel, user, fmt.Sprintf(":lock: Deploying to *%s* needs the %s permission.", options.Environment, action))
+			return
+		}
+	}
+	// A vote can't be cast from a form; the message still needs its rockets
+	environment := options.Environment
+	if environment == "" {
+		environment = repoConfig.defaultEnvironment()
+	}
+	if required := repoConfig.requiredVotes(environment); required > 1 {
+		a.postEphemeral(ctx, private.Channel, user, fmt.Sprintf(":ballot_box_with_check: Deploying *%s* takes %d votes; react to the message with :%s: instead.", metadata.Repository, required, RocketReaction))
+		return
+	}
+
+	logInfo("Deploy shortcut for %s branch %s by %s", metadata.Repository, metadata.Branch, user)
+	if d := a.deployFromReaction(ctx, metadata, options, private.Channel, private.Ts, user); d == nil {
+		a.postEphemeral(ctx, private.Channel, user, fmt.Sprintf(":warning: *%s* `%s` did not start deploying; see the message's thread.", metadata.Repository, metadata.Branch))
+	}
+}
+
+// deployCommand deploys the PR message a permalink points at, as a :rocket: on it would, for messages too far
+// up the channel to react to
+func (a *App) deployCommand(ctx context.Context, command slack.SlashCommand, args []string) *slack.WebhookMessage {
+	if len(args) != 1 || !isMessageLink(args[0]) {
+		return ephemeralReply("Usage: `deploy <message link>`, with *Copy link* on the PR message")
+	}
+	user := command.UserID
+	channel, ts, metadata, err := a.resolveMessageLink(ctx, args[0])
+	if err != nil {
+		logError("Error resolving %s: %v", args[0], err)
+		return ephemeralReply(":warning: Could not read that message; check the link, and that VibeDeploy is in its channel.")
+	}
+	metadata, refusal := a.messageTarget(ctx, metadata, user)
+	if metadata == nil {
+		return ephemeralReply(refusal)
+	}
+	repoConfig := a.repoConfig(metadata.Repository)
+	if required := repoConfig.requiredVotes(repoConfig.defaultEnvironment()); required > 1 {
+		return ephemeralReply(fmt.Sprintf(":ballot_box_with_check: Deploying *%s* takes %d votes; react to the message with :%s: instead.", metadata.Repository, required, RocketReaction))
+	}
+
+	logInfo("Deploy command for %s branch %s by %s", metadata.Repository, metadata.Branch, user)
+	if d := a.deployFromReaction(ctx, metadata, DeployOptions{}, channel, ts, user); d == nil {
+		return ephemeralReply(fmt.Sprintf(":warning: *%s* `%s` did not start deploying; see the message's thread.", metadata.Repository, metadata.Branch))
+	}
+	return ephemeralReply(fmt.Sprintf(":gear: Deploying *%s* `%s`; follow along in the message's thread.", metadata.Repository, metadata.Branch))
+}
+
+// postEphemeral posts a message in a channel that only the user sees
+func (a *App) postEphemeral(ctx context.Context, channel, user, text string) {
+	if _, err := a.slackClient.PostEphemeralContext(ctx, channel, user, slack.MsgOptionText(text, false)); err != nil {
+		logError("Error posting ephemeral message to %s: %v", user, err)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// WorkflowMetadataType is the Slack message metadata event type of deployments started from Workflow Builder
+const WorkflowMetadataType = "vibedeploy_workflow"
+
+// WorkflowTriggeredBy is recorded as who triggered a Workflow Builder deployment that doesn't say who ran the workflow
+const WorkflowTriggeredBy = "workflow"
+
+// slackReferencePattern matches the user and channel references Workflow Builder substitutes for variables, e.g. <@U012AB3CD>
+var slackReferencePattern = regexp.MustCompile(`^<[@#]([A-Z0-9]+)(\|[^>]*)?>$`)
+
+// WorkflowTriggerRequest is the body of a Workflow Builder "Send a web request" step. Workflow variables are
+// all strings; repo and env are accepted as short names for repository and environment.
+type WorkflowTriggerRequest struct {
+	Repository  string `json:"repository"`
+	Repo        string `json:"repo"`
+	Branch      string `json:"branch"`
+	Environment string `json:"environment"`
+	Env         string `json:"env"`
+	// User is the person who ran the workflow, and Channel where the deployment should report
+	User    string `json:"user"`
+	Channel string `json:"channel"`
+}
+
+// slackReference strips the markup around a user or channel reference, leaving the ID
+func slackReference(value string) string {
+	value = strings.TrimSpace(value)
+	if match := slackReferencePattern.FindStringSubmatch(value); match != nil {
+		return match[1]
+	}
+	return value
+}
+
+// handleWorkflowTrigger starts a deployment from a Slack Workflow Builder step, so a guided form can deploy
+// without anyone knowing the emoji conventions
+func (a *App) handleWorkflowTrigger(w http.ResponseWriter, r *http.Request) {
+	var req WorkflowTriggerRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCallbackBodySize)).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	repo := strings.TrimSpace(req.Repository)
+	if repo == "" {
+		repo = strings.TrimSpace(req.Repo)
+	}
+	repo = a.canonicalRepo(repo)
+	environment := strings.TrimSpace(req.Environment)
+	if environment == "" {
+		environment = strings.TrimSpace(req.Env)
+	}
+	branch, user, channel := strings.TrimSpace(req.Branch), slackReference(req.User), slackReference(req.Channel)
+	if repo == "" || branch == "" {
+		http.Error(w, "repository and branch are required", http.StatusBadRequest)
+		return
+	}
+	if !isRepoAllowed(repo, a.allowedRepos) {
+		http.Error(w, "repository "+repo+" is not in the allowed list", http.StatusForbidden)
+		return
+	}
+	repoConfig := a.repoConfig(repo)
+	if environment != "" && repoConfig.environmentIndex(environment) < 0 {
+		http.Error(w, fmt.Sprintf("%s has no environment %q", repo, environment), http.StatusBadRequest)
+		return
+	}
+	if !a.authorizeRequest(w, r, ActionDeploy, repo) {
+		return
+	}
+
+	// The API key belongs to the workflow, so whoever ran it needs permission of their own. Without a user
+	// there is nobody to check, so neither RBAC nor an approval gate can be satisfied.
+	action := ActionDeploy
+	if i := repoConfig.environmentIndex(environment); i >= 0 {
+		action = promotionAction(&repoConfig.Environments[i])
+	}
+	rbac := a.reposConfig != nil && a.reposConfig.RBAC != nil
+	if user == "" && (rbac || action == ActionApprove) {
+		logWarn("Refused workflow deployment of %s without a user", repo)
+		http.Error(w, fmt.Sprintf("user is required to %s %s", action, repo), http.StatusForbidden)
+		return
+	}
+	by := WorkflowTriggeredBy
+	if user != "" {
+		if !a.authorizeGate(r.Context(), a.slackIdentities(r.Context(), user), action, repo, environment) {
+			logWarn("Denied workflow deployment of %s to %s", repo, user)
+			http.Error(w, fmt.Sprintf("%s may not %s %s", user, action, repo), http.StatusForbidden)
+			return
+		}
+		by = user
+	}
+
+	// Reporting under a message of its own gives the deployment a thread, and reactions on it work as on a PR message
+	var ts string
+	if channel != "" {
+		text := a.messages.text("workflow.started", map[string]interface{}{"User": user, "Repository": repo, "Branch": branch, "Environment": environment})
+		var err error
+		if ts, err = a.postDeploymentMessage(r.Context(), channel, text, WorkflowMetadataType, repo, branch); err != nil {
+			logError("Error posting workflow deployment message in %s: %v", channel, err)
+			channel = ""
+		}
+	}
+
+	metadata := &PRMetadata{Repository: repo, Branch: branch}
+	logInfo("Workflow Builder trigger for %s branch %s by %q", repo, branch, by)
+	deployment, err := a.startDeployment(r.Context(), metadata, DeployOptions{Environment: environment}, channel, ts, by)
+	if errors.Is(err, ErrDeploymentDeclined) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		logError("Error starting workflow deployment for %s: %v", repo, err)
+		http.Error(w, "failed to start deployment", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, deployment)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// slashCommandUsage lists the subcommands of the VibeDeploy slash command
+const slashCommandUsage = "Usage: `incident start <id> [#channel]`, `incident end`, `incident`, `halt [purge]`, `halt status`, `resume`, `hosts [name]`, `migrate <owner/repo> <host> [environment]` `digest [daily|weekly|off] [owner/repo ...]`, `delegate @user [start] <end> [owner/repo ...]`, `status`, `config <owner/repo|message link>`, `deploy <message link>` or `why <message link>`"
+
+func (a *App) listenForSlashCommands(ctx context.Context) {
+	pubsub := a.redisClient.Subscribe(ctx, a.config.RedisSlashCommands)
+	defer pubsub.Close()
+
+	logInfo("Subscribed to Redis channel: %s", a.config.RedisSlashCommands)
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			logInfo("Slash command listener context cancelled, exiting")
+			return
+		case msg := <-ch:
+			if msg == nil {
+				continue
+			}
+			logDebug("Received slash command from channel: %s", a.config.RedisSlashCommands)
+			a.capture.consumed(ctx, a.cipher, CaptureSlashCommand, msg.Channel, []byte(msg.Payload))
+			a.processSlashCommand(ctx, msg.Payload)
+		}
+	}
+}
+
+// processSlashCommand runs a relayed slash command and answers through its response URL
+func (a *App) processSlashCommand(ctx context.Context, payload string) {
+	plaintext, err := a.cipher.open([]byte(payload))
+	if err != nil {
+		logError("Error decrypting slash command: %v", err)
+		return
+	}
+
+	var command slack.SlashCommand
+	if err := json.Unmarshal(plaintext, &command); err != nil {
+		logError("Error parsing slash command: %v", err)
+		return
+	}
+	logInfo("Processing %s %q from user %s in channel %s", command.Command, command.Text, command.UserID, command.ChannelID)
+
+	args := strings.Fields(command.Text)
+	var reply *slack.WebhookMessage
+	switch {
+	case len(args) > 0 && args[0] == "incident":
+		reply = a.incidentCommand(ctx, command, args[1:])
+	case len(args) > 0 && args[0] == "halt":
+		reply = a.haltCommand(ctx, command, args[1:])
+	case len(args) == 1 && args[0] == "resume":
+		reply = a.resumeCommand(ctx, command)
+	case len(args) > 0 && args[0] == "hosts":
+		reply = a.hostsCommand(ctx, command, args[1:])
+	case len(args) > 0 && args[0] == "migrate":
+		reply = a.migrateCommand(ctx, command, args[1:])
+	case len(args) > 0 && args[0] == "digest":
+		reply = a.digestCommand(ctx, command, args[1:])
+	case len(args) > 0 && args[0] == "delegate":
+		reply = a.delegateCommand(ctx, command, args[1:])
+	case len(args) == 1 && args[0] == "status":
+		reply = a.statusCommand(ctx)
+	case len(args) > 0 && args[0] == "config":
+		reply = a.configCommand(ctx, command, args[1:])
+	case len(args) > 0 && args[0] == "deploy":
+		reply = a.deployCommand(ctx, command, args[1:])
+	case len(args) > 0 && args[0] == "why":
+		reply = a.whyCommand(ctx, command, args[1:])
+	default:
+		reply = ephemeralReply(slashCommandUsage)
+	}
+
+	if command.ResponseURL == "" {
+		return
+	}
+	if err := slack.PostWebhookContext(ctx, command.ResponseURL, reply); err != nil {
+		logError("Error replying to %s from user %s: %v", command.Command, command.UserID, err)
+	}
+}
+
+// ephemeralReply is a slash command reply only the invoking user sees
+func ephemeralReply(text string) *slack.WebhookMessage {
+	return &slack.WebhookMessage{ResponseType: slack.ResponseTypeEphemeral, Text: text}
+}
+
+// channelReply is a slash command reply posted for everyone in the channel
+func channelReply(text string) *slack.WebhookMessage {
+	return &slack.WebhookMessage{ResponseType: slack.ResponseTypeInChannel, Text: text}
+}
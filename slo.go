@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// The latency objectives: from the reaction being added in Slack to the gear reaction, and to the deployment
+// being queued with the executor
+const (
+	SLOGearReaction = "gear_reaction"
+	SLOQueued       = "queued"
+)
+
+// sloKeyPrefix starts the per-minute Redis hashes of each objective's total and slow event counts
+const sloKeyPrefix = "vibedeploy:slo:"
+
+// sloAlertedKeyPrefix keeps an objective to one burn alert per long window, across instances
+const sloAlertedKeyPrefix = "vibedeploy:slo:alerted:"
+
+// Burn rates are checked over a long window, and a short one so an alert doesn't fire after the burning has stopped
+const (
+	sloLongWindow  = time.Hour
+	sloShortWindow = 5 * time.Minute
+	// sloMinEvents keeps a couple of slow reactions on a quiet hour from paging anyone
+	sloMinEvents = 10
+)
+
+// sloBuckets are the upper bounds, in seconds, of the latency histograms served on /metrics
+var sloBuckets = []float64{0.25, 0.5, 1, 2, 3, 5, 10, 30}
+
+// latencyHistogram is a cumulative histogram of one objective's latencies on this instance
+type latencyHistogram struct {
+	counts []int64
+	sum    float64
+	total  int64
+}
+
+// latencyHistograms holds this instance's histograms, which /metrics serves
+type latencyHistograms struct {
+	mu         sync.Mutex
+	histograms map[string]*latencyHistogram
+}
+
+var sloLatencies = &latencyHistograms{histograms: make(map[string]*latencyHistogram)}
+
+func (h *latencyHistograms) observe(objective string, latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	histogram, ok := h.histograms[objective]
+	if !ok {
+		histogram = &latencyHistogram{counts: make([]int64, len(sloBuckets))}
+		h.histograms[objective] = histogram
+	}
+	seconds := latency.Seconds()
+	for i, bound := range sloBuckets {
+		if seconds <= bound {
+			histogram.counts[i]++
+		}
+	}
+	histogram.sum += seconds
+	histogram.total++
+}
+
+// sloThreshold returns the latency an objective's events must stay under
+func (a *App) sloThreshold(objective string) time.Duration {
+	if objective == SLOGearReaction {
+		return a.config.SLOGearLatency
+	}
+	return a.config.SLOQueuedLatency
+}
+
+// parseSlackTs converts a Slack event timestamp ("1712345678.123456") to a time
+func parseSlackTs(ts string) time.Time {
+	seconds, err := strconv.ParseFloat(ts, 64)
+	if err != nil || seconds <= 0 {
+		return time.Time{}
+	}
+	whole, fraction := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(fraction*1e9))
+}
+
+// reactedAt is when the reaction of an event was added, by Slack's clock
+func (e *ReactionEvent) reactedAt() time.Time {
+	if t := parseSlackTs(e.Event.EventTs); !t.IsZero() {
+		return t
+	}
+	if e.EventTime > 0 {
+		return time.Unix(e.EventTime, 0)
+	}
+	return time.Time{}
+}
+
+// observeLatency records how long an objective took for a reaction. Events are counted per minute in Redis,
+// so the burn rate covers every instance.
+func (a *App) observeLatency(ctx context.Context, objective string, reactedAt time.Time) {
+	if reactedAt.IsZero() {
+		return
+	}
+	// Slack's clock and ours can disagree by a little
+	latency := time.Since(reactedAt)
+	if latency < 0 {
+		latency = 0
+	}
+	sloLatencies.observe(objective, latency)
+
+	key := sloKeyPrefix + objective + ":" + strconv.FormatInt(time.Now().Unix()/60, 10)
+	pipe := a.redisClient.Pipeline()
+	pipe.HIncrBy(ctx, key, "total", 1)
+	if latency > a.sloThreshold(objective) {
+		pipe.HIncrBy(ctx, key, "slow", 1)
+		logDebug("%s took %s after the reaction, over the %s objective", objective, latency.Round(time.Millisecond), a.sloThreshold(objective))
+	}
+	pipe.Expire(ctx, key, sloLongWindow+2*time.Minute)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logError("Error recording %s latency: %v", objective, err)
+	}
+}
+
+// sloCounts returns an objective's total and slow events over the window
+func (a *App) sloCounts(ctx context.Context, objective string, window time.Duration) (total, slow int64, err error) {
+	now := time.Now().Unix() / 60
+	minutes := int64(window / time.Minute)
+	pipe := a.redisClient.Pipeline()
+	results := make([]*redis.MapStringStringCmd, 0, minutes)
+	for minute := now - minutes + 1; minute <= now; minute++ {
+		results = append(results, pipe.HGetAll(ctx, sloKeyPrefix+objective+":"+strconv.FormatInt(minute, 10)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, 0, fmt.Errorf("failed to read %s latency counts: %w", objective, err)
+	}
+	for _, result := range results {
+		counts := result.Val()
+		t, _ := strconv.ParseInt(counts["total"], 10, 64)
+		s, _ := strconv.ParseInt(counts["slow"], 10, 64)
+		total += t
+		slow += s
+	}
+	return total, slow, nil
+}
+
+// burnRate is how many times faster than the objective allows the error budget is being spent
+func (a *App) burnRate(total, slow int64) float64 {
+	budget := 1 - a.config.SLOTarget
+	if total == 0 || budget <= 0 {
+		return 0
+	}
+	return float64(slow) / float64(total) / budget
+}
+
+// runSLOChecks periodically alerts the ops channel about objectives burning their error budget fast
+func (a *App) runSLOChecks(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logInfo("SLO check context cancelled, exiting")
+			return
+		case <-ticker.C:
+			for _, objective := range []string{SLOGearReaction, SLOQueued} {
+				a.checkBurnRate(ctx, objective)
+			}
+		}
+	}
+}
+
+// checkBurnRate alerts when both the long and the short window burn faster than SLO_BURN_RATE
+func (a *App) checkBurnRate(ctx context.Context, objective string) {
+	total, slow, err := a.sloCounts(ctx, objective, sloLongWindow)
+	if err != nil {
+		logError("Error checking %s objective: %v", objective, err)
+		return
+	}
+	longBurn := a.burnRate(total, slow)
+	if total < sloMinEvents || longBurn < a.config.SLOBurnRate {
+		return
+	}
+	shortTotal, shortSlow, err := a.sloCounts(ctx, objective, sloShortWindow)
+	if err != nil {
+		logError("Error checking %s objective: %v", objective, err)
+		return
+	}
+	shortBurn := a.burnRate(shortTotal, shortSlow)
+	if shortBurn < a.config.SLOBurnRate {
+		return
+	}
+
+	// Every instance checks; the first to claim the alert posts it
+	claimed, err := a.redisClient.SetNX(ctx, sloAlertedKeyPrefix+objective, 1, sloLongWindow).Result()
+	if err != nil || !claimed {
+		return
+	}
+	logWarn("%s objective burning its error budget %.1fx too fast (%d of %d slow in the last hour)", objective, longBurn, slow, total)
+	if a.config.OpsAlertChannel == "" {
+		return
+	}
+	text := a.messages.text("slo.burn", map[string]interface{}{
+		"Objective": strings.ReplaceAll(objective, "_", " "),
+		"Threshold": a.sloThreshold(objective),
+		"Target":    strconv.FormatFloat(a.config.SLOTarget*100, 'f', -1, 64),
+		"Slow":      slow,
+		"Total":     total,
+		"BurnRate":  strconv.FormatFloat(longBurn, 'f', 1, 64),
+	})
+	if err := a.postThreadMessage(ctx, a.config.OpsAlertChannel, "", text); err != nil {
+		logError("Error posting SLO burn alert: %v", err)
+	}
+}
+
+// handleMetrics serves the latency histograms of this instance and the burn rates of all instances in
+// the Prometheus text format
+func (a *App) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	b.WriteString("# HELP vibedeploy_reaction_latency_seconds Time from a Slack reaction to each objective's milestone.\n")
+	b.WriteString("# TYPE vibedeploy_reaction_latency_seconds histogram\n")
+	sloLatencies.mu.Lock()
+	objectives := make([]string, 0, len(sloLatencies.histograms))
+	for objective := range sloLatencies.histograms {
+		objectives = append(objectives, objective)
+	}
+	sort.Strings(objectives)
+	for _, objective := range objectives {
+		histogram := sloLatencies.histograms[objective]
+		for i, bound := range sloBuckets {
+			fmt.Fprintf(&b, "vibedeploy_reaction_latency_seconds_bucket{objective=%q,le=%q} %d\n", objective, strconv.FormatFloat(bound, 'f', -1, 64), histogram.counts[i])
+		}
+		fmt.Fprintf(&b, "vibedeploy_reaction_latency_seconds_bucket{objective=%q,le=\"+Inf\"} %d\n", objective, histogram.total)
+		fmt.Fprintf(&b, "vibedeploy_reaction_latency_seconds_sum{objective=%q} %g\n", objective, histogram.sum)
+		fmt.Fprintf(&b, "vibedeploy_reaction_latency_seconds_count{objective=%q} %d\n", objective, histogram.total)
+	}
+	sloLatencies.mu.Unlock()
+
+	b.WriteString("# HELP vibedeploy_slo_burn_rate How fast each objective is spending its error budget; 1 spends it exactly.\n")
+	b.WriteString("# TYPE vibedeploy_slo_burn_rate gauge\n")
+	windows := map[string]time.Duration{"5m": sloShortWindow, "1h": sloLongWindow}
+	for _, objective := range []string{SLOGearReaction, SLOQueued} {
+		for _, name := range []string{"5m", "1h"} {
+			total, slow, err := a.sloCounts(r.Context(), objective, windows[name])
+			if err != nil {
+				logError("Error serving %s burn rate: %v", objective, err)
+				continue
+			}
+			fmt.Fprintf(&b, "vibedeploy_slo_burn_rate{objective=%q,window=%q} %g\n", objective, name, a.burnRate(total, slow))
+		}
+	}
+	writeFailureMetrics(&b)
+	a.writeInstanceMetrics(r.Context(), &b)
+	a.writeKeyspaceMetrics(r.Context(), &b)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(b.String()))
+}
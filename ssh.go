@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const SSHExecutorName = "ssh"
+
+// sshDialTimeout bounds how long connecting to a host may take
+const sshDialTimeout = 15 * time.Second
+
+// SSHTargetConfig is how VibeDeploy reaches a host that has no Poppit worker of its own
+type SSHTargetConfig struct {
+	// Address is host:port (port 22 if omitted)
+	Address string `yaml:"address"`
+	User    string `yaml:"user"`
+	// KeySecret names the private key in the secrets provider
+	KeySecret string `yaml:"key_secret"`
+	// HostKey is the host's public key in authorized_keys format, e.g. "ssh-ed25519 AAAA..."
+	HostKey string `yaml:"host_key"`
+}
+
+func (c *SSHTargetConfig) validate() error {
+	if c.Address == "" || c.User == "" || c.KeySecret == "" {
+		return errors.New("ssh needs address, user and key_secret")
+	}
+	if c.HostKey == "" {
+		return errors.New("ssh needs the host_key to verify the host against")
+	}
+	if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(c.HostKey)); err != nil {
+		return fmt.Errorf("invalid ssh host_key: %w", err)
+	}
+	return nil
+}
+
+// SSHExecutor runs a command's pipeline on a host over SSH, one step at a time, like a Poppit worker would.
+// Each step's output is handed to report; a failing step stops the pipeline and is handed to fail instead.
+type SSHExecutor struct {
+	host    string
+	config  SSHTargetConfig
+	secrets SecretsProvider
+	report  func(ctx context.Context, output CommandOutput)
+	fail    func(ctx context.Context, output CommandOutput, reason string)
+	// mu serialises pipelines on the host, as a single worker does
+	mu      sync.Mutex
+	running sync.WaitGroup
+}
+
+func (e *SSHExecutor) Name() string {
+	return SSHExecutorName
+}
+
+// Execute starts the pipeline in the background and returns once the host is known to be reachable
+func (e *SSHExecutor) Execute(ctx context.Context, cmd PoppitCommand) error {
+	client, err := e.dial(ctx)
+	if err != nil {
+		return err
+	}
+	// The pipeline outlives the request or event that dispatched it
+	e.running.Add(1)
+	go func() {
+		defer e.running.Done()
+		e.run(context.WithoutCancel(ctx), client, cmd)
+	}()
+	return nil
+}
+
+// wait blocks until the pipelines this process started have finished
+func (e *SSHExecutor) wait() {
+	e.running.Wait()
+}
+
+func (e *SSHExecutor) dial(ctx context.Context) (*ssh.Client, error) {
+	key, err := e.secrets.Secret(ctx, e.config.KeySecret)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve the ssh key for %s: %w", e.host, err)
+	}
+	signer, err := ssh.ParsePrivateKey([]byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssh key for %s: %w", e.host, err)
+	}
+	hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(e.config.HostKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssh host_key for %s: %w", e.host, err)
+	}
+
+	address := e.config.Address
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "22")
+	}
+	client, err := ssh.Dial("tcp", address, &ssh.ClientConfig{
+		User:            e.config.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+		Timeout:         sshDialTimeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s at %s: %w", e.host, address, err)
+	}
+	return client, nil
+}
+
+func (e *SSHExecutor) run(ctx context.Context, client *ssh.Client, cmd PoppitCommand) {
+	defer client.Close()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	logDebug("Running %d commands for %s on %s", len(cmd.Commands), cmd.Repo, e.host)
+	for _, command := range cmd.Commands {
+		output := CommandOutput{Metadata: cmd.Metadata, Type: cmd.Type, Command: command}
+		var err error
+		output.Output, err = e.runStep(client, cmd, command)
+		if err != nil {
+			var exitErr *ssh.ExitError
+			if errors.As(err, &exitErr) {
+				output.ExitCode = exitErr.ExitStatus()
+			}
+			e.fail(ctx, output, fmt.Sprintf("`%s` failed on %s: %v", command, e.host, err))
+			return
+		}
+		e.report(ctx, output)
+	}
+}
+
+// runStep runs one command in the pipeline's directory. The script, including the env, goes over stdin
+// so values such as secrets never show up in the host's process list.
+func (e *SSHExecutor) runStep(client *ssh.Client, cmd PoppitCommand, command string) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to open ssh session: %w", err)
+	}
+	defer session.Close()
+
+	if seconds := cmd.Timeouts[command]; seconds > 0 {
+		timer := time.AfterFunc(time.Duration(seconds)*time.Second, func() { session.Close() })
+		defer timer.Stop()
+	}
+	session.Stdin = strings.NewReader(sshScript(cmd, command))
+	output, err := session.CombinedOutput("sh -s")
+	return string(output), err
+}
+
+// sshScript exports the command's env, then runs one step from its directory
+func sshScript(cmd PoppitCommand, command string) string {
+	names := make([]string, 0, len(cmd.Env))
+	for name := range cmd.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "export %s=%s\n", name, shellQuote(cmd.Env[name]))
+	}
+	if cmd.Dir != "" {
+		fmt.Fprintf(&b, "cd %s || exit 1\n", shellQuote(cmd.Dir))
+	}
+	b.WriteString(command + "\n")
+	return b.String()
+}
+
+// shellQuote single-quotes a value for sh
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Status page providers
+const (
+	StatuspageProviderName = "statuspage"
+	InstatusProviderName   = "instatus"
+)
+
+// Component statuses, in Statuspage's naming; Instatus uses the same names upper-cased without underscores
+const (
+	ComponentOperational      = "operational"
+	ComponentUnderMaintenance = "under_maintenance"
+)
+
+const (
+	statuspageAPIURL = "https://api.statuspage.io/v1"
+	instatusAPIURL   = "https://api.instatus.com/v1"
+)
+
+var statusPageHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// StatusPageConfig is the status_page section of a repository's settings
+type StatusPageConfig struct {
+	// Provider is statuspage (default) or instatus
+	Provider    string `yaml:"provider"`
+	PageID      string `yaml:"page_id"`
+	ComponentID string `yaml:"component_id"`
+	// APIKeySecret names the API key in the secrets provider
+	APIKeySecret string `yaml:"api_key_secret"`
+
+	// DeployingStatus is set while the pipeline runs (default: under_maintenance)
+	DeployingStatus string `yaml:"deploying_status"`
+	// FailedStatus is set when a deployment fails; empty leaves the deploying status for someone to review
+	FailedStatus string `yaml:"failed_status"`
+}
+
+// validate checks the component is identified and the provider known
+func (c *StatusPageConfig) validate() error {
+	if c.PageID == "" || c.ComponentID == "" || c.APIKeySecret == "" {
+		return fmt.Errorf("status_page needs page_id, component_id and api_key_secret")
+	}
+	switch c.Provider {
+	case "", StatuspageProviderName, InstatusProviderName:
+		return nil
+	default:
+		return fmt.Errorf("unknown status_page provider %q (expected %s or %s)", c.Provider, StatuspageProviderName, InstatusProviderName)
+	}
+}
+
+// setComponentStatus updates the component through the provider's API
+func (c *StatusPageConfig) setComponentStatus(ctx context.Context, apiKey, status string) error {
+	var method, url, authorization string
+	var body interface{}
+	switch c.Provider {
+	case InstatusProviderName:
+		method = http.MethodPut
+		url = fmt.Sprintf("%s/%s/components/%s", instatusAPIURL, c.PageID, c.ComponentID)
+		authorization = "Bearer " + apiKey
+		body = map[string]string{"status": strings.ToUpper(strings.ReplaceAll(status, "_", ""))}
+	default:
+		method = http.MethodPatch
+		url = fmt.Sprintf("%s/pages/%s/components/%s", statuspageAPIURL, c.PageID, c.ComponentID)
+		authorization = "OAuth " + apiKey
+		body = map[string]map[string]string{"component": {"status": status}}
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal component update: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to build component update: %w", err)
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := statusPageHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call the status page API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("status page API returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// updateStatusPage sets the repository's status page component for the deployment's state.
+// Status page problems are logged and never affect the deployment.
+func (a *App) updateStatusPage(ctx context.Context, d *Deployment) {
+	config := a.repoConfig(d.Repository).StatusPage
+	if config == nil {
+		return
+	}
+
+	var status string
+	switch d.Status {
+	case StatusQueued:
+		status = config.DeployingStatus
+		if status == "" {
+			status = ComponentUnderMaintenance
+		}
+	case StatusSucceeded, StatusCancelled:
+		status = ComponentOperational
+	case StatusFailed:
+		status = config.FailedStatus
+	}
+	if status == "" {
+		return
+	}
+
+	apiKey, err := a.secrets.Secret(ctx, config.APIKeySecret)
+	if err != nil {
+		logError("Error resolving status page API key for %s: %v", d.Repository, err)
+		return
+	}
+	if err := config.setComponentStatus(ctx, apiKey, status); err != nil {
+		logError("Error setting status page component of %s to %s: %v", d.Repository, status, err)
+		return
+	}
+	logInfo("Set status page component of %s to %s for deployment %s", d.Repository, status, d.ID)
+}
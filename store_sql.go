@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// migration is one versioned schema change, with a statement per SQL dialect
+type migration struct {
+	version  int
+	postgres string
+	sqlite   string
+}
+
+// sqlMigrations are applied in order and recorded in schema_migrations; never edit a released entry
+var sqlMigrations = []migration{
+	{
+		version: 1,
+		postgres: `
+CREATE TABLE deployments (
+	id         TEXT PRIMARY KEY,
+	repository TEXT NOT NULL,
+	branch     TEXT NOT NULL,
+	status     TEXT NOT NULL,
+	started_at BIGINT NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE INDEX deployments_repository_started_at ON deployments (repository, started_at DESC);`,
+		sqlite: `
+CREATE TABLE deployments (
+	id         TEXT PRIMARY KEY,
+	repository TEXT NOT NULL,
+	branch     TEXT NOT NULL,
+	status     TEXT NOT NULL,
+	started_at INTEGER NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE INDEX deployments_repository_started_at ON deployments (repository, started_at DESC);`,
+	},
+	{
+		version: 2,
+		postgres: `
+CREATE TABLE deployment_events (
+	id            BIGSERIAL PRIMARY KEY,
+	type          TEXT NOT NULL,
+	deployment_id TEXT NOT NULL,
+	repository    TEXT NOT NULL,
+	recorded_at   BIGINT NOT NULL,
+	data          TEXT NOT NULL
+);
+CREATE INDEX deployment_events_deployment_id ON deployment_events (deployment_id);`,
+		sqlite: `
+CREATE TABLE deployment_events (
+	id            INTEGER PRIMARY KEY AUTOINCREMENT,
+	type          TEXT NOT NULL,
+	deployment_id TEXT NOT NULL,
+	repository    TEXT NOT NULL,
+	recorded_at   INTEGER NOT NULL,
+	data          TEXT NOT NULL
+);
+CREATE INDEX deployment_events_deployment_id ON deployment_events (deployment_id);`,
+	},
+	{
+		version: 3,
+		postgres: `
+ALTER TABLE deployment_events ADD COLUMN stream_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE deployment_events ADD COLUMN prev_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE deployment_events ADD COLUMN hash TEXT NOT NULL DEFAULT ''`,
+		sqlite: `
+ALTER TABLE deployment_events ADD COLUMN stream_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE deployment_events ADD COLUMN prev_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE deployment_events ADD COLUMN hash TEXT NOT NULL DEFAULT ''`,
+	},
+	{
+		// Replays record each stream entry once; duplicates from earlier replays are dropped first
+		version: 4,
+		postgres: `
+DELETE FROM deployment_events WHERE stream_id <> '' AND id NOT IN (SELECT MIN(id) FROM deployment_events WHERE stream_id <> '' GROUP BY stream_id);
+CREATE UNIQUE INDEX deployment_events_stream_id ON deployment_events (stream_id) WHERE stream_id <> ''`,
+		sqlite: `
+DELETE FROM deployment_events WHERE stream_id <> '' AND id NOT IN (SELECT MIN(id) FROM deployment_events WHERE stream_id <> '' GROUP BY stream_id);
+CREATE UNIQUE INDEX deployment_events_stream_id ON deployment_events (stream_id) WHERE stream_id <> ''`,
+	},
+}
+
+// SQLDeploymentStore keeps deployment history and the lifecycle audit log in Postgres or SQLite
+type SQLDeploymentStore struct {
+	db      *sql.DB
+	dialect string
+}
+
+// openSQLStore connects to the database and applies any pending migrations
+func openSQLStore(dialect, dsn string) (*SQLDeploymentStore, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("STORE_DSN is required for the %s store", dialect)
+	}
+
+	driver := dialect
+	if dialect == SQLiteStoreBackend {
+		driver = "sqlite"
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if dialect == SQLiteStoreBackend {
+		// SQLite only supports one writer at a time
+		db.SetMaxOpenConns(1)
+	}
+
+	store := &SQLDeploymentStore{db: db, dialect: dialect}
+	if err := store.migrate(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// migrate applies every migration newer than the recorded schema version
+func (s *SQLDeploymentStore) migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, applied_at BIGINT NOT NULL)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	var current int
+	if err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for _, m := range sqlMigrations {
+		if m.version <= current {
+			continue
+		}
+
+		statement := m.postgres
+		if s.dialect == SQLiteStoreBackend {
+			statement = m.sqlite
+		}
+
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %d: %w", m.version, err)
+		}
+		for _, stmt := range strings.Split(statement, ";") {
+			if strings.TrimSpace(stmt) == "" {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("failed to apply migration %d: %w", m.version, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`), m.version, time.Now().UnixMilli()); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", m.version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", m.version, err)
+		}
+
+		logInfo("Applied %s schema migration %d", s.dialect, m.version)
+	}
+
+	return nil
+}
+
+// rebind converts ? placeholders to the $n form Postgres expects
+func (s *SQLDeploymentStore) rebind(query string) string {
+	if s.dialect != PostgresStoreBackend {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *SQLDeploymentStore) Save(ctx context.Context, d *Deployment) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("failed to marshal deployment: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, s.rebind(`
+INSERT INTO deployments (id, repository, branch, status, started_at, data)
+VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT (id) DO UPDATE SET
+	repository = excluded.repository,
+	branch = excluded.branch,
+	status = excluded.status,
+	started_at = excluded.started_at,
+	data = excluded.data`),
+		d.ID, d.Repository, d.Branch, d.Status, d.StartedAt.UnixMilli(), string(data))
+	if err != nil {
+		return fmt.Errorf("failed to store deployment: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLDeploymentStore) Get(ctx context.Context, id string) (*Deployment, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT data FROM deployments WHERE id = ?`), id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDeploymentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load deployment: %w", err)
+	}
+
+	var d Deployment
+	if err := json.Unmarshal([]byte(data), &d); err != nil {
+		return nil, fmt.Errorf("failed to parse deployment: %w", err)
+	}
+
+	return &d, nil
+}
+
+func (s *SQLDeploymentStore) List(ctx context.Context, repo string, limit int) ([]*Deployment, error) {
+	query := `SELECT data FROM deployments WHERE repository = ? ORDER BY started_at DESC`
+	args := []interface{}{repo}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	defer rows.Close()
+
+	deployments := make([]*Deployment, 0)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to read history row: %w", err)
+		}
+		var d Deployment
+		if err := json.Unmarshal([]byte(data), &d); err != nil {
+			return nil, fmt.Errorf("failed to parse deployment: %w", err)
+		}
+		deployments = append(deployments, &d)
+	}
+
+	return deployments, rows.Err()
+}
+
+func (s *SQLDeploymentStore) Repositories(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT repository FROM deployments ORDER BY repository`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repositories: %w", err)
+	}
+	defer rows.Close()
+
+	var repos []string
+	for rows.Next() {
+		var repo string
+		if err := rows.Scan(&repo); err != nil {
+			return nil, fmt.Errorf("failed to read repository row: %w", err)
+		}
+		repos = append(repos, repo)
+	}
+
+	return repos, rows.Err()
+}
+
+func (s *SQLDeploymentStore) Prune(ctx context.Context, repo string, cutoff time.Time, keep int) (int, error) {
+	removed := 0
+
+	if !cutoff.IsZero() {
+		result, err := s.db.ExecContext(ctx, s.rebind(`DELETE FROM deployments WHERE repository = ? AND started_at < ? AND status IN (?, ?, ?)`),
+			repo, cutoff.UnixMilli(), StatusSucceeded, StatusFailed, StatusCancelled)
+		if err != nil {
+			return removed, fmt.Errorf("failed to prune expired deployments: %w", err)
+		}
+		n, _ := result.RowsAffected()
+		removed += int(n)
+	}
+
+	if keep > 0 {
+		result, err := s.db.ExecContext(ctx, s.rebind(`
+DELETE FROM deployments WHERE repository = ? AND status IN (?, ?, ?) AND id NOT IN (
+	SELECT id FROM deployments WHERE repository = ? ORDER BY started_at DESC LIMIT ?
+)`), repo, StatusSucceeded, StatusFailed, StatusCancelled, repo, keep)
+		if err != nil {
+			return removed, fmt.Errorf("failed to prune excess deployments: %w", err)
+		}
+		n, _ := result.RowsAffected()
+		removed += int(n)
+	}
+
+	return removed, nil
+}
+
+// RecordEvent appends a lifecycle event to the deployment_events audit table, along with its stream ID and chain hashes
+// Delegation events are stored with their delegation as the data and no deployment. An event whose stream ID is
+// already recorded is skipped, so replaying the stream doesn't duplicate the audit trail.
+func (s *SQLDeploymentStore) RecordEvent(ctx context.Context, event *LifecycleEvent) error {
+	var snapshot interface{} = event.Deployment
+	var deploymentID, repository string
+	if event.Deployment != nil {
+		deploymentID, repository = event.Deployment.ID, event.Deployment.Repository
+	} else {
+		snapshot = event.Delegation
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event snapshot: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, s.rebind(`INSERT INTO deployment_events (type, deployment_id, repository, recorded_at, data, stream_id, prev_hash, hash) VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (stream_id) WHERE stream_id <> '' DO NOTHING`),
+		event.Type, deploymentID, repository, event.Timestamp.UnixMilli(), string(data), event.ID, event.PrevHash, event.Hash)
+	if err != nil {
+		return fmt.Errorf("failed to record lifecycle event: %w", err)
+	}
+
+	return nil
+}
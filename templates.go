@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// CommandTemplates are a repository's own deployment commands, for repositories that don't deploy with docker
+// compose, configured under commands. Each is a Go template of the PR's {{.Branch}}, {{.Repo}} and {{.PRNumber}}.
+// Steps get the branch and repository single-quoted, so a branch name can't add commands of its own.
+type CommandTemplates struct {
+	// Dir is the directory the pipeline runs in, under BASE_DIR unless absolute (default: the checkout)
+	Dir string `yaml:"dir"`
+	// Steps replace the build and compose steps, after the git steps check out the branch or commit
+	Steps []PipelineStepConfig `yaml:"steps"`
+	// Completion is the command whose output means the deployment succeeded (default: the last step)
+	Completion string `yaml:"completion"`
+}
+
+// commandTemplateData is what command templates are rendered with
+type commandTemplateData struct {
+	Branch   string
+	Repo     string
+	PRNumber int
+}
+
+func (c *CommandTemplates) validate() error {
+	if c.Dir == "" && len(c.Steps) == 0 {
+		return fmt.Errorf("commands needs dir or steps")
+	}
+	if c.Completion != "" && len(c.Steps) == 0 {
+		return fmt.Errorf("commands completion only applies with steps")
+	}
+	sample := commandTemplateData{Branch: "main", Repo: "owner/name", PRNumber: 1}
+	check := func(where, text string) error {
+		if strings.TrimSpace(text) == "" {
+			return fmt.Errorf("commands %s is empty", where)
+		}
+		if _, err := renderCommandTemplate(text, sample); err != nil {
+			return fmt.Errorf("commands %s: %w", where, err)
+		}
+		return nil
+	}
+	if c.Dir != "" {
+		if err := check("dir", c.Dir); err != nil {
+			return err
+		}
+		if strings.Contains(c.Dir, "..") {
+			return fmt.Errorf("commands dir %q must not contain ..", c.Dir)
+		}
+	}
+	completes := c.Completion == ""
+	for i, step := range c.Steps {
+		if err := check(fmt.Sprintf("step %d", i+1), step.Run); err != nil {
+			return err
+		}
+		completes = completes || step.Run == c.Completion
+	}
+	if !completes {
+		return fmt.Errorf("commands completion %q is not one of the steps", c.Completion)
+	}
+	return nil
+}
+
+// renderCommandTemplate fills in a template, failing on fields the data doesn't have
+func renderCommandTemplate(text string, data commandTemplateData) (string, error) {
+	tmpl, err := template.New("command").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// render fills in one of the repository's templates for a PR. Templates were checked when the config was loaded,
+// so one that still fails is left as it was, for the command policy to turn away.
+func (c *CommandTemplates) render(text string, metadata *PRMetadata) string {
+	return c.renderWith(text, metadata, commandTemplateData{Branch: metadata.Branch, Repo: metadata.Repository, PRNumber: metadata.PRNumber})
+}
+
+// renderStep fills in a step's template for a PR with the branch and repository shell-quoted
+func (c *CommandTemplates) renderStep(text string, metadata *PRMetadata) string {
+	return c.renderWith(text, metadata, commandTemplateData{Branch: shellQuote(metadata.Branch), Repo: shellQuote(metadata.Repository), PRNumber: metadata.PRNumber})
+}
+
+func (c *CommandTemplates) renderWith(text string, metadata *PRMetadata, data commandTemplateData) string {
+	rendered, err := renderCommandTemplate(text, data)
+	if err != nil {
+		logError("Error rendering command template %q for %s: %v", text, metadata.Repository, err)
+		return text
+	}
+	return rendered
+}
+
+// runsSteps reports whether the repository's deployments run its own steps
+func (c *CommandTemplates) runsSteps() bool {
+	return c != nil && len(c.Steps) > 0
+}
+
+// steps returns the repository's deployment steps for a PR
+func (c *CommandTemplates) steps(metadata *PRMetadata) []pipelineStep {
+	steps := make([]pipelineStep, 0, len(c.Steps))
+	for i, step := range c.Steps {
+		name := step.Name
+		if name == "" {
+			name = fmt.Sprintf("step-%d", i+1)
+		}
+		steps = append(steps, pipelineStep{name, c.renderStep(step.Run, metadata)})
+	}
+	return steps
+}
+
+// completion returns the command that completes a deployment of a PR, or "" for the built-in ones
+func (c *CommandTemplates) completion(metadata *PRMetadata) string {
+	if !c.runsSteps() {
+		return ""
+	}
+	if c.Completion != "" {
+		return c.renderStep(c.Completion, metadata)
+	}
+	return c.renderStep(c.Steps[len(c.Steps)-1].Run, metadata)
+}
+
+// pipelineDir returns the directory a run of the repository's pipeline works in: its dir template, for the first
+// environment, or the environment's checkout. A rendered template may not contain .. (git refuses it in
+// branch names too) and must stay under BASE_DIR, or under the directory an absolute template names before its
+// first placeholder, so a branch can't move the pipeline elsewhere.
+func (c RepoConfig) pipelineDir(baseDir string, metadata *PRMetadata, environment string) (string, error) {
+	if c.Commands == nil || c.Commands.Dir == "" || c.environmentIndex(environment) > 0 {
+		return c.environmentDir(baseDir, metadata.Repository, environment), nil
+	}
+	root := baseDir
+	dir := c.Commands.render(c.Commands.Dir, metadata)
+	if strings.Contains(dir, "..") {
+		return "", fmt.Errorf("commands dir %q for branch %q contains ..", c.Commands.Dir, metadata.Branch)
+	}
+	if filepath.IsAbs(c.Commands.Dir) {
+		prefix, _, _ := strings.Cut(c.Commands.Dir, "{{")
+		root = filepath.Dir(prefix + "x")
+		dir = filepath.Clean(dir)
+	} else {
+		dir = filepath.Join(baseDir, dir)
+	}
+	if rel, err := filepath.Rel(root, dir); err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("commands dir %q for branch %q is outside %s", c.Commands.Dir, metadata.Branch, root)
+	}
+	return dir, nil
+}
+
+// completesWorkflow reports whether a command's output means its workflow succeeded: the completion command a
+// deployment of a repository with command templates recorded, or one of the built-in ones
+func (a *App) completesWorkflow(ctx context.Context, output CommandOutput) bool {
+	if output.Metadata.DeploymentID != "" && a.hasCommandTemplates() {
+		if d, err := a.deployments.Get(ctx, output.Metadata.DeploymentID); err == nil && d.Completion != "" {
+			// A migration still completes with the old host's teardown
+			return output.Command == d.Completion || output.Command == TeardownCommand
+		}
+	}
+	return isCompletionCommand(output.Command)
+}
+
+// hasCommandTemplates reports whether any repository runs its own deployment steps, so that only then does
+// command output need its deployment looked up to tell whether it completes it
+func (a *App) hasCommandTemplates() bool {
+	if a.reposConfig == nil {
+		return false
+	}
+	for _, repoConfig := range a.reposConfig.Repos {
+		if repoConfig.Commands.runsSteps() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+// Command fakeslack stands in for the Slack Web API in the integration test stack.
+//
+// Tests register the messages VibeDeploy will look up with POST /_messages, and read back
+// every API call it made with GET /_calls.
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Message is a Slack message with the PR metadata VibeDeploy reads from it
+type Message struct {
+	Channel  string                 `json:"channel"`
+	Ts       string                 `json:"ts"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// Call is one Web API request, with its form or JSON parameters flattened to strings
+type Call struct {
+	Method string            `json:"method"`
+	Params map[string]string `json:"params"`
+}
+
+type server struct {
+	mu       sync.Mutex
+	messages map[string]Message
+	calls    []Call
+}
+
+func main() {
+	addr := os.Getenv("FAKE_SLACK_ADDR")
+	if addr == "" {
+		addr = ":8080"
+	}
+	s := &server{messages: make(map[string]Message)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /_messages", s.handleAddMessage)
+	mux.HandleFunc("GET /_calls", s.handleCalls)
+	mux.HandleFunc("/", s.handleAPI)
+
+	log.Printf("Fake Slack listening on %s", addr)
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
+
+func (s *server) handleAddMessage(w http.ResponseWriter, r *http.Request) {
+	var message Message
+	if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.messages[message.Channel+"/"+message.Ts] = message
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) handleCalls(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.calls)
+}
+
+// handleAPI records the call and answers the few methods VibeDeploy relies on; the rest just succeed
+func (s *server) handleAPI(w http.ResponseWriter, r *http.Request) {
+	method := strings.Trim(r.URL.Path, "/")
+	params := make(map[string]string)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		for key, value := range body {
+			if text, ok := value.(string); ok {
+				params[key] = text
+			} else {
+				encoded, _ := json.Marshal(value)
+				params[key] = string(encoded)
+			}
+		}
+	} else {
+		r.ParseForm()
+		for key := range r.Form {
+			params[key] = r.Form.Get(key)
+		}
+	}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, Call{Method: method, Params: params})
+	message, found := s.messages[params["channel"]+"/"+params["latest"]]
+	s.mu.Unlock()
+
+	response := map[string]interface{}{"ok": true}
+	switch method {
+	case "conversations.history":
+		var messages []map[string]interface{}
+		if found {
+			messages = append(messages, map[string]interface{}{
+				"type": "message",
+				"ts":   message.Ts,
+				"metadata": map[string]interface{}{
+					"event_type":    "pull_request",
+					"event_payload": message.Metadata,
+				},
+			})
+		}
+		response["messages"] = messages
+	case "chat.postMessage":
+		response["channel"] = params["channel"]
+		response["ts"] = "1700000000.999999"
+	case "chat.getPermalink":
+		response["permalink"] = "https://slack.example.com/archives/" + params["channel"] + "/p" + strings.ReplaceAll(params["message_ts"], ".", "")
+	case "reactions.get":
+		response["type"] = "message"
+		response["message"] = map[string]interface{}{"reactions": []interface{}{}}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
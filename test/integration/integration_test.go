@@ -0,0 +1,309 @@
+//go:build integration
+
+// Package integration runs end-to-end scenarios against the docker compose test stack in this directory.
+// Start the stack and run the suite with `make integration-test` from the repository root.
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	reactionChannel = "slack-relay-reaction-added"
+	reactionList    = "slack_reactions"
+	receivedList    = "integration:poppit:received"
+	testChannel     = "CINTEGRATION"
+)
+
+// scenarioTimeout covers the failure scenario's 5s step timeout plus the watchdog's 15s check interval
+const scenarioTimeout = 60 * time.Second
+
+var (
+	redisClient *redis.Client
+	slackURL    string
+)
+
+func TestMain(m *testing.M) {
+	redisClient = redis.NewClient(&redis.Options{Addr: getEnv("INTEGRATION_REDIS_ADDR", "localhost:16379")})
+	slackURL = strings.TrimSuffix(getEnv("INTEGRATION_SLACK_URL", "http://localhost:18080"), "/")
+
+	if err := waitForStack(); err != nil {
+		fmt.Fprintf(os.Stderr, "integration stack is not running (try `make integration-test`): %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+func waitForStack() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	for {
+		err := redisClient.Ping(ctx).Err()
+		if err == nil {
+			var resp *http.Response
+			if resp, err = http.Get(slackURL + "/_calls"); err == nil {
+				resp.Body.Close()
+				// VibeDeploy is up once it has subscribed to the reaction channel
+				var counts map[string]int64
+				if counts, err = redisClient.PubSubNumSub(ctx, reactionChannel).Result(); err == nil && counts[reactionChannel] > 0 {
+					return nil
+				}
+				if err == nil {
+					err = fmt.Errorf("nothing subscribed to %s yet", reactionChannel)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// slackReaction mirrors the messages VibeDeploy pushes to the reaction list
+type slackReaction struct {
+	Reaction string `json:"reaction"`
+	Channel  string `json:"channel"`
+	Ts       string `json:"ts"`
+	Remove   bool   `json:"remove,omitempty"`
+}
+
+// poppitCommand mirrors the payloads VibeDeploy queues for Poppit
+type poppitCommand struct {
+	Repo     string   `json:"repo"`
+	Branch   string   `json:"branch"`
+	Type     string   `json:"type"`
+	Commands []string `json:"commands"`
+	Metadata struct {
+		Channel      string `json:"channel"`
+		Ts           string `json:"ts"`
+		DeploymentID string `json:"deployment_id"`
+	} `json:"metadata"`
+}
+
+type slackCall struct {
+	Method string            `json:"method"`
+	Params map[string]string `json:"params"`
+}
+
+// newMessage registers a PR message with the fake Slack and returns its timestamp, unique to this run
+func newMessage(t *testing.T, repo, branch string) string {
+	t.Helper()
+	ts := fmt.Sprintf("%d.%06d", time.Now().Unix(), time.Now().Nanosecond()/1000)
+	body, _ := json.Marshal(map[string]interface{}{
+		"channel": testChannel,
+		"ts":      ts,
+		"metadata": map[string]interface{}{
+			"repository": repo,
+			"branch":     branch,
+			"pr_number":  42,
+			"pr_url":     "https://github.com/" + repo + "/pull/42",
+			"author":     "octocat",
+		},
+	})
+	resp, err := http.Post(slackURL+"/_messages", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to register message: %v", err)
+	}
+	resp.Body.Close()
+	return ts
+}
+
+// publishReaction relays a reaction_added event the way Slack Relay does
+func publishReaction(t *testing.T, eventID, reaction, ts string) {
+	t.Helper()
+	event := map[string]interface{}{
+		"event_id": eventID,
+		"event": map[string]interface{}{
+			"type":     "reaction_added",
+			"user":     "UINTEGRATION",
+			"reaction": reaction,
+			"item":     map[string]interface{}{"type": "message", "channel": testChannel, "ts": ts},
+		},
+	}
+	payload, _ := json.Marshal(event)
+	if err := redisClient.Publish(context.Background(), reactionChannel, payload).Err(); err != nil {
+		t.Fatalf("failed to publish reaction: %v", err)
+	}
+}
+
+// reactionsFor returns the reactions VibeDeploy published for a message, in order
+func reactionsFor(t *testing.T, ts string) []slackReaction {
+	t.Helper()
+	entries, err := redisClient.LRange(context.Background(), reactionList, 0, -1).Result()
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", reactionList, err)
+	}
+	var reactions []slackReaction
+	for _, entry := range entries {
+		var reaction slackReaction
+		if err := json.Unmarshal([]byte(entry), &reaction); err != nil {
+			t.Fatalf("reaction %q is not valid JSON: %v", entry, err)
+		}
+		if reaction.Ts == ts {
+			reactions = append(reactions, reaction)
+		}
+	}
+	return reactions
+}
+
+// commandsFor returns the Poppit payloads queued for a message
+func commandsFor(t *testing.T, ts string) []poppitCommand {
+	t.Helper()
+	entries, err := redisClient.LRange(context.Background(), receivedList, 0, -1).Result()
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", receivedList, err)
+	}
+	var commands []poppitCommand
+	for _, entry := range entries {
+		var cmd poppitCommand
+		if err := json.Unmarshal([]byte(entry), &cmd); err != nil {
+			t.Fatalf("Poppit payload %q is not valid JSON: %v", entry, err)
+		}
+		if cmd.Metadata.Ts == ts {
+			commands = append(commands, cmd)
+		}
+	}
+	return commands
+}
+
+// threadReplies returns the text of every message VibeDeploy posted in the message's thread
+func threadReplies(t *testing.T, ts string) []string {
+	t.Helper()
+	resp, err := http.Get(slackURL + "/_calls")
+	if err != nil {
+		t.Fatalf("failed to read Slack calls: %v", err)
+	}
+	defer resp.Body.Close()
+	var calls []slackCall
+	if err := json.NewDecoder(resp.Body).Decode(&calls); err != nil {
+		t.Fatalf("failed to parse Slack calls: %v", err)
+	}
+	var replies []string
+	for _, call := range calls {
+		if call.Method == "chat.postMessage" && call.Params["thread_ts"] == ts {
+			replies = append(replies, call.Params["text"])
+		}
+	}
+	return replies
+}
+
+// waitFor polls until the condition holds or the scenario times out
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(scenarioTimeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// hasReaction reports whether the reaction was added (not removed) for the message
+func hasReaction(reactions []slackReaction, name string) bool {
+	for _, reaction := range reactions {
+		if reaction.Reaction == name && !reaction.Remove {
+			return true
+		}
+	}
+	return false
+}
+
+func TestHappyPath(t *testing.T) {
+	ts := newMessage(t, "its-the-vibe/VibeMerge", "feature/happy")
+	publishReaction(t, "Ev-happy-"+ts, "rocket", ts)
+
+	waitFor(t, "the rocket reaction", func() bool { return hasReaction(reactionsFor(t, ts), "rocket") })
+
+	commands := commandsFor(t, ts)
+	if len(commands) != 1 {
+		t.Fatalf("expected 1 Poppit command, got %d", len(commands))
+	}
+	cmd := commands[0]
+	if cmd.Repo != "its-the-vibe/VibeMerge" || cmd.Branch != "feature/happy" || cmd.Type != "vibe-deploy" {
+		t.Errorf("unexpected command target: %+v", cmd)
+	}
+	if cmd.Metadata.DeploymentID == "" {
+		t.Error("command metadata has no deployment ID")
+	}
+	if len(cmd.Commands) == 0 || cmd.Commands[0] != "git fetch origin" {
+		t.Errorf("pipeline should start with git fetch origin: %q", cmd.Commands)
+	}
+
+	var order []string
+	for _, reaction := range reactionsFor(t, ts) {
+		name := reaction.Reaction
+		if reaction.Remove {
+			name = "-" + name
+		}
+		order = append(order, name)
+	}
+	if want := "gear,-gear,rocket"; strings.Join(order, ",") != want {
+		t.Errorf("expected reactions %s, got %s", want, strings.Join(order, ","))
+	}
+	if hasReaction(reactionsFor(t, ts), "x") {
+		t.Error("a successful deployment should not get the x reaction")
+	}
+}
+
+func TestFailure(t *testing.T) {
+	ts := newMessage(t, "its-the-vibe/VibeMerge", "fail/broken-build")
+	publishReaction(t, "Ev-fail-"+ts, "rocket", ts)
+
+	waitFor(t, "the x reaction", func() bool { return hasReaction(reactionsFor(t, ts), "x") })
+
+	if hasReaction(reactionsFor(t, ts), "rocket") {
+		t.Error("a failed deployment should not get the rocket reaction")
+	}
+	waitFor(t, "the failure thread reply", func() bool {
+		for _, reply := range threadReplies(t, ts) {
+			if strings.Contains(reply, "failed") && strings.Contains(reply, "`docker compose build` exited with status 1") {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func TestDuplicateEvents(t *testing.T) {
+	ts := newMessage(t, "its-the-vibe/VibeMerge", "feature/duplicate")
+	eventID := "Ev-duplicate-" + ts
+	publishReaction(t, eventID, "rocket", ts)
+	publishReaction(t, eventID, "rocket", ts)
+
+	waitFor(t, "the rocket reaction", func() bool { return hasReaction(reactionsFor(t, ts), "rocket") })
+
+	// Give a second deployment time to show up if the duplicate wasn't dropped
+	time.Sleep(2 * time.Second)
+	if commands := commandsFor(t, ts); len(commands) != 1 {
+		t.Fatalf("expected the duplicate event to be ignored, got %d Poppit commands", len(commands))
+	}
+	gears := 0
+	for _, reaction := range reactionsFor(t, ts) {
+		if reaction.Reaction == "gear" && !reaction.Remove {
+			gears++
+		}
+	}
+	if gears != 1 {
+		t.Errorf("expected one gear reaction, got %d", gears)
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
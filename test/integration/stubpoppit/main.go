@@ -0,0 +1,94 @@
+// Command stubpoppit stands in for Poppit in the integration test stack.
+//
+// It pops commands from the Poppit list, keeps a copy of each payload in the received list for tests
+// to assert on, and publishes an output message for every command as if it had run. Branches starting
+// with "fail/" stop at the build step with a non-zero exit code, as a real build failure would.
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	poppitv1 "github.com/its-the-vibe/VibeDeploy/api/poppit/v1"
+)
+
+// receivedKey is the Redis list of every payload the stub has consumed, oldest first
+const receivedKey = "integration:poppit:received"
+
+func main() {
+	redisClient := redis.NewClient(&redis.Options{Addr: getEnv("REDIS_ADDR", "localhost:6379")})
+	list := getEnv("REDIS_LIST_NAME", "poppit-commands")
+	channel := getEnv("REDIS_OUTPUT_CHANNEL", "poppit:command-output")
+	ctx := context.Background()
+
+	log.Printf("Stub Poppit consuming %s", list)
+	for {
+		result, err := redisClient.BLPop(ctx, 5*time.Second, list).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			log.Printf("Error popping from %s: %v", list, err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		payload := result[1]
+		if err := redisClient.RPush(ctx, receivedKey, payload).Err(); err != nil {
+			log.Printf("Error recording payload: %v", err)
+		}
+
+		// Decode strictly, as Poppit would, so a payload that drifts from the schema fails the suite
+		cmd, err := poppitv1.DecodeCommand([]byte(payload))
+		if err != nil {
+			log.Printf("Error parsing command: %v", err)
+			continue
+		}
+		for _, step := range cmd.Commands {
+			output := &poppitv1.CommandOutput{Metadata: cmd.Metadata, Type: cmd.Type, Command: step, Output: stepOutput(step)}
+			failed := strings.HasPrefix(cmd.Branch, "fail/") && strings.HasPrefix(step, "docker compose build")
+			if failed {
+				log.Printf("Failing %q for branch %s", step, cmd.Branch)
+				output.Output, output.ExitCode = "failed to solve: process \"/bin/sh -c npm run build\" did not complete successfully", 1
+			}
+			// Reply in the encoding the command arrived in, as a Poppit that speaks both would
+			message, err := poppitv1.EncodeCommandOutput(output, poppitv1.ContentType([]byte(payload)))
+			if err != nil {
+				log.Printf("Error marshaling output: %v", err)
+				break
+			}
+			if err := redisClient.Publish(ctx, channel, message).Err(); err != nil {
+				log.Printf("Error publishing output: %v", err)
+			}
+			if failed {
+				break
+			}
+		}
+	}
+}
+
+// stepOutput is plausible output for the steps whose output VibeDeploy parses
+func stepOutput(step string) string {
+	switch {
+	case step == "git rev-parse HEAD":
+		return "0123456789abcdef0123456789abcdef01234567\n"
+	case strings.HasPrefix(step, "docker compose config --hash"):
+		return "web 4f0c2a9d\n"
+	case strings.HasPrefix(step, "docker compose images"), strings.HasPrefix(step, "docker compose stats"):
+		return "[]\n"
+	default:
+		return "ok\n"
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
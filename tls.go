@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// certificatesKey is a Redis hash of preview hostname to when its certificate was last provisioned (RFC 3339)
+const certificatesKey = "vibedeploy:certificates"
+
+// TLS certificate modes
+const (
+	// TLSModeACME requests a certificate with lego using an ACME DNS-01 challenge
+	TLSModeACME = "acme"
+	// TLSModeWildcard copies an existing wildcard certificate into place
+	TLSModeWildcard = "wildcard"
+)
+
+// defaultCertificateRenewal is how long a provisioned certificate is reused before the step runs again
+const defaultCertificateRenewal = 60 * 24 * time.Hour
+
+// Certificate steps are recognised by their prefix, since the pipeline is generated and uses nothing else like them
+const (
+	legoCommandPrefix     = "lego "
+	wildcardCommandPrefix = "cp -p "
+)
+
+// TLSConfig is the tls section of a repository's settings
+type TLSConfig struct {
+	// Mode is acme or wildcard
+	Mode string `yaml:"mode"`
+
+	// Email, DNSProvider and Path configure lego for acme mode; Path is lego's --path
+	Email       string `yaml:"email"`
+	DNSProvider string `yaml:"dns_provider"`
+	Path        string `yaml:"path"`
+
+	// Cert and Key are copied into Dir in wildcard mode
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+	Dir  string `yaml:"dir"`
+
+	// RenewAfter is how long a certificate is reused before it is provisioned again (default: 1440h)
+	RenewAfter Duration `yaml:"renew_after"`
+}
+
+// certificateCommand returns the step that provisions a certificate for the hostname
+func (c *TLSConfig) certificateCommand(hostname string) string {
+	switch c.Mode {
+	case TLSModeACME:
+		return fmt.Sprintf("%s--accept-tos --email %s --dns %s --domains %s --path %s run", legoCommandPrefix, c.Email, c.DNSProvider, hostname, c.Path)
+	case TLSModeWildcard:
+		return fmt.Sprintf("%s%s %s %s", wildcardCommandPrefix, c.Cert, c.Key, c.Dir)
+	default:
+		return ""
+	}
+}
+
+// validate checks that the settings for the chosen mode are present
+func (c *TLSConfig) validate() error {
+	switch c.Mode {
+	case TLSModeACME:
+		if c.Email == "" || c.DNSProvider == "" || c.Path == "" {
+			return fmt.Errorf("tls mode %s needs email, dns_provider and path", TLSModeACME)
+		}
+	case TLSModeWildcard:
+		if c.Cert == "" || c.Key == "" || c.Dir == "" {
+			return fmt.Errorf("tls mode %s needs cert, key and dir", TLSModeWildcard)
+		}
+	default:
+		return fmt.Errorf("unknown tls mode %q (expected %s or %s)", c.Mode, TLSModeACME, TLSModeWildcard)
+	}
+	return nil
+}
+
+// isCertificateCommand reports whether a command is a certificate provisioning step
+func isCertificateCommand(command string) bool {
+	return strings.HasPrefix(command, legoCommandPrefix) || strings.HasPrefix(command, wildcardCommandPrefix)
+}
+
+// certificateStep returns the certificate step for a deployment, or "" when it has no TLS settings,
+// no allocated hostname, or a certificate that is still fresh
+func (a *App) certificateStep(ctx context.Context, repoConfig RepoConfig, allocation *PoolAllocation) string {
+	if repoConfig.TLS == nil || allocation == nil || allocation.Hostname == "" {
+		return ""
+	}
+
+	renewAfter := time.Duration(repoConfig.TLS.RenewAfter)
+	if renewAfter <= 0 {
+		renewAfter = defaultCertificateRenewal
+	}
+	raw, err := a.redisClient.HGet(ctx, certificatesKey, allocation.Hostname).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		logError("Error reading certificate state for %s: %v", allocation.Hostname, err)
+	}
+	if issued, err := time.Parse(time.RFC3339, raw); err == nil && time.Since(issued) < renewAfter {
+		logDebug("Certificate for %s was provisioned %s ago, skipping the tls step", allocation.Hostname, time.Since(issued).Round(time.Minute))
+		return ""
+	}
+
+	return repoConfig.TLS.certificateCommand(allocation.Hostname)
+}
+
+// certificateError returns the first error line of a certificate step's output, or "" if it succeeded
+func certificateError(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		lower := strings.ToLower(line)
+		if strings.Contains(lower, "error") || strings.Contains(lower, "could not obtain") || strings.Contains(lower, "no such file") {
+			return strings.TrimSpace(line)
+		}
+	}
+	return ""
+}
+
+// recordCertificate handles the output of a certificate step: a failure fails the deployment with a
+// certificate-specific reason, and a success is remembered so the step is skipped until renewal is due
+func (a *App) recordCertificate(ctx context.Context, output CommandOutput) {
+	if output.Metadata.DeploymentID == "" {
+		return
+	}
+	d, err := a.deployments.Get(ctx, output.Metadata.DeploymentID)
+	if err != nil {
+		logError("Error loading deployment %s for certificate step: %v", output.Metadata.DeploymentID, err)
+		return
+	}
+	if d.Allocation == nil || d.Allocation.Hostname == "" {
+		return
+	}
+
+	message := certificateError(output.Output)
+	if message == "" && output.ExitCode != 0 {
+		message = fmt.Sprintf("the step exited with status %d", output.ExitCode)
+	}
+	if message != "" {
+		logWarn("Certificate for %s could not be provisioned for deployment %s: %s", d.Allocation.Hostname, d.ID, message)
+		a.failDeployment(ctx, d.ID, fmt.Sprintf(":lock: certificate for %s could not be provisioned: %s", d.Allocation.Hostname, message))
+		return
+	}
+
+	if err := a.redisClient.HSet(ctx, certificatesKey, d.Allocation.Hostname, time.Now().UTC().Format(time.RFC3339)).Err(); err != nil {
+		logError("Error recording certificate for %s: %v", d.Allocation.Hostname, err)
+	}
+	logInfo("Provisioned certificate for %s", d.Allocation.Hostname)
+}
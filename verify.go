@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// VerifyConfig is the verify section of an environment, which makes it a protected environment: deployments to it
+// must ship a commit GitHub verified the signature of, and come from a PR targeting a protected branch
+type VerifyConfig struct {
+	// SignedCommits requires GitHub to report the deployed commit's signature as verified
+	SignedCommits bool `yaml:"signed_commits"`
+	// ProtectedBase requires the PR's base branch, or the deployed branch itself without a PR, to be protected
+	ProtectedBase bool `yaml:"protected_base"`
+}
+
+func (c *VerifyConfig) validate() error {
+	if !c.SignedCommits && !c.ProtectedBase {
+		return fmt.Errorf("verify needs signed_commits or protected_base")
+	}
+	return nil
+}
+
+// commitVerification is the subset of GitHub's commit fields the signature check uses
+type commitVerification struct {
+	SHA    string `json:"sha"`
+	Commit struct {
+		Verification struct {
+			Verified bool   `json:"verified"`
+			Reason   string `json:"reason"`
+		} `json:"verification"`
+	} `json:"commit"`
+}
+
+func (g *GitHubApp) commit(ctx context.Context, repo, ref string) (*commitVerification, error) {
+	token, err := g.token(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	var commit commitVerification
+	if err := g.do(ctx, token, http.MethodGet, "/repos/"+repo+"/commits/"+ref, nil, &commit); err != nil {
+		return nil, fmt.Errorf("failed to get commit %s: %w", ref, err)
+	}
+	return &commit, nil
+}
+
+// branchProtected reports whether a branch has branch protection
+func (g *GitHubApp) branchProtected(ctx context.Context, repo, branch string) (bool, error) {
+	token, err := g.token(ctx, repo)
+	if err != nil {
+		return false, err
+	}
+	var b struct {
+		Protected bool `json:"protected"`
+	}
+	if err := g.do(ctx, token, http.MethodGet, "/repos/"+repo+"/branches/"+branch, nil, &b); err != nil {
+		return false, fmt.Errorf("failed to get branch %s: %w", branch, err)
+	}
+	return b.Protected, nil
+}
+
+// verifyRef returns ErrDeploymentDeclined unless a deployment to a protected environment ships what its verify
+// settings require. It returns the commit it verified, for the deployment to check out, so that a branch moving on
+// after the check can't ship an unverified commit; and "" if the environment isn't protected. Like the gate, it
+// declines when GitHub can't be asked.
+func (a *App) verifyRef(ctx context.Context, metadata *PRMetadata, repoConfig RepoConfig, options DeployOptions) (string, error) {
+	i := repoConfig.environmentIndex(options.Environment)
+	if i < 0 || repoConfig.Environments[i].Verify == nil {
+		return "", nil
+	}
+	verify, environment := repoConfig.Environments[i].Verify, repoConfig.Environments[i].Name
+	if a.github == nil {
+		return "", fmt.Errorf("%w: %s is a protected environment, and verifying deployments to it needs the GitHub App", ErrDeploymentDeclined, environment)
+	}
+
+	// A promotion or rollback ships a commit of its own; otherwise the PR's head is what gets deployed
+	ref, base := options.GitSHA, metadata.Branch
+	if metadata.PRNumber != 0 {
+		pr, err := a.github.pullRequest(ctx, metadata.Repository, metadata.PRNumber)
+		if err != nil {
+			return "", fmt.Errorf("%w: could not verify %s#%d: %v", ErrDeploymentDeclined, metadata.Repository, metadata.PRNumber, err)
+		}
+		if ref == "" {
+			ref = pr.Head.SHA
+		}
+		base = pr.Base.Ref
+	}
+	if ref == "" {
+		ref = metadata.Branch
+	}
+
+	commit, err := a.github.commit(ctx, metadata.Repository, ref)
+	if err != nil {
+		return "", fmt.Errorf("%w: could not verify `%s`: %v", ErrDeploymentDeclined, metadata.Branch, err)
+	}
+	if verify.SignedCommits && !commit.Commit.Verification.Verified {
+		reason := strings.ReplaceAll(commit.Commit.Verification.Reason, "_", " ")
+		return "", fmt.Errorf("%w: commit `%s` of `%s` has no verified signature (%s), which %s requires", ErrDeploymentDeclined, shortSHA(commit.SHA), metadata.Branch, reason, environment)
+	}
+	if verify.ProtectedBase {
+		protected, err := a.github.branchProtected(ctx, metadata.Repository, base)
+		if err != nil {
+			return "", fmt.Errorf("%w: could not verify `%s`: %v", ErrDeploymentDeclined, base, err)
+		}
+		if !protected {
+			if base == metadata.Branch {
+				return "", fmt.Errorf("%w: `%s` is not a protected branch, which %s requires without a PR", ErrDeploymentDeclined, base, environment)
+			}
+			return "", fmt.Errorf("%w: `%s` targets `%s`, which is not a protected branch, as %s requires", ErrDeploymentDeclined, metadata.Branch, base, environment)
+		}
+	}
+	logInfo("Verified %s at %s for %s", metadata.Repository, shortSHA(commit.SHA), environment)
+	return commit.SHA, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// votePassedKeyPrefix marks, per reaction and message, a vote that has passed, so later votes don't deploy again
+const votePassedKeyPrefix = "vibedeploy:votes:passed:"
+
+// votePassedTTL is how long a passed vote stands; after it, further reactions on the message are a new vote
+const votePassedTTL = 24 * time.Hour
+
+// requiredVotes returns how many distinct authorized reactions it takes to deploy to an environment, which
+// is 1 for repositories and environments without a vote
+func (c RepoConfig) requiredVotes(environment string) int {
+	votes := c.Votes
+	if i := c.environmentIndex(environment); i >= 0 && c.Environments[i].Votes > 0 {
+		votes = c.Environments[i].Votes
+	}
+	if votes < 1 {
+		return 1
+	}
+	return votes
+}
+
+// countVotes returns how many distinct users allowed to vote have reacted to a message with the reaction
+func (a *App) countVotes(ctx context.Context, channel, ts, reaction string, allowed func(user string) bool) (int, error) {
+	reactions, err := a.slackClient.GetReactionsContext(ctx, slack.NewRefToMessage(channel, ts), slack.GetReactionsParameters{Full: true})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get message reactions: %w", err)
+	}
+	votes := 0
+	for _, r := range reactions {
+		if r.Name != reaction {
+			continue
+		}
+		for _, user := range r.Users {
+			if allowed(user) {
+				votes++
+			}
+		}
+	}
+	return votes, nil
+}
+
+// castVote counts a reaction towards deploying a repository to an environment, and reports whether the vote
+// passed with it. Until it does, each vote gets a tally in the thread.
+func (a *App) castVote(ctx context.Context, reaction, repo, environment, channel, ts string, allowed func(user string) bool) bool {
+	required := a.repoConfig(repo).requiredVotes(environment)
+	if required <= 1 {
+		return true
+	}
+
+	votes, err := a.countVotes(ctx, channel, ts, reaction, allowed)
+	if err != nil {
+		// Without a count there is no consensus, so nothing deploys
+		logError("Error counting votes on message %s: %v", ts, err)
+		return false
+	}
+	if votes < required {
+		logInfo("%d of %d votes to deploy %s on message %s", votes, required, repo, ts)
+		text := a.messages.text("reaction.votes", map[string]interface{}{
+			"Votes":       votes,
+			"Required":    required,
+			"Remaining":   required - votes,
+			"Reaction":    reaction,
+			"Repository":  repo,
+			"Environment": environment,
+		})
+		if err := a.postThreadMessage(ctx, channel, ts, text); err != nil {
+			logError("Error posting vote tally: %v", err)
+		}
+		return false
+	}
+
+	// Every vote past the threshold sees it passed; only the first deploys
+	passed, err := a.redisClient.SetNX(ctx, votePassedKeyPrefix+reaction+":"+channel+":"+ts, votes, votePassedTTL).Result()
+	if err != nil {
+		logError("Error recording vote on message %s: %v", ts, err)
+		return false
+	}
+	if !passed {
+		// A burst of votes past the threshold is still coalesced into the deployment
+		if a.coalescing(ctx, channel, ts) {
+			return true
+		}
+		logInfo("Vote to deploy %s on message %s already passed, ignoring reaction", repo, ts)
+		return false
+	}
+	logInfo("Vote to deploy %s passed with %d of %d votes on message %s", repo, votes, required, ts)
+	return true
+}
+
+// reopenVote lets a message vote again after its passed vote deployed nothing
+func (a *App) reopenVote(ctx context.Context, reaction, channel, ts string) {
+	if err := a.redisClient.Del(ctx, votePassedKeyPrefix+reaction+":"+channel+":"+ts).Err(); err != nil {
+		logError("Error reopening vote on message %s: %v", ts, err)
+	}
+}
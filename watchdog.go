@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	watchdogDeadlinesKey = "vibedeploy:watchdog"
+	watchdogAwaitingKey  = "vibedeploy:watchdog:awaiting"
+	// watchdogPickupKey is a set of deployments whose first step is still waiting for a Poppit worker
+	watchdogPickupKey = "vibedeploy:watchdog:pickup"
+)
+
+// watchdogInterval is how often overdue deployments are checked for
+const watchdogInterval = 15 * time.Second
+
+// armWatchdog sets the output deadline for the step following lastCommand ("" for the first step).
+// The deadline is cleared when the next step has no timeout or the pipeline has no further steps.
+func (a *App) armWatchdog(ctx context.Context, deploymentID, lastCommand string) {
+	d, err := a.deployments.Get(ctx, deploymentID)
+	if err != nil {
+		logError("Error loading deployment %s for watchdog: %v", deploymentID, err)
+		return
+	}
+	if d.Status != StatusQueued {
+		return
+	}
+
+	next := nextPipelineCommand(d.Pipeline, lastCommand)
+	timeout := d.Timeouts[next]
+	if next == "" || timeout <= 0 {
+		a.disarmWatchdog(ctx, deploymentID)
+		return
+	}
+
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+	pipe := a.redisClient.TxPipeline()
+	pipe.ZAdd(ctx, watchdogDeadlinesKey, redis.Z{Score: float64(deadline.UnixMilli()), Member: deploymentID})
+	pipe.HSet(ctx, watchdogAwaitingKey, deploymentID, next)
+	pipe.SRem(ctx, watchdogPickupKey, deploymentID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logError("Error arming watchdog for deployment %s: %v", deploymentID, err)
+		return
+	}
+	logDebug("Watchdog expects output of %q for deployment %s within %ds", next, deploymentID, timeout)
+}
+
+// armPickupWatchdog watches a deployment whose first step waits in a Poppit queue. Waiting for a worker
+// doesn't count against the step's timeout: the queue is looked at every watchdogInterval, and the first
+// step's deadline is armed once the command has left it.
+func (a *App) armPickupWatchdog(ctx context.Context, deploymentID string) {
+	pipe := a.redisClient.TxPipeline()
+	pipe.SAdd(ctx, watchdogPickupKey, deploymentID)
+	pipe.ZAdd(ctx, watchdogDeadlinesKey, redis.Z{Score: float64(time.Now().Add(watchdogInterval).UnixMilli()), Member: deploymentID})
+	if _, err := pipe.Exec(ctx); err != nil {
+		logError("Error arming watchdog for deployment %s: %v", deploymentID, err)
+	}
+}
+
+// disarmWatchdog clears any pending output deadline for a deployment
+func (a *App) disarmWatchdog(ctx context.Context, deploymentID string) {
+	pipe := a.redisClient.TxPipeline()
+	pipe.ZRem(ctx, watchdogDeadlinesKey, deploymentID)
+	pipe.HDel(ctx, watchdogAwaitingKey, deploymentID)
+	pipe.SRem(ctx, watchdogPickupKey, deploymentID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logError("Error disarming watchdog for deployment %s: %v", deploymentID, err)
+	}
+}
+
+// nextPipelineCommand returns the command after lastCommand, or the first command when lastCommand is empty
+func nextPipelineCommand(pipeline []string, lastCommand string) string {
+	if lastCommand == "" {
+		if len(pipeline) == 0 {
+			return ""
+		}
+		return pipeline[0]
+	}
+	for i, command := range pipeline {
+		if command == lastCommand && i+1 < len(pipeline) {
+			return pipeline[i+1]
+		}
+	}
+	return ""
+}
+
+// runWatchdog periodically fails deployments whose current step has exceeded its timeout
+func (a *App) runWatchdog(ctx context.Context) {
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logInfo("Watchdog context cancelled, exiting")
+			return
+		case <-ticker.C:
+			if err := a.checkWatchdogDeadlines(ctx); err != nil {
+				logError("Error checking watchdog deadlines: %v", err)
+			}
+		}
+	}
+}
+
+func (a *App) checkWatchdogDeadlines(ctx context.Context) error {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	overdue, err := a.redisClient.ZRangeByScore(ctx, watchdogDeadlinesKey, &redis.ZRangeBy{Min: "-inf", Max: now}).Result()
+	if err != nil {
+		return fmt.Errorf("failed to read watchdog deadlines: %w", err)
+	}
+
+	// The queues are only read when a deployment is waiting to be picked up, and once per check
+	var queued map[string]bool
+	for _, id := range overdue {
+		// Only the instance that removes the deadline handles the timeout
+		removed, err := a.redisClient.ZRem(ctx, watchdogDeadlinesKey, id).Result()
+		if err != nil || removed == 0 {
+			continue
+		}
+
+		if waiting, err := a.redisClient.SIsMember(ctx, watchdogPickupKey, id).Result(); err == nil && waiting {
+			if queued == nil {
+				if queued, err = a.queuedDeploymentIDs(ctx); err != nil {
+					logError("Error reading queues for watchdog: %v", err)
+					queued = map[string]bool{}
+				}
+			}
+			a.checkPickup(ctx, id, queued[id])
+			continue
+		}
+
+		command, err := a.redisClient.HGet(ctx, watchdogAwaitingKey, id).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			logError("Error reading awaited step for deployment %s: %v", id, err)
+		}
+		a.redisClient.HDel(ctx, watchdogAwaitingKey, id)
+
+		logWarn("Deployment %s timed out waiting for output of %q", id, command)
+		reason := fmt.Sprintf("timed out waiting for output of %q", command)
+		if isCertificateCommand(command) {
+			reason = ":lock: timed out provisioning the certificate with " + strconv.Quote(command)
+		}
+		a.failDeployment(ctx, id, reason)
+	}
+
+	return nil
+}
+
+// checkPickup arms the first step's deadline once a worker has taken the deployment's command, and otherwise
+// looks again after watchdogInterval
+func (a *App) checkPickup(ctx context.Context, deploymentID string, queued bool) {
+	if queued {
+		if err := a.redisClient.ZAdd(ctx, watchdogDeadlinesKey, redis.Z{Score: float64(time.Now().Add(watchdogInterval).UnixMilli()), Member: deploymentID}).Err(); err != nil {
+			logError("Error re-arming watchdog for deployment %s: %v", deploymentID, err)
+		}
+		return
+	}
+	// Output of the first step may have armed the next deadline already
+	if removed, err := a.redisClient.SRem(ctx, watchdogPickupKey, deploymentID).Result(); err != nil || removed == 0 {
+		return
+	}
+	logDebug("Deployment %s was picked up by a worker", deploymentID)
+	a.armWatchdog(ctx, deploymentID, "")
+}
+
+// queuedDeploymentIDs returns the deployments with a command still waiting in a queue list
+func (a *App) queuedDeploymentIDs(ctx context.Context) (map[string]bool, error) {
+	entries, err := a.queuedEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		ids[entry.cmd.Metadata.DeploymentID] = true
+	}
+	return ids, nil
+}
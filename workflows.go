@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Workflows a reaction can start
+const (
+	// WorkflowDeploy fetches, builds and brings up the branch
+	WorkflowDeploy = "deploy"
+	// WorkflowRestart restarts the containers of whatever is currently deployed, without git or build steps
+	WorkflowRestart = "restart"
+)
+
+const RepeatReaction = "repeat"
+
+// RestartCommand is the only step of the restart workflow, and marks its completion
+const RestartCommand = "docker compose restart"
+
+// reactionWorkflows maps each trigger reaction to the workflow it starts
+var reactionWorkflows = map[string]string{
+	RocketReaction:      WorkflowDeploy,
+	RepeatReaction:      WorkflowRestart,
+	RewindReaction:      WorkflowRollback,
+	DiagnosticsReaction: WorkflowDiagnostics,
+	PromoteReaction:     WorkflowPromote,
+	DriftReaction:       WorkflowDrift,
+	ApplyReaction:       WorkflowInfraPlan,
+	DiscardReaction:     WorkflowInfraPlan,
+	KeepReaction:        WorkflowIdle,
+	// teardownReactions, on quota rejections
+	"one":   WorkflowTeardown,
+	"two":   WorkflowTeardown,
+	"three": WorkflowTeardown,
+	"four":  WorkflowTeardown,
+	"five":  WorkflowTeardown,
+	"six":   WorkflowTeardown,
+	"seven": WorkflowTeardown,
+	"eight": WorkflowTeardown,
+	"nine":  WorkflowTeardown,
+}
+
+// workflowSteps returns the pipeline for a workflow
+func workflowSteps(workflow string, metadata *PRMetadata, repoConfig RepoConfig, options DeployOptions, certificate string) []pipelineStep {
+	if options.Pipeline != nil {
+		return options.Pipeline.steps(metadata)
+	}
+	switch workflow {
+	case WorkflowRestart:
+		return []pipelineStep{
+			{"restart", RestartCommand},
+		}
+	default:
+		steps := []pipelineStep{
+			{"fetch", "git fetch origin"},
+			{"checkout", "git checkout " + shellQuote(metadata.Branch)},
+			{"pull", "git pull"},
+			{"sha", GitSHACommand},
+		}
+		// A workspace was created at the branch head, and another checkout may have the branch checked out
+		if options.Workspace != "" {
+			steps = []pipelineStep{
+				{"sha", GitSHACommand},
+			}
+		}
+		// A promotion deploys the commit that was tested, even if the branch has moved on since
+		if options.GitSHA != "" {
+			steps = []pipelineStep{
+				{"fetch", "git fetch origin"},
+				{"checkout", "git checkout --detach " + shellQuote(options.GitSHA)},
+				{"sha", GitSHACommand},
+			}
+		}
+		// A repository with its own steps runs them in place of the build and compose steps
+		if repoConfig.Commands.runsSteps() {
+			return append(steps, repoConfig.Commands.steps(metadata)...)
+		}
+		// Release deployments record their tags and lockfile hashes for the provenance manifest
+		steps = append(steps, repoConfig.Provenance.steps()...)
+		// The .env file has to exist before compose reads it to build and start the services
+		if envFile := repoConfig.envFileStep(options.Environment); envFile != "" {
+			steps = append(steps, pipelineStep{"env-file", envFile})
+		}
+		// Log in before the build so private base images can be pulled too
+		if login := repoConfig.Registry.loginStep(); login != "" {
+			steps = append(steps, pipelineStep{"login", login})
+		}
+		// A monorepo change limited to some services rebuilds and recreates only those, leaving the rest running
+		services := ""
+		if len(options.Services) > 0 {
+			services = " " + strings.Join(options.Services, " ")
+		}
+		// Pinned images are the ones that were tested, so they are pulled rather than rebuilt
+		flags := ""
+		if len(options.Images) > 0 {
+			steps = append(steps, pipelineStep{"pull-images", PullImagesCommand})
+			flags = " --no-build"
+		} else {
+			steps = append(steps, pipelineStep{"build", buildCommand(repoConfig.Build, options) + services})
+		}
+		// Images are scanned before they are pushed anywhere or brought up
+		if sbom := repoConfig.SecurityScan.sbomStep(); sbom != "" {
+			steps = append(steps, pipelineStep{"sbom", sbom})
+		}
+		if scan := repoConfig.SecurityScan.scanStep(); scan != "" {
+			steps = append(steps, pipelineStep{"scan", scan})
+		}
+		// Images were pushed when the commit was first deployed, so a promotion or rollback doesn't push them again
+		if options.PromotedFrom == "" && options.RolledBackFrom == "" {
+			for _, push := range repoConfig.Registry.pushSteps() {
+				steps = append(steps, pipelineStep{"push", push})
+			}
+		}
+		// A migration only cuts over once compose reports the new host's containers running and healthy
+		if options.MigratedFrom != "" {
+			flags += " --wait"
+		}
+		up := DeploymentCommand + flags + services
+		steps = append(steps, pipelineStep{"config-hash", ConfigHashCommand})
+		if services == "" {
+			steps = append(steps, pipelineStep{"down", "docker compose down"})
+		}
+		// The certificate has to be in place before the proxy starts serving the hostname
+		if certificate != "" {
+			steps = append(steps, pipelineStep{"tls", certificate})
+		}
+		steps = append(steps,
+			pipelineStep{"up", up},
+			pipelineStep{"images", ImagesCommand},
+			pipelineStep{"stats", StatsCommand},
+			// try commenting out checking out main,
+			// so that projects which rely on the feature branch files
+			// might work
+			// pipelineStep{"checkout-main", "git checkout main"},
+		)
+		// Digests let the next environment of the chain run exactly these images, and go in provenance manifests
+		if len(repoConfig.Environments) > 0 || repoConfig.Provenance != nil {
+			steps = append(steps, pipelineStep{"digests", DigestsCommand})
+		}
+		return steps
+	}
+}
+
+// isCompletionCommand reports whether a command's output means its workflow succeeded
+func isCompletionCommand(command string) bool {
+	return command == DeploymentCommand || strings.HasPrefix(command, DeploymentCommand+" ") || command == RestartCommand || command == TeardownCommand
+}
+
+// workflowOf returns the workflow a deployment ran; records from before workflows existed are deployments
+func workflowOf(d *Deployment) string {
+	if d.Workflow == "" {
+		return WorkflowDeploy
+	}
+	return d.Workflow
+}
+
+// currentDeployment returns the most recent successful full deployment of a repository, or nil if there is none.
+// With a promotion chain, only the first environment counts, since that is the checkout restarts run in;
+// deployments recorded before the chain was configured ran there too.
+func (a *App) currentDeployment(ctx context.Context, repo string) (*Deployment, error) {
+	history, err := a.deployments.List(ctx, repo, defaultHistoryLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load history for %s: %w", repo, err)
+	}
+	environment := a.repoConfig(repo).defaultEnvironment()
+	for _, d := range history {
+		if d.Status == StatusSucceeded && workflowOf(d) == WorkflowDeploy && (d.Environment == environment || d.Environment == "") {
+			return d, nil
+		}
+	}
+	return nil, nil
+}
+
+// startRestart restarts the containers of the repository's currently deployed ref
+func (a *App) startRestart(ctx context.Context, metadata *PRMetadata, channel, ts, user string) (*Deployment, error) {
+	current, err := a.currentDeployment(ctx, metadata.Repository)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		if postErr := a.postThreadMessage(ctx, channel, ts, fmt.Sprintf(":repeat: Nothing to restart: %s has no successful deployment yet.", metadata.Repository)); postErr != nil {
+			logError("Error posting restart notice: %v", postErr)
+		}
+		return nil, fmt.Errorf("no successful deployment of %s to restart", metadata.Repository)
+	}
+
+	// Restart what is running, which may be a different branch from the one in the message
+	if current.Branch != metadata.Branch {
+		text := fmt.Sprintf(":repeat: `%s` is not the deployed branch, restarting the currently deployed `%s` instead.", metadata.Branch, current.Branch)
+		if err := a.postThreadMessage(ctx, channel, ts, text); err != nil {
+			logError("Error posting restart notice: %v", err)
+		}
+	}
+	restart := &PRMetadata{Repository: current.Repository, Branch: current.Branch, PRNumber: current.PRNumber}
+
+	d, err := a.startWorkflow(ctx, WorkflowRestart, restart, DeployOptions{}, channel, ts, user)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := updateDeployment(ctx, a.deployments, d.ID, func(d *Deployment) {
+		d.Build.GitSHA = current.Build.GitSHA
+	}); err != nil {
+		logError("Error recording restarted ref for deployment %s: %v", d.ID, err)
+	}
+	return d, nil
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// workspacesKey is a Redis hash of deployment ID to the ephemeral workspace it runs in, until the workspace is torn down
+const workspacesKey = "vibedeploy:workspaces"
+
+// workspacePipelinesKey is a Redis hash of deployment ID to its pipeline (sealed like pending commands), which is
+// dispatched into the workspace once the checkout exists
+const workspacePipelinesKey = "vibedeploy:workspaces:pipelines"
+
+// workspacePrefix starts the directory name of each deployment's workspace in the repository's checkout
+const workspacePrefix = "deploy-"
+
+// WorkflowTeardown stops a workspace's stack and removes its checkout; its output belongs to no deployment
+const WorkflowTeardown = "teardown"
+
+// ComposeProjectEnvVar gives each workspace's stack a compose project of its own, so stacks don't replace each other
+const ComposeProjectEnvVar = "COMPOSE_PROJECT_NAME"
+
+// Commands that create and tear down workspaces, run from the repository's checkout
+const (
+	workspaceAddPrefix    = "git worktree add --detach "
+	workspaceRemovePrefix = "git worktree remove --force "
+	composeProjectPrefix  = "docker compose -p "
+	workspaceDownSuffix   = " down --remove-orphans --volumes"
+)
+
+// ErrWorkspaceNotFound is returned for a deployment without a workspace, or whose workspace was torn down
+var ErrWorkspaceNotFound = errors.New("workspace not found")
+
+// Workspace is a deployment's own checkout, a git worktree of the repository's checkout
+type Workspace struct {
+	DeploymentID string `json:"deployment_id"`
+	Repository   string `json:"repository"`
+	Branch       string `json:"branch"`
+	// Dir is the repository's checkout, and Name the workspace's directory in it
+	Dir         string    `json:"dir"`
+	Name        string    `json:"name"`
+	Project     string    `json:"project"`
+	Host        string    `json:"host,omitempty"`
+	TriggeredBy string    `json:"triggered_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// usesWorkspace reports whether a run gets an ephemeral workspace: feature deployments of repositories with
+// ephemeral_workspaces, to the first environment. A rollback replaces what the shared checkout runs.
+func (c RepoConfig) usesWorkspace(workflow string, options DeployOptions) bool {
+	return c.EphemeralWorkspaces && workflow == WorkflowDeploy && c.Infra == nil &&
+		options.PromotedFrom == "" && options.MigratedFrom == "" && options.RolledBackFrom == "" && c.environmentIndex(options.Environment) <= 0
+}
+
+// composeProjectName names a workspace's stack after the repository and deployment, e.g. "vibemerge-20261014t094220-bdfa595c"
+func composeProjectName(repo, id string) string {
+	name := repo[strings.LastIndex(repo, "/")+1:]
+	return strings.Trim(nonLabelChars.ReplaceAllString(strings.ToLower(name+"-"+id), "-"), "-")
+}
+
+// workspaceCommand creates the workspace from the branch head, before its pipeline is dispatched into it
+func workspaceCommand(w *Workspace, metadata *CommandMetadata) PoppitCommand {
+	cmd := PoppitCommand{
+		Repo:     w.Repository,
+		Branch:   w.Branch,
+		Type:     VibeDeployType,
+		Dir:      w.Dir,
+		Commands: []string{"git fetch origin", workspaceAddPrefix + w.Name + " " + shellQuote("origin/"+w.Branch)},
+		Metadata: metadata,
+	}
+	if w.Host != "" {
+		cmd.Env = map[string]string{HostEnvVar: w.Host}
+	}
+	return cmd
+}
+
+// workspacePipeline is what a workspace deployment's record tracks: creating the workspace, then the pipeline in it
+func workspacePipeline(prepare, cmd PoppitCommand, repoConfig RepoConfig, config Config) ([]string, map[string]int) {
+	pipeline := append(append([]string{}, prepare.Commands...), cmd.Commands...)
+	timeouts := make(map[string]int, len(cmd.Timeouts)+len(prepare.Commands))
+	for command, seconds := range cmd.Timeouts {
+		timeouts[command] = seconds
+	}
+	for i, name := range []string{"fetch", "workspace"} {
+		if timeout := repoConfig.stepTimeout(name, config.DefaultStepTimeout); timeout > 0 {
+			timeouts[prepare.Commands[i]] = int(timeout.Seconds())
+		}
+	}
+	return pipeline, timeouts
+}
+
+// openWorkspace records a deployment's workspace and keeps its pipeline until the workspace is created
+func (a *App) openWorkspace(ctx context.Context, w *Workspace, cmd PoppitCommand) error {
+	record, err := json.Marshal(w)
+	if err != nil {
+		return fmt.Errorf("failed to marshal workspace: %w", err)
+	}
+	payload, err := json.Marshal(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pipeline: %w", err)
+	}
+	if payload, err = a.cipher.seal(payload); err != nil {
+		return fmt.Errorf("failed to encrypt pipeline: %w", err)
+	}
+	pipe := a.redisClient.TxPipeline()
+	pipe.HSet(ctx, workspacesKey, w.DeploymentID, record)
+	pipe.HSet(ctx, workspacePipelinesKey, w.DeploymentID, payload)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record workspace: %w", err)
+	}
+	return nil
+}
+
+// continueWorkspace dispatches a deployment's pipeline into its workspace once the workspace is created
+func (a *App) continueWorkspace(ctx context.Context, output CommandOutput) {
+	if !strings.HasPrefix(output.Command, workspaceAddPrefix) {
+		return
+	}
+	id := output.Metadata.DeploymentID
+	payload, err := a.redisClient.HGet(ctx, workspacePipelinesKey, id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return
+	}
+	if err != nil {
+		logError("Error loading pipeline of deployment %s: %v", id, err)
+		return
+	}
+	// Only the instance that claims the pipeline dispatches it
+	if claimed, err := a.redisClient.HDel(ctx, workspacePipelinesKey, id).Result(); err != nil || claimed == 0 {
+		return
+	}
+	plaintext, err := a.cipher.open(payload)
+	if err != nil {
+		a.failDeployment(ctx, id, fmt.Sprintf("could not decrypt the pipeline: %v", err))
+		return
+	}
+	var cmd PoppitCommand
+	if err := json.Unmarshal(plaintext, &cmd); err != nil {
+		a.failDeployment(ctx, id, fmt.Sprintf("could not parse the pipeline: %v", err))
+		return
+	}
+
+	// The deployment holds its concurrency slot and watchdog from creating the workspace
+	executor, err := a.executorFor(cmd)
+	if err == nil {
+		err = executor.Execute(ctx, cmd)
+	}
+	if err != nil {
+		logError("Error dispatching pipeline of deployment %s into %s: %v", id, cmd.Dir, err)
+		a.failDeployment(ctx, id, fmt.Sprintf("could not dispatch into the workspace: %v", err))
+		return
+	}
+	logInfo("Dispatched pipeline of deployment %s into %s", id, cmd.Dir)
+}
+
+// closeWorkspaces tears down what a finished deployment leaves behind: its own workspace if it didn't succeed,
+// or the workspaces of the branch's earlier deployments, which it replaces, if it did
+func (a *App) closeWorkspaces(ctx context.Context, d *Deployment) {
+	if d.Workspace == "" {
+		return
+	}
+	if err := a.redisClient.HDel(ctx, workspacePipelinesKey, d.ID).Err(); err != nil {
+		logError("Error clearing pipeline of deployment %s: %v", d.ID, err)
+	}
+	if d.Status != StatusSucceeded {
+		if err := a.teardownWorkspace(ctx, d.ID); err != nil && !errors.Is(err, ErrWorkspaceNotFound) {
+			logError("Error tearing down workspace of deployment %s: %v", d.ID, err)
+		}
+		return
+	}
+
+	workspaces, err := a.listWorkspaces(ctx)
+	if err != nil {
+		logError("Error listing workspaces: %v", err)
+		return
+	}
+	for _, w := range workspaces {
+		if w.Repository != d.Repository || w.Branch != d.Branch || w.DeploymentID == d.ID || w.CreatedAt.After(d.StartedAt) {
+			continue
+		}
+		logInfo("Deployment %s replaces %s of %s (%s)", d.ID, w.DeploymentID, d.Repository, d.Branch)
+		if err := a.teardownWorkspace(ctx, w.DeploymentID); err != nil {
+			logError("Error tearing down workspace of deployment %s: %v", w.DeploymentID, err)
+		}
+	}
+}
+
+// getWorkspace returns a deployment's workspace, or ErrWorkspaceNotFound
+func (a *App) getWorkspace(ctx context.Context, id string) (*Workspace, error) {
+	data, err := a.redisClient.HGet(ctx, workspacesKey, id).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load workspace: %w", err)
+	}
+	var w Workspace
+	if err := json.Unmarshal([]byte(data), &w); err != nil {
+		return nil, fmt.Errorf("failed to parse workspace: %w", err)
+	}
+	return &w, nil
+}
+
+// listWorkspaces returns every workspace that hasn't been torn down, oldest first
+func (a *App) listWorkspaces(ctx context.Context) ([]*Workspace, error) {
+	entries, err := a.redisClient.HGetAll(ctx, workspacesKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workspaces: %w", err)
+	}
+	workspaces := make([]*Workspace, 0, len(entries))
+	for id, data := range entries {
+		var w Workspace
+		if err := json.Unmarshal([]byte(data), &w); err != nil {
+			logWarn("Skipping workspace of deployment %s: %v", id, err)
+			continue
+		}
+		workspaces = append(workspaces, &w)
+	}
+	sort.Slice(workspaces, func(i, j int) bool { return workspaces[i].CreatedAt.Before(workspaces[j].CreatedAt) })
+	return workspaces, nil
+}
+
+// teardownWorkspace stops a workspace's stack, removes its checkout, and returns its port, hostname and route
+func (a *App) teardownWorkspace(ctx context.Context, id string) error {
+	w, err := a.getWorkspace(ctx, id)
+	if err != nil {
+		return err
+	}
+	cmd := PoppitCommand{
+		Repo:   w.Repository,
+		Branch: w.Branch,
+		Type:   VibeDeployType,
+		Dir:    w.Dir,
+		Commands: []string{
+			composeProjectPrefix + w.Project + workspaceDownSuffix,
+			workspaceRemovePrefix + w.Name,
+		},
+		Metadata: &CommandMetadata{Workflow: WorkflowTeardown},
+	}
+	if w.Host != "" {
+		cmd.Env = map[string]string{HostEnvVar: w.Host}
+	}
+	if a.policy != nil {
+		if err := a.policy.check(cmd); err != nil {
+			return err
+		}
+	}
+	executor, err := a.executorFor(cmd)
+	if err == nil {
+		err = executor.Execute(ctx, cmd)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to dispatch teardown: %w", err)
+	}
+
+	pipe := a.redisClient.TxPipeline()
+	pipe.HDel(ctx, workspacesKey, id)
+	pipe.HDel(ctx, workspaceActivityKey, id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logError("Error removing workspace of deployment %s: %v", id, err)
+	}
+	key := allocationKey(w.Repository, w.Name)
+	if err := a.redisClient.HDel(ctx, poolAllocationsKey, key).Err(); err != nil {
+		logError("Error releasing allocation of %s: %v", key, err)
+	}
+	if a.proxy != nil {
+		if err := a.proxy.Remove(ctx, key); err != nil {
+			logError("Error removing %s route of %s: %v", a.proxy.Name(), key, err)
+		}
+	}
+	logInfo("Tearing down workspace %s of %s (%s)", w.Name, w.Repository, w.Branch)
+	return nil
+}
+
+// handleListWorkspaces serves GET /api/workspaces
+func (a *App) handleListWorkspaces(w http.ResponseWriter, r *http.Request) {
+	workspaces, err := a.listWorkspaces(r.Context())
+	if err != nil {
+		logError("Error listing workspaces: %v", err)
+		http.Error(w, "failed to list workspaces", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, workspaces)
+}
+
+// handleTeardownWorkspace serves DELETE /api/workspaces/{id}
+func (a *App) handleTeardownWorkspace(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	workspace, err := a.getWorkspace(r.Context(), id)
+	if errors.Is(err, ErrWorkspaceNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logError("Error loading workspace of deployment %s: %v", id, err)
+		http.Error(w, "failed to load workspace", http.StatusInternalServerError)
+		return
+	}
+	if !a.authorizeRequest(w, r, ActionDeploy, workspace.Repository) {
+		return
+	}
+
+	logInfo("HTTP teardown of workspace of deployment %s", id)
+	if err := a.teardownWorkspace(r.Context(), id); err != nil {
+		logError("Error tearing down workspace of deployment %s: %v", id, err)
+		http.Error(w, "failed to tear down workspace", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}